@@ -0,0 +1,38 @@
+"""Tour departures — shared seat inventory for the bookings service
+
+Revision ID: 0002
+Revises: 0001
+Create Date: 2026-10-16
+"""
+from typing import Sequence, Union
+
+from alembic import op
+import sqlalchemy as sa
+
+revision: str = "0002"
+down_revision: Union[str, None] = "0001"
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+
+def upgrade() -> None:
+    # ── Tour Departures ──
+    # One row per dated run of a tour. booked counts every seat the bookings
+    # service has taken, by guest bookings and agency holds alike; seats are
+    # reserved with a conditional UPDATE on the row so concurrent replicas
+    # can never sell more than capacity.
+    op.create_table(
+        "tour_departures",
+        sa.Column("tour_id", sa.String(100), primary_key=True),
+        sa.Column("date", sa.Date(), primary_key=True),
+        sa.Column("slot", sa.String(5), primary_key=True, server_default=""),
+        sa.Column("capacity", sa.Integer(), nullable=False),
+        sa.Column("booked", sa.Integer(), nullable=False, server_default="0"),
+        sa.Column("created_at", sa.DateTime(), server_default=sa.func.now()),
+        sa.Column("updated_at", sa.DateTime(), server_default=sa.func.now()),
+        sa.CheckConstraint("booked >= 0", name="ck_tour_departures_booked_nonnegative"),
+    )
+
+
+def downgrade() -> None:
+    op.drop_table("tour_departures")
@@ -7,7 +7,9 @@ from datetime import datetime
 from uuid import uuid4
 
 from sqlalchemy import (
+    CheckConstraint,
     Column,
+    Date,
     DateTime,
     Float,
     ForeignKey,
@@ -252,6 +254,23 @@ class Tour(Base):
     updated_at = Column(DateTime, default=datetime.utcnow, onupdate=datetime.utcnow)
 
 
+class TourDeparture(Base):
+    """Seat inventory for one dated run of a tour, owned by the bookings service."""
+
+    __tablename__ = "tour_departures"
+    __table_args__ = (
+        CheckConstraint("booked >= 0", name="ck_tour_departures_booked_nonnegative"),
+    )
+
+    tour_id = Column(String(100), primary_key=True)
+    date = Column(Date, primary_key=True)
+    slot = Column(String(5), primary_key=True, default="")
+    capacity = Column(Integer, nullable=False)
+    booked = Column(Integer, nullable=False, default=0)
+    created_at = Column(DateTime, default=datetime.utcnow)
+    updated_at = Column(DateTime, default=datetime.utcnow, onupdate=datetime.utcnow)
+
+
 # ── Content Models ───────────────────────────────────
 
 
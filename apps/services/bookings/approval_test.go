@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func seedPendingTour(t *testing.T, s *server, party int) Booking {
+	t.Helper()
+	b, err := s.store.AddBooking(Booking{
+		Kind: KindTour, OfferingID: "volcano-hike", Date: "2026-03-14", PartySize: party, GuestEmail: "ana@example.com",
+	}, s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPaymentBelowThresholdConfirms(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.ApprovalThresholdCents = 100000
+	b := seedPendingTour(t, s, 2)
+
+	var got Booking
+	doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_1", "amount_cents": 15000, "currency": "USD",
+	}, &got)
+	if got.Status != StatusConfirmed {
+		t.Fatalf("status %s, want confirmed", got.Status)
+	}
+}
+
+func TestHighValueBookingApproved(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.ApprovalThresholdCents = 100000
+	s.cfg.StaffAPIKey = "staff-key"
+	h := s.routes()
+	b := seedPendingTour(t, s, 4)
+
+	var got Booking
+	doService(t, h, http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_2", "amount_cents": 250000, "currency": "USD",
+	}, &got)
+	if got.Status != StatusPendingApproval {
+		t.Fatalf("after payment: status %s, want pending_approval", got.Status)
+	}
+
+	rec := doJSONAs(t, "staff-key", h, http.MethodPost, "/api/bookings/"+b.ID+"/approve", map[string]string{"staff_id": "maria"}, &got)
+	if rec.Code != http.StatusOK || got.Status != StatusConfirmed || got.ReviewedBy != "maria" {
+		t.Fatalf("approve: status %d booking %+v", rec.Code, got)
+	}
+	if refunds := s.payments.(*fakePayments).refunds; len(refunds) != 0 {
+		t.Fatalf("approved booking issued %d refunds", len(refunds))
+	}
+}
+
+func TestHighValueBookingRejectedRefunds(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.ApprovalThresholdCents = 100000
+	s.cfg.StaffAPIKey = "staff-key"
+	h := s.routes()
+	b := seedPendingTour(t, s, 4)
+
+	doService(t, h, http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_3", "amount_cents": 250000, "currency": "USD",
+	}, nil)
+
+	var resp struct {
+		Booking      Booking `json:"booking"`
+		RefundStatus string  `json:"refund_status"`
+	}
+	doJSONAs(t, "staff-key", h, http.MethodPost, "/api/bookings/"+b.ID+"/reject", map[string]string{"staff_id": "maria", "reason": "suspected fraud"}, &resp)
+	if resp.Booking.Status != StatusRejected || resp.RefundStatus != "requested" {
+		t.Fatalf("reject: got %+v", resp)
+	}
+	refunds := s.payments.(*fakePayments).refunds
+	if len(refunds) != 1 || refunds[0].PaymentRef != "cs_3" || refunds[0].AmountCents != 250000 {
+		t.Fatalf("refunds = %+v, want one full refund of cs_3", refunds)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 0 {
+		t.Fatalf("rejected booking still holds %d seats", d.Booked)
+	}
+}
+
+func TestPaymentRecheckConfirmsWhenSeatsHeld(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPendingTour(t, s, 4)
+
+	var got Booking
+	doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_ok", "amount_cents": 20000, "currency": "USD",
+	}, &got)
+	if got.Status != StatusConfirmed {
+		t.Fatalf("status %s, want confirmed", got.Status)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 4 {
+		t.Fatalf("booked = %d, want 4", d.Booked)
+	}
+	if refunds := s.payments.(*fakePayments).refunds; len(refunds) != 0 {
+		t.Fatalf("confirmed booking issued %d refunds", len(refunds))
+	}
+}
+
+func TestPaymentAfterLostCapacityRefunds(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPendingTour(t, s, 4)
+
+	// The operator cut the departure to a smaller vehicle while the guest
+	// was on the checkout page.
+	s.store.mu.Lock()
+	s.store.departures[departureKey{"volcano-hike", "2026-03-14", ""}].Capacity = 2
+	s.store.mu.Unlock()
+
+	var got Booking
+	rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_late", "amount_cents": 20000, "currency": "USD",
+	}, &got)
+	if rec.Code != http.StatusOK || got.Status != StatusFailedNoCapacity {
+		t.Fatalf("status %d booking %+v, want failed_no_capacity", rec.Code, got)
+	}
+
+	refunds := s.payments.(*fakePayments).refunds
+	// The guest's email lets payments refund a Lightning payment to their
+	// saved Lightning Address.
+	if len(refunds) != 1 || refunds[0].PaymentRef != "cs_late" || refunds[0].AmountCents != 20000 || refunds[0].Reason != "no_capacity" || refunds[0].GuestEmail != "ana@example.com" {
+		t.Fatalf("refunds = %+v", refunds)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 0 {
+		t.Fatalf("booked = %d, want seats released", d.Booked)
+	}
+	emails := sentMessages(s).emails
+	if len(emails) != 1 || emails[0].Subject != "We couldn't complete your booking" {
+		t.Fatalf("emails = %+v", emails)
+	}
+}
+
+func TestConfirmBookingRacingRailsConfirmsOnce(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPendingTour(t, s, 2)
+
+	// A card payment and a Lightning invoice settle for the same booking at
+	// once.
+	refs := []string{"cs_race", "lnd_race"}
+	errs := make([]error, len(refs))
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = s.ConfirmBooking(context.Background(), b.ID, PaymentDetails{Kind: TxnPayment, Ref: ref, AmountCents: 9000, Currency: "USD"})
+		}()
+	}
+	wg.Wait()
+
+	var confirmed int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			confirmed++
+		case !errors.Is(err, ErrInvalidTransition):
+			t.Fatalf("losing rail: %v, want ErrInvalidTransition", err)
+		}
+	}
+	got, _ := s.store.Booking(b.ID)
+	if confirmed != 1 || got.Status != StatusConfirmed || len(got.Transactions) != 1 || got.PaymentRef != got.Transactions[0].Ref {
+		t.Fatalf("%d confirmations, booking %+v; want one", confirmed, got)
+	}
+	if n := len(sentMessages(s).emails); n != 1 {
+		t.Fatalf("%d confirmation emails, want 1", n)
+	}
+}
+
+func TestConfirmBookingIgnoresRedeliveredPayment(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPendingTour(t, s, 2)
+	payment := PaymentDetails{Kind: TxnPayment, Ref: "cs_1", AmountCents: 9000, Currency: "USD"}
+
+	if _, err := s.ConfirmBooking(context.Background(), b.ID, payment); err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.ConfirmBooking(context.Background(), b.ID, payment)
+	if !errors.Is(err, ErrPaymentRecorded) || again.Status != StatusConfirmed || len(again.Transactions) != 1 {
+		t.Fatalf("redelivery: %v, booking %+v; want it left as confirmed", err, again)
+	}
+	rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_1", "amount_cents": 9000, "currency": "USD",
+	}, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("redelivered notice: status %d, want 409", rec.Code)
+	}
+	if n := len(sentMessages(s).emails); n != 1 {
+		t.Fatalf("%d confirmation emails, want 1", n)
+	}
+}
+
+func TestPaymentAndReviewNeedCredentials(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.ApprovalThresholdCents = 100000
+	s.cfg.StaffAPIKey = "staff-key"
+	h := s.routes()
+	b := seedPendingTour(t, s, 4)
+	payment := map[string]interface{}{"payment_ref": "cs_4", "amount_cents": 250000, "currency": "USD"}
+
+	// A guest, or staff, cannot mark a booking paid; only payments can.
+	for _, token := range []string{"", "staff-key"} {
+		if rec := doJSONAs(t, token, h, http.MethodPost, "/api/bookings/"+b.ID+"/payment", payment, nil); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("payment with %q: status %d, want 401", token, rec.Code)
+		}
+	}
+	doService(t, h, http.MethodPost, "/api/bookings/"+b.ID+"/payment", payment, nil)
+
+	review := map[string]string{"staff_id": "maria"}
+	for _, action := range []string{"approve", "reject"} {
+		for _, token := range []string{"", testServiceKey} {
+			if rec := doJSONAs(t, token, h, http.MethodPost, "/api/bookings/"+b.ID+"/"+action, review, nil); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("%s with %q: status %d, want 401", action, token, rec.Code)
+			}
+		}
+	}
+	if got, _ := s.store.Booking(b.ID); got.Status != StatusPendingApproval {
+		t.Fatalf("status %s, want still pending_approval", got.Status)
+	}
+}
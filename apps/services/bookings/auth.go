@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// role is a class of operator allowed onto restricted routes.
+type role string
+
+const (
+	roleStaff role = "staff"
+	roleGuide role = "guide"
+	// roleAgency is a travel agency selling seats from its blocks.
+	roleAgency role = "agency"
+	// roleService is a sibling service, such as payments reporting the
+	// outcome of a charge.
+	roleService role = "service"
+)
+
+// apiKey returns the bearer token configured for r, or "" if none is.
+func (s *server) apiKey(r role) string {
+	switch r {
+	case roleStaff:
+		return s.cfg.StaffAPIKey
+	case roleGuide:
+		return s.cfg.GuideAPIKey
+	case roleAgency:
+		return s.cfg.AgencyAPIKey
+	case roleService:
+		return s.cfg.ServiceAPIKey
+	}
+	return ""
+}
+
+// requireRole rejects requests that do not carry the API key of one of roles
+// as a bearer token. A role with no key configured never matches.
+func (s *server) requireRole(roles ...role) func(http.Handler) http.Handler {
+	names := make([]string, len(roles))
+	for i, ro := range roles {
+		names[i] = string(ro)
+	}
+	need := strings.Join(names, " or ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !s.hasRole(r, roles...) {
+				respondError(w, http.StatusUnauthorized, "unauthorized", need+" credentials required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasRole reports whether r carries the API key of one of roles as a bearer
+// token.
+func (s *server) hasRole(r *http.Request, roles ...role) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	for _, ro := range roles {
+		if key := s.apiKey(ro); key != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// maxBulkAvailabilityProperties bounds one bulk availability request.
+const maxBulkAvailabilityProperties = 50
+
+// availabilityCoalescer shares one availability computation between
+// identical requests for the same property and window that are in flight at
+// once, as when a burst of search page loads ask for the same dates. Callers
+// sharing a result must not modify it.
+type availabilityCoalescer struct {
+	group   singleflight.Group
+	compute func(propertyID string, from, to time.Time) []NightAvailability
+}
+
+func newAvailabilityCoalescer(compute func(propertyID string, from, to time.Time) []NightAvailability) *availabilityCoalescer {
+	return &availabilityCoalescer{compute: compute}
+}
+
+// Nights lists each night of the property in [from, to).
+func (c *availabilityCoalescer) Nights(propertyID string, from, to time.Time) []NightAvailability {
+	key := propertyID + "|" + from.Format(time.DateOnly) + "|" + to.Format(time.DateOnly)
+	v, _, _ := c.group.Do(key, func() (interface{}, error) {
+		return c.compute(propertyID, from, to), nil
+	})
+	return v.([]NightAvailability)
+}
+
+// bulkRentalAvailabilityHandler lists each night in ?from= up to ?to= for
+// every property in ?property_ids= (comma-separated), keyed by property.
+func (s *server) bulkRentalAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseNights(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid_range", "from and to must be formatted YYYY-MM-DD with to after from")
+		return
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(r.URL.Query().Get("property_ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxBulkAvailabilityProperties {
+		respondError(w, http.StatusBadRequest, "invalid_properties", "property_ids must list between 1 and 50 properties")
+		return
+	}
+	properties := make(map[string][]NightAvailability, len(ids))
+	for _, id := range ids {
+		properties[id] = s.availability.Nights(id, from, to)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from":       from.Format(time.DateOnly),
+		"to":         to.Format(time.DateOnly),
+		"properties": properties,
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdenticalAvailabilityRequestsShareOneComputation(t *testing.T) {
+	s, _ := newTestServer(t)
+	if _, rec := bookStay(t, s, "2026-04-02", "2026-04-04"); rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The computation holds until every request has had time to arrive,
+	// so they all overlap it.
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	s.availability.compute = func(propertyID string, from, to time.Time) []NightAvailability {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return s.store.RentalAvailability(propertyID, from, to)
+	}
+
+	const requests = 20
+	h := s.routes()
+	codes := make([]int, requests)
+	bodies := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := "/api/bookings/rentals/availability?property_ids=casa-suchitoto&from=2026-04-01&to=2026-04-06"
+			if i%2 == 1 {
+				path = "/api/bookings/rentals/casa-suchitoto/availability?from=2026-04-01&to=2026-04-06"
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			codes[i], bodies[i] = rec.Code, rec.Body.String()
+		}(i)
+	}
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("availability computed %d times for %d identical requests, want once", n, requests)
+	}
+	for i := range codes {
+		if codes[i] != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i, codes[i], bodies[i])
+		}
+	}
+	var bulk struct {
+		Properties map[string][]NightAvailability `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &bulk); err != nil {
+		t.Fatal(err)
+	}
+	nights := bulk.Properties["casa-suchitoto"]
+	if len(nights) != 5 || !nights[0].Available || nights[1].Available {
+		t.Fatalf("nights = %+v, want 5 with the booked stay unavailable", nights)
+	}
+
+	// A different window is computed on its own.
+	availability(t, s, "2026-04-01", "2026-04-03")
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("computations = %d after a new window, want 2", n)
+	}
+}
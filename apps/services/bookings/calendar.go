@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// calendarPriceConcurrency bounds how many quotes one calendar asks the
+// pricing service for at once.
+const calendarPriceConcurrency = 8
+
+// CalendarDeparture is one departure on a tour's calendar. Available means
+// it has seats for the whole party, and only available departures are
+// priced. A departure the pricing service could not quote, or quoted
+// nothing for, has no price or currency.
+type CalendarDeparture struct {
+	Slot       string `json:"slot,omitempty"`
+	Capacity   int    `json:"capacity"`
+	SeatsLeft  int    `json:"seats_left"`
+	SoldOut    bool   `json:"sold_out"`
+	Available  bool   `json:"available"`
+	PriceCents int64  `json:"price_cents,omitempty"`
+	Currency   string `json:"currency,omitempty"`
+}
+
+// CalendarDay is a date on a tour's calendar with its departures in slot
+// order.
+type CalendarDay struct {
+	Date       string              `json:"date"`
+	Departures []CalendarDeparture `json:"departures"`
+}
+
+// TourDepartures returns a tour's departures from one date to another,
+// inclusive, in date and slot order. Departures its schedule template
+// would run but that have not been materialized are included at the
+// template's capacity; none are created.
+func (s *Store) TourDepartures(tourID string, from, to time.Time) []Departure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first, last := from.Format(time.DateOnly), to.Format(time.DateOnly)
+	var out []Departure
+	for key, d := range s.departures {
+		if key.TourID == tourID && key.Date >= first && key.Date <= last {
+			out = append(out, *d)
+		}
+	}
+	if t, ok := s.templates[tourID]; ok {
+		for _, key := range t.slots(from, to) {
+			if _, ok := s.departures[key]; !ok {
+				out = append(out, Departure{TourID: key.TourID, Date: key.Date, Slot: key.Slot, Capacity: t.Capacity})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Date != out[j].Date {
+			return out[i].Date < out[j].Date
+		}
+		return out[i].Slot < out[j].Slot
+	})
+	return out
+}
+
+// tourCalendar lays departures out by date with their seats left and, for
+// those the party fits, the pricing service's quote. Quotes are fetched
+// concurrently.
+func (s *server) tourCalendar(ctx context.Context, departures []Departure, partySize int) []CalendarDay {
+	entries := make([]CalendarDeparture, len(departures))
+	sem := make(chan struct{}, calendarPriceConcurrency)
+	var wg sync.WaitGroup
+	for i, d := range departures {
+		left := max(0, d.Remaining())
+		entries[i] = CalendarDeparture{
+			Slot:      d.Slot,
+			Capacity:  d.Capacity,
+			SeatsLeft: left,
+			SoldOut:   left == 0,
+			Available: left >= partySize,
+		}
+		if !entries[i].Available {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			price, err := s.pricing.TourPrice(ctx, d.TourID, d.Date, d.Slot, partySize)
+			if err != nil {
+				log.Printf("pricing calendar departure %s %s %s: %v", d.TourID, d.Date, d.Slot, err)
+				return
+			}
+			// The pricing service answers a zero price for tours it has
+			// no pricing for; that is not a free departure.
+			if price.AmountCents <= 0 {
+				return
+			}
+			entries[i].PriceCents, entries[i].Currency = price.AmountCents, price.Currency
+		}()
+	}
+	wg.Wait()
+
+	days := []CalendarDay{}
+	for i, d := range departures {
+		if len(days) == 0 || days[len(days)-1].Date != d.Date {
+			days = append(days, CalendarDay{Date: d.Date})
+		}
+		day := &days[len(days)-1]
+		day.Departures = append(day.Departures, entries[i])
+	}
+	return days
+}
+
+// tourCalendarHandler lists a month of a tour's upcoming departures, given
+// as ?month=YYYY-MM and defaulting to the current one, with seats left and
+// the price for ?party_size= guests (default 1).
+func (s *server) tourCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	now := s.now()
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		month = now.Format("2006-01")
+	}
+	first, err := time.Parse("2006-01", month)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_month", "month must be formatted YYYY-MM")
+		return
+	}
+	partySize := 1
+	if v := r.URL.Query().Get("party_size"); v != "" {
+		if partySize, err = strconv.Atoi(v); err != nil || partySize < 1 {
+			respondError(w, http.StatusBadRequest, "invalid_party_size", "party_size must be a positive number")
+			return
+		}
+	}
+
+	tourID := chi.URLParam(r, "tourId")
+	var upcoming []Departure
+	for _, d := range s.store.TourDepartures(tourID, first, first.AddDate(0, 1, -1)) {
+		if !(Booking{Date: d.Date, Slot: d.Slot}).departed(now) {
+			upcoming = append(upcoming, d)
+		}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tour_id":    tourID,
+		"month":      first.Format("2006-01"),
+		"party_size": partySize,
+		"days":       s.tourCalendar(r.Context(), upcoming, partySize),
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type calendarResponse struct {
+	TourID    string        `json:"tour_id"`
+	Month     string        `json:"month"`
+	PartySize int           `json:"party_size"`
+	Days      []CalendarDay `json:"days"`
+}
+
+func TestTourCalendarListsSeatsAndPrices(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.pricing = &fakePricing{price: Price{AmountCents: 4500, Currency: "USD"}, dateCents: map[string]int64{"2026-03-21": 6000}}
+	// The tour runs Saturdays at 08:00 with four seats.
+	s.store.SetScheduleTemplate(ScheduleTemplate{TourID: "volcano-hike", Weekdays: []string{"sat"}, Times: []string{"08:00"}, Capacity: 4})
+	s.store.EnsureDepartures([]departureKey{{"volcano-hike", "2026-03-14", "08:00"}, {"volcano-hike", "2026-03-01", "08:00"}}, 4)
+	// An extra afternoon departure, outside the template, and the 14th sold out.
+	for _, b := range []Booking{
+		{Kind: KindTour, OfferingID: "volcano-hike", Date: "2026-03-10", Slot: "15:00", PartySize: 1},
+		{Kind: KindTour, OfferingID: "volcano-hike", Date: "2026-03-14", Slot: "08:00", PartySize: 4},
+		{Kind: KindTour, OfferingID: "volcano-hike", Date: "2026-04-04", Slot: "08:00", PartySize: 1},
+	} {
+		if _, err := s.store.AddBooking(b, s.now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock.advance(12 * time.Hour)
+
+	var resp calendarResponse
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours/volcano-hike/calendar?month=2026-03&party_size=2", nil, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Month != "2026-03" || resp.PartySize != 2 {
+		t.Fatalf("response %+v", resp)
+	}
+	// By the afternoon of the 1st its 08:00 departure has left, and April
+	// is another month.
+	want := []struct {
+		date      string
+		slot      string
+		seatsLeft int
+		soldOut   bool
+		price     int64
+	}{
+		{"2026-03-07", "08:00", 4, false, 9000},
+		{"2026-03-10", "15:00", 11, false, 9000},
+		{"2026-03-14", "08:00", 0, true, 0},
+		{"2026-03-21", "08:00", 4, false, 12000},
+		{"2026-03-28", "08:00", 4, false, 9000},
+	}
+	if len(resp.Days) != len(want) {
+		t.Fatalf("days %+v, want %d", resp.Days, len(want))
+	}
+	for i, w := range want {
+		day := resp.Days[i]
+		if day.Date != w.date || len(day.Departures) != 1 {
+			t.Fatalf("day %d = %+v, want one departure on %s", i, day, w.date)
+		}
+		d := day.Departures[0]
+		if d.Slot != w.slot || d.SeatsLeft != w.seatsLeft || d.SoldOut != w.soldOut || d.Available == w.soldOut || d.PriceCents != w.price {
+			t.Errorf("%s departure = %+v, want slot %s, %d left, sold out %v, price %d", w.date, d, w.slot, w.seatsLeft, w.soldOut, w.price)
+		}
+		if w.price != 0 && d.Currency != "USD" {
+			t.Errorf("%s currency = %q", w.date, d.Currency)
+		}
+	}
+	// Reading the calendar does not create the template's departures.
+	if got := len(s.store.OpenDepartures("2026-03-21", "2026-03-21", 1)); got != 0 {
+		t.Fatalf("calendar materialized %d departures", got)
+	}
+}
+
+func TestTourCalendarRejectsBadMonth(t *testing.T) {
+	s, _ := newTestServer(t)
+	for _, q := range []string{"?month=2026-3", "?month=march", "?month=2026-03&party_size=0"} {
+		if rec := doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours/volcano-hike/calendar"+q, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+}
+
+func TestTourCalendarLeavesZeroQuotesUnpriced(t *testing.T) {
+	s, _ := newTestServer(t)
+	// The pricing service's tour endpoint, which quotes zero for tours it
+	// does not price yet.
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RequestURI())
+		json.NewEncoder(w).Encode(map[string]interface{}{"tour_id": "volcano-hike", "price_cents": 0, "currency": "USD"})
+	}))
+	t.Cleanup(srv.Close)
+	s.pricing = newHTTPPricingClient(srv.URL)
+	s.store.EnsureDepartures([]departureKey{{"volcano-hike", "2026-03-14", "08:00"}}, 4)
+
+	var resp calendarResponse
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours/volcano-hike/calendar?month=2026-03&party_size=2", nil, &resp)
+	if rec.Code != http.StatusOK || len(resp.Days) != 1 {
+		t.Fatalf("status %d days %+v", rec.Code, resp.Days)
+	}
+	if d := resp.Days[0].Departures[0]; !d.Available || d.PriceCents != 0 || d.Currency != "" {
+		t.Fatalf("departure = %+v, want available with no price or currency", d)
+	}
+	if len(queries) != 1 || queries[0] != "/api/pricing/tour/volcano-hike?date=2026-03-14&party_size=2&slot=08%3A00" {
+		t.Fatalf("pricing queried %v", queries)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// localZone is El Salvador's time zone, in which departure dates and slots
+// are written. The country does not observe daylight saving time.
+var localZone = time.FixedZone("America/El_Salvador", -6*60*60)
+
+// RefundTier refunds Rate of the amount paid when a booking is cancelled at
+// least MinNotice before it starts.
+type RefundTier struct {
+	MinNotice time.Duration
+	Rate      apitypes.Percent
+}
+
+// CancellationPolicy is a rate plan's refund schedule. Tiers are ordered by
+// decreasing notice; the first one met applies and later cancellations get
+// nothing back.
+type CancellationPolicy struct {
+	Tiers []RefundTier
+}
+
+// defaultRatePlan is the plan bookings without one are sold under.
+const defaultRatePlan = "standard"
+
+// cancellationPolicies maps each rate plan to its refund schedule.
+var cancellationPolicies = map[string]CancellationPolicy{
+	"flexible": {Tiers: []RefundTier{
+		{MinNotice: 24 * time.Hour, Rate: apitypes.HundredPercent},
+	}},
+	"standard": {Tiers: []RefundTier{
+		{MinNotice: 7 * 24 * time.Hour, Rate: apitypes.HundredPercent},
+		{MinNotice: 48 * time.Hour, Rate: 50 * apitypes.OnePercent},
+	}},
+	"non_refundable": {},
+}
+
+// Refund rules reported with a RefundDecision.
+const (
+	RefundRuleCoolingOff = "cooling_off"
+	RefundRulePolicy     = "policy"
+	RefundRuleUnpaid     = "unpaid"
+)
+
+// RefundDecision is what a guest gets back for cancelling, and why.
+type RefundDecision struct {
+	AmountCents int64            `json:"amount_cents"`
+	Currency    string           `json:"currency,omitempty"`
+	Rate        apitypes.Percent `json:"rate"`
+	Rule        string           `json:"rule"`
+	RatePlan    string           `json:"rate_plan"`
+}
+
+// startsAt is when a booking begins in local time: its slot on its date, or
+// the start of the day when it has no slot.
+func (b Booking) startsAt() (time.Time, error) {
+	if b.Slot == "" {
+		return time.ParseInLocation(time.DateOnly, b.Date, localZone)
+	}
+	return time.ParseInLocation(time.DateOnly+" 15:04", b.Date+" "+b.Slot, localZone)
+}
+
+// departed reports whether b's departure has gone by at now: its slot has
+// started, or, without a slot, its date is before today in local time.
+func (b Booking) departed(now time.Time) bool {
+	start, err := b.startsAt()
+	if err != nil {
+		return false
+	}
+	if b.Slot == "" {
+		return start.AddDate(0, 0, 1).Compare(now) <= 0
+	}
+	return !now.Before(start)
+}
+
+// computeRefund decides the refund for cancelling b at now. Within
+// coolingOff of the booking being made the guest gets everything back,
+// whatever the rate plan says; a zero coolingOff disables that right.
+func computeRefund(b Booking, now time.Time, coolingOff time.Duration) RefundDecision {
+	plan := b.RatePlan
+	if plan == "" {
+		plan = defaultRatePlan
+	}
+	d := RefundDecision{Currency: b.Currency, RatePlan: plan, Rule: RefundRulePolicy}
+	if b.PaymentRef == "" {
+		d.Rule = RefundRuleUnpaid
+		return d
+	}
+
+	switch {
+	case coolingOff > 0 && now.Before(b.CreatedAt.Add(coolingOff)):
+		d.Rule, d.Rate = RefundRuleCoolingOff, apitypes.HundredPercent
+	default:
+		start, err := b.startsAt()
+		if err != nil {
+			// Without a start time no notice can be proven; treat the
+			// cancellation as last-minute.
+			start = now
+		}
+		notice := start.Sub(now)
+		for _, tier := range cancellationPolicies[plan].Tiers {
+			if notice >= tier.MinNotice {
+				d.Rate = tier.Rate
+				break
+			}
+		}
+	}
+	d.AmountCents = d.Rate.Of(b.AmountCents - b.refundedCents())
+	return d
+}
+
+// CancelDeparture cancels every booking still expected on a tour departure,
+// as when staff call it off for weather, and returns them.
+func (s *Store) CancelDeparture(tourID, date, slot string, now time.Time) []Booking {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := departureKey{tourID, date, slot}
+	var cancelled []Booking
+	for _, b := range s.bookings {
+		if b.Kind != KindTour || (departureKey{b.OfferingID, b.Date, b.Slot}) != key {
+			continue
+		}
+		switch b.Status {
+		case StatusPending, StatusPendingApproval, StatusConfirmed:
+		default:
+			continue
+		}
+		s.releaseBookingLocked(b)
+		b.Status = StatusCancelled
+		b.UpdatedAt = apitypes.JSONTime{Time: now}
+		cancelled = append(cancelled, *b)
+	}
+	sort.Slice(cancelled, func(i, j int) bool { return cancelled[i].ID < cancelled[j].ID })
+	return cancelled
+}
+
+// operatorCancellation is the outcome for one booking on a cancelled
+// departure.
+type operatorCancellation struct {
+	BookingID    string `json:"booking_id"`
+	RefundCents  int64  `json:"refund_cents"`
+	RefundStatus string `json:"refund_status"`
+}
+
+// cancelDepartureHandler lets staff call off a departure. Unlike a guest's
+// own cancellation, every guest is refunded in full whatever their rate
+// plan, and is told the reason, which is therefore required.
+func (s *server) cancelDepartureHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Date   string `json:"date"`
+		Slot   string `json:"slot"`
+		Reason string `json:"reason"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		respondError(w, http.StatusBadRequest, "missing_reason", "reason is required; it is sent to every guest")
+		return
+	}
+
+	results := []operatorCancellation{}
+	for _, b := range s.store.CancelDeparture(chi.URLParam(r, "tourId"), req.Date, req.Slot, s.now()) {
+		res := operatorCancellation{BookingID: b.ID, RefundStatus: "none"}
+		if b.PaymentRef != "" {
+			res.RefundCents = b.AmountCents - b.refundedCents()
+		}
+		if res.RefundCents > 0 {
+			res.RefundStatus = s.refund(r.Context(), RefundRequest{
+				PaymentRef:  b.PaymentRef,
+				BookingID:   b.ID,
+				AmountCents: res.RefundCents,
+				Currency:    b.Currency,
+				Reason:      "operator_cancelled",
+				GuestEmail:  b.GuestEmail,
+			})
+		}
+		s.sendNotification(r.Context(), Notification{
+			Template:    TemplateBookingCancelledByOperator,
+			Booking:     b,
+			RefundCents: res.RefundCents,
+			Reason:      req.Reason,
+		})
+		results = append(results, res)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"reason": req.Reason, "cancelled": results})
+}
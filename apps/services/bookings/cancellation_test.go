@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// seedPaidTour confirms a 9000-cent tour booking under plan. It departs on
+// 2026-03-14, thirteen days after the test clock starts.
+func seedPaidTour(t *testing.T, s *server, plan string) Booking {
+	t.Helper()
+	b := seedConfirmedTour(t, s)
+	b, err := s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.RatePlan = plan
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+type cancelResponse struct {
+	Booking      Booking        `json:"booking"`
+	Refund       RefundDecision `json:"refund"`
+	RefundStatus string         `json:"refund_status"`
+}
+
+func cancelTour(t *testing.T, s *server, id string) cancelResponse {
+	t.Helper()
+	var got cancelResponse
+	rec := doJSON(t, s.routes(), http.MethodPut, "/api/bookings/tours/"+id+"/cancel", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func TestCoolingOffRefundsNonRefundablePlanInFull(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.CoolingOffWindow = 24 * time.Hour
+	b := seedPaidTour(t, s, "non_refundable")
+	clock.advance(23 * time.Hour)
+
+	got := cancelTour(t, s, b.ID)
+	if got.Booking.Status != StatusCancelled || got.RefundStatus != "requested" {
+		t.Fatalf("response = %+v", got)
+	}
+	if got.Refund.Rule != RefundRuleCoolingOff || got.Refund.AmountCents != 9000 {
+		t.Fatalf("refund = %+v, want 9000 under cooling_off", got.Refund)
+	}
+	refunds := s.payments.(*fakePayments).refunds
+	if len(refunds) != 1 || refunds[0].AmountCents != 9000 || refunds[0].Reason != "guest_cancelled_cooling_off" {
+		t.Fatalf("refunds = %+v", refunds)
+	}
+}
+
+func TestNonRefundablePlanAfterCoolingOff(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.CoolingOffWindow = 24 * time.Hour
+	b := seedPaidTour(t, s, "non_refundable")
+	clock.advance(25 * time.Hour)
+
+	got := cancelTour(t, s, b.ID)
+	if got.Refund.AmountCents != 0 || got.Refund.Rule != RefundRulePolicy || got.RefundStatus != "none" {
+		t.Fatalf("response = %+v, want no refund", got)
+	}
+	if refunds := s.payments.(*fakePayments).refunds; len(refunds) != 0 {
+		t.Fatalf("refunds = %+v, want none", refunds)
+	}
+}
+
+func TestComputeRefundFollowsPlanTiers(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	b := Booking{Date: "2026-03-14", Slot: "06:00", PaymentRef: "cs_1", AmountCents: 9000, CreatedAt: apitypes.JSONTime{Time: created}}
+	// 06:00 in El Salvador is 12:00 UTC.
+	start := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		plan       string
+		now        time.Time
+		coolingOff time.Duration
+		want       int64
+		rule       string
+	}{
+		{"standard a week out", "", start.Add(-8 * 24 * time.Hour), 24 * time.Hour, 9000, RefundRulePolicy},
+		{"standard three days out", "standard", start.Add(-72 * time.Hour), 24 * time.Hour, 4500, RefundRulePolicy},
+		{"standard on the day", "standard", start.Add(-time.Hour), 24 * time.Hour, 0, RefundRulePolicy},
+		{"flexible just inside notice", "flexible", start.Add(-24 * time.Hour), 24 * time.Hour, 9000, RefundRulePolicy},
+		{"cooling-off overrides late notice", "non_refundable", created.Add(time.Hour), 24 * time.Hour, 9000, RefundRuleCoolingOff},
+		{"cooling-off disabled", "non_refundable", created.Add(time.Hour), 0, 0, RefundRulePolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := b
+			b.RatePlan = tt.plan
+			got := computeRefund(b, tt.now, tt.coolingOff)
+			if got.AmountCents != tt.want || got.Rule != tt.rule {
+				t.Fatalf("refund = %+v, want %d under %s", got, tt.want, tt.rule)
+			}
+		})
+	}
+}
+
+func TestComputeRefundUnpaid(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	got := computeRefund(Booking{Date: "2026-03-14", CreatedAt: apitypes.JSONTime{Time: now}}, now, 24*time.Hour)
+	if got.AmountCents != 0 || got.Rule != RefundRuleUnpaid {
+		t.Fatalf("refund = %+v, want nothing for an unpaid booking", got)
+	}
+}
+
+// lastEmail returns the most recent email sent to a guest.
+func lastEmail(t *testing.T, s *server) sentMessage {
+	t.Helper()
+	ob := sentMessages(s)
+	if len(ob.emails) == 0 {
+		t.Fatal("no email sent")
+	}
+	return ob.emails[len(ob.emails)-1]
+}
+
+func TestGuestCancellationUsesPolicyTemplate(t *testing.T) {
+	s, clock := newTestServer(t)
+	b := seedPaidTour(t, s, "standard")
+	// Three days out the standard plan refunds half.
+	clock.advance(10 * 24 * time.Hour)
+
+	if got := cancelTour(t, s, b.ID); got.Refund.AmountCents != 4500 {
+		t.Fatalf("refund = %+v", got.Refund)
+	}
+	msg := lastEmail(t, s)
+	if msg.Subject != "Your booking is cancelled" || !strings.Contains(msg.Body, "cancellation policy we are refunding 45.00 USD") {
+		t.Fatalf("email = %+v", msg)
+	}
+	if strings.Contains(msg.Body, "Reason:") {
+		t.Fatalf("guest cancellation email gives an operator reason: %q", msg.Body)
+	}
+}
+
+func TestGuestCancellationWithoutRefundSaysSo(t *testing.T) {
+	s, clock := newTestServer(t)
+	b := seedPaidTour(t, s, "non_refundable")
+	clock.advance(time.Hour)
+
+	cancelTour(t, s, b.ID)
+	if msg := lastEmail(t, s); !strings.Contains(msg.Body, "this cancellation is not refundable") {
+		t.Fatalf("email = %+v", msg)
+	}
+}
+
+func cancelDeparture(t *testing.T, s *server, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/bookings/tours/volcano-hike/cancel-departure", &buf)
+	req.Header.Set("Authorization", "Bearer staff-key")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOperatorCancellationRefundsInFullWithReason(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	paid := seedPaidTour(t, s, "non_refundable")
+	unpaid := seedPendingTour(t, s, 1)
+
+	rec := cancelDeparture(t, s, map[string]interface{}{"date": "2026-03-14", "reason": "Volcano trail closed by heavy rain"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		Cancelled []operatorCancellation `json:"cancelled"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if len(got.Cancelled) != 2 {
+		t.Fatalf("cancelled = %+v", got.Cancelled)
+	}
+
+	refunds := s.payments.(*fakePayments).refunds
+	if len(refunds) != 1 || refunds[0].BookingID != paid.ID || refunds[0].AmountCents != 9000 || refunds[0].Reason != "operator_cancelled" {
+		t.Fatalf("refunds = %+v, want the non-refundable booking refunded in full", refunds)
+	}
+	for _, id := range []string{paid.ID, unpaid.ID} {
+		if b, _ := s.store.Booking(id); b.Status != StatusCancelled {
+			t.Fatalf("booking %s status %s", id, b.Status)
+		}
+	}
+
+	var paidMsg, unpaidMsg sentMessage
+	for _, m := range sentMessages(s).emails {
+		if m.Subject != "We've had to cancel your booking" {
+			continue
+		}
+		switch {
+		case strings.Contains(m.Body, paid.ID):
+			paidMsg = m
+		case strings.Contains(m.Body, unpaid.ID):
+			unpaidMsg = m
+		}
+	}
+	if !strings.Contains(paidMsg.Body, "Reason: Volcano trail closed by heavy rain") || !strings.Contains(paidMsg.Body, "refunding your payment in full, 90.00 USD") {
+		t.Fatalf("paid guest email = %+v", paidMsg)
+	}
+	if !strings.Contains(unpaidMsg.Body, "Reason: Volcano trail closed") || !strings.Contains(unpaidMsg.Body, "You have not been charged") {
+		t.Fatalf("unpaid guest email = %+v", unpaidMsg)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 0 {
+		t.Fatalf("departure still has %d seats booked", d.Booked)
+	}
+}
+
+func TestOperatorCancellationRequiresReason(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	seedPaidTour(t, s, "standard")
+
+	rec := cancelDeparture(t, s, map[string]interface{}{"date": "2026-03-14", "reason": "  "})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "missing_reason") {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if refunds := s.payments.(*fakePayments).refunds; len(refunds) != 0 {
+		t.Fatalf("refunds = %+v, want none", refunds)
+	}
+}
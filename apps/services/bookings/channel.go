@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ChannelSchema is the CSV layout a host's channel manager imports rental
+// reservations in: its column names mapped from booking fields, its date
+// format and its names for booking statuses. Bookings whose status has no
+// name are left out of the export.
+type ChannelSchema struct {
+	Name       string
+	Columns    []ChannelColumn
+	DateLayout string
+	Statuses   map[BookingStatus]string
+}
+
+// ChannelColumn names the booking field exported under Header. Fields are
+// the keys of channelFields.
+type ChannelColumn struct {
+	Header string
+	Field  string
+}
+
+// channelSource identifies us as the channel reservations came from.
+const channelSource = "gateway-el-salvador"
+
+// channelFields are the booking fields a ChannelColumn can export.
+var channelFields = map[string]func(b Booking, sc ChannelSchema) string{
+	"booking_id":  func(b Booking, _ ChannelSchema) string { return b.ID },
+	"property_id": func(b Booking, _ ChannelSchema) string { return b.OfferingID },
+	"check_in":    func(b Booking, sc ChannelSchema) string { return sc.date(b.Date) },
+	"check_out":   func(b Booking, sc ChannelSchema) string { return sc.date(b.CheckOut) },
+	"nights": func(b Booking, _ ChannelSchema) string {
+		in, err1 := time.Parse(time.DateOnly, b.Date)
+		out, err2 := time.Parse(time.DateOnly, b.CheckOut)
+		if err1 != nil || err2 != nil {
+			return ""
+		}
+		return strconv.Itoa(int(out.Sub(in).Hours() / 24))
+	},
+	"guest_name":       func(b Booking, _ ChannelSchema) string { return b.GuestName },
+	"guest_first_name": func(b Booking, _ ChannelSchema) string { first, _ := splitName(b.GuestName); return first },
+	"guest_last_name":  func(b Booking, _ ChannelSchema) string { _, last := splitName(b.GuestName); return last },
+	"guest_email":      func(b Booking, _ ChannelSchema) string { return b.GuestEmail },
+	"guest_phone":      func(b Booking, _ ChannelSchema) string { return b.GuestPhone },
+	"guests":           func(b Booking, _ ChannelSchema) string { return strconv.Itoa(b.PartySize) },
+	"status":           func(b Booking, sc ChannelSchema) string { return sc.Statuses[b.Status] },
+	"total":            func(b Booking, _ ChannelSchema) string { return formatCents(b.AmountCents) },
+	"total_cents":      func(b Booking, _ ChannelSchema) string { return strconv.FormatInt(b.AmountCents, 10) },
+	"currency":         func(b Booking, _ ChannelSchema) string { return b.Currency },
+	"payment_ref":      func(b Booking, _ ChannelSchema) string { return b.PaymentRef },
+	"source":           func(Booking, ChannelSchema) string { return channelSource },
+	"created_at":       func(b Booking, sc ChannelSchema) string { return b.CreatedAt.UTC().Format(sc.DateLayout) },
+	"notes":            func(b Booking, _ ChannelSchema) string { return b.SpecialRequests },
+}
+
+// defaultChannelStatuses exports paid bookings as confirmed and cancelled
+// ones so the channel manager frees their nights. Unpaid bookings are left
+// out.
+var defaultChannelStatuses = map[BookingStatus]string{
+	StatusPendingApproval: "confirmed",
+	StatusConfirmed:       "confirmed",
+	StatusCheckedIn:       "confirmed",
+	StatusDisputed:        "confirmed",
+	StatusCancelled:       "cancelled",
+	StatusNoShow:          "cancelled",
+}
+
+// channelSchemas are the schemas selectable with CHANNEL_EXPORT_SCHEMA.
+var channelSchemas = map[string]ChannelSchema{
+	"generic_csv": {
+		Name: "generic_csv",
+		Columns: []ChannelColumn{
+			{"reservation_id", "booking_id"}, {"listing_id", "property_id"},
+			{"check_in", "check_in"}, {"check_out", "check_out"}, {"nights", "nights"},
+			{"guest_name", "guest_name"}, {"guest_email", "guest_email"}, {"guest_phone", "guest_phone"},
+			{"guests", "guests"}, {"status", "status"}, {"total", "total"}, {"currency", "currency"},
+			{"source", "source"},
+		},
+		DateLayout: time.DateOnly,
+		Statuses:   defaultChannelStatuses,
+	},
+	"channel_manager_csv": {
+		Name: "channel_manager_csv",
+		Columns: []ChannelColumn{
+			{"Reservation ID", "booking_id"}, {"Property ID", "property_id"},
+			{"Arrival", "check_in"}, {"Departure", "check_out"}, {"Nights", "nights"},
+			{"First Name", "guest_first_name"}, {"Last Name", "guest_last_name"},
+			{"Email", "guest_email"}, {"Phone", "guest_phone"}, {"Adults", "guests"},
+			{"Status", "status"}, {"Total Price", "total"}, {"Currency", "currency"},
+			{"Channel", "source"}, {"Booked On", "created_at"}, {"Notes", "notes"},
+		},
+		DateLayout: "02/01/2006",
+		Statuses: map[BookingStatus]string{
+			StatusPendingApproval: "Confirmed",
+			StatusConfirmed:       "Confirmed",
+			StatusCheckedIn:       "Confirmed",
+			StatusDisputed:        "Confirmed",
+			StatusCancelled:       "Cancelled",
+			StatusNoShow:          "Cancelled",
+		},
+	},
+}
+
+// channelDateFormats are the date formats CHANNEL_EXPORT_DATE_FORMAT
+// accepts.
+var channelDateFormats = map[string]string{
+	"YYYY-MM-DD": time.DateOnly,
+	"DD/MM/YYYY": "02/01/2006",
+	"MM/DD/YYYY": "01/02/2006",
+	"DD.MM.YYYY": "02.01.2006",
+}
+
+// loadChannelSchema builds the export schema from the built-in schema
+// named name, overridden by columns ("Header=field,..."), dateFormat (one
+// of channelDateFormats) and statuses ("status=Name,...") when set.
+func loadChannelSchema(name, columns, dateFormat, statuses string) (ChannelSchema, error) {
+	base, ok := channelSchemas[name]
+	if !ok {
+		return ChannelSchema{}, fmt.Errorf("unknown channel export schema %q", name)
+	}
+	sc := ChannelSchema{Name: base.Name, Columns: base.Columns, DateLayout: base.DateLayout, Statuses: base.Statuses}
+	if columns != "" {
+		sc.Name, sc.Columns = "custom", nil
+		for _, entry := range strings.Split(columns, ",") {
+			header, field, ok := strings.Cut(entry, "=")
+			header, field = strings.TrimSpace(header), strings.TrimSpace(field)
+			if !ok || header == "" {
+				return ChannelSchema{}, fmt.Errorf("channel export column %q must be formatted Header=field", entry)
+			}
+			if _, known := channelFields[field]; !known {
+				return ChannelSchema{}, fmt.Errorf("channel export column %q: unknown field %q", header, field)
+			}
+			sc.Columns = append(sc.Columns, ChannelColumn{header, field})
+		}
+	}
+	if dateFormat != "" {
+		if sc.DateLayout, ok = channelDateFormats[strings.ToUpper(dateFormat)]; !ok {
+			return ChannelSchema{}, fmt.Errorf("channel export date format %q must be YYYY-MM-DD, DD/MM/YYYY, MM/DD/YYYY or DD.MM.YYYY", dateFormat)
+		}
+	}
+	if statuses != "" {
+		sc.Statuses = make(map[BookingStatus]string)
+		for _, entry := range strings.Split(statuses, ",") {
+			status, label, ok := strings.Cut(entry, "=")
+			if !ok {
+				return ChannelSchema{}, fmt.Errorf("channel export status %q must be formatted status=Name", entry)
+			}
+			sc.Statuses[BookingStatus(strings.TrimSpace(status))] = strings.TrimSpace(label)
+		}
+	}
+	return sc, nil
+}
+
+func (sc ChannelSchema) date(isoDate string) string {
+	d, err := time.Parse(time.DateOnly, isoDate)
+	if err != nil {
+		return isoDate
+	}
+	return d.Format(sc.DateLayout)
+}
+
+// CSV lays bookings out in the schema. Bookings with an unmapped status
+// are skipped.
+func (sc ChannelSchema) CSV(bookings []Booking) []byte {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	headers := make([]string, len(sc.Columns))
+	for i, c := range sc.Columns {
+		headers[i] = c.Header
+	}
+	cw.Write(headers)
+	for _, b := range bookings {
+		if _, ok := sc.Statuses[b.Status]; !ok {
+			continue
+		}
+		row := make([]string, len(sc.Columns))
+		for i, c := range sc.Columns {
+			row[i] = channelFields[c.Field](b, sc)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return buf.Bytes()
+}
+
+// splitName splits a guest's name into first name and the rest.
+func splitName(name string) (first, last string) {
+	first, last, _ = strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(last)
+}
+
+// formatCents renders cents as a decimal amount, e.g. 12550 as "125.50".
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// PropertyBookings lists a property's rental bookings by check-in date.
+func (s *Store) PropertyBookings(propertyID string) []Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Booking
+	for _, b := range s.bookings {
+		if b.Kind == KindRental && b.OfferingID == propertyID {
+			out = append(out, *b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Date != out[j].Date {
+			return out[i].Date < out[j].Date
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// exportRentalBookingsHandler exports a property's bookings as CSV in the
+// configured channel manager's schema. ?from=YYYY-MM-DD leaves out stays
+// that ended before it.
+func (s *server) exportRentalBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	propertyID := chi.URLParam(r, "propertyId")
+	from := r.URL.Query().Get("from")
+	if from != "" {
+		if _, err := time.Parse(time.DateOnly, from); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_date", "from must be formatted YYYY-MM-DD")
+			return
+		}
+	}
+	var bookings []Booking
+	for _, b := range s.store.PropertyBookings(propertyID) {
+		if from == "" || b.CheckOut > from {
+			bookings = append(bookings, b)
+		}
+	}
+	sc := s.cfg.ChannelExport
+	writeAttachment(w, mediaCSV+"; charset=utf-8", fmt.Sprintf("bookings-%s-%s.csv", propertyID, sc.Name), sc.CSV(bookings))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func exportBookings(t *testing.T, s *server, query string) [][]string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/bookings/rentals/casa-suchitoto/export"+query, nil)
+	req.Header.Set("Authorization", "Bearer staff-key")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("export: status %d type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestChannelExportMatchesSchema(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	var err error
+	if s.cfg.ChannelExport, err = loadChannelSchema("channel_manager_csv", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	b, rec := bookNamedStay(t, s, "Ana María López")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+	doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "pi_1", "amount_cents": 36050, "currency": "USD",
+	}, &b)
+	// An unpaid booking is not exported.
+	bookStay(t, s, "2026-04-20", "2026-04-22")
+
+	rows := exportBookings(t, s, "")
+	want := [][]string{
+		{"Reservation ID", "Property ID", "Arrival", "Departure", "Nights", "First Name", "Last Name",
+			"Email", "Phone", "Adults", "Status", "Total Price", "Currency", "Channel", "Booked On", "Notes"},
+		{b.ID, "casa-suchitoto", "10/04/2026", "13/04/2026", "3", "Ana", "María López",
+			"ana@example.com", "+50370000000", "2", "Confirmed", "360.50", "USD", "gateway-el-salvador", "01/03/2026", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("export =\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestChannelExportCustomColumns(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	var err error
+	s.cfg.ChannelExport, err = loadChannelSchema("generic_csv", "Booking Ref=booking_id,Check In=check_in,Guest=guest_name,State=status",
+		"MM/DD/YYYY", "pending=Tentative,confirmed=Booked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := bookStay(t, s, "2026-04-10", "2026-04-13")
+
+	rows := exportBookings(t, s, "?from=2026-04-01")
+	want := [][]string{{"Booking Ref", "Check In", "Guest", "State"}, {b.ID, "04/10/2026", "Ana", "Tentative"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("export = %q, want %q", rows, want)
+	}
+	if rows := exportBookings(t, s, "?from=2026-04-13"); len(rows) != 1 {
+		t.Fatalf("stay ending before from exported: %q", rows)
+	}
+}
+
+func TestLoadChannelSchemaRejectsUnknownFields(t *testing.T) {
+	if _, err := loadChannelSchema("generic_csv", "Arrival=arrival_date", "", ""); err == nil {
+		t.Fatal("accepted a column mapped to an unknown field")
+	}
+	if _, err := loadChannelSchema("nope", "", "", ""); err == nil {
+		t.Fatal("accepted an unknown schema")
+	}
+	if _, err := loadChannelSchema("generic_csv", "", "YYYYMMDD", ""); err == nil {
+		t.Fatal("accepted an unknown date format")
+	}
+}
+
+func bookNamedStay(t *testing.T, s *server, guestName string) (Booking, *httptest.ResponseRecorder) {
+	t.Helper()
+	var b Booking
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/rentals", map[string]interface{}{
+		"property_id": "casa-suchitoto", "check_in": "2026-04-10", "check_out": "2026-04-13",
+		"party_size": 2, "guest_name": guestName, "guest_email": "ana@example.com", "guest_phone": "+50370000000",
+	}, &b)
+	return b, rec
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// kindCategories maps booking kinds to the categories the payments service
+// allocates Foundation funds by.
+var kindCategories = map[BookingKind]string{
+	KindTour:       "tours",
+	KindRental:     "rentals",
+	KindConsulting: "consulting",
+}
+
+// createCheckoutHandler opens a hosted checkout for a pending booking,
+// charging the deposit its risk calls for (see DepositPolicy). Every
+// call for a booking carries the same idempotency key, so calling again
+// after a failure or timeout resumes the session already created instead of
+// opening a second one.
+func (s *server) createCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store.Booking(chi.URLParam(r, "bookingId"))
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	if b.Status != StatusPending {
+		respondError(w, http.StatusConflict, "invalid_state", "only pending bookings can be paid for")
+		return
+	}
+	if b.fullyDiscounted() {
+		if !s.cfg.AcceptZeroAmountBookings {
+			respondError(w, http.StatusUnprocessableEntity, "zero_amount", "booking is fully discounted and zero-amount bookings are not accepted")
+			return
+		}
+		// Stripe would refuse to charge nothing, so there is no checkout.
+		if b, err = s.confirmZeroAmount(r.Context(), b); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{"booking": b, "checkout": nil})
+		return
+	}
+	if b.PriceCents <= 0 {
+		respondError(w, http.StatusUnprocessableEntity, "unpriced", "booking has no price to charge")
+		return
+	}
+
+	deposit := s.depositFor(b)
+	description := string(b.Kind) + " " + b.OfferingID
+	if deposit.BalanceCents > 0 {
+		description += " deposit"
+	}
+	session, err := s.payments.CreateCheckout(r.Context(), CheckoutRequest{
+		BookingID:   b.ID,
+		AmountCents: deposit.AmountCents,
+		Currency:    s.tenant(r.Context()).Currency,
+		Category:    kindCategories[b.Kind],
+		Description: description,
+
+		ReferralCode: b.ReferralCode,
+	})
+	if err != nil {
+		log.Printf("checkout for booking %s failed: %v", b.ID, err)
+		respondError(w, http.StatusBadGateway, "payments_unavailable", "could not create checkout; retry to resume")
+		return
+	}
+
+	b, err = s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.CheckoutSessionID = session.ID
+		b.DepositCents = deposit.AmountCents
+		return nil
+	})
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"booking": b, "checkout": session, "deposit": deposit})
+}
+
+// fullyDiscounted reports whether a promo code took a booking's whole price
+// off, leaving nothing to charge.
+func (b Booking) fullyDiscounted() bool {
+	return b.PriceCents == 0 && b.DiscountCents > 0
+}
+
+// confirmZeroAmount confirms a fully discounted booking without a payment.
+// A zero-value transaction is recorded in its place so the booking's
+// history shows why it was confirmed.
+func (s *server) confirmZeroAmount(ctx context.Context, b Booking) (Booking, error) {
+	b, err := s.ConfirmBooking(ctx, b.ID, PaymentDetails{
+		Kind:     TxnPayment,
+		Ref:      "zero_" + b.ID,
+		Currency: b.Currency,
+		Reason:   "fully_discounted:" + b.PromoCode,
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+	log.Printf("booking %s confirmed without payment: promo code %s discounted %d cents", b.ID, b.PromoCode, b.DiscountCents)
+	return b, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCheckoutAPI stands in for the payments service's checkout endpoint,
+// creating one session per idempotency key. failures makes the first calls
+// answer 503.
+type fakeCheckoutAPI struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	keys     []string
+	sessions map[string]CheckoutSession
+}
+
+func (f *fakeCheckoutAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	key := r.Header.Get("Idempotency-Key")
+	f.keys = append(f.keys, key)
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	session, ok := f.sessions[key]
+	if !ok {
+		session = CheckoutSession{ID: fmt.Sprintf("cs_%d", len(f.sessions)+1), URL: "https://checkout.test"}
+		f.sessions[key] = session
+	}
+	json.NewEncoder(w).Encode(session)
+}
+
+func newCheckoutAPIClient(t *testing.T, failures int) (*httpPaymentsClient, *fakeCheckoutAPI) {
+	t.Helper()
+	api := &fakeCheckoutAPI{failures: failures, sessions: make(map[string]CheckoutSession)}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	c := newHTTPPaymentsClient(srv.URL, "")
+	c.backoff = time.Millisecond
+	return c, api
+}
+
+func TestCreateCheckoutWithSameBookingKeyCreatesOneSession(t *testing.T) {
+	c, api := newCheckoutAPIClient(t, 0)
+	req := CheckoutRequest{BookingID: "bk-1", AmountCents: 9000, Currency: "USD", Category: "tours"}
+
+	first, err := c.CreateCheckout(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.CreateCheckout(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != second.ID || len(api.sessions) != 1 {
+		t.Fatalf("sessions %q and %q, %d created; want one", first.ID, second.ID, len(api.sessions))
+	}
+	for _, key := range api.keys {
+		if key != "booking-bk-1-checkout" {
+			t.Fatalf("idempotency key = %q", key)
+		}
+	}
+}
+
+func TestCreateCheckoutRetriesTransientFailure(t *testing.T) {
+	c, api := newCheckoutAPIClient(t, 1)
+
+	session, err := c.CreateCheckout(context.Background(), CheckoutRequest{BookingID: "bk-1", AmountCents: 9000})
+	if err != nil {
+		t.Fatalf("err = %v, want the 503 retried to success", err)
+	}
+	if session.ID == "" || api.attempts != 2 || api.keys[0] != api.keys[1] {
+		t.Fatalf("session %+v after %d attempts with keys %v", session, api.attempts, api.keys)
+	}
+}
+
+func TestCreateCheckoutGivesUpAfterRetries(t *testing.T) {
+	c, api := newCheckoutAPIClient(t, 5)
+
+	_, err := c.CreateCheckout(context.Background(), CheckoutRequest{BookingID: "bk-1", AmountCents: 9000})
+	var se *paymentsStatusError
+	if !errors.As(err, &se) || se.Status != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v, want the final 503", err)
+	}
+	if api.attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", api.attempts)
+	}
+}
+
+func TestRefundIsNotRetried(t *testing.T) {
+	c, api := newCheckoutAPIClient(t, 1)
+
+	if err := c.Refund(context.Background(), RefundRequest{BookingID: "bk-1", AmountCents: 100}); err == nil {
+		t.Fatal("want the 503 returned")
+	}
+	if api.attempts != 1 {
+		t.Fatalf("attempts = %d, want 1 without an idempotency key", api.attempts)
+	}
+}
+
+func seedPricedTour(t *testing.T, s *server) Booking {
+	t.Helper()
+	b := seedPendingTour(t, s, 2)
+	b, err := s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.PriceCents = 9000
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCheckoutHandlerResumesAfterFailure(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	b := seedPricedTour(t, s)
+	payments := s.payments.(*fakePayments)
+
+	payments.err = errors.New("payments down")
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/"+b.ID+"/checkout", nil, nil); rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502", rec.Code)
+	}
+	if got, _ := s.store.Booking(b.ID); got.Status != StatusPending || got.CheckoutSessionID != "" {
+		t.Fatalf("after failure: %+v, want pending without a session", got)
+	}
+
+	payments.err = nil
+	var resp struct {
+		Booking  Booking         `json:"booking"`
+		Checkout CheckoutSession `json:"checkout"`
+	}
+	rec := doJSON(t, h, http.MethodPost, "/api/bookings/"+b.ID+"/checkout", nil, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Booking.CheckoutSessionID != resp.Checkout.ID || resp.Checkout.URL == "" {
+		t.Fatalf("response = %+v", resp)
+	}
+	last := payments.checkouts[len(payments.checkouts)-1]
+	if last.AmountCents != 9000 || last.Category != "tours" {
+		t.Fatalf("checkout request = %+v", last)
+	}
+}
+
+func TestCheckoutForwardsReferralCode(t *testing.T) {
+	s, _ := newTestServer(t)
+	var b Booking
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "slot": "08:00", "party_size": 2,
+		"referral_code": " surfclub ",
+	}, &b)
+	if rec.Code != http.StatusCreated || b.ReferralCode != "surfclub" {
+		t.Fatalf("status %d booking %+v", rec.Code, b)
+	}
+	if _, err := s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.PriceCents = 9000
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/checkout", nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := s.payments.(*fakePayments).checkouts[0].ReferralCode; got != "surfclub" {
+		t.Fatalf("checkout referral_code = %q, want surfclub", got)
+	}
+}
+
+func TestCheckoutHandlerRequiresPendingBooking(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedConfirmedTour(t, s)
+	if rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/checkout", nil, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409", rec.Code)
+	}
+}
+
+// bookComped books two guests on volcano-hike with a code that takes the
+// whole price off.
+func bookComped(t *testing.T, s *server) Booking {
+	t.Helper()
+	s.cfg.StaffAPIKey = "staff-key"
+	if rec := putPromoCode(t, s, "comp", PromoCode{OfferingID: "volcano-hike", AmountOffCents: 100000}); rec.Code != http.StatusOK {
+		t.Fatalf("put promo: status %d: %s", rec.Code, rec.Body)
+	}
+	var b Booking
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "party_size": 2,
+		"customer_email": "ana@example.com", "promo_code": "COMP",
+	}, &b)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+	if b.PriceCents != 0 || b.DiscountCents != 9000 || b.PromoCode != "COMP" {
+		t.Fatalf("booking = %+v, want 9000 discounted to nothing", b)
+	}
+	return b
+}
+
+func TestFullyDiscountedBookingConfirmsWithoutPayment(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.AcceptZeroAmountBookings = true
+	b := bookComped(t, s)
+
+	if b.Status != StatusConfirmed || b.CheckInToken == "" {
+		t.Fatalf("booking = %+v, want confirmed with a check-in token", b)
+	}
+	if n := len(s.payments.(*fakePayments).checkouts); n != 0 {
+		t.Fatalf("%d checkouts created, want none", n)
+	}
+	if len(b.Transactions) != 1 {
+		t.Fatalf("transactions = %+v, want one audit entry", b.Transactions)
+	}
+	if txn := b.Transactions[0]; txn.Kind != TxnPayment || txn.AmountCents != 0 || txn.Ref != "zero_"+b.ID || txn.Reason == "" {
+		t.Fatalf("audit entry = %+v, want a zero-value payment with a reason", txn)
+	}
+	if sum := b.paymentSummary(); sum.OutstandingCents != 0 {
+		t.Fatalf("outstanding = %d, want 0", sum.OutstandingCents)
+	}
+}
+
+func TestZeroAmountBookingRefusedWhenNotAccepted(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := bookComped(t, s)
+	if b.Status != StatusPending {
+		t.Fatalf("status = %s, want pending", b.Status)
+	}
+
+	var body map[string]string
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/checkout", nil, &body)
+	if rec.Code != http.StatusUnprocessableEntity || body["error"] != "zero_amount" {
+		t.Fatalf("checkout: status %d body %v, want 422 zero_amount", rec.Code, body)
+	}
+	if n := len(s.payments.(*fakePayments).checkouts); n != 0 {
+		t.Fatalf("%d checkouts created, want none", n)
+	}
+}
+
+func TestRefundSendsPaymentsAdminKey(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := newHTTPPaymentsClient(srv.URL, "payments-admin")
+	if err := c.Refund(context.Background(), RefundRequest{PaymentRef: "pi_1", AmountCents: 100, Currency: "USD"}); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer payments-admin" {
+		t.Fatalf("Authorization = %q", auth)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// defaultLowPriorityRoutes are the preview and estimate routes shed under
+// overload unless LOAD_SHED_LOW_PRIORITY_ROUTES names others.
+const defaultLowPriorityRoutes = "POST /api/bookings/tours/{tourId}/simulate," +
+	"POST /api/bookings/tours/{tourId}/quote," +
+	"GET /api/bookings/consulting/{consultantId}/slots"
+
+// config holds the runtime settings for the bookings service, loaded from
+// the environment with development-friendly defaults.
+type config struct {
+	Port string
+
+	// HTTPTimeouts bound each stage of an incoming connection.
+	HTTPTimeouts httpkit.ServerTimeouts
+	// LoadShedding turns away low-priority routes under overload.
+	LoadShedding httpkit.LoadShedding
+
+	// RequestIDHeader is the header used to accept, echo and forward the
+	// request correlation id.
+	RequestIDHeader string
+
+	// Tenants are the brands served, loaded at startup from TenantsFile.
+	// Requests naming no tenant are served as DefaultTenant.
+	Tenants       Tenants
+	TenantsFile   string
+	DefaultTenant string
+
+	// DefaultTourCapacity is the seat count assumed for a departure that has
+	// not been explicitly scheduled.
+	DefaultTourCapacity int
+
+	// BlockHoldTTL is how long an agency seat block stays reserved when the
+	// request does not specify its own expiry, and the longest it may ask
+	// for.
+	BlockHoldTTL time.Duration
+	// HoldSweepInterval controls how often expired holds are released.
+	HoldSweepInterval time.Duration
+	// CapacityReconcileInterval controls how often every departure's seat
+	// counts are recounted from its bookings and holds. Zero disables the
+	// sweep; staff can still reconcile a tour on demand.
+	CapacityReconcileInterval time.Duration
+
+	// ApprovalThresholdCents is the paid amount above which a booking waits
+	// for staff approval before confirming. Zero disables the check.
+	ApprovalThresholdCents int64
+
+	// AcceptZeroAmountBookings confirms bookings discounted to nothing
+	// without sending them through checkout. When it is off they are
+	// refused at checkout instead.
+	AcceptZeroAmountBookings bool
+
+	// PaymentsServiceURL and PricingServiceURL are the base URLs of the
+	// sibling services.
+	PaymentsServiceURL string
+	PricingServiceURL  string
+	// PaymentsAPIKey is the payments service's admin key, which refunds
+	// are sent with.
+	PaymentsAPIKey string
+	// PlatformHealthTimeout bounds each sibling service's readiness probe
+	// in the platform health check.
+	PlatformHealthTimeout time.Duration
+
+	// WaitlistPriceLockTTL is how long a waitlisted guest keeps the price in
+	// effect when they joined.
+	WaitlistPriceLockTTL time.Duration
+	// WaitlistPolicy picks which waitlisted party is offered seats that
+	// free up on a departure.
+	WaitlistPolicy WaitlistPolicy
+	// WaitlistOfferWindow is how long a waitlisted party has to accept
+	// freed seats before they pass to the next party; zero promotes them
+	// outright. WaitlistPartialOffers lets the head of the queue be offered
+	// fewer seats than it asked for when no party fits; it needs a window.
+	WaitlistOfferWindow   time.Duration
+	WaitlistPartialOffers bool
+
+	// Outbound notification providers. When a provider is not configured
+	// its messages are logged instead of sent.
+	ResendAPIKey     string
+	EmailFrom        string
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioFromNumber string
+	// NotifyMaxAttempts is how many times a guest notification is tried
+	// before support is alerted, waiting NotifyRetryBackoff longer after
+	// each failure.
+	NotifyMaxAttempts  int
+	NotifyRetryBackoff time.Duration
+
+	// UnsubscribeSecret signs unsubscribe and preferences links; AppURL is
+	// where they point. Only development runs without one (see
+	// resolveUnsubscribeSecret).
+	UnsubscribeSecret string
+	AppURL            string
+
+	// CoolingOffWindow is how long after booking a guest may cancel for a
+	// full refund regardless of rate plan. Zero disables it.
+	CoolingOffWindow time.Duration
+
+	// NoShowCutoff is how long after a departure starts its confirmed
+	// bookings that never checked in are marked no-show, refunding
+	// NoShowRefundRate of what they paid. NoShowSweepInterval is how often
+	// that runs; zero leaves it to staff.
+	NoShowCutoff        time.Duration
+	NoShowRefundRate    apitypes.Percent
+	NoShowSweepInterval time.Duration
+
+	// NonTransferablePlans are rate plans whose bookings cannot be handed
+	// to another guest.
+	NonTransferablePlans map[string]bool
+
+	// External property-management system. Confirmed bookings are pushed
+	// to PMSWebhookURL in PMSFormat when it is set.
+	PMSWebhookURL   string
+	PMSWebhookToken string
+	PMSFormat       string
+	PMSMaxAttempts  int
+
+	// StaffAPIKey and GuideAPIKey are the bearer tokens for operational
+	// routes such as departure manifests. A role with no key configured
+	// cannot authenticate.
+	StaffAPIKey string
+	GuideAPIKey string
+	// AgencyAPIKey is the bearer token travel agencies manage their seat
+	// blocks with.
+	AgencyAPIKey string
+	// ServiceAPIKey is the bearer token the payments service presents when
+	// it reports payments, refunds and disputes. Without it those routes
+	// are closed.
+	ServiceAPIKey string
+
+	// DatabaseURL points at the Postgres database holding the shared
+	// tour_departures seat inventory. When empty, seats are only tracked
+	// in memory, which is safe for a single replica.
+	DatabaseURL string
+
+	// MaxActiveBookingsPerGuest caps how many pending or confirmed
+	// bookings one guest email may hold, to curb scalping. Zero disables
+	// the cap.
+	MaxActiveBookingsPerGuest int
+	// ChannelExport is the layout rental bookings are exported in for
+	// hosts' channel managers, loaded at startup from CHANNEL_EXPORT_*.
+	ChannelExport ChannelSchema
+
+	// Deposits sizes what checkout takes up front by booking risk.
+	Deposits DepositPolicy
+
+	// Rebooking picks the departures offered to a guest who cancels a tour.
+	Rebooking RebookPolicy
+
+	// DisputeBlocksGuest bars a guest who charges back a payment from new
+	// bookings until the dispute is decided.
+	DisputeBlocksGuest bool
+
+	// PaymentFailureReleasesSeats frees a pending booking's seats when the
+	// payments service reports its payment failed. Off, the booking keeps
+	// them, and the guest can pay again, until it is cancelled.
+	PaymentFailureReleasesSeats bool
+
+	// TourLanguages are the languages tours can be offered in, as ISO 639-1
+	// codes. A tour without its own list is offered in all of them, and
+	// the first is the default for bookings that name none.
+	TourLanguages []string
+
+	// ConsultingHours are when consulting sessions can be booked.
+	ConsultingHours ConsultingHours
+	// Holidays are the public holidays consultants take no sessions on.
+	// Each consultant observes the holidays of their region in
+	// ConsultantRegions, or of ConsultingRegion when not listed there.
+	// HolidayCalendarFile is the JSON file Holidays are loaded from at
+	// startup, alongside those listed inline.
+	Holidays            HolidayCalendar
+	HolidayCalendarFile string
+	ConsultingRegion    string
+	ConsultantRegions   map[string]string
+
+	// GuestDataRetention is how long after a booking completes its guest's
+	// personal data is kept before being anonymized. Zero keeps it
+	// forever. RetentionPurgeInterval is how often the purge runs.
+	GuestDataRetention     time.Duration
+	RetentionPurgeInterval time.Duration
+
+	// PopularityWindow is how far back bookings count toward a tour's
+	// search ranking; PopularityRefreshInterval is how often rankings are
+	// rescored.
+	PopularityWindow          time.Duration
+	PopularityRefreshInterval time.Duration
+}
+
+func loadConfig() config {
+	return config{
+		Port:                      envString("BOOKINGS_SERVICE_PORT", "8002"),
+		RequestIDHeader:           envString("REQUEST_ID_HEADER", httpkit.RequestIDHeader),
+		HTTPTimeouts:              httpkit.ServerTimeoutsFromEnv(),
+		LoadShedding:              httpkit.LoadSheddingFromEnv(defaultLowPriorityRoutes),
+		TenantsFile:               os.Getenv("TENANTS_FILE"),
+		DefaultTenant:             envString("DEFAULT_TENANT", tenantkit.DefaultID),
+		DefaultTourCapacity:       envInt("TOUR_DEFAULT_CAPACITY", 12),
+		BlockHoldTTL:              envDuration("BLOCK_HOLD_TTL", 72*time.Hour),
+		HoldSweepInterval:         envDuration("HOLD_SWEEP_INTERVAL", time.Minute),
+		CapacityReconcileInterval: envDuration("CAPACITY_RECONCILE_INTERVAL", time.Hour),
+
+		ApprovalThresholdCents: int64(envInt("APPROVAL_THRESHOLD_CENTS", 500000)),
+		PaymentsServiceURL:     envString("PAYMENTS_SERVICE_URL", "http://localhost:8001"),
+		PaymentsAPIKey:         os.Getenv("PAYMENTS_ADMIN_API_KEY"),
+		PricingServiceURL:      envString("PRICING_SERVICE_URL", "http://localhost:8003"),
+		WaitlistPriceLockTTL:   envDuration("WAITLIST_PRICE_LOCK_TTL", 14*24*time.Hour),
+		WaitlistPolicy:         parseWaitlistPolicy(os.Getenv("WAITLIST_POLICY")),
+
+		AcceptZeroAmountBookings: envBool("ACCEPT_ZERO_AMOUNT_BOOKINGS", true),
+
+		PlatformHealthTimeout: envDuration("PLATFORM_HEALTH_TIMEOUT", 3*time.Second),
+
+		WaitlistOfferWindow:   envDuration("WAITLIST_OFFER_WINDOW", 24*time.Hour),
+		WaitlistPartialOffers: envBool("WAITLIST_PARTIAL_OFFERS", false),
+
+		ResendAPIKey:     os.Getenv("RESEND_API_KEY"),
+		EmailFrom:        envString("EMAIL_FROM", "hello@gatewayelsalvador.com"),
+		TwilioAccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+		TwilioFromNumber: os.Getenv("TWILIO_FROM_NUMBER"),
+
+		NotifyMaxAttempts:  envInt("NOTIFY_MAX_ATTEMPTS", 4),
+		NotifyRetryBackoff: envDuration("NOTIFY_RETRY_BACKOFF", 30*time.Second),
+
+		UnsubscribeSecret: os.Getenv("UNSUBSCRIBE_SECRET"),
+		AppURL:            envString("APP_URL", "http://localhost:3000"),
+
+		CoolingOffWindow:     envDuration("COOLING_OFF_WINDOW", 24*time.Hour),
+		NonTransferablePlans: envSet("NON_TRANSFERABLE_PLANS", "non_refundable"),
+
+		NoShowCutoff:        envDuration("NO_SHOW_CUTOFF", 2*time.Hour),
+		NoShowRefundRate:    envPercent("NO_SHOW_REFUND_PERCENT", 0),
+		NoShowSweepInterval: envDuration("NO_SHOW_SWEEP_INTERVAL", 15*time.Minute),
+
+		PMSWebhookURL:   os.Getenv("PMS_WEBHOOK_URL"),
+		PMSWebhookToken: os.Getenv("PMS_WEBHOOK_TOKEN"),
+		PMSFormat:       envString("PMS_FORMAT", "generic_json"),
+		PMSMaxAttempts:  envInt("PMS_MAX_ATTEMPTS", 4),
+
+		StaffAPIKey: os.Getenv("STAFF_API_KEY"),
+		GuideAPIKey: os.Getenv("GUIDE_API_KEY"),
+
+		AgencyAPIKey: os.Getenv("AGENCY_API_KEY"),
+
+		ServiceAPIKey: os.Getenv("INTERNAL_SERVICE_KEY"),
+
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+
+		MaxActiveBookingsPerGuest: envInt("MAX_ACTIVE_BOOKINGS_PER_GUEST", 10),
+		DisputeBlocksGuest:        envBool("DISPUTE_BLOCKS_GUEST", false),
+
+		PaymentFailureReleasesSeats: envBool("PAYMENT_FAILURE_RELEASES_SEATS", true),
+
+		Deposits: loadDepositPolicy(),
+
+		Rebooking: loadRebookPolicy(),
+
+		TourLanguages: envList("TOUR_LANGUAGES", "es,en"),
+
+		ConsultingHours: ConsultingHours{
+			DayStart: envString("CONSULTING_DAY_START", "09:00"),
+			DayEnd:   envString("CONSULTING_DAY_END", "17:00"),
+			Session:  envDuration("CONSULTING_SESSION_LENGTH", time.Hour),
+		},
+		HolidayCalendarFile: os.Getenv("HOLIDAY_CALENDAR_FILE"),
+		ConsultingRegion:    strings.ToUpper(envString("CONSULTING_REGION", "SV")),
+		ConsultantRegions:   envMap("CONSULTANT_REGIONS"),
+
+		GuestDataRetention:     envDuration("GUEST_DATA_RETENTION", 730*24*time.Hour),
+		RetentionPurgeInterval: envDuration("RETENTION_PURGE_INTERVAL", 24*time.Hour),
+
+		PopularityWindow:          envDuration("POPULARITY_WINDOW", 30*24*time.Hour),
+		PopularityRefreshInterval: envDuration("POPULARITY_REFRESH_INTERVAL", 15*time.Minute),
+	}
+}
+
+// devUnsubscribeSecret signs links in development when UNSUBSCRIBE_SECRET
+// is unset.
+const devUnsubscribeSecret = "dev-unsubscribe-secret"
+
+// resolveUnsubscribeSecret returns the secret to sign guest links with.
+// With NODE_ENV=development a missing secret falls back to
+// devUnsubscribeSecret; anywhere else it, or the development one, is
+// refused, since anyone who knows it can forge a guest's links.
+func resolveUnsubscribeSecret(secret, nodeEnv string) (string, error) {
+	if nodeEnv == "development" {
+		if secret == "" {
+			return devUnsubscribeSecret, nil
+		}
+		return secret, nil
+	}
+	if secret == "" || secret == devUnsubscribeSecret {
+		return "", fmt.Errorf("UNSUBSCRIBE_SECRET must be set outside development (NODE_ENV=%q)", nodeEnv)
+	}
+	return secret, nil
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+// envPercent reads a percentage such as "30" or "12.5%".
+func envPercent(key string, fallback apitypes.Percent) apitypes.Percent {
+	if v, err := apitypes.ParsePercent(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+// envList reads a comma-separated list, lowercased and in order.
+func envList(key, fallback string) []string {
+	var list []string
+	for _, v := range strings.Split(envString(key, fallback), ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envMap reads comma-separated key=VALUE pairs, upper-casing the values.
+func envMap(key string) map[string]string {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(k) != "" {
+			m[strings.TrimSpace(k)] = strings.ToUpper(strings.TrimSpace(v))
+		}
+	}
+	return m
+}
+
+// envSet reads a comma-separated list into a set.
+func envSet(key, fallback string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range strings.Split(envString(key, fallback), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var ErrSlotUnavailable = errors.New("time overlaps an existing session or blocked time")
+
+// ConsultingHours are when consultants take sessions, in El Salvador time:
+// back-to-back sessions of Session length from DayStart until DayEnd.
+type ConsultingHours struct {
+	DayStart string
+	DayEnd   string
+	Session  time.Duration
+}
+
+func (h ConsultingHours) validate() error {
+	start, err1 := time.Parse("15:04", h.DayStart)
+	end, err2 := time.Parse("15:04", h.DayEnd)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("consulting day start and end must be formatted HH:MM")
+	}
+	if h.Session <= 0 || end.Sub(start) < h.Session {
+		return fmt.Errorf("consulting day must fit at least one %s session", h.Session)
+	}
+	return nil
+}
+
+// slotTimes lists the day's session start times, as HH:MM.
+func (h ConsultingHours) slotTimes() []string {
+	start, _ := time.Parse("15:04", h.DayStart)
+	end, _ := time.Parse("15:04", h.DayEnd)
+	var slots []string
+	for t := start; !t.Add(h.Session).After(end); t = t.Add(h.Session) {
+		slots = append(slots, t.Format("15:04"))
+	}
+	return slots
+}
+
+// sessionSpan is when a consulting booking starts and ends.
+func (b *Booking) sessionSpan() (time.Time, time.Time) {
+	start, _ := time.ParseInLocation(time.DateOnly+" 15:04", b.Date+" "+b.Slot, localZone)
+	return start, start.Add(time.Duration(b.DurationMinutes) * time.Minute)
+}
+
+// TimeBlock is personal time during which a consultant takes no sessions.
+type TimeBlock struct {
+	ID           string            `json:"block_id"`
+	ConsultantID string            `json:"consultant_id"`
+	Start        apitypes.JSONTime `json:"start"`
+	End          apitypes.JSONTime `json:"end"`
+	Reason       string            `json:"reason,omitempty"`
+	CreatedAt    apitypes.JSONTime `json:"created_at"`
+}
+
+// consultingConflictsLocked returns the sessions and blocked time of a
+// consultant that overlap [from, to). Callers must hold s.mu.
+func (s *Store) consultingConflictsLocked(consultantID string, from, to time.Time) ([]Booking, []TimeBlock) {
+	var bookings []Booking
+	for _, b := range s.bookings {
+		if b.Kind != KindConsulting || b.OfferingID != consultantID || !b.occupies() {
+			continue
+		}
+		if start, end := b.sessionSpan(); start.Before(to) && from.Before(end) {
+			bookings = append(bookings, *b)
+		}
+	}
+	var blocks []TimeBlock
+	for _, tb := range s.timeBlocks {
+		if tb.ConsultantID == consultantID && tb.Start.Before(to) && from.Before(tb.End.Time) {
+			blocks = append(blocks, *tb)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool {
+		a, _ := bookings[i].sessionSpan()
+		b, _ := bookings[j].sessionSpan()
+		return a.Before(b)
+	})
+	return bookings, blocks
+}
+
+// BlockConsultantTime marks [start, end) unavailable. It fails with
+// ErrBlockConflict, listing them, when sessions are already booked then.
+func (s *Store) BlockConsultantTime(consultantID string, start, end time.Time, reason string, now time.Time) (TimeBlock, []Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bookings, _ := s.consultingConflictsLocked(consultantID, start, end); len(bookings) > 0 {
+		return TimeBlock{}, bookings, ErrBlockConflict
+	}
+	tb := TimeBlock{
+		ID:           newID(),
+		ConsultantID: consultantID,
+		Start:        apitypes.JSONTime{Time: start},
+		End:          apitypes.JSONTime{Time: end},
+		Reason:       reason,
+		CreatedAt:    apitypes.JSONTime{Time: now},
+	}
+	s.timeBlocks[tb.ID] = &tb
+	return tb, nil, nil
+}
+
+// ConsultantBlocks lists a consultant's blocked time ending after now,
+// earliest first.
+func (s *Store) ConsultantBlocks(consultantID string, now time.Time) []TimeBlock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blocks := []TimeBlock{}
+	for _, tb := range s.timeBlocks {
+		if tb.ConsultantID == consultantID && tb.End.After(now) {
+			blocks = append(blocks, *tb)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Start.Before(blocks[j].Start.Time) })
+	return blocks
+}
+
+// UnblockConsultantTime removes a block.
+func (s *Store) UnblockConsultantTime(consultantID, blockID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tb, ok := s.timeBlocks[blockID]
+	if !ok || tb.ConsultantID != consultantID {
+		return ErrNotFound
+	}
+	delete(s.timeBlocks, blockID)
+	return nil
+}
+
+// ConsultingSlots lists the slots on date that are neither booked nor
+// blocked.
+func (s *Store) ConsultingSlots(consultantID, date string, hours ConsultingHours) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	free := []string{}
+	for _, slot := range hours.slotTimes() {
+		probe := Booking{Date: date, Slot: slot, DurationMinutes: int(hours.Session / time.Minute)}
+		start, end := probe.sessionSpan()
+		if bookings, blocks := s.consultingConflictsLocked(consultantID, start, end); len(bookings) == 0 && len(blocks) == 0 {
+			free = append(free, slot)
+		}
+	}
+	return free
+}
+
+// offersSlot reports whether slot is one of the day's session start times.
+func (h ConsultingHours) offersSlot(slot string) bool {
+	for _, t := range h.slotTimes() {
+		if t == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// createConsultingBookingHandler books a session with a consultant in one
+// of their free slots.
+func (s *server) createConsultingBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ConsultantID string `json:"consultant_id"`
+		Date         string `json:"date"`
+		Slot         string `json:"slot"`
+		GuestName    string `json:"guest_name"`
+		GuestEmail   string `json:"guest_email"`
+		GuestPhone   string `json:"guest_phone"`
+		Referral     string `json:"referral_code"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if err := validateBooking(bookingFields{
+		OfferingField: "consultant_id", OfferingID: req.ConsultantID,
+		DateField: "date", Date: req.Date,
+		PartySize: 1, GuestEmail: req.GuestEmail,
+	}); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+	if !s.cfg.ConsultingHours.offersSlot(req.Slot) {
+		respondError(w, http.StatusBadRequest, "invalid_slot", "slot must be one of "+strings.Join(s.cfg.ConsultingHours.slotTimes(), ", "))
+		return
+	}
+	if name, ok := s.consultingHoliday(req.ConsultantID, req.Date); ok {
+		respondError(w, http.StatusConflict, "holiday", fmt.Sprintf("consultants take no sessions on %s, a public holiday (%s)", req.Date, name))
+		return
+	}
+	b, err := s.store.AddBooking(Booking{
+		Tenant:          s.tenant(r.Context()).ID,
+		Kind:            KindConsulting,
+		OfferingID:      req.ConsultantID,
+		Date:            req.Date,
+		Slot:            req.Slot,
+		DurationMinutes: int(s.cfg.ConsultingHours.Session / time.Minute),
+		PartySize:       1,
+		GuestName:       req.GuestName,
+		GuestEmail:      req.GuestEmail,
+		GuestPhone:      req.GuestPhone,
+		ReferralCode:    strings.TrimSpace(req.Referral),
+	}, s.now())
+	if errors.Is(err, ErrSlotUnavailable) {
+		respondError(w, http.StatusConflict, "slot_unavailable", err.Error())
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, b)
+}
+
+// consultingSlotsHandler lists a consultant's free slots on ?date=. A
+// public holiday in the consultant's region has none, and names the
+// holiday.
+func (s *server) consultingSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+		return
+	}
+	consultantID := chi.URLParam(r, "consultantId")
+	resp := map[string]interface{}{
+		"consultant_id": consultantID,
+		"date":          date,
+	}
+	if name, ok := s.consultingHoliday(consultantID, date); ok {
+		resp["slots"], resp["holiday"] = []string{}, name
+	} else {
+		resp["slots"] = s.store.ConsultingSlots(consultantID, date, s.cfg.ConsultingHours)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// blockConsultantTimeHandler blocks personal time. Body: {"start": RFC 3339,
+// "end": RFC 3339, "reason": "..."}.
+func (s *server) blockConsultantTimeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Start  apitypes.JSONTime `json:"start"`
+		End    apitypes.JSONTime `json:"end"`
+		Reason string            `json:"reason"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.Start.IsZero() || !req.End.After(req.Start.Time) {
+		respondError(w, http.StatusBadRequest, "invalid_range", "start and end are required and end must be after start")
+		return
+	}
+	tb, conflicts, err := s.store.BlockConsultantTime(chi.URLParam(r, "consultantId"), req.Start.Time, req.End.Time, strings.TrimSpace(req.Reason), s.now())
+	if errors.Is(err, ErrBlockConflict) {
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "bookings_in_range",
+			"message":   err.Error(),
+			"conflicts": conflicts,
+		})
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, tb)
+}
+
+func (s *server) listConsultantBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.store.ConsultantBlocks(chi.URLParam(r, "consultantId"), s.now()))
+}
+
+func (s *server) unblockConsultantTimeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.UnblockConsultantTime(chi.URLParam(r, "consultantId"), chi.URLParam(r, "blockId")); err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
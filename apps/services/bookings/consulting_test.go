@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func bookSession(t *testing.T, s *server, date, slot string) (Booking, *httptest.ResponseRecorder) {
+	t.Helper()
+	var b Booking
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/consulting", map[string]interface{}{
+		"consultant_id": "maria-bitcoin", "date": date, "slot": slot,
+		"guest_name": "Ana", "guest_email": "ana@example.com",
+	}, &b)
+	return b, rec
+}
+
+func consultingSlots(t *testing.T, s *server, date string) []string {
+	t.Helper()
+	var got struct {
+		Slots []string `json:"slots"`
+	}
+	doJSON(t, s.routes(), http.MethodGet, "/api/bookings/consulting/maria-bitcoin/slots?date="+date, nil, &got)
+	return got.Slots
+}
+
+func TestConsultantBlockRemovesSlots(t *testing.T) {
+	s, _ := newTestServer(t)
+	if got := consultingSlots(t, s, "2026-03-10"); len(got) != 8 {
+		t.Fatalf("slots = %v, want eight hourly slots from 09:00", got)
+	}
+
+	// 12:00-14:30 El Salvador time blocks the 12:00, 13:00 and 14:00 slots.
+	var tb TimeBlock
+	rec := doStaff(t, s.routes(), http.MethodPost, "/api/bookings/consulting/maria-bitcoin/block", map[string]interface{}{
+		"start": "2026-03-10T18:00:00Z", "end": "2026-03-10T20:30:00Z", "reason": "Dentist",
+	}, &tb)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("block: status %d: %s", rec.Code, rec.Body)
+	}
+	got := consultingSlots(t, s, "2026-03-10")
+	want := []string{"09:00", "10:00", "11:00", "15:00", "16:00"}
+	if len(got) != len(want) {
+		t.Fatalf("slots = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("slots = %v, want %v", got, want)
+		}
+	}
+	if _, rec := bookSession(t, s, "2026-03-10", "13:00"); rec.Code != http.StatusConflict {
+		t.Fatalf("booking blocked slot: status %d, want 409", rec.Code)
+	}
+
+	var blocks []TimeBlock
+	doJSON(t, s.routes(), http.MethodGet, "/api/bookings/consulting/maria-bitcoin/blocks", nil, &blocks)
+	if len(blocks) != 1 || blocks[0].ID != tb.ID || blocks[0].Reason != "Dentist" {
+		t.Fatalf("blocks = %+v", blocks)
+	}
+	rec = doStaff(t, s.routes(), http.MethodDelete, "/api/bookings/consulting/maria-bitcoin/block/"+tb.ID, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unblock: status %d", rec.Code)
+	}
+	if got := consultingSlots(t, s, "2026-03-10"); len(got) != 8 {
+		t.Fatalf("slots after unblock = %v", got)
+	}
+}
+
+func TestConsultantBlockRequiresStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	block := map[string]interface{}{"start": "2026-03-10T18:00:00Z", "end": "2026-03-10T20:30:00Z"}
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/consulting/maria-bitcoin/block", block, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("block without credentials: status %d, want 401", rec.Code)
+	}
+	if got := consultingSlots(t, s, "2026-03-10"); len(got) != 8 {
+		t.Fatalf("unauthorised block removed slots: %v", got)
+	}
+
+	var tb TimeBlock
+	doStaff(t, h, http.MethodPost, "/api/bookings/consulting/maria-bitcoin/block", block, &tb)
+	if rec := doJSON(t, h, http.MethodDelete, "/api/bookings/consulting/maria-bitcoin/block/"+tb.ID, nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unblock without credentials: status %d, want 401", rec.Code)
+	}
+	if got := consultingSlots(t, s, "2026-03-10"); len(got) != 5 {
+		t.Fatalf("unauthorised unblock reopened slots: %v", got)
+	}
+}
+
+func TestConsultantBlockRejectsOverlappingBooking(t *testing.T) {
+	s, _ := newTestServer(t)
+	b, rec := bookSession(t, s, "2026-03-10", "10:00")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var got struct {
+		Error     string    `json:"error"`
+		Conflicts []Booking `json:"conflicts"`
+	}
+	rec = doStaff(t, s.routes(), http.MethodPost, "/api/bookings/consulting/maria-bitcoin/block", map[string]interface{}{
+		"start": "2026-03-10T15:30:00Z", "end": "2026-03-10T17:00:00Z",
+	}, &got)
+	if rec.Code != http.StatusConflict || got.Error != "bookings_in_range" {
+		t.Fatalf("status %d: %s, want 409 bookings_in_range", rec.Code, rec.Body)
+	}
+	if len(got.Conflicts) != 1 || got.Conflicts[0].ID != b.ID {
+		t.Fatalf("conflicts = %+v, want the 10:00 session", got.Conflicts)
+	}
+	if slots := consultingSlots(t, s, "2026-03-10"); len(slots) != 7 {
+		t.Fatalf("slots = %v, want only the booked one gone", slots)
+	}
+}
+
+func TestConsultingHolidayRemovesSlotsAndRejectsBookings(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.ConsultingRegion = "SV"
+	s.cfg.ConsultantRegions = map[string]string{"juan-us": "US"}
+	holidays, err := loadHolidayCalendar("", "SV:2026-09-15:Independence Day,US:2026-07-04")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.Holidays = holidays
+
+	var got struct {
+		Slots   []string `json:"slots"`
+		Holiday string   `json:"holiday"`
+	}
+	doJSON(t, s.routes(), http.MethodGet, "/api/bookings/consulting/maria-bitcoin/slots?date=2026-09-15", nil, &got)
+	if len(got.Slots) != 0 || got.Holiday != "Independence Day" {
+		t.Fatalf("holiday slots = %v (%q), want none on Independence Day", got.Slots, got.Holiday)
+	}
+	if got := consultingSlots(t, s, "2026-09-16"); len(got) != 8 {
+		t.Fatalf("slots the day after = %v, want all eight", got)
+	}
+	if _, rec := bookSession(t, s, "2026-09-15", "10:00"); rec.Code != http.StatusConflict {
+		t.Fatalf("book on holiday: status %d, want 409", rec.Code)
+	}
+
+	// A consultant in another region keeps their slots on SV holidays and
+	// loses them on their own.
+	doJSON(t, s.routes(), http.MethodGet, "/api/bookings/consulting/juan-us/slots?date=2026-09-15", nil, &got)
+	if len(got.Slots) != 8 {
+		t.Fatalf("US consultant on SV holiday: slots = %v, want all eight", got.Slots)
+	}
+	doJSON(t, s.routes(), http.MethodGet, "/api/bookings/consulting/juan-us/slots?date=2026-07-04", nil, &got)
+	if len(got.Slots) != 0 {
+		t.Fatalf("US consultant on US holiday: slots = %v, want none", got.Slots)
+	}
+}
+
+func TestLoadHolidayCalendarFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "holidays.json")
+	if err := os.WriteFile(path, []byte(`{"sv": {"2026-12-25": "Christmas Day"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadHolidayCalendar(path, "SV:2026-11-02:Day of the Dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := c.Holiday("SV", "2026-12-25"); !ok || name != "Christmas Day" {
+		t.Fatalf("christmas = %q, %v", name, ok)
+	}
+	if _, ok := c.Holiday("SV", "2026-11-02"); !ok {
+		t.Fatal("inline holiday missing")
+	}
+	if _, err := loadHolidayCalendar("", "SV:15-09-2026"); err == nil {
+		t.Fatal("malformed date accepted")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// Risk factors that raise a booking's deposit.
+const (
+	DepositFactorNewGuest  = "new_guest"
+	DepositFactorHighValue = "high_value"
+	DepositFactorShortLead = "short_lead_time"
+)
+
+// DepositPolicy sizes the deposit taken at checkout by how risky the
+// booking is. Every booking pays BasePercent of its price; a guest with no
+// earlier paid booking, a price of at least HighValueCents and a start
+// within ShortLeadTime each add their percentage, up to MaxPercent. With
+// the policy disabled checkout takes the whole price.
+type DepositPolicy struct {
+	Enabled          bool
+	BasePercent      apitypes.Percent
+	MaxPercent       apitypes.Percent
+	NewGuestPercent  apitypes.Percent
+	HighValueCents   int64
+	HighValuePercent apitypes.Percent
+	ShortLeadTime    time.Duration
+	ShortLeadPercent apitypes.Percent
+}
+
+// DepositFactor is one risk factor that raised a deposit, and by how much.
+type DepositFactor struct {
+	Factor  string           `json:"factor"`
+	Percent apitypes.Percent `json:"percent"`
+	Detail  string           `json:"detail"`
+}
+
+// Deposit is what checkout charges for a booking now, and what is left for
+// the balance.
+type Deposit struct {
+	Percent      apitypes.Percent `json:"percent"`
+	AmountCents  int64            `json:"amount_cents"`
+	BalanceCents int64            `json:"balance_cents"`
+	Factors      []DepositFactor  `json:"factors"`
+}
+
+func loadDepositPolicy() DepositPolicy {
+	return DepositPolicy{
+		Enabled:          envBool("DEPOSITS_ENABLED", false),
+		BasePercent:      envPercent("DEPOSIT_BASE_PERCENT", 30*apitypes.OnePercent),
+		MaxPercent:       envPercent("DEPOSIT_MAX_PERCENT", apitypes.HundredPercent),
+		NewGuestPercent:  envPercent("DEPOSIT_NEW_GUEST_PERCENT", 20*apitypes.OnePercent),
+		HighValueCents:   int64(envInt("DEPOSIT_HIGH_VALUE_CENTS", 100000)),
+		HighValuePercent: envPercent("DEPOSIT_HIGH_VALUE_PERCENT", 20*apitypes.OnePercent),
+		ShortLeadTime:    envDuration("DEPOSIT_SHORT_LEAD_TIME", 7*24*time.Hour),
+		ShortLeadPercent: envPercent("DEPOSIT_SHORT_LEAD_PERCENT", 30*apitypes.OnePercent),
+	}
+}
+
+// validate refuses a policy that could take nothing, or more than the
+// price.
+func (p DepositPolicy) validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	if p.BasePercent <= 0 || p.MaxPercent < p.BasePercent || p.MaxPercent > apitypes.HundredPercent {
+		return fmt.Errorf("DEPOSIT_BASE_PERCENT must be above 0 and at most DEPOSIT_MAX_PERCENT, which must be at most 100")
+	}
+	if p.NewGuestPercent < 0 || p.HighValuePercent < 0 || p.ShortLeadPercent < 0 {
+		return fmt.Errorf("deposit risk factor percentages must not be negative")
+	}
+	return nil
+}
+
+// Size computes the deposit for b at now. returningGuest is whether its
+// guest has paid for an earlier booking. A booking whose start cannot be
+// read is treated as starting now, as for refunds.
+func (p DepositPolicy) Size(b Booking, returningGuest bool, now time.Time) Deposit {
+	d := Deposit{Percent: apitypes.HundredPercent, Factors: []DepositFactor{}}
+	if p.Enabled {
+		d.Percent = p.BasePercent
+		if !returningGuest {
+			d.Factors = append(d.Factors, DepositFactor{DepositFactorNewGuest, p.NewGuestPercent, "no earlier paid booking"})
+		}
+		if p.HighValueCents > 0 && b.PriceCents >= p.HighValueCents {
+			d.Factors = append(d.Factors, DepositFactor{DepositFactorHighValue, p.HighValuePercent,
+				fmt.Sprintf("price of at least %s", formatCents(p.HighValueCents))})
+		}
+		start, err := b.startsAt()
+		if err != nil {
+			start = now
+		}
+		if p.ShortLeadTime > 0 && start.Sub(now) < p.ShortLeadTime {
+			d.Factors = append(d.Factors, DepositFactor{DepositFactorShortLead, p.ShortLeadPercent,
+				fmt.Sprintf("starts within %s", p.ShortLeadTime)})
+		}
+		for _, f := range d.Factors {
+			d.Percent += f.Percent
+		}
+		d.Percent = min(d.Percent, p.MaxPercent)
+	}
+	d.AmountCents = min(d.Percent.Of(b.PriceCents), b.PriceCents)
+	d.BalanceCents = b.PriceCents - d.AmountCents
+	return d
+}
+
+// ReturningGuest reports whether guestEmail has paid for a booking other
+// than excludeID.
+func (s *Store) ReturningGuest(guestEmail, excludeID string) bool {
+	if guestEmail == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.bookings {
+		if b.ID == excludeID || !strings.EqualFold(b.GuestEmail, guestEmail) {
+			continue
+		}
+		switch b.Status {
+		case StatusConfirmed, StatusCheckedIn:
+			return true
+		}
+	}
+	return false
+}
+
+// depositFor sizes the deposit checkout takes for b now.
+func (s *server) depositFor(b Booking) Deposit {
+	return s.cfg.Deposits.Size(b, s.store.ReturningGuest(b.GuestEmail, b.ID), s.now())
+}
+
+// checkoutPreviewHandler shows what checkout would charge for a booking and
+// the risk factors that sized its deposit.
+func (s *server) checkoutPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store.Booking(chi.URLParam(r, "bookingId"))
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"booking_id":  b.ID,
+		"price_cents": b.PriceCents,
+		"currency":    s.tenant(r.Context()).Currency,
+		"deposit":     s.depositFor(b),
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func testDepositPolicy() DepositPolicy {
+	return DepositPolicy{
+		Enabled:          true,
+		BasePercent:      30 * apitypes.OnePercent,
+		MaxPercent:       apitypes.HundredPercent,
+		NewGuestPercent:  20 * apitypes.OnePercent,
+		HighValueCents:   100000,
+		HighValuePercent: 20 * apitypes.OnePercent,
+		ShortLeadTime:    7 * 24 * time.Hour,
+		ShortLeadPercent: 30 * apitypes.OnePercent,
+	}
+}
+
+func TestHighRiskBookingPaysLargerDeposit(t *testing.T) {
+	p := testDepositPolicy()
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, localZone)
+	low := p.Size(Booking{PriceCents: 20000, Date: "2026-04-01"}, true, now)
+	high := p.Size(Booking{PriceCents: 200000, Date: "2026-03-03"}, false, now)
+
+	if low.Percent != 30*apitypes.OnePercent || low.AmountCents != 6000 || low.BalanceCents != 14000 || len(low.Factors) != 0 {
+		t.Fatalf("low risk = %+v, want the 30%% base", low)
+	}
+	if high.Percent != apitypes.HundredPercent || high.AmountCents != 200000 || high.BalanceCents != 0 {
+		t.Fatalf("high risk = %+v, want 100%%", high)
+	}
+	if high.Percent <= low.Percent {
+		t.Fatalf("high risk deposit %s not above low risk %s", high.Percent, low.Percent)
+	}
+	var factors []string
+	for _, f := range high.Factors {
+		factors = append(factors, f.Factor)
+	}
+	if len(factors) != 3 || factors[0] != DepositFactorNewGuest || factors[1] != DepositFactorHighValue || factors[2] != DepositFactorShortLead {
+		t.Fatalf("factors = %v", factors)
+	}
+}
+
+func TestDisabledDepositPolicyTakesFullPrice(t *testing.T) {
+	d := DepositPolicy{}.Size(Booking{PriceCents: 9000, Date: "2026-03-02"}, false, time.Now())
+	if d.Percent != apitypes.HundredPercent || d.AmountCents != 9000 || d.BalanceCents != 0 || len(d.Factors) != 0 {
+		t.Fatalf("deposit = %+v, want the full price", d)
+	}
+}
+
+func TestCheckoutChargesDepositForBookingRisk(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.Deposits = testDepositPolicy()
+	h := s.routes()
+
+	// ana has never paid before, so her first booking carries the new
+	// guest factor.
+	first := seedPricedTour(t, s)
+	var preview struct {
+		PriceCents int64   `json:"price_cents"`
+		Deposit    Deposit `json:"deposit"`
+	}
+	if rec := doJSON(t, h, http.MethodGet, "/api/bookings/"+first.ID+"/checkout/preview", nil, &preview); rec.Code != http.StatusOK {
+		t.Fatalf("preview: status %d: %s", rec.Code, rec.Body)
+	}
+	if preview.PriceCents != 9000 || preview.Deposit.AmountCents != 4500 ||
+		len(preview.Deposit.Factors) != 1 || preview.Deposit.Factors[0].Factor != DepositFactorNewGuest {
+		t.Fatalf("preview = %+v, want 50%% for a new guest", preview)
+	}
+
+	var resp struct {
+		Deposit Deposit `json:"deposit"`
+	}
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/"+first.ID+"/checkout", nil, &resp); rec.Code != http.StatusOK {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	payments := s.payments.(*fakePayments)
+	if got := payments.checkouts[0]; got.AmountCents != 4500 || resp.Deposit.BalanceCents != 4500 {
+		t.Fatalf("checkout %+v, deposit %+v; want 4500 charged", got, resp.Deposit)
+	}
+
+	// Once she has a paid booking she is no longer new.
+	seedConfirmedTour(t, s)
+	second := seedPricedTour(t, s)
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/"+second.ID+"/checkout", nil, &resp); rec.Code != http.StatusOK {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := payments.checkouts[1]; got.AmountCents != 2700 || len(resp.Deposit.Factors) != 0 {
+		t.Fatalf("checkout %+v, deposit %+v; want the 30%% base for a returning guest", got, resp.Deposit)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var ErrGuestBlocked = errors.New("guest has a payment dispute pending and cannot book until it is resolved")
+
+// Dispute states, as reported by the payments service.
+const (
+	DisputeOpen = "open"
+	DisputeWon  = "won"
+	DisputeLost = "lost"
+)
+
+// BookingDispute is a chargeback the guest raised on a booking's payment.
+// PreviousStatus is what the booking returns to if the dispute is won.
+type BookingDispute struct {
+	ID             string            `json:"dispute_id"`
+	PaymentRef     string            `json:"payment_ref"`
+	AmountCents    int64             `json:"amount_cents"`
+	Currency       string            `json:"currency,omitempty"`
+	Reason         string            `json:"reason,omitempty"`
+	Status         string            `json:"status"`
+	PreviousStatus BookingStatus     `json:"previous_status"`
+	OpenedAt       apitypes.JSONTime `json:"opened_at"`
+	ClosedAt       apitypes.JSONTime `json:"closed_at"`
+}
+
+// OpenDispute marks a paid booking StatusDisputed. Reopening the dispute it
+// already carries changes nothing.
+func (s *Store) OpenDispute(id string, d BookingDispute, now time.Time) (Booking, error) {
+	return s.UpdateBooking(id, now, func(b *Booking) error {
+		if b.Dispute != nil && b.Dispute.ID == d.ID {
+			return nil
+		}
+		switch b.Status {
+		case StatusConfirmed, StatusPendingApproval, StatusCheckedIn, StatusNoShow:
+		default:
+			return ErrInvalidTransition
+		}
+		d.Status, d.PreviousStatus, d.OpenedAt = DisputeOpen, b.Status, apitypes.JSONTime{Time: now}
+		b.Dispute, b.Status = &d, StatusDisputed
+		return nil
+	})
+}
+
+// CloseDispute finalises a booking's dispute. A won dispute returns the
+// booking to the status it had when the dispute opened. A lost one leaves
+// the booking unpaid, so it is cancelled and its seats freed.
+func (s *Store) CloseDispute(id, disputeID string, won bool, now time.Time) (Booking, error) {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	if b.Dispute == nil || b.Dispute.ID != disputeID {
+		return Booking{}, ErrInvalidTransition
+	}
+	if b.Dispute.Status != DisputeOpen {
+		return *b, nil
+	}
+	d := *b.Dispute
+	d.ClosedAt = apitypes.JSONTime{Time: now}
+	if won {
+		d.Status = DisputeWon
+		b.Status = d.PreviousStatus
+	} else {
+		d.Status = DisputeLost
+		s.releaseBookingLocked(b)
+		b.Status = StatusCancelled
+	}
+	b.Dispute = &d
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	return *b, nil
+}
+
+// BlockGuest stops a guest making new bookings while disputeID is open.
+func (s *Store) BlockGuest(email, disputeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blockedGuests[strings.ToLower(email)] = disputeID
+}
+
+// UnblockGuest lifts the block disputeID placed on a guest. A block for
+// another dispute stays.
+func (s *Store) UnblockGuest(email, disputeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.blockedGuests[strings.ToLower(email)] == disputeID {
+		delete(s.blockedGuests, strings.ToLower(email))
+	}
+}
+
+// recordDisputeHandler takes a chargeback reported by the payments service:
+// an open dispute marks the booking disputed, and a closed one settles it.
+// With DisputeBlocksGuest the guest cannot book again until it closes.
+func (s *server) recordDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DisputeID   string `json:"dispute_id"`
+		PaymentRef  string `json:"payment_ref"`
+		AmountCents int64  `json:"amount_cents"`
+		Currency    string `json:"currency"`
+		Reason      string `json:"reason"`
+		Status      string `json:"status"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.DisputeID == "" {
+		respondError(w, http.StatusBadRequest, "invalid_dispute", "dispute_id is required")
+		return
+	}
+	id := chi.URLParam(r, "bookingId")
+	var (
+		b   Booking
+		err error
+	)
+	switch req.Status {
+	case DisputeOpen:
+		b, err = s.store.OpenDispute(id, BookingDispute{
+			ID:          req.DisputeID,
+			PaymentRef:  req.PaymentRef,
+			AmountCents: req.AmountCents,
+			Currency:    req.Currency,
+			Reason:      req.Reason,
+		}, s.now())
+		if err == nil && s.cfg.DisputeBlocksGuest && b.GuestEmail != "" {
+			s.store.BlockGuest(b.GuestEmail, req.DisputeID)
+		}
+	case DisputeWon, DisputeLost:
+		b, err = s.store.CloseDispute(id, req.DisputeID, req.Status == DisputeWon, s.now())
+		if err == nil && b.GuestEmail != "" {
+			s.store.UnblockGuest(b.GuestEmail, req.DisputeID)
+		}
+	default:
+		respondError(w, http.StatusBadRequest, "invalid_dispute", "status must be open, won or lost")
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	log.Printf("ALERT: booking %s dispute %s %s; booking is now %s", b.ID, req.DisputeID, req.Status, b.Status)
+	respondJSON(w, http.StatusOK, b)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// paidTour books and pays for a tour for ana@example.com.
+func paidTour(t *testing.T, s *server) Booking {
+	t.Helper()
+	b, rec := bookTour(t, s, "", 2)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+	doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "pi_1", "amount_cents": 9000, "currency": "USD",
+	}, &b)
+	if b.Status != StatusConfirmed {
+		t.Fatalf("paid booking = %s, want confirmed", b.Status)
+	}
+	return b
+}
+
+func postDispute(t *testing.T, s *server, bookingID, status string) (Booking, *httptest.ResponseRecorder) {
+	t.Helper()
+	var b Booking
+	rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+bookingID+"/dispute", map[string]interface{}{
+		"dispute_id": "dp_1", "payment_ref": "pi_1", "amount_cents": 9000, "currency": "USD",
+		"reason": "fraudulent", "status": status,
+	}, &b)
+	return b, rec
+}
+
+func TestDisputeMarksBookingDisputedAndWinRestoresIt(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := paidTour(t, s)
+
+	got, rec := postDispute(t, s, b.ID, DisputeOpen)
+	if rec.Code != http.StatusOK || got.Status != StatusDisputed || got.Dispute == nil || got.Dispute.PreviousStatus != StatusConfirmed {
+		t.Fatalf("open dispute: status %d booking %+v", rec.Code, got)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 2 {
+		t.Fatalf("disputed booking gave up its seats: booked = %d", d.Booked)
+	}
+
+	got, _ = postDispute(t, s, b.ID, DisputeWon)
+	if got.Status != StatusConfirmed || got.Dispute.Status != DisputeWon {
+		t.Fatalf("won dispute: booking %s, dispute %s; want confirmed and won", got.Status, got.Dispute.Status)
+	}
+}
+
+func TestLostDisputeCancelsBooking(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := paidTour(t, s)
+	postDispute(t, s, b.ID, DisputeOpen)
+
+	got, _ := postDispute(t, s, b.ID, DisputeLost)
+	if got.Status != StatusCancelled || got.Dispute.Status != DisputeLost {
+		t.Fatalf("lost dispute: booking %s, dispute %s; want cancelled and lost", got.Status, got.Dispute.Status)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 0 {
+		t.Fatalf("booked = %d, want seats freed", d.Booked)
+	}
+}
+
+func TestDisputeBlocksGuestUntilClosed(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.DisputeBlocksGuest = true
+	b := paidTour(t, s)
+	postDispute(t, s, b.ID, DisputeOpen)
+
+	var errBody map[string]interface{}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "slot": "08:00", "party_size": 1,
+		"guest_name": "Ana", "customer_email": "ANA@example.com",
+	}, &errBody)
+	if rec.Code != http.StatusForbidden || errBody["error"] != "guest_blocked" {
+		t.Fatalf("blocked guest booking: status %d: %s", rec.Code, rec.Body)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 2 {
+		t.Fatalf("refused booking took seats: booked = %d", d.Booked)
+	}
+
+	postDispute(t, s, b.ID, DisputeWon)
+	if _, rec := bookTour(t, s, "", 1); rec.Code != http.StatusCreated {
+		t.Fatalf("guest still blocked after dispute closed: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDisputeOnUnpaidBookingRefused(t *testing.T) {
+	s, _ := newTestServer(t)
+	b, _ := bookTour(t, s, "", 2)
+	if _, rec := postDispute(t, s, b.ID, DisputeOpen); rec.Code != http.StatusConflict {
+		t.Fatalf("dispute on pending booking: status %d, want 409", rec.Code)
+	}
+}
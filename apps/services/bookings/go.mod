@@ -5,4 +5,18 @@ go 1.22
 require (
 	github.com/go-chi/chi/v5 v5.2.0
 	github.com/go-chi/cors v1.2.1
+	github.com/jackc/pgx/v5 v5.6.0
+	golang.org/x/sync v0.7.0
 )
+
+require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
+
+require github.com/pupuseria/gateway-es/packages/gokit v0.0.0
+
+replace github.com/pupuseria/gateway-es/packages/gokit => ../../../packages/gokit
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGuestAtBookingCapIsBlocked(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.store.LimitActiveBookings(2)
+
+	first, rec := bookTour(t, s, "es", 1)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first: status %d: %s", rec.Code, rec.Body)
+	}
+	// Below the cap, a second booking of any kind succeeds.
+	if _, rec := bookStay(t, s, "2026-04-01", "2026-04-03"); rec.Code != http.StatusCreated {
+		t.Fatalf("second: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var got map[string]string
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "slot": "08:00", "party_size": 1, "customer_email": "ANA@example.com",
+	}, &got)
+	if rec.Code != http.StatusTooManyRequests || got["error"] != "booking_limit_reached" {
+		t.Fatalf("at cap: status %d: %s, want 429 booking_limit_reached", rec.Code, rec.Body)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 1 {
+		t.Fatalf("blocked booking took seats: booked = %d", d.Booked)
+	}
+
+	// Cancelled bookings no longer count.
+	if _, err := s.store.CancelBooking(first.ID, s.now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, rec := bookTour(t, s, "es", 1); rec.Code != http.StatusCreated {
+		t.Fatalf("after cancelling: status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// HoldStatus is the lifecycle state of an agency seat block.
+type HoldStatus string
+
+const (
+	HoldActive    HoldStatus = "active"
+	HoldReleased  HoldStatus = "released"
+	HoldExpired   HoldStatus = "expired"
+	HoldExhausted HoldStatus = "exhausted"
+)
+
+// BlockHold is a provisional reservation of several seats on one departure,
+// taken by a travel agency and filled with real bookings over time.
+type BlockHold struct {
+	ID         string            `json:"hold_id"`
+	Tenant     string            `json:"tenant,omitempty"`
+	TourID     string            `json:"tour_id"`
+	Date       string            `json:"date"`
+	Slot       string            `json:"slot,omitempty"`
+	AgencyID   string            `json:"agency_id"`
+	Seats      int               `json:"seats"`
+	Converted  int               `json:"converted"`
+	Released   int               `json:"released"`
+	Status     HoldStatus        `json:"status"`
+	BookingIDs []string          `json:"booking_ids"`
+	ExpiresAt  apitypes.JSONTime `json:"expires_at"`
+	CreatedAt  apitypes.JSONTime `json:"created_at"`
+}
+
+// Outstanding is the number of seats still held and not yet converted or
+// released.
+func (h BlockHold) Outstanding() int {
+	return h.Seats - h.Converted - h.Released
+}
+
+// HoldGuest is one party an agency books into its held seats.
+type HoldGuest struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone,omitempty"`
+	PartySize int    `json:"party_size"`
+}
+
+// CreateBlockHold reserves seats on a departure for an agency selling for
+// tenant until expiresAt.
+func (s *Store) CreateBlockHold(tenant, tourID, date, slot, agencyID string, seats int, now, expiresAt time.Time) (BlockHold, error) {
+	key := departureKey{tourID, date, slot}
+	if err := s.reserveShared(key, seats); err != nil {
+		return BlockHold{}, err
+	}
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.departureLocked(key)
+	if d.Remaining() < seats {
+		s.queueReleaseLocked(key, seats)
+		return BlockHold{}, ErrInsufficientCapacity
+	}
+	d.Held += seats
+
+	h := &BlockHold{
+		ID:         newID(),
+		Tenant:     tenant,
+		TourID:     tourID,
+		Date:       date,
+		Slot:       slot,
+		AgencyID:   agencyID,
+		Seats:      seats,
+		Status:     HoldActive,
+		BookingIDs: []string{},
+		ExpiresAt:  apitypes.JSONTime{Time: expiresAt},
+		CreatedAt:  apitypes.JSONTime{Time: now},
+	}
+	s.holds[h.ID] = h
+	return *h, nil
+}
+
+// BlockHold returns tenant's hold on a tour.
+func (s *Store) BlockHold(tenant, tourID, holdID string) (BlockHold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.holds[holdID]
+	if !ok || h.TourID != tourID || h.Tenant != tenant {
+		return BlockHold{}, ErrNotFound
+	}
+	return *h, nil
+}
+
+// activeHoldLocked looks up tenant's hold that can still be drawn from,
+// expiring it first if its deadline has passed. Another tenant's hold is
+// not found. Callers must hold s.mu.
+func (s *Store) activeHoldLocked(tenant, tourID, holdID string, now time.Time) (*BlockHold, error) {
+	h, ok := s.holds[holdID]
+	if !ok || h.TourID != tourID || h.Tenant != tenant {
+		return nil, ErrNotFound
+	}
+	if h.Status == HoldActive && !now.Before(h.ExpiresAt.Time) {
+		s.expireHoldLocked(h)
+	}
+	switch h.Status {
+	case HoldActive:
+		return h, nil
+	case HoldExpired:
+		return nil, ErrHoldExpired
+	default:
+		return nil, ErrHoldInactive
+	}
+}
+
+// releaseSeatsLocked returns n outstanding seats of h to the departure.
+// Callers must defer s.flushReleases.
+func (s *Store) releaseSeatsLocked(h *BlockHold, n int) {
+	key := departureKey{h.TourID, h.Date, h.Slot}
+	s.departureLocked(key).Held -= n
+	h.Released += n
+	s.queueReleaseLocked(key, n)
+}
+
+func (s *Store) expireHoldLocked(h *BlockHold) {
+	s.releaseSeatsLocked(h, h.Outstanding())
+	h.Status = HoldExpired
+}
+
+// settleHoldLocked marks a hold finished once nothing is left outstanding.
+func settleHoldLocked(h *BlockHold) {
+	if h.Outstanding() > 0 {
+		return
+	}
+	if h.Converted > 0 {
+		h.Status = HoldExhausted
+	} else {
+		h.Status = HoldReleased
+	}
+}
+
+// ReleaseBlockHold gives seats of tenant's hold back to public inventory. A
+// seats value of zero releases everything still outstanding.
+func (s *Store) ReleaseBlockHold(tenant, tourID, holdID string, seats int, now time.Time) (BlockHold, error) {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, err := s.activeHoldLocked(tenant, tourID, holdID, now)
+	if err != nil {
+		return BlockHold{}, err
+	}
+	if seats == 0 {
+		seats = h.Outstanding()
+	}
+	if seats > h.Outstanding() {
+		return BlockHold{}, ErrInsufficientCapacity
+	}
+	s.releaseSeatsLocked(h, seats)
+	settleHoldLocked(h)
+	return *h, nil
+}
+
+// ConvertBlockHold turns seats of tenant's hold into bookings, one per
+// guest party at the matching price. The seats were already committed to
+// the agency, which settles with its guests itself, so the bookings are
+// confirmed straight away with check-in tokens. Either every party is
+// booked or none are.
+func (s *Store) ConvertBlockHold(tenant, tourID, holdID string, guests []HoldGuest, prices []PriceBreakdown, now time.Time) (BlockHold, []Booking, error) {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, err := s.activeHoldLocked(tenant, tourID, holdID, now)
+	if err != nil {
+		return BlockHold{}, nil, err
+	}
+	seats := 0
+	for _, g := range guests {
+		seats += g.PartySize
+	}
+	if seats > h.Outstanding() {
+		return BlockHold{}, nil, ErrInsufficientCapacity
+	}
+
+	d := s.departureLocked(departureKey{h.TourID, h.Date, h.Slot})
+	created := make([]Booking, 0, len(guests))
+	for i, g := range guests {
+		b := &Booking{
+			ID:           newID(),
+			Tenant:       h.Tenant,
+			Kind:         KindTour,
+			OfferingID:   h.TourID,
+			Date:         h.Date,
+			Slot:         h.Slot,
+			PartySize:    g.PartySize,
+			GuestName:    g.Name,
+			GuestEmail:   g.Email,
+			GuestPhone:   g.Phone,
+			PriceCents:   prices[i].TotalCents,
+			Currency:     prices[i].Currency,
+			Status:       StatusConfirmed,
+			CheckInToken: newCheckInToken(),
+			AgencyID:     h.AgencyID,
+			HoldID:       h.ID,
+			CreatedAt:    apitypes.JSONTime{Time: now},
+			UpdatedAt:    apitypes.JSONTime{Time: now},
+		}
+		s.bookings[b.ID] = b
+		h.BookingIDs = append(h.BookingIDs, b.ID)
+		created = append(created, *b)
+	}
+	d.Held -= seats
+	d.Booked += seats
+	h.Converted += seats
+	settleHoldLocked(h)
+	return *h, created, nil
+}
+
+// ExpireBlockHolds releases the outstanding seats of every hold whose expiry
+// has passed and returns the holds it expired.
+func (s *Store) ExpireBlockHolds(now time.Time) []BlockHold {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []BlockHold
+	for _, h := range s.holds {
+		if h.Status == HoldActive && !now.Before(h.ExpiresAt.Time) {
+			s.expireHoldLocked(h)
+			expired = append(expired, *h)
+		}
+	}
+	return expired
+}
+
+// sweepBlockHolds periodically expires overdue holds and waitlist offers
+// until ctx is done, offering the seats they free to the waitlist.
+func (s *server) sweepBlockHolds(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.HoldSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, h := range s.store.ExpireBlockHolds(s.now()) {
+				log.Printf("block hold %s for tour %s expired, released %d seats", h.ID, h.TourID, h.Released)
+				s.offerFreedSeats(ctx, h.TourID, h.Date, h.Slot)
+			}
+			s.expireWaitlistOffers(ctx)
+		}
+	}
+}
+
+func (s *server) createBlockHoldHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Date       string `json:"date"`
+		Slot       string `json:"slot"`
+		AgencyID   string `json:"agency_id"`
+		Seats      int    `json:"seats"`
+		TTLMinutes int    `json:"ttl_minutes"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+		return
+	}
+	if req.AgencyID == "" || req.Seats < 1 {
+		respondError(w, http.StatusBadRequest, "invalid_hold", "agency_id and a positive seats count are required")
+		return
+	}
+
+	// An agency may ask for a shorter hold than BlockHoldTTL, never a
+	// longer one.
+	if maxMinutes := int(s.cfg.BlockHoldTTL / time.Minute); req.TTLMinutes < 0 || req.TTLMinutes > maxMinutes {
+		respondError(w, http.StatusBadRequest, "invalid_ttl", fmt.Sprintf("ttl_minutes must be between 1 and %d", maxMinutes))
+		return
+	}
+
+	now := s.now()
+	ttl := s.cfg.BlockHoldTTL
+	if req.TTLMinutes > 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+	hold, err := s.store.CreateBlockHold(s.tenant(r.Context()).ID, chi.URLParam(r, "tourId"), req.Date, req.Slot, req.AgencyID, req.Seats, now, now.Add(ttl))
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, hold)
+}
+
+func (s *server) releaseBlockHoldHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Seats int `json:"seats"`
+	}
+	// An empty body releases every outstanding seat.
+	if err := httpkit.DecodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.Seats < 0 {
+		respondError(w, http.StatusBadRequest, "invalid_seats", "seats must not be negative")
+		return
+	}
+	hold, err := s.store.ReleaseBlockHold(s.tenant(r.Context()).ID, chi.URLParam(r, "tourId"), chi.URLParam(r, "holdId"), req.Seats, s.now())
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, hold)
+}
+
+func (s *server) convertBlockHoldHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Guests []HoldGuest `json:"guests"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if len(req.Guests) == 0 {
+		respondError(w, http.StatusBadRequest, "invalid_guests", "at least one guest party is required")
+		return
+	}
+	for _, g := range req.Guests {
+		if g.Email == "" || g.PartySize < 1 {
+			respondError(w, http.StatusBadRequest, "invalid_guests", "each guest needs an email and a positive party_size")
+			return
+		}
+	}
+	tenant, tourID, holdID := s.tenant(r.Context()).ID, chi.URLParam(r, "tourId"), chi.URLParam(r, "holdId")
+	held, err := s.store.BlockHold(tenant, tourID, holdID)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	prices := make([]PriceBreakdown, len(req.Guests))
+	for i, g := range req.Guests {
+		pb, ok := s.priceTourBooking(w, r, tourID, held.Date, held.Slot, g.PartySize, nil, "")
+		if !ok {
+			return
+		}
+		prices[i] = pb
+	}
+	hold, bookings, err := s.store.ConvertBlockHold(tenant, tourID, holdID, req.Guests, prices, s.now())
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	for _, b := range bookings {
+		s.bookingConfirmed(r.Context(), b)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"hold":     hold,
+		"bookings": bookings,
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+func TestBlockHoldPartialConvertThenExpiry(t *testing.T) {
+	s, clock := newTestServer(t)
+	h := s.routes()
+
+	var hold BlockHold
+	rec := doAgency(t, h, http.MethodPost, "/api/bookings/tours/volcano-hike/block-hold", map[string]interface{}{
+		"date": "2026-03-14", "slot": "09:00", "agency_id": "agencia-sol", "seats": 10, "ttl_minutes": 60,
+	}, &hold)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create hold: status %d body %s", rec.Code, rec.Body)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "09:00"); d.Held != 10 || d.Remaining() != 2 {
+		t.Fatalf("after hold: held=%d remaining=%d, want 10 and 2", d.Held, d.Remaining())
+	}
+
+	var converted struct {
+		Hold     BlockHold `json:"hold"`
+		Bookings []Booking `json:"bookings"`
+	}
+	rec = doAgency(t, h, http.MethodPost, "/api/bookings/tours/volcano-hike/block-hold/"+hold.ID+"/convert", map[string]interface{}{
+		"guests": []HoldGuest{{Name: "Ana", Email: "ana@example.com", PartySize: 3}, {Name: "Luis", Email: "luis@example.com", PartySize: 1}},
+	}, &converted)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("convert: status %d body %s", rec.Code, rec.Body)
+	}
+	if len(converted.Bookings) != 2 || converted.Hold.Outstanding() != 6 {
+		t.Fatalf("convert: %d bookings, %d outstanding; want 2 and 6", len(converted.Bookings), converted.Hold.Outstanding())
+	}
+	// The agency settles with its guests, so their seats are confirmed.
+	for i, b := range converted.Bookings {
+		if b.Status != StatusConfirmed || b.CheckInToken == "" || b.PriceCents != 4500*int64([]int{3, 1}[i]) {
+			t.Errorf("booking %s status %s price %d, want confirmed at 4500 a seat", b.ID, b.Status, b.PriceCents)
+		}
+	}
+
+	clock.advance(61 * time.Minute)
+	expired := s.store.ExpireBlockHolds(clock.now())
+	if len(expired) != 1 || expired[0].Released != 6 || expired[0].Status != HoldExpired {
+		t.Fatalf("expiry: got %+v, want one expired hold releasing 6 seats", expired)
+	}
+	d := s.store.Departure("volcano-hike", "2026-03-14", "09:00")
+	if d.Held != 0 || d.Booked != 4 || d.Remaining() != 8 {
+		t.Fatalf("after expiry: held=%d booked=%d remaining=%d, want 0, 4, 8", d.Held, d.Booked, d.Remaining())
+	}
+
+	rec = doAgency(t, h, http.MethodPost, "/api/bookings/tours/volcano-hike/block-hold/"+hold.ID+"/convert", map[string]interface{}{
+		"guests": []HoldGuest{{Email: "late@example.com", PartySize: 1}},
+	}, nil)
+	if rec.Code != http.StatusGone {
+		t.Fatalf("convert after expiry: status %d, want 410", rec.Code)
+	}
+}
+
+func TestBlockHoldRelease(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+
+	var hold BlockHold
+	doAgency(t, h, http.MethodPost, "/api/bookings/tours/lake-kayak/block-hold", map[string]interface{}{
+		"date": "2026-04-02", "agency_id": "agencia-sol", "seats": 5,
+	}, &hold)
+
+	rec := doAgency(t, h, http.MethodPost, "/api/bookings/tours/lake-kayak/block-hold/"+hold.ID+"/release", map[string]int{"seats": 2}, &hold)
+	if rec.Code != http.StatusOK || hold.Outstanding() != 3 || hold.Status != HoldActive {
+		t.Fatalf("partial release: status %d outstanding %d hold status %s", rec.Code, hold.Outstanding(), hold.Status)
+	}
+	rec = doAgency(t, h, http.MethodPost, "/api/bookings/tours/lake-kayak/block-hold/"+hold.ID+"/release", nil, &hold)
+	if rec.Code != http.StatusOK || hold.Status != HoldReleased {
+		t.Fatalf("full release: status %d hold status %s", rec.Code, hold.Status)
+	}
+	if d := s.store.Departure("lake-kayak", "2026-04-02", ""); d.Remaining() != 12 {
+		t.Fatalf("remaining %d after full release, want 12", d.Remaining())
+	}
+}
+
+func TestBlockHoldRejectsOversizedBlock(t *testing.T) {
+	s, _ := newTestServer(t)
+	rec := doAgency(t, s.routes(), http.MethodPost, "/api/bookings/tours/lake-kayak/block-hold", map[string]interface{}{
+		"date": "2026-04-02", "agency_id": "agencia-sol", "seats": 13,
+	}, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409", rec.Code)
+	}
+}
+
+func TestBlockHoldNeedsAgencyAndBoundedTTL(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	body := map[string]interface{}{"date": "2026-04-02", "agency_id": "agencia-sol", "seats": 2}
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/tours/lake-kayak/block-hold", body, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without credentials: status %d, want 401", rec.Code)
+	}
+	// BlockHoldTTL is an hour in tests; the second would overflow a Duration.
+	for _, ttl := range []int{61, math.MaxInt} {
+		body["ttl_minutes"] = ttl
+		if rec := doAgency(t, h, http.MethodPost, "/api/bookings/tours/lake-kayak/block-hold", body, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("ttl_minutes %d: status %d, want 400", ttl, rec.Code)
+		}
+	}
+	if d := s.store.Departure("lake-kayak", "2026-04-02", ""); d.Held != 0 {
+		t.Fatalf("held = %d, want no seats taken", d.Held)
+	}
+}
+
+func TestBlockHoldBelongsToItsTenant(t *testing.T) {
+	s, clock := newTestServer(t)
+	hold, err := s.store.CreateBlockHold(tenantkit.DefaultID, "lake-kayak", "2026-04-02", "", "agencia-sol", 4, clock.now(), clock.now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.ReleaseBlockHold("volcanica", "lake-kayak", hold.ID, 0, clock.now()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("release by another tenant: err %v, want ErrNotFound", err)
+	}
+	guests := []HoldGuest{{Email: "ana@example.com", PartySize: 1}}
+	if _, _, err := s.store.ConvertBlockHold("volcanica", "lake-kayak", hold.ID, guests, make([]PriceBreakdown, 1), clock.now()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("convert by another tenant: err %v, want ErrNotFound", err)
+	}
+	if d := s.store.Departure("lake-kayak", "2026-04-02", ""); d.Held != 4 {
+		t.Fatalf("held = %d, want the hold untouched", d.Held)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// HolidayCalendar lists public holidays by region: region code, such as
+// "SV", to YYYY-MM-DD date to the holiday's name. Consultants are not
+// bookable on their region's holidays.
+type HolidayCalendar map[string]map[string]string
+
+// Holiday returns the name of the holiday on date in region, if any.
+func (c HolidayCalendar) Holiday(region, date string) (string, bool) {
+	name, ok := c[strings.ToUpper(region)][date]
+	return name, ok
+}
+
+func (c HolidayCalendar) add(region, date, name string) error {
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return fmt.Errorf("holiday %q in %s: date must be formatted YYYY-MM-DD", name, region)
+	}
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region == "" {
+		return fmt.Errorf("holiday on %s: region is required", date)
+	}
+	if c[region] == nil {
+		c[region] = make(map[string]string)
+	}
+	c[region][date] = strings.TrimSpace(name)
+	return nil
+}
+
+// parseHolidays reads a comma-separated list of REGION:YYYY-MM-DD:Name
+// entries, e.g. "SV:2026-09-15:Independence Day". The name is optional.
+func parseHolidays(list string, into HolidayCalendar) error {
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 {
+			return fmt.Errorf("holiday %q must be formatted REGION:YYYY-MM-DD:Name", entry)
+		}
+		name := ""
+		if len(parts) == 3 {
+			name = parts[2]
+		}
+		if err := into.add(parts[0], strings.TrimSpace(parts[1]), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadHolidayCalendar reads the holiday calendar from the JSON file at path,
+// when set, then adds the inline HOLIDAYS list. The file maps regions to
+// dates to names: {"SV": {"2026-09-15": "Independence Day"}}.
+func loadHolidayCalendar(path, inline string) (HolidayCalendar, error) {
+	c := make(HolidayCalendar)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("holiday calendar: %w", err)
+		}
+		var file map[string]map[string]string
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("holiday calendar %s: %w", path, err)
+		}
+		for region, days := range file {
+			for date, name := range days {
+				if err := c.add(region, date, name); err != nil {
+					return nil, fmt.Errorf("holiday calendar %s: %w", path, err)
+				}
+			}
+		}
+	}
+	if err := parseHolidays(inline, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// consultantRegion is the region whose holidays a consultant observes.
+func (c config) consultantRegion(consultantID string) string {
+	if region, ok := c.ConsultantRegions[consultantID]; ok {
+		return region
+	}
+	return c.ConsultingRegion
+}
+
+// consultingHoliday returns the holiday, if any, that keeps a consultant
+// from taking sessions on date.
+func (s *server) consultingHoliday(consultantID, date string) (string, bool) {
+	return s.cfg.Holidays.Holiday(s.cfg.consultantRegion(consultantID), date)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// inventoryTimeout bounds each round trip to the shared seat inventory.
+const inventoryTimeout = 5 * time.Second
+
+// SeatInventory is the seat count shared by every replica of the bookings
+// service. The Store's own lock only serialises requests within one
+// process; reserving against a SeatInventory first is what stops two
+// replicas from selling the same last seat. It counts every seat taken,
+// whether by a booking or an agency block hold.
+type SeatInventory interface {
+	// Reserve takes seats on d, or returns ErrInsufficientCapacity when
+	// fewer than seats remain. d.Capacity seeds departures the inventory
+	// has not seen before.
+	Reserve(ctx context.Context, d Departure, seats int) error
+	// Release returns seats previously reserved on d.
+	Release(ctx context.Context, d Departure, seats int) error
+	// EnsureBooked raises the seats counted taken on d to at least seats,
+	// returning the count before. It never lowers the count, which may
+	// include seats other replicas sold.
+	EnsureBooked(ctx context.Context, d Departure, seats int) (before int, err error)
+}
+
+// pgSeatInventory keeps seat counts in the tour_departures table. A
+// reservation is a single conditional UPDATE, so Postgres takes the row lock
+// and re-checks the remaining seats atomically; no SELECT ... FOR UPDATE
+// round trip is needed.
+type pgSeatInventory struct {
+	pool *pgxpool.Pool
+}
+
+func newPGSeatInventory(pool *pgxpool.Pool) *pgSeatInventory {
+	return &pgSeatInventory{pool: pool}
+}
+
+const (
+	seedDepartureSQL = `
+INSERT INTO tour_departures (tour_id, date, slot, capacity)
+VALUES ($1, $2::date, $3, $4)
+ON CONFLICT (tour_id, date, slot) DO NOTHING`
+
+	reserveSeatsSQL = `
+UPDATE tour_departures
+   SET booked = booked + $4, updated_at = now()
+ WHERE tour_id = $1 AND date = $2::date AND slot = $3
+   AND capacity - booked >= $4`
+
+	releaseSeatsSQL = `
+UPDATE tour_departures
+   SET booked = GREATEST(booked - $4, 0), updated_at = now()
+ WHERE tour_id = $1 AND date = $2::date AND slot = $3`
+
+	lockBookedSQL = `
+SELECT booked FROM tour_departures
+ WHERE tour_id = $1 AND date = $2::date AND slot = $3
+   FOR UPDATE`
+
+	setBookedSQL = `
+UPDATE tour_departures
+   SET booked = $4, updated_at = now()
+ WHERE tour_id = $1 AND date = $2::date AND slot = $3`
+)
+
+func (inv *pgSeatInventory) Reserve(ctx context.Context, d Departure, seats int) error {
+	return pgx.BeginFunc(ctx, inv.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, seedDepartureSQL, d.TourID, d.Date, d.Slot, d.Capacity); err != nil {
+			return fmt.Errorf("seed departure: %w", err)
+		}
+		tag, err := tx.Exec(ctx, reserveSeatsSQL, d.TourID, d.Date, d.Slot, seats)
+		if err != nil {
+			return fmt.Errorf("reserve seats: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInsufficientCapacity
+		}
+		return nil
+	})
+}
+
+func (inv *pgSeatInventory) Release(ctx context.Context, d Departure, seats int) error {
+	if _, err := inv.pool.Exec(ctx, releaseSeatsSQL, d.TourID, d.Date, d.Slot, seats); err != nil {
+		return fmt.Errorf("release seats: %w", err)
+	}
+	return nil
+}
+
+func (inv *pgSeatInventory) EnsureBooked(ctx context.Context, d Departure, seats int) (before int, err error) {
+	err = pgx.BeginFunc(ctx, inv.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, seedDepartureSQL, d.TourID, d.Date, d.Slot, d.Capacity); err != nil {
+			return fmt.Errorf("seed departure: %w", err)
+		}
+		if err := tx.QueryRow(ctx, lockBookedSQL, d.TourID, d.Date, d.Slot).Scan(&before); err != nil {
+			return fmt.Errorf("read seats: %w", err)
+		}
+		if before >= seats {
+			return nil
+		}
+		if _, err := tx.Exec(ctx, setBookedSQL, d.TourID, d.Date, d.Slot, seats); err != nil {
+			return fmt.Errorf("set seats: %w", err)
+		}
+		return nil
+	})
+	return before, err
+}
+
+// seatRelease is shared-inventory work queued under the store lock and
+// carried out once it is released.
+type seatRelease struct {
+	departure Departure
+	seats     int
+}
+
+// UseInventory makes the store reserve tour seats against inv before
+// committing them locally.
+func (s *Store) UseInventory(inv SeatInventory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inventory = inv
+}
+
+// reserveShared reserves seats in the shared inventory, if there is one.
+// It must be called without s.mu held.
+func (s *Store) reserveShared(key departureKey, seats int) error {
+	s.mu.Lock()
+	inv := s.inventory
+	d := *s.departureLocked(key)
+	s.mu.Unlock()
+	if inv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), inventoryTimeout)
+	defer cancel()
+	return inv.Reserve(ctx, d, seats)
+}
+
+// queueReleaseLocked schedules seats to be returned to the shared inventory
+// by the next flushReleases. Callers must hold s.mu.
+func (s *Store) queueReleaseLocked(key departureKey, seats int) {
+	if s.inventory == nil {
+		return
+	}
+	s.pendingReleases = append(s.pendingReleases, seatRelease{departure: *s.departureLocked(key), seats: seats})
+}
+
+// flushReleases returns queued seats to the shared inventory. Methods that
+// may release seats defer it before taking s.mu so it runs after the lock
+// is dropped. A failed release leaves the seats unsellable rather than
+// oversold, so it is alerted on rather than retried.
+func (s *Store) flushReleases() {
+	s.mu.Lock()
+	inv, pending := s.inventory, s.pendingReleases
+	s.pendingReleases = nil
+	s.mu.Unlock()
+	for _, r := range pending {
+		ctx, cancel := context.WithTimeout(context.Background(), inventoryTimeout)
+		if err := inv.Release(ctx, r.departure, r.seats); err != nil {
+			log.Printf("ALERT: releasing %d seats on %s %s %s: %v", r.seats, r.departure.TourID, r.departure.Date, r.departure.Slot, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fakeInventory is an in-memory SeatInventory shared by several stores, as
+// a database would be by several replicas. Like tour_departures, a
+// departure's capacity is fixed by whichever store reserves on it first.
+type fakeInventory struct {
+	mu       sync.Mutex
+	capacity map[departureKey]int
+	booked   map[departureKey]int
+}
+
+func newFakeInventory() *fakeInventory {
+	return &fakeInventory{capacity: make(map[departureKey]int), booked: make(map[departureKey]int)}
+}
+
+func (f *fakeInventory) Reserve(_ context.Context, d Departure, seats int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := departureKey{d.TourID, d.Date, d.Slot}
+	if _, ok := f.capacity[key]; !ok {
+		f.capacity[key] = d.Capacity
+	}
+	if f.capacity[key]-f.booked[key] < seats {
+		return ErrInsufficientCapacity
+	}
+	f.booked[key] += seats
+	return nil
+}
+
+func (f *fakeInventory) Release(_ context.Context, d Departure, seats int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.booked[departureKey{d.TourID, d.Date, d.Slot}] -= seats
+	return nil
+}
+
+func (f *fakeInventory) EnsureBooked(_ context.Context, d Departure, seats int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := departureKey{d.TourID, d.Date, d.Slot}
+	if _, ok := f.capacity[key]; !ok {
+		f.capacity[key] = d.Capacity
+	}
+	before := f.booked[key]
+	f.booked[key] = max(before, seats)
+	return before, nil
+}
+
+func (f *fakeInventory) bookedOn(tourID, date, slot string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.booked[departureKey{tourID, date, slot}]
+}
+
+// raceForLastSeat fires attempts concurrent single-seat bookings, spread
+// round-robin over stores, and returns how many succeeded.
+func raceForLastSeat(t *testing.T, stores []*Store, attempts int) int {
+	t.Helper()
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	var ok atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(s *Store) {
+			defer wg.Done()
+			<-start
+			_, err := s.AddBooking(Booking{Kind: KindTour, OfferingID: "el-boqueron", Date: "2026-04-02", Slot: "06:00", PartySize: 1}, now)
+			switch {
+			case err == nil:
+				ok.Add(1)
+			case !errors.Is(err, ErrInsufficientCapacity):
+				t.Errorf("AddBooking: %v", err)
+			}
+		}(stores[i%len(stores)])
+	}
+	close(start)
+	wg.Wait()
+	return int(ok.Load())
+}
+
+func TestLastSeatSoldOnceWithinReplica(t *testing.T) {
+	s := NewStore(1)
+	if got := raceForLastSeat(t, []*Store{s}, 50); got != 1 {
+		t.Fatalf("%d bookings succeeded, want 1", got)
+	}
+	if d := s.Departure("el-boqueron", "2026-04-02", "06:00"); d.Booked != 1 {
+		t.Fatalf("booked = %d, want 1", d.Booked)
+	}
+}
+
+func TestLastSeatSoldOnceAcrossReplicas(t *testing.T) {
+	inv := newFakeInventory()
+	stores := []*Store{NewStore(1), NewStore(1), NewStore(1)}
+	for _, s := range stores {
+		s.UseInventory(inv)
+	}
+	if got := raceForLastSeat(t, stores, 60); got != 1 {
+		t.Fatalf("%d bookings succeeded, want 1", got)
+	}
+	if got := inv.bookedOn("el-boqueron", "2026-04-02", "06:00"); got != 1 {
+		t.Fatalf("shared inventory booked = %d, want 1", got)
+	}
+}
+
+func TestReleasedSeatsReturnToSharedInventory(t *testing.T) {
+	inv := newFakeInventory()
+	s := NewStore(4)
+	s.UseInventory(inv)
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	b, err := s.AddBooking(Booking{Kind: KindTour, OfferingID: "el-boqueron", Date: "2026-04-02", PartySize: 3}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inv.bookedOn("el-boqueron", "2026-04-02", ""); got != 3 {
+		t.Fatalf("after booking: shared booked = %d, want 3", got)
+	}
+	if _, err := s.CancelBooking(b.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := inv.bookedOn("el-boqueron", "2026-04-02", ""); got != 0 {
+		t.Fatalf("after cancel: shared booked = %d, want 0", got)
+	}
+}
+
+func TestLocalRejectionReleasesSharedReservation(t *testing.T) {
+	inv := newFakeInventory()
+	s := NewStore(4)
+	s.UseInventory(inv)
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	// Another replica seeded the departure with more seats than this one
+	// now allows, so the shared reservation succeeds but the local check
+	// fails.
+	if err := inv.Reserve(context.Background(), Departure{TourID: "el-boqueron", Date: "2026-04-02", Capacity: 8}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.AddBooking(Booking{Kind: KindTour, OfferingID: "el-boqueron", Date: "2026-04-02", PartySize: 6}, now)
+	if !errors.Is(err, ErrInsufficientCapacity) {
+		t.Fatalf("err = %v, want ErrInsufficientCapacity", err)
+	}
+	if got := inv.bookedOn("el-boqueron", "2026-04-02", ""); got != 0 {
+		t.Fatalf("shared booked = %d, want 0", got)
+	}
+}
+
+// TestPostgresLastSeatSoldOnce runs the race against a real database. Set
+// BOOKINGS_TEST_DATABASE_URL to a disposable Postgres to run it.
+func TestPostgresLastSeatSoldOnce(t *testing.T) {
+	url := os.Getenv("BOOKINGS_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("BOOKINGS_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := pool.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS tour_departures (
+	tour_id    varchar(100) NOT NULL,
+	date       date NOT NULL,
+	slot       varchar(5) NOT NULL DEFAULT '',
+	capacity   integer NOT NULL,
+	booked     integer NOT NULL DEFAULT 0,
+	created_at timestamp DEFAULT now(),
+	updated_at timestamp DEFAULT now(),
+	PRIMARY KEY (tour_id, date, slot)
+)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `DELETE FROM tour_departures WHERE tour_id = 'el-boqueron'`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Separate stores stand in for separate replicas: none of them can see
+	// the others' in-memory counts, so only Postgres can keep the seat
+	// from being sold twice.
+	inv := newPGSeatInventory(pool)
+	stores := make([]*Store, 10)
+	for i := range stores {
+		stores[i] = NewStore(1)
+		stores[i].UseInventory(inv)
+	}
+	if got := raceForLastSeat(t, stores, 100); got != 1 {
+		t.Fatalf("%d bookings succeeded, want 1", got)
+	}
+	var booked int
+	if err := pool.QueryRow(ctx, `SELECT booked FROM tour_departures WHERE tour_id = 'el-boqueron'`).Scan(&booked); err != nil {
+		t.Fatal(err)
+	}
+	if booked != 1 {
+		t.Fatalf("booked = %d, want 1", booked)
+	}
+
+	// Reconciling raises a count that lost seats and leaves a higher one.
+	d := Departure{TourID: "el-boqueron", Date: "2026-04-02", Slot: "06:00", Capacity: 1}
+	if _, err := pool.Exec(ctx, `UPDATE tour_departures SET booked = 0 WHERE tour_id = 'el-boqueron'`); err != nil {
+		t.Fatal(err)
+	}
+	for _, seats := range []int{1, 0} {
+		if before, err := inv.EnsureBooked(ctx, d, seats); err != nil || before != 1-seats {
+			t.Fatalf("EnsureBooked(%d) = %d, %v", seats, before, err)
+		}
+	}
+	if err := pool.QueryRow(ctx, `SELECT booked FROM tour_departures WHERE tour_id = 'el-boqueron'`).Scan(&booked); err != nil || booked != 1 {
+		t.Fatalf("booked = %d, %v, want 1", booked, err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// jobAttemptTimeout bounds each background retry of a job.
+const jobAttemptTimeout = 30 * time.Second
+
+// Job is a unit of work the queue retries until it succeeds. OnFailure is
+// called with the last error once the job fails permanently or runs out of
+// attempts.
+type Job struct {
+	Name      string
+	Run       func(ctx context.Context) error
+	OnFailure func(err error, attempts int)
+}
+
+// JobQueue runs jobs with retries. A job is tried once straight away on the
+// caller's goroutine, so the usual case costs no extra latency; if that
+// fails it is retried in the background with linear backoff, and an alert
+// is raised when it finally gives up.
+type JobQueue struct {
+	maxAttempts int
+	backoff     time.Duration
+	// alert is called once a job has failed for good.
+	alert func(job string, err error)
+
+	wg sync.WaitGroup
+}
+
+func NewJobQueue(maxAttempts int, backoff time.Duration) *JobQueue {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &JobQueue{
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		alert: func(job string, err error) {
+			log.Printf("ALERT: %s failed: %v", job, err)
+		},
+	}
+}
+
+// permanentError marks a failure that retrying cannot fix, such as a
+// rejected address.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so the queue does not retry it.
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var pe permanentError
+	return errors.As(err, &pe)
+}
+
+// Submit runs j, retrying it in the background if the first attempt fails.
+func (q *JobQueue) Submit(ctx context.Context, j Job) {
+	err := j.Run(ctx)
+	if err == nil {
+		return
+	}
+	if isPermanent(err) || q.maxAttempts == 1 {
+		q.fail(j, err, 1)
+		return
+	}
+	log.Printf("%s: attempt 1 failed, retrying: %v", j.Name, err)
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		q.retry(j)
+	}()
+}
+
+func (q *JobQueue) retry(j Job) {
+	for attempt := 2; ; attempt++ {
+		time.Sleep(q.backoff * time.Duration(attempt-1))
+		ctx, cancel := context.WithTimeout(context.Background(), jobAttemptTimeout)
+		err := j.Run(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+		if isPermanent(err) || attempt == q.maxAttempts {
+			q.fail(j, err, attempt)
+			return
+		}
+		log.Printf("%s: attempt %d failed, retrying: %v", j.Name, attempt, err)
+	}
+}
+
+func (q *JobQueue) fail(j Job, err error, attempts int) {
+	if j.OnFailure != nil {
+		j.OnFailure(err, attempts)
+	}
+	q.alert(j.Name, err)
+}
+
+// Wait blocks until every background retry has finished.
+func (q *JobQueue) Wait() {
+	q.wg.Wait()
+}
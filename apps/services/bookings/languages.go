@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrLanguageNotOffered = errors.New("the tour is not offered in that language")
+	ErrNoGuideAvailable   = errors.New("no guide who speaks that language is free for the departure")
+)
+
+// languagePattern is an ISO 639-1 code such as "es" or "en".
+var languagePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+// normalizeLanguages lowercases codes, drops duplicates and checks each is an
+// ISO 639-1 code, keeping the order given.
+func normalizeLanguages(codes []string) ([]string, error) {
+	seen := make(map[string]bool, len(codes))
+	out := make([]string, 0, len(codes))
+	for _, c := range codes {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !languagePattern.MatchString(c) {
+			return nil, fmt.Errorf("language %q must be a two-letter ISO 639-1 code", c)
+		}
+		if !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func containsLanguage(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Guide leads tour departures in the languages they speak.
+type Guide struct {
+	ID        string   `json:"guide_id"`
+	Name      string   `json:"name"`
+	Languages []string `json:"languages"`
+}
+
+// SetTourLanguages records the languages a tour is offered in. An empty
+// list falls back to the platform's supported languages.
+func (s *Store) SetTourLanguages(tourID string, languages []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(languages) == 0 {
+		delete(s.tourLanguages, tourID)
+		return
+	}
+	s.tourLanguages[tourID] = append([]string(nil), languages...)
+}
+
+// TourLanguages returns the languages a tour is offered in, or supported
+// when it has none of its own.
+func (s *Store) TourLanguages(tourID string, supported []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if languages, ok := s.tourLanguages[tourID]; ok {
+		return append([]string(nil), languages...)
+	}
+	return append([]string(nil), supported...)
+}
+
+// PutGuide adds or replaces a guide on the roster.
+func (s *Store) PutGuide(g Guide) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g.Languages = append([]string(nil), g.Languages...)
+	s.guides[g.ID] = g
+}
+
+// Guides lists the roster by id.
+func (s *Store) Guides() []Guide {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	guides := make([]Guide, 0, len(s.guides))
+	for _, g := range s.guides {
+		guides = append(guides, g)
+	}
+	sort.Slice(guides, func(i, j int) bool { return guides[i].ID < guides[j].ID })
+	return guides
+}
+
+// guideForLocked picks the guide for a party on a departure in language.
+// Parties sharing a departure and language share a guide; otherwise the
+// first guide by id who speaks the language and is not leading another
+// group at the same date and slot is chosen. With no roster configured,
+// guides are not assigned and it returns "". Callers must hold s.mu.
+func (s *Store) guideForLocked(key departureKey, language string) (string, error) {
+	if len(s.guides) == 0 {
+		return "", nil
+	}
+	busy := make(map[string]bool)
+	for _, b := range s.bookings {
+		if b.Kind != KindTour || b.GuideID == "" || !b.occupies() || b.Date != key.Date || b.Slot != key.Slot {
+			continue
+		}
+		if b.OfferingID == key.TourID && b.Language == language {
+			return b.GuideID, nil
+		}
+		busy[b.GuideID] = true
+	}
+	ids := make([]string, 0, len(s.guides))
+	for id := range s.guides {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !busy[id] && containsLanguage(s.guides[id].Languages, language) {
+			return id, nil
+		}
+	}
+	return "", ErrNoGuideAvailable
+}
+
+// LanguageAvailability is whether a departure can still be booked in one
+// language.
+type LanguageAvailability struct {
+	Language  string `json:"language"`
+	Available bool   `json:"available"`
+	GuideID   string `json:"guide_id,omitempty"`
+}
+
+// DepartureLanguages reports, for each offered language, whether a guide
+// can lead it on the departure.
+func (s *Store) DepartureLanguages(key departureKey, offered []string) []LanguageAvailability {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]LanguageAvailability, 0, len(offered))
+	for _, lang := range offered {
+		guide, err := s.guideForLocked(key, lang)
+		out = append(out, LanguageAvailability{Language: lang, Available: err == nil, GuideID: guide})
+	}
+	return out
+}
+
+// TourBooking is a guest's request for seats on a tour departure. Slot is
+// the departure's start time, HH:MM, and may be empty for a tour that runs
+// once a day.
+type TourBooking struct {
+	TourID        string  `json:"tour_id"`
+	Date          string  `json:"date"`
+	Slot          string  `json:"slot"`
+	PartySize     int     `json:"party_size"`
+	Language      string  `json:"language"`
+	GuestName     string  `json:"guest_name"`
+	CustomerEmail string  `json:"customer_email"`
+	GuestPhone    string  `json:"guest_phone"`
+	AddOns        []AddOn `json:"add_ons"`
+	PromoCode     string  `json:"promo_code"`
+	Referral      string  `json:"referral_code"`
+}
+
+// AvailabilityChecker decides whether a tour departure can still take a
+// party of partySize at now, returning ErrDeparted once it has left and
+// ErrInsufficientCapacity when it is short of seats. It is checked before
+// anything is priced or reserved; reserving the seats checks again.
+type AvailabilityChecker interface {
+	TourAvailable(tourID, date, slot string, partySize int, now time.Time) error
+}
+
+// TourAvailable checks a departure against the seats this replica knows
+// of. With a shared seat inventory AddBooking has the final say.
+func (s *Store) TourAvailable(tourID, date, slot string, partySize int, now time.Time) error {
+	if (Booking{Date: date, Slot: slot}).departed(now) {
+		return fmt.Errorf("%w: %s", ErrDeparted, strings.TrimSpace(date+" "+slot))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.departureLocked(departureKey{tourID, date, slot}).Remaining() < partySize {
+		return ErrInsufficientCapacity
+	}
+	return nil
+}
+
+// createTourBookingHandler books seats on a tour departure in the guest's
+// language, defaulting to the first the tour is offered in. Departures that
+// have already left, or lack the seats for the party, are refused with 409.
+func (s *server) createTourBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var req TourBooking
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if err := validateBooking(bookingFields{
+		OfferingField: "tour_id", OfferingID: req.TourID,
+		DateField: "date", Date: req.Date,
+		PartySize:  req.PartySize,
+		EmailField: "customer_email", GuestEmail: req.CustomerEmail,
+	}); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+	if _, err := time.Parse("15:04", req.Slot); req.Slot != "" && err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_slot", "slot must be a time formatted HH:MM")
+		return
+	}
+	if err := s.tourAvailability.TourAvailable(req.TourID, req.Date, req.Slot, req.PartySize, s.now()); err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	offered := s.store.TourLanguages(req.TourID, s.cfg.TourLanguages)
+	language := strings.ToLower(strings.TrimSpace(req.Language))
+	if language == "" && len(offered) > 0 {
+		language = offered[0]
+	}
+	if !containsLanguage(offered, language) {
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":     "language_not_offered",
+			"message":   ErrLanguageNotOffered.Error(),
+			"languages": offered,
+		})
+		return
+	}
+	booking := Booking{
+		Tenant:     s.tenant(r.Context()).ID,
+		Kind:       KindTour,
+		OfferingID: req.TourID,
+		Date:       req.Date,
+		Slot:       req.Slot,
+		PartySize:  req.PartySize,
+		Language:   language,
+		GuestName:  req.GuestName,
+		GuestEmail: req.CustomerEmail,
+		GuestPhone: req.GuestPhone,
+
+		ReferralCode: strings.TrimSpace(req.Referral),
+	}
+	// Add-ons and promo codes are priced up front so the discount the
+	// guest was shown is the one they are charged.
+	if len(req.AddOns) > 0 || req.PromoCode != "" {
+		pb, ok := s.priceTourBooking(w, r, req.TourID, req.Date, req.Slot, req.PartySize, req.AddOns, req.PromoCode)
+		if !ok {
+			return
+		}
+		booking.PriceCents, booking.Currency = pb.TotalCents, pb.Currency
+		booking.PromoCode, booking.DiscountCents = pb.PromoCode, pb.DiscountCents
+		for _, a := range pb.AddOns {
+			booking.AddOns = append(booking.AddOns, AddOn{Code: a.Code, Name: a.Name, Quantity: a.Quantity})
+		}
+	}
+	b, err := s.store.AddBooking(booking, s.now())
+	if errors.Is(err, ErrNoGuideAvailable) {
+		respondError(w, http.StatusUnprocessableEntity, "language_unavailable", err.Error())
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	if b.fullyDiscounted() && s.cfg.AcceptZeroAmountBookings {
+		if b, err = s.confirmZeroAmount(r.Context(), b); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+	respondJSON(w, http.StatusCreated, b)
+}
+
+// putTourLanguagesHandler sets the languages a tour is offered in. Body:
+// {"languages": ["es", "en"]}; each must be a supported language.
+func (s *server) putTourLanguagesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Languages []string `json:"languages"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	languages, err := normalizeLanguages(req.Languages)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_language", err.Error())
+		return
+	}
+	for _, l := range languages {
+		if !containsLanguage(s.cfg.TourLanguages, l) {
+			respondError(w, http.StatusUnprocessableEntity, "unsupported_language", fmt.Sprintf("%s is not a supported tour language (%s)", l, strings.Join(s.cfg.TourLanguages, ", ")))
+			return
+		}
+	}
+	tourID := chi.URLParam(r, "tourId")
+	s.store.SetTourLanguages(tourID, languages)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tour_id":   tourID,
+		"languages": s.store.TourLanguages(tourID, s.cfg.TourLanguages),
+	})
+}
+
+// tourLanguagesHandler lists a tour's languages and, with ?date= (and
+// optionally &slot=), whether a guide can still lead each on that
+// departure.
+func (s *server) tourLanguagesHandler(w http.ResponseWriter, r *http.Request) {
+	tourID := chi.URLParam(r, "tourId")
+	offered := s.store.TourLanguages(tourID, s.cfg.TourLanguages)
+	resp := map[string]interface{}{"tour_id": tourID, "languages": offered}
+	if date := r.URL.Query().Get("date"); date != "" {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+			return
+		}
+		key := departureKey{tourID, date, r.URL.Query().Get("slot")}
+		resp["availability"] = s.store.DepartureLanguages(key, offered)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// putGuideHandler adds or replaces a guide. Body: {"name": "...",
+// "languages": ["es", "en"]}.
+func (s *server) putGuideHandler(w http.ResponseWriter, r *http.Request) {
+	var g Guide
+	if err := httpkit.DecodeJSON(r, &g); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	g.ID = chi.URLParam(r, "guideId")
+	languages, err := normalizeLanguages(g.Languages)
+	if err != nil || len(languages) == 0 {
+		respondError(w, http.StatusBadRequest, "invalid_language", "languages must list at least one two-letter ISO 639-1 code")
+		return
+	}
+	g.Languages = languages
+	s.store.PutGuide(g)
+	respondJSON(w, http.StatusOK, g)
+}
+
+func (s *server) listGuidesHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.store.Guides())
+}
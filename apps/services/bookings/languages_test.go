@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+func staffPut(t *testing.T, s *server, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(body)
+	req := httptest.NewRequest(http.MethodPut, path, &buf)
+	req.Header.Set("Authorization", "Bearer staff-key")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func bookTour(t *testing.T, s *server, language string, partySize int) (Booking, *httptest.ResponseRecorder) {
+	t.Helper()
+	var b Booking
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "slot": "08:00", "party_size": partySize,
+		"language": language, "guest_name": "Ana", "customer_email": "ana@example.com",
+	}, &b)
+	return b, rec
+}
+
+func TestTourBookingInOfferedLanguage(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	if rec := staffPut(t, s, "/api/bookings/tours/volcano-hike/languages", map[string][]string{"languages": {"es"}}); rec.Code != http.StatusOK {
+		t.Fatalf("set languages: status %d: %s", rec.Code, rec.Body)
+	}
+
+	b, rec := bookTour(t, s, "ES", 2)
+	if rec.Code != http.StatusCreated || b.Language != "es" || b.Status != StatusPending {
+		t.Fatalf("status %d booking %+v", rec.Code, b)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 2 {
+		t.Fatalf("booked = %d, want 2", d.Booked)
+	}
+
+	var got map[string]interface{}
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "slot": "08:00", "party_size": 2, "language": "en",
+	}, &got)
+	if rec.Code != http.StatusUnprocessableEntity || got["error"] != "language_not_offered" {
+		t.Fatalf("unoffered language: status %d: %s", rec.Code, rec.Body)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 2 {
+		t.Fatalf("rejected booking took seats: booked = %d", d.Booked)
+	}
+}
+
+func TestTourLanguagesMustBeSupported(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	if rec := staffPut(t, s, "/api/bookings/tours/volcano-hike/languages", map[string][]string{"languages": {"es", "fr"}}); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("unsupported language: status %d, want 422", rec.Code)
+	}
+}
+
+func TestLanguageSlotOnlyUsesCapableGuides(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	for id, langs := range map[string][]string{"g1-carlos": {"es"}, "g2-maria": {"es", "en"}} {
+		if rec := staffPut(t, s, "/api/bookings/guides/"+id, map[string]interface{}{"name": id, "languages": langs}); rec.Code != http.StatusOK {
+			t.Fatalf("put guide %s: status %d: %s", id, rec.Code, rec.Body)
+		}
+	}
+
+	// English goes to the only guide who speaks it, even though Carlos
+	// sorts first.
+	en, rec := bookTour(t, s, "en", 2)
+	if rec.Code != http.StatusCreated || en.GuideID != "g2-maria" {
+		t.Fatalf("english: status %d guide %q, want g2-maria", rec.Code, en.GuideID)
+	}
+	// A second English party joins Maria's group.
+	if b, _ := bookTour(t, s, "en", 1); b.GuideID != "g2-maria" {
+		t.Fatalf("second english party guide %q, want g2-maria", b.GuideID)
+	}
+	// Spanish goes to Carlos, since Maria is leading English.
+	if b, _ := bookTour(t, s, "es", 3); b.GuideID != "g1-carlos" {
+		t.Fatalf("spanish guide %q, want g1-carlos", b.GuideID)
+	}
+
+	var langs struct {
+		Availability []LanguageAvailability `json:"availability"`
+	}
+	doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours/sunset-kayak/languages?date=2026-03-14&slot=08:00", nil, &langs)
+	for _, a := range langs.Availability {
+		if a.Available {
+			t.Fatalf("both guides are out at 08:00 but %s is available", a.Language)
+		}
+	}
+	// With both guides out, another tour at the same time cannot run in
+	// English.
+	var got map[string]interface{}
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "sunset-kayak", "date": "2026-03-14", "slot": "08:00", "party_size": 2, "language": "en",
+	}, &got)
+	if rec.Code != http.StatusUnprocessableEntity || got["error"] != "language_unavailable" {
+		t.Fatalf("no free guide: status %d: %s", rec.Code, rec.Body)
+	}
+	if d := s.store.Departure("sunset-kayak", "2026-03-14", "08:00"); d.Booked != 0 {
+		t.Fatalf("rejected booking took seats: booked = %d", d.Booked)
+	}
+}
+
+func TestTourBookingRefusals(t *testing.T) {
+	// The test clock reads 03:00 on 2026-03-01 in El Salvador.
+	cases := []struct {
+		name     string
+		body     string
+		seatsSet int
+		status   int
+		code     string
+	}{
+		{"seats left", `{"tour_id":"volcano-hike","date":"2026-03-14","slot":"08:00","party_size":4}`, 8, http.StatusCreated, ""},
+		{"overbooked", `{"tour_id":"volcano-hike","date":"2026-03-14","slot":"08:00","party_size":5}`, 8, http.StatusConflict, "insufficient_capacity"},
+		{"past date", `{"tour_id":"volcano-hike","date":"2026-02-28","party_size":2}`, 0, http.StatusConflict, "departure_in_past"},
+		{"slot already left today", `{"tour_id":"volcano-hike","date":"2026-03-01","slot":"02:30","party_size":2}`, 0, http.StatusConflict, "departure_in_past"},
+		{"later slot today", `{"tour_id":"volcano-hike","date":"2026-03-01","slot":"08:00","party_size":2}`, 0, http.StatusCreated, ""},
+		{"today without slot", `{"tour_id":"volcano-hike","date":"2026-03-01","party_size":2}`, 0, http.StatusCreated, ""},
+		{"malformed JSON", `{"tour_id":"volcano-hike",`, 0, http.StatusBadRequest, httpkit.DecodeInvalidJSON},
+		{"unparseable slot", `{"tour_id":"volcano-hike","date":"2026-03-14","slot":"8am","party_size":2}`, 0, http.StatusBadRequest, "invalid_slot"},
+		{"slot out of range", `{"tour_id":"volcano-hike","date":"2026-03-14","slot":"25:00","party_size":2}`, 0, http.StatusBadRequest, "invalid_slot"},
+		{"old email field", `{"tour_id":"volcano-hike","date":"2026-03-14","party_size":2,"guest_email":"ana@example.com"}`, 0, http.StatusBadRequest, httpkit.DecodeUnknownField},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			if c.seatsSet > 0 {
+				if _, rec := bookTour(t, s, "es", c.seatsSet); rec.Code != http.StatusCreated {
+					t.Fatalf("seed: status %d: %s", rec.Code, rec.Body)
+				}
+			}
+			rec := httptest.NewRecorder()
+			s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/bookings/tours", bytes.NewBufferString(c.body)))
+			var got map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &got)
+			if rec.Code != c.status || (c.code != "" && got["error"] != c.code) {
+				t.Fatalf("status %d: %s; want %d %s", rec.Code, rec.Body, c.status, c.code)
+			}
+			if c.status == http.StatusCreated && got["booking_id"] == nil {
+				t.Fatalf("created booking has no id: %s", rec.Body)
+			}
+		})
+	}
+}
+
+// fullTours reports every departure of a tour as short of seats.
+type fullTours map[string]bool
+
+func (f fullTours) TourAvailable(tourID, _, _ string, _ int, _ time.Time) error {
+	if f[tourID] {
+		return ErrInsufficientCapacity
+	}
+	return nil
+}
+
+func TestTourBookingConsultsAvailabilityChecker(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.tourAvailability = fullTours{"volcano-hike": true}
+
+	var resp map[string]interface{}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", TourBooking{TourID: "volcano-hike", Date: "2026-03-14", Slot: "08:00", PartySize: 2}, &resp)
+	if rec.Code != http.StatusConflict || resp["error"] != "insufficient_capacity" {
+		t.Fatalf("status %d resp %v, want 409 insufficient_capacity", rec.Code, resp)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 0 {
+		t.Fatalf("booked = %d, want nothing reserved", d.Booked)
+	}
+	if rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours", TourBooking{TourID: "lake-kayak", Date: "2026-03-14", PartySize: 2, CustomerEmail: "ana@example.com"}, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("other tour: status %d: %s", rec.Code, rec.Body)
+	}
+}
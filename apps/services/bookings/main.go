@@ -10,33 +10,169 @@ Booking orchestration microservice handling:
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
 )
 
+// server wires configuration and state into the HTTP handlers.
+type server struct {
+	cfg         config
+	store       *Store
+	payments    PaymentsClient
+	pricing     PricingClient
+	prefs       *PreferenceStore
+	unsubscribe *unsubscribeSigner
+	notifier    *Notifier
+	pms         *PMSPusher
+	jobs        *JobQueue
+	shed        *httpkit.LoadShedder
+	now         func() time.Time
+
+	// availability coalesces identical rental availability lookups.
+	availability *availabilityCoalescer
+	// tourAvailability vets tour bookings before seats are reserved.
+	tourAvailability AvailabilityChecker
+
+	// popularity caches tour search rankings between refreshes.
+	popularity *popularityCache
+}
+
+func newServer(cfg config) *server {
+	var email EmailSender = logSender{}
+	if cfg.ResendAPIKey != "" {
+		email = newResendSender(cfg.ResendAPIKey, cfg.EmailFrom)
+	}
+	var sms SMSSender = logSender{}
+	if cfg.TwilioAccountSID != "" {
+		sms = newTwilioSender(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioFromNumber)
+	}
+	prefs := NewPreferenceStore()
+	unsubscribe := newUnsubscribeSigner(cfg.UnsubscribeSecret, cfg.AppURL)
+
+	var pms *PMSPusher
+	if cfg.PMSWebhookURL != "" {
+		format, ok := pmsFormats[cfg.PMSFormat]
+		if !ok {
+			log.Fatalf("unknown PMS_FORMAT %q", cfg.PMSFormat)
+		}
+		pms = NewPMSPusher(cfg.PMSWebhookURL, cfg.PMSWebhookToken, format, cfg.PMSMaxAttempts)
+	}
+
+	if cfg.Tenants.Len() == 0 {
+		cfg.Tenants = tenantkit.New(tenantkit.DefaultID, builtinTenant)
+	}
+	store := NewStore(cfg.DefaultTourCapacity)
+	store.LimitActiveBookings(cfg.MaxActiveBookingsPerGuest)
+	if cfg.DatabaseURL != "" {
+		pool, err := pgxpool.New(context.Background(), cfg.DatabaseURL)
+		if err != nil {
+			log.Fatalf("connect to DATABASE_URL: %v", err)
+		}
+		store.UseInventory(newPGSeatInventory(pool))
+	}
+
+	return &server{
+		cfg:         cfg,
+		store:       store,
+		payments:    newHTTPPaymentsClient(cfg.PaymentsServiceURL, cfg.PaymentsAPIKey),
+		pricing:     newHTTPPricingClient(cfg.PricingServiceURL),
+		prefs:       prefs,
+		unsubscribe: unsubscribe,
+		notifier:    NewNotifier(email, sms, prefs, unsubscribe),
+		pms:         pms,
+		jobs:        NewJobQueue(cfg.NotifyMaxAttempts, cfg.NotifyRetryBackoff),
+		shed:        httpkit.NewLoadShedder(cfg.LoadShedding),
+		now:         time.Now,
+
+		availability:     newAvailabilityCoalescer(store.RentalAvailability),
+		tourAvailability: store,
+
+		popularity: &popularityCache{},
+	}
+}
+
 func main() {
-	port := os.Getenv("BOOKINGS_SERVICE_PORT")
-	if port == "" {
-		port = "8002"
+	cfg := loadConfig()
+	if err := cfg.ConsultingHours.validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if err := cfg.Deposits.validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
 	}
+	if err := cfg.Rebooking.validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if _, err := normalizeLanguages(cfg.TourLanguages); err != nil || len(cfg.TourLanguages) == 0 {
+		log.Fatalf("invalid configuration: TOUR_LANGUAGES must list two-letter ISO 639-1 codes")
+	}
+	if cfg.PopularityWindow <= 0 {
+		log.Fatalf("invalid configuration: POPULARITY_WINDOW must be positive")
+	}
+	secret, err := resolveUnsubscribeSecret(cfg.UnsubscribeSecret, os.Getenv("NODE_ENV"))
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.UnsubscribeSecret = secret
+	holidays, err := loadHolidayCalendar(cfg.HolidayCalendarFile, os.Getenv("HOLIDAYS"))
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.Holidays = holidays
+	if cfg.Tenants, err = loadTenants(cfg.TenantsFile, cfg.DefaultTenant); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.ChannelExport, err = loadChannelSchema(envString("CHANNEL_EXPORT_SCHEMA", "generic_csv"),
+		os.Getenv("CHANNEL_EXPORT_COLUMNS"), os.Getenv("CHANNEL_EXPORT_DATE_FORMAT"), os.Getenv("CHANNEL_EXPORT_STATUSES"))
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	s := newServer(cfg)
 
+	go s.sweepBlockHolds(context.Background())
+	go s.sweepGuestData(context.Background())
+	if cfg.CapacityReconcileInterval > 0 {
+		go s.sweepCapacity(context.Background())
+	}
+	if cfg.NoShowSweepInterval > 0 {
+		go s.sweepNoShows(context.Background())
+	}
+	if cfg.PopularityRefreshInterval > 0 {
+		go s.sweepPopularity(context.Background())
+	}
+
+	log.Printf("🇸🇻 Bookings service starting on port %s", cfg.Port)
+	if err := httpkit.Run(s.routes(), cfg.Port, cfg.HTTPTimeouts); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Bookings service stopped")
+}
+
+func (s *server) routes() chi.Router {
 	r := chi.NewRouter()
 
+	r.Use(httpkit.RequestID(s.cfg.RequestIDHeader))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.RequestID)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{"http://localhost:3000", "http://localhost:8000"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type"},
+		AllowOriginFunc: s.cfg.Tenants.AllowOrigin,
+		AllowedMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:  []string{"Accept", "Authorization", "Content-Type", tenantkit.Header},
 	}))
+	if s.shed != nil {
+		r.Use(s.shed.Middleware)
+	}
+	httpkit.UseJSONErrors(r)
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		respondJSON(w, http.StatusOK, map[string]string{
@@ -44,57 +180,204 @@ func main() {
 			"service": "bookings",
 		})
 	})
+	r.Get("/ready", func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, map[string]string{
+			"status":  "ready",
+			"service": "bookings",
+		})
+	})
+	r.Get("/health/platform", s.platformHealthHandler)
 
 	r.Route("/api/bookings", func(r chi.Router) {
+		r.Use(s.cfg.Tenants.Middleware)
+		// Routes on one booking only see the tenant's own.
+		own := r.With(s.requireTenantBooking)
+		r.Get("/tenant", s.tenantHandler)
+
+		// Tour search, ranked by popularity
+		r.Get("/tours", s.searchToursHandler)
+		r.With(s.requireRole(roleStaff)).Put("/tours/{tourId}/rating", s.putTourRatingHandler)
+
 		// Tour bookings
-		r.Post("/tours", createTourBookingHandler)
-		r.Get("/tours/{bookingId}", getTourBookingHandler)
-		r.Put("/tours/{bookingId}/cancel", cancelTourBookingHandler)
+		r.Post("/tours", s.createTourBookingHandler)
+		own.Get("/tours/{bookingId}", s.getTourBookingHandler)
+		own.Put("/tours/{bookingId}/cancel", s.cancelTourBookingHandler)
+		own.Get("/tours/{bookingId}/payments", s.getPaymentSummaryHandler)
+		own.Post("/tours/{bookingId}/transfer", s.transferBookingHandler(KindTour))
+
+		// Departure manifest for guides
+		r.With(s.requireRole(roleStaff, roleGuide)).Get("/tours/{tourId}/manifest", s.getManifestHandler)
+
+		// Operator cancellation of a whole departure
+		r.With(s.requireRole(roleStaff)).Post("/tours/{tourId}/cancel-departure", s.cancelDepartureHandler)
+
+		// Recount a tour's seats from its bookings and holds
+		r.With(s.requireRole(roleStaff)).Post("/tours/{tourId}/reconcile-capacity", s.reconcileCapacityHandler)
+
+		// Close out departures: mark guests who never checked in no-show
+		r.With(s.requireRole(roleStaff)).Post("/tours/no-shows", s.processNoShowsHandler)
+		r.With(s.requireRole(roleStaff)).Get("/tours/{tourId}/no-shows", s.noShowStatsHandler)
+
+		// What-if simulation of operational changes
+		r.Post("/tours/{tourId}/simulate", s.simulateChangeHandler)
+
+		// Tour languages and the guides who lead them
+		r.Get("/tours/{tourId}/languages", s.tourLanguagesHandler)
+		r.With(s.requireRole(roleStaff)).Put("/tours/{tourId}/languages", s.putTourLanguagesHandler)
+		r.With(s.requireRole(roleStaff)).Get("/guides", s.listGuidesHandler)
+		r.With(s.requireRole(roleStaff)).Put("/guides/{guideId}", s.putGuideHandler)
+
+		// Recurring schedules
+		r.With(s.requireRole(roleStaff)).Put("/tours/{tourId}/schedule", s.putScheduleTemplateHandler)
+		r.With(s.requireRole(roleStaff)).Post("/tours/{tourId}/schedule/materialize", s.materializeScheduleHandler)
+
+		// Month calendar of departures with seats left and prices
+		r.Get("/tours/{tourId}/calendar", s.tourCalendarHandler)
+
+		// Agency seat blocks
+		agency := r.With(s.requireRole(roleAgency, roleStaff))
+		agency.Post("/tours/{tourId}/block-hold", s.createBlockHoldHandler)
+		agency.Post("/tours/{tourId}/block-hold/{holdId}/release", s.releaseBlockHoldHandler)
+		agency.Post("/tours/{tourId}/block-hold/{holdId}/convert", s.convertBlockHoldHandler)
+
+		// Waitlist for sold-out departures
+		r.Post("/tours/{tourId}/waitlist", s.joinWaitlistHandler)
+		r.With(s.requireRole(roleStaff)).Post("/waitlist/{entryId}/promote", s.promoteWaitlistHandler)
+		r.Post("/waitlist/{entryId}/accept", s.acceptWaitlistOfferHandler)
+		r.With(s.requireRole(roleStaff)).Post("/tours/{tourId}/waitlist/offer", s.offerWaitlistHandler)
 
 		// Rental bookings
-		r.Post("/rentals", createRentalBookingHandler)
-		r.Get("/rentals/{bookingId}", getRentalBookingHandler)
+		r.Post("/rentals", s.createRentalBookingHandler)
+		own.Get("/rentals/{bookingId}", s.getRentalBookingHandler)
+		own.Post("/rentals/{bookingId}/transfer", s.transferBookingHandler(KindRental))
+		r.Get("/rentals/availability", s.bulkRentalAvailabilityHandler)
+		r.Get("/rentals/{propertyId}/availability", s.rentalAvailabilityHandler)
+		r.With(s.requireRole(roleStaff)).Post("/rentals/{propertyId}/block", s.blockPropertyHandler)
+		r.With(s.requireRole(roleStaff)).Delete("/rentals/{propertyId}/block/{blockId}", s.unblockPropertyHandler)
+		r.With(s.requireRole(roleStaff)).Get("/rentals/{propertyId}/export", s.exportRentalBookingsHandler)
 
 		// Consulting sessions
-		r.Post("/consulting", createConsultingBookingHandler)
-	})
+		r.Post("/consulting", s.createConsultingBookingHandler)
+		own.Post("/consulting/{bookingId}/transfer", s.transferBookingHandler(KindConsulting))
+		r.Get("/consulting/{consultantId}/slots", s.consultingSlotsHandler)
+		r.With(s.requireRole(roleStaff)).Post("/consulting/{consultantId}/block", s.blockConsultantTimeHandler)
+		r.Get("/consulting/{consultantId}/blocks", s.listConsultantBlocksHandler)
+		r.With(s.requireRole(roleStaff)).Delete("/consulting/{consultantId}/block/{blockId}", s.unblockConsultantTimeHandler)
 
-	log.Printf("🇸🇻 Bookings service starting on port %s", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), r); err != nil {
-		log.Fatal(err)
-	}
-}
+		// QR check-in
+		r.Get("/check-in/{token}", s.checkInHandler)
+		r.With(s.requireRole(roleStaff, roleGuide)).Post("/check-in/{token}", s.admitGuestHandler)
 
-func createTourBookingHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Validate availability, create booking, trigger payment
-	respondJSON(w, http.StatusCreated, map[string]string{"status": "tour_booking_created"})
-}
+		// Checkout, payment outcome and staff review
+		own.Post("/{bookingId}/checkout", s.createCheckoutHandler)
+		own.Get("/{bookingId}/checkout/preview", s.checkoutPreviewHandler)
+		// Payment outcomes are reported by the payments service alone.
+		service := own.With(s.requireRole(roleService))
+		service.Post("/{bookingId}/payment", s.recordPaymentHandler)
+		service.Post("/{bookingId}/refund", s.recordRefundHandler)
+		service.Post("/{bookingId}/dispute", s.recordDisputeHandler)
+		service.Post("/{bookingId}/payment-failure", s.recordPaymentFailureHandler)
+		own.With(s.requireRole(roleStaff)).Post("/{bookingId}/approve", s.approveBookingHandler)
+		own.With(s.requireRole(roleStaff)).Post("/{bookingId}/reject", s.rejectBookingHandler)
+
+		// Per-offering booking questions and guest answers
+		r.With(s.requireRole(roleStaff)).Put("/offerings/{offeringId}/questions", s.putQuestionsHandler)
+		r.Get("/offerings/{offeringId}/questions", s.getQuestionsHandler)
+		own.Put("/{bookingId}/answers", s.putAnswersHandler)
+
+		// Add-ons, promo codes and quotes
+		r.With(s.requireRole(roleStaff)).Put("/offerings/{offeringId}/add-ons", s.putAddOnsHandler)
+		r.Get("/offerings/{offeringId}/add-ons", s.getAddOnsHandler)
+		r.With(s.requireRole(roleStaff)).Put("/promo-codes/{code}", s.putPromoCodeHandler)
+		r.Post("/tours/{tourId}/quote", s.quoteTourHandler)
 
-func getTourBookingHandler(w http.ResponseWriter, r *http.Request) {
-	bookingID := chi.URLParam(r, "bookingId")
-	respondJSON(w, http.StatusOK, map[string]string{"booking_id": bookingID, "status": "confirmed"})
+		// Guest contact preferences
+		r.Put("/guests/{email}/preferences", s.putPreferencesHandler)
+		r.Post("/unsubscribe", s.unsubscribeHandler)
+	})
+
+	return r
 }
 
-func cancelTourBookingHandler(w http.ResponseWriter, r *http.Request) {
-	bookingID := chi.URLParam(r, "bookingId")
-	respondJSON(w, http.StatusOK, map[string]string{"booking_id": bookingID, "status": "cancelled"})
+func (s *server) getTourBookingHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store.Booking(chi.URLParam(r, "bookingId"))
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, b)
 }
 
-func createRentalBookingHandler(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusCreated, map[string]string{"status": "rental_booking_created"})
+// cancelTourBookingHandler cancels a booking at the guest's request and
+// refunds whatever its rate plan, or the cooling-off right, allows. The
+// freed seats are offered to the departure's waitlist.
+func (s *server) cancelTourBookingHandler(w http.ResponseWriter, r *http.Request) {
+	now := s.now()
+	b, err := s.store.CancelBooking(chi.URLParam(r, "bookingId"), now)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+
+	decision := computeRefund(b, now, s.cfg.CoolingOffWindow)
+	status := "none"
+	if decision.AmountCents > 0 {
+		status = s.refund(r.Context(), RefundRequest{
+			PaymentRef:  b.PaymentRef,
+			BookingID:   b.ID,
+			AmountCents: decision.AmountCents,
+			Currency:    b.Currency,
+			Reason:      "guest_cancelled_" + decision.Rule,
+			GuestEmail:  b.GuestEmail,
+		})
+	}
+	var suggestions []RebookSuggestion
+	if b.Kind == KindTour {
+		suggestions = s.rebookSuggestions(r.Context(), b)
+	}
+	s.sendNotification(r.Context(), Notification{Template: TemplateBookingCancelled, Booking: b, RefundCents: decision.AmountCents, Suggestions: suggestions})
+	resp := map[string]interface{}{"booking": b, "refund": decision, "refund_status": status}
+	if b.Kind == KindTour {
+		resp["rebook_suggestions"] = suggestions
+		resp["waitlist_offers"] = s.offerFreedSeats(r.Context(), b.OfferingID, b.Date, b.Slot)
+	}
+	respondJSON(w, http.StatusOK, resp)
 }
 
-func getRentalBookingHandler(w http.ResponseWriter, r *http.Request) {
-	bookingID := chi.URLParam(r, "bookingId")
-	respondJSON(w, http.StatusOK, map[string]string{"booking_id": bookingID, "status": "confirmed"})
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	httpkit.RespondJSON(w, status, data)
 }
 
-func createConsultingBookingHandler(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusCreated, map[string]string{"status": "consulting_booked"})
+// respondError writes the standard error envelope.
+func respondError(w http.ResponseWriter, status int, code, message string) {
+	httpkit.RespondError(w, status, code, message)
 }
 
-func respondJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+// respondStoreError maps store sentinel errors onto HTTP responses.
+func respondStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		respondError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, ErrInsufficientCapacity):
+		respondError(w, http.StatusConflict, "insufficient_capacity", err.Error())
+	case errors.Is(err, ErrDeparted):
+		respondError(w, http.StatusConflict, "departure_in_past", err.Error())
+	case errors.Is(err, ErrBookingLimitReached):
+		respondError(w, http.StatusTooManyRequests, "booking_limit_reached", err.Error())
+	case errors.Is(err, ErrGuestBlocked):
+		respondError(w, http.StatusForbidden, "guest_blocked", err.Error())
+	case errors.Is(err, ErrHoldExpired):
+		respondError(w, http.StatusGone, "hold_expired", err.Error())
+	case errors.Is(err, ErrOfferExpired):
+		respondError(w, http.StatusGone, "offer_expired", err.Error())
+	case errors.Is(err, ErrHoldInactive), errors.Is(err, ErrInvalidTransition):
+		respondError(w, http.StatusConflict, "invalid_state", err.Error())
+	case errors.Is(err, ErrPaymentRecorded):
+		respondError(w, http.StatusConflict, "payment_already_recorded", err.Error())
+	case errors.Is(err, ErrUnderpaid):
+		respondError(w, http.StatusUnprocessableEntity, "underpaid", err.Error())
+	default:
+		log.Printf("unexpected store error: %v", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	}
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a controllable clock for handler tests.
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// testServiceKey is the payments service's credential in tests,
+// testAgencyKey a travel agency's and testStaffKey staff's.
+const (
+	testServiceKey = "service-key"
+	testAgencyKey  = "agency-key"
+	testStaffKey   = "staff-key"
+)
+
+func newTestServer(t *testing.T) (*server, *testClock) {
+	t.Helper()
+	clock := &testClock{t: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	s := newServer(config{DefaultTourCapacity: 12, BlockHoldTTL: time.Hour, HoldSweepInterval: time.Minute})
+	s.now = clock.now
+	s.payments = &fakePayments{}
+	s.pricing = &fakePricing{price: Price{AmountCents: 4500, Currency: "USD"}}
+	s.cfg.WaitlistPriceLockTTL = 48 * time.Hour
+	s.cfg.ConsultingHours = ConsultingHours{DayStart: "09:00", DayEnd: "17:00", Session: time.Hour}
+	s.cfg.TourLanguages = []string{"es", "en"}
+	s.cfg.ServiceAPIKey = testServiceKey
+	s.cfg.AgencyAPIKey = testAgencyKey
+	s.cfg.StaffAPIKey = testStaffKey
+	ob := &outbox{}
+	s.notifier = NewNotifier(ob, ob, s.prefs, s.unsubscribe)
+	return s, clock
+}
+
+// doJSON sends body (marshalled as JSON unless nil) and decodes the response
+// into out when out is non-nil.
+func doJSON(t *testing.T, h http.Handler, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONAs(t, "", h, method, path, body, out)
+}
+
+// doService is doJSON with the payments service's credentials.
+func doService(t *testing.T, h http.Handler, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONAs(t, testServiceKey, h, method, path, body, out)
+}
+
+// doAgency is doJSON with a travel agency's credentials.
+func doAgency(t *testing.T, h http.Handler, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONAs(t, testAgencyKey, h, method, path, body, out)
+}
+
+// doStaff is doJSON with staff credentials.
+func doStaff(t *testing.T, h http.Handler, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONAs(t, testStaffKey, h, method, path, body, out)
+}
+
+// doJSONAs is doJSON sending token as a bearer token, unless it is empty.
+func doJSONAs(t *testing.T, token string, h http.Handler, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+// fakePayments records calls made to the payments service.
+type fakePayments struct {
+	refunds   []RefundRequest
+	checkouts []CheckoutRequest
+	err       error
+}
+
+func (f *fakePayments) Refund(_ context.Context, req RefundRequest) error {
+	f.refunds = append(f.refunds, req)
+	return f.err
+}
+
+func (f *fakePayments) CreateCheckout(_ context.Context, req CheckoutRequest) (CheckoutSession, error) {
+	f.checkouts = append(f.checkouts, req)
+	if f.err != nil {
+		return CheckoutSession{}, f.err
+	}
+	return CheckoutSession{ID: "cs_" + req.BookingID, URL: "https://checkout.test/cs_" + req.BookingID}, nil
+}
+
+// fakePricing quotes a fixed price per seat, or the tour's own from
+// seatCents when listed.
+type fakePricing struct {
+	price     Price
+	seatCents map[string]int64
+	// dateCents overrides the seat price on particular dates.
+	dateCents map[string]int64
+	err       error
+}
+
+func (f *fakePricing) TourPrice(_ context.Context, tourID, date, _ string, partySize int) (Price, error) {
+	seat := f.price.AmountCents
+	if c, ok := f.seatCents[tourID]; ok {
+		seat = c
+	}
+	if c, ok := f.dateCents[date]; ok {
+		seat = c
+	}
+	return Price{AmountCents: seat * int64(partySize), Currency: f.price.Currency}, f.err
+}
+
+// outbox captures messages instead of delivering them. Setting smsErr makes
+// every SMS fail; each email fails with the next of emailErrs until they run
+// out.
+type outbox struct {
+	mu        sync.Mutex
+	emails    []sentMessage
+	sms       []sentMessage
+	smsErr    error
+	emailErrs []error
+}
+
+// sentMessages returns the test server's outbox.
+func sentMessages(s *server) *outbox {
+	return s.notifier.email.(*outbox)
+}
+
+type sentMessage struct {
+	To, Subject, Body string
+}
+
+func (o *outbox) SendEmail(_ context.Context, to, subject, body string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.emailErrs) > 0 {
+		err := o.emailErrs[0]
+		o.emailErrs = o.emailErrs[1:]
+		return err
+	}
+	o.emails = append(o.emails, sentMessage{to, subject, body})
+	return nil
+}
+
+func (o *outbox) SendSMS(_ context.Context, to, body string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.smsErr != nil {
+		return o.smsErr
+	}
+	o.sms = append(o.sms, sentMessage{To: to, Body: body})
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// ManifestEntry is one booking as a guide sees it on the day.
+type ManifestEntry struct {
+	BookingID       string          `json:"booking_id"`
+	GuestName       string          `json:"guest_name"`
+	GuestPhone      string          `json:"guest_phone,omitempty"`
+	PartySize       int             `json:"party_size"`
+	Status          BookingStatus   `json:"status"`
+	AddOns          []AddOn         `json:"add_ons"`
+	SpecialRequests string          `json:"special_requests,omitempty"`
+	Answers         []BookingAnswer `json:"answers"`
+	AgencyID        string          `json:"agency_id,omitempty"`
+}
+
+// Manifest lists who is expected on a departure. Guests holds confirmed and
+// checked-in bookings; no-shows and cancellations are kept apart so a guide
+// never counts them by mistake.
+type Manifest struct {
+	TourID      string            `json:"tour_id"`
+	Date        string            `json:"date"`
+	Slot        string            `json:"slot,omitempty"`
+	Capacity    int               `json:"capacity"`
+	Headcount   int               `json:"headcount"`
+	Guests      []ManifestEntry   `json:"guests"`
+	NoShows     []ManifestEntry   `json:"no_shows"`
+	Cancelled   []ManifestEntry   `json:"cancelled"`
+	GeneratedAt apitypes.JSONTime `json:"generated_at"`
+}
+
+// Manifest builds the guest manifest for one tour departure. Bookings that
+// never confirmed are left off entirely.
+func (s *Store) Manifest(tourID, date, slot string, now time.Time) Manifest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := departureKey{tourID, date, slot}
+	m := Manifest{
+		TourID:      tourID,
+		Date:        date,
+		Slot:        slot,
+		Capacity:    s.departureLocked(key).Capacity,
+		Guests:      []ManifestEntry{},
+		NoShows:     []ManifestEntry{},
+		Cancelled:   []ManifestEntry{},
+		GeneratedAt: apitypes.JSONTime{Time: now},
+	}
+	questions := s.questionsLocked(tourID)
+	for _, b := range s.bookings {
+		if b.Kind != KindTour || (departureKey{b.OfferingID, b.Date, b.Slot}) != key {
+			continue
+		}
+		e := ManifestEntry{
+			BookingID:       b.ID,
+			GuestName:       b.GuestName,
+			GuestPhone:      b.GuestPhone,
+			PartySize:       b.PartySize,
+			Status:          b.Status,
+			AddOns:          append([]AddOn{}, b.AddOns...),
+			SpecialRequests: b.SpecialRequests,
+			Answers:         questions.formatAnswers(b.Answers),
+			AgencyID:        b.AgencyID,
+		}
+		switch b.Status {
+		case StatusConfirmed, StatusCheckedIn:
+			m.Guests = append(m.Guests, e)
+			m.Headcount += b.PartySize
+		case StatusNoShow:
+			m.NoShows = append(m.NoShows, e)
+		case StatusCancelled:
+			m.Cancelled = append(m.Cancelled, e)
+		}
+	}
+	for _, list := range [][]ManifestEntry{m.Guests, m.NoShows, m.Cancelled} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].GuestName != list[j].GuestName {
+				return list[i].GuestName < list[j].GuestName
+			}
+			return list[i].BookingID < list[j].BookingID
+		})
+	}
+	return m
+}
+
+// Manifest representations, in order of preference.
+const (
+	mediaJSON = "application/json"
+	mediaCSV  = "text/csv"
+	mediaPDF  = "application/pdf"
+)
+
+// getManifestHandler returns a departure's manifest as JSON, CSV or PDF,
+// chosen by the Accept header.
+func (s *server) getManifestHandler(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+		return
+	}
+	media := negotiate(r.Header.Get("Accept"), mediaJSON, mediaCSV, mediaPDF)
+	if media == "" {
+		respondError(w, http.StatusNotAcceptable, "not_acceptable", "manifest is available as application/json, text/csv or application/pdf")
+		return
+	}
+
+	m := s.store.Manifest(chi.URLParam(r, "tourId"), date, r.URL.Query().Get("slot"), s.now())
+	w.Header().Set("Vary", "Accept")
+	switch media {
+	case mediaCSV:
+		writeAttachment(w, mediaCSV+"; charset=utf-8", m.filename("csv"), m.csv())
+	case mediaPDF:
+		writeAttachment(w, mediaPDF, m.filename("pdf"), m.pdf())
+	default:
+		respondJSON(w, http.StatusOK, m)
+	}
+}
+
+func writeAttachment(w http.ResponseWriter, contentType, filename string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (m Manifest) filename(ext string) string {
+	name := "manifest-" + m.TourID + "-" + m.Date
+	if m.Slot != "" {
+		name += "-" + strings.ReplaceAll(m.Slot, ":", "")
+	}
+	return name + "." + ext
+}
+
+// manifestSection is one part of a manifest as laid out in CSV and PDF.
+type manifestSection struct {
+	label   string
+	heading string
+	entries []ManifestEntry
+}
+
+func (m Manifest) sections() []manifestSection {
+	return []manifestSection{
+		{"guests", "GUESTS", m.Guests},
+		{"no_shows", "NO-SHOWS", m.NoShows},
+		{"cancelled", "CANCELLED", m.Cancelled},
+	}
+}
+
+func (m Manifest) csv() []byte {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write([]string{"section", "booking_id", "guest_name", "guest_phone", "party_size", "status", "add_ons", "special_requests", "agency_id", "answers"})
+	for _, sec := range m.sections() {
+		for _, e := range sec.entries {
+			cw.Write([]string{sec.label, e.BookingID, e.GuestName, e.GuestPhone, strconv.Itoa(e.PartySize),
+				string(e.Status), formatAddOns(e.AddOns), e.SpecialRequests, e.AgencyID, formatAnswers(e.Answers)})
+		}
+	}
+	cw.Flush()
+	return buf.Bytes()
+}
+
+func (m Manifest) pdf() []byte {
+	title := "Manifest: " + m.TourID + " " + m.Date
+	if m.Slot != "" {
+		title += " " + m.Slot
+	}
+	lines := []string{
+		fmt.Sprintf("Headcount %d of %d seats", m.Headcount, m.Capacity),
+		"Generated " + m.GeneratedAt.UTC().Format(time.RFC3339),
+	}
+	for _, sec := range m.sections() {
+		lines = append(lines, "", fmt.Sprintf("%s (%d)", sec.heading, len(sec.entries)))
+		if len(sec.entries) == 0 {
+			lines = append(lines, "    none")
+		}
+		for _, e := range sec.entries {
+			box := "[ ]"
+			if e.Status == StatusCheckedIn {
+				box = "[x]"
+			}
+			lines = append(lines, fmt.Sprintf("%s %s  party of %d  %s", box, e.GuestName, e.PartySize, e.GuestPhone))
+			if len(e.AddOns) > 0 {
+				lines = append(lines, "      Add-ons: "+formatAddOns(e.AddOns))
+			}
+			if e.SpecialRequests != "" {
+				lines = append(lines, "      Notes: "+e.SpecialRequests)
+			}
+			for _, a := range e.Answers {
+				lines = append(lines, "      "+a.Question+": "+a.Answer)
+			}
+		}
+	}
+	return textPDF(title, lines)
+}
+
+// formatAddOns renders add-ons as "2x Lunch; 1x Snorkel gear".
+func formatAddOns(addOns []AddOn) string {
+	parts := make([]string, len(addOns))
+	for i, a := range addOns {
+		parts[i] = fmt.Sprintf("%dx %s", a.Quantity, a.Name)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatAnswers renders answers as "Dietary needs: vegan; Arrival flight: AV 123".
+func formatAnswers(answers []BookingAnswer) string {
+	parts := make([]string, len(answers))
+	for i, a := range answers {
+		parts[i] = a.Question + ": " + a.Answer
+	}
+	return strings.Join(parts, "; ")
+}
+
+// negotiate picks the first of offers acceptable under an Accept header,
+// honouring q-values and wildcards. An empty header accepts offers[0]; no
+// acceptable offer yields "".
+func negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mr := mediaRange{typ: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		if mr.q > 0 {
+			ranges = append(ranges, mr)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, mr := range ranges {
+		for _, offer := range offers {
+			major, _, _ := strings.Cut(offer, "/")
+			if mr.typ == offer || mr.typ == "*/*" || mr.typ == major+"/*" {
+				return offer
+			}
+		}
+	}
+	return ""
+}
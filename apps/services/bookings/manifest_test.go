@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testGuideKey = "guide-key"
+
+// seedManifestBooking adds a tour booking and moves it to status.
+func seedManifestBooking(t *testing.T, s *server, name, date string, party int, status BookingStatus) Booking {
+	t.Helper()
+	b, err := s.store.AddBooking(Booking{
+		Kind: KindTour, OfferingID: "volcano-hike", Date: date, Slot: "06:00",
+		PartySize: party, GuestName: name, GuestPhone: "+50370000000",
+	}, s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.Status = status
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func getManifest(t *testing.T, s *server, accept, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/bookings/tours/volcano-hike/manifest?date=2026-03-14&slot=06:00", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func newManifestTestServer(t *testing.T) *server {
+	t.Helper()
+	s, _ := newTestServer(t)
+	s.cfg.GuideAPIKey = testGuideKey
+	confirmed := seedManifestBooking(t, s, "Ana", "2026-03-14", 2, StatusConfirmed)
+	s.store.UpdateBooking(confirmed.ID, s.now(), func(b *Booking) error {
+		b.AddOns = []AddOn{{Code: "lunch", Name: "Lunch", Quantity: 2}}
+		b.SpecialRequests = "vegetarian"
+		return nil
+	})
+	seedManifestBooking(t, s, "Beto", "2026-03-14", 3, StatusCheckedIn)
+	seedManifestBooking(t, s, "Carla", "2026-03-14", 1, StatusCancelled)
+	seedManifestBooking(t, s, "Diego", "2026-03-14", 4, StatusNoShow)
+	seedManifestBooking(t, s, "Elena", "2026-03-14", 2, StatusPending)
+	seedManifestBooking(t, s, "Fabio", "2026-03-15", 2, StatusConfirmed)
+	return s
+}
+
+func TestManifestListsOnlyExpectedGuestsForDeparture(t *testing.T) {
+	s := newManifestTestServer(t)
+
+	rec := getManifest(t, s, "", testGuideKey)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var m Manifest
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Guests) != 2 || m.Guests[0].GuestName != "Ana" || m.Guests[1].GuestName != "Beto" {
+		t.Fatalf("guests = %+v, want Ana and Beto", m.Guests)
+	}
+	if m.Headcount != 5 {
+		t.Fatalf("headcount = %d, want 5", m.Headcount)
+	}
+	if got := m.Guests[0]; len(got.AddOns) != 1 || got.AddOns[0].Quantity != 2 || got.SpecialRequests != "vegetarian" {
+		t.Fatalf("Ana's entry = %+v", got)
+	}
+	if len(m.NoShows) != 1 || m.NoShows[0].GuestName != "Diego" {
+		t.Fatalf("no-shows = %+v, want Diego", m.NoShows)
+	}
+	if len(m.Cancelled) != 1 || m.Cancelled[0].GuestName != "Carla" {
+		t.Fatalf("cancelled = %+v, want Carla", m.Cancelled)
+	}
+}
+
+func TestManifestCSV(t *testing.T) {
+	s := newManifestTestServer(t)
+
+	rec := getManifest(t, s, "text/csv", testGuideKey)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header plus Ana, Beto, Diego and Carla.
+	if len(rows) != 5 {
+		t.Fatalf("rows = %v", rows)
+	}
+	if rows[1][0] != "guests" || rows[1][2] != "Ana" || rows[1][6] != "2x Lunch" {
+		t.Fatalf("first guest row = %v", rows[1])
+	}
+	if rows[3][0] != "no_shows" || rows[4][0] != "cancelled" {
+		t.Fatalf("section order = %v, %v", rows[3][0], rows[4][0])
+	}
+}
+
+func TestManifestPDF(t *testing.T) {
+	s := newManifestTestServer(t)
+
+	rec := getManifest(t, s, "application/pdf", testGuideKey)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.Bytes()
+	if !bytes.HasPrefix(body, []byte("%PDF-")) || !bytes.Contains(body, []byte("[ ] Ana  party of 2")) || !bytes.Contains(body, []byte("[x] Beto")) {
+		t.Fatalf("not a manifest PDF: %q", body)
+	}
+	if bytes.Contains(body, []byte("Fabio")) || bytes.Contains(body, []byte("Elena")) {
+		t.Fatal("PDF lists guests not expected on the departure")
+	}
+}
+
+func TestManifestNegotiation(t *testing.T) {
+	s := newManifestTestServer(t)
+
+	if rec := getManifest(t, s, "image/png", testGuideKey); rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("image/png: status %d, want 406", rec.Code)
+	}
+	rec := getManifest(t, s, "application/json;q=0.5, text/csv", testGuideKey)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Fatalf("preferred csv: content type %q", ct)
+	}
+}
+
+func TestManifestRequiresStaffOrGuide(t *testing.T) {
+	s := newManifestTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+
+	for _, token := range []string{"", "wrong"} {
+		if rec := getManifest(t, s, "", token); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("token %q: status %d, want 401", token, rec.Code)
+		}
+	}
+	if rec := getManifest(t, s, "", "staff-key"); rec.Code != http.StatusOK {
+		t.Fatalf("staff key: status %d", rec.Code)
+	}
+}
+
+func TestAdmitGuestChecksIn(t *testing.T) {
+	s := newManifestTestServer(t)
+	b := seedConfirmedTour(t, s)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/bookings/check-in/"+b.CheckInToken, nil)
+	req.Header.Set("Authorization", "Bearer "+testGuideKey)
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got, _ := s.store.Booking(b.ID); got.Status != StatusCheckedIn {
+		t.Fatalf("status = %s, want checked_in", got.Status)
+	}
+
+	rec = httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("second check-in: status %d, want 409", rec.Code)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// NoShowOutcome records how a booking was closed out as a no-show: when,
+// and what the no-show policy refunded.
+type NoShowOutcome struct {
+	MarkedAt     apitypes.JSONTime `json:"marked_at"`
+	Rate         apitypes.Percent  `json:"refund_rate"`
+	RefundCents  int64             `json:"refund_cents"`
+	RefundStatus string            `json:"refund_status"`
+}
+
+// MarkNoShows moves confirmed tour bookings whose departure started more
+// than after ago to StatusNoShow, deciding a refund of rate of what they
+// paid. Checked-in, cancelled and unpaid bookings are left alone. The
+// party keeps its seats, as it held them for the departure.
+func (s *Store) MarkNoShows(after time.Duration, rate apitypes.Percent, now time.Time) []Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var marked []Booking
+	for _, b := range s.bookings {
+		if b.Kind != KindTour || b.Status != StatusConfirmed {
+			continue
+		}
+		start, err := b.startsAt()
+		if err != nil || now.Before(start.Add(after)) {
+			continue
+		}
+		outcome := NoShowOutcome{MarkedAt: apitypes.JSONTime{Time: now}, Rate: rate, RefundStatus: "none"}
+		if b.PaymentRef != "" {
+			outcome.RefundCents = rate.Of(b.AmountCents - b.refundedCents())
+		}
+		b.Status, b.NoShow = StatusNoShow, &outcome
+		b.UpdatedAt = apitypes.JSONTime{Time: now}
+		marked = append(marked, *b)
+	}
+	return marked
+}
+
+// NoShowStats is a tour's attendance record over the departures processed
+// so far. Rate is the share of guests who never arrived, which the
+// overbooking model uses to decide how far past capacity a departure can
+// sell.
+type NoShowStats struct {
+	TourID         string           `json:"tour_id"`
+	AttendedGuests int              `json:"attended_guests"`
+	NoShowGuests   int              `json:"no_show_guests"`
+	NoShowBookings int              `json:"no_show_bookings"`
+	Rate           apitypes.Percent `json:"no_show_rate"`
+	Departures     int              `json:"departures"`
+}
+
+// NoShowStats counts checked-in and no-show guests on tourID's departures.
+func (s *Store) NoShowStats(tourID string) NoShowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := NoShowStats{TourID: tourID}
+	departures := make(map[departureKey]bool)
+	for _, b := range s.bookings {
+		if b.Kind != KindTour || b.OfferingID != tourID {
+			continue
+		}
+		switch b.Status {
+		case StatusCheckedIn:
+			st.AttendedGuests += b.PartySize
+		case StatusNoShow:
+			st.NoShowGuests += b.PartySize
+			st.NoShowBookings++
+		default:
+			continue
+		}
+		departures[departureKey{b.OfferingID, b.Date, b.Slot}] = true
+	}
+	st.Departures = len(departures)
+	if total := st.AttendedGuests + st.NoShowGuests; total > 0 {
+		st.Rate = apitypes.Percent(int64(st.NoShowGuests) * int64(apitypes.HundredPercent) / int64(total))
+	}
+	return st
+}
+
+// noShowResult is what processing did for one booking.
+type noShowResult struct {
+	BookingID    string `json:"booking_id"`
+	TourID       string `json:"tour_id"`
+	Date         string `json:"date"`
+	Slot         string `json:"slot,omitempty"`
+	RefundCents  int64  `json:"refund_cents"`
+	RefundStatus string `json:"refund_status"`
+}
+
+// processNoShows marks the bookings NoShowCutoff past their departure as
+// no-shows, refunds what the no-show policy allows and records the outcome
+// on each booking.
+func (s *server) processNoShows(ctx context.Context) []noShowResult {
+	results := []noShowResult{}
+	for _, b := range s.store.MarkNoShows(s.cfg.NoShowCutoff, s.cfg.NoShowRefundRate, s.now()) {
+		res := noShowResult{BookingID: b.ID, TourID: b.OfferingID, Date: b.Date, Slot: b.Slot, RefundCents: b.NoShow.RefundCents, RefundStatus: "none"}
+		if res.RefundCents > 0 {
+			res.RefundStatus = s.refund(ctx, RefundRequest{
+				PaymentRef:  b.PaymentRef,
+				BookingID:   b.ID,
+				AmountCents: res.RefundCents,
+				Currency:    b.Currency,
+				Reason:      "no_show",
+				GuestEmail:  b.GuestEmail,
+			})
+			_, err := s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+				outcome := *b.NoShow
+				outcome.RefundStatus = res.RefundStatus
+				b.NoShow = &outcome
+				return nil
+			})
+			if err != nil {
+				log.Printf("recording no-show refund status for booking %s: %v", b.ID, err)
+			}
+		}
+		results = append(results, res)
+	}
+	if len(results) > 0 {
+		log.Printf("marked %d bookings no-show", len(results))
+	}
+	return results
+}
+
+// sweepNoShows processes no-shows periodically until ctx is done.
+func (s *server) sweepNoShows(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.NoShowSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.processNoShows(ctx)
+		}
+	}
+}
+
+// processNoShowsHandler runs no-show processing on demand, as the sweep
+// would.
+func (s *server) processNoShowsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"no_shows": s.processNoShows(r.Context())})
+}
+
+func (s *server) noShowStatsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.store.NoShowStats(chi.URLParam(r, "tourId")))
+}
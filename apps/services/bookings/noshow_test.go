@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func TestNoShowProcessingMarksOnlyUncheckedInBookingsAfterCutoff(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	s.cfg.NoShowCutoff = 2 * time.Hour
+	s.cfg.NoShowRefundRate = 10 * apitypes.OnePercent
+
+	absent := seedConfirmedTour(t, s)
+	present := seedConfirmedTour(t, s)
+	cancelled := seedConfirmedTour(t, s)
+	if _, err := s.store.CheckIn(present.CheckInToken, s.now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.CancelBooking(cancelled.ID, s.now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The departure starts at midnight local time on 2026-03-14, 06:00
+	// UTC; an hour after that is still inside the cutoff.
+	clock.t = time.Date(2026, 3, 14, 7, 0, 0, 0, time.UTC)
+	var resp struct {
+		NoShows []noShowResult `json:"no_shows"`
+	}
+	if rec := staffPost(t, s, "/api/bookings/tours/no-shows", &resp); rec.Code != http.StatusOK || len(resp.NoShows) != 0 {
+		t.Fatalf("before cutoff: status %d, no-shows %+v; want none", rec.Code, resp.NoShows)
+	}
+
+	clock.advance(2 * time.Hour)
+	if rec := staffPost(t, s, "/api/bookings/tours/no-shows", &resp); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.NoShows) != 1 || resp.NoShows[0].BookingID != absent.ID || resp.NoShows[0].RefundCents != 900 || resp.NoShows[0].RefundStatus != "requested" {
+		t.Fatalf("no-shows = %+v, want %s refunded 900", resp.NoShows, absent.ID)
+	}
+
+	got, _ := s.store.Booking(absent.ID)
+	if got.Status != StatusNoShow || got.NoShow == nil || got.NoShow.RefundStatus != "requested" || got.paymentSummary().RefundedCents != 900 {
+		t.Fatalf("absent booking = %+v, want no_show with its refund recorded", got)
+	}
+	if got, _ := s.store.Booking(present.ID); got.Status != StatusCheckedIn || got.NoShow != nil {
+		t.Fatalf("checked-in booking = %+v, want untouched", got)
+	}
+	if got, _ := s.store.Booking(cancelled.ID); got.Status != StatusCancelled || got.NoShow != nil {
+		t.Fatalf("cancelled booking = %+v, want untouched", got)
+	}
+
+	// Running again finds nothing new.
+	if staffPost(t, s, "/api/bookings/tours/no-shows", &resp); len(resp.NoShows) != 0 {
+		t.Fatalf("second run = %+v, want none", resp.NoShows)
+	}
+
+	var stats NoShowStats
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours/volcano-hike/no-shows", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("stats without a key: status %d, want 401", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/bookings/tours/volcano-hike/no-shows", nil)
+	req.Header.Set("Authorization", "Bearer staff-key")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	json.Unmarshal(rec.Body.Bytes(), &stats)
+	if rec.Code != http.StatusOK || stats.AttendedGuests != 2 || stats.NoShowGuests != 2 || stats.Rate != 50*apitypes.OnePercent || stats.Departures != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
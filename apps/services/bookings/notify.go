@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// Channel is a medium a guest can be contacted on.
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+)
+
+// EmailSender delivers a single email.
+type EmailSender interface {
+	SendEmail(ctx context.Context, to, subject, body string) error
+}
+
+// SMSSender delivers a single text message to an E.164 phone number.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// validE164 reports whether phone is an E.164 formatted number such as
+// +50370001234.
+func validE164(phone string) bool {
+	return e164Pattern.MatchString(phone)
+}
+
+// Category separates messages a guest must receive from ones they may opt
+// out of.
+type Category string
+
+const (
+	CategoryTransactional Category = "transactional"
+	CategoryMarketing     Category = "marketing"
+)
+
+// Notification templates.
+const (
+	TemplateBookingConfirmed = "booking_confirmed"
+	TemplateBookingReminder  = "booking_reminder"
+	// TemplateBookingFailedNoCapacity tells a guest their payment was
+	// refunded because the departure sold out while they paid.
+	TemplateBookingFailedNoCapacity = "booking_failed_no_capacity"
+	// TemplateBookingCancelled confirms a guest's own cancellation and the
+	// refund their rate plan allows.
+	TemplateBookingCancelled = "booking_cancelled"
+	// TemplateBookingCancelledByOperator tells a guest we called their
+	// departure off, why, and that they are refunded in full.
+	TemplateBookingCancelledByOperator = "booking_cancelled_by_operator"
+)
+
+// templateCategories maps each template to its category. Anything not listed
+// is transactional.
+var templateCategories = map[string]Category{
+	TemplateBookingReminder: CategoryMarketing,
+}
+
+// Notification is a guest-facing message about a booking. Cancellation
+// templates also carry the refund and, for operator cancellations, the
+// reason; a guest's own cancellation may suggest departures to rebook on.
+type Notification struct {
+	Template    string
+	Booking     Booking
+	RefundCents int64
+	Reason      string
+	Suggestions []RebookSuggestion
+}
+
+func (n Notification) category() Category {
+	if c, ok := templateCategories[n.Template]; ok {
+		return c
+	}
+	return CategoryTransactional
+}
+
+// render produces the email subject/body and the shorter SMS text.
+func (n Notification) render() (subject, body, sms string) {
+	b := n.Booking
+	when := b.Date
+	if b.Slot != "" {
+		when += " " + b.Slot
+	}
+	switch n.Template {
+	case TemplateBookingReminder:
+		subject = "Reminder: your upcoming booking"
+		body = fmt.Sprintf("Hi %s,\n\nThis is a reminder of your %s booking %s on %s for %d guest(s).\n\n¡Nos vemos pronto!", b.GuestName, b.Kind, b.ID, when, b.PartySize)
+		sms = fmt.Sprintf("Reminder: %s booking %s on %s, %d guest(s).", b.Kind, shortID(b.ID), when, b.PartySize)
+	case TemplateBookingFailedNoCapacity:
+		subject = "We couldn't complete your booking"
+		body = fmt.Sprintf("Hi %s,\n\nSorry — your %s booking %s on %s sold out while your payment was processing. We have refunded your payment in full; it may take a few days to appear.\n\nPlease choose another date and we'll be glad to host you.", b.GuestName, b.Kind, b.ID, when)
+		sms = fmt.Sprintf("Sorry, %s booking %s on %s sold out during payment. You have been refunded in full.", b.Kind, shortID(b.ID), when)
+	case TemplateBookingCancelled:
+		refund := "Under your booking's cancellation policy this cancellation is not refundable."
+		smsRefund := "No refund is due."
+		if n.RefundCents > 0 {
+			refund = fmt.Sprintf("Under your booking's cancellation policy we are refunding %s; it may take a few days to appear.", formatMoney(n.RefundCents, b.Currency))
+			smsRefund = "Refund: " + formatMoney(n.RefundCents, b.Currency) + "."
+		}
+		subject = "Your booking is cancelled"
+		body = fmt.Sprintf("Hi %s,\n\nAs you asked, we have cancelled your %s booking %s on %s. %s\n\n%sWe hope to welcome you another time.", b.GuestName, b.Kind, b.ID, when, refund, rebookingOffer(n.Suggestions, b.PartySize))
+		sms = fmt.Sprintf("Cancelled: %s booking %s on %s. %s", b.Kind, shortID(b.ID), when, smsRefund)
+	case TemplateBookingCancelledByOperator:
+		refund := "You have not been charged."
+		if n.RefundCents > 0 {
+			refund = fmt.Sprintf("We are refunding your payment in full, %s; it may take a few days to appear.", formatMoney(n.RefundCents, b.Currency))
+		}
+		subject = "We've had to cancel your booking"
+		body = fmt.Sprintf("Hi %s,\n\nWe're sorry — we've had to cancel your %s booking %s on %s.\n\nReason: %s\n\n%s\n\nPlease choose another date and we'll be glad to host you.", b.GuestName, b.Kind, b.ID, when, n.Reason, refund)
+		sms = fmt.Sprintf("Sorry, we cancelled %s booking %s on %s: %s. %s", b.Kind, shortID(b.ID), when, n.Reason, refund)
+	default:
+		subject = "Your booking is confirmed"
+		body = fmt.Sprintf("Hi %s,\n\nYour %s booking %s on %s for %d guest(s) is confirmed.\n\n¡Gracias por visitar El Salvador!", b.GuestName, b.Kind, b.ID, when, b.PartySize)
+		sms = fmt.Sprintf("Confirmed: %s booking %s on %s, %d guest(s).", b.Kind, shortID(b.ID), when, b.PartySize)
+	}
+	return subject, body, sms
+}
+
+// rebookingOffer lists departures a cancelling guest could book instead,
+// as a paragraph of the cancellation email.
+func rebookingOffer(suggestions []RebookSuggestion, partySize int) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	offer := fmt.Sprintf("If you'd still like to join us, these departures have room for your %d guest(s):\n", partySize)
+	for _, sg := range suggestions {
+		when := sg.Date
+		if sg.Slot != "" {
+			when += " " + sg.Slot
+		}
+		offer += fmt.Sprintf("  - %s on %s, %s\n", sg.TourID, when, formatMoney(sg.PriceCents, sg.Currency))
+	}
+	return offer + "\n"
+}
+
+// formatMoney renders cents as "45.00 USD".
+func formatMoney(cents int64, currency string) string {
+	if currency == "" {
+		currency = "USD"
+	}
+	return fmt.Sprintf("%d.%02d %s", cents/100, cents%100, currency)
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// ChannelNone is returned by Notifier.Send when a message was suppressed by
+// the guest's opt-outs.
+const ChannelNone Channel = ""
+
+// Notifier sends guest notifications over the channel each guest prefers,
+// honouring their opt-outs.
+type Notifier struct {
+	email       EmailSender
+	sms         SMSSender
+	prefs       *PreferenceStore
+	unsubscribe *unsubscribeSigner
+}
+
+func NewNotifier(email EmailSender, sms SMSSender, prefs *PreferenceStore, unsubscribe *unsubscribeSigner) *Notifier {
+	return &Notifier{email: email, sms: sms, prefs: prefs, unsubscribe: unsubscribe}
+}
+
+// Send delivers n and returns the channel it went out on. Guests who prefer
+// SMS get a text; if that is impossible or fails the message falls back to
+// email so it is never silently dropped. Marketing messages skip any channel
+// the guest opted out of and are suppressed entirely when no channel is left;
+// transactional messages always send.
+func (n *Notifier) Send(ctx context.Context, note Notification) (Channel, error) {
+	subject, body, text := note.render()
+	pref := n.prefs.Get(note.Booking.GuestEmail)
+	category := note.category()
+	allowed := func(ch Channel) bool {
+		return category == CategoryTransactional || !pref.optedOut(ch, category)
+	}
+	if category == CategoryMarketing && n.unsubscribe != nil {
+		body += "\n\nUnsubscribe: " + n.unsubscribe.link(pref.Email, category, ChannelNone) +
+			"\nContact preferences: " + n.unsubscribe.preferencesLink(pref.Email)
+	}
+
+	if pref.Channel == ChannelSMS && allowed(ChannelSMS) {
+		phone := pref.Phone
+		if phone == "" {
+			phone = note.Booking.GuestPhone
+		}
+		switch {
+		case !validE164(phone):
+			log.Printf("notify %s: guest prefers sms but %q is not E.164, using email", note.Booking.ID, phone)
+		default:
+			err := n.sms.SendSMS(ctx, phone, text)
+			if err == nil {
+				return ChannelSMS, nil
+			}
+			log.Printf("notify %s: sms failed, falling back to email: %v", note.Booking.ID, err)
+		}
+	}
+
+	if !allowed(ChannelEmail) {
+		return ChannelNone, nil
+	}
+	if err := n.email.SendEmail(ctx, note.Booking.GuestEmail, subject, body); err != nil {
+		return ChannelEmail, err
+	}
+	return ChannelEmail, nil
+}
+
+// notify sends a notification through the job queue. Delivery errors never
+// fail the caller, since the booking itself has already been committed;
+// once retries are exhausted the failure is recorded on the booking for
+// support to follow up.
+func (s *server) notify(ctx context.Context, template string, b Booking) {
+	s.sendNotification(ctx, Notification{Template: template, Booking: b})
+}
+
+// sendNotification is notify for notes that carry more than a booking.
+func (s *server) sendNotification(ctx context.Context, note Notification) {
+	s.jobs.Submit(ctx, Job{
+		Name: "notify " + note.Booking.ID + " (" + note.Template + ")",
+		Run: func(ctx context.Context) error {
+			_, err := s.notifier.Send(ctx, note)
+			return err
+		},
+		OnFailure: func(err error, attempts int) {
+			_, rerr := s.store.UpdateBooking(note.Booking.ID, s.now(), func(b *Booking) error {
+				b.NotificationFailures = append(b.NotificationFailures, NotificationFailure{
+					Template: note.Template,
+					Error:    err.Error(),
+					Attempts: attempts,
+					FailedAt: apitypes.JSONTime{Time: s.now()},
+				})
+				return nil
+			})
+			if rerr != nil {
+				log.Printf("recording failed notification for booking %s: %v", note.Booking.ID, rerr)
+			}
+		},
+	})
+}
+
+// NotificationFailure records a guest message that could not be delivered
+// after every retry.
+type NotificationFailure struct {
+	Template string            `json:"template"`
+	Error    string            `json:"error"`
+	Attempts int               `json:"attempts"`
+	FailedAt apitypes.JSONTime `json:"failed_at"`
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNotifierSendsSMSWhenPreferred(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.prefs.Set(GuestPreferences{Email: "Ana@Example.com", Phone: "+50370001234", Channel: ChannelSMS})
+
+	b := Booking{ID: "b-1", Kind: KindTour, Date: "2026-03-14", PartySize: 2, GuestEmail: "ana@example.com"}
+	ch, err := s.notifier.Send(context.Background(), Notification{Template: TemplateBookingConfirmed, Booking: b})
+	if err != nil || ch != ChannelSMS {
+		t.Fatalf("Send = %s, %v; want sms", ch, err)
+	}
+	ob := sentMessages(s)
+	if len(ob.sms) != 1 || ob.sms[0].To != "+50370001234" || len(ob.emails) != 0 {
+		t.Fatalf("outbox sms=%+v emails=%+v", ob.sms, ob.emails)
+	}
+}
+
+func TestNotifierFallsBackToEmailOnSMSError(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.prefs.Set(GuestPreferences{Email: "ana@example.com", Phone: "+50370001234", Channel: ChannelSMS})
+	ob := sentMessages(s)
+	ob.smsErr = errors.New("twilio: unexpected status 500")
+
+	b := Booking{ID: "b-2", Kind: KindTour, Date: "2026-03-14", PartySize: 2, GuestEmail: "ana@example.com"}
+	ch, err := s.notifier.Send(context.Background(), Notification{Template: TemplateBookingReminder, Booking: b})
+	if err != nil || ch != ChannelEmail {
+		t.Fatalf("Send = %s, %v; want email fallback", ch, err)
+	}
+	if len(ob.emails) != 1 || ob.emails[0].To != "ana@example.com" || ob.emails[0].Subject != "Reminder: your upcoming booking" {
+		t.Fatalf("emails = %+v", ob.emails)
+	}
+}
+
+func TestPreferencesRejectNonE164Phone(t *testing.T) {
+	s, _ := newTestServer(t)
+	for _, phone := range []string{"7000-1234", "50370001234", "+0123", "+503 7000 1234"} {
+		rec := doStaff(t, s.routes(), http.MethodPut, "/api/bookings/guests/ana@example.com/preferences", map[string]string{
+			"channel": "sms", "phone": phone,
+		}, nil)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("phone %q: status %d, want 422", phone, rec.Code)
+		}
+	}
+	if got := s.prefs.Get("ana@example.com"); got.Channel != ChannelEmail {
+		t.Fatalf("rejected update changed preferences: %+v", got)
+	}
+}
+
+func TestConfirmationUsesPreferredChannel(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.ApprovalThresholdCents = 0
+	h := s.routes()
+	token := s.unsubscribe.preferencesToken("ana@example.com")
+	doJSON(t, h, http.MethodPut, "/api/bookings/guests/ana@example.com/preferences?token="+token, map[string]string{
+		"channel": "sms", "phone": "+50370001234",
+	}, nil)
+
+	b := seedPendingTour(t, s, 2)
+	doService(t, h, http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_1", "amount_cents": 5000,
+	}, nil)
+	if ob := sentMessages(s); len(ob.sms) != 1 {
+		t.Fatalf("confirmation sms count = %d, want 1", len(ob.sms))
+	}
+}
+
+// newRetryTestServer retries notifications up to three times without
+// waiting and collects alerts instead of logging them.
+func newRetryTestServer(t *testing.T) (*server, *[]string) {
+	t.Helper()
+	s, _ := newTestServer(t)
+	s.jobs = NewJobQueue(3, 0)
+	var alerts []string
+	s.jobs.alert = func(job string, err error) { alerts = append(alerts, job+": "+err.Error()) }
+	return s, &alerts
+}
+
+func TestConfirmationEmailRetriesTransientFailure(t *testing.T) {
+	s, alerts := newRetryTestServer(t)
+	ob := sentMessages(s)
+	ob.emailErrs = []error{errors.New("resend: unexpected status 503"), errors.New("resend: unexpected status 502")}
+	b := seedPendingTour(t, s, 2)
+
+	if rec := confirmPaid(t, s, b); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	s.jobs.Wait()
+	if len(ob.emails) != 1 || ob.emails[0].Subject != "Your booking is confirmed" {
+		t.Fatalf("emails = %+v", ob.emails)
+	}
+	if len(*alerts) != 0 {
+		t.Fatalf("alerts = %v", *alerts)
+	}
+	if got, _ := s.store.Booking(b.ID); len(got.NotificationFailures) != 0 {
+		t.Fatalf("failures = %+v", got.NotificationFailures)
+	}
+}
+
+func TestConfirmationEmailFailureAlertsAndIsRecorded(t *testing.T) {
+	s, alerts := newRetryTestServer(t)
+	ob := sentMessages(s)
+	down := errors.New("resend: unexpected status 503")
+	ob.emailErrs = []error{down, down, down}
+	b := seedPendingTour(t, s, 2)
+
+	confirmPaid(t, s, b)
+	s.jobs.Wait()
+	if len(ob.emails) != 0 {
+		t.Fatalf("emails = %+v", ob.emails)
+	}
+	if len(*alerts) != 1 {
+		t.Fatalf("alerts = %v, want one", *alerts)
+	}
+	got, _ := s.store.Booking(b.ID)
+	if got.Status != StatusConfirmed {
+		t.Fatalf("status %s: a failed email must not undo the confirmation", got.Status)
+	}
+	if len(got.NotificationFailures) != 1 {
+		t.Fatalf("failures = %+v", got.NotificationFailures)
+	}
+	if f := got.NotificationFailures[0]; f.Template != TemplateBookingConfirmed || f.Attempts != 3 || f.Error != down.Error() {
+		t.Fatalf("failure = %+v", f)
+	}
+}
+
+func TestPermanentEmailFailureIsNotRetried(t *testing.T) {
+	s, alerts := newRetryTestServer(t)
+	ob := sentMessages(s)
+	ob.emailErrs = []error{permanent(errors.New("resend: unexpected status 422"))}
+	b := seedPendingTour(t, s, 2)
+
+	confirmPaid(t, s, b)
+	s.jobs.Wait()
+	got, _ := s.store.Booking(b.ID)
+	if len(*alerts) != 1 || len(got.NotificationFailures) != 1 || got.NotificationFailures[0].Attempts != 1 {
+		t.Fatalf("alerts = %v, failures = %+v", *alerts, got.NotificationFailures)
+	}
+}
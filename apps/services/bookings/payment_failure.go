@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// PaymentFailure is why a booking's payment never completed, as reported
+// by the payments service.
+type PaymentFailure struct {
+	PaymentRef string            `json:"payment_ref,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	At         apitypes.JSONTime `json:"at"`
+}
+
+// FailPayment marks a pending booking StatusPaymentFailed and frees its
+// seats. Payment providers redeliver their notifications, so a booking
+// that has already failed is returned as it stands and its seats are not
+// released a second time.
+func (s *Store) FailPayment(id string, f PaymentFailure, now time.Time) (Booking, error) {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	switch b.Status {
+	case StatusPaymentFailed:
+		return *b, nil
+	case StatusPending:
+	default:
+		return Booking{}, ErrInvalidTransition
+	}
+	s.releaseBookingLocked(b)
+	f.At = apitypes.JSONTime{Time: now}
+	b.PaymentFailure = &f
+	b.Status = StatusPaymentFailed
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	return *b, nil
+}
+
+// recordPaymentFailureHandler takes a failed or abandoned payment reported
+// by the payments service. Unless PaymentFailureReleasesSeats is off, the
+// booking gives up its seats; otherwise it stays pending so the guest can
+// retry on the seats they hold.
+func (s *server) recordPaymentFailureHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PaymentRef string `json:"payment_ref"`
+		Source     string `json:"source"`
+		Reason     string `json:"reason"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	id := chi.URLParam(r, "bookingId")
+	if !s.cfg.PaymentFailureReleasesSeats {
+		b, err := s.store.Booking(id)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		log.Printf("booking %s: %s payment %s failed (%s); keeping its seats", id, req.Source, req.PaymentRef, req.Reason)
+		respondJSON(w, http.StatusOK, b)
+		return
+	}
+	b, err := s.store.FailPayment(id, PaymentFailure{
+		PaymentRef: req.PaymentRef,
+		Source:     req.Source,
+		Reason:     req.Reason,
+	}, s.now())
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	log.Printf("booking %s: %s payment %s failed (%s); booking is now %s", b.ID, req.Source, req.PaymentRef, req.Reason, b.Status)
+	respondJSON(w, http.StatusOK, b)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func postPaymentFailure(t *testing.T, s *server, bookingID, source string) (Booking, *httptest.ResponseRecorder) {
+	t.Helper()
+	var b Booking
+	rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+bookingID+"/payment-failure", map[string]interface{}{
+		"payment_ref": "cs_1", "source": source, "reason": "checkout.session.expired",
+	}, &b)
+	return b, rec
+}
+
+func TestPaymentFailureReleasesSeatsOnce(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.PaymentFailureReleasesSeats = true
+	inv := newFakeInventory()
+	s.store.UseInventory(inv)
+	// Another guest's seats on the same departure show up any double release.
+	seedPendingTour(t, s, 3)
+	b := seedPendingTour(t, s, 2)
+
+	// Stripe redelivers its webhooks, so the same failure can arrive twice.
+	for i := 0; i < 2; i++ {
+		got, rec := postPaymentFailure(t, s, b.ID, "stripe")
+		if rec.Code != http.StatusOK || got.Status != StatusPaymentFailed || got.PaymentFailure == nil {
+			t.Fatalf("failure %d: status %d booking %+v", i+1, rec.Code, got)
+		}
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 3 {
+		t.Fatalf("booked = %d, want 3 after releasing the failed booking's 2 seats once", d.Booked)
+	}
+	if got := inv.bookedOn("volcano-hike", "2026-03-14", ""); got != 3 {
+		t.Fatalf("shared inventory booked = %d, want 3", got)
+	}
+	if rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "pi_1", "amount_cents": 9000, "currency": "USD",
+	}, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("paying a failed booking: status %d, want 409", rec.Code)
+	}
+}
+
+func TestPaymentFailureKeepsSeatsWhenDisabled(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPendingTour(t, s, 2)
+
+	got, rec := postPaymentFailure(t, s, b.ID, "lightning")
+	if rec.Code != http.StatusOK || got.Status != StatusPending {
+		t.Fatalf("status %d booking %s, want 200 and still pending", rec.Code, got.Status)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 2 {
+		t.Fatalf("booked = %d, want seats kept", d.Booked)
+	}
+}
+
+func TestPaymentFailureOnPaidBookingConflicts(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.PaymentFailureReleasesSeats = true
+	b := paidTour(t, s)
+
+	if _, rec := postPaymentFailure(t, s, b.ID, "stripe"); rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409", rec.Code)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Booked != 2 {
+		t.Fatalf("booked = %d, want paid seats kept", d.Booked)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// RefundRequest asks the payments service to return money for a booking.
+type RefundRequest struct {
+	PaymentRef  string `json:"payment_ref"`
+	BookingID   string `json:"booking_id"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	Reason      string `json:"reason"`
+	// GuestEmail finds the guest's saved Lightning Address, where a
+	// Lightning payment is refunded.
+	GuestEmail string `json:"guest_email,omitempty"`
+}
+
+// CheckoutRequest asks the payments service for a hosted checkout page for
+// a booking.
+type CheckoutRequest struct {
+	BookingID   string `json:"booking_id"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	// ReferralCode is ignored by the payments service when it is unknown.
+	ReferralCode string `json:"referral_code,omitempty"`
+}
+
+// CheckoutSession is where the guest goes to pay.
+type CheckoutSession struct {
+	ID  string `json:"session_id"`
+	URL string `json:"url"`
+}
+
+// PaymentsClient is the bookings service's view of the payments service.
+type PaymentsClient interface {
+	Refund(ctx context.Context, req RefundRequest) error
+	// CreateCheckout is idempotent per booking: repeating it returns the
+	// session created the first time.
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (CheckoutSession, error)
+}
+
+// checkoutIdempotencyKey identifies every checkout attempt for a booking, so
+// the payments service creates at most one session for it.
+func checkoutIdempotencyKey(bookingID string) string {
+	return "booking-" + bookingID + "-checkout"
+}
+
+// httpPaymentsClient talks to the payments service over its REST API.
+type httpPaymentsClient struct {
+	baseURL string
+	// apiKey is sent as a bearer token; refunds need the payments
+	// service's admin key.
+	apiKey string
+	http   *http.Client
+	// Calls sent with an idempotency key are retried up to maxRetries
+	// times, waiting backoff longer before each attempt.
+	maxRetries int
+	backoff    time.Duration
+}
+
+func newHTTPPaymentsClient(baseURL, apiKey string) *httpPaymentsClient {
+	return &httpPaymentsClient{
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		http:       &http.Client{Timeout: 10 * time.Second},
+		maxRetries: 2,
+		backoff:    200 * time.Millisecond,
+	}
+}
+
+func (c *httpPaymentsClient) Refund(ctx context.Context, req RefundRequest) error {
+	return c.post(ctx, "/api/payments/refunds", req, "", nil)
+}
+
+func (c *httpPaymentsClient) CreateCheckout(ctx context.Context, req CheckoutRequest) (CheckoutSession, error) {
+	var session CheckoutSession
+	err := c.post(ctx, "/api/payments/checkout", req, checkoutIdempotencyKey(req.BookingID), &session)
+	return session, err
+}
+
+// post sends body to path and decodes the response into out when out is
+// non-nil. Only calls with an idempotency key are retried, since the
+// payments service can then recognise a repeat of a call that already
+// succeeded.
+func (c *httpPaymentsClient) post(ctx context.Context, path string, body interface{}, idempotencyKey string, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.backoff * time.Duration(attempt)):
+			}
+		}
+		err = c.send(ctx, path, payload, idempotencyKey, out)
+		if idempotencyKey == "" || attempt == c.maxRetries || !transient(ctx, err) {
+			return err
+		}
+	}
+}
+
+func (c *httpPaymentsClient) send(ctx context.Context, path string, payload []byte, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	httpkit.PropagateRequestID(ctx, req)
+	tenantkit.Propagate(ctx, req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &paymentsStatusError{Path: path, Status: resp.StatusCode}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("payments %s: %w", path, err)
+	}
+	return nil
+}
+
+// paymentsStatusError is a non-2xx answer from the payments service.
+type paymentsStatusError struct {
+	Path   string
+	Status int
+}
+
+func (e *paymentsStatusError) Error() string {
+	return fmt.Sprintf("payments %s: unexpected status %d", e.Path, e.Status)
+}
+
+// transient reports whether err may go away on retry: a network failure
+// while ctx is still live, or a 5xx or 429 answer.
+func transient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var se *paymentsStatusError
+	if errors.As(err, &se) {
+		return se.Status >= 500 || se.Status == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// Readiness of one service as seen by the platform health check.
+// Unreachable means it could not be asked at all; unhealthy means it
+// answered and was not fit to serve.
+const (
+	ServiceReady       = "ready"
+	ServiceDegraded    = "degraded"
+	ServiceUnhealthy   = "unhealthy"
+	ServiceUnreachable = "unreachable"
+)
+
+// Overall platform status.
+const (
+	PlatformHealthy   = "healthy"
+	PlatformDegraded  = "degraded"
+	PlatformUnhealthy = "unhealthy"
+)
+
+// ServiceHealth is one service's answer to its /ready probe.
+type ServiceHealth struct {
+	Service    string                 `json:"service"`
+	Status     string                 `json:"status"`
+	HTTPStatus int                    `json:"http_status,omitempty"`
+	LatencyMS  int64                  `json:"latency_ms"`
+	Error      string                 `json:"error,omitempty"`
+	Checks     map[string]interface{} `json:"checks,omitempty"`
+}
+
+// PlatformHealth combines every service's readiness. The platform is
+// healthy when all services are ready, unhealthy when any is unhealthy or
+// unreachable, and degraded otherwise.
+type PlatformHealth struct {
+	Status    string            `json:"status"`
+	CheckedAt apitypes.JSONTime `json:"checked_at"`
+	Services  []ServiceHealth   `json:"services"`
+}
+
+// healthTargets maps each sibling service to its base URL.
+func (s *server) healthTargets() map[string]string {
+	return map[string]string{
+		"payments": s.cfg.PaymentsServiceURL,
+		"pricing":  s.cfg.PricingServiceURL,
+	}
+}
+
+// platformHealth probes every service's /ready concurrently, each bounded
+// by PlatformHealthTimeout. Bookings answers for itself without a round
+// trip.
+func (s *server) platformHealth(ctx context.Context) PlatformHealth {
+	targets := s.healthTargets()
+	results := make(chan ServiceHealth, len(targets))
+	var wg sync.WaitGroup
+	for name, baseURL := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- s.probeService(ctx, name, baseURL)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	h := PlatformHealth{Status: PlatformHealthy, CheckedAt: apitypes.JSONTime{Time: s.now()}}
+	h.Services = append(h.Services, ServiceHealth{Service: "bookings", Status: ServiceReady})
+	for res := range results {
+		h.Services = append(h.Services, res)
+	}
+	sort.Slice(h.Services, func(i, j int) bool { return h.Services[i].Service < h.Services[j].Service })
+	for _, svc := range h.Services {
+		switch svc.Status {
+		case ServiceReady:
+		case ServiceDegraded:
+			if h.Status == PlatformHealthy {
+				h.Status = PlatformDegraded
+			}
+		default:
+			h.Status = PlatformUnhealthy
+		}
+	}
+	return h
+}
+
+// probeService asks one service whether it is ready. A 200 answer reports
+// the service's own status, "ready" or "degraded"; any other answer is
+// unhealthy.
+func (s *server) probeService(ctx context.Context, name, baseURL string) (res ServiceHealth) {
+	res.Service = name
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.PlatformHealthTimeout)
+	defer cancel()
+	start := time.Now()
+	defer func() { res.LatencyMS = time.Since(start).Milliseconds() }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/ready", nil)
+	if err != nil {
+		res.Status, res.Error = ServiceUnreachable, err.Error()
+		return res
+	}
+	httpkit.PropagateRequestID(ctx, req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		res.Status, res.Error = ServiceUnreachable, err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	res.HTTPStatus = resp.StatusCode
+
+	var body struct {
+		Status string                 `json:"status"`
+		Checks map[string]interface{} `json:"checks"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+	res.Checks = body.Checks
+	switch {
+	case resp.StatusCode != http.StatusOK:
+		res.Status, res.Error = ServiceUnhealthy, fmt.Sprintf("/ready answered %d", resp.StatusCode)
+	case decodeErr != nil:
+		res.Status, res.Error = ServiceUnhealthy, "unreadable /ready response: "+decodeErr.Error()
+	case body.Status == ServiceReady || body.Status == ServiceDegraded:
+		res.Status = body.Status
+	default:
+		res.Status, res.Error = ServiceUnhealthy, fmt.Sprintf("reported status %q", body.Status)
+	}
+	return res
+}
+
+// platformHealthHandler reports the whole platform's readiness in one
+// call, answering 503 when it is unhealthy so load balancers and uptime
+// checks can act on the status code alone.
+func (s *server) platformHealthHandler(w http.ResponseWriter, r *http.Request) {
+	h := s.platformHealth(r.Context())
+	status := http.StatusOK
+	if h.Status == PlatformUnhealthy {
+		status = http.StatusServiceUnavailable
+	}
+	respondJSON(w, status, h)
+}
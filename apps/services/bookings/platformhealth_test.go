@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// readyService stands in for a sibling service answering /ready.
+func readyService(t *testing.T, code int, status string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			http.NotFound(w, r)
+			return
+		}
+		respondJSON(w, code, map[string]interface{}{"status": status, "checks": map[string]interface{}{"lightning": map[string]string{"status": "ok"}}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func platformHealthFor(t *testing.T, paymentsURL, pricingURL string) (int, PlatformHealth) {
+	t.Helper()
+	s, _ := newTestServer(t)
+	s.cfg.PaymentsServiceURL, s.cfg.PricingServiceURL = paymentsURL, pricingURL
+	s.cfg.PlatformHealthTimeout = time.Second
+	var h PlatformHealth
+	rec := doJSON(t, s.routes(), http.MethodGet, "/health/platform", nil, &h)
+	return rec.Code, h
+}
+
+func serviceStatuses(h PlatformHealth) map[string]string {
+	out := make(map[string]string)
+	for _, svc := range h.Services {
+		out[svc.Service] = svc.Status
+	}
+	return out
+}
+
+func TestPlatformHealthAllReady(t *testing.T) {
+	code, h := platformHealthFor(t, readyService(t, http.StatusOK, "ready").URL, readyService(t, http.StatusOK, "ready").URL)
+	got := serviceStatuses(h)
+	if code != http.StatusOK || h.Status != PlatformHealthy || len(got) != 3 ||
+		got["bookings"] != ServiceReady || got["payments"] != ServiceReady || got["pricing"] != ServiceReady {
+		t.Fatalf("status %d, health %+v; want every service ready", code, h)
+	}
+}
+
+func TestPlatformHealthDegradedServiceDegradesPlatform(t *testing.T) {
+	code, h := platformHealthFor(t, readyService(t, http.StatusOK, "degraded").URL, readyService(t, http.StatusOK, "ready").URL)
+	if code != http.StatusOK || h.Status != PlatformDegraded || serviceStatuses(h)["payments"] != ServiceDegraded {
+		t.Fatalf("status %d, health %+v; want degraded", code, h)
+	}
+}
+
+func TestPlatformHealthTellsUnreachableFromUnhealthy(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	code, h := platformHealthFor(t, readyService(t, http.StatusInternalServerError, "error").URL, downURL)
+	if code != http.StatusServiceUnavailable || h.Status != PlatformUnhealthy {
+		t.Fatalf("status %d, health %+v; want 503 unhealthy", code, h)
+	}
+	for _, svc := range h.Services {
+		switch svc.Service {
+		case "pricing":
+			if svc.Status != ServiceUnreachable || svc.HTTPStatus != 0 || svc.Error == "" {
+				t.Errorf("pricing = %+v, want unreachable", svc)
+			}
+		case "payments":
+			if svc.Status != ServiceUnhealthy || svc.HTTPStatus != http.StatusInternalServerError {
+				t.Errorf("payments = %+v, want unhealthy with its 500", svc)
+			}
+		case "bookings":
+			if svc.Status != ServiceReady {
+				t.Errorf("bookings = %+v, want ready", svc)
+			}
+		}
+	}
+}
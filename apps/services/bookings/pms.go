@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PMSFormat maps a booking onto the request body an external
+// property-management system expects.
+type PMSFormat interface {
+	ContentType() string
+	Encode(b Booking) ([]byte, error)
+}
+
+// pmsFormats are the formats selectable with PMS_FORMAT.
+var pmsFormats = map[string]PMSFormat{
+	"generic_json": genericJSONFormat{},
+}
+
+// pmsReservation is the generic reservation schema most PMS webhooks accept.
+type pmsReservation struct {
+	ExternalID string   `json:"external_id"`
+	Source     string   `json:"source"`
+	Type       string   `json:"type"`
+	ListingID  string   `json:"listing_id"`
+	Arrival    string   `json:"arrival"`
+	StartTime  string   `json:"start_time,omitempty"`
+	Guests     int      `json:"guests"`
+	Guest      pmsGuest `json:"guest"`
+	Status     string   `json:"status"`
+	TotalCents int64    `json:"total_cents"`
+	Currency   string   `json:"currency,omitempty"`
+	PaymentRef string   `json:"payment_ref,omitempty"`
+	AgencyID   string   `json:"agency_id,omitempty"`
+}
+
+type pmsGuest struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// genericJSONFormat encodes bookings as a pmsReservation.
+type genericJSONFormat struct{}
+
+func (genericJSONFormat) ContentType() string { return "application/json" }
+
+func (genericJSONFormat) Encode(b Booking) ([]byte, error) {
+	return json.Marshal(pmsReservation{
+		ExternalID: b.ID,
+		Source:     "gateway-el-salvador",
+		Type:       string(b.Kind),
+		ListingID:  b.OfferingID,
+		Arrival:    b.Date,
+		StartTime:  b.Slot,
+		Guests:     b.PartySize,
+		Guest:      pmsGuest{Name: b.GuestName, Email: b.GuestEmail, Phone: b.GuestPhone},
+		Status:     string(b.Status),
+		TotalCents: b.AmountCents,
+		Currency:   b.Currency,
+		PaymentRef: b.PaymentRef,
+		AgencyID:   b.AgencyID,
+	})
+}
+
+// PMSPusher pushes confirmed bookings to a host's property-management system.
+// Pushes run in the background so a slow or failing PMS never delays the
+// guest's confirmation; exhausted retries raise an alert instead.
+type PMSPusher struct {
+	endpoint    string
+	token       string
+	format      PMSFormat
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	// alert is called once a push has failed on every attempt.
+	alert func(b Booking, err error)
+
+	wg sync.WaitGroup
+}
+
+func NewPMSPusher(endpoint, token string, format PMSFormat, maxAttempts int) *PMSPusher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &PMSPusher{
+		endpoint:    endpoint,
+		token:       token,
+		format:      format,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: maxAttempts,
+		backoff:     time.Second,
+		alert: func(b Booking, err error) {
+			log.Printf("ALERT: PMS push for booking %s failed: %v", b.ID, err)
+		},
+	}
+}
+
+// Push sends b to the PMS, retrying network errors, 5xx and 429 responses
+// with linear backoff.
+func (p *PMSPusher) Push(ctx context.Context, b Booking) error {
+	body, err := p.format.Encode(b)
+	if err != nil {
+		return fmt.Errorf("pms: encode booking: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := p.send(ctx, body, b.ID)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == p.maxAttempts {
+			return fmt.Errorf("pms: attempt %d: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.backoff * time.Duration(attempt)):
+		}
+	}
+}
+
+// send makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (p *PMSPusher) send(ctx context.Context, body []byte, bookingID string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", p.format.ContentType())
+	// Lets the PMS deduplicate redelivered reservations.
+	req.Header.Set("Idempotency-Key", bookingID)
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// PushAsync pushes b in the background, alerting if every attempt fails.
+func (p *PMSPusher) PushAsync(b Booking) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if err := p.Push(ctx, b); err != nil {
+			p.alert(b, err)
+		}
+	}()
+}
+
+// Wait blocks until every background push has finished.
+func (p *PMSPusher) Wait() {
+	p.wg.Wait()
+}
+
+// bookingConfirmed runs the side effects of a booking becoming confirmed:
+// the guest is notified and, when configured, the PMS is updated.
+func (s *server) bookingConfirmed(ctx context.Context, b Booking) {
+	s.notify(ctx, TemplateBookingConfirmed, b)
+	if s.pms != nil {
+		s.pms.PushAsync(b)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakePMS answers each push with the next status in statuses, then 200.
+type fakePMS struct {
+	mu       sync.Mutex
+	statuses []int
+	received []pmsReservation
+	attempts int
+}
+
+func (f *fakePMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if len(f.statuses) > 0 {
+		status := f.statuses[0]
+		f.statuses = f.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	var res pmsReservation
+	json.NewDecoder(r.Body).Decode(&res)
+	f.received = append(f.received, res)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func newPMSTestServer(t *testing.T, pms *fakePMS) (*server, *[]error) {
+	t.Helper()
+	s, _ := newTestServer(t)
+	srv := httptest.NewServer(pms)
+	t.Cleanup(srv.Close)
+	s.pms = NewPMSPusher(srv.URL, "pms-token", genericJSONFormat{}, 3)
+	s.pms.backoff = 0
+	var alerts []error
+	s.pms.alert = func(_ Booking, err error) { alerts = append(alerts, err) }
+	return s, &alerts
+}
+
+func confirmPaid(t *testing.T, s *server, b Booking) *httptest.ResponseRecorder {
+	t.Helper()
+	return doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_pms", "amount_cents": 9000, "currency": "USD",
+	}, nil)
+}
+
+func TestPMSPushOnConfirmation(t *testing.T) {
+	pms := &fakePMS{}
+	s, alerts := newPMSTestServer(t, pms)
+	b := seedPendingTour(t, s, 3)
+
+	if rec := confirmPaid(t, s, b); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	s.pms.Wait()
+
+	if len(pms.received) != 1 || len(*alerts) != 0 {
+		t.Fatalf("received %d reservations, alerts %v", len(pms.received), *alerts)
+	}
+	got := pms.received[0]
+	if got.ExternalID != b.ID || got.ListingID != "volcano-hike" || got.Arrival != "2026-03-14" ||
+		got.Guests != 3 || got.Guest.Email != "ana@example.com" || got.TotalCents != 9000 || got.Status != "confirmed" {
+		t.Fatalf("reservation = %+v", got)
+	}
+}
+
+func TestPMSPushRetriesTransientFailures(t *testing.T) {
+	pms := &fakePMS{statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway}}
+	s, alerts := newPMSTestServer(t, pms)
+	b := seedPendingTour(t, s, 2)
+
+	confirmPaid(t, s, b)
+	s.pms.Wait()
+
+	if pms.attempts != 3 || len(pms.received) != 1 || len(*alerts) != 0 {
+		t.Fatalf("attempts %d, received %d, alerts %v", pms.attempts, len(pms.received), *alerts)
+	}
+}
+
+func TestPMSFailureAlertsWithoutBlockingConfirmation(t *testing.T) {
+	pms := &fakePMS{statuses: []int{500, 500, 500}}
+	s, alerts := newPMSTestServer(t, pms)
+	b := seedPendingTour(t, s, 2)
+
+	var got Booking
+	rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_pms", "amount_cents": 9000, "currency": "USD",
+	}, &got)
+	s.pms.Wait()
+
+	if rec.Code != http.StatusOK || got.Status != StatusConfirmed {
+		t.Fatalf("confirmation: status %d booking %+v", rec.Code, got)
+	}
+	if len(sentMessages(s).emails) != 1 {
+		t.Fatalf("guest emails = %d, want 1", len(sentMessages(s).emails))
+	}
+	if pms.attempts != 3 || len(*alerts) != 1 {
+		t.Fatalf("attempts %d, alerts %v; want 3 attempts and one alert", pms.attempts, *alerts)
+	}
+}
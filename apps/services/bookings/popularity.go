@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// How much each signal contributes to a tour's popularity score, which
+// runs from 0 to 1.
+const (
+	popularityVelocityWeight   = 0.5
+	popularityConversionWeight = 0.3
+	popularityRatingWeight     = 0.2
+)
+
+// A tour's rating is averaged with ratingPrior as though it had
+// ratingPriorReviews more reviews at that rating, so one five-star review
+// does not outrank hundreds at 4.8. Unrated tours score the prior.
+const (
+	maxTourRating      = 5.0
+	ratingPrior        = 3.5
+	ratingPriorReviews = 10
+)
+
+// TourRating is a tour's guest rating as published in the catalogue, out
+// of maxTourRating.
+type TourRating struct {
+	Rating      float64 `json:"rating"`
+	ReviewCount int     `json:"review_count"`
+}
+
+// TourPopularity is how a tour ranks in search. BookingsPerDay counts the
+// bookings made over the popularity window, paid or not; ConversionRate
+// is the share of them that went on to pay.
+type TourPopularity struct {
+	TourID         string           `json:"tour_id"`
+	Score          float64          `json:"score"`
+	BookingsPerDay float64          `json:"bookings_per_day"`
+	ConversionRate apitypes.Percent `json:"conversion_rate"`
+	Rating         *TourRating      `json:"rating,omitempty"`
+}
+
+// SetTourRating records a tour's catalogue rating. A rating with no
+// reviews clears it.
+func (s *Store) SetTourRating(tourID string, rating TourRating) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rating.ReviewCount == 0 {
+		delete(s.tourRatings, tourID)
+		return
+	}
+	s.tourRatings[tourID] = rating
+}
+
+// tourActivity is what the store knows of every tour: the tours it has
+// departures, bookings or ratings for, their bookings, and their ratings.
+type tourActivity struct {
+	tourIDs  []string
+	bookings []Booking
+	ratings  map[string]TourRating
+}
+
+// TourActivity snapshots the tours the store knows of for scoring.
+func (s *Store) TourActivity() tourActivity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool)
+	a := tourActivity{ratings: make(map[string]TourRating, len(s.tourRatings))}
+	for key := range s.departures {
+		seen[key.TourID] = true
+	}
+	for _, b := range s.bookings {
+		if b.Kind == KindTour {
+			seen[b.OfferingID] = true
+			a.bookings = append(a.bookings, *b)
+		}
+	}
+	for id, r := range s.tourRatings {
+		seen[id] = true
+		a.ratings[id] = r
+	}
+	for id := range seen {
+		a.tourIDs = append(a.tourIDs, id)
+	}
+	return a
+}
+
+// scorePopularity ranks a's tours for tenant on the bookings it made in the
+// window before now, most popular first. Booking velocity is scaled
+// against the tenant's busiest tour.
+func scorePopularity(tenants Tenants, tenant Tenant, a tourActivity, window time.Duration, now time.Time) []TourPopularity {
+	made := make(map[string]int)
+	paid := make(map[string]int)
+	since := now.Add(-window)
+	for _, b := range a.bookings {
+		if !owns(tenants, tenant, b) || b.CreatedAt.Before(since) || b.CreatedAt.After(now) {
+			continue
+		}
+		made[b.OfferingID]++
+		if b.PaymentRef != "" {
+			paid[b.OfferingID]++
+		}
+	}
+	busiest := 0
+	for _, n := range made {
+		busiest = max(busiest, n)
+	}
+	days := window.Hours() / 24
+	scores := make([]TourPopularity, 0, len(a.tourIDs))
+	for _, id := range a.tourIDs {
+		p := TourPopularity{TourID: id, BookingsPerDay: math.Round(float64(made[id])/days*100) / 100}
+		var velocity, conversion float64
+		if made[id] > 0 {
+			velocity = float64(made[id]) / float64(busiest)
+			conversion = float64(paid[id]) / float64(made[id])
+			p.ConversionRate = apitypes.Percent(int64(paid[id]) * int64(apitypes.HundredPercent) / int64(made[id]))
+		}
+		rating := ratingPrior
+		if r, ok := a.ratings[id]; ok {
+			p.Rating = &r
+			rating = (r.Rating*float64(r.ReviewCount) + ratingPrior*ratingPriorReviews) / float64(r.ReviewCount+ratingPriorReviews)
+		}
+		score := popularityVelocityWeight*velocity + popularityConversionWeight*conversion + popularityRatingWeight*rating/maxTourRating
+		p.Score = math.Round(score*10000) / 10000
+		scores = append(scores, p)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].TourID < scores[j].TourID
+	})
+	return scores
+}
+
+// popularityCache holds each tenant's tour ranking between refreshes, so
+// searches do not rescan every booking.
+type popularityCache struct {
+	mu         sync.Mutex
+	byTenant   map[string][]TourPopularity
+	computedAt time.Time
+}
+
+// refreshPopularity rescores every tenant's tours.
+func (s *server) refreshPopularity() {
+	now := s.now()
+	a := s.store.TourActivity()
+	byTenant := make(map[string][]TourPopularity, s.cfg.Tenants.Len())
+	for _, tenant := range s.cfg.Tenants.All() {
+		byTenant[tenant.ID] = scorePopularity(s.cfg.Tenants, tenant, a, s.cfg.PopularityWindow, now)
+	}
+	s.popularity.mu.Lock()
+	defer s.popularity.mu.Unlock()
+	s.popularity.byTenant, s.popularity.computedAt = byTenant, now
+}
+
+// tourPopularity returns tenant's cached ranking and when it was scored,
+// scoring it first if no refresh has run yet.
+func (s *server) tourPopularity(tenant Tenant) ([]TourPopularity, time.Time) {
+	s.popularity.mu.Lock()
+	computed := !s.popularity.computedAt.IsZero()
+	s.popularity.mu.Unlock()
+	if !computed {
+		s.refreshPopularity()
+	}
+	s.popularity.mu.Lock()
+	defer s.popularity.mu.Unlock()
+	return append([]TourPopularity(nil), s.popularity.byTenant[tenant.ID]...), s.popularity.computedAt
+}
+
+// sweepPopularity refreshes tour popularity periodically until ctx is done.
+func (s *server) sweepPopularity(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PopularityRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshPopularity()
+		}
+	}
+}
+
+// searchToursHandler lists the tenant's tours, most popular first. With
+// ?sort=tour_id they are listed by id instead.
+func (s *server) searchToursHandler(w http.ResponseWriter, r *http.Request) {
+	tours, computedAt := s.tourPopularity(s.tenant(r.Context()))
+	switch sortBy := r.URL.Query().Get("sort"); sortBy {
+	case "", "popularity":
+	case "tour_id":
+		sort.Slice(tours, func(i, j int) bool { return tours[i].TourID < tours[j].TourID })
+	default:
+		respondError(w, http.StatusBadRequest, "invalid_sort", "sort must be popularity or tour_id")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tours":       tours,
+		"computed_at": apitypes.JSONTime{Time: computedAt},
+	})
+}
+
+// putTourRatingHandler records a tour's catalogue rating for ranking.
+func (s *server) putTourRatingHandler(w http.ResponseWriter, r *http.Request) {
+	var req TourRating
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.ReviewCount < 0 || (req.ReviewCount > 0 && (req.Rating < 1 || req.Rating > maxTourRating)) {
+		respondError(w, http.StatusBadRequest, "invalid_rating", "rating must be from 1 to 5 and review_count must not be negative")
+		return
+	}
+	tourID := chi.URLParam(r, "tourId")
+	s.store.SetTourRating(tourID, req)
+	respondJSON(w, http.StatusOK, map[string]interface{}{"tour_id": tourID, "rating": req})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// seedTourBookings books n single-seat tours on tourID at the clock's
+// current time, paying for the first paid of them.
+func seedTourBookings(t *testing.T, s *server, tourID string, n, paid int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		b, err := s.store.AddBooking(Booking{Kind: KindTour, OfferingID: tourID, Date: "2026-06-01", PartySize: 1}, s.now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < paid {
+			s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+				b.PaymentRef = "pi_" + b.ID
+				return nil
+			})
+		}
+	}
+}
+
+func searchTours(t *testing.T, s *server, query string) []TourPopularity {
+	t.Helper()
+	var resp struct {
+		Tours []TourPopularity `json:"tours"`
+	}
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours"+query, nil, &resp); rec.Code != http.StatusOK {
+		t.Fatalf("search: status %d: %s", rec.Code, rec.Body)
+	}
+	return resp.Tours
+}
+
+func tourOrder(tours []TourPopularity) []string {
+	ids := make([]string, len(tours))
+	for i, p := range tours {
+		ids[i] = p.TourID
+	}
+	return ids
+}
+
+func TestRecentBookingsRankTourHigher(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.PopularityWindow = 30 * 24 * time.Hour
+	// Last season's favourite has fallen outside the window.
+	seedTourBookings(t, s, "coffee-farm", 10, 0)
+	clock.advance(45 * 24 * time.Hour)
+	seedTourBookings(t, s, "volcano-hike", 4, 0)
+	seedTourBookings(t, s, "surf-lesson", 1, 0)
+
+	tours := searchTours(t, s, "")
+	if got := tourOrder(tours); len(got) != 3 || got[0] != "volcano-hike" || got[1] != "surf-lesson" || got[2] != "coffee-farm" {
+		t.Fatalf("ranking %v, want volcano-hike, surf-lesson, coffee-farm", got)
+	}
+	if tours[0].BookingsPerDay != 0.13 || tours[2].BookingsPerDay != 0 {
+		t.Fatalf("velocity %+v", tours)
+	}
+}
+
+func TestPopularityScoreOrdering(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.PopularityWindow = 30 * 24 * time.Hour
+	s.cfg.StaffAPIKey = "staff-key"
+	// Equally booked: conversion breaks the tie before rating does.
+	seedTourBookings(t, s, "volcano-hike", 4, 3)
+	seedTourBookings(t, s, "lake-kayak", 4, 1)
+	seedTourBookings(t, s, "ruins-walk", 4, 1)
+	// One perfect review counts for less than many excellent ones.
+	for tour, rating := range map[string]TourRating{"lake-kayak": {4.8, 300}, "ruins-walk": {5, 1}} {
+		if rec := staffPut(t, s, "/api/bookings/tours/"+tour+"/rating", rating); rec.Code != http.StatusOK {
+			t.Fatalf("rate %s: status %d: %s", tour, rec.Code, rec.Body)
+		}
+	}
+
+	tours := searchTours(t, s, "")
+	if got := tourOrder(tours); len(got) != 3 || got[0] != "volcano-hike" || got[1] != "lake-kayak" || got[2] != "ruins-walk" {
+		t.Fatalf("ranking %v, want volcano-hike, lake-kayak, ruins-walk", got)
+	}
+	for i := 1; i < len(tours); i++ {
+		if tours[i].Score >= tours[i-1].Score {
+			t.Fatalf("scores not descending: %+v", tours)
+		}
+	}
+	if tours[0].ConversionRate != 75*apitypes.OnePercent || tours[1].Rating == nil || tours[1].Rating.ReviewCount != 300 {
+		t.Fatalf("signals %+v", tours)
+	}
+
+	if got := tourOrder(searchTours(t, s, "?sort=tour_id")); got[0] != "lake-kayak" || got[2] != "volcano-hike" {
+		t.Fatalf("sorted by id %v", got)
+	}
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours?sort=price", nil, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown sort: status %d, want 400", rec.Code)
+	}
+}
+
+func TestPopularityIsCachedUntilRefreshed(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.PopularityWindow = 30 * 24 * time.Hour
+	seedTourBookings(t, s, "volcano-hike", 2, 0)
+	searchTours(t, s, "")
+
+	seedTourBookings(t, s, "surf-lesson", 5, 0)
+	if got := tourOrder(searchTours(t, s, "")); len(got) != 1 {
+		t.Fatalf("ranking changed before a refresh: %v", got)
+	}
+	s.refreshPopularity()
+	if got := tourOrder(searchTours(t, s, "")); len(got) != 2 || got[0] != "surf-lesson" {
+		t.Fatalf("ranking after refresh %v, want surf-lesson first", got)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// GuestPreferences records how a guest wants to be contacted.
+type GuestPreferences struct {
+	Email   string  `json:"email"`
+	Phone   string  `json:"phone,omitempty"`
+	Channel Channel `json:"channel"`
+	// OptOuts lists the channel/category pairs the guest unsubscribed from.
+	OptOuts []OptOut `json:"opt_outs"`
+}
+
+// OptOut silences one category of message on one channel. An empty Channel
+// covers every channel.
+type OptOut struct {
+	Channel  Channel  `json:"channel,omitempty"`
+	Category Category `json:"category"`
+}
+
+func (p GuestPreferences) optedOut(ch Channel, cat Category) bool {
+	for _, o := range p.OptOuts {
+		if o.Category == cat && (o.Channel == ChannelNone || o.Channel == ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferenceStore holds guest contact preferences keyed by email address.
+type PreferenceStore struct {
+	mu    sync.RWMutex
+	prefs map[string]GuestPreferences
+}
+
+func NewPreferenceStore() *PreferenceStore {
+	return &PreferenceStore{prefs: make(map[string]GuestPreferences)}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Get returns the guest's preferences, defaulting to email.
+func (p *PreferenceStore) Get(email string) GuestPreferences {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.getLocked(normalizeEmail(email))
+}
+
+func (p *PreferenceStore) getLocked(key string) GuestPreferences {
+	if pref, ok := p.prefs[key]; ok {
+		pref.OptOuts = append([]OptOut{}, pref.OptOuts...)
+		return pref
+	}
+	return GuestPreferences{Email: key, Channel: ChannelEmail, OptOuts: []OptOut{}}
+}
+
+// Set replaces the guest's channel and phone, keeping their opt-outs.
+func (p *PreferenceStore) Set(pref GuestPreferences) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pref.Email = normalizeEmail(pref.Email)
+	pref.OptOuts = p.prefs[pref.Email].OptOuts
+	p.prefs[pref.Email] = pref
+}
+
+// AddOptOut records that the guest no longer wants a category of message.
+func (p *PreferenceStore) AddOptOut(email string, o OptOut) GuestPreferences {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := normalizeEmail(email)
+	pref, ok := p.prefs[key]
+	if !ok {
+		pref = GuestPreferences{Email: key, Channel: ChannelEmail}
+	}
+	for _, existing := range pref.OptOuts {
+		if existing == o {
+			return p.getLocked(key)
+		}
+	}
+	pref.OptOuts = append(pref.OptOuts, o)
+	p.prefs[key] = pref
+	return p.getLocked(key)
+}
+
+// unsubscribeSigner issues and verifies the tamper-proof tokens embedded in
+// unsubscribe and preferences links, so a link can only ever act for the
+// guest it was sent to.
+type unsubscribeSigner struct {
+	secret  []byte
+	baseURL string
+}
+
+func newUnsubscribeSigner(secret, baseURL string) *unsubscribeSigner {
+	return &unsubscribeSigner{secret: []byte(secret), baseURL: baseURL}
+}
+
+type unsubscribeClaims struct {
+	Email    string   `json:"e"`
+	Category Category `json:"c"`
+	Channel  Channel  `json:"ch,omitempty"`
+	// Purpose is purposePreferences on a preferences token and empty on an
+	// unsubscribe one, so neither is accepted in place of the other.
+	Purpose string `json:"p,omitempty"`
+}
+
+const purposePreferences = "preferences"
+
+func (u *unsubscribeSigner) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, u.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (u *unsubscribeSigner) token(email string, cat Category, ch Channel) string {
+	return u.encode(unsubscribeClaims{Email: normalizeEmail(email), Category: cat, Channel: ch})
+}
+
+// preferencesToken lets the guest at email change their contact
+// preferences.
+func (u *unsubscribeSigner) preferencesToken(email string) string {
+	return u.encode(unsubscribeClaims{Email: normalizeEmail(email), Purpose: purposePreferences})
+}
+
+func (u *unsubscribeSigner) encode(claims unsubscribeClaims) string {
+	payload, _ := json.Marshal(claims)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(u.sign(payload))
+}
+
+func (u *unsubscribeSigner) link(email string, cat Category, ch Channel) string {
+	return u.baseURL + "/unsubscribe?token=" + u.token(email, cat, ch)
+}
+
+func (u *unsubscribeSigner) preferencesLink(email string) string {
+	return u.baseURL + "/preferences/" + url.PathEscape(normalizeEmail(email)) + "?token=" + u.preferencesToken(email)
+}
+
+var errBadUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+func (u *unsubscribeSigner) verify(token string) (unsubscribeClaims, error) {
+	var claims unsubscribeClaims
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, errBadUnsubscribeToken
+	}
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil {
+		return claims, errBadUnsubscribeToken
+	}
+	sig, err := enc.DecodeString(sigPart)
+	if err != nil || !hmac.Equal(sig, u.sign(payload)) {
+		return claims, errBadUnsubscribeToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Email == "" {
+		return claims, errBadUnsubscribeToken
+	}
+	return claims, nil
+}
+
+// unsubscribeHandler applies the opt-out carried by a signed unsubscribe
+// link. Transactional messages cannot be unsubscribed from.
+func (s *server) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.unsubscribe.verify(r.URL.Query().Get("token"))
+	if err != nil || claims.Purpose != "" {
+		respondError(w, http.StatusForbidden, "invalid_token", "unsubscribe link is invalid")
+		return
+	}
+	if claims.Category != CategoryMarketing {
+		respondError(w, http.StatusUnprocessableEntity, "not_unsubscribable", "only marketing messages can be unsubscribed from")
+		return
+	}
+	pref := s.prefs.AddOptOut(claims.Email, OptOut{Channel: claims.Channel, Category: claims.Category})
+	respondJSON(w, http.StatusOK, pref)
+}
+
+// putPreferencesHandler sets a guest's contact channel and phone. Staff may
+// set anyone's; a guest needs the signed token from their preferences link.
+func (s *server) putPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	email := chi.URLParam(r, "email")
+	if !s.hasRole(r, roleStaff) {
+		claims, err := s.unsubscribe.verify(r.URL.Query().Get("token"))
+		if err != nil || claims.Purpose != purposePreferences || claims.Email != normalizeEmail(email) {
+			respondError(w, http.StatusForbidden, "invalid_token", "a preferences link or staff credentials are required")
+			return
+		}
+	}
+	var req struct {
+		Phone   string  `json:"phone"`
+		Channel Channel `json:"channel"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	switch req.Channel {
+	case ChannelEmail:
+	case ChannelSMS:
+		if !validE164(req.Phone) {
+			respondError(w, http.StatusUnprocessableEntity, "invalid_phone", "phone must be in E.164 format, e.g. +50370001234")
+			return
+		}
+	default:
+		respondError(w, http.StatusUnprocessableEntity, "invalid_channel", "channel must be email or sms")
+		return
+	}
+	if req.Phone != "" && !validE164(req.Phone) {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_phone", "phone must be in E.164 format, e.g. +50370001234")
+		return
+	}
+
+	pref := GuestPreferences{Email: email, Phone: req.Phone, Channel: req.Channel}
+	s.prefs.Set(pref)
+	respondJSON(w, http.StatusOK, s.prefs.Get(pref.Email))
+}
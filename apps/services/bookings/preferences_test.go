@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMarketingOptOutStillGetsConfirmation(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.prefs.AddOptOut("ana@example.com", OptOut{Category: CategoryMarketing})
+	b := Booking{ID: "b-1", Kind: KindTour, Date: "2026-03-14", PartySize: 2, GuestEmail: "ana@example.com"}
+
+	ch, err := s.notifier.Send(context.Background(), Notification{Template: TemplateBookingReminder, Booking: b})
+	if err != nil || ch != ChannelNone {
+		t.Fatalf("reminder Send = %q, %v; want suppressed", ch, err)
+	}
+	ch, err = s.notifier.Send(context.Background(), Notification{Template: TemplateBookingConfirmed, Booking: b})
+	if err != nil || ch != ChannelEmail {
+		t.Fatalf("confirmation Send = %q, %v; want email", ch, err)
+	}
+
+	ob := sentMessages(s)
+	if len(ob.emails) != 1 || ob.emails[0].Subject != "Your booking is confirmed" {
+		t.Fatalf("emails = %+v, want only the confirmation", ob.emails)
+	}
+}
+
+func TestSMSOptOutMovesMarketingToEmail(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.prefs.Set(GuestPreferences{Email: "ana@example.com", Phone: "+50370001234", Channel: ChannelSMS})
+	s.prefs.AddOptOut("ana@example.com", OptOut{Channel: ChannelSMS, Category: CategoryMarketing})
+
+	b := Booking{ID: "b-1", Kind: KindTour, GuestEmail: "ana@example.com"}
+	ch, _ := s.notifier.Send(context.Background(), Notification{Template: TemplateBookingReminder, Booking: b})
+	if ch != ChannelEmail {
+		t.Fatalf("channel %q, want email", ch)
+	}
+	if body := sentMessages(s).emails[0].Body; !strings.Contains(body, "/unsubscribe?token=") || !strings.Contains(body, "/preferences/ana@example.com?token=") {
+		t.Fatalf("marketing email lacks unsubscribe and preferences links: %q", body)
+	}
+}
+
+func TestUnsubscribeLink(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	token := s.unsubscribe.token("Ana@example.com", CategoryMarketing, ChannelNone)
+
+	rec := doJSON(t, h, http.MethodPost, "/api/bookings/unsubscribe?token="+token, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if !s.prefs.Get("ana@example.com").optedOut(ChannelEmail, CategoryMarketing) {
+		t.Fatal("guest not opted out of marketing")
+	}
+
+	tampered := s.unsubscribe.token("ana@example.com", CategoryMarketing, ChannelNone)
+	tampered = strings.Replace(tampered, tampered[:4], "AAAA", 1)
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/unsubscribe?token="+tampered, nil, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("tampered token: status %d, want 403", rec.Code)
+	}
+
+	transactional := s.unsubscribe.token("ana@example.com", CategoryTransactional, ChannelNone)
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/unsubscribe?token="+transactional, nil, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("transactional unsubscribe: status %d, want 422", rec.Code)
+	}
+}
+
+func TestPreferencesNeedTheGuestsTokenOrStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	sms := map[string]string{"channel": "sms", "phone": "+50370001234"}
+	path := "/api/bookings/guests/ana@example.com/preferences"
+
+	for name, token := range map[string]string{
+		"no token":           "",
+		"another guest's":    s.unsubscribe.preferencesToken("beto@example.com"),
+		"an unsubscribe one": s.unsubscribe.token("ana@example.com", CategoryMarketing, ChannelNone),
+	} {
+		if rec := doJSON(t, h, http.MethodPut, path+"?token="+token, sms, nil); rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: status %d, want 403", name, rec.Code)
+		}
+	}
+	if got := s.prefs.Get("ana@example.com"); got.Channel != ChannelEmail {
+		t.Fatalf("refused updates changed preferences: %+v", got)
+	}
+
+	if rec := doJSON(t, h, http.MethodPut, path+"?token="+s.unsubscribe.preferencesToken("Ana@example.com"), sms, nil); rec.Code != http.StatusOK {
+		t.Fatalf("guest's token: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doStaff(t, h, http.MethodPut, path, map[string]string{"channel": "email"}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("staff: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// A preferences token cannot unsubscribe the guest.
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/unsubscribe?token="+s.unsubscribe.preferencesToken("ana@example.com"), nil, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("preferences token as unsubscribe: status %d, want 403", rec.Code)
+	}
+}
+
+func TestUnsubscribeSecretRequiredOutsideDevelopment(t *testing.T) {
+	if got, err := resolveUnsubscribeSecret("", "development"); err != nil || got != devUnsubscribeSecret {
+		t.Fatalf("development without a secret = %q, %v; want the development secret", got, err)
+	}
+	for _, env := range []string{"", "production", "staging"} {
+		for _, secret := range []string{"", devUnsubscribeSecret} {
+			if _, err := resolveUnsubscribeSecret(secret, env); err == nil {
+				t.Errorf("NODE_ENV=%q with secret %q accepted", env, secret)
+			}
+		}
+	}
+	if got, err := resolveUnsubscribeSecret("s3cret", "production"); err != nil || got != "s3cret" {
+		t.Fatalf("production with a secret = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// Price is an amount quoted by the pricing service.
+type Price struct {
+	AmountCents int64  `json:"price_cents"`
+	Currency    string `json:"currency"`
+}
+
+// PricingClient is the bookings service's view of the pricing service.
+type PricingClient interface {
+	// TourPrice quotes a party of partySize on one tour departure.
+	TourPrice(ctx context.Context, tourID, date, slot string, partySize int) (Price, error)
+}
+
+// httpPricingClient talks to the pricing service over its REST API.
+type httpPricingClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newHTTPPricingClient(baseURL string) *httpPricingClient {
+	return &httpPricingClient{baseURL: baseURL, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *httpPricingClient) TourPrice(ctx context.Context, tourID, date, slot string, partySize int) (Price, error) {
+	q := url.Values{"date": {date}, "party_size": {strconv.Itoa(partySize)}}
+	if slot != "" {
+		q.Set("slot", slot)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/pricing/tour/"+url.PathEscape(tourID)+"?"+q.Encode(), nil)
+	if err != nil {
+		return Price{}, err
+	}
+	httpkit.PropagateRequestID(ctx, req)
+	tenantkit.Propagate(ctx, req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Price{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Price{}, fmt.Errorf("pricing: unexpected status %d", resp.StatusCode)
+	}
+	var p Price
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return Price{}, fmt.Errorf("pricing: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrPromoNotFound   = errors.New("promo code not found")
+	ErrPromoNotValidOn = errors.New("promo code does not apply to this offering")
+)
+
+// OfferingAddOn is an extra an offering sells, priced per unit.
+type OfferingAddOn struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	PriceCents int64  `json:"price_cents"`
+}
+
+// AddOnCatalog lists the add-ons an offering sells.
+type AddOnCatalog struct {
+	OfferingID string          `json:"offering_id"`
+	AddOns     []OfferingAddOn `json:"add_ons"`
+}
+
+func (c AddOnCatalog) validate() error {
+	seen := make(map[string]bool, len(c.AddOns))
+	for _, a := range c.AddOns {
+		if a.Code == "" || a.Name == "" {
+			return errors.New("every add-on needs a code and a name")
+		}
+		if seen[a.Code] {
+			return fmt.Errorf("add-on %q is listed twice", a.Code)
+		}
+		seen[a.Code] = true
+		if a.PriceCents < 0 {
+			return fmt.Errorf("add-on %q: price_cents must not be negative", a.Code)
+		}
+	}
+	return nil
+}
+
+func (c AddOnCatalog) find(code string) (OfferingAddOn, bool) {
+	for _, a := range c.AddOns {
+		if a.Code == code {
+			return a, true
+		}
+	}
+	return OfferingAddOn{}, false
+}
+
+// PromoCode is a marketing code. It may take a percentage or a fixed amount
+// off, grant add-ons for free, or both, as in "free lunch + 10% off". A code
+// with an OfferingID only applies to that offering.
+type PromoCode struct {
+	Code           string           `json:"code"`
+	OfferingID     string           `json:"offering_id,omitempty"`
+	Discount       apitypes.Percent `json:"discount,omitempty"`
+	AmountOffCents int64            `json:"amount_off_cents,omitempty"`
+	// FreeAddOns are included at no charge. A zero quantity means one per
+	// guest.
+	FreeAddOns []AddOn `json:"free_add_ons,omitempty"`
+}
+
+// validate checks the code on its own and, when it is tied to an offering,
+// that every free add-on is one that offering sells.
+func (p PromoCode) validate(catalog AddOnCatalog) error {
+	if p.Code == "" {
+		return errors.New("code is required")
+	}
+	if p.Discount < 0 || p.Discount > apitypes.HundredPercent {
+		return errors.New("discount must be between 0% and 100%")
+	}
+	if p.AmountOffCents < 0 {
+		return errors.New("amount_off_cents must not be negative")
+	}
+	if p.Discount > 0 && p.AmountOffCents > 0 {
+		return errors.New("use either discount or amount_off_cents, not both")
+	}
+	if p.Discount == 0 && p.AmountOffCents == 0 && len(p.FreeAddOns) == 0 {
+		return errors.New("a promo code must discount or include an add-on")
+	}
+	for _, a := range p.FreeAddOns {
+		if a.Quantity < 0 {
+			return fmt.Errorf("free add-on %q: quantity must not be negative", a.Code)
+		}
+		if p.OfferingID != "" {
+			if _, ok := catalog.find(a.Code); !ok {
+				return fmt.Errorf("free add-on %q is not sold with offering %s", a.Code, p.OfferingID)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizePromoCode makes codes case-insensitive.
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// PricedAddOn is one add-on line of a breakdown. FreeQuantity of Quantity
+// came with a promo code and is not charged.
+type PricedAddOn struct {
+	Code         string `json:"code"`
+	Name         string `json:"name"`
+	Quantity     int    `json:"quantity"`
+	FreeQuantity int    `json:"free_quantity,omitempty"`
+	UnitCents    int64  `json:"unit_cents"`
+	AmountCents  int64  `json:"amount_cents"`
+}
+
+// PriceBreakdown itemises what a party pays. TotalCents always equals
+// BaseCents plus every add-on's AmountCents minus DiscountCents.
+type PriceBreakdown struct {
+	BaseCents     int64         `json:"base_cents"`
+	AddOns        []PricedAddOn `json:"add_ons"`
+	SubtotalCents int64         `json:"subtotal_cents"`
+	PromoCode     string        `json:"promo_code,omitempty"`
+	DiscountCents int64         `json:"discount_cents"`
+	TotalCents    int64         `json:"total_cents"`
+	Currency      string        `json:"currency"`
+}
+
+// priceAddOns builds a breakdown from a base price and the add-ons the
+// guest chose, including any the promo grants. Free units cover chosen ones
+// first so nothing is charged twice; the monetary discount then comes off
+// everything still charged.
+func priceAddOns(base Price, partySize int, chosen []AddOn, catalog AddOnCatalog, promo *PromoCode) (PriceBreakdown, error) {
+	pb := PriceBreakdown{BaseCents: base.AmountCents, AddOns: []PricedAddOn{}, Currency: base.Currency}
+	lines := make(map[string]*PricedAddOn)
+	var order []string
+	line := func(code string) (*PricedAddOn, error) {
+		if l, ok := lines[code]; ok {
+			return l, nil
+		}
+		a, ok := catalog.find(code)
+		if !ok {
+			return nil, fmt.Errorf("add-on %q is not sold with offering %s", code, catalog.OfferingID)
+		}
+		lines[code] = &PricedAddOn{Code: a.Code, Name: a.Name, UnitCents: a.PriceCents}
+		order = append(order, code)
+		return lines[code], nil
+	}
+	for _, a := range chosen {
+		if a.Quantity < 1 {
+			return PriceBreakdown{}, fmt.Errorf("add-on %q: quantity must be at least 1", a.Code)
+		}
+		l, err := line(a.Code)
+		if err != nil {
+			return PriceBreakdown{}, err
+		}
+		l.Quantity += a.Quantity
+	}
+	if promo != nil {
+		pb.PromoCode = promo.Code
+		for _, a := range promo.FreeAddOns {
+			l, err := line(a.Code)
+			if err != nil {
+				return PriceBreakdown{}, err
+			}
+			free := a.Quantity
+			if free == 0 {
+				free = partySize
+			}
+			l.FreeQuantity += free
+			l.Quantity = max(l.Quantity, l.FreeQuantity)
+		}
+	}
+
+	pb.SubtotalCents = pb.BaseCents
+	for _, code := range order {
+		l := lines[code]
+		l.AmountCents = int64(l.Quantity-l.FreeQuantity) * l.UnitCents
+		pb.SubtotalCents += l.AmountCents
+		pb.AddOns = append(pb.AddOns, *l)
+	}
+	if promo != nil {
+		pb.DiscountCents = min(promo.Discount.Of(pb.SubtotalCents)+promo.AmountOffCents, pb.SubtotalCents)
+	}
+	pb.TotalCents = pb.SubtotalCents - pb.DiscountCents
+	return pb, nil
+}
+
+// SetAddOns replaces the add-ons sold with an offering.
+func (s *Store) SetAddOns(c AddOnCatalog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addOns[c.OfferingID] = c
+}
+
+// AddOns returns the add-ons sold with an offering, which may be none.
+func (s *Store) AddOns(offeringID string) AddOnCatalog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.addOns[offeringID]
+	if !ok {
+		return AddOnCatalog{OfferingID: offeringID, AddOns: []OfferingAddOn{}}
+	}
+	return c
+}
+
+// PutPromoCode creates or replaces a promo code, checking any free add-ons
+// against its offering's catalog.
+func (s *Store) PutPromoCode(p PromoCode) (PromoCode, error) {
+	p.Code = normalizePromoCode(p.Code)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := p.validate(s.addOns[p.OfferingID]); err != nil {
+		return PromoCode{}, err
+	}
+	p.FreeAddOns = append([]AddOn(nil), p.FreeAddOns...)
+	s.promoCodes[p.Code] = p
+	return p, nil
+}
+
+// PromoCode looks up a code for an offering.
+func (s *Store) PromoCode(code, offeringID string) (PromoCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.promoCodes[normalizePromoCode(code)]
+	if !ok {
+		return PromoCode{}, ErrPromoNotFound
+	}
+	if p.OfferingID != "" && p.OfferingID != offeringID {
+		return PromoCode{}, ErrPromoNotValidOn
+	}
+	p.FreeAddOns = append([]AddOn(nil), p.FreeAddOns...)
+	return p, nil
+}
+
+func (s *server) putAddOnsHandler(w http.ResponseWriter, r *http.Request) {
+	var c AddOnCatalog
+	if err := httpkit.DecodeJSON(r, &c); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	c.OfferingID = chi.URLParam(r, "offeringId")
+	if c.AddOns == nil {
+		c.AddOns = []OfferingAddOn{}
+	}
+	if err := c.validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_add_ons", err.Error())
+		return
+	}
+	s.store.SetAddOns(c)
+	respondJSON(w, http.StatusOK, c)
+}
+
+func (s *server) getAddOnsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.store.AddOns(chi.URLParam(r, "offeringId")))
+}
+
+func (s *server) putPromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var p PromoCode
+	if err := httpkit.DecodeJSON(r, &p); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	p.Code = chi.URLParam(r, "code")
+	p, err := s.store.PutPromoCode(p)
+	if err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_promo_code", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+// quoteTourHandler prices a party on a departure with its chosen add-ons
+// and an optional promo code.
+func (s *server) quoteTourHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Date      string  `json:"date"`
+		Slot      string  `json:"slot"`
+		PartySize int     `json:"party_size"`
+		AddOns    []AddOn `json:"add_ons"`
+		PromoCode string  `json:"promo_code"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.Date == "" || req.PartySize < 1 {
+		respondError(w, http.StatusBadRequest, "invalid_quote", "date and a positive party_size are required")
+		return
+	}
+	pb, ok := s.priceTourBooking(w, r, chi.URLParam(r, "tourId"), req.Date, req.Slot, req.PartySize, req.AddOns, req.PromoCode)
+	if ok {
+		respondJSON(w, http.StatusOK, pb)
+	}
+}
+
+// priceTourBooking prices a party on a departure with add-ons and an
+// optional promo code. On failure it writes the error response and returns
+// false.
+func (s *server) priceTourBooking(w http.ResponseWriter, r *http.Request, tourID, date, slot string, partySize int, addOns []AddOn, promoCode string) (PriceBreakdown, bool) {
+	var promo *PromoCode
+	if promoCode != "" {
+		p, err := s.store.PromoCode(promoCode, tourID)
+		if err != nil {
+			respondError(w, http.StatusUnprocessableEntity, "invalid_promo_code", err.Error())
+			return PriceBreakdown{}, false
+		}
+		promo = &p
+	}
+	price, err := s.pricing.TourPrice(r.Context(), tourID, date, slot, partySize)
+	if err != nil {
+		log.Printf("pricing tour %s on %s failed: %v", tourID, date, err)
+		respondError(w, http.StatusBadGateway, "pricing_unavailable", "could not price the departure")
+		return PriceBreakdown{}, false
+	}
+	pb, err := priceAddOns(price, partySize, addOns, s.store.AddOns(tourID), promo)
+	if err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_add_ons", err.Error())
+		return PriceBreakdown{}, false
+	}
+	return pb, true
+}
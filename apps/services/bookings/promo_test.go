@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func seedAddOns(s *server) {
+	s.store.SetAddOns(AddOnCatalog{OfferingID: "volcano-hike", AddOns: []OfferingAddOn{
+		{Code: "lunch", Name: "Pupusa lunch", PriceCents: 1200},
+		{Code: "poles", Name: "Trekking poles", PriceCents: 500},
+	}})
+}
+
+func putPromoCode(t *testing.T, s *server, code string, body PromoCode) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(body)
+	req := httptest.NewRequest(http.MethodPut, "/api/bookings/promo-codes/"+code, &buf)
+	req.Header.Set("Authorization", "Bearer staff-key")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPutAddOnsRequiresStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	seedAddOns(s)
+	cheap := AddOnCatalog{AddOns: []OfferingAddOn{{Code: "lunch", Name: "Pupusa lunch", PriceCents: 1}}}
+	if rec := doJSON(t, h, http.MethodPut, "/api/bookings/offerings/volcano-hike/add-ons", cheap, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without credentials: status %d, want 401", rec.Code)
+	}
+	if got := s.store.AddOns("volcano-hike"); len(got.AddOns) != 2 || got.AddOns[0].PriceCents != 1200 {
+		t.Fatalf("unauthorised call changed the catalog: %+v", got)
+	}
+	if rec := doStaff(t, h, http.MethodPut, "/api/bookings/offerings/volcano-hike/add-ons", cheap, nil); rec.Code != http.StatusOK {
+		t.Fatalf("staff: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := s.store.AddOns("volcano-hike"); len(got.AddOns) != 1 || got.AddOns[0].PriceCents != 1 {
+		t.Fatalf("catalog = %+v", got)
+	}
+}
+
+func TestPromoCodeGrantsFreeAddOnAndDiscountsTheRest(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	seedAddOns(s)
+	if rec := putPromoCode(t, s, "lunch10", PromoCode{
+		OfferingID: "volcano-hike",
+		Discount:   10 * apitypes.OnePercent,
+		FreeAddOns: []AddOn{{Code: "lunch"}},
+	}); rec.Code != http.StatusOK {
+		t.Fatalf("put promo: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Two guests at 45.00 each; they also ask for lunch, which the code
+	// already includes, and one set of poles.
+	var pb PriceBreakdown
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours/volcano-hike/quote", map[string]interface{}{
+		"date":       "2026-03-14",
+		"party_size": 2,
+		"add_ons":    []AddOn{{Code: "lunch", Quantity: 2}, {Code: "poles", Quantity: 1}},
+		"promo_code": "LUNCH10",
+	}, &pb)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(pb.AddOns) != 2 {
+		t.Fatalf("add-ons = %+v", pb.AddOns)
+	}
+	lunch, poles := pb.AddOns[0], pb.AddOns[1]
+	if lunch.Code != "lunch" || lunch.Quantity != 2 || lunch.FreeQuantity != 2 || lunch.AmountCents != 0 {
+		t.Errorf("lunch = %+v, want two free lunches at zero cost", lunch)
+	}
+	if poles.AmountCents != 500 {
+		t.Errorf("poles = %+v, want charged 500", poles)
+	}
+	// 10% off 9000 + 500, the lunches not counted.
+	if pb.SubtotalCents != 9500 || pb.DiscountCents != 950 || pb.TotalCents != 8550 {
+		t.Errorf("subtotal %d discount %d total %d, want 9500 950 8550", pb.SubtotalCents, pb.DiscountCents, pb.TotalCents)
+	}
+	if pb.PromoCode != "LUNCH10" {
+		t.Errorf("promo code = %q", pb.PromoCode)
+	}
+}
+
+func TestPromoCodeAddsFreeAddOnGuestDidNotChoose(t *testing.T) {
+	s, _ := newTestServer(t)
+	seedAddOns(s)
+	if _, err := s.store.PutPromoCode(PromoCode{Code: "poles", OfferingID: "volcano-hike", FreeAddOns: []AddOn{{Code: "poles", Quantity: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	pb, err := priceAddOns(Price{AmountCents: 4500, Currency: "USD"}, 1, nil, s.store.AddOns("volcano-hike"), ptrPromo(t, s, "poles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pb.AddOns) != 1 || pb.AddOns[0].Quantity != 1 || pb.AddOns[0].AmountCents != 0 || pb.TotalCents != 4500 {
+		t.Fatalf("breakdown = %+v, want poles included for free", pb)
+	}
+}
+
+func ptrPromo(t *testing.T, s *server, code string) *PromoCode {
+	t.Helper()
+	p, err := s.store.PromoCode(code, "volcano-hike")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &p
+}
+
+func TestPromoCodeRejectsAddOnTheTourDoesNotSell(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	seedAddOns(s)
+	rec := putPromoCode(t, s, "surf", PromoCode{OfferingID: "volcano-hike", FreeAddOns: []AddOn{{Code: "surfboard"}}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
+
+func TestPromoCodeLimitedToItsOffering(t *testing.T) {
+	s, _ := newTestServer(t)
+	seedAddOns(s)
+	s.store.PutPromoCode(PromoCode{Code: "volcano10", OfferingID: "volcano-hike", Discount: 10 * apitypes.OnePercent})
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours/lake-kayak/quote", map[string]interface{}{
+		"date": "2026-03-14", "party_size": 1, "promo_code": "volcano10",
+	}, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// QuestionType is the kind of answer a booking question expects.
+type QuestionType string
+
+const (
+	QuestionText        QuestionType = "text"
+	QuestionNumber      QuestionType = "number"
+	QuestionBoolean     QuestionType = "boolean"
+	QuestionChoice      QuestionType = "choice"
+	QuestionMultiChoice QuestionType = "multi_choice"
+)
+
+// Question is something an operator needs to know from a guest before a
+// tour or stay, such as dietary needs or an arrival flight. Choice
+// questions must be answered from Options.
+type Question struct {
+	ID       string       `json:"id"`
+	Label    string       `json:"label"`
+	Type     QuestionType `json:"type"`
+	Required bool         `json:"required"`
+	Options  []string     `json:"options,omitempty"`
+}
+
+// QuestionSchema is the ordered list of questions asked for an offering.
+type QuestionSchema struct {
+	OfferingID string     `json:"offering_id"`
+	Questions  []Question `json:"questions"`
+}
+
+func (q Question) hasOptions() bool {
+	return q.Type == QuestionChoice || q.Type == QuestionMultiChoice
+}
+
+func (qs QuestionSchema) validate() error {
+	seen := make(map[string]bool)
+	for _, q := range qs.Questions {
+		if q.ID == "" || q.Label == "" {
+			return fmt.Errorf("every question needs an id and a label")
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("question %q is listed twice", q.ID)
+		}
+		seen[q.ID] = true
+		switch q.Type {
+		case QuestionText, QuestionNumber, QuestionBoolean, QuestionChoice, QuestionMultiChoice:
+		default:
+			return fmt.Errorf("question %q has unknown type %q", q.ID, q.Type)
+		}
+		if q.hasOptions() != (len(q.Options) > 0) {
+			return fmt.Errorf("question %q: options are required for choice questions and only allowed there", q.ID)
+		}
+	}
+	return nil
+}
+
+// AnswerError explains why an answer was refused.
+type AnswerError struct {
+	QuestionID string
+	Reason     string
+}
+
+func (e *AnswerError) Error() string {
+	return fmt.Sprintf("question %q: %s", e.QuestionID, e.Reason)
+}
+
+// checkAnswers validates raw answers against the schema and returns them
+// decoded: strings for text and choice, float64 for numbers, bool and
+// []string for multiple choice. Every required question must be answered
+// and no answer may be given to a question the schema does not ask.
+func (qs QuestionSchema) checkAnswers(raw map[string]json.RawMessage) (map[string]interface{}, error) {
+	answers := make(map[string]interface{}, len(raw))
+	asked := make(map[string]bool, len(qs.Questions))
+	for _, q := range qs.Questions {
+		asked[q.ID] = true
+		msg, ok := raw[q.ID]
+		if !ok || bytes.Equal(msg, []byte("null")) {
+			if q.Required {
+				return nil, &AnswerError{q.ID, "is required"}
+			}
+			continue
+		}
+		v, err := q.decode(msg)
+		if err != nil {
+			return nil, err
+		}
+		answers[q.ID] = v
+	}
+	for id := range raw {
+		if !asked[id] {
+			return nil, &AnswerError{id, "is not asked for this offering"}
+		}
+	}
+	return answers, nil
+}
+
+func (q Question) decode(msg json.RawMessage) (interface{}, error) {
+	var (
+		v   interface{}
+		err error
+	)
+	switch q.Type {
+	case QuestionNumber:
+		var n float64
+		err = json.Unmarshal(msg, &n)
+		v = n
+	case QuestionBoolean:
+		var b bool
+		err = json.Unmarshal(msg, &b)
+		v = b
+	case QuestionMultiChoice:
+		var picks []string
+		if err = json.Unmarshal(msg, &picks); err == nil {
+			for _, p := range picks {
+				if !q.allows(p) {
+					return nil, &AnswerError{q.ID, fmt.Sprintf("%q is not one of the options", p)}
+				}
+			}
+			if q.Required && len(picks) == 0 {
+				return nil, &AnswerError{q.ID, "is required"}
+			}
+		}
+		v = picks
+	default:
+		var s string
+		if err = json.Unmarshal(msg, &s); err == nil {
+			s = strings.TrimSpace(s)
+			if q.Type == QuestionChoice && !q.allows(s) {
+				return nil, &AnswerError{q.ID, fmt.Sprintf("%q is not one of the options", s)}
+			}
+			if q.Required && s == "" {
+				return nil, &AnswerError{q.ID, "is required"}
+			}
+		}
+		v = s
+	}
+	if err != nil {
+		return nil, &AnswerError{q.ID, "must be a " + q.typeName()}
+	}
+	return v, nil
+}
+
+func (q Question) allows(option string) bool {
+	for _, o := range q.Options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func (q Question) typeName() string {
+	switch q.Type {
+	case QuestionNumber:
+		return "number"
+	case QuestionBoolean:
+		return "boolean"
+	case QuestionMultiChoice:
+		return "list of options"
+	default:
+		return "string"
+	}
+}
+
+// BookingAnswer is one answered question as an operator reads it.
+type BookingAnswer struct {
+	QuestionID string `json:"question_id"`
+	Question   string `json:"question"`
+	Answer     string `json:"answer"`
+}
+
+// formatAnswers lists b's answers in schema order, skipping questions that
+// are unanswered or no longer asked.
+func (qs QuestionSchema) formatAnswers(answers map[string]interface{}) []BookingAnswer {
+	out := []BookingAnswer{}
+	for _, q := range qs.Questions {
+		v, ok := answers[q.ID]
+		if !ok {
+			continue
+		}
+		var text string
+		switch v := v.(type) {
+		case bool:
+			text = "no"
+			if v {
+				text = "yes"
+			}
+		case float64:
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		case []string:
+			text = strings.Join(v, ", ")
+		case string:
+			text = v
+		}
+		out = append(out, BookingAnswer{QuestionID: q.ID, Question: q.Label, Answer: text})
+	}
+	return out
+}
+
+// SetQuestions replaces the questions asked for an offering. Answers
+// already given are kept.
+func (s *Store) SetQuestions(qs QuestionSchema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.questions[qs.OfferingID] = qs
+}
+
+// Questions returns the questions asked for an offering, which may be
+// none.
+func (s *Store) Questions(offeringID string) QuestionSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.questionsLocked(offeringID)
+}
+
+func (s *Store) questionsLocked(offeringID string) QuestionSchema {
+	qs, ok := s.questions[offeringID]
+	if !ok {
+		return QuestionSchema{OfferingID: offeringID, Questions: []Question{}}
+	}
+	return qs
+}
+
+// AnswerQuestions validates a guest's answers against their offering's
+// questions and stores them on the booking, replacing earlier answers.
+func (s *Store) AnswerQuestions(id string, raw map[string]json.RawMessage, now time.Time) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	switch b.Status {
+	case StatusPending, StatusPendingApproval, StatusConfirmed:
+	default:
+		return Booking{}, ErrInvalidTransition
+	}
+	answers, err := s.questionsLocked(b.OfferingID).checkAnswers(raw)
+	if err != nil {
+		return Booking{}, err
+	}
+	b.Answers = answers
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	return *b, nil
+}
+
+func (s *server) putQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+	var qs QuestionSchema
+	if err := httpkit.DecodeJSON(r, &qs); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	qs.OfferingID = chi.URLParam(r, "offeringId")
+	if qs.Questions == nil {
+		qs.Questions = []Question{}
+	}
+	if err := qs.validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_questions", err.Error())
+		return
+	}
+	s.store.SetQuestions(qs)
+	respondJSON(w, http.StatusOK, qs)
+}
+
+func (s *server) getQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.store.Questions(chi.URLParam(r, "offeringId")))
+}
+
+// putAnswersHandler records a guest's answers to their offering's booking
+// questions. Body: {"answers": {"<question id>": <value>, ...}}.
+func (s *server) putAnswersHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Answers map[string]json.RawMessage `json:"answers"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	b, err := s.store.AnswerQuestions(chi.URLParam(r, "bookingId"), req.Answers, s.now())
+	var ae *AnswerError
+	if errors.As(err, &ae) {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_answers", ae.Error())
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, b)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func putTourQuestions(t *testing.T, s *server) {
+	t.Helper()
+	rec := doStaff(t, s.routes(), http.MethodPut, "/api/bookings/offerings/volcano-hike/questions", map[string]interface{}{
+		"questions": []map[string]interface{}{
+			{"id": "diet", "label": "Dietary needs", "type": "choice", "required": true, "options": []string{"none", "vegetarian", "vegan"}},
+			{"id": "flight", "label": "Arrival flight", "type": "text"},
+			{"id": "surfers", "label": "Number of surfers", "type": "number", "required": true},
+			{"id": "gear", "label": "Gear", "type": "multi_choice", "options": []string{"board", "wetsuit"}},
+		},
+	}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put questions: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func putAnswers(t *testing.T, s *server, id string, answers map[string]interface{}) (Booking, map[string]string, int) {
+	t.Helper()
+	rec := doJSON(t, s.routes(), http.MethodPut, "/api/bookings/"+id+"/answers", map[string]interface{}{"answers": answers}, nil)
+	var b Booking
+	var e map[string]string
+	if rec.Code == http.StatusOK {
+		json.Unmarshal(rec.Body.Bytes(), &b)
+	} else {
+		json.Unmarshal(rec.Body.Bytes(), &e)
+	}
+	return b, e, rec.Code
+}
+
+func TestAnswersEnforceRequiredQuestions(t *testing.T) {
+	s, _ := newTestServer(t)
+	putTourQuestions(t, s)
+	b := seedPendingTour(t, s, 2)
+
+	_, e, code := putAnswers(t, s, b.ID, map[string]interface{}{"diet": "vegan", "flight": "AV 123"})
+	if code != http.StatusUnprocessableEntity || e["error"] != "invalid_answers" || !strings.Contains(e["message"], `"surfers": is required`) {
+		t.Fatalf("missing required: status %d, %v", code, e)
+	}
+	_, e, code = putAnswers(t, s, b.ID, map[string]interface{}{"diet": "vegan", "surfers": nil})
+	if code != http.StatusUnprocessableEntity || !strings.Contains(e["message"], "surfers") {
+		t.Fatalf("null required: status %d, %v", code, e)
+	}
+
+	got, _, code := putAnswers(t, s, b.ID, map[string]interface{}{"diet": "vegan", "surfers": 2, "gear": []string{"board"}})
+	if code != http.StatusOK {
+		t.Fatalf("valid answers: status %d", code)
+	}
+	if got.Answers["diet"] != "vegan" || got.Answers["surfers"] != 2.0 || len(got.Answers) != 3 {
+		t.Fatalf("answers = %v", got.Answers)
+	}
+	if stored, _ := s.store.Booking(b.ID); stored.Answers["diet"] != "vegan" {
+		t.Fatalf("stored answers = %v", stored.Answers)
+	}
+}
+
+func TestAnswersRejectInvalidOptionsAndTypes(t *testing.T) {
+	s, _ := newTestServer(t)
+	putTourQuestions(t, s)
+	b := seedPendingTour(t, s, 2)
+
+	cases := []struct {
+		name    string
+		answers map[string]interface{}
+		want    string
+	}{
+		{"unknown option", map[string]interface{}{"diet": "carnivore", "surfers": 1}, `"carnivore" is not one of the options`},
+		{"unknown multi option", map[string]interface{}{"diet": "none", "surfers": 1, "gear": []string{"kayak"}}, `"kayak" is not one of the options`},
+		{"wrong type", map[string]interface{}{"diet": "none", "surfers": "two"}, `"surfers": must be a number`},
+		{"unasked question", map[string]interface{}{"diet": "none", "surfers": 1, "shoe_size": 42}, `"shoe_size": is not asked`},
+	}
+	for _, tc := range cases {
+		_, e, code := putAnswers(t, s, b.ID, tc.answers)
+		if code != http.StatusUnprocessableEntity || !strings.Contains(e["message"], tc.want) {
+			t.Errorf("%s: status %d, %v", tc.name, code, e)
+		}
+	}
+	if stored, _ := s.store.Booking(b.ID); stored.Answers != nil {
+		t.Fatalf("rejected answers were stored: %v", stored.Answers)
+	}
+}
+
+func TestQuestionSchemaValidation(t *testing.T) {
+	s, _ := newTestServer(t)
+	for _, q := range []map[string]interface{}{
+		{"id": "diet", "label": "Diet", "type": "choice"},
+		{"id": "flight", "label": "Flight", "type": "text", "options": []string{"a"}},
+		{"id": "x", "label": "X", "type": "date"},
+		{"id": "", "label": "X", "type": "text"},
+	} {
+		rec := doStaff(t, s.routes(), http.MethodPut, "/api/bookings/offerings/volcano-hike/questions",
+			map[string]interface{}{"questions": []map[string]interface{}{q}}, nil)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%v: status %d, want 422", q, rec.Code)
+		}
+	}
+}
+
+func TestPutQuestionsRequiresStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	putTourQuestions(t, s)
+	rec := doJSON(t, s.routes(), http.MethodPut, "/api/bookings/offerings/volcano-hike/questions",
+		map[string]interface{}{"questions": []map[string]interface{}{}}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without credentials: status %d, want 401", rec.Code)
+	}
+	if got := s.store.Questions("volcano-hike"); len(got.Questions) != 4 {
+		t.Fatalf("unauthorised call changed the questions: %+v", got)
+	}
+}
+
+func TestManifestIncludesAnswers(t *testing.T) {
+	s := newManifestTestServer(t)
+	putTourQuestions(t, s)
+	ana := s.store.Manifest("volcano-hike", "2026-03-14", "06:00", s.now()).Guests[0]
+	if _, _, code := putAnswers(t, s, ana.BookingID, map[string]interface{}{"diet": "vegan", "surfers": 2, "gear": []string{"board", "wetsuit"}}); code != http.StatusOK {
+		t.Fatalf("answers: status %d", code)
+	}
+
+	var m Manifest
+	rec := getManifest(t, s, "", testGuideKey)
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := []BookingAnswer{
+		{"diet", "Dietary needs", "vegan"},
+		{"surfers", "Number of surfers", "2"},
+		{"gear", "Gear", "board, wetsuit"},
+	}
+	got := m.Guests[0].Answers
+	if len(got) != len(want) {
+		t.Fatalf("answers = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("answers[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if csv := getManifest(t, s, "text/csv", testGuideKey).Body.String(); !strings.Contains(csv, "Dietary needs: vegan; Number of surfers: 2") {
+		t.Fatalf("csv = %q", csv)
+	}
+}
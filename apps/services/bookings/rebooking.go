@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// RebookPolicy decides which other departures a guest who cancels a tour
+// is offered instead, to keep their custom. Candidates must have seats for
+// the whole party, leave within DateWindow of the cancelled departure and,
+// when SameRegion is set, run in its region. With a PriceBand they must
+// also cost within that share of what the guest was paying. Max caps how
+// many are offered; zero offers none.
+type RebookPolicy struct {
+	Max        int
+	DateWindow time.Duration
+	PriceBand  apitypes.Percent
+	SameRegion bool
+	// Regions maps tour ids to the region they run in. Tours not listed
+	// share the unnamed region.
+	Regions map[string]string
+}
+
+func loadRebookPolicy() RebookPolicy {
+	return RebookPolicy{
+		Max:        envInt("REBOOK_MAX_SUGGESTIONS", 3),
+		DateWindow: envDuration("REBOOK_DATE_WINDOW", 7*24*time.Hour),
+		PriceBand:  envPercent("REBOOK_PRICE_BAND_PERCENT", 25*apitypes.OnePercent),
+		SameRegion: envBool("REBOOK_SAME_REGION", true),
+		Regions:    envMap("TOUR_REGIONS"),
+	}
+}
+
+func (p RebookPolicy) validate() error {
+	if p.Max < 0 || p.DateWindow < 0 || p.PriceBand < 0 {
+		return fmt.Errorf("REBOOK_MAX_SUGGESTIONS, REBOOK_DATE_WINDOW and REBOOK_PRICE_BAND_PERCENT must not be negative")
+	}
+	return nil
+}
+
+// RebookSuggestion is a departure offered to a guest in place of the one
+// they cancelled, priced for their party.
+type RebookSuggestion struct {
+	TourID     string `json:"tour_id"`
+	Date       string `json:"date"`
+	Slot       string `json:"slot,omitempty"`
+	Region     string `json:"region,omitempty"`
+	SeatsLeft  int    `json:"seats_left"`
+	PriceCents int64  `json:"price_cents"`
+	Currency   string `json:"currency"`
+}
+
+// OpenDepartures returns the departures from one date to another,
+// inclusive, with at least seats left to sell.
+func (s *Store) OpenDepartures(from, to string, seats int) []Departure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var open []Departure
+	for key, d := range s.departures {
+		if key.Date >= from && key.Date <= to && d.Remaining() >= seats {
+			open = append(open, *d)
+		}
+	}
+	return open
+}
+
+// rebookSuggestions finds departures like cancelled's the guest could book
+// instead, nearest in date first. A candidate the pricing service cannot
+// quote is left out, as the guest could not be told what it costs.
+func (s *server) rebookSuggestions(ctx context.Context, cancelled Booking) []RebookSuggestion {
+	p := s.cfg.Rebooking
+	date, err := time.Parse(time.DateOnly, cancelled.Date)
+	if p.Max == 0 || err != nil {
+		return nil
+	}
+	from := date.Add(-p.DateWindow).Format(time.DateOnly)
+	to := date.Add(p.DateWindow).Format(time.DateOnly)
+	candidates := s.store.OpenDepartures(from, to, cancelled.PartySize)
+	sort.Slice(candidates, func(i, j int) bool {
+		di, dj := daysApart(candidates[i].Date, date), daysApart(candidates[j].Date, date)
+		if di != dj {
+			return di < dj
+		}
+		if candidates[i].TourID != candidates[j].TourID {
+			return candidates[i].TourID < candidates[j].TourID
+		}
+		return candidates[i].Slot < candidates[j].Slot
+	})
+
+	region := p.Regions[cancelled.OfferingID]
+	now := s.now()
+	var out []RebookSuggestion
+	for _, d := range candidates {
+		if len(out) == p.Max {
+			break
+		}
+		same := d.TourID == cancelled.OfferingID && d.Date == cancelled.Date && d.Slot == cancelled.Slot
+		if same || (p.SameRegion && p.Regions[d.TourID] != region) || (Booking{Date: d.Date, Slot: d.Slot}).departed(now) {
+			continue
+		}
+		price, err := s.pricing.TourPrice(ctx, d.TourID, d.Date, d.Slot, cancelled.PartySize)
+		if err != nil {
+			log.Printf("pricing rebooking suggestion %s %s for booking %s: %v", d.TourID, d.Date, cancelled.ID, err)
+			continue
+		}
+		if p.PriceBand > 0 && cancelled.PriceCents > 0 {
+			diff := price.AmountCents - cancelled.PriceCents
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > p.PriceBand.Of(cancelled.PriceCents) {
+				continue
+			}
+		}
+		out = append(out, RebookSuggestion{
+			TourID:     d.TourID,
+			Date:       d.Date,
+			Slot:       d.Slot,
+			Region:     p.Regions[d.TourID],
+			SeatsLeft:  d.Remaining(),
+			PriceCents: price.AmountCents,
+			Currency:   price.Currency,
+		})
+	}
+	return out
+}
+
+// daysApart is how many days date is from ref, either way.
+func daysApart(date string, ref time.Time) int {
+	d, _ := time.Parse(time.DateOnly, date)
+	days := int(d.Sub(ref).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
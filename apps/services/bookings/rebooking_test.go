@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func TestCancellationSuggestsSimilarDepartures(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.Rebooking = RebookPolicy{
+		Max: 3, DateWindow: 7 * 24 * time.Hour, PriceBand: 25 * apitypes.OnePercent, SameRegion: true,
+		Regions: map[string]string{
+			"volcano-hike": "SANTA-ANA", "lake-kayak": "SANTA-ANA", "coffee-farm": "SANTA-ANA",
+			"canopy-tour": "SANTA-ANA", "surf-lesson": "LA-LIBERTAD",
+		},
+	}
+	s.pricing.(*fakePricing).seatCents = map[string]int64{"lake-kayak": 4000, "canopy-tour": 9000}
+
+	b, rec := bookTour(t, s, "es", 2)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+	s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.PriceCents = 9000
+		return nil
+	})
+	for _, d := range []struct{ tour, date, slot string }{
+		{"volcano-hike", "2026-03-15", "08:00"}, // the same tour the next day
+		{"lake-kayak", "2026-03-12", "07:00"},   // nearby, a little cheaper
+		{"coffee-farm", "2026-03-14", "09:00"},  // sold out below
+		{"canopy-tour", "2026-03-13", "10:00"},  // twice the price
+		{"surf-lesson", "2026-03-14", "08:00"},  // another region
+		{"lake-kayak", "2026-03-30", "07:00"},   // too far off
+		{"volcano-hike", "2026-02-28", "08:00"}, // already left
+	} {
+		s.store.Departure(d.tour, d.date, d.slot)
+	}
+	if _, err := s.store.AddBooking(Booking{Kind: KindTour, OfferingID: "coffee-farm", Date: "2026-03-14", Slot: "09:00", PartySize: 11}, s.now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Suggestions []RebookSuggestion `json:"rebook_suggestions"`
+	}
+	if rec := doJSON(t, s.routes(), http.MethodPut, "/api/bookings/tours/"+b.ID+"/cancel", nil, &got); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", rec.Code, rec.Body)
+	}
+	want := []RebookSuggestion{
+		{TourID: "volcano-hike", Date: "2026-03-15", Slot: "08:00", Region: "SANTA-ANA", SeatsLeft: 12, PriceCents: 9000, Currency: "USD"},
+		{TourID: "lake-kayak", Date: "2026-03-12", Slot: "07:00", Region: "SANTA-ANA", SeatsLeft: 12, PriceCents: 8000, Currency: "USD"},
+	}
+	if len(got.Suggestions) != len(want) {
+		t.Fatalf("suggestions %+v, want %+v", got.Suggestions, want)
+	}
+	for i := range want {
+		if got.Suggestions[i] != want[i] {
+			t.Errorf("suggestion %d = %+v, want %+v", i, got.Suggestions[i], want[i])
+		}
+	}
+
+	emails := sentMessages(s).emails
+	if len(emails) == 0 {
+		t.Fatal("no cancellation email sent")
+	}
+	body := emails[len(emails)-1].Body
+	if !strings.Contains(body, "volcano-hike on 2026-03-15 08:00, 90.00 USD") || !strings.Contains(body, "lake-kayak on 2026-03-12 07:00") || strings.Contains(body, "coffee-farm") {
+		t.Fatalf("cancellation email does not list the suggestions:\n%s", body)
+	}
+}
+
+func TestRebookingCriteriaAreConfigurable(t *testing.T) {
+	s, _ := newTestServer(t)
+	cancelled := Booking{ID: "bk-1", Kind: KindTour, OfferingID: "volcano-hike", Date: "2026-03-14", PartySize: 2, PriceCents: 9000}
+	s.pricing.(*fakePricing).seatCents = map[string]int64{"canopy-tour": 9000}
+	s.store.Departure("surf-lesson", "2026-03-14", "08:00")
+	s.store.Departure("canopy-tour", "2026-03-20", "10:00")
+	regions := map[string]string{"volcano-hike": "SANTA-ANA", "canopy-tour": "SANTA-ANA", "surf-lesson": "LA-LIBERTAD"}
+
+	cases := []struct {
+		name   string
+		policy RebookPolicy
+		want   []string
+	}{
+		{"disabled", RebookPolicy{Max: 0, DateWindow: 7 * 24 * time.Hour, Regions: regions}, nil},
+		{"same region within the band", RebookPolicy{Max: 3, DateWindow: 7 * 24 * time.Hour, PriceBand: 25 * apitypes.OnePercent, SameRegion: true, Regions: regions}, nil},
+		{"any price", RebookPolicy{Max: 3, DateWindow: 7 * 24 * time.Hour, SameRegion: true, Regions: regions}, []string{"canopy-tour"}},
+		{"any region", RebookPolicy{Max: 3, DateWindow: 7 * 24 * time.Hour, PriceBand: 25 * apitypes.OnePercent, Regions: regions}, []string{"surf-lesson"}},
+		{"narrow window", RebookPolicy{Max: 3, DateWindow: 3 * 24 * time.Hour, Regions: regions}, []string{"surf-lesson"}},
+		{"capped", RebookPolicy{Max: 1, DateWindow: 7 * 24 * time.Hour, Regions: regions}, []string{"surf-lesson"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s.cfg.Rebooking = c.policy
+			var got []string
+			for _, sg := range s.rebookSuggestions(context.Background(), cancelled) {
+				got = append(got, sg.TourID)
+			}
+			if strings.Join(got, ",") != strings.Join(c.want, ",") {
+				t.Fatalf("suggested %v, want %v", got, c.want)
+			}
+		})
+	}
+}
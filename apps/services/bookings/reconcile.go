@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CapacityCorrection is one departure whose stored seat counts disagreed
+// with its bookings and agency holds, and what they were set to.
+type CapacityCorrection struct {
+	TourID          string `json:"tour_id"`
+	Date            string `json:"date"`
+	Slot            string `json:"slot,omitempty"`
+	BookedBefore    int    `json:"booked_before"`
+	BookedAfter     int    `json:"booked_after"`
+	HeldBefore      int    `json:"held_before"`
+	HeldAfter       int    `json:"held_after"`
+	RemainingBefore int    `json:"remaining_before"`
+	RemainingAfter  int    `json:"remaining_after"`
+	// Shared is set when the shared seat inventory counted fewer seats
+	// taken than this store holds and was raised to match.
+	Shared *SharedSeatCorrection `json:"shared,omitempty"`
+}
+
+// SharedSeatCorrection is a departure's seat count in the shared inventory
+// before and after reconciling.
+type SharedSeatCorrection struct {
+	BookedBefore int `json:"booked_before"`
+	BookedAfter  int `json:"booked_after"`
+}
+
+// ReconcileCapacity recounts the seats taken on a tour's departures, or on
+// every tour's when tourID is empty, optionally only on date. Booked is
+// rebuilt from the bookings that hold seats and Held from the outstanding
+// seats of active agency holds. The recount and the correction happen under
+// the store lock, so reservations made meanwhile are neither lost nor
+// double counted, and a second run finds nothing to correct.
+//
+// The shared seat inventory, when configured, is then brought up to at
+// least the seats this store has taken on each departure, so a count that
+// lost seats cannot oversell them. It spans every replica, so a count above
+// this store's is left alone.
+func (s *Store) ReconcileCapacity(tourID, date string) []CapacityCorrection {
+	corrections, keys := s.reconcileLocal(tourID, date)
+	byKey := make(map[departureKey]int, len(corrections))
+	for i, c := range corrections {
+		byKey[departureKey{c.TourID, c.Date, c.Slot}] = i
+	}
+	for _, key := range keys {
+		shared, d, ok := s.reconcileShared(key)
+		if !ok {
+			continue
+		}
+		i, found := byKey[key]
+		if !found {
+			corrections = append(corrections, CapacityCorrection{
+				TourID: key.TourID, Date: key.Date, Slot: key.Slot,
+				BookedBefore: d.Booked, BookedAfter: d.Booked, HeldBefore: d.Held, HeldAfter: d.Held,
+				RemainingBefore: d.Remaining(), RemainingAfter: d.Remaining(),
+			})
+			i = len(corrections) - 1
+		}
+		corrections[i].Shared = &shared
+	}
+	sortCorrections(corrections)
+	return corrections
+}
+
+// reconcileShared raises the shared inventory's count for key to the seats
+// this store has taken. The store lock is held across the round trip so no
+// seats are taken or given back locally meanwhile. ok reports whether the
+// count was raised.
+func (s *Store) reconcileShared(key departureKey) (shared SharedSeatCorrection, d Departure, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dep, exists := s.departures[key]
+	if s.inventory == nil || !exists || dep.Booked+dep.Held == 0 {
+		return SharedSeatCorrection{}, Departure{}, false
+	}
+	d = *dep
+	ctx, cancel := context.WithTimeout(context.Background(), inventoryTimeout)
+	defer cancel()
+	before, err := s.inventory.EnsureBooked(ctx, d, d.Booked+d.Held)
+	if err != nil {
+		log.Printf("ALERT: reconciling shared seats on %s %s %s: %v", key.TourID, key.Date, key.Slot, err)
+		return SharedSeatCorrection{}, Departure{}, false
+	}
+	if before >= d.Booked+d.Held {
+		return SharedSeatCorrection{}, Departure{}, false
+	}
+	return SharedSeatCorrection{BookedBefore: before, BookedAfter: d.Booked + d.Held}, d, true
+}
+
+// reconcileLocal corrects this store's counts, returning the corrections
+// and every departure it checked.
+func (s *Store) reconcileLocal(tourID, date string) ([]CapacityCorrection, []departureKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match := func(key departureKey) bool {
+		return (tourID == "" || key.TourID == tourID) && (date == "" || key.Date == date)
+	}
+	booked := make(map[departureKey]int)
+	held := make(map[departureKey]int)
+	for _, b := range s.bookings {
+		key := departureKey{b.OfferingID, b.Date, b.Slot}
+		if b.Kind == KindTour && b.holdsSeats() && match(key) {
+			booked[key] += b.PartySize
+		}
+	}
+	for _, h := range s.holds {
+		key := departureKey{h.TourID, h.Date, h.Slot}
+		if h.Status == HoldActive && match(key) {
+			held[key] += h.Outstanding()
+		}
+	}
+	// A departure may have seats taken but never have been stored, e.g.
+	// after a restore from bookings alone.
+	for key := range booked {
+		s.departureLocked(key)
+	}
+	for key := range held {
+		s.departureLocked(key)
+	}
+
+	corrections := []CapacityCorrection{}
+	var keys []departureKey
+	for key, d := range s.departures {
+		if !match(key) {
+			continue
+		}
+		keys = append(keys, key)
+		if d.Booked == booked[key] && d.Held == held[key] {
+			continue
+		}
+		c := CapacityCorrection{
+			TourID: key.TourID, Date: key.Date, Slot: key.Slot,
+			BookedBefore: d.Booked, HeldBefore: d.Held, RemainingBefore: d.Remaining(),
+		}
+		d.Booked, d.Held = booked[key], held[key]
+		c.BookedAfter, c.HeldAfter, c.RemainingAfter = d.Booked, d.Held, d.Remaining()
+		corrections = append(corrections, c)
+	}
+	return corrections, keys
+}
+
+// sortCorrections orders corrections by tour, date and slot.
+func sortCorrections(corrections []CapacityCorrection) {
+	sort.Slice(corrections, func(i, j int) bool {
+		a, b := corrections[i], corrections[j]
+		if a.TourID != b.TourID {
+			return a.TourID < b.TourID
+		}
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.Slot < b.Slot
+	})
+}
+
+func logCapacityCorrections(corrections []CapacityCorrection) {
+	for _, c := range corrections {
+		log.Printf("capacity reconcile: %s %s %s booked %d -> %d, held %d -> %d, remaining %+d",
+			c.TourID, c.Date, c.Slot, c.BookedBefore, c.BookedAfter, c.HeldBefore, c.HeldAfter, c.RemainingAfter-c.RemainingBefore)
+		if c.Shared != nil {
+			log.Printf("capacity reconcile: %s %s %s shared inventory booked %d -> %d",
+				c.TourID, c.Date, c.Slot, c.Shared.BookedBefore, c.Shared.BookedAfter)
+		}
+	}
+}
+
+// reconcileCapacityHandler recounts a tour's seats and corrects any drift.
+// ?date=YYYY-MM-DD limits it to one day's departures.
+func (s *server) reconcileCapacityHandler(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date != "" {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+			return
+		}
+	}
+	tourID := chi.URLParam(r, "tourId")
+	corrections := s.store.ReconcileCapacity(tourID, date)
+	logCapacityCorrections(corrections)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tour_id":     tourID,
+		"date":        date,
+		"corrections": corrections,
+	})
+}
+
+// sweepCapacity reconciles every departure each CapacityReconcileInterval.
+func (s *server) sweepCapacity(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CapacityReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logCapacityCorrections(s.store.ReconcileCapacity("", ""))
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+func staffPost(t *testing.T, s *server, path string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.Header.Set("Authorization", "Bearer staff-key")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body, err)
+		}
+	}
+	return rec
+}
+
+func TestReconcileCapacityRepairsDesync(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	bookTour(t, s, "es", 2)
+	cancelled, _ := bookTour(t, s, "es", 3)
+	bookTour(t, s, "es", 1)
+	if _, err := s.store.CancelBooking(cancelled.ID, clock.now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.CreateBlockHold(tenantkit.DefaultID, "volcano-hike", "2026-03-14", "08:00", "agency-1", 4, clock.now(), clock.now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// Another day's departure, which a date-limited run must not touch.
+	other := departureKey{"volcano-hike", "2026-03-15", "08:00"}
+
+	// Simulate a bad manual edit.
+	s.store.mu.Lock()
+	d := s.store.departureLocked(departureKey{"volcano-hike", "2026-03-14", "08:00"})
+	d.Booked, d.Held = 9, 0
+	s.store.departureLocked(other).Booked = 2
+	s.store.mu.Unlock()
+
+	var resp struct {
+		Corrections []CapacityCorrection `json:"corrections"`
+	}
+	rec := staffPost(t, s, "/api/bookings/tours/volcano-hike/reconcile-capacity?date=2026-03-14", &resp)
+	if rec.Code != http.StatusOK || len(resp.Corrections) != 1 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := CapacityCorrection{
+		TourID: "volcano-hike", Date: "2026-03-14", Slot: "08:00",
+		BookedBefore: 9, BookedAfter: 3, HeldBefore: 0, HeldAfter: 4, RemainingBefore: 3, RemainingAfter: 5,
+	}
+	if resp.Corrections[0] != want {
+		t.Fatalf("correction = %+v, want %+v", resp.Corrections[0], want)
+	}
+	if got := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); got.Remaining() != 5 {
+		t.Fatalf("remaining = %d, want 5", got.Remaining())
+	}
+	if got := s.store.Departure(other.TourID, other.Date, other.Slot); got.Booked != 2 {
+		t.Fatalf("other day's departure was touched: %+v", got)
+	}
+
+	// Running it again finds nothing to correct.
+	staffPost(t, s, "/api/bookings/tours/volcano-hike/reconcile-capacity?date=2026-03-14", &resp)
+	if len(resp.Corrections) != 0 {
+		t.Fatalf("second run corrected %+v", resp.Corrections)
+	}
+}
+
+func TestReconcileCapacityAlongsideBookings(t *testing.T) {
+	s, clock := newTestServer(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.store.AddBooking(Booking{Kind: KindTour, OfferingID: "volcano-hike", Date: "2026-03-14", PartySize: 1, GuestEmail: "ana@example.com"}, clock.now())
+		}()
+		go func() {
+			defer wg.Done()
+			s.store.ReconcileCapacity("volcano-hike", "")
+		}()
+	}
+	wg.Wait()
+	if c := s.store.ReconcileCapacity("", ""); len(c) != 0 {
+		t.Fatalf("reconciling during bookings left drift: %+v", c)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 8 {
+		t.Fatalf("booked = %d, want 8", d.Booked)
+	}
+}
+
+func TestReconcileCapacityRequiresStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.StaffAPIKey = "staff-key"
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/bookings/tours/volcano-hike/reconcile-capacity", nil))
+	if rec.Code != http.StatusUnauthorized && rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 401 or 403", rec.Code)
+	}
+}
+
+func TestReconcileCapacityRaisesSharedInventory(t *testing.T) {
+	s, clock := newTestServer(t)
+	inv := newFakeInventory()
+	s.store.UseInventory(inv)
+	bookTour(t, s, "es", 2)
+	if _, err := s.store.CreateBlockHold(tenantkit.DefaultID, "volcano-hike", "2026-03-14", "08:00", "agency-1", 4, clock.now(), clock.now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	key := departureKey{"volcano-hike", "2026-03-14", "08:00"}
+
+	// The shared count lost seats, say to a restore from an old backup.
+	inv.mu.Lock()
+	inv.booked[key] = 1
+	inv.mu.Unlock()
+
+	c := s.store.ReconcileCapacity("volcano-hike", "")
+	want := SharedSeatCorrection{BookedBefore: 1, BookedAfter: 6}
+	if len(c) != 1 || c[0].Shared == nil || *c[0].Shared != want || c[0].BookedBefore != c[0].BookedAfter {
+		t.Fatalf("corrections = %+v, want only the shared count raised to 6", c)
+	}
+	if got := inv.bookedOn(key.TourID, key.Date, key.Slot); got != 6 {
+		t.Fatalf("shared inventory booked = %d, want 6", got)
+	}
+
+	// Seats other replicas sold are not this store's to give back.
+	inv.mu.Lock()
+	inv.booked[key] = 9
+	inv.mu.Unlock()
+	if c := s.store.ReconcileCapacity("volcano-hike", ""); len(c) != 0 {
+		t.Fatalf("corrections = %+v, want none", c)
+	}
+	if got := inv.bookedOn(key.TourID, key.Date, key.Slot); got != 9 {
+		t.Fatalf("shared inventory booked = %d, want 9 left alone", got)
+	}
+}
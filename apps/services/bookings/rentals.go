@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrDatesUnavailable = errors.New("dates overlap an existing booking or maintenance block")
+	ErrBlockConflict    = errors.New("bookings already occupy the range")
+)
+
+// maxAvailabilityNights bounds an availability or block range.
+const maxAvailabilityNights = 366
+
+// MaintenanceBlock takes a rental property off sale for the nights from
+// Start to End, inclusive, e.g. for renovations.
+type MaintenanceBlock struct {
+	ID         string            `json:"block_id"`
+	PropertyID string            `json:"property_id"`
+	Start      string            `json:"start"`
+	End        string            `json:"end"`
+	Reason     string            `json:"reason"`
+	CreatedAt  apitypes.JSONTime `json:"created_at"`
+}
+
+// until is the first night after the block, so it compares with a stay's
+// check-out.
+func (m MaintenanceBlock) until() string {
+	end, _ := time.Parse(time.DateOnly, m.End)
+	return end.AddDate(0, 0, 1).Format(time.DateOnly)
+}
+
+// nightsOverlap reports whether the half-open night ranges [aFrom, aTo) and
+// [bFrom, bTo) share a night. Dates are ISO formatted so they compare
+// lexically.
+func nightsOverlap(aFrom, aTo, bFrom, bTo string) bool {
+	return aFrom < bTo && bFrom < aTo
+}
+
+// occupies reports whether a booking keeps its nights, session time or tour
+// guide off sale. Unpaid bookings do too, so two guests cannot check out
+// the same nights or session.
+func (b *Booking) occupies() bool {
+	switch b.Status {
+	case StatusPending, StatusPendingApproval, StatusConfirmed, StatusCheckedIn, StatusDisputed:
+		return true
+	}
+	return false
+}
+
+// rentalConflictsLocked returns the bookings and blocks on a property that
+// share a night with [from, to). Callers must hold s.mu.
+func (s *Store) rentalConflictsLocked(propertyID, from, to string) ([]Booking, []MaintenanceBlock) {
+	var bookings []Booking
+	for _, b := range s.bookings {
+		if b.Kind == KindRental && b.OfferingID == propertyID && b.occupies() && nightsOverlap(b.Date, b.CheckOut, from, to) {
+			bookings = append(bookings, *b)
+		}
+	}
+	var blocks []MaintenanceBlock
+	for _, m := range s.blocks {
+		if m.PropertyID == propertyID && nightsOverlap(m.Start, m.until(), from, to) {
+			blocks = append(blocks, *m)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].Date < bookings[j].Date })
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+	return bookings, blocks
+}
+
+// BlockProperty takes a property off sale for [start, end]. It fails with
+// ErrBlockConflict, listing them, when confirmed bookings already hold any
+// of those nights, and with ErrDatesUnavailable when another block does.
+func (s *Store) BlockProperty(propertyID, start, end, reason string, now time.Time) (MaintenanceBlock, []Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := MaintenanceBlock{ID: newID(), PropertyID: propertyID, Start: start, End: end, Reason: reason, CreatedAt: apitypes.JSONTime{Time: now}}
+	bookings, blocks := s.rentalConflictsLocked(propertyID, m.Start, m.until())
+	var confirmed []Booking
+	for _, b := range bookings {
+		if b.Status != StatusPending {
+			confirmed = append(confirmed, b)
+		}
+	}
+	if len(confirmed) > 0 {
+		return MaintenanceBlock{}, confirmed, ErrBlockConflict
+	}
+	if len(blocks) > 0 {
+		return MaintenanceBlock{}, nil, ErrDatesUnavailable
+	}
+	s.blocks[m.ID] = &m
+	return m, nil, nil
+}
+
+// UnblockProperty removes a maintenance block.
+func (s *Store) UnblockProperty(propertyID, blockID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.blocks[blockID]
+	if !ok || m.PropertyID != propertyID {
+		return ErrNotFound
+	}
+	delete(s.blocks, blockID)
+	return nil
+}
+
+// NightAvailability is whether one night of a property can be sold, and
+// what holds it if not.
+type NightAvailability struct {
+	Date      string `json:"date"`
+	Available bool   `json:"available"`
+	BookingID string `json:"booking_id,omitempty"`
+	BlockID   string `json:"block_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// RentalAvailability lists each night in [from, to).
+func (s *Store) RentalAvailability(propertyID string, from, to time.Time) []NightAvailability {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bookings, blocks := s.rentalConflictsLocked(propertyID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	nights := []NightAvailability{}
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		n := NightAvailability{Date: d.Format(time.DateOnly), Available: true}
+		for _, b := range bookings {
+			if b.Date <= n.Date && n.Date < b.CheckOut {
+				n.Available, n.BookingID = false, b.ID
+			}
+		}
+		for _, m := range blocks {
+			if m.Start <= n.Date && n.Date <= m.End {
+				n.Available, n.BlockID, n.Reason = false, m.ID, m.Reason
+			}
+		}
+		nights = append(nights, n)
+	}
+	return nights
+}
+
+// parseNights reads two YYYY-MM-DD dates and checks that to comes after from
+// and within maxAvailabilityNights.
+func parseNights(from, to string) (time.Time, time.Time, bool) {
+	f, err1 := time.Parse(time.DateOnly, from)
+	t, err2 := time.Parse(time.DateOnly, to)
+	if err1 != nil || err2 != nil || !t.After(f) || t.Sub(f) > maxAvailabilityNights*24*time.Hour {
+		return time.Time{}, time.Time{}, false
+	}
+	return f, t, true
+}
+
+// createRentalBookingHandler books a stay from check_in up to the morning
+// of check_out.
+func (s *server) createRentalBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PropertyID string `json:"property_id"`
+		CheckIn    string `json:"check_in"`
+		CheckOut   string `json:"check_out"`
+		PartySize  int    `json:"party_size"`
+		GuestName  string `json:"guest_name"`
+		GuestEmail string `json:"guest_email"`
+		GuestPhone string `json:"guest_phone"`
+		Referral   string `json:"referral_code"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if err := validateBooking(bookingFields{
+		OfferingField: "property_id", OfferingID: req.PropertyID,
+		DateField: "check_in", Date: req.CheckIn,
+		CheckOutField: "check_out", CheckOut: req.CheckOut,
+		PartySize: req.PartySize, GuestEmail: req.GuestEmail,
+	}); err != nil {
+		respondValidationError(w, err)
+		return
+	}
+	b, err := s.store.AddBooking(Booking{
+		Tenant:     s.tenant(r.Context()).ID,
+		Kind:       KindRental,
+		OfferingID: req.PropertyID,
+		Date:       req.CheckIn,
+		CheckOut:   req.CheckOut,
+		PartySize:  req.PartySize,
+		GuestName:  req.GuestName,
+		GuestEmail: req.GuestEmail,
+		GuestPhone: req.GuestPhone,
+
+		ReferralCode: strings.TrimSpace(req.Referral),
+	}, s.now())
+	if errors.Is(err, ErrDatesUnavailable) {
+		respondError(w, http.StatusConflict, "dates_unavailable", err.Error())
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, b)
+}
+
+func (s *server) getRentalBookingHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store.Booking(chi.URLParam(r, "bookingId"))
+	if err == nil && b.Kind != KindRental {
+		err = ErrNotFound
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, b)
+}
+
+// blockPropertyHandler takes a property off sale for maintenance. Body:
+// {"start": "YYYY-MM-DD", "end": "YYYY-MM-DD", "reason": "..."}, both dates
+// inclusive.
+func (s *server) blockPropertyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Start  string `json:"start"`
+		End    string `json:"end"`
+		Reason string `json:"reason"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	end, err := time.Parse(time.DateOnly, req.End)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_range", "start and end must be formatted YYYY-MM-DD with end not before start")
+		return
+	}
+	if _, _, ok := parseNights(req.Start, end.AddDate(0, 0, 1).Format(time.DateOnly)); !ok {
+		respondError(w, http.StatusBadRequest, "invalid_range", "start and end must be formatted YYYY-MM-DD with end not before start")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		respondError(w, http.StatusBadRequest, "missing_reason", "a reason is required")
+		return
+	}
+	m, conflicts, err := s.store.BlockProperty(chi.URLParam(r, "propertyId"), req.Start, req.End, req.Reason, s.now())
+	switch {
+	case errors.Is(err, ErrBlockConflict):
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "bookings_in_range",
+			"message":   err.Error(),
+			"conflicts": conflicts,
+		})
+	case errors.Is(err, ErrDatesUnavailable):
+		respondError(w, http.StatusConflict, "already_blocked", "the range overlaps another maintenance block")
+	case err != nil:
+		respondStoreError(w, err)
+	default:
+		respondJSON(w, http.StatusCreated, m)
+	}
+}
+
+func (s *server) unblockPropertyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.UnblockProperty(chi.URLParam(r, "propertyId"), chi.URLParam(r, "blockId")); err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rentalAvailabilityHandler lists each night in ?from= up to ?to=.
+func (s *server) rentalAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseNights(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid_range", "from and to must be formatted YYYY-MM-DD with to after from")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"property_id": chi.URLParam(r, "propertyId"),
+		"nights":      s.availability.Nights(chi.URLParam(r, "propertyId"), from, to),
+	})
+}
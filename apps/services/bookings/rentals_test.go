@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func bookStay(t *testing.T, s *server, checkIn, checkOut string) (Booking, *httptest.ResponseRecorder) {
+	t.Helper()
+	var b Booking
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/rentals", map[string]interface{}{
+		"property_id": "casa-suchitoto", "check_in": checkIn, "check_out": checkOut,
+		"party_size": 2, "guest_name": "Ana", "guest_email": "ana@example.com",
+	}, &b)
+	return b, rec
+}
+
+func blockProperty(t *testing.T, s *server, start, end string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return doStaff(t, s.routes(), http.MethodPost, "/api/bookings/rentals/casa-suchitoto/block", map[string]interface{}{
+		"start": start, "end": end, "reason": "Roof repairs",
+	}, out)
+}
+
+func availability(t *testing.T, s *server, from, to string) []NightAvailability {
+	t.Helper()
+	var got struct {
+		Nights []NightAvailability `json:"nights"`
+	}
+	doJSON(t, s.routes(), http.MethodGet, "/api/bookings/rentals/casa-suchitoto/availability?from="+from+"&to="+to, nil, &got)
+	return got.Nights
+}
+
+func TestBlockFreeRangeRemovesAvailabilityAndRejectsBookings(t *testing.T) {
+	s, _ := newTestServer(t)
+	var m MaintenanceBlock
+	if rec := blockProperty(t, s, "2026-04-01", "2026-04-10", &m); rec.Code != http.StatusCreated {
+		t.Fatalf("block: status %d: %s", rec.Code, rec.Body)
+	}
+
+	nights := availability(t, s, "2026-03-31", "2026-04-12")
+	if len(nights) != 12 || !nights[0].Available || !nights[11].Available {
+		t.Fatalf("nights = %+v, want the edges free", nights)
+	}
+	for _, n := range nights[1:11] {
+		if n.Available || n.BlockID != m.ID || n.Reason != "Roof repairs" {
+			t.Fatalf("night %+v, want blocked for roof repairs", n)
+		}
+	}
+
+	// A stay checking out on the first blocked day is fine; one staying
+	// into it is not.
+	if _, rec := bookStay(t, s, "2026-03-29", "2026-04-01"); rec.Code != http.StatusCreated {
+		t.Fatalf("stay before block: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, rec := bookStay(t, s, "2026-04-10", "2026-04-12"); rec.Code != http.StatusConflict {
+		t.Fatalf("stay overlapping block: status %d, want 409", rec.Code)
+	}
+}
+
+func TestBlockConflictsWithConfirmedBookings(t *testing.T) {
+	s, _ := newTestServer(t)
+	b, rec := bookStay(t, s, "2026-04-05", "2026-04-08")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := confirmPaid(t, s, b); rec.Code != http.StatusOK {
+		t.Fatalf("pay: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var got struct {
+		Error     string    `json:"error"`
+		Conflicts []Booking `json:"conflicts"`
+	}
+	rec = blockProperty(t, s, "2026-04-01", "2026-04-10", &got)
+	if rec.Code != http.StatusConflict || got.Error != "bookings_in_range" {
+		t.Fatalf("status %d: %s, want 409 bookings_in_range", rec.Code, rec.Body)
+	}
+	if len(got.Conflicts) != 1 || got.Conflicts[0].ID != b.ID {
+		t.Fatalf("conflicts = %+v, want the confirmed stay", got.Conflicts)
+	}
+	if n := availability(t, s, "2026-04-01", "2026-04-02"); len(n) != 1 || !n[0].Available {
+		t.Fatalf("failed block left nights unavailable: %+v", n)
+	}
+}
+
+func TestBlockPropertyRequiresStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	block := map[string]interface{}{"start": "2026-04-01", "end": "2026-04-10", "reason": "Roof repairs"}
+	if rec := doJSON(t, h, http.MethodPost, "/api/bookings/rentals/casa-suchitoto/block", block, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("block without credentials: status %d, want 401", rec.Code)
+	}
+	if n := availability(t, s, "2026-04-01", "2026-04-02"); len(n) != 1 || !n[0].Available {
+		t.Fatalf("unauthorised block closed nights: %+v", n)
+	}
+
+	var m MaintenanceBlock
+	blockProperty(t, s, "2026-04-01", "2026-04-10", &m)
+	if rec := doJSON(t, h, http.MethodDelete, "/api/bookings/rentals/casa-suchitoto/block/"+m.ID, nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unblock without credentials: status %d, want 401", rec.Code)
+	}
+	if n := availability(t, s, "2026-04-01", "2026-04-02"); len(n) != 1 || n[0].Available {
+		t.Fatalf("unauthorised unblock reopened nights: %+v", n)
+	}
+}
+
+func TestUnblockReopensRange(t *testing.T) {
+	s, _ := newTestServer(t)
+	var m MaintenanceBlock
+	blockProperty(t, s, "2026-04-01", "2026-04-10", &m)
+
+	rec := doStaff(t, s.routes(), http.MethodDelete, "/api/bookings/rentals/casa-suchitoto/block/"+m.ID, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unblock: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, rec := bookStay(t, s, "2026-04-03", "2026-04-06"); rec.Code != http.StatusCreated {
+		t.Fatalf("stay after unblock: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = doStaff(t, s.routes(), http.MethodDelete, "/api/bookings/rentals/casa-suchitoto/block/"+m.ID, nil, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("second unblock: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// completedAt is when a booking stops needing its guest's details: when it
+// was cancelled, rejected or failed, or otherwise once it has taken place.
+// Bookings without a parseable start complete at their last update.
+func (b Booking) completedAt() time.Time {
+	switch b.Status {
+	case StatusCancelled, StatusRejected, StatusFailedNoCapacity, StatusPaymentFailed:
+		return b.UpdatedAt.Time
+	}
+	start, err := b.startsAt()
+	if err != nil || start.Before(b.UpdatedAt.Time) {
+		return b.UpdatedAt.Time
+	}
+	return start
+}
+
+// anonymize irreversibly removes the guest's personal data. Identifiers,
+// amounts and payment references stay so accounting still balances.
+func (b *Booking) anonymize(now time.Time) {
+	b.GuestName, b.GuestEmail, b.GuestPhone = "", "", ""
+	b.SpecialRequests = ""
+	b.Answers = nil
+	b.CheckInToken = ""
+	for i := range b.Transfers {
+		b.Transfers[i].From = GuestContact{}
+		b.Transfers[i].To = GuestContact{}
+	}
+	b.Anonymized = true
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+}
+
+// AnonymizeCompletedBefore scrubs guest PII from every booking completed
+// before cutoff, and from waitlist entries for departures before it. It
+// returns the number of bookings and entries scrubbed.
+func (s *Store) AnonymizeCompletedBefore(cutoff, now time.Time) (bookings, entries int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.bookings {
+		if b.Anonymized || !b.completedAt().Before(cutoff) {
+			continue
+		}
+		b.anonymize(now)
+		bookings++
+	}
+	for _, e := range s.waitlist {
+		date, err := time.ParseInLocation(time.DateOnly, e.Date, localZone)
+		if err != nil || !date.Before(cutoff) || e.GuestEmail == "" && e.GuestName == "" && e.GuestPhone == "" {
+			continue
+		}
+		e.GuestName, e.GuestEmail, e.GuestPhone = "", "", ""
+		entries++
+	}
+	return bookings, entries
+}
+
+// purgeGuestData anonymizes bookings completed more than the retention
+// period ago.
+func (s *server) purgeGuestData() {
+	now := s.now()
+	bookings, entries := s.store.AnonymizeCompletedBefore(now.Add(-s.cfg.GuestDataRetention), now)
+	if bookings > 0 || entries > 0 {
+		log.Printf("retention purge anonymized %d bookings and %d waitlist entries", bookings, entries)
+	}
+}
+
+// sweepGuestData runs the retention purge periodically until ctx is done.
+// A zero retention period disables it.
+func (s *server) sweepGuestData(ctx context.Context) {
+	if s.cfg.GuestDataRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.RetentionPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeGuestData()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeScrubsPIIPastRetentionAndKeepsAmounts(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.GuestDataRetention = 30 * 24 * time.Hour
+	old := seedPaidTour(t, s, "standard")
+	s.store.UpdateBooking(old.ID, s.now(), func(b *Booking) error {
+		b.GuestName, b.SpecialRequests = "Ana López", "wheelchair access"
+		return nil
+	})
+	s.store.CheckIn(old.CheckInToken, s.now())
+
+	// The tour departed on 2026-03-14, more than 30 days before the purge;
+	// a booking last updated today completes no earlier than today.
+	clock.advance(60 * 24 * time.Hour)
+	recent := seedPaidTour(t, s, "standard")
+
+	s.purgeGuestData()
+
+	got, _ := s.store.Booking(old.ID)
+	if got.GuestName != "" || got.GuestEmail != "" || got.GuestPhone != "" || got.SpecialRequests != "" || !got.Anonymized {
+		t.Fatalf("old booking = %+v, want PII scrubbed", got)
+	}
+	if got.AmountCents != 9000 || got.PaymentRef != old.PaymentRef || got.Currency != "USD" || got.Status != StatusCheckedIn {
+		t.Fatalf("old booking = %+v, want payment and status kept", got)
+	}
+
+	got, _ = s.store.Booking(recent.ID)
+	if got.GuestEmail == "" || got.Anonymized {
+		t.Fatalf("recent booking = %+v, want untouched", got)
+	}
+}
+
+func TestPurgeWaitsForRetentionAfterDeparture(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.GuestDataRetention = 30 * 24 * time.Hour
+	b := seedPaidTour(t, s, "standard")
+
+	// Booked 2026-03-01 for 2026-03-14: the window runs from the departure,
+	// not from when the booking was made.
+	clock.advance(35 * 24 * time.Hour)
+	s.purgeGuestData()
+	if got, _ := s.store.Booking(b.ID); got.Anonymized {
+		t.Fatal("anonymized before retention elapsed after departure")
+	}
+
+	clock.advance(10 * 24 * time.Hour)
+	s.purgeGuestData()
+	if got, _ := s.store.Booking(b.ID); !got.Anonymized || got.GuestEmail != "" {
+		t.Fatalf("booking = %+v, want anonymized", got)
+	}
+}
+
+func TestPurgeCountsCancelledBookingsFromCancellation(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.GuestDataRetention = 24 * time.Hour
+	b := seedPendingTour(t, s, 2)
+	if _, err := s.store.CancelBooking(b.ID, s.now()); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(48 * time.Hour)
+	s.purgeGuestData()
+	if got, _ := s.store.Booking(b.ID); !got.Anonymized || got.Status != StatusCancelled {
+		t.Fatalf("booking = %+v, want anonymized and still cancelled", got)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// ScheduleTemplate describes a tour's recurring weekly departures, e.g. "runs
+// Tue/Thu/Sat at 09:00 with 12 seats".
+type ScheduleTemplate struct {
+	TourID        string   `json:"tour_id"`
+	Weekdays      []string `json:"weekdays"`
+	Times         []string `json:"times"`
+	Capacity      int      `json:"capacity"`
+	BlackoutDates []string `json:"blackout_dates"`
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (t ScheduleTemplate) validate() error {
+	if len(t.Weekdays) == 0 || len(t.Times) == 0 {
+		return fmt.Errorf("weekdays and times are required")
+	}
+	for _, d := range t.Weekdays {
+		if _, ok := weekdayNames[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown weekday %q", d)
+		}
+	}
+	for _, tm := range t.Times {
+		if _, err := time.Parse("15:04", tm); err != nil {
+			return fmt.Errorf("time %q must be formatted HH:MM", tm)
+		}
+	}
+	for _, d := range t.BlackoutDates {
+		if _, err := time.Parse(time.DateOnly, d); err != nil {
+			return fmt.Errorf("blackout date %q must be formatted YYYY-MM-DD", d)
+		}
+	}
+	if t.Capacity < 1 {
+		return fmt.Errorf("capacity must be at least 1")
+	}
+	return nil
+}
+
+// slots expands the template into departure keys for every date in
+// [from, to], skipping blackout dates.
+func (t ScheduleTemplate) slots(from, to time.Time) []departureKey {
+	days := make(map[time.Weekday]bool)
+	for _, d := range t.Weekdays {
+		days[weekdayNames[strings.ToLower(d)]] = true
+	}
+	blackout := make(map[string]bool)
+	for _, d := range t.BlackoutDates {
+		blackout[d] = true
+	}
+
+	var keys []departureKey
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		if !days[day.Weekday()] || blackout[date] {
+			continue
+		}
+		for _, tm := range t.Times {
+			keys = append(keys, departureKey{TourID: t.TourID, Date: date, Slot: tm})
+		}
+	}
+	return keys
+}
+
+// SetScheduleTemplate stores the recurring schedule for a tour.
+func (s *Store) SetScheduleTemplate(t ScheduleTemplate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates[t.TourID] = t
+}
+
+// ScheduleTemplate returns the recurring schedule for a tour.
+func (s *Store) ScheduleTemplate(tourID string) (ScheduleTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.templates[tourID]
+	if !ok {
+		return ScheduleTemplate{}, ErrNotFound
+	}
+	return t, nil
+}
+
+// EnsureDepartures creates each missing departure with the given capacity and
+// leaves existing ones untouched, so materializing a template is idempotent.
+func (s *Store) EnsureDepartures(keys []departureKey, capacity int) (created, existing []Departure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if d, ok := s.departures[key]; ok {
+			existing = append(existing, *d)
+			continue
+		}
+		d := &Departure{TourID: key.TourID, Date: key.Date, Slot: key.Slot, Capacity: capacity}
+		s.departures[key] = d
+		created = append(created, *d)
+	}
+	return created, existing
+}
+
+func (s *server) putScheduleTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var t ScheduleTemplate
+	if err := httpkit.DecodeJSON(r, &t); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	t.TourID = chi.URLParam(r, "tourId")
+	if err := t.validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_template", err.Error())
+		return
+	}
+	s.store.SetScheduleTemplate(t)
+	respondJSON(w, http.StatusOK, t)
+}
+
+// materializeScheduleHandler turns the tour's template into concrete dated
+// departures between from and to (inclusive).
+func (s *server) materializeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	from, err1 := time.Parse(time.DateOnly, req.From)
+	to, err2 := time.Parse(time.DateOnly, req.To)
+	if err1 != nil || err2 != nil || to.Before(from) {
+		respondError(w, http.StatusBadRequest, "invalid_range", "from and to must be YYYY-MM-DD with from <= to")
+		return
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		respondError(w, http.StatusBadRequest, "invalid_range", "the horizon may not exceed one year")
+		return
+	}
+
+	t, err := s.store.ScheduleTemplate(chi.URLParam(r, "tourId"))
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	created, existing := s.store.EnsureDepartures(t.slots(from, to), t.Capacity)
+	if created == nil {
+		created = []Departure{}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"created":        created,
+		"created_count":  len(created),
+		"existing_count": len(existing),
+	})
+}
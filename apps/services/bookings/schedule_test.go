@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type materializeResponse struct {
+	Created       []Departure `json:"created"`
+	CreatedCount  int         `json:"created_count"`
+	ExistingCount int         `json:"existing_count"`
+}
+
+func TestMaterializeScheduleTemplate(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+
+	rec := doStaff(t, h, http.MethodPut, "/api/bookings/tours/ruta-flores/schedule", ScheduleTemplate{
+		Weekdays: []string{"tue", "thu", "sat"}, Times: []string{"09:00"}, Capacity: 8,
+		BlackoutDates: []string{"2026-03-05"},
+	}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put template: %d %s", rec.Code, rec.Body)
+	}
+
+	// 2026-03-02 is a Monday; the two weeks hold Tue 3, Thu 5, Sat 7,
+	// Tue 10, Thu 12, Sat 14. Thu 5 is blacked out.
+	var resp materializeResponse
+	doStaff(t, h, http.MethodPost, "/api/bookings/tours/ruta-flores/schedule/materialize", map[string]string{
+		"from": "2026-03-02", "to": "2026-03-15",
+	}, &resp)
+
+	want := []string{"2026-03-03", "2026-03-07", "2026-03-10", "2026-03-12", "2026-03-14"}
+	if resp.CreatedCount != len(want) {
+		t.Fatalf("created %d departures, want %d: %+v", resp.CreatedCount, len(want), resp.Created)
+	}
+	for i, d := range resp.Created {
+		if d.Date != want[i] || d.Slot != "09:00" || d.Capacity != 8 {
+			t.Errorf("departure %d = %+v, want %s 09:00 cap 8", i, d, want[i])
+		}
+	}
+}
+
+func TestMaterializeScheduleIsIdempotent(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	doStaff(t, h, http.MethodPut, "/api/bookings/tours/ruta-flores/schedule", ScheduleTemplate{
+		Weekdays: []string{"sat"}, Times: []string{"09:00", "14:00"}, Capacity: 8,
+	}, nil)
+
+	var first, second materializeResponse
+	doStaff(t, h, http.MethodPost, "/api/bookings/tours/ruta-flores/schedule/materialize", map[string]string{"from": "2026-03-01", "to": "2026-03-31"}, &first)
+	if first.CreatedCount != 8 {
+		t.Fatalf("first run created %d, want 8", first.CreatedCount)
+	}
+
+	// Seats sold between runs must survive a re-run.
+	if _, err := s.store.AddBooking(Booking{Kind: KindTour, OfferingID: "ruta-flores", Date: "2026-03-07", Slot: "09:00", PartySize: 3}, s.now()); err != nil {
+		t.Fatal(err)
+	}
+	doStaff(t, h, http.MethodPost, "/api/bookings/tours/ruta-flores/schedule/materialize", map[string]string{"from": "2026-03-01", "to": "2026-03-31"}, &second)
+	if second.CreatedCount != 0 || second.ExistingCount != 8 {
+		t.Fatalf("second run = %+v, want 0 created 8 existing", second)
+	}
+	if d := s.store.Departure("ruta-flores", "2026-03-07", "09:00"); d.Booked != 3 || d.Capacity != 8 {
+		t.Fatalf("departure after re-run = %+v", d)
+	}
+}
+
+func TestScheduleTemplateValidation(t *testing.T) {
+	s, _ := newTestServer(t)
+	rec := doStaff(t, s.routes(), http.MethodPut, "/api/bookings/tours/ruta-flores/schedule", ScheduleTemplate{
+		Weekdays: []string{"funday"}, Times: []string{"09:00"}, Capacity: 8,
+	}, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
+
+func TestScheduleRequiresStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	template := ScheduleTemplate{Weekdays: []string{"sat"}, Times: []string{"09:00"}, Capacity: 8}
+	window := map[string]string{"from": "2026-03-01", "to": "2026-03-31"}
+	for _, token := range []string{"", testServiceKey, testAgencyKey} {
+		if rec := doJSONAs(t, token, h, http.MethodPut, "/api/bookings/tours/ruta-flores/schedule", template, nil); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("put template with %q: status %d, want 401", token, rec.Code)
+		}
+		if rec := doJSONAs(t, token, h, http.MethodPost, "/api/bookings/tours/ruta-flores/schedule/materialize", window, nil); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("materialize with %q: status %d, want 401", token, rec.Code)
+		}
+	}
+	if d := s.store.Departure("ruta-flores", "2026-03-07", "09:00"); d.Capacity == 8 {
+		t.Fatalf("an unauthorised call scheduled %+v", d)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// resendSender delivers email through the Resend API.
+type resendSender struct {
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+func newResendSender(apiKey, from string) *resendSender {
+	return &resendSender{apiKey: apiKey, from: from, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (r *resendSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"from":    r.from,
+		"to":      []string{to},
+		"subject": subject,
+		"text":    body,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.resend.com/emails", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("resend: unexpected status %d", resp.StatusCode)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			// The message itself was refused; sending it again won't help.
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// twilioSender delivers SMS through Twilio's Messages API.
+type twilioSender struct {
+	accountSID string
+	authToken  string
+	from       string
+	baseURL    string
+	client     *http.Client
+}
+
+func newTwilioSender(accountSID, authToken, from string) *twilioSender {
+	return &twilioSender{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		baseURL:    "https://api.twilio.com",
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *twilioSender) SendSMS(ctx context.Context, to, body string) error {
+	if !validE164(to) {
+		return fmt.Errorf("twilio: %q is not an E.164 phone number", to)
+	}
+	form := url.Values{"To": {to}, "From": {t.from}, "Body": {body}}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.baseURL, t.accountSID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("twilio: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// logSender stands in for real providers in development by logging messages.
+type logSender struct{}
+
+func (logSender) SendEmail(_ context.Context, to, subject, _ string) error {
+	log.Printf("email to %s: %s", to, subject)
+	return nil
+}
+
+func (logSender) SendSMS(_ context.Context, to, body string) error {
+	log.Printf("sms to %s: %s", to, body)
+	return nil
+}
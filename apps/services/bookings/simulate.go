@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// Proposed change types accepted by the simulator.
+const (
+	ChangeCapacity = "capacity"
+	ChangeBlackout = "blackout"
+)
+
+// ProposedChange is an operational change to a tour that staff want to dry
+// run. An empty Slot targets every departure on Date.
+type ProposedChange struct {
+	Type     string `json:"type"`
+	Date     string `json:"date"`
+	Slot     string `json:"slot,omitempty"`
+	Capacity int    `json:"capacity,omitempty"`
+}
+
+func (c ProposedChange) validate() error {
+	if _, err := time.Parse(time.DateOnly, c.Date); err != nil {
+		return fmt.Errorf("date must be formatted YYYY-MM-DD")
+	}
+	switch c.Type {
+	case ChangeCapacity:
+		if c.Capacity < 0 {
+			return fmt.Errorf("capacity must not be negative")
+		}
+	case ChangeBlackout:
+	default:
+		return fmt.Errorf("type must be %q or %q", ChangeCapacity, ChangeBlackout)
+	}
+	return nil
+}
+
+// SimulationResult lists what a proposed change would disturb.
+type SimulationResult struct {
+	Change           ProposedChange `json:"change"`
+	AffectedBookings []Booking      `json:"affected_bookings"`
+	AffectedHolds    []BlockHold    `json:"affected_holds"`
+	SeatsOver        int            `json:"seats_over"`
+}
+
+// holdsSeats reports whether a booking currently occupies departure seats.
+func (b Booking) holdsSeats() bool {
+	switch b.Status {
+	case StatusPending, StatusPendingApproval, StatusConfirmed, StatusCheckedIn, StatusNoShow, StatusDisputed:
+		return true
+	}
+	return false
+}
+
+// SimulateChange reports which bookings and agency holds a change would
+// affect, without modifying anything. When capacity shrinks, the earliest
+// bookings keep their seats and later ones are reported, followed by any
+// held seats that no longer fit.
+func (s *Store) SimulateChange(tourID string, c ProposedChange) SimulationResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := SimulationResult{Change: c, AffectedBookings: []Booking{}, AffectedHolds: []BlockHold{}}
+	for key := range s.departures {
+		if key.TourID != tourID || key.Date != c.Date || (c.Slot != "" && key.Slot != c.Slot) {
+			continue
+		}
+		bookings, holds := s.departureOccupantsLocked(key)
+		capacity := 0
+		if c.Type == ChangeCapacity {
+			capacity = c.Capacity
+		}
+
+		used := 0
+		for _, b := range bookings {
+			used += b.PartySize
+			if used > capacity {
+				res.AffectedBookings = append(res.AffectedBookings, b)
+			}
+		}
+		for _, h := range holds {
+			used += h.Outstanding()
+			if used > capacity {
+				res.AffectedHolds = append(res.AffectedHolds, h)
+			}
+		}
+		if used > capacity {
+			res.SeatsOver += used - capacity
+		}
+	}
+	return res
+}
+
+// departureOccupantsLocked returns the seat-holding bookings and active
+// holds on a departure, oldest first. Callers must hold s.mu.
+func (s *Store) departureOccupantsLocked(key departureKey) ([]Booking, []BlockHold) {
+	var bookings []Booking
+	for _, b := range s.bookings {
+		if b.Kind == KindTour && (departureKey{b.OfferingID, b.Date, b.Slot}) == key && b.holdsSeats() {
+			bookings = append(bookings, *b)
+		}
+	}
+	var holds []BlockHold
+	for _, h := range s.holds {
+		if (departureKey{h.TourID, h.Date, h.Slot}) == key && h.Status == HoldActive && h.Outstanding() > 0 {
+			holds = append(holds, *h)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].CreatedAt.Before(bookings[j].CreatedAt.Time) })
+	sort.Slice(holds, func(i, j int) bool { return holds[i].CreatedAt.Before(holds[j].CreatedAt.Time) })
+	return bookings, holds
+}
+
+// simulateChangeHandler dry-runs a capacity cut or blackout and lists the
+// bookings it would conflict with. Nothing is changed.
+func (s *server) simulateChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var c ProposedChange
+	if err := httpkit.DecodeJSON(r, &c); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if err := c.validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_change", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, s.store.SimulateChange(chi.URLParam(r, "tourId"), c))
+}
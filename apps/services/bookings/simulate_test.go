@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+func TestSimulateCapacityReductionListsOverflow(t *testing.T) {
+	s, clock := newTestServer(t)
+	var ids []string
+	for _, party := range []int{3, 4, 2} {
+		b, err := s.store.AddBooking(Booking{
+			Kind: KindTour, OfferingID: "volcano-hike", Date: "2026-03-14", PartySize: party, GuestEmail: "g@example.com",
+		}, clock.now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, b.ID)
+		clock.advance(time.Minute)
+	}
+	before := s.store.Departure("volcano-hike", "2026-03-14", "")
+
+	var res SimulationResult
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours/volcano-hike/simulate", ProposedChange{
+		Type: ChangeCapacity, Date: "2026-03-14", Capacity: 5,
+	}, &res)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The first party of 3 still fits; the later parties of 4 and 2 do not.
+	var got []string
+	for _, b := range res.AffectedBookings {
+		got = append(got, b.ID)
+	}
+	if !reflect.DeepEqual(got, ids[1:]) || res.SeatsOver != 4 {
+		t.Fatalf("affected %v seats over %d, want %v and 4", got, res.SeatsOver, ids[1:])
+	}
+
+	if after := s.store.Departure("volcano-hike", "2026-03-14", ""); after != before {
+		t.Fatalf("departure changed by simulation: %+v -> %+v", before, after)
+	}
+	for _, id := range ids {
+		if b, _ := s.store.Booking(id); b.Status != StatusPending {
+			t.Fatalf("booking %s status %s after simulation", id, b.Status)
+		}
+	}
+}
+
+func TestSimulateBlackoutAffectsEveryBooking(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPendingTour(t, s, 2)
+	hold, err := s.store.CreateBlockHold(tenantkit.DefaultID, "volcano-hike", "2026-03-14", "", "agency-1", 4, s.now(), s.now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res SimulationResult
+	doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours/volcano-hike/simulate", ProposedChange{
+		Type: ChangeBlackout, Date: "2026-03-14",
+	}, &res)
+	if len(res.AffectedBookings) != 1 || res.AffectedBookings[0].ID != b.ID ||
+		len(res.AffectedHolds) != 1 || res.AffectedHolds[0].ID != hold.ID || res.SeatsOver != 6 {
+		t.Fatalf("result = %+v", res)
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrInsufficientCapacity = errors.New("insufficient capacity")
+	ErrHoldExpired          = errors.New("hold expired")
+	ErrHoldInactive         = errors.New("hold is no longer active")
+	ErrInvalidTransition    = errors.New("invalid status transition")
+	ErrBookingLimitReached  = errors.New("guest already holds the maximum number of active bookings")
+	ErrDeparted             = errors.New("departure has already left")
+	// ErrPaymentRecorded means a payment was already applied to the
+	// booking, as when a notice is redelivered.
+	ErrPaymentRecorded = errors.New("payment already recorded")
+	// ErrUnderpaid is returned for a payment below what the booking is due.
+	ErrUnderpaid = errors.New("payment is below the amount due")
+)
+
+// BookingKind distinguishes the three bookable product lines.
+type BookingKind string
+
+const (
+	KindTour       BookingKind = "tour"
+	KindRental     BookingKind = "rental"
+	KindConsulting BookingKind = "consulting"
+)
+
+// BookingStatus is the lifecycle state of a booking.
+type BookingStatus string
+
+const (
+	StatusPending         BookingStatus = "pending"
+	StatusPendingApproval BookingStatus = "pending_approval"
+	StatusConfirmed       BookingStatus = "confirmed"
+	StatusRejected        BookingStatus = "rejected"
+	StatusCancelled       BookingStatus = "cancelled"
+	// StatusFailedNoCapacity marks a paid booking whose seats were lost
+	// before the payment landed; the guest is refunded.
+	StatusFailedNoCapacity BookingStatus = "failed_no_capacity"
+	// StatusCheckedIn marks a confirmed guest admitted by their guide;
+	// StatusNoShow one who never arrived. Both keep their seats.
+	StatusCheckedIn BookingStatus = "checked_in"
+	StatusNoShow    BookingStatus = "no_show"
+	// StatusDisputed marks a booking whose payment the guest has charged
+	// back. It keeps its seats until the dispute is decided.
+	StatusDisputed BookingStatus = "disputed"
+	// StatusPaymentFailed marks a pending booking whose payment failed or
+	// was abandoned; its seats have been freed.
+	StatusPaymentFailed BookingStatus = "payment_failed"
+)
+
+// AddOn is an extra purchased with a booking, such as equipment rental or
+// a meal.
+type AddOn struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// Booking is a single reservation for a tour seat block, rental stay or
+// consulting session, made through one tenant.
+type Booking struct {
+	ID         string      `json:"booking_id"`
+	Tenant     string      `json:"tenant,omitempty"`
+	Kind       BookingKind `json:"kind"`
+	OfferingID string      `json:"offering_id"`
+	Date       string      `json:"date,omitempty"`
+	// CheckOut is the morning a rental guest leaves; Date is their check-in.
+	CheckOut string `json:"check_out,omitempty"`
+	// DurationMinutes is the length of a consulting session starting at
+	// Date and Slot.
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+	Slot            string `json:"slot,omitempty"`
+	// Language is the ISO 639-1 code a tour is held in for the party, and
+	// GuideID the guide assigned to lead it.
+	Language   string        `json:"language,omitempty"`
+	GuideID    string        `json:"guide_id,omitempty"`
+	PartySize  int           `json:"party_size"`
+	GuestName  string        `json:"guest_name,omitempty"`
+	GuestEmail string        `json:"guest_email,omitempty"`
+	GuestPhone string        `json:"guest_phone,omitempty"`
+	Status     BookingStatus `json:"status"`
+	AgencyID   string        `json:"agency_id,omitempty"`
+	HoldID     string        `json:"hold_id,omitempty"`
+	AddOns     []AddOn       `json:"add_ons,omitempty"`
+	// SpecialRequests are the guest's own notes for the guide, such as
+	// dietary or mobility needs.
+	SpecialRequests string `json:"special_requests,omitempty"`
+	// Answers holds the guest's replies to the offering's booking
+	// questions, keyed by question id.
+	Answers map[string]interface{} `json:"answers,omitempty"`
+	// PriceCents is the amount the guest is asked to pay. PriceLocked marks
+	// a price honoured from an earlier quote, such as a waitlist snapshot.
+	PriceCents  int64 `json:"price_cents,omitempty"`
+	PriceLocked bool  `json:"price_locked,omitempty"`
+	// PromoCode is the code redeemed on the booking and DiscountCents what
+	// it took off the price.
+	PromoCode     string `json:"promo_code,omitempty"`
+	DiscountCents int64  `json:"discount_cents,omitempty"`
+	// ReferralCode is the partner code the guest booked with. It is passed
+	// on at checkout, where the payments service validates it and credits
+	// the partner's commission once the booking is paid.
+	ReferralCode string `json:"referral_code,omitempty"`
+	// RatePlan is the commercial plan the booking was sold under; some
+	// plans forbid transfers.
+	RatePlan string `json:"rate_plan,omitempty"`
+	// CheckInToken is encoded in the guest's QR code and presented at
+	// check-in. It is issued on confirmation and rotated on transfer.
+	CheckInToken string           `json:"check_in_token,omitempty"`
+	Transfers    []TransferRecord `json:"transfers,omitempty"`
+	// CheckoutSessionID is the hosted checkout the guest was sent to pay
+	// on, and DepositCents the amount it asked for.
+	CheckoutSessionID string `json:"checkout_session_id,omitempty"`
+	DepositCents      int64  `json:"deposit_cents,omitempty"`
+	// Payment details are filled in once the payments service reports a
+	// successful charge. PaymentRef is the first charge and AmountCents
+	// the total charged; Transactions lists every charge and refund.
+	PaymentRef   string        `json:"payment_ref,omitempty"`
+	AmountCents  int64         `json:"amount_cents,omitempty"`
+	Currency     string        `json:"currency,omitempty"`
+	Transactions []Transaction `json:"transactions,omitempty"`
+	ReviewedBy   string        `json:"reviewed_by,omitempty"`
+	// NoShow records how the booking was closed out when its guest never
+	// checked in.
+	NoShow *NoShowOutcome `json:"no_show,omitempty"`
+	// Dispute is the latest chargeback raised on the booking's payment.
+	Dispute *BookingDispute `json:"dispute,omitempty"`
+	// PaymentFailure is why the booking's payment never completed.
+	PaymentFailure *PaymentFailure `json:"payment_failure,omitempty"`
+	// NotificationFailures lists guest messages that were never delivered,
+	// for support to follow up by hand.
+	NotificationFailures []NotificationFailure `json:"notification_failures,omitempty"`
+	// Anonymized marks a booking whose guest details were scrubbed by the
+	// retention policy.
+	Anonymized bool              `json:"anonymized,omitempty"`
+	Notes      string            `json:"notes,omitempty"`
+	CreatedAt  apitypes.JSONTime `json:"created_at"`
+	UpdatedAt  apitypes.JSONTime `json:"updated_at"`
+}
+
+// Departure is one dated run of a tour and its seat accounting.
+type Departure struct {
+	TourID   string `json:"tour_id"`
+	Date     string `json:"date"`
+	Slot     string `json:"slot,omitempty"`
+	Capacity int    `json:"capacity"`
+	Booked   int    `json:"booked"`
+	Held     int    `json:"held"`
+}
+
+// Remaining is the number of seats still available to the public.
+func (d Departure) Remaining() int {
+	return d.Capacity - d.Booked - d.Held
+}
+
+type departureKey struct {
+	TourID string
+	Date   string
+	Slot   string
+}
+
+// Store is the in-memory source of truth for bookings and tour inventory.
+// Every mutation that touches more than one record happens under a single
+// lock so seat counts and bookings never disagree.
+type Store struct {
+	mu              sync.Mutex
+	defaultCapacity int
+	bookings        map[string]*Booking
+	departures      map[departureKey]*Departure
+	holds           map[string]*BlockHold
+	templates       map[string]ScheduleTemplate
+	waitlist        map[string]*WaitlistEntry
+	waitlistSeq     int
+	questions       map[string]QuestionSchema
+	addOns          map[string]AddOnCatalog
+	promoCodes      map[string]PromoCode
+	blocks          map[string]*MaintenanceBlock
+	timeBlocks      map[string]*TimeBlock
+	tourLanguages   map[string][]string
+	tourRatings     map[string]TourRating
+	guides          map[string]Guide
+
+	// inventory, when set, is reserved against before seats are committed
+	// here; pendingReleases holds seats to hand back to it once s.mu is
+	// released.
+	inventory       SeatInventory
+	pendingReleases []seatRelease
+
+	// maxActivePerGuest caps a guest's pending and confirmed bookings.
+	// Zero means no cap.
+	maxActivePerGuest int
+	// blockedGuests maps the lowercased emails of guests barred from
+	// booking to the dispute that barred them.
+	blockedGuests map[string]string
+}
+
+func NewStore(defaultCapacity int) *Store {
+	return &Store{
+		defaultCapacity: defaultCapacity,
+		bookings:        make(map[string]*Booking),
+		departures:      make(map[departureKey]*Departure),
+		holds:           make(map[string]*BlockHold),
+		templates:       make(map[string]ScheduleTemplate),
+		waitlist:        make(map[string]*WaitlistEntry),
+		questions:       make(map[string]QuestionSchema),
+		addOns:          make(map[string]AddOnCatalog),
+		promoCodes:      make(map[string]PromoCode),
+		blocks:          make(map[string]*MaintenanceBlock),
+		timeBlocks:      make(map[string]*TimeBlock),
+		tourLanguages:   make(map[string][]string),
+		tourRatings:     make(map[string]TourRating),
+		guides:          make(map[string]Guide),
+		blockedGuests:   make(map[string]string),
+	}
+}
+
+// departureLocked returns the departure for key, creating it with the
+// default capacity on first use. Callers must hold s.mu.
+func (s *Store) departureLocked(key departureKey) *Departure {
+	d, ok := s.departures[key]
+	if !ok {
+		d = &Departure{TourID: key.TourID, Date: key.Date, Slot: key.Slot, Capacity: s.defaultCapacity}
+		s.departures[key] = d
+	}
+	return d
+}
+
+// Departure returns a snapshot of a tour departure's seat accounting.
+func (s *Store) Departure(tourID, date, slot string) Departure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.departureLocked(departureKey{tourID, date, slot})
+}
+
+// Booking returns a copy of the booking with the given id.
+func (s *Store) Booking(id string) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	return *b, nil
+}
+
+// AddBooking stores a new pending booking, reserving tour seats when the
+// booking is for a tour departure and assigning a guide who speaks its
+// language, failing with ErrNoGuideAvailable if none can. A rental stay
+// fails with ErrDatesUnavailable when its nights are already booked or
+// blocked, and a consulting session with ErrSlotUnavailable when its time
+// is. Any booking fails with ErrBookingLimitReached when the guest already
+// holds their cap of active bookings, and with ErrGuestBlocked while a
+// dispute bars them.
+func (s *Store) AddBooking(b Booking, now time.Time) (Booking, error) {
+	key := departureKey{b.OfferingID, b.Date, b.Slot}
+	if b.Kind == KindTour {
+		if err := s.reserveShared(key, b.PartySize); err != nil {
+			return Booking{}, err
+		}
+	}
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, blocked := s.blockedGuests[strings.ToLower(b.GuestEmail)]; blocked && b.GuestEmail != "" {
+		if b.Kind == KindTour {
+			s.queueReleaseLocked(key, b.PartySize)
+		}
+		return Booking{}, ErrGuestBlocked
+	}
+	if s.maxActivePerGuest > 0 && b.GuestEmail != "" && s.activeBookingsLocked(b.GuestEmail) >= s.maxActivePerGuest {
+		if b.Kind == KindTour {
+			s.queueReleaseLocked(key, b.PartySize)
+		}
+		return Booking{}, ErrBookingLimitReached
+	}
+	if b.Kind == KindTour {
+		d := s.departureLocked(key)
+		if d.Remaining() < b.PartySize {
+			s.queueReleaseLocked(key, b.PartySize)
+			return Booking{}, ErrInsufficientCapacity
+		}
+		if b.Language != "" {
+			guide, err := s.guideForLocked(key, b.Language)
+			if err != nil {
+				s.queueReleaseLocked(key, b.PartySize)
+				return Booking{}, err
+			}
+			b.GuideID = guide
+		}
+		d.Booked += b.PartySize
+	}
+	if b.Kind == KindRental {
+		if bookings, blocks := s.rentalConflictsLocked(b.OfferingID, b.Date, b.CheckOut); len(bookings) > 0 || len(blocks) > 0 {
+			return Booking{}, ErrDatesUnavailable
+		}
+	}
+	if b.Kind == KindConsulting {
+		start, end := b.sessionSpan()
+		if bookings, blocks := s.consultingConflictsLocked(b.OfferingID, start, end); len(bookings) > 0 || len(blocks) > 0 {
+			return Booking{}, ErrSlotUnavailable
+		}
+	}
+	b.ID = newID()
+	b.Status = StatusPending
+	b.CreatedAt = apitypes.JSONTime{Time: now}
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	s.bookings[b.ID] = &b
+	return b, nil
+}
+
+// LimitActiveBookings caps how many pending or confirmed bookings one guest,
+// identified by email, may hold at once. Zero lifts the cap.
+func (s *Store) LimitActiveBookings(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxActivePerGuest = max
+}
+
+// activeBookingsLocked counts a guest's pending and confirmed bookings.
+// Callers must hold s.mu.
+func (s *Store) activeBookingsLocked(guestEmail string) int {
+	n := 0
+	for _, b := range s.bookings {
+		if !strings.EqualFold(b.GuestEmail, guestEmail) {
+			continue
+		}
+		switch b.Status {
+		case StatusPending, StatusPendingApproval, StatusConfirmed:
+			n++
+		}
+	}
+	return n
+}
+
+// UpdateBooking applies fn to the stored booking under the store lock. If fn
+// returns an error the booking is left untouched.
+func (s *Store) UpdateBooking(id string, now time.Time, fn func(b *Booking) error) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	next := *b
+	if err := fn(&next); err != nil {
+		return Booking{}, err
+	}
+	next.UpdatedAt = apitypes.JSONTime{Time: now}
+	*b = next
+	return next, nil
+}
+
+// PaymentDetails describe a successful charge reported by the payments
+// service.
+type PaymentDetails struct {
+	Kind        TransactionKind
+	Ref         string
+	AmountCents int64
+	Currency    string
+	Reason      string
+}
+
+// RecordPayment attaches a successful payment to a pending booking. Before
+// confirming it re-checks that the booking's tour seats are still covered by
+// the departure's capacity; if they are not, the seats are released and the
+// booking is marked StatusFailedNoCapacity so the caller can refund it.
+// needsApproval parks the booking in StatusPendingApproval instead of
+// confirming it. A TxnBalance payment instead adds to a booking that is
+// already confirmed or awaiting approval and leaves its status alone. A
+// payment whose ref the booking already holds is not applied again; the
+// booking is returned as it stands with ErrPaymentRecorded. Any other
+// payment must cover the deposit checkout asked for, or the whole price
+// when the booking went through no checkout, or ErrUnderpaid is returned
+// and nothing changes.
+func (s *Store) RecordPayment(id string, p PaymentDetails, needsApproval bool, now time.Time) (Booking, error) {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	if b.chargedBy(p.Ref) {
+		return *b, ErrPaymentRecorded
+	}
+	txn := Transaction{Kind: p.Kind, Ref: p.Ref, AmountCents: p.AmountCents, Currency: p.Currency, Reason: p.Reason, At: apitypes.JSONTime{Time: now}}
+	if txn.Kind == "" {
+		txn.Kind = TxnPayment
+	}
+	if txn.Kind == TxnBalance {
+		switch b.Status {
+		case StatusConfirmed, StatusCheckedIn, StatusPendingApproval:
+		default:
+			return Booking{}, ErrInvalidTransition
+		}
+		b.AmountCents += p.AmountCents
+		b.Transactions = append(b.Transactions, txn)
+		b.UpdatedAt = apitypes.JSONTime{Time: now}
+		return *b, nil
+	}
+	if b.Status != StatusPending {
+		return Booking{}, ErrInvalidTransition
+	}
+	if p.AmountCents < b.amountDue() {
+		return Booking{}, ErrUnderpaid
+	}
+	b.PaymentRef = p.Ref
+	b.AmountCents = p.AmountCents
+	b.Currency = p.Currency
+	b.Transactions = append(b.Transactions, txn)
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+
+	switch {
+	case !s.reservationHeldLocked(b):
+		s.releaseBookingLocked(b)
+		b.Status = StatusFailedNoCapacity
+	case needsApproval:
+		b.Status = StatusPendingApproval
+	default:
+		b.Status = StatusConfirmed
+		b.CheckInToken = newCheckInToken()
+	}
+	return *b, nil
+}
+
+// amountDue is the least a first payment must bring in: the deposit
+// checkout asked for, else the price.
+func (b *Booking) amountDue() int64 {
+	if b.DepositCents > 0 {
+		return b.DepositCents
+	}
+	return b.PriceCents
+}
+
+// reservationHeldLocked reports whether a booking's seats still fit within
+// its departure. A departure whose capacity was cut below what is booked and
+// held is oversold, and the booking being paid for loses its seats. Callers
+// must hold s.mu.
+func (s *Store) reservationHeldLocked(b *Booking) bool {
+	if b.Kind != KindTour {
+		return true
+	}
+	return s.departureLocked(departureKey{b.OfferingID, b.Date, b.Slot}).Remaining() >= 0
+}
+
+// releaseBookingLocked returns a tour booking's seats to its departure and
+// queues their release from the shared inventory. Callers must hold s.mu
+// and defer s.flushReleases.
+func (s *Store) releaseBookingLocked(b *Booking) {
+	if b.Kind == KindTour {
+		key := departureKey{b.OfferingID, b.Date, b.Slot}
+		s.departureLocked(key).Booked -= b.PartySize
+		s.queueReleaseLocked(key, b.PartySize)
+	}
+}
+
+// RejectBooking declines a booking awaiting approval and frees its seats.
+func (s *Store) RejectBooking(id, staffID, reason string, now time.Time) (Booking, error) {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	if b.Status != StatusPendingApproval {
+		return Booking{}, ErrInvalidTransition
+	}
+	s.releaseBookingLocked(b)
+	b.Status = StatusRejected
+	b.ReviewedBy = staffID
+	b.Notes = reason
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	return *b, nil
+}
+
+// CancelBooking cancels a booking and returns any tour seats to inventory.
+func (s *Store) CancelBooking(id string, now time.Time) (Booking, error) {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	switch b.Status {
+	case StatusCancelled, StatusRejected, StatusFailedNoCapacity, StatusCheckedIn, StatusNoShow, StatusPaymentFailed:
+		return Booking{}, ErrInvalidTransition
+	}
+	s.releaseBookingLocked(b)
+	b.Status = StatusCancelled
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	return *b, nil
+}
+
+// newCheckInToken returns an unguessable token for a booking's QR code.
+func newCheckInToken() string {
+	var b [18]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// newID returns a random RFC 4122 version 4 UUID.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
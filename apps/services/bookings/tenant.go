@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// Tenant is one brand the platform serves: a regional marketplace with its
+// own currency, web origins and branding. Bookings made for one tenant are
+// invisible to every other.
+type Tenant struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Currency    string   `json:"currency"`
+	CORSOrigins []string `json:"cors_origins"`
+	Branding    Branding `json:"branding"`
+}
+
+func (t Tenant) TenantID() string         { return t.ID }
+func (t Tenant) AllowedOrigins() []string { return t.CORSOrigins }
+
+// Branding is how a tenant's storefront and messages present it.
+type Branding struct {
+	LogoURL      string `json:"logo_url,omitempty"`
+	PrimaryColor string `json:"primary_color,omitempty"`
+	SupportEmail string `json:"support_email,omitempty"`
+}
+
+// Tenants are the brands served, by id.
+type Tenants = tenantkit.Tenants[Tenant]
+
+// builtinTenant is the single tenant served without a tenants file.
+var builtinTenant = Tenant{
+	ID:          tenantkit.DefaultID,
+	Name:        "PupuserIA",
+	Currency:    "USD",
+	CORSOrigins: tenantkit.LocalOrigins,
+}
+
+// loadTenants reads the tenants from the JSON file at path, which maps
+// tenant ids to their settings: {"pupuseria": {"name": "PupuserIA",
+// "currency": "USD", "cors_origins": ["https://pupuseria.sv"]}}. Without a
+// file the built-in PupuserIA tenant is served. defaultID, when set, must
+// name one of the tenants.
+func loadTenants(path, defaultID string) (Tenants, error) {
+	return tenantkit.Load(path, defaultID, builtinTenant, func(id string, t Tenant) (Tenant, error) {
+		t.ID = id
+		t.Currency = strings.ToUpper(t.Currency)
+		if len(t.Currency) != 3 {
+			return t, errors.New("needs a three-letter currency")
+		}
+		return t, nil
+	})
+}
+
+// owns reports whether b belongs to tenant. Bookings made before tenants
+// were recorded belong to the default tenant.
+func owns(tenants Tenants, tenant Tenant, b Booking) bool {
+	return b.Tenant == tenant.ID || (b.Tenant == "" && tenant.ID == tenants.Default().ID)
+}
+
+// tenant returns the tenant ctx's request is for, or the default tenant
+// outside a request.
+func (s *server) tenant(ctx context.Context) Tenant {
+	if tenant, ok := tenantkit.FromContext[Tenant](ctx); ok {
+		return tenant
+	}
+	return s.cfg.Tenants.Default()
+}
+
+// requireTenantBooking answers 404 for a booking of another tenant, just as
+// for one that does not exist, so tenants cannot learn of each other's
+// bookings.
+func (s *server) requireTenantBooking(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := s.store.Booking(chi.URLParam(r, "bookingId"))
+		if err == nil && !owns(s.cfg.Tenants, s.tenant(r.Context()), b) {
+			err = ErrNotFound
+		}
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantHandler describes the tenant the request is for, so storefronts can
+// brand themselves and price in its currency.
+func (s *server) tenantHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.tenant(r.Context()))
+}
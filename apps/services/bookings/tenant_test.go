@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+const testTenants = `{
+	"pupuseria": {"name": "PupuserIA", "currency": "usd", "cors_origins": ["https://pupuseria.sv"]},
+	"volcanica": {"name": "Volcánica", "currency": "EUR", "cors_origins": ["https://volcanica.example"],
+		"branding": {"logo_url": "https://volcanica.example/logo.svg", "primary_color": "#c0392b"}}
+}`
+
+// newTenantTestServer serves PupuserIA, the default, and Volcánica.
+func newTenantTestServer(t *testing.T) (*server, http.Handler) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(testTenants), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestServer(t)
+	tenants, err := loadTenants(path, "pupuseria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.Tenants = tenants
+	return s, s.routes()
+}
+
+// tenantJSON is doJSON for the tenant named in the X-Tenant-ID header.
+func tenantJSON(t *testing.T, h http.Handler, tenant, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if tenant != "" {
+		req.Header.Set(tenantkit.Header, tenant)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func TestTenantCannotReadAnotherTenantsBookings(t *testing.T) {
+	_, h := newTenantTestServer(t)
+	var b Booking
+	rec := tenantJSON(t, h, "volcanica", http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "party_size": 2, "customer_email": "ana@example.com",
+	}, &b)
+	if rec.Code != http.StatusCreated || b.Tenant != "volcanica" {
+		t.Fatalf("book: status %d booking %+v", rec.Code, b)
+	}
+
+	for _, path := range []string{"/api/bookings/tours/" + b.ID, "/api/bookings/" + b.ID + "/checkout/preview"} {
+		if rec := tenantJSON(t, h, "volcanica", http.MethodGet, path, nil, nil); rec.Code != http.StatusOK {
+			t.Errorf("owner GET %s: status %d", path, rec.Code)
+		}
+		// The default tenant, asked for by name or by omission, sees nothing.
+		for _, other := range []string{"pupuseria", ""} {
+			if rec := tenantJSON(t, h, other, http.MethodGet, path, nil, nil); rec.Code != http.StatusNotFound {
+				t.Errorf("tenant %q GET %s: status %d, want 404", other, path, rec.Code)
+			}
+		}
+	}
+	if rec := tenantJSON(t, h, "pupuseria", http.MethodPut, "/api/bookings/tours/"+b.ID+"/cancel", nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("other tenant cancelled: status %d", rec.Code)
+	}
+
+	// A subdomain names the tenant as well as the header does.
+	req := httptest.NewRequest(http.MethodGet, "/api/bookings/tours/"+b.ID, nil)
+	req.Host = "volcanica.marketplace.example"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("subdomain GET: status %d", rec.Code)
+	}
+}
+
+func TestUnknownTenantIsRejected(t *testing.T) {
+	_, h := newTenantTestServer(t)
+	var body map[string]string
+	rec := tenantJSON(t, h, "acme", http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "party_size": 2,
+	}, &body)
+	if rec.Code != http.StatusNotFound || body["error"] != "unknown_tenant" {
+		t.Fatalf("status %d resp %v, want 404 unknown_tenant", rec.Code, body)
+	}
+}
+
+func TestTenantConfigIsApplied(t *testing.T) {
+	s, h := newTenantTestServer(t)
+	var tenant Tenant
+	tenantJSON(t, h, "volcanica", http.MethodGet, "/api/bookings/tenant", nil, &tenant)
+	if tenant.Name != "Volcánica" || tenant.Currency != "EUR" || tenant.Branding.PrimaryColor != "#c0392b" {
+		t.Fatalf("tenant = %+v", tenant)
+	}
+
+	// Checkout charges in the tenant's currency.
+	var b Booking
+	tenantJSON(t, h, "volcanica", http.MethodPost, "/api/bookings/tours", map[string]interface{}{
+		"tour_id": "volcano-hike", "date": "2026-03-14", "party_size": 2,
+	}, &b)
+	s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.PriceCents = 9000
+		return nil
+	})
+	if rec := tenantJSON(t, h, "volcanica", http.MethodPost, "/api/bookings/"+b.ID+"/checkout", nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := s.payments.(*fakePayments).checkouts; len(got) != 1 || got[0].Currency != "EUR" {
+		t.Fatalf("checkouts %+v, want one in EUR", got)
+	}
+
+	// Browsers are only let in from the tenant's own origins.
+	for origin, want := range map[string]string{"https://volcanica.example": "https://volcanica.example", "https://pupuseria.sv": ""} {
+		req := httptest.NewRequest(http.MethodOptions, "/api/bookings/tenant", nil)
+		req.Header.Set(tenantkit.Header, "volcanica")
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Errorf("preflight from %s allowed %q, want %q", origin, got, want)
+		}
+	}
+}
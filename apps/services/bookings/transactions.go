@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var ErrRefundExceedsPaid = errors.New("refund exceeds the amount paid less earlier refunds")
+
+// TransactionKind classifies money moving for a booking.
+type TransactionKind string
+
+const (
+	// TxnPayment pays for a booking in full.
+	TxnPayment TransactionKind = "payment"
+	// TxnDeposit secures a booking with part of its price; TxnBalance pays
+	// some or all of the rest later.
+	TxnDeposit TransactionKind = "deposit"
+	TxnBalance TransactionKind = "balance"
+	// TxnRefund returns money to the guest.
+	TxnRefund TransactionKind = "refund"
+)
+
+// Transaction is one charge or refund against a booking. Amounts are
+// positive whichever way the money moved.
+type Transaction struct {
+	Kind        TransactionKind   `json:"kind"`
+	Ref         string            `json:"payment_ref"`
+	AmountCents int64             `json:"amount_cents"`
+	Currency    string            `json:"currency"`
+	Reason      string            `json:"reason,omitempty"`
+	At          apitypes.JSONTime `json:"at"`
+}
+
+// PaymentSummary consolidates a booking's transactions. Money charged on a
+// booking awaiting staff approval is held rather than paid until it is
+// approved. The outstanding balance is what the guest still owes on the
+// price after refunds; a cancelled, rejected or failed booking owes
+// nothing.
+type PaymentSummary struct {
+	BookingID        string        `json:"booking_id"`
+	Status           BookingStatus `json:"status"`
+	Currency         string        `json:"currency,omitempty"`
+	DueCents         int64         `json:"due_cents"`
+	PaidCents        int64         `json:"paid_cents"`
+	HeldCents        int64         `json:"held_cents"`
+	RefundedCents    int64         `json:"refunded_cents"`
+	OutstandingCents int64         `json:"outstanding_cents"`
+	Transactions     []Transaction `json:"transactions"`
+}
+
+// paymentSummary totals b's transactions. An unpriced booking is due
+// whatever was charged for it.
+func (b Booking) paymentSummary() PaymentSummary {
+	sum := PaymentSummary{
+		BookingID:    b.ID,
+		Status:       b.Status,
+		Currency:     b.Currency,
+		DueCents:     b.PriceCents,
+		Transactions: append([]Transaction{}, b.Transactions...),
+	}
+	var charged int64
+	for _, t := range b.Transactions {
+		if t.Kind == TxnRefund {
+			sum.RefundedCents += t.AmountCents
+		} else {
+			charged += t.AmountCents
+		}
+	}
+	if sum.DueCents == 0 {
+		sum.DueCents = charged
+	}
+	if b.Status == StatusPendingApproval {
+		sum.HeldCents = charged
+	} else {
+		sum.PaidCents = charged
+	}
+	switch b.Status {
+	case StatusCancelled, StatusRejected, StatusFailedNoCapacity, StatusPaymentFailed:
+	default:
+		sum.OutstandingCents = max(0, sum.DueCents-charged+sum.RefundedCents)
+	}
+	return sum
+}
+
+// refundedCents is what has already been returned to b's guest.
+func (b Booking) refundedCents() int64 {
+	var refunded int64
+	for _, t := range b.Transactions {
+		if t.Kind == TxnRefund {
+			refunded += t.AmountCents
+		}
+	}
+	return refunded
+}
+
+// chargedBy reports whether b already holds a charge with ref.
+func (b Booking) chargedBy(ref string) bool {
+	for _, t := range b.Transactions {
+		if t.Kind != TxnRefund && t.Ref == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordRefund adds a refund to a booking's transactions. It cannot return
+// more than the guest has paid.
+func (s *Store) RecordRefund(id string, t Transaction, now time.Time) (Booking, error) {
+	t.Kind, t.At = TxnRefund, apitypes.JSONTime{Time: now}
+	return s.UpdateBooking(id, now, func(b *Booking) error {
+		if t.AmountCents > b.AmountCents-b.refundedCents() {
+			return ErrRefundExceedsPaid
+		}
+		b.Transactions = append(b.Transactions, t)
+		return nil
+	})
+}
+
+// refund asks the payments service to return money for a cancelled
+// booking and reports the outcome as "requested" or "failed". A failed
+// refund leaves the cancellation standing; support reconciles it manually.
+func (s *server) refund(ctx context.Context, req RefundRequest) string {
+	if err := s.payments.Refund(ctx, req); err != nil {
+		log.Printf("refund for cancelled booking %s failed: %v", req.BookingID, err)
+		return "failed"
+	}
+	s.refundRequested(req)
+	return "requested"
+}
+
+// refundRequested records a refund the payments service accepted. The
+// refund has already been issued, so failing to record it only leaves the
+// booking's summary stale.
+func (s *server) refundRequested(req RefundRequest) {
+	_, err := s.store.RecordRefund(req.BookingID, Transaction{
+		Ref:         req.PaymentRef,
+		AmountCents: req.AmountCents,
+		Currency:    req.Currency,
+		Reason:      req.Reason,
+	}, s.now())
+	if err != nil {
+		log.Printf("ALERT: recording refund of %d cents for booking %s: %v", req.AmountCents, req.BookingID, err)
+	}
+}
+
+// recordRefundHandler records a refund the payments service issued outside
+// a cancellation, such as a goodwill credit on a booking that goes ahead.
+func (s *server) recordRefundHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PaymentRef  string `json:"payment_ref"`
+		AmountCents int64  `json:"amount_cents"`
+		Currency    string `json:"currency"`
+		Reason      string `json:"reason"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.PaymentRef == "" || req.AmountCents <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_refund", "payment_ref and a positive amount_cents are required")
+		return
+	}
+	b, err := s.store.RecordRefund(chi.URLParam(r, "bookingId"), Transaction{
+		Ref:         req.PaymentRef,
+		AmountCents: req.AmountCents,
+		Currency:    req.Currency,
+		Reason:      req.Reason,
+	}, s.now())
+	if errors.Is(err, ErrRefundExceedsPaid) {
+		respondError(w, http.StatusUnprocessableEntity, "refund_exceeds_paid", err.Error())
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, b.paymentSummary())
+}
+
+func (s *server) getPaymentSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store.Booking(chi.URLParam(r, "bookingId"))
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, b.paymentSummary())
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func postPayment(t *testing.T, s *server, id string, kind TransactionKind, ref string, cents int64) *httptest.ResponseRecorder {
+	t.Helper()
+	return doService(t, s.routes(), http.MethodPost, "/api/bookings/"+id+"/payment", map[string]interface{}{
+		"kind": kind, "payment_ref": ref, "amount_cents": cents, "currency": "USD",
+	}, nil)
+}
+
+// askDeposit records that checkout asked for a deposit of cents on the
+// booking, as createCheckoutHandler does.
+func askDeposit(t *testing.T, s *server, id string, cents int64) {
+	t.Helper()
+	if _, err := s.store.UpdateBooking(id, s.now(), func(b *Booking) error {
+		b.DepositCents = cents
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func paymentSummary(t *testing.T, s *server, id string) PaymentSummary {
+	t.Helper()
+	var got PaymentSummary
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/bookings/tours/"+id+"/payments", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("summary: status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func TestPaymentSummaryDepositPartialRefundAndBalance(t *testing.T) {
+	s, clock := newTestServer(t)
+	b := seedPricedTour(t, s)
+	askDeposit(t, s, b.ID, 3000)
+
+	if res := postPayment(t, s, b.ID, TxnDeposit, "pi_deposit", 3000); res.Code != http.StatusOK {
+		t.Fatalf("deposit: status %d: %s", res.Code, res.Body)
+	}
+	clock.advance(time.Hour)
+	rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/refund", map[string]interface{}{
+		"payment_ref": "pi_deposit", "amount_cents": 500, "currency": "USD", "reason": "goodwill",
+	}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refund: status %d: %s", rec.Code, rec.Body)
+	}
+
+	got := paymentSummary(t, s, b.ID)
+	if got.Status != StatusConfirmed || got.DueCents != 9000 || got.PaidCents != 3000 || got.HeldCents != 0 ||
+		got.RefundedCents != 500 || got.OutstandingCents != 6500 {
+		t.Fatalf("summary = %+v", got)
+	}
+	if len(got.Transactions) != 2 || got.Transactions[0].Kind != TxnDeposit || got.Transactions[1].Kind != TxnRefund ||
+		got.Transactions[1].Reason != "goodwill" {
+		t.Fatalf("transactions = %+v", got.Transactions)
+	}
+
+	// Paying the balance settles the booking.
+	if res := postPayment(t, s, b.ID, TxnBalance, "pi_balance", 6500); res.Code != http.StatusOK {
+		t.Fatalf("balance: status %d: %s", res.Code, res.Body)
+	}
+	got = paymentSummary(t, s, b.ID)
+	if got.PaidCents != 9500 || got.OutstandingCents != 0 || len(got.Transactions) != 3 {
+		t.Fatalf("after balance = %+v", got)
+	}
+}
+
+func TestPaymentSummaryHoldsFundsAwaitingApproval(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.ApprovalThresholdCents = 1000
+	b := seedPricedTour(t, s)
+	postPayment(t, s, b.ID, TxnPayment, "pi_full", 9000)
+
+	got := paymentSummary(t, s, b.ID)
+	if got.Status != StatusPendingApproval || got.HeldCents != 9000 || got.PaidCents != 0 || got.OutstandingCents != 0 {
+		t.Fatalf("summary = %+v", got)
+	}
+}
+
+func TestPaymentSummaryRecordsCancellationRefund(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPricedTour(t, s)
+	postPayment(t, s, b.ID, TxnPayment, "pi_full", 9000)
+	if got := cancelTour(t, s, b.ID); got.RefundStatus != "requested" {
+		t.Fatalf("refund status %q", got.RefundStatus)
+	}
+
+	got := paymentSummary(t, s, b.ID)
+	if got.RefundedCents != 9000 || got.OutstandingCents != 0 || got.Transactions[1].Reason != "guest_cancelled_policy" {
+		t.Fatalf("summary = %+v", got)
+	}
+}
+
+func TestRecordRefundCannotExceedPaid(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPricedTour(t, s)
+	askDeposit(t, s, b.ID, 3000)
+	postPayment(t, s, b.ID, TxnDeposit, "pi_deposit", 3000)
+
+	rec := doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/refund", map[string]interface{}{
+		"payment_ref": "pi_deposit", "amount_cents": 3001, "currency": "USD",
+	}, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
+
+func TestBalancePaymentFollowsDeposit(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPricedTour(t, s)
+	if res := postPayment(t, s, b.ID, TxnBalance, "pi_balance", 3000); res.Code != http.StatusConflict {
+		t.Fatalf("balance before any deposit: status %d, want 409", res.Code)
+	}
+	askDeposit(t, s, b.ID, 3000)
+	postPayment(t, s, b.ID, TxnDeposit, "pi_deposit", 3000)
+	if res := postPayment(t, s, b.ID, TxnDeposit, "pi_deposit_2", 3000); res.Code != http.StatusConflict {
+		t.Fatalf("deposit on confirmed booking: status %d, want 409", res.Code)
+	}
+}
+
+func TestUnderpaymentIsRejected(t *testing.T) {
+	s, _ := newTestServer(t)
+	b := seedPricedTour(t, s)
+
+	// Without a checkout the whole price is due.
+	rec := postPayment(t, s, b.ID, TxnPayment, "pi_short", 8999)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("payment below the price: status %d, want 422: %s", rec.Code, rec.Body)
+	}
+	askDeposit(t, s, b.ID, 3000)
+	if rec := postPayment(t, s, b.ID, TxnDeposit, "pi_short_deposit", 2999); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("payment below the deposit: status %d, want 422: %s", rec.Code, rec.Body)
+	}
+	got, err := s.store.Booking(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusPending || got.PaymentRef != "" || len(got.Transactions) != 0 {
+		t.Fatalf("underpaid booking = %+v, want it untouched", got)
+	}
+	if rec := postPayment(t, s, b.ID, TxnDeposit, "pi_deposit", 3000); rec.Code != http.StatusOK {
+		t.Fatalf("deposit: status %d: %s", rec.Code, rec.Body)
+	}
+}
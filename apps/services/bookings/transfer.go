@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// ErrNotTransferable is returned when a booking's rate plan forbids
+// transfers.
+var ErrNotTransferable = errors.New("booking is not transferable")
+
+// GuestContact is who a booking belongs to.
+type GuestContact struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// TransferRecord logs one change of guest on a booking.
+type TransferRecord struct {
+	From          GuestContact      `json:"from"`
+	To            GuestContact      `json:"to"`
+	TransferredAt apitypes.JSONTime `json:"transferred_at"`
+}
+
+// TransferBooking reassigns a booking to a new guest. The old check-in token
+// stops working and a new one is issued when the booking is confirmed.
+func (s *Store) TransferBooking(id string, kind BookingKind, to GuestContact, nonTransferable map[string]bool, now time.Time) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok || b.Kind != kind {
+		return Booking{}, ErrNotFound
+	}
+	switch b.Status {
+	case StatusPending, StatusPendingApproval, StatusConfirmed:
+	default:
+		return Booking{}, ErrInvalidTransition
+	}
+	if nonTransferable[b.RatePlan] {
+		return Booking{}, ErrNotTransferable
+	}
+
+	b.Transfers = append(b.Transfers, TransferRecord{
+		From:          GuestContact{Name: b.GuestName, Email: b.GuestEmail, Phone: b.GuestPhone},
+		To:            to,
+		TransferredAt: apitypes.JSONTime{Time: now},
+	})
+	b.GuestName, b.GuestEmail, b.GuestPhone = to.Name, to.Email, to.Phone
+	b.CheckInToken = ""
+	if b.Status == StatusConfirmed {
+		b.CheckInToken = newCheckInToken()
+	}
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	return *b, nil
+}
+
+// BookingByCheckInToken finds the booking a QR code belongs to.
+func (s *Store) BookingByCheckInToken(token string) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bookingByCheckInTokenLocked(token)
+	if b == nil {
+		return Booking{}, ErrNotFound
+	}
+	return *b, nil
+}
+
+// CheckIn admits the guest holding a QR code to their departure. Only
+// confirmed bookings can be checked in.
+func (s *Store) CheckIn(token string, now time.Time) (Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bookingByCheckInTokenLocked(token)
+	if b == nil {
+		return Booking{}, ErrNotFound
+	}
+	if b.Status != StatusConfirmed {
+		return Booking{}, ErrInvalidTransition
+	}
+	b.Status = StatusCheckedIn
+	b.UpdatedAt = apitypes.JSONTime{Time: now}
+	return *b, nil
+}
+
+// bookingByCheckInTokenLocked returns the booking issued token, or nil.
+// Callers must hold s.mu.
+func (s *Store) bookingByCheckInTokenLocked(token string) *Booking {
+	if token == "" {
+		return nil
+	}
+	for _, b := range s.bookings {
+		if b.CheckInToken == token {
+			return b
+		}
+	}
+	return nil
+}
+
+// transferBookingHandler hands a booking of the given kind to another guest
+// and sends them a fresh confirmation.
+func (s *server) transferBookingHandler(kind BookingKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var to GuestContact
+		if err := httpkit.DecodeJSON(r, &to); err != nil {
+			httpkit.RespondDecodeError(w, err)
+			return
+		}
+		if to.Name == "" || to.Email == "" {
+			respondError(w, http.StatusBadRequest, "invalid_guest", "name and email are required")
+			return
+		}
+		if to.Phone != "" && !validE164(to.Phone) {
+			respondError(w, http.StatusUnprocessableEntity, "invalid_phone", "phone must be in E.164 format, e.g. +50370001234")
+			return
+		}
+
+		b, err := s.store.TransferBooking(chi.URLParam(r, "bookingId"), kind, to, s.cfg.NonTransferablePlans, s.now())
+		if errors.Is(err, ErrNotTransferable) {
+			respondError(w, http.StatusForbidden, "not_transferable", "this booking's plan does not allow transfers")
+			return
+		}
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		last := b.Transfers[len(b.Transfers)-1]
+		log.Printf("booking %s transferred from %s to %s", b.ID, last.From.Email, last.To.Email)
+		if b.Status == StatusConfirmed {
+			s.notify(r.Context(), TemplateBookingConfirmed, b)
+		}
+		respondJSON(w, http.StatusOK, b)
+	}
+}
+
+// checkInHandler resolves a scanned QR code to its booking.
+func (s *server) checkInHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store.BookingByCheckInToken(chi.URLParam(r, "token"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "invalid_token", "check-in token is not valid")
+		return
+	}
+	respondJSON(w, http.StatusOK, b)
+}
+
+// admitGuestHandler checks in the guest whose QR code a guide scanned.
+func (s *server) admitGuestHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store.CheckIn(chi.URLParam(r, "token"), s.now())
+	switch {
+	case errors.Is(err, ErrNotFound):
+		respondError(w, http.StatusNotFound, "invalid_token", "check-in token is not valid")
+	case err != nil:
+		respondStoreError(w, err)
+	default:
+		respondJSON(w, http.StatusOK, b)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func seedConfirmedTour(t *testing.T, s *server) Booking {
+	t.Helper()
+	b := seedPendingTour(t, s, 2)
+	var confirmed Booking
+	doService(t, s.routes(), http.MethodPost, "/api/bookings/"+b.ID+"/payment", map[string]interface{}{
+		"payment_ref": "cs_t", "amount_cents": 9000, "currency": "USD",
+	}, &confirmed)
+	if confirmed.Status != StatusConfirmed || confirmed.CheckInToken == "" {
+		t.Fatalf("seed: booking %+v, want confirmed with a check-in token", confirmed)
+	}
+	return confirmed
+}
+
+func TestTransferReissuesTokens(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.routes()
+	b := seedConfirmedTour(t, s)
+	oldToken := b.CheckInToken
+
+	var got Booking
+	rec := doJSON(t, h, http.MethodPost, "/api/bookings/tours/"+b.ID+"/transfer", GuestContact{
+		Name: "Luis", Email: "luis@example.com", Phone: "+50370001234",
+	}, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got.GuestEmail != "luis@example.com" || got.CheckInToken == "" || got.CheckInToken == oldToken {
+		t.Fatalf("booking = %+v, want new guest and rotated token", got)
+	}
+	if len(got.Transfers) != 1 || got.Transfers[0].From.Email != "ana@example.com" {
+		t.Fatalf("transfers = %+v", got.Transfers)
+	}
+
+	if rec := doJSON(t, h, http.MethodGet, "/api/bookings/check-in/"+oldToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("old token: status %d, want 404", rec.Code)
+	}
+	var checkedIn Booking
+	if rec := doJSON(t, h, http.MethodGet, "/api/bookings/check-in/"+got.CheckInToken, nil, &checkedIn); rec.Code != http.StatusOK || checkedIn.ID != b.ID {
+		t.Fatalf("new token: status %d booking %s", rec.Code, checkedIn.ID)
+	}
+
+	emails := sentMessages(s).emails
+	if last := emails[len(emails)-1]; last.To != "luis@example.com" {
+		t.Fatalf("confirmation sent to %s, want the new guest", last.To)
+	}
+}
+
+func TestTransferRejectedForNonTransferablePlan(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.NonTransferablePlans = map[string]bool{"non_refundable": true}
+	b := seedConfirmedTour(t, s)
+	s.store.UpdateBooking(b.ID, s.now(), func(b *Booking) error {
+		b.RatePlan = "non_refundable"
+		return nil
+	})
+
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours/"+b.ID+"/transfer", GuestContact{
+		Name: "Luis", Email: "luis@example.com",
+	}, nil)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", rec.Code)
+	}
+	if after, _ := s.store.Booking(b.ID); after.GuestEmail != "ana@example.com" || after.CheckInToken != b.CheckInToken {
+		t.Fatalf("booking changed by rejected transfer: %+v", after)
+	}
+}
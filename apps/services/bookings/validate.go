@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// FieldError is one problem with one field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything wrong with a request body, so a client
+// can fix every field in one round trip.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + " " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+// bookingFields are the parts of a booking request every kind of booking
+// is checked for. The names are the request's JSON field names, so errors
+// point at what the client sent.
+type bookingFields struct {
+	OfferingField string
+	OfferingID    string
+	DateField     string
+	Date          string
+	// CheckOut, when CheckOutField is set, ends a stay starting on Date.
+	CheckOutField string
+	CheckOut      string
+	PartySize     int
+	// EmailField names the guest email field, guest_email unless set.
+	EmailField string
+	GuestEmail string
+}
+
+// validateBooking checks f's required fields and formats, returning a
+// *ValidationError naming each field at fault, or nil. Dates are RFC 3339
+// full dates, YYYY-MM-DD; a guest email is optional but must be a bare
+// address when given.
+func validateBooking(f bookingFields) error {
+	var v ValidationError
+	if strings.TrimSpace(f.OfferingID) == "" {
+		v.add(f.OfferingField, "is required")
+	}
+	date, err := time.Parse(time.DateOnly, f.Date)
+	if err != nil {
+		v.add(f.DateField, "must be a date formatted YYYY-MM-DD")
+	}
+	if f.CheckOutField != "" {
+		if checkOut, err := time.Parse(time.DateOnly, f.CheckOut); err != nil {
+			v.add(f.CheckOutField, "must be a date formatted YYYY-MM-DD")
+		} else if _, _, ok := parseNights(f.Date, f.CheckOut); !ok && !date.IsZero() {
+			if checkOut.After(date) {
+				v.add(f.CheckOutField, fmt.Sprintf("must be within %d nights of %s", maxAvailabilityNights, f.DateField))
+			} else {
+				v.add(f.CheckOutField, "must be after "+f.DateField)
+			}
+		}
+	}
+	if f.PartySize < 1 {
+		v.add("party_size", "must be at least 1")
+	}
+	if f.GuestEmail != "" {
+		field := f.EmailField
+		if field == "" {
+			field = "guest_email"
+		}
+		if addr, err := mail.ParseAddress(f.GuestEmail); err != nil || addr.Address != f.GuestEmail {
+			v.add(field, "must be an email address such as ana@example.com")
+		}
+	}
+	if len(v.Errors) > 0 {
+		return &v
+	}
+	return nil
+}
+
+// respondValidationError writes a 422 for an error from validateBooking,
+// listing each field at fault alongside the standard error envelope.
+func respondValidationError(w http.ResponseWriter, err error) {
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_booking", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":   "invalid_booking",
+		"message": ve.Error(),
+		"errors":  ve.Errors,
+	})
+}
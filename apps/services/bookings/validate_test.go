@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestBookingValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		body map[string]interface{}
+		want []FieldError
+	}{
+		{"tour without id", "/api/bookings/tours",
+			map[string]interface{}{"date": "2026-03-14", "party_size": 2},
+			[]FieldError{{"tour_id", "is required"}}},
+		{"tour with malformed date", "/api/bookings/tours",
+			map[string]interface{}{"tour_id": "volcano-hike", "date": "14/03/2026", "party_size": 2},
+			[]FieldError{{"date", "must be a date formatted YYYY-MM-DD"}}},
+		{"tour for nobody", "/api/bookings/tours",
+			map[string]interface{}{"tour_id": "volcano-hike", "date": "2026-03-14", "party_size": 0},
+			[]FieldError{{"party_size", "must be at least 1"}}},
+		{"tour with bad email", "/api/bookings/tours",
+			map[string]interface{}{"tour_id": "volcano-hike", "date": "2026-03-14", "party_size": 2, "customer_email": "ana at example"},
+			[]FieldError{{"customer_email", "must be an email address such as ana@example.com"}}},
+		{"tour missing everything", "/api/bookings/tours",
+			map[string]interface{}{"customer_email": "Ana <ana@example.com>"},
+			[]FieldError{
+				{"tour_id", "is required"},
+				{"date", "must be a date formatted YYYY-MM-DD"},
+				{"party_size", "must be at least 1"},
+				{"customer_email", "must be an email address such as ana@example.com"},
+			}},
+		{"rental without property", "/api/bookings/rentals",
+			map[string]interface{}{"check_in": "2026-04-01", "check_out": "2026-04-03", "party_size": 2},
+			[]FieldError{{"property_id", "is required"}}},
+		{"rental with malformed check_out", "/api/bookings/rentals",
+			map[string]interface{}{"property_id": "casa-playa", "check_in": "2026-04-01", "check_out": "2026-04-03T10:00:00Z", "party_size": 2},
+			[]FieldError{{"check_out", "must be a date formatted YYYY-MM-DD"}}},
+		{"rental ending before it starts", "/api/bookings/rentals",
+			map[string]interface{}{"property_id": "casa-playa", "check_in": "2026-04-03", "check_out": "2026-04-03", "party_size": 2},
+			[]FieldError{{"check_out", "must be after check_in"}}},
+		{"rental over a year", "/api/bookings/rentals",
+			map[string]interface{}{"property_id": "casa-playa", "check_in": "2026-04-01", "check_out": "2027-04-03", "party_size": 2},
+			[]FieldError{{"check_out", "must be within 366 nights of check_in"}}},
+		{"rental for nobody", "/api/bookings/rentals",
+			map[string]interface{}{"property_id": "casa-playa", "check_in": "2026-04-01", "check_out": "2026-04-03"},
+			[]FieldError{{"party_size", "must be at least 1"}}},
+		{"consulting without consultant", "/api/bookings/consulting",
+			map[string]interface{}{"date": "2026-03-16", "slot": "09:00"},
+			[]FieldError{{"consultant_id", "is required"}}},
+		{"consulting without date", "/api/bookings/consulting",
+			map[string]interface{}{"consultant_id": "maria-bitcoin", "slot": "09:00"},
+			[]FieldError{{"date", "must be a date formatted YYYY-MM-DD"}}},
+		{"consulting with bad email", "/api/bookings/consulting",
+			map[string]interface{}{"consultant_id": "maria-bitcoin", "date": "2026-03-16", "slot": "09:00", "guest_email": "@example.com"},
+			[]FieldError{{"guest_email", "must be an email address such as ana@example.com"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			var got struct {
+				Error  string       `json:"error"`
+				Errors []FieldError `json:"errors"`
+			}
+			rec := doJSON(t, s.routes(), http.MethodPost, c.path, c.body, &got)
+			if rec.Code != http.StatusUnprocessableEntity || got.Error != "invalid_booking" {
+				t.Fatalf("status %d: %s; want 422 invalid_booking", rec.Code, rec.Body)
+			}
+			if !reflect.DeepEqual(got.Errors, c.want) {
+				t.Fatalf("errors = %+v, want %+v", got.Errors, c.want)
+			}
+			if n := len(s.store.bookings); n != 0 {
+				t.Fatalf("invalid request made %d bookings", n)
+			}
+		})
+	}
+}
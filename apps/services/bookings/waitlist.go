@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// WaitlistStatus is the lifecycle state of a waitlist entry.
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting WaitlistStatus = "waiting"
+	// WaitlistOffered entries hold a pending booking for freed seats that
+	// the guest must accept before OfferExpiresAt.
+	WaitlistOffered  WaitlistStatus = "offered"
+	WaitlistPromoted WaitlistStatus = "promoted"
+	// WaitlistExpired entries let an offer lapse and leave the queue.
+	WaitlistExpired WaitlistStatus = "expired"
+)
+
+var ErrOfferExpired = errors.New("waitlist offer expired")
+
+// WaitlistEntry is a guest waiting for seats on a sold-out departure. The
+// price in effect when they joined is snapshotted and honoured on promotion
+// until PriceLockedUntil. OfferedSeats is how many seats were booked for
+// the party, which is fewer than PartySize for a partial offer.
+type WaitlistEntry struct {
+	ID               string            `json:"entry_id"`
+	Tenant           string            `json:"tenant,omitempty"`
+	TourID           string            `json:"tour_id"`
+	Date             string            `json:"date"`
+	Slot             string            `json:"slot,omitempty"`
+	PartySize        int               `json:"party_size"`
+	GuestName        string            `json:"guest_name,omitempty"`
+	GuestEmail       string            `json:"guest_email"`
+	GuestPhone       string            `json:"guest_phone,omitempty"`
+	Status           WaitlistStatus    `json:"status"`
+	LockedPrice      Price             `json:"locked_price"`
+	PriceLockedUntil apitypes.JSONTime `json:"price_locked_until"`
+	BookingID        string            `json:"booking_id,omitempty"`
+	OfferedSeats     int               `json:"offered_seats,omitempty"`
+	OfferExpiresAt   apitypes.JSONTime `json:"offer_expires_at"`
+	CreatedAt        apitypes.JSONTime `json:"created_at"`
+
+	// seq is the entry's place in join order.
+	seq int
+}
+
+// priceLocked reports whether the snapshotted price still applies at now.
+func (e WaitlistEntry) priceLocked(now time.Time) bool {
+	return now.Before(e.PriceLockedUntil.Time)
+}
+
+// WaitlistPolicy decides which waiting party is offered seats that free up
+// on a departure.
+type WaitlistPolicy string
+
+const (
+	// WaitlistFIFOFits offers the seats to the earliest party that fits.
+	WaitlistFIFOFits WaitlistPolicy = "fifo_fits"
+	// WaitlistBestFit offers them to the largest party that fits, the
+	// earliest of equal parties first, so as few seats as possible go
+	// unsold.
+	WaitlistBestFit WaitlistPolicy = "best_fit"
+	// WaitlistStrictFIFO only ever offers them to the head of the queue,
+	// which holds everyone behind it until enough seats free up.
+	WaitlistStrictFIFO WaitlistPolicy = "strict_fifo"
+)
+
+// parseWaitlistPolicy reads a policy name, defaulting to WaitlistFIFOFits.
+func parseWaitlistPolicy(name string) WaitlistPolicy {
+	switch p := WaitlistPolicy(name); p {
+	case WaitlistBestFit, WaitlistStrictFIFO:
+		return p
+	case WaitlistFIFOFits, "":
+	default:
+		log.Printf("unknown WAITLIST_POLICY %q, using %s", name, WaitlistFIFOFits)
+	}
+	return WaitlistFIFOFits
+}
+
+// JoinWaitlist stores a new waiting entry.
+func (s *Store) JoinWaitlist(e WaitlistEntry, now time.Time) WaitlistEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ID = newID()
+	e.Status = WaitlistWaiting
+	e.CreatedAt = apitypes.JSONTime{Time: now}
+	s.waitlistSeq++
+	e.seq = s.waitlistSeq
+	s.waitlist[e.ID] = &e
+	return e
+}
+
+// WaitlistEntry returns a copy of the entry with the given id.
+func (s *Store) WaitlistEntry(id string) (WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.waitlist[id]
+	if !ok {
+		return WaitlistEntry{}, ErrNotFound
+	}
+	return *e, nil
+}
+
+// NextWaitlistEntry returns the waiting entry on a departure that policy
+// offers seats free seats to, or false when no waiting party fits.
+func (s *Store) NextWaitlistEntry(tourID, date, slot string, seats int, policy WaitlistPolicy) (WaitlistEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := departureKey{tourID, date, slot}
+	var queue []*WaitlistEntry
+	for _, e := range s.waitlist {
+		if e.Status == WaitlistWaiting && (departureKey{e.TourID, e.Date, e.Slot}) == key {
+			queue = append(queue, e)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].seq < queue[j].seq })
+	if policy == WaitlistStrictFIFO && len(queue) > 0 {
+		queue = queue[:1]
+	}
+
+	var best *WaitlistEntry
+	for _, e := range queue {
+		if e.PartySize > seats {
+			continue
+		}
+		if policy != WaitlistBestFit {
+			return *e, true
+		}
+		if best == nil || e.PartySize > best.PartySize {
+			best = e
+		}
+	}
+	if best == nil {
+		return WaitlistEntry{}, false
+	}
+	return *best, true
+}
+
+// PromoteWaitlist turns a waiting entry into a pending booking charged at
+// price, reserving its seats.
+func (s *Store) PromoteWaitlist(id string, price Price, priceLocked bool, now time.Time) (WaitlistEntry, Booking, error) {
+	return s.OfferWaitlist(id, 0, price, priceLocked, time.Time{}, now)
+}
+
+// OfferWaitlist books seats for a waiting entry's party, all of it when
+// seats is zero, as a pending booking charged at price. With a non-zero
+// expiresAt the entry is offered the booking and must accept it before
+// then; otherwise it is promoted outright.
+func (s *Store) OfferWaitlist(id string, seats int, price Price, priceLocked bool, expiresAt, now time.Time) (WaitlistEntry, Booking, error) {
+	entry, err := s.WaitlistEntry(id)
+	if err != nil {
+		return WaitlistEntry{}, Booking{}, err
+	}
+	if entry.Status != WaitlistWaiting {
+		return WaitlistEntry{}, Booking{}, ErrInvalidTransition
+	}
+	if seats <= 0 || seats > entry.PartySize {
+		seats = entry.PartySize
+	}
+	key := departureKey{entry.TourID, entry.Date, entry.Slot}
+	if err := s.reserveShared(key, seats); err != nil {
+		return WaitlistEntry{}, Booking{}, err
+	}
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.waitlist[id]
+	if e.Status != WaitlistWaiting {
+		s.queueReleaseLocked(key, seats)
+		return WaitlistEntry{}, Booking{}, ErrInvalidTransition
+	}
+	d := s.departureLocked(key)
+	if d.Remaining() < seats {
+		s.queueReleaseLocked(key, seats)
+		return WaitlistEntry{}, Booking{}, ErrInsufficientCapacity
+	}
+	d.Booked += seats
+
+	b := &Booking{
+		ID:          newID(),
+		Tenant:      e.Tenant,
+		Kind:        KindTour,
+		OfferingID:  e.TourID,
+		Date:        e.Date,
+		Slot:        e.Slot,
+		PartySize:   seats,
+		GuestName:   e.GuestName,
+		GuestEmail:  e.GuestEmail,
+		GuestPhone:  e.GuestPhone,
+		Status:      StatusPending,
+		PriceCents:  price.AmountCents,
+		Currency:    price.Currency,
+		PriceLocked: priceLocked,
+		CreatedAt:   apitypes.JSONTime{Time: now},
+		UpdatedAt:   apitypes.JSONTime{Time: now},
+	}
+	s.bookings[b.ID] = b
+	e.Status = WaitlistPromoted
+	if !expiresAt.IsZero() {
+		e.Status, e.OfferExpiresAt = WaitlistOffered, apitypes.JSONTime{Time: expiresAt}
+	}
+	e.BookingID = b.ID
+	e.OfferedSeats = seats
+	return *e, *b, nil
+}
+
+// AcceptWaitlistOffer promotes an offered entry whose offer is still open.
+// Its booking stays pending until it is paid for.
+func (s *Store) AcceptWaitlistOffer(id string, now time.Time) (WaitlistEntry, Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.waitlist[id]
+	if !ok {
+		return WaitlistEntry{}, Booking{}, ErrNotFound
+	}
+	if e.Status != WaitlistOffered {
+		return WaitlistEntry{}, Booking{}, ErrInvalidTransition
+	}
+	if !now.Before(e.OfferExpiresAt.Time) {
+		return WaitlistEntry{}, Booking{}, ErrOfferExpired
+	}
+	e.Status = WaitlistPromoted
+	return *e, *s.bookings[e.BookingID], nil
+}
+
+// ExpireWaitlistOffers lapses every offer whose accept window has closed,
+// cancelling its booking and freeing the seats, and returns the entries it
+// expired. An offer whose booking was paid for in the meantime counts as
+// accepted.
+func (s *Store) ExpireWaitlistOffers(now time.Time) []WaitlistEntry {
+	defer s.flushReleases()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []WaitlistEntry
+	for _, e := range s.waitlist {
+		if e.Status != WaitlistOffered || now.Before(e.OfferExpiresAt.Time) {
+			continue
+		}
+		b := s.bookings[e.BookingID]
+		if b.Status != StatusPending {
+			e.Status = WaitlistPromoted
+			continue
+		}
+		s.releaseBookingLocked(b)
+		b.Status = StatusCancelled
+		b.Notes = "waitlist offer expired"
+		b.UpdatedAt = apitypes.JSONTime{Time: now}
+		e.Status = WaitlistExpired
+		expired = append(expired, *e)
+	}
+	return expired
+}
+
+func (s *server) joinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Date       string `json:"date"`
+		Slot       string `json:"slot"`
+		PartySize  int    `json:"party_size"`
+		GuestName  string `json:"guest_name"`
+		GuestEmail string `json:"guest_email"`
+		GuestPhone string `json:"guest_phone"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+		return
+	}
+	if req.GuestEmail == "" || req.PartySize < 1 {
+		respondError(w, http.StatusBadRequest, "invalid_guest", "guest_email and a positive party_size are required")
+		return
+	}
+
+	tourID := chi.URLParam(r, "tourId")
+	price, err := s.pricing.TourPrice(r.Context(), tourID, req.Date, req.Slot, req.PartySize)
+	if err != nil {
+		log.Printf("pricing tour %s for waitlist failed: %v", tourID, err)
+		respondError(w, http.StatusBadGateway, "pricing_unavailable", "could not price the departure")
+		return
+	}
+	now := s.now()
+	entry := s.store.JoinWaitlist(WaitlistEntry{
+		Tenant:           s.tenant(r.Context()).ID,
+		TourID:           tourID,
+		Date:             req.Date,
+		Slot:             req.Slot,
+		PartySize:        req.PartySize,
+		GuestName:        req.GuestName,
+		GuestEmail:       req.GuestEmail,
+		GuestPhone:       req.GuestPhone,
+		LockedPrice:      price,
+		PriceLockedUntil: apitypes.JSONTime{Time: now.Add(s.cfg.WaitlistPriceLockTTL)},
+	}, now)
+	respondJSON(w, http.StatusCreated, entry)
+}
+
+// waitlistPrice is what a waitlisted party pays for seats on promotion: the
+// price snapshotted at join while the lock is valid, prorated when they
+// are offered fewer seats than they asked for, and the current price after
+// it.
+func (s *server) waitlistPrice(ctx context.Context, entry WaitlistEntry, seats int, now time.Time) (Price, bool, error) {
+	if entry.priceLocked(now) {
+		price := entry.LockedPrice
+		price.AmountCents = price.AmountCents * int64(seats) / int64(entry.PartySize)
+		return price, true, nil
+	}
+	price, err := s.pricing.TourPrice(ctx, entry.TourID, entry.Date, entry.Slot, seats)
+	if err != nil {
+		log.Printf("repricing waitlist entry %s failed: %v", entry.ID, err)
+		return Price{}, false, err
+	}
+	return price, false, nil
+}
+
+// promoteWaitlistHandler books a waitlisted party.
+func (s *server) promoteWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	entry, err := s.store.WaitlistEntry(chi.URLParam(r, "entryId"))
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	now := s.now()
+	price, locked, err := s.waitlistPrice(r.Context(), entry, entry.PartySize, now)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, "pricing_unavailable", "could not price the departure")
+		return
+	}
+	entry, b, err := s.store.PromoteWaitlist(entry.ID, price, locked, now)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"entry":   entry,
+		"booking": b,
+	})
+}
+
+// WaitlistOffer is a waitlisted party offered, or promoted into, freed
+// seats.
+type WaitlistOffer struct {
+	Entry   WaitlistEntry `json:"entry"`
+	Booking Booking       `json:"booking"`
+}
+
+// offerFreedSeats offers a departure's free seats to waitlisted parties,
+// picked by the configured policy, until no waiting party fits the seats
+// still free. With an offer window each party must accept before it
+// closes; without one they are promoted outright. When no party fits and
+// partial offers are on, the head of the queue is offered what is free.
+func (s *server) offerFreedSeats(ctx context.Context, tourID, date, slot string) []WaitlistOffer {
+	offers := []WaitlistOffer{}
+	for {
+		free := s.store.Departure(tourID, date, slot).Remaining()
+		entry, ok := s.store.NextWaitlistEntry(tourID, date, slot, free, s.cfg.WaitlistPolicy)
+		seats := entry.PartySize
+		if !ok {
+			if !s.cfg.WaitlistPartialOffers || s.cfg.WaitlistOfferWindow <= 0 || free <= 0 {
+				return offers
+			}
+			if entry, ok = s.store.NextWaitlistEntry(tourID, date, slot, math.MaxInt, WaitlistStrictFIFO); !ok {
+				return offers
+			}
+			seats = free
+		}
+		now := s.now()
+		var expiresAt time.Time
+		if s.cfg.WaitlistOfferWindow > 0 {
+			expiresAt = now.Add(s.cfg.WaitlistOfferWindow)
+		}
+		price, locked, err := s.waitlistPrice(ctx, entry, seats, now)
+		if err != nil {
+			return offers
+		}
+		entry, b, err := s.store.OfferWaitlist(entry.ID, seats, price, locked, expiresAt, now)
+		if err != nil {
+			// The shared inventory may have given the seats to another
+			// instance; the next release offers them again.
+			log.Printf("offering seats to waitlist entry %s failed: %v", entry.ID, err)
+			return offers
+		}
+		offers = append(offers, WaitlistOffer{Entry: entry, Booking: b})
+	}
+}
+
+// expireWaitlistOffers lapses overdue offers and passes their seats on to
+// the next parties in line.
+func (s *server) expireWaitlistOffers(ctx context.Context) {
+	for _, e := range s.store.ExpireWaitlistOffers(s.now()) {
+		log.Printf("waitlist offer %s for tour %s on %s expired, releasing %d seats", e.ID, e.TourID, e.Date, e.OfferedSeats)
+		s.offerFreedSeats(ctx, e.TourID, e.Date, e.Slot)
+	}
+}
+
+// acceptWaitlistOfferHandler takes up an offer of freed seats. The booking
+// it holds is then paid for like any other.
+func (s *server) acceptWaitlistOfferHandler(w http.ResponseWriter, r *http.Request) {
+	entry, b, err := s.store.AcceptWaitlistOffer(chi.URLParam(r, "entryId"), s.now())
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, WaitlistOffer{Entry: entry, Booking: b})
+}
+
+// offerWaitlistHandler offers a departure's free seats to its waitlist.
+// Body: {"date": "2026-03-14", "slot": "08:00"}.
+func (s *server) offerWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Date string `json:"date"`
+		Slot string `json:"slot"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"policy": s.cfg.WaitlistPolicy,
+		"offers": s.offerFreedSeats(r.Context(), chi.URLParam(r, "tourId"), req.Date, req.Slot),
+	})
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func joinWaitlist(t *testing.T, s *server) WaitlistEntry {
+	t.Helper()
+	var entry WaitlistEntry
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours/volcano-hike/waitlist", map[string]interface{}{
+		"date": "2026-03-14", "party_size": 2, "guest_name": "Ana", "guest_email": "ana@example.com",
+	}, &entry)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("join: status %d: %s", rec.Code, rec.Body)
+	}
+	return entry
+}
+
+type promotion struct {
+	Entry   WaitlistEntry `json:"entry"`
+	Booking Booking       `json:"booking"`
+}
+
+func TestWaitlistPromotionHonoursLockedPrice(t *testing.T) {
+	s, clock := newTestServer(t)
+	entry := joinWaitlist(t, s)
+	if entry.LockedPrice.AmountCents != 9000 {
+		t.Fatalf("snapshot = %+v, want 9000", entry.LockedPrice)
+	}
+
+	// Demand surges while the guest waits.
+	s.pricing.(*fakePricing).price.AmountCents = 7000
+	clock.advance(24 * time.Hour)
+
+	var got promotion
+	rec := doStaff(t, s.routes(), http.MethodPost, "/api/bookings/waitlist/"+entry.ID+"/promote", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("promote: status %d: %s", rec.Code, rec.Body)
+	}
+	if got.Booking.PriceCents != 9000 || !got.Booking.PriceLocked || got.Booking.Status != StatusPending {
+		t.Fatalf("booking = %+v, want pending at locked 9000", got.Booking)
+	}
+	if got.Entry.Status != WaitlistPromoted || got.Entry.BookingID != got.Booking.ID {
+		t.Fatalf("entry = %+v", got.Entry)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 2 {
+		t.Fatalf("booked = %d, want 2", d.Booked)
+	}
+}
+
+func TestWaitlistExpiredLockUsesCurrentPrice(t *testing.T) {
+	s, clock := newTestServer(t)
+	entry := joinWaitlist(t, s)
+
+	s.pricing.(*fakePricing).price.AmountCents = 7000
+	clock.advance(49 * time.Hour)
+
+	var got promotion
+	doStaff(t, s.routes(), http.MethodPost, "/api/bookings/waitlist/"+entry.ID+"/promote", nil, &got)
+	if got.Booking.PriceCents != 14000 || got.Booking.PriceLocked {
+		t.Fatalf("booking = %+v, want current price 14000 unlocked", got.Booking)
+	}
+
+	// A second promotion of the same entry is refused.
+	rec := doStaff(t, s.routes(), http.MethodPost, "/api/bookings/waitlist/"+entry.ID+"/promote", nil, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("re-promote: status %d, want 409", rec.Code)
+	}
+}
+
+func TestWaitlistPromotionRequiresStaff(t *testing.T) {
+	s, _ := newTestServer(t)
+	entry := joinWaitlist(t, s)
+	for _, token := range []string{"", testServiceKey} {
+		rec := doJSONAs(t, token, s.routes(), http.MethodPost, "/api/bookings/waitlist/"+entry.ID+"/promote", nil, nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("promote with %q: status %d, want 401", token, rec.Code)
+		}
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", ""); d.Booked != 0 {
+		t.Fatalf("booked = %d after unauthorised promotions, want 0", d.Booked)
+	}
+}
+
+// waitlistParty joins the 08:00 volcano-hike waitlist with a party of size.
+func waitlistParty(t *testing.T, s *server, size int, email string) WaitlistEntry {
+	t.Helper()
+	var entry WaitlistEntry
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/tours/volcano-hike/waitlist", map[string]interface{}{
+		"date": "2026-03-14", "slot": "08:00", "party_size": size, "guest_email": email,
+	}, &entry)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("join: status %d: %s", rec.Code, rec.Body)
+	}
+	return entry
+}
+
+func TestCancellationOffersSeatsToFirstPartyThatFits(t *testing.T) {
+	s, clock := newTestServer(t)
+	bookTour(t, s, "", 10)
+	pair, rec := bookTour(t, s, "", 2)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("book: status %d: %s", rec.Code, rec.Body)
+	}
+	four := waitlistParty(t, s, 4, "four@example.com")
+	clock.advance(time.Minute)
+	two := waitlistParty(t, s, 2, "two@example.com")
+
+	var got struct {
+		Offers []promotion `json:"waitlist_offers"`
+	}
+	rec = doJSON(t, s.routes(), http.MethodPut, "/api/bookings/tours/"+pair.ID+"/cancel", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(got.Offers) != 1 || got.Offers[0].Entry.ID != two.ID || got.Offers[0].Booking.PartySize != 2 {
+		t.Fatalf("offers = %+v, want only the 2-seat entry", got.Offers)
+	}
+	if e, _ := s.store.WaitlistEntry(four.ID); e.Status != WaitlistWaiting {
+		t.Fatalf("4-seat entry = %s, want still waiting", e.Status)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Remaining() != 0 {
+		t.Fatalf("remaining = %d, want 0", d.Remaining())
+	}
+}
+
+func TestWaitlistPolicies(t *testing.T) {
+	tests := []struct {
+		policy WaitlistPolicy
+		want   []int
+	}{
+		{WaitlistFIFOFits, []int{1, 2}},
+		{WaitlistBestFit, []int{3}},
+		{WaitlistStrictFIFO, nil},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.cfg.StaffAPIKey = "staff-key"
+			s.cfg.WaitlistPolicy = tt.policy
+			bookTour(t, s, "", 9) // 3 seats left
+			waitlistParty(t, s, 4, "a@example.com")
+			waitlistParty(t, s, 1, "b@example.com")
+			waitlistParty(t, s, 3, "c@example.com")
+			waitlistParty(t, s, 2, "d@example.com")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/bookings/tours/volcano-hike/waitlist/offer", strings.NewReader(`{"date":"2026-03-14","slot":"08:00"}`))
+			req.Header.Set("Authorization", "Bearer staff-key")
+			rec := httptest.NewRecorder()
+			s.routes().ServeHTTP(rec, req)
+			var got struct {
+				Offers []promotion `json:"offers"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("offer: status %d: %s", rec.Code, rec.Body)
+			}
+			var sizes []int
+			for _, o := range got.Offers {
+				sizes = append(sizes, o.Entry.PartySize)
+			}
+			if len(sizes) != len(tt.want) {
+				t.Fatalf("offered parties %v, want %v", sizes, tt.want)
+			}
+			for i := range sizes {
+				if sizes[i] != tt.want[i] {
+					t.Fatalf("offered parties %v, want %v", sizes, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// cancelForOffers cancels a tour booking and returns the waitlist offers
+// the freed seats produced.
+func cancelForOffers(t *testing.T, s *server, id string) []promotion {
+	t.Helper()
+	var got struct {
+		Offers []promotion `json:"waitlist_offers"`
+	}
+	if rec := doJSON(t, s.routes(), http.MethodPut, "/api/bookings/tours/"+id+"/cancel", nil, &got); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", rec.Code, rec.Body)
+	}
+	return got.Offers
+}
+
+func TestWaitlistOfferToGroupThatFits(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.WaitlistOfferWindow = 2 * time.Hour
+	bookTour(t, s, "", 9)
+	three, _ := bookTour(t, s, "", 3)
+	group := waitlistParty(t, s, 3, "group@example.com")
+
+	offers := cancelForOffers(t, s, three.ID)
+	if len(offers) != 1 || offers[0].Entry.ID != group.ID {
+		t.Fatalf("offers = %+v, want the 3-seat group", offers)
+	}
+	o := offers[0]
+	if o.Entry.Status != WaitlistOffered || o.Entry.OfferedSeats != 3 || !o.Entry.OfferExpiresAt.Equal(clock.now().Add(2*time.Hour)) {
+		t.Fatalf("entry = %+v, want offered 3 seats for 2h", o.Entry)
+	}
+	if o.Booking.Status != StatusPending || o.Booking.PartySize != 3 {
+		t.Fatalf("booking = %+v, want pending for 3", o.Booking)
+	}
+
+	clock.advance(time.Hour)
+	var got promotion
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/waitlist/"+group.ID+"/accept", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("accept: status %d: %s", rec.Code, rec.Body)
+	}
+	if got.Entry.Status != WaitlistPromoted || got.Booking.ID != o.Booking.ID {
+		t.Fatalf("accepted = %+v", got)
+	}
+
+	// An accepted offer is left alone once its window closes.
+	clock.advance(2 * time.Hour)
+	s.expireWaitlistOffers(context.Background())
+	if b, _ := s.store.Booking(o.Booking.ID); b.Status != StatusPending {
+		t.Fatalf("booking = %s, want still pending", b.Status)
+	}
+}
+
+func TestWaitlistOfferSkipsPartyThatDoesNotFit(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.WaitlistOfferWindow = 2 * time.Hour
+	bookTour(t, s, "", 10)
+	pair, _ := bookTour(t, s, "", 2)
+	big := waitlistParty(t, s, 5, "big@example.com")
+	clock.advance(time.Minute)
+	small := waitlistParty(t, s, 2, "small@example.com")
+
+	offers := cancelForOffers(t, s, pair.ID)
+	if len(offers) != 1 || offers[0].Entry.ID != small.ID || offers[0].Entry.Status != WaitlistOffered {
+		t.Fatalf("offers = %+v, want the 2-seat party offered", offers)
+	}
+	if e, _ := s.store.WaitlistEntry(big.ID); e.Status != WaitlistWaiting {
+		t.Fatalf("5-seat entry = %s, want still waiting", e.Status)
+	}
+}
+
+func TestWaitlistOfferExpiresToNextCandidate(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.cfg.WaitlistOfferWindow = 2 * time.Hour
+	bookTour(t, s, "", 10)
+	pair, _ := bookTour(t, s, "", 2)
+	first := waitlistParty(t, s, 2, "first@example.com")
+	clock.advance(time.Minute)
+	second := waitlistParty(t, s, 2, "second@example.com")
+
+	offers := cancelForOffers(t, s, pair.ID)
+	if len(offers) != 1 || offers[0].Entry.ID != first.ID {
+		t.Fatalf("offers = %+v, want the first party", offers)
+	}
+
+	// Not yet due: nothing moves.
+	clock.advance(time.Hour)
+	s.expireWaitlistOffers(context.Background())
+	if e, _ := s.store.WaitlistEntry(second.ID); e.Status != WaitlistWaiting {
+		t.Fatalf("second = %s before expiry, want waiting", e.Status)
+	}
+
+	clock.advance(time.Hour)
+	s.expireWaitlistOffers(context.Background())
+	if e, _ := s.store.WaitlistEntry(first.ID); e.Status != WaitlistExpired {
+		t.Fatalf("first = %s, want expired", e.Status)
+	}
+	if b, _ := s.store.Booking(offers[0].Booking.ID); b.Status != StatusCancelled {
+		t.Fatalf("first booking = %s, want cancelled", b.Status)
+	}
+	e, _ := s.store.WaitlistEntry(second.ID)
+	if e.Status != WaitlistOffered || !e.OfferExpiresAt.Equal(clock.now().Add(2*time.Hour)) {
+		t.Fatalf("second = %+v, want a fresh 2h offer", e)
+	}
+	if d := s.store.Departure("volcano-hike", "2026-03-14", "08:00"); d.Remaining() != 0 {
+		t.Fatalf("remaining = %d, want 0", d.Remaining())
+	}
+
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/bookings/waitlist/"+first.ID+"/accept", nil, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("accept lapsed offer: status %d, want 409", rec.Code)
+	}
+	clock.advance(3 * time.Hour)
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/bookings/waitlist/"+second.ID+"/accept", nil, nil)
+	if rec.Code != http.StatusGone || !strings.Contains(rec.Body.String(), "offer_expired") {
+		t.Fatalf("accept after window: status %d: %s, want 410 offer_expired", rec.Code, rec.Body)
+	}
+}
+
+func TestWaitlistPartialOfferToHead(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.WaitlistOfferWindow = 2 * time.Hour
+	s.cfg.WaitlistPartialOffers = true
+	bookTour(t, s, "", 10)
+	pair, _ := bookTour(t, s, "", 2)
+	head := waitlistParty(t, s, 4, "head@example.com")
+
+	offers := cancelForOffers(t, s, pair.ID)
+	if len(offers) != 1 || offers[0].Entry.ID != head.ID || offers[0].Entry.OfferedSeats != 2 {
+		t.Fatalf("offers = %+v, want 2 of the head's 4 seats", offers)
+	}
+	// The locked 4-seat price is prorated to the 2 seats offered.
+	if b := offers[0].Booking; b.PartySize != 2 || b.PriceCents != head.LockedPrice.AmountCents/2 {
+		t.Fatalf("booking = %+v, want 2 seats at half the locked price", b)
+	}
+}
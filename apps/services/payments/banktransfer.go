@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrTransferNotFound         = errors.New("no bank transfer is awaited with that reference")
+	ErrTransferAlreadyConfirmed = errors.New("bank transfer was already confirmed")
+)
+
+// Bank transfer states.
+const (
+	TransferAwaiting  = "pending_awaiting_transfer"
+	TransferConfirmed = "confirmed"
+)
+
+// BankTransfer is a booking waiting to be paid by bank transfer. The guest
+// quotes Reference on the transfer so finance can match it when it lands.
+type BankTransfer struct {
+	Reference   string            `json:"reference"`
+	Tenant      string            `json:"tenant,omitempty"`
+	BookingID   string            `json:"booking_id"`
+	Category    string            `json:"category,omitempty"`
+	AmountCents int64             `json:"amount_cents"`
+	Currency    string            `json:"currency"`
+	Status      string            `json:"status"`
+	CreatedAt   apitypes.JSONTime `json:"created_at"`
+	ConfirmedAt apitypes.JSONTime `json:"confirmed_at"`
+	ConfirmedBy string            `json:"confirmed_by,omitempty"`
+}
+
+// bankTransfers holds awaited and confirmed transfers by reference.
+type bankTransfers struct {
+	mu    sync.Mutex
+	byRef map[string]*BankTransfer
+	// confirmMu serialises confirmations so a reference listed twice, or
+	// confirmed by two people at once, is only paid once.
+	confirmMu sync.Mutex
+}
+
+func newBankTransfers() *bankTransfers {
+	return &bankTransfers{byRef: make(map[string]*BankTransfer)}
+}
+
+// newTransferReference returns a short reference a guest can type into a
+// bank's payment memo, e.g. "GES-7K2QD4XA".
+func newTransferReference() string {
+	var b [5]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return "GES-" + base32.StdEncoding.EncodeToString(b[:])
+}
+
+// normalizeTransferReference makes references case- and space-insensitive,
+// since they are copied by hand from bank statements.
+func normalizeTransferReference(ref string) string {
+	return strings.ToUpper(strings.TrimSpace(ref))
+}
+
+func (b *bankTransfers) Add(t BankTransfer) BankTransfer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t.Reference = newTransferReference()
+	t.Status = TransferAwaiting
+	b.byRef[t.Reference] = &t
+	return t
+}
+
+func (b *bankTransfers) Get(ref string) (BankTransfer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.byRef[normalizeTransferReference(ref)]
+	if !ok {
+		return BankTransfer{}, ErrTransferNotFound
+	}
+	return *t, nil
+}
+
+// MarkConfirmed records that ref's money arrived.
+func (b *bankTransfers) MarkConfirmed(ref, by string, at time.Time) BankTransfer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.byRef[normalizeTransferReference(ref)]
+	t.Status, t.ConfirmedAt, t.ConfirmedBy = TransferConfirmed, apitypes.JSONTime{Time: at}, by
+	return *t
+}
+
+// createBankTransferHandler starts a bank transfer payment for a booking
+// and returns the reference the guest must quote. Body: {"booking_id":
+// "...", "category": "tours", "amount_cents": 250000}.
+func (s *server) createBankTransferHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BookingID   string `json:"booking_id"`
+		Category    string `json:"category"`
+		AmountCents int64  `json:"amount_cents"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.BookingID == "" || req.AmountCents <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_transfer", "booking_id and a positive amount_cents are required")
+		return
+	}
+	for _, a := range s.cfg.Rails.Availability("", req.AmountCents) {
+		if a.Rail == RailBankTransfer && !a.Enabled {
+			respondError(w, http.StatusUnprocessableEntity, "rail_unavailable", "bank transfer is "+a.Message)
+			return
+		}
+	}
+	t := s.transfers.Add(BankTransfer{
+		Tenant:      s.tenant(r.Context()).ID,
+		BookingID:   req.BookingID,
+		Category:    req.Category,
+		AmountCents: req.AmountCents,
+		Currency:    "USD",
+		CreatedAt:   apitypes.JSONTime{Time: s.now()},
+	})
+	respondJSON(w, http.StatusCreated, t)
+}
+
+// Outcomes of confirming one bank transfer.
+const (
+	TransferResultConfirmed        = "confirmed"
+	TransferResultUnknownReference = "unknown_reference"
+	TransferResultAlreadyConfirmed = "already_confirmed"
+	TransferResultAmountMismatch   = "amount_mismatch"
+	TransferResultNoCapacity       = "failed_no_capacity"
+	TransferResultBookingsError    = "bookings_error"
+)
+
+// transferConfirmation is the outcome for one reference in a batch.
+type transferConfirmation struct {
+	Reference     string `json:"reference"`
+	Result        string `json:"result"`
+	BookingID     string `json:"booking_id,omitempty"`
+	BookingStatus string `json:"booking_status,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+// confirmBankTransfer matches a received transfer to its booking, records
+// the payment and its Foundation allocation and confirms the booking with
+// the bookings service. receivedCents, when set, must be the amount
+// awaited; short or over payments are left for finance to resolve.
+func (s *server) confirmBankTransfer(r *http.Request, ref string, receivedCents int64, by string) transferConfirmation {
+	s.transfers.confirmMu.Lock()
+	defer s.transfers.confirmMu.Unlock()
+	out := transferConfirmation{Reference: normalizeTransferReference(ref)}
+	t, err := s.transfers.Get(ref)
+	if err != nil {
+		out.Result, out.Message = TransferResultUnknownReference, err.Error()
+		return out
+	}
+	out.BookingID = t.BookingID
+	switch {
+	case t.Status == TransferConfirmed:
+		out.Result, out.Message = TransferResultAlreadyConfirmed, ErrTransferAlreadyConfirmed.Error()
+		return out
+	case receivedCents != 0 && receivedCents != t.AmountCents:
+		out.Result = TransferResultAmountMismatch
+		out.Message = fmt.Sprintf("received %s but %s was awaited", formatUSD(receivedCents), formatUSD(t.AmountCents))
+		return out
+	}
+
+	now := s.now()
+	s.commitPayment(Payment{
+		Ref:        t.Reference,
+		Tenant:     t.Tenant,
+		BookingID:  t.BookingID,
+		Category:   t.Category,
+		GrossCents: t.AmountCents,
+		Currency:   t.Currency,
+		Rail:       string(RailBankTransfer),
+		PaidAt:     apitypes.JSONTime{Time: now},
+	})
+	status, err := s.bookings.RecordPayment(s.withTenant(r.Context(), t.Tenant), t.BookingID, PaymentNotice{
+		PaymentRef:  t.Reference,
+		AmountCents: t.AmountCents,
+		Currency:    t.Currency,
+	})
+	var berr *BookingsError
+	if errors.As(err, &berr) && berr.Status == http.StatusConflict {
+		out.Result, out.Message = TransferResultBookingsError, "booking is no longer awaiting payment"
+		return out
+	}
+	if err != nil {
+		log.Printf("bank transfer %s: recording payment for booking %s failed: %v", t.Reference, t.BookingID, err)
+		out.Result, out.Message = TransferResultBookingsError, "could not record payment with bookings service"
+		return out
+	}
+	s.transfers.MarkConfirmed(t.Reference, by, now)
+	out.Result, out.BookingStatus = TransferResultConfirmed, status
+	if status == "failed_no_capacity" {
+		// The money arrived after the seats were lost; bookings refunds it.
+		out.Result = TransferResultNoCapacity
+	}
+	return out
+}
+
+// confirmBankTransfersHandler confirms a batch of transfers finance matched
+// on the bank statement. Body: {"confirmed_by": "finance@...",
+// "transfers": [{"reference": "GES-...", "amount_cents": 250000}]}. Each
+// reference gets its own result, so one bad line does not hold up the rest.
+func (s *server) confirmBankTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ConfirmedBy string `json:"confirmed_by"`
+		Transfers   []struct {
+			Reference   string `json:"reference"`
+			AmountCents int64  `json:"amount_cents"`
+		} `json:"transfers"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if len(req.Transfers) == 0 {
+		respondError(w, http.StatusBadRequest, "invalid_confirmation", "transfers must list at least one reference")
+		return
+	}
+	results := make([]transferConfirmation, 0, len(req.Transfers))
+	confirmed := 0
+	for _, t := range req.Transfers {
+		res := s.confirmBankTransfer(r, t.Reference, t.AmountCents, req.ConfirmedBy)
+		if res.Result == TransferResultConfirmed {
+			confirmed++
+		}
+		results = append(results, res)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"confirmed": confirmed,
+		"results":   results,
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newBankTransferTestServer(t *testing.T) *server {
+	t.Helper()
+	s := newTestServer(t)
+	s.cfg.Rails = RailPolicy{RailBankTransfer: {Enabled: true, MinCents: 100000}}
+	return s
+}
+
+func startTransfer(t *testing.T, s *server, bookingID string, cents int64) BankTransfer {
+	t.Helper()
+	var bt BankTransfer
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/bank-transfer", map[string]interface{}{
+		"booking_id": bookingID, "category": CategoryTours, "amount_cents": cents,
+	}, &bt)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("start transfer: status %d: %s", rec.Code, rec.Body)
+	}
+	return bt
+}
+
+type confirmResponse struct {
+	Confirmed int                    `json:"confirmed"`
+	Results   []transferConfirmation `json:"results"`
+}
+
+func confirmTransfers(t *testing.T, s *server, lines ...map[string]interface{}) confirmResponse {
+	t.Helper()
+	var got confirmResponse
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/bank-transfer/confirm", map[string]interface{}{
+		"confirmed_by": "finance@example.com", "transfers": lines,
+	}, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm: status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func TestBankTransferConfirmationPaysBooking(t *testing.T) {
+	s := newBankTransferTestServer(t)
+	bt := startTransfer(t, s, "bk-villa", 250000)
+	if bt.Status != TransferAwaiting || !strings.HasPrefix(bt.Reference, "GES-") {
+		t.Fatalf("transfer = %+v, want awaiting with a GES- reference", bt)
+	}
+
+	// Finance types the reference from the statement in lower case.
+	got := confirmTransfers(t, s, map[string]interface{}{"reference": strings.ToLower(bt.Reference), "amount_cents": 250000})
+	if got.Confirmed != 1 || got.Results[0].Result != TransferResultConfirmed || got.Results[0].BookingStatus != "confirmed" {
+		t.Fatalf("response = %+v, want the transfer confirmed", got)
+	}
+	if n := s.bookings.(*fakeBookings).payments["bk-villa"]; n.PaymentRef != bt.Reference || n.AmountCents != 250000 {
+		t.Fatalf("bookings notice = %+v", n)
+	}
+	p, err := s.ledger.Payment(bt.Reference)
+	if err != nil || p.Rail != string(RailBankTransfer) || p.GrossCents != 250000 {
+		t.Fatalf("ledger payment = %+v, %v", p, err)
+	}
+	if f := s.ledger.FoundationTotal(bt.Reference); f != 37500 {
+		t.Fatalf("foundation = %d, want 37500", f)
+	}
+	if stored, _ := s.transfers.Get(bt.Reference); stored.Status != TransferConfirmed || stored.ConfirmedBy != "finance@example.com" {
+		t.Fatalf("stored transfer = %+v", stored)
+	}
+
+	// Confirming it again records nothing more.
+	again := confirmTransfers(t, s, map[string]interface{}{"reference": bt.Reference})
+	if again.Confirmed != 0 || again.Results[0].Result != TransferResultAlreadyConfirmed {
+		t.Fatalf("second confirmation = %+v", again)
+	}
+	if n := len(s.ledger.PaymentsBetween(s.now().AddDate(0, 0, -1), s.now().AddDate(0, 0, 1))); n != 1 {
+		t.Fatalf("%d payments recorded, want 1", n)
+	}
+}
+
+func TestBankTransferRejectsUnknownReferenceAndWrongAmount(t *testing.T) {
+	s := newBankTransferTestServer(t)
+	bt := startTransfer(t, s, "bk-villa", 250000)
+
+	got := confirmTransfers(t, s,
+		map[string]interface{}{"reference": "GES-NOTAREF0"},
+		map[string]interface{}{"reference": bt.Reference, "amount_cents": 200000},
+	)
+	if got.Confirmed != 0 || len(got.Results) != 2 {
+		t.Fatalf("response = %+v, want nothing confirmed", got)
+	}
+	if got.Results[0].Result != TransferResultUnknownReference {
+		t.Errorf("unknown reference = %+v", got.Results[0])
+	}
+	if got.Results[1].Result != TransferResultAmountMismatch {
+		t.Errorf("short transfer = %+v", got.Results[1])
+	}
+	if len(s.bookings.(*fakeBookings).payments) != 0 {
+		t.Fatal("bookings was told of a payment")
+	}
+	if _, err := s.ledger.Payment(bt.Reference); err == nil {
+		t.Fatal("a payment was recorded")
+	}
+}
+
+func TestBankTransferNeedsALargeBooking(t *testing.T) {
+	s := newBankTransferTestServer(t)
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/bank-transfer", map[string]interface{}{
+		"booking_id": "bk-1", "amount_cents": 9000,
+	}, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
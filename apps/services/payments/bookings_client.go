@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// PaymentNotice reports a successful charge for a booking.
+type PaymentNotice struct {
+	PaymentRef  string `json:"payment_ref"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+}
+
+// DisputeNotice reports a chargeback on a booking's payment. Status is
+// DisputeOpen while Stripe reviews it, then DisputeWon or DisputeLost.
+type DisputeNotice struct {
+	DisputeID   string `json:"dispute_id"`
+	PaymentRef  string `json:"payment_ref"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	Reason      string `json:"reason,omitempty"`
+	Status      string `json:"status"`
+}
+
+// PaymentFailureNotice reports that a booking's payment failed or was
+// abandoned, so its seats can be freed. Source is the rail it was
+// attempted on.
+type PaymentFailureNotice struct {
+	PaymentRef string `json:"payment_ref"`
+	Source     string `json:"source"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// BookingsError is a non-2xx answer from the bookings service.
+type BookingsError struct {
+	Status int
+	Code   string
+}
+
+func (e *BookingsError) Error() string {
+	return fmt.Sprintf("bookings: %d %s", e.Status, e.Code)
+}
+
+// BookingsClient is the payments service's view of the bookings service.
+type BookingsClient interface {
+	// RecordPayment hands a successful payment to bookings, which re-checks
+	// capacity and returns the booking's resulting status.
+	RecordPayment(ctx context.Context, bookingID string, n PaymentNotice) (string, error)
+	// RecordDispute tells bookings a booking's payment is disputed, or how
+	// a dispute ended, and returns the booking's resulting status.
+	RecordDispute(ctx context.Context, bookingID string, n DisputeNotice) (string, error)
+	// RecordPaymentFailure tells bookings a booking's payment will not
+	// complete. Bookings frees its seats once however often it is told,
+	// and returns the booking's resulting status.
+	RecordPaymentFailure(ctx context.Context, bookingID string, n PaymentFailureNotice) (string, error)
+}
+
+// httpBookingsClient talks to the bookings service over its REST API,
+// authenticating with apiKey.
+type httpBookingsClient struct {
+	baseURL string
+	apiKey  string
+	client  *outbound.Client
+}
+
+func newHTTPBookingsClient(baseURL, apiKey string) *httpBookingsClient {
+	return &httpBookingsClient{baseURL: baseURL, apiKey: apiKey, client: outbound.NewClient("bookings", 10*time.Second)}
+}
+
+func (c *httpBookingsClient) RecordPayment(ctx context.Context, bookingID string, n PaymentNotice) (string, error) {
+	return c.post(ctx, "/api/bookings/"+bookingID+"/payment", n)
+}
+
+func (c *httpBookingsClient) RecordDispute(ctx context.Context, bookingID string, n DisputeNotice) (string, error) {
+	return c.post(ctx, "/api/bookings/"+bookingID+"/dispute", n)
+}
+
+func (c *httpBookingsClient) RecordPaymentFailure(ctx context.Context, bookingID string, n PaymentFailureNotice) (string, error) {
+	return c.post(ctx, "/api/bookings/"+bookingID+"/payment-failure", n)
+}
+
+// post sends v to bookings and returns the booking status it answers
+// with.
+func (c *httpBookingsClient) post(ctx context.Context, path string, v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	tenantkit.Propagate(ctx, req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode >= 300 {
+		return "", &BookingsError{Status: resp.StatusCode, Code: body.Error}
+	}
+	return body.Status, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBookingsClientAuthenticates(t *testing.T) {
+	var auth, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, path = r.Header.Get("Authorization"), r.URL.Path
+		json.NewEncoder(w).Encode(map[string]string{"status": "confirmed"})
+	}))
+	defer srv.Close()
+
+	c := newHTTPBookingsClient(srv.URL, "service-key")
+	status, err := c.RecordPayment(context.Background(), "bk-1", PaymentNotice{PaymentRef: "pi_1", AmountCents: 9000, Currency: "USD"})
+	if err != nil || status != "confirmed" {
+		t.Fatalf("RecordPayment = %q, %v", status, err)
+	}
+	if auth != "Bearer service-key" || path != "/api/bookings/bk-1/payment" {
+		t.Fatalf("sent %s with Authorization %q", path, auth)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+)
+
+// RailReasonRateStale withholds the bitcoin rails while the BTC/USD rate
+// sats amounts are priced at is too old to trust.
+const RailReasonRateStale = "rate_too_stale"
+
+// btcRails are the rails whose amounts depend on the BTC/USD rate.
+var btcRails = map[Rail]bool{RailLightning: true, RailOnchain: true}
+
+// BTCRateReading is the pricing service's current BTC/USD rate and when it
+// was read from the market.
+type BTCRateReading struct {
+	BtcUSD    float64           `json:"btc_usd"`
+	Source    string            `json:"source"`
+	FetchedAt apitypes.JSONTime `json:"fetched_at"`
+	Cached    bool              `json:"cached"`
+}
+
+// RateClient is the payments service's view of the pricing service's BTC
+// rate.
+type RateClient interface {
+	BTCRate(ctx context.Context) (BTCRateReading, error)
+}
+
+// httpRateClient reads the rate from the pricing service's REST API.
+type httpRateClient struct {
+	baseURL string
+	client  *outbound.Client
+}
+
+func newHTTPRateClient(baseURL string) *httpRateClient {
+	return &httpRateClient{baseURL: baseURL, client: outbound.NewClient("pricing", 5*time.Second)}
+}
+
+func (c *httpRateClient) BTCRate(ctx context.Context) (BTCRateReading, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/pricing/btc/rate", nil)
+	if err != nil {
+		return BTCRateReading{}, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return BTCRateReading{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return BTCRateReading{}, fmt.Errorf("pricing: unexpected status %d", resp.StatusCode)
+	}
+	var rate BTCRateReading
+	if err := json.NewDecoder(resp.Body).Decode(&rate); err != nil {
+		return BTCRateReading{}, fmt.Errorf("pricing: %w", err)
+	}
+	return rate, nil
+}
+
+// btcRateStale reports whether the BTC rate is older than
+// cfg.BTCRateMaxStaleness, and why. A rate that cannot be read at all
+// counts as stale. A zero maximum turns the check off.
+func (s *server) btcRateStale(ctx context.Context) (bool, string) {
+	if s.cfg.BTCRateMaxStaleness <= 0 {
+		return false, ""
+	}
+	rate, err := s.rates.BTCRate(ctx)
+	if err != nil {
+		return true, "the BTC rate is unavailable"
+	}
+	if age := s.now().Sub(rate.FetchedAt.Time); rate.FetchedAt.IsZero() || age > s.cfg.BTCRateMaxStaleness {
+		return true, fmt.Sprintf("the BTC rate is %s old, over the %s limit", age.Truncate(time.Second), s.cfg.BTCRateMaxStaleness)
+	}
+	return false, ""
+}
+
+// withholdBTCRails marks every bitcoin rail in rails unavailable because the
+// rate is stale, leaving fiat rails as they were.
+func withholdBTCRails(rails []RailAvailability, message string) {
+	for i, a := range rails {
+		if btcRails[a.Rail] && a.Enabled {
+			rails[i] = RailAvailability{Rail: a.Rail, Reason: RailReasonRateStale, Message: message}
+		}
+	}
+}
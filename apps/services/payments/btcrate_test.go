@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// fakeRates serves a fixed BTC rate reading.
+type fakeRates struct {
+	reading BTCRateReading
+	err     error
+}
+
+func (f *fakeRates) BTCRate(context.Context) (BTCRateReading, error) {
+	return f.reading, f.err
+}
+
+// newRateTestServer reads a rate fetched age ago, with a 10 minute limit.
+func newRateTestServer(t *testing.T, age time.Duration) (*server, *fakeLND) {
+	t.Helper()
+	s, lnd := newLightningTestServer(t)
+	s.cfg.Rails = newRailsTestServer(t).cfg.Rails
+	s.cfg.BTCRateMaxStaleness = 10 * time.Minute
+	s.rates = &fakeRates{reading: BTCRateReading{BtcUSD: 65000, Source: "coingecko", FetchedAt: apitypes.JSONTime{Time: s.now().Add(-age)}}}
+	return s, lnd
+}
+
+func TestFreshBTCRateAllowsBitcoinRails(t *testing.T) {
+	s, _ := newRateTestServer(t, time.Minute)
+
+	var got railsResponse
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?region=SV&amount=250", nil, &got)
+	for _, rail := range []Rail{RailCard, RailLightning, RailOnchain} {
+		if a := got.rail(t, rail); !a.Enabled {
+			t.Errorf("%s = %+v, want enabled", rail, a)
+		}
+	}
+	createInvoice(t, s, "bk-1", 15000, 1000)
+}
+
+func TestStaleBTCRateDisablesOnlyBitcoin(t *testing.T) {
+	s, lnd := newRateTestServer(t, 30*time.Minute)
+
+	var got railsResponse
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?region=SV&amount=250", nil, &got)
+	for _, rail := range []Rail{RailLightning, RailOnchain} {
+		if a := got.rail(t, rail); a.Enabled || a.Reason != RailReasonRateStale {
+			t.Errorf("%s = %+v, want withheld as rate_too_stale", rail, a)
+		}
+	}
+	if card := got.rail(t, RailCard); !card.Enabled {
+		t.Errorf("card = %+v, want enabled", card)
+	}
+	if credit := got.rail(t, RailCredit); credit.Reason != RailReasonDisabled {
+		t.Errorf("credit = %+v, want its own reason kept", credit)
+	}
+
+	var body map[string]string
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/invoice", map[string]interface{}{
+		"booking_id": "bk-1", "amount_sats": 15000, "amount_cents": 1000,
+	}, &body)
+	if rec.Code != http.StatusServiceUnavailable || body["error"] != RailReasonRateStale {
+		t.Fatalf("invoice: status %d body %v, want 503 rate_too_stale", rec.Code, body)
+	}
+	if len(lnd.invoices) != 0 {
+		t.Fatalf("LND was asked for %d invoices, want none", len(lnd.invoices))
+	}
+
+	// Card checkout does not depend on the rate.
+	cs, _ := newCheckoutTestServer(t, 0)
+	cs.cfg.BTCRateMaxStaleness = 10 * time.Minute
+	cs.rates = &fakeRates{err: errors.New("pricing down")}
+	if rec := postCheckout(t, cs.routes(), "booking-bk-1-checkout", testCheckout); rec.Code != http.StatusOK {
+		t.Fatalf("card checkout: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUnreadableBTCRateCountsAsStale(t *testing.T) {
+	s, _ := newRateTestServer(t, 0)
+	s.rates = &fakeRates{err: errors.New("pricing down")}
+	if stale, _ := s.btcRateStale(context.Background()); !stale {
+		t.Fatal("an unreadable rate should count as stale")
+	}
+	s.cfg.BTCRateMaxStaleness = 0
+	if stale, _ := s.btcRateStale(context.Background()); stale {
+		t.Fatal("a zero limit should turn the check off")
+	}
+}
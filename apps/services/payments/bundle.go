@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// maxOrderLines bounds a single order quote.
+const maxOrderLines = 20
+
+// BundleRule discounts every line of an order in Categories by Rate when
+// the order has at least one line in each of them.
+type BundleRule struct {
+	Name       string           `json:"name"`
+	Categories []string         `json:"categories"`
+	Rate       apitypes.Percent `json:"rate"`
+}
+
+// BundlePolicy lists the bundles on offer.
+type BundlePolicy []BundleRule
+
+// loadBundlePolicy reads BUNDLE_DISCOUNTS, a comma-separated list of
+// category combinations and their discount such as
+// "tours+rentals=10%,tours+rentals+consulting=15%". Malformed input falls
+// back to the default tours and rentals bundle.
+func loadBundlePolicy() BundlePolicy {
+	const fallback = "tours+rentals=10%"
+	p, err := parseBundlePolicy(envString("BUNDLE_DISCOUNTS", fallback))
+	if err != nil {
+		p, _ = parseBundlePolicy(fallback)
+	}
+	return p
+}
+
+func parseBundlePolicy(s string) (BundlePolicy, error) {
+	var p BundlePolicy
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		combo, rate, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("bundle %q: want categories=percent", entry)
+		}
+		r, err := apitypes.ParsePercent(rate)
+		if err != nil {
+			return nil, fmt.Errorf("bundle %q: %w", entry, err)
+		}
+		var cats []string
+		for _, c := range strings.Split(combo, "+") {
+			cats = append(cats, strings.ToLower(strings.TrimSpace(c)))
+		}
+		sort.Strings(cats)
+		p = append(p, BundleRule{Name: strings.Join(cats, "+"), Categories: cats, Rate: r})
+	}
+	return p, nil
+}
+
+func (p BundlePolicy) validate() error {
+	for _, b := range p {
+		if len(b.Categories) < 2 {
+			return fmt.Errorf("bundle %s: needs at least two categories", b.Name)
+		}
+		for _, c := range b.Categories {
+			if !validCategory(c) {
+				return fmt.Errorf("bundle %s: unknown category %q", b.Name, c)
+			}
+		}
+		if b.Rate <= 0 || b.Rate >= apitypes.HundredPercent {
+			return fmt.Errorf("bundle %s: discount %s must be between 0%% and 100%%", b.Name, b.Rate)
+		}
+	}
+	return nil
+}
+
+// Match returns the most generous bundle an order with lines in categories
+// qualifies for.
+func (p BundlePolicy) Match(categories map[string]bool) (BundleRule, bool) {
+	var best BundleRule
+	found := false
+	for _, b := range p {
+		qualifies := true
+		for _, c := range b.Categories {
+			qualifies = qualifies && categories[c]
+		}
+		if qualifies && (!found || b.Rate > best.Rate) {
+			best, found = b, true
+		}
+	}
+	return best, found
+}
+
+func validCategory(c string) bool {
+	switch c {
+	case CategoryTours, CategoryRentals, CategoryConsulting:
+		return true
+	}
+	return false
+}
+
+// OrderLine is one booking in an order, priced before any bundle discount.
+type OrderLine struct {
+	Category    string `json:"category"`
+	Reference   string `json:"reference,omitempty"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// QuotedLine is an order line after the bundle discount, with the
+// Foundation's share of what the guest will actually pay for it.
+type QuotedLine struct {
+	OrderLine
+	DiscountCents   int64 `json:"discount_cents"`
+	TotalCents      int64 `json:"total_cents"`
+	FoundationCents int64 `json:"foundation_cents"`
+}
+
+// OrderQuote prices an order. The bundle discount is taken off each
+// qualifying line before the Foundation allocation, so the Foundation's
+// share is of money actually received.
+type OrderQuote struct {
+	Lines           []QuotedLine `json:"lines"`
+	Bundle          *BundleRule  `json:"bundle,omitempty"`
+	SubtotalCents   int64        `json:"subtotal_cents"`
+	DiscountCents   int64        `json:"discount_cents"`
+	TotalCents      int64        `json:"total_cents"`
+	FoundationCents int64        `json:"foundation_cents"`
+	Currency        string       `json:"currency"`
+}
+
+// QuoteOrder applies the best bundle the order qualifies for and allocates
+// each discounted line.
+func QuoteOrder(lines []OrderLine, bundles BundlePolicy, foundation FoundationPolicy) OrderQuote {
+	present := make(map[string]bool)
+	for _, l := range lines {
+		present[l.Category] = true
+	}
+	q := OrderQuote{Lines: make([]QuotedLine, 0, len(lines)), Currency: "USD"}
+	bundle, ok := bundles.Match(present)
+	inBundle := make(map[string]bool)
+	if ok {
+		q.Bundle = &bundle
+		for _, c := range bundle.Categories {
+			inBundle[c] = true
+		}
+	}
+	for _, l := range lines {
+		ql := QuotedLine{OrderLine: l}
+		if inBundle[l.Category] {
+			ql.DiscountCents = bundle.Rate.Of(l.AmountCents)
+		}
+		ql.TotalCents = l.AmountCents - ql.DiscountCents
+		ql.FoundationCents, _ = foundation.Allocate(ql.TotalCents, l.Category)
+		q.SubtotalCents += l.AmountCents
+		q.DiscountCents += ql.DiscountCents
+		q.TotalCents += ql.TotalCents
+		q.FoundationCents += ql.FoundationCents
+		q.Lines = append(q.Lines, ql)
+	}
+	return q
+}
+
+// quoteOrderHandler prices a multi-booking order, itemizing any bundle
+// discount.
+func (s *server) quoteOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Lines []OrderLine `json:"lines"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if len(req.Lines) == 0 || len(req.Lines) > maxOrderLines {
+		respondError(w, http.StatusBadRequest, "invalid_order", fmt.Sprintf("an order needs between 1 and %d lines", maxOrderLines))
+		return
+	}
+	for i, l := range req.Lines {
+		if !validCategory(l.Category) {
+			respondError(w, http.StatusBadRequest, "invalid_order", fmt.Sprintf("line %d: category must be one of tours, rentals or consulting", i))
+			return
+		}
+		if l.AmountCents <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid_order", fmt.Sprintf("line %d: amount_cents must be positive", i))
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, QuoteOrder(req.Lines, s.cfg.Bundles, s.cfg.foundationPolicy(s.tenant(r.Context()))))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func quoteOrder(t *testing.T, s *server, lines ...OrderLine) OrderQuote {
+	t.Helper()
+	var got OrderQuote
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/orders/quote", map[string]interface{}{"lines": lines}, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func newBundleTestServer(t *testing.T) *server {
+	t.Helper()
+	s := newTestServer(t)
+	bundles, err := parseBundlePolicy("tours+rentals=10%, rentals+tours+consulting=15%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.Bundles = bundles
+	return s
+}
+
+func TestTourAndRentalOrderGetsBundleDiscount(t *testing.T) {
+	s := newBundleTestServer(t)
+
+	got := quoteOrder(t, s,
+		OrderLine{Category: CategoryTours, Reference: "bk_tour", AmountCents: 9000},
+		OrderLine{Category: CategoryRentals, Reference: "bk_stay", AmountCents: 45000},
+	)
+	if got.Bundle == nil || got.Bundle.Name != "rentals+tours" || got.Bundle.Rate != 10*apitypes.OnePercent {
+		t.Fatalf("bundle = %+v", got.Bundle)
+	}
+	if got.SubtotalCents != 54000 || got.DiscountCents != 5400 || got.TotalCents != 48600 {
+		t.Fatalf("totals = %+v", got)
+	}
+	tour, stay := got.Lines[0], got.Lines[1]
+	if tour.DiscountCents != 900 || tour.TotalCents != 8100 || stay.DiscountCents != 4500 || stay.TotalCents != 40500 {
+		t.Fatalf("lines = %+v", got.Lines)
+	}
+	// The Foundation's 15% is of the discounted amounts.
+	if tour.FoundationCents != 1215 || stay.FoundationCents != 6075 || got.FoundationCents != 7290 {
+		t.Fatalf("foundation = %d + %d = %d", tour.FoundationCents, stay.FoundationCents, got.FoundationCents)
+	}
+}
+
+func TestSingleLineOrderGetsNoBundle(t *testing.T) {
+	s := newBundleTestServer(t)
+
+	got := quoteOrder(t, s, OrderLine{Category: CategoryTours, AmountCents: 9000})
+	if got.Bundle != nil || got.DiscountCents != 0 || got.TotalCents != 9000 || got.Lines[0].FoundationCents != 1350 {
+		t.Fatalf("quote = %+v", got)
+	}
+	// Two tours are still one kind of product.
+	got = quoteOrder(t, s, OrderLine{Category: CategoryTours, AmountCents: 9000}, OrderLine{Category: CategoryTours, AmountCents: 4000})
+	if got.Bundle != nil || got.DiscountCents != 0 {
+		t.Fatalf("two tours: %+v", got)
+	}
+}
+
+func TestBundleDiscountsOnlyItsCategoriesAndPicksBest(t *testing.T) {
+	s := newBundleTestServer(t)
+
+	got := quoteOrder(t, s,
+		OrderLine{Category: CategoryTours, AmountCents: 10000},
+		OrderLine{Category: CategoryRentals, AmountCents: 20000},
+		OrderLine{Category: CategoryConsulting, AmountCents: 30000},
+	)
+	if got.Bundle == nil || got.Bundle.Rate != 15*apitypes.OnePercent || got.DiscountCents != 9000 {
+		t.Fatalf("three-way bundle = %+v", got)
+	}
+
+	s.cfg.Bundles = s.cfg.Bundles[:1]
+	got = quoteOrder(t, s,
+		OrderLine{Category: CategoryTours, AmountCents: 10000},
+		OrderLine{Category: CategoryRentals, AmountCents: 20000},
+		OrderLine{Category: CategoryConsulting, AmountCents: 30000},
+	)
+	if got.DiscountCents != 3000 || got.Lines[2].DiscountCents != 0 {
+		t.Fatalf("consulting outside the bundle was discounted: %+v", got.Lines)
+	}
+}
+
+func TestQuoteOrderRejectsBadLines(t *testing.T) {
+	s := newBundleTestServer(t)
+	for _, lines := range [][]OrderLine{
+		nil,
+		{{Category: "cruises", AmountCents: 100}},
+		{{Category: CategoryTours, AmountCents: 0}},
+	} {
+		rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/orders/quote", map[string]interface{}{"lines": lines}, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%+v: status %d, want 400", lines, rec.Code)
+		}
+	}
+}
+
+func TestBundlePolicyValidation(t *testing.T) {
+	for _, in := range []string{"tours=10%", "tours+cruises=10%", "tours+rentals=100%"} {
+		p, err := parseBundlePolicy(in)
+		if err == nil {
+			err = p.validate()
+		}
+		if err == nil {
+			t.Errorf("%q: accepted", in)
+		}
+	}
+	if _, err := parseBundlePolicy("tours+rentals"); err == nil {
+		t.Error("missing rate accepted")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+var (
+	ErrAuthorizationNotFound = errors.New("authorization not found")
+	ErrAuthorizationExpired  = errors.New("authorization has expired and can no longer be captured")
+	ErrAuthorizationSettled  = errors.New("authorization was already settled the other way")
+)
+
+// stripeAuthorizationLimit is how long Stripe holds an uncaptured card
+// authorization before releasing it to the guest.
+const stripeAuthorizationLimit = 7 * 24 * time.Hour
+
+// captureManual marks a checkout whose card is only authorized, in the
+// session and PaymentIntent metadata, so the webhook knows not to treat it
+// as paid.
+const captureManual = "manual"
+
+// Authorization states. An authorization is captured when the tour runs,
+// voided when it does not, and expired once Stripe has released it.
+const (
+	AuthorizationPending  = "authorized"
+	AuthorizationCaptured = "captured"
+	AuthorizationVoided   = "voided"
+	AuthorizationExpired  = "expired"
+)
+
+// Authorization is a card payment held but not yet taken. Nothing is
+// written to the ledger until it is captured, so the Foundation's share is
+// only allocated on money actually received.
+type Authorization struct {
+	PaymentRef   string            `json:"payment_ref"`
+	Tenant       string            `json:"tenant,omitempty"`
+	BookingID    string            `json:"booking_id"`
+	Category     string            `json:"category"`
+	AmountCents  int64             `json:"amount_cents"`
+	Currency     string            `json:"currency"`
+	Status       string            `json:"status"`
+	AuthorizedAt apitypes.JSONTime `json:"authorized_at"`
+	ExpiresAt    apitypes.JSONTime `json:"expires_at"`
+	SettledAt    apitypes.JSONTime `json:"settled_at"`
+	ReferralCode string            `json:"referral_code,omitempty"`
+}
+
+// authorizations holds manual-capture payments by PaymentIntent. mu also
+// serialises captures and voids so an authorization is settled once.
+type authorizations struct {
+	mu    sync.Mutex
+	byRef map[string]*Authorization
+}
+
+func newAuthorizations() *authorizations {
+	return &authorizations{byRef: make(map[string]*Authorization)}
+}
+
+// Add records a new authorization. A redelivered one is ignored.
+func (a *authorizations) Add(auth Authorization) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.byRef[auth.PaymentRef]; !ok {
+		a.byRef[auth.PaymentRef] = &auth
+	}
+}
+
+// Get returns the authorization for a PaymentIntent.
+func (a *authorizations) Get(ref string) (Authorization, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	auth, ok := a.byRef[ref]
+	if !ok {
+		return Authorization{}, ErrAuthorizationNotFound
+	}
+	return *auth, nil
+}
+
+// authorize records a manual-capture payment the bookings service has
+// accepted, capturable until StripeAuthorizationTTL from now.
+func (s *server) authorize(p Payment) {
+	now := s.now()
+	s.authorizations.Add(Authorization{
+		PaymentRef:   p.Ref,
+		Tenant:       p.Tenant,
+		BookingID:    p.BookingID,
+		Category:     p.Category,
+		AmountCents:  p.GrossCents,
+		Currency:     p.Currency,
+		Status:       AuthorizationPending,
+		AuthorizedAt: apitypes.JSONTime{Time: now},
+		ExpiresAt:    apitypes.JSONTime{Time: now.Add(s.cfg.StripeAuthorizationTTL)},
+		ReferralCode: p.ReferralCode,
+	})
+}
+
+// settleLocked moves auth on to status, or reports why it cannot be. It
+// returns done when auth is already in status, so a retried capture or
+// void answers with the original outcome. An authorization past its expiry
+// is marked expired first. s.authorizations.mu must be held.
+func (s *server) settleLocked(auth *Authorization, status string) (done bool, err error) {
+	if auth.Status == AuthorizationPending && !s.now().Before(auth.ExpiresAt.Time) {
+		auth.Status, auth.SettledAt = AuthorizationExpired, auth.ExpiresAt
+	}
+	switch auth.Status {
+	case status:
+		return true, nil
+	case AuthorizationPending:
+		return false, nil
+	case AuthorizationExpired:
+		return false, ErrAuthorizationExpired
+	}
+	return false, fmt.Errorf("%w: it is %s", ErrAuthorizationSettled, auth.Status)
+}
+
+// Capture takes an authorized payment and records it in the ledger with
+// its Foundation share, as any other card payment is when it succeeds.
+// Stripe dedupes retries by the PaymentIntent, so a capture that failed
+// partway can be repeated.
+func (s *server) Capture(ctx context.Context, ref string) (Authorization, []LedgerEntry, error) {
+	s.authorizations.mu.Lock()
+	defer s.authorizations.mu.Unlock()
+	auth, ok := s.authorizations.byRef[ref]
+	if !ok {
+		return Authorization{}, nil, ErrAuthorizationNotFound
+	}
+	if done, err := s.settleLocked(auth, AuthorizationCaptured); done || err != nil {
+		return *auth, nil, err
+	}
+	ctx, capture := withExchangeCapture(ctx)
+	err := s.stripe.post(ctx, "/v1/payment_intents/"+url.PathEscape(ref)+"/capture", url.Values{}, "capture-"+ref, nil)
+	s.payloads.Add(ref, capture.list()...)
+	if err != nil {
+		return *auth, nil, err
+	}
+	auth.Status, auth.SettledAt = AuthorizationCaptured, apitypes.JSONTime{Time: s.now()}
+	entries := s.commitPayment(Payment{
+		Ref:        auth.PaymentRef,
+		Tenant:     auth.Tenant,
+		BookingID:  auth.BookingID,
+		Category:   auth.Category,
+		GrossCents: auth.AmountCents,
+		Currency:   auth.Currency,
+		Rail:       string(RailCard),
+		PaidAt:     auth.SettledAt,
+
+		ReferralCode: auth.ReferralCode,
+	})
+	return *auth, entries, nil
+}
+
+// Void releases an authorized payment back to the guest. Nothing is
+// written to the ledger. Voiding one Stripe has already released only
+// records that it expired.
+func (s *server) Void(ctx context.Context, ref string) (Authorization, error) {
+	s.authorizations.mu.Lock()
+	defer s.authorizations.mu.Unlock()
+	auth, ok := s.authorizations.byRef[ref]
+	if !ok {
+		return Authorization{}, ErrAuthorizationNotFound
+	}
+	if done, err := s.settleLocked(auth, AuthorizationVoided); done || errors.Is(err, ErrAuthorizationExpired) {
+		return *auth, nil
+	} else if err != nil {
+		return *auth, err
+	}
+	ctx, capture := withExchangeCapture(ctx)
+	err := s.stripe.post(ctx, "/v1/payment_intents/"+url.PathEscape(ref)+"/cancel", url.Values{}, "cancel-"+ref, nil)
+	s.payloads.Add(ref, capture.list()...)
+	if err != nil {
+		return *auth, err
+	}
+	auth.Status, auth.SettledAt = AuthorizationVoided, apitypes.JSONTime{Time: s.now()}
+	return *auth, nil
+}
+
+// respondAuthorizationError maps Capture and Void errors to responses.
+func respondAuthorizationError(w http.ResponseWriter, ref string, err error) {
+	switch {
+	case errors.Is(err, ErrAuthorizationNotFound):
+		respondError(w, http.StatusNotFound, "authorization_not_found", err.Error())
+	case errors.Is(err, ErrAuthorizationExpired):
+		respondError(w, http.StatusConflict, "authorization_expired", err.Error())
+	case errors.Is(err, ErrAuthorizationSettled):
+		respondError(w, http.StatusConflict, "authorization_settled", err.Error())
+	default:
+		log.Printf("settling authorization %s failed: %v", ref, err)
+		respondError(w, http.StatusBadGateway, "stripe_unavailable", "could not settle authorization with Stripe")
+	}
+}
+
+// captureHandler captures a manual-capture payment once its tour has run.
+// Capturing after Stripe has released the authorization is refused with
+// 409 authorization_expired.
+func (s *server) captureHandler(w http.ResponseWriter, r *http.Request) {
+	ref := chi.URLParam(r, "paymentRef")
+	auth, entries, err := s.Capture(r.Context(), ref)
+	if err != nil {
+		respondAuthorizationError(w, ref, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"authorization": auth, "entries": entries})
+}
+
+// voidHandler releases a manual-capture payment whose tour did not run.
+func (s *server) voidHandler(w http.ResponseWriter, r *http.Request) {
+	ref := chi.URLParam(r, "paymentRef")
+	auth, err := s.Void(r.Context(), ref)
+	if err != nil {
+		respondAuthorizationError(w, ref, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"authorization": auth})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStripeIntents answers PaymentIntent captures and cancels, recording
+// the paths called.
+type fakeStripeIntents struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeStripeIntents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.URL.Path)
+	json.NewEncoder(w).Encode(map[string]string{"id": "pi_test_1"})
+}
+
+// newAuthorizedTestServer has bookings accept a manual-capture checkout for
+// bk-1 as a $200 tour, held for a day.
+func newAuthorizedTestServer(t *testing.T) (*server, *fakeStripeIntents) {
+	t.Helper()
+	s := newTestServer(t)
+	s.cfg.StripeAuthorizationTTL = 24 * time.Hour
+	stripe := &fakeStripeIntents{}
+	api := httptest.NewServer(stripe)
+	t.Cleanup(api.Close)
+	s.stripe = newStripeClient("sk_test", api.URL)
+
+	event := checkoutCompleted("bk-1")
+	event["data"].(map[string]interface{})["object"].(map[string]interface{})["metadata"] = map[string]string{
+		"booking_id": "bk-1", "category": CategoryTours, "capture": captureManual,
+	}
+	var resp map[string]string
+	if rec := postStripeEvent(t, s, event, testWebhookSecret, &resp); rec.Code != http.StatusOK || resp["status"] != "processed" {
+		t.Fatalf("webhook: status %d resp %v", rec.Code, resp)
+	}
+	return s, stripe
+}
+
+func TestManualCaptureCheckoutOnlyAuthorizesCard(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	req := testCheckout
+	req.ManualCapture = true
+	if rec := postCheckout(t, s.routes(), "booking-bk-1-checkout", req); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	form := stripe.forms[0]
+	if form.Get("payment_intent_data[capture_method]") != "manual" || form.Get("payment_intent_data[metadata][capture]") != captureManual {
+		t.Fatalf("session form %v does not ask for manual capture", form)
+	}
+}
+
+func TestAuthorizedPaymentAllocatesFoundationOnlyOnCapture(t *testing.T) {
+	s, stripe := newAuthorizedTestServer(t)
+	if entries := s.ledger.Entries(nil); len(entries) != 0 {
+		t.Fatalf("authorization wrote ledger entries %+v", entries)
+	}
+
+	var resp struct {
+		Authorization Authorization `json:"authorization"`
+		Entries       []LedgerEntry `json:"entries"`
+	}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/pi_test_1/capture", nil, &resp)
+	if rec.Code != http.StatusOK || resp.Authorization.Status != AuthorizationCaptured {
+		t.Fatalf("capture: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(stripe.calls) != 1 || stripe.calls[0] != "/v1/payment_intents/pi_test_1/capture" {
+		t.Fatalf("stripe calls %v", stripe.calls)
+	}
+	entries := s.ledger.Entries(nil)
+	if len(entries) != 2 || entries[0].Kind != EntryGross || entries[0].AmountCents != 20000 ||
+		entries[1].Kind != EntryFoundation || entries[1].AmountCents != 3000 || entries[1].BookingID != "bk-1" {
+		t.Fatalf("ledger after capture = %+v, want $200 gross and its 15%% Foundation share", entries)
+	}
+
+	// A retried capture answers as before without taking the money twice.
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/payments/pi_test_1/capture", nil, nil)
+	if rec.Code != http.StatusOK || len(stripe.calls) != 1 || len(s.ledger.Entries(nil)) != 2 {
+		t.Fatalf("retried capture: status %d, %d stripe calls, %d entries", rec.Code, len(stripe.calls), len(s.ledger.Entries(nil)))
+	}
+}
+
+func TestVoidReleasesAuthorizationWithoutLedgerEntries(t *testing.T) {
+	s, stripe := newAuthorizedTestServer(t)
+	var resp struct {
+		Authorization Authorization `json:"authorization"`
+	}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/pi_test_1/void", nil, &resp)
+	if rec.Code != http.StatusOK || resp.Authorization.Status != AuthorizationVoided {
+		t.Fatalf("void: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(stripe.calls) != 1 || stripe.calls[0] != "/v1/payment_intents/pi_test_1/cancel" {
+		t.Fatalf("stripe calls %v", stripe.calls)
+	}
+	if entries := s.ledger.Entries(nil); len(entries) != 0 {
+		t.Fatalf("void wrote ledger entries %+v", entries)
+	}
+
+	var body map[string]string
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/payments/pi_test_1/capture", nil, &body)
+	if rec.Code != http.StatusConflict || body["error"] != "authorization_settled" {
+		t.Fatalf("capture after void: status %d resp %v, want 409 authorization_settled", rec.Code, body)
+	}
+}
+
+func TestCaptureAfterAuthorizationExpiryIsRefused(t *testing.T) {
+	s, stripe := newAuthorizedTestServer(t)
+	authorized := s.now()
+	s.now = func() time.Time { return authorized.Add(25 * time.Hour) }
+
+	var body map[string]string
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/pi_test_1/capture", nil, &body)
+	if rec.Code != http.StatusConflict || body["error"] != "authorization_expired" {
+		t.Fatalf("status %d resp %v, want 409 authorization_expired", rec.Code, body)
+	}
+	if len(stripe.calls) != 0 || len(s.ledger.Entries(nil)) != 0 {
+		t.Fatalf("expired capture reached Stripe (%v) or the ledger", stripe.calls)
+	}
+	if auth, _ := s.authorizations.Get("pi_test_1"); auth.Status != AuthorizationExpired {
+		t.Fatalf("authorization = %+v, want expired", auth)
+	}
+}
+
+func TestAuthorizationForLostSeatsIsVoided(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.StripeAuthorizationTTL = 24 * time.Hour
+	stripe := &fakeStripeIntents{}
+	api := httptest.NewServer(stripe)
+	t.Cleanup(api.Close)
+	s.stripe = newStripeClient("sk_test", api.URL)
+	s.bookings.(*fakeBookings).status = "failed_no_capacity"
+
+	event := checkoutCompleted("bk-2")
+	event["data"].(map[string]interface{})["object"].(map[string]interface{})["metadata"] = map[string]string{
+		"booking_id": "bk-2", "capture": captureManual,
+	}
+	postStripeEvent(t, s, event, testWebhookSecret, nil)
+	if auth, _ := s.authorizations.Get("pi_test_1"); auth.Status != AuthorizationVoided || len(stripe.calls) != 1 {
+		t.Fatalf("authorization %+v after %v, want it voided", auth, stripe.calls)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different checkout")
+
+// checkoutCurrencies maps each currency a checkout may be priced in to the
+// one Stripe charges it in. BTC-PROXY is a dollar price shown to guests as
+// a bitcoin equivalent, so it is charged in dollars.
+var checkoutCurrencies = map[string]string{
+	"USD":       "usd",
+	"BTC-PROXY": "usd",
+}
+
+// chargeCurrency returns the currency Stripe charges a checkout priced in
+// currency in: one of checkoutCurrencies, or the tenant's own currency.
+func chargeCurrency(tenant Tenant, currency string) (string, bool) {
+	if charged, ok := checkoutCurrencies[currency]; ok {
+		return charged, true
+	}
+	if tenant.Currency != "" && strings.EqualFold(currency, tenant.Currency) {
+		return strings.ToLower(currency), true
+	}
+	return "", false
+}
+
+// stripeMinimumCharge is the smallest amount Stripe will charge in each
+// currency, in that currency's minor unit. Currencies not listed are left
+// for Stripe to judge.
+var stripeMinimumCharge = map[string]int64{
+	"USD": 50,
+	"EUR": 50,
+	"GBP": 30,
+	"CAD": 50,
+	"AUD": 50,
+	"CHF": 50,
+	"BRL": 50,
+	"MXN": 1000,
+	"JPY": 50,
+}
+
+// stripeMinimum returns the minimum charge for currency, if Stripe has one
+// we know of.
+func stripeMinimum(currency string) (int64, bool) {
+	minimum, ok := stripeMinimumCharge[strings.ToUpper(currency)]
+	return minimum, ok
+}
+
+// CheckoutRequest is a booking's request for a hosted checkout page. The
+// amount is given either in minor units as amount_cents or as a decimal
+// string in amount, e.g. "100.00". GuestEmail and CardFingerprint, a
+// saved card's Stripe fingerprint, are optional and count the checkout
+// against the guest and card for velocity limits. SuccessURL and CancelURL
+// override where Stripe sends the guest afterwards; they must stay on the
+// configured pages' sites. ManualCapture only authorizes the card, for tours
+// that may be called off; the payment is taken later with a capture.
+// ReferralCode credits the partner who sent the guest; an unknown code is
+// ignored.
+type CheckoutRequest struct {
+	BookingID       string `json:"booking_id"`
+	AmountCents     int64  `json:"amount_cents"`
+	Amount          string `json:"amount,omitempty"`
+	Currency        string `json:"currency"`
+	Category        string `json:"category"`
+	Description     string `json:"description"`
+	GuestEmail      string `json:"guest_email,omitempty"`
+	CardFingerprint string `json:"card_fingerprint,omitempty"`
+	SuccessURL      string `json:"success_url,omitempty"`
+	CancelURL       string `json:"cancel_url,omitempty"`
+	ManualCapture   bool   `json:"manual_capture,omitempty"`
+	ReferralCode    string `json:"referral_code,omitempty"`
+}
+
+// redirectURL returns the page Stripe should send the guest to: requested
+// when given, otherwise configured. A requested page must be an http(s)
+// URL on the configured page's host, so a checkout cannot send guests off
+// the site.
+func redirectURL(requested, configured string) (string, error) {
+	if requested == "" {
+		return configured, nil
+	}
+	u, err := url.Parse(requested)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", errors.New("success_url and cancel_url must be absolute http(s) URLs")
+	}
+	if base, err := url.Parse(configured); err != nil || !strings.EqualFold(u.Host, base.Host) {
+		return "", fmt.Errorf("success_url and cancel_url must be on %s", base.Host)
+	}
+	return requested, nil
+}
+
+// CheckoutSession is a Stripe Checkout Session the guest pays on.
+type CheckoutSession struct {
+	ID  string `json:"session_id"`
+	URL string `json:"url"`
+}
+
+// checkoutResponse is a checkout session with the Foundation's share of
+// the payment, as it will be allocated once paid.
+type checkoutResponse struct {
+	CheckoutSession
+	Foundation foundationEstimate `json:"foundation"`
+}
+
+// checkoutAttempt is the first call made with an idempotency key. Repeats
+// wait on done and share its outcome.
+type checkoutAttempt struct {
+	req     CheckoutRequest
+	done    chan struct{}
+	session CheckoutSession
+	err     error
+}
+
+// checkoutStore remembers checkouts by idempotency key so a retried call
+// returns the session already created rather than opening another one.
+type checkoutStore struct {
+	mu       sync.Mutex
+	attempts map[string]*checkoutAttempt
+}
+
+func newCheckoutStore() *checkoutStore {
+	return &checkoutStore{attempts: make(map[string]*checkoutAttempt)}
+}
+
+// begin returns the attempt for key, and whether the caller started it and
+// must finish it. Reusing a key for a different request is an error.
+func (c *checkoutStore) begin(key string, req CheckoutRequest) (*checkoutAttempt, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if a, ok := c.attempts[key]; ok {
+		if a.req != req {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		return a, false, nil
+	}
+	a := &checkoutAttempt{req: req, done: make(chan struct{})}
+	c.attempts[key] = a
+	return a, true, nil
+}
+
+// finish records the outcome of an attempt. A failed attempt is forgotten
+// so the next call with its key tries again.
+func (c *checkoutStore) finish(key string, a *checkoutAttempt, session CheckoutSession, err error) {
+	c.mu.Lock()
+	a.session, a.err = session, err
+	if err != nil {
+		delete(c.attempts, key)
+	}
+	c.mu.Unlock()
+	close(a.done)
+}
+
+// createCheckoutSession opens a Stripe Checkout Session for req. The booking
+// id, category and tenant travel as metadata on the session and its PaymentIntent so
+// the webhook can attribute the payment, along with whether it is only
+// authorized and the referral code it was booked with.
+func (s *server) createCheckoutSession(r *http.Request, req CheckoutRequest, idempotencyKey string) (CheckoutSession, error) {
+	charged, _ := chargeCurrency(s.tenant(r.Context()), req.Currency)
+	form := url.Values{
+		"mode":                                   {"payment"},
+		"success_url":                            {req.SuccessURL},
+		"cancel_url":                             {req.CancelURL},
+		"client_reference_id":                    {req.BookingID},
+		"line_items[0][quantity]":                {"1"},
+		"line_items[0][price_data][currency]":    {charged},
+		"line_items[0][price_data][unit_amount]": {strconv.FormatInt(req.AmountCents, 10)},
+		"line_items[0][price_data][product_data][name]": {req.Description},
+		"metadata[booking_id]":                          {req.BookingID},
+		"metadata[category]":                            {req.Category},
+		"payment_intent_data[metadata][booking_id]":     {req.BookingID},
+		"payment_intent_data[metadata][category]":       {req.Category},
+		"metadata[tenant]":                              {s.tenant(r.Context()).ID},
+		"payment_intent_data[metadata][tenant]":         {s.tenant(r.Context()).ID},
+	}
+	if req.ManualCapture {
+		form.Set("payment_intent_data[capture_method]", "manual")
+		form.Set("metadata[capture]", captureManual)
+		form.Set("payment_intent_data[metadata][capture]", captureManual)
+	}
+	if req.ReferralCode != "" {
+		form.Set("metadata[referral_code]", req.ReferralCode)
+		form.Set("payment_intent_data[metadata][referral_code]", req.ReferralCode)
+	}
+	var out struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	ctx, capture := withExchangeCapture(r.Context())
+	if err := s.stripe.post(ctx, "/v1/checkout/sessions", form, idempotencyKey, &out); err != nil {
+		return CheckoutSession{}, err
+	}
+	s.payloads.Add(out.ID, capture.list()...)
+	return CheckoutSession{ID: out.ID, URL: out.URL}, nil
+}
+
+// createCheckoutHandler opens a hosted checkout for a booking. Only the
+// bookings service, holding the admin key, opens one, since the amount
+// charged is taken from the body. Callers must send an Idempotency-Key: repeating a call with the same key and body
+// returns the original session, marked with Idempotent-Replayed, and a
+// call that failed can be retried with the same key. Too many checkouts
+// from one guest, IP or card are refused with 429 velocity_exceeded;
+// retries with a key already counted are not. A currency Stripe is not
+// charged in here is refused with 400, and without a Stripe key every
+// checkout is refused with 503.
+func (s *server) createCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		respondError(w, http.StatusBadRequest, "missing_idempotency_key", "Idempotency-Key header is required")
+		return
+	}
+	var req CheckoutRequest
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	tenant := s.tenant(r.Context())
+	if req.Currency == "" {
+		req.Currency = tenant.Currency
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+	charged, ok := chargeCurrency(tenant, req.Currency)
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid_currency", "currency must be USD, BTC-PROXY or the site's own currency")
+		return
+	}
+	if req.Amount != "" {
+		m, err := ParseMoney(req.Amount, req.Currency)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_amount", err.Error())
+			return
+		}
+		if req.AmountCents != 0 && req.AmountCents != m.MinorUnits {
+			respondError(w, http.StatusBadRequest, "invalid_amount", "amount and amount_cents disagree")
+			return
+		}
+		// Normalize so "100" and "100.00" share an idempotency key.
+		req.AmountCents, req.Amount = m.MinorUnits, ""
+	}
+	if req.BookingID == "" || req.AmountCents <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_checkout", "booking_id and a positive amount or amount_cents are required")
+		return
+	}
+	var err error
+	if req.SuccessURL, err = redirectURL(req.SuccessURL, s.cfg.CheckoutSuccessURL); err == nil {
+		req.CancelURL, err = redirectURL(req.CancelURL, s.cfg.CheckoutCancelURL)
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_redirect_url", err.Error())
+		return
+	}
+	// Stripe would reject the charge anyway; say why instead of relaying
+	// its error as a gateway failure.
+	if minimum, ok := stripeMinimum(charged); ok && req.AmountCents < minimum {
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":         "below_minimum",
+			"message":       fmt.Sprintf("amount_cents must be at least %d for %s", minimum, req.Currency),
+			"currency":      req.Currency,
+			"minimum_cents": minimum,
+		})
+		return
+	}
+
+	if !s.stripe.configured() {
+		log.Printf("ALERT: checkout for booking %s refused: STRIPE_SECRET_KEY is not set", req.BookingID)
+		respondError(w, http.StatusServiceUnavailable, "stripe_not_configured", "card payments are not configured")
+		return
+	}
+
+	if req.ReferralCode != "" {
+		partner, ok := s.cfg.Referrals.lookup(req.ReferralCode)
+		if !ok {
+			log.Printf("checkout for booking %s: ignoring unknown referral code %q", req.BookingID, req.ReferralCode)
+		}
+		req.ReferralCode = partner.Code
+	}
+
+	if !s.checkVelocity(w, r, req, key) {
+		return
+	}
+
+	attempt, first, err := s.checkouts.begin(key, req)
+	if err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", err.Error())
+		return
+	}
+	if first {
+		session, err := s.createCheckoutSession(r, req, key)
+		s.checkouts.finish(key, attempt, session, err)
+	} else {
+		select {
+		case <-attempt.done:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+
+	if attempt.err != nil {
+		log.Printf("checkout for booking %s failed: %v", req.BookingID, attempt.err)
+		respondError(w, http.StatusBadGateway, "stripe_unavailable", "could not create checkout session")
+		return
+	}
+	respondJSON(w, http.StatusOK, checkoutResponse{
+		CheckoutSession: attempt.session,
+		Foundation:      s.estimateFoundation(tenant, req.AmountCents, req.Category, req.Currency),
+	})
+}
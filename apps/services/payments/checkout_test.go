@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// fakeStripeCheckout creates a numbered session per call, failing the first
+// failures calls with a 400 so they are not retried.
+type fakeStripeCheckout struct {
+	mu       sync.Mutex
+	failures int
+	created  int
+	keys     []string
+	forms    []url.Values
+}
+
+func (f *fakeStripeCheckout) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, r.Header.Get("Idempotency-Key"))
+	r.ParseForm()
+	f.forms = append(f.forms, r.PostForm)
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"type":"api_error","message":"boom"}}`))
+		return
+	}
+	f.created++
+	json.NewEncoder(w).Encode(map[string]string{"id": fmt.Sprintf("cs_%d", f.created), "url": "https://checkout.stripe.test"})
+}
+
+func newCheckoutTestServer(t *testing.T, failures int) (*server, *fakeStripeCheckout) {
+	t.Helper()
+	s := newTestServer(t)
+	stripe := &fakeStripeCheckout{failures: failures}
+	api := httptest.NewServer(stripe)
+	t.Cleanup(api.Close)
+	s.stripe = newStripeClient("sk_test", api.URL)
+	return s, stripe
+}
+
+func postCheckout(t *testing.T, h http.Handler, key string, req CheckoutRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/payments/checkout", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminKey)
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+var testCheckout = CheckoutRequest{BookingID: "bk-1", AmountCents: 9000, Currency: "USD", Category: CategoryTours, Description: "tour volcano-hike"}
+
+func TestCheckoutRequiresAdminKey(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	body, _ := json.Marshal(testCheckout)
+	r := httptest.NewRequest(http.MethodPost, "/api/payments/checkout", bytes.NewReader(body))
+	r.Header.Set("Idempotency-Key", "booking-bk-1-checkout")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", rec.Code)
+	}
+	if len(stripe.forms) != 0 {
+		t.Fatalf("an unauthenticated checkout reached Stripe: %v", stripe.forms)
+	}
+}
+
+func TestCheckoutShowsFoundationShare(t *testing.T) {
+	s, _ := newCheckoutTestServer(t, 0)
+	s.cfg.Foundation.CategoryRates = map[string]apitypes.Percent{CategoryRentals: 20 * apitypes.OnePercent}
+	cases := []struct {
+		category       string
+		gross          int64
+		wantRate       apitypes.Percent
+		wantFoundation int64
+	}{
+		{CategoryTours, 10001, 15 * apitypes.OnePercent, 1500}, // 1500.15 rounds down
+		{CategoryTours, 10010, 15 * apitypes.OnePercent, 1502}, // 1501.5 rounds half to even
+		{CategoryRentals, 10003, 20 * apitypes.OnePercent, 2001},
+	}
+	for i, c := range cases {
+		req := testCheckout
+		req.BookingID, req.Category, req.AmountCents = fmt.Sprintf("bk-%d", i), c.category, c.gross
+		var got checkoutResponse
+		rec := postCheckout(t, s.routes(), "checkout-"+req.BookingID, req)
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		f := got.Foundation
+		if got.ID == "" || f.Rate != c.wantRate || f.FoundationCents != c.wantFoundation || f.FoundationCents+f.NetCents != c.gross || f.Currency != "USD" {
+			t.Errorf("%s %d: foundation %+v, want %s = %d", c.category, c.gross, f, c.wantRate, c.wantFoundation)
+		}
+	}
+}
+
+func TestCheckoutWithSameKeyCreatesOneSession(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	h := s.routes()
+
+	var first, second CheckoutSession
+	rec := postCheckout(t, h, "booking-bk-1-checkout", testCheckout)
+	json.Unmarshal(rec.Body.Bytes(), &first)
+	if rec.Code != http.StatusOK || first.ID == "" {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	rec = postCheckout(t, h, "booking-bk-1-checkout", testCheckout)
+	json.Unmarshal(rec.Body.Bytes(), &second)
+	if rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("replay: status %d, headers %v", rec.Code, rec.Header())
+	}
+	if first != second || stripe.created != 1 {
+		t.Fatalf("sessions %+v and %+v, %d created; want one", first, second, stripe.created)
+	}
+	if stripe.keys[0] != "booking-bk-1-checkout" {
+		t.Fatalf("stripe idempotency key = %q", stripe.keys[0])
+	}
+}
+
+func TestCheckoutRetriesAfterFailedAttempt(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 1)
+	h := s.routes()
+
+	if rec := postCheckout(t, h, "booking-bk-1-checkout", testCheckout); rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502", rec.Code)
+	}
+	if rec := postCheckout(t, h, "booking-bk-1-checkout", testCheckout); rec.Code != http.StatusOK {
+		t.Fatalf("retry: status %d: %s", rec.Code, rec.Body)
+	}
+	if stripe.created != 1 {
+		t.Fatalf("created = %d, want 1", stripe.created)
+	}
+}
+
+func TestCheckoutRejectsReusedKeyAndMissingKey(t *testing.T) {
+	s, _ := newCheckoutTestServer(t, 0)
+	h := s.routes()
+
+	postCheckout(t, h, "k1", testCheckout)
+	other := testCheckout
+	other.AmountCents = 4500
+	if rec := postCheckout(t, h, "k1", other); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key: status %d, want 422", rec.Code)
+	}
+	if rec := postCheckout(t, h, "", testCheckout); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing key: status %d, want 400", rec.Code)
+	}
+}
+
+func TestCheckoutRejectsAmountBelowStripeMinimum(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	h := s.routes()
+
+	below := testCheckout
+	below.AmountCents = 49
+	rec := postCheckout(t, h, "k-below", below)
+	var body struct {
+		Error        string `json:"error"`
+		Currency     string `json:"currency"`
+		MinimumCents int64  `json:"minimum_cents"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusUnprocessableEntity || body.Error != "below_minimum" {
+		t.Fatalf("status %d: %s, want 422 below_minimum", rec.Code, rec.Body)
+	}
+	if body.Currency != "USD" || body.MinimumCents != 50 {
+		t.Errorf("minimum = %d %s, want 50 USD", body.MinimumCents, body.Currency)
+	}
+	if stripe.created != 0 || len(stripe.keys) != 0 {
+		t.Fatalf("stripe was called %d times, want none", len(stripe.keys))
+	}
+
+	atMinimum := testCheckout
+	atMinimum.AmountCents = 50
+	if rec := postCheckout(t, h, "k-min", atMinimum); rec.Code != http.StatusOK {
+		t.Fatalf("at minimum: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCheckoutRedirectsToRequestedPagesOnSite(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	s.cfg.CheckoutSuccessURL = "https://gatewayelsalvador.com/checkout/success"
+	s.cfg.CheckoutCancelURL = "https://gatewayelsalvador.com/checkout/cancelled"
+	h := s.routes()
+
+	req := testCheckout
+	req.SuccessURL = "https://gatewayelsalvador.com/tours/volcano-hike/booked?session_id={CHECKOUT_SESSION_ID}"
+	var session CheckoutSession
+	rec := postCheckout(t, h, "k-redirect", req)
+	json.Unmarshal(rec.Body.Bytes(), &session)
+	if rec.Code != http.StatusOK || session.URL == "" {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	form := stripe.forms[0]
+	if form.Get("success_url") != req.SuccessURL || form.Get("cancel_url") != s.cfg.CheckoutCancelURL {
+		t.Fatalf("stripe redirects = %q, %q", form.Get("success_url"), form.Get("cancel_url"))
+	}
+
+	req.CancelURL = "https://phish.example/cancelled"
+	if rec := postCheckout(t, h, "k-offsite", req); rec.Code != http.StatusBadRequest || len(stripe.forms) != 1 {
+		t.Fatalf("off-site cancel_url: status %d, stripe called %d times", rec.Code, len(stripe.forms))
+	}
+}
+
+func TestCheckoutWithoutStripeKeyFails(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	s.stripe.secretKey = ""
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	rec := postCheckout(t, s.routes(), "k-nokey", testCheckout)
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusServiceUnavailable || body.Error != "stripe_not_configured" || len(stripe.keys) != 0 {
+		t.Fatalf("status %d: %s; want 503 stripe_not_configured without calling stripe", rec.Code, rec.Body)
+	}
+}
+
+func TestCheckoutCurrencyAllowlist(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	for i, c := range []struct {
+		currency string
+		status   int
+	}{
+		{"usd", http.StatusOK},
+		{"BTC-PROXY", http.StatusOK},
+		{"EUR", http.StatusBadRequest},
+		{"btc", http.StatusBadRequest},
+	} {
+		req := testCheckout
+		req.BookingID, req.Currency = fmt.Sprintf("bk-cur-%d", i), c.currency
+		if rec := postCheckout(t, s.routes(), req.BookingID, req); rec.Code != c.status {
+			t.Errorf("%s: status %d, want %d: %s", c.currency, rec.Code, c.status, rec.Body)
+		}
+	}
+	if len(stripe.forms) != 2 {
+		t.Fatalf("stripe called %d times, want 2", len(stripe.forms))
+	}
+	for _, form := range stripe.forms {
+		if got := form.Get("line_items[0][price_data][currency]"); got != "usd" {
+			t.Errorf("charged in %q, want usd", got)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// defaultLowPriorityRoutes are the preview and estimate routes shed under
+// overload unless LOAD_SHED_LOW_PRIORITY_ROUTES names others.
+const defaultLowPriorityRoutes = "GET /api/payments/impact," +
+	"GET /api/payments/foundation/estimate," +
+	"POST /api/payments/orders/quote"
+
+// config holds the runtime settings for the payments service, loaded from the
+// environment with development-friendly defaults. Credentials are tagged
+// secret:"true" so GET /config never shows them.
+type config struct {
+	Port string
+
+	// HTTPTimeouts bound each stage of an incoming connection.
+	HTTPTimeouts httpkit.ServerTimeouts
+	// LoadShedding turns away low-priority routes under overload.
+	LoadShedding httpkit.LoadShedding
+
+	// RequestIDHeader is the header used to accept, echo and forward the
+	// request correlation id.
+	RequestIDHeader string
+
+	// Tenants are the brands served, loaded at startup from TenantsFile.
+	// Requests naming no tenant are served as DefaultTenant.
+	Tenants       Tenants
+	TenantsFile   string
+	DefaultTenant string
+
+	// Stripe credentials. The secret key is never logged or echoed back.
+	StripeSecretKey string `secret:"true"`
+	StripeAPIURL    string
+
+	// StripeWebhookSecrets are the signing secrets webhooks may be signed
+	// with. More than one is accepted while a secret is rotated. Webhooks
+	// are refused when none is set.
+	StripeWebhookSecrets []string `secret:"true"`
+
+	// CheckoutSuccessURL and CheckoutCancelURL are where Stripe Checkout
+	// sends the guest after paying or giving up.
+	CheckoutSuccessURL string
+	CheckoutCancelURL  string
+	// CheckoutVelocity limits how fast checkouts may be started by one
+	// guest, IP address or card.
+	CheckoutVelocity VelocityPolicy
+	// StripeAuthorizationTTL is how long a manual-capture checkout's card
+	// authorization may be captured. Stripe releases uncaptured card
+	// authorizations after seven days, so it may not be longer.
+	StripeAuthorizationTTL time.Duration
+
+	// LNDGRPCHost is the host:port of the LND node's gRPC interface.
+	// Lightning is off when it is empty.
+	LNDGRPCHost string
+	// LNDTLSCertPath is the node's tls.cert; empty trusts the system's
+	// certificate authorities instead.
+	LNDTLSCertPath string
+	// LNDMacaroonPath is the macaroon file, such as admin.macaroon, every
+	// call to the node is authenticated with.
+	LNDMacaroonPath string `secret:"true"`
+	// LightningFallbackRail is the rail guests are offered when the node
+	// cannot take a Lightning payment; empty offers none.
+	LightningFallbackRail string
+	// LightningMaxInvoiceSats caps the amount of one Lightning invoice;
+	// zero leaves it uncapped.
+	LightningMaxInvoiceSats int64
+	// OnchainConfirmations sets how many confirmations an on-chain payment
+	// needs before its order is marked paid, by payment size.
+	OnchainConfirmations ConfirmationPolicy
+
+	// BookingsServiceURL is the base URL of the bookings service, and
+	// BookingsServiceKey the bearer token it expects from us when we
+	// report payments, refunds and disputes.
+	BookingsServiceURL string
+	BookingsServiceKey string `secret:"true"`
+
+	// PricingServiceURL is the base URL of the pricing service, which
+	// supplies the BTC/USD rate. BTCRateMaxStaleness is how old that rate
+	// may be before the bitcoin rails are withheld; zero never withholds
+	// them.
+	PricingServiceURL   string
+	BTCRateMaxStaleness time.Duration
+
+	// AdminAPIKey guards operational endpoints. Admin routes are closed
+	// when it is empty.
+	AdminAPIKey string `secret:"true"`
+
+	// Foundation is the share of gross revenue allocated to the Foundation,
+	// loaded at startup by loadFoundationPolicy.
+	Foundation FoundationPolicy
+	// FoundationPayouts are the accounts the Foundation's share of fiat and
+	// BTC proceeds is paid out to.
+	FoundationPayouts FoundationPayoutAccounts
+	// GrantClaimTTL is how long a grant recipient has to claim an
+	// LNURL-withdraw grant before its amount returns to the Foundation.
+	GrantClaimTTL time.Duration
+
+	// PublicURL is where guests' and wallets' requests reach this service,
+	// used in the LNURL-withdraw links grants are claimed with.
+	PublicURL string
+
+	// Bundles are the discounts for booking several kinds of product in
+	// one order.
+	Bundles BundlePolicy
+
+	// IntegrationLimits caps concurrent calls per external integration,
+	// keyed by integration name. Unlisted integrations are unlimited.
+	IntegrationLimits map[string]outbound.ConcurrencyLimit
+
+	// Rails decides which payment rails are offered for a region and
+	// amount.
+	Rails RailPolicy
+
+	// Referrals are the partner codes guests may book with, and the
+	// commission each partner earns.
+	Referrals Referrals
+}
+
+func loadConfig() config {
+	return config{
+		Port:                 envString("PAYMENTS_SERVICE_PORT", "8001"),
+		RequestIDHeader:      envString("REQUEST_ID_HEADER", httpkit.RequestIDHeader),
+		HTTPTimeouts:         httpkit.ServerTimeoutsFromEnv(),
+		LoadShedding:         httpkit.LoadSheddingFromEnv(defaultLowPriorityRoutes),
+		TenantsFile:          os.Getenv("TENANTS_FILE"),
+		DefaultTenant:        envString("DEFAULT_TENANT", tenantkit.DefaultID),
+		StripeSecretKey:      os.Getenv("STRIPE_SECRET_KEY"),
+		StripeAPIURL:         envString("STRIPE_API_URL", "https://api.stripe.com"),
+		StripeWebhookSecrets: envList("STRIPE_WEBHOOK_SECRETS", os.Getenv("STRIPE_WEBHOOK_SECRET")),
+		CheckoutSuccessURL:   envString("CHECKOUT_SUCCESS_URL", "http://localhost:3000/checkout/success?session_id={CHECKOUT_SESSION_ID}"),
+		CheckoutCancelURL:    envString("CHECKOUT_CANCEL_URL", "http://localhost:3000/checkout/cancelled"),
+		LNDGRPCHost:          os.Getenv("LND_GRPC_HOST"),
+		LNDTLSCertPath:       os.Getenv("LND_TLS_CERT_PATH"),
+		LNDMacaroonPath:      os.Getenv("LND_MACAROON_PATH"),
+		BookingsServiceURL:   envString("BOOKINGS_SERVICE_URL", "http://localhost:8002"),
+		BookingsServiceKey:   os.Getenv("INTERNAL_SERVICE_KEY"),
+		AdminAPIKey:          os.Getenv("ADMIN_API_KEY"),
+		Bundles:              loadBundlePolicy(),
+		CheckoutVelocity:     loadVelocityPolicy(),
+		OnchainConfirmations: loadConfirmationPolicy(),
+
+		LightningFallbackRail: lightningFallbackRail(),
+
+		LightningMaxInvoiceSats: envInt64("LIGHTNING_MAX_INVOICE_SATS", 5_000_000),
+
+		StripeAuthorizationTTL: httpkit.TimeoutFromEnv("STRIPE_AUTHORIZATION_TTL", stripeAuthorizationLimit),
+
+		FoundationPayouts: FoundationPayoutAccounts{
+			StripeAccount:    os.Getenv("FOUNDATION_STRIPE_ACCOUNT"),
+			LightningAddress: os.Getenv("FOUNDATION_LIGHTNING_ADDRESS"),
+			OnchainAddress:   os.Getenv("FOUNDATION_ONCHAIN_ADDRESS"),
+		},
+
+		GrantClaimTTL: httpkit.TimeoutFromEnv("GRANT_CLAIM_TTL", 7*24*time.Hour),
+		PublicURL:     envString("PAYMENTS_PUBLIC_URL", "http://localhost:8001"),
+
+		PricingServiceURL:   envString("PRICING_SERVICE_URL", "http://localhost:8003"),
+		BTCRateMaxStaleness: httpkit.TimeoutFromEnv("BTC_RATE_MAX_STALENESS", 10*time.Minute),
+
+		Referrals: loadReferrals(),
+
+		Rails: loadRailPolicy(),
+		IntegrationLimits: outbound.ParseConcurrencyLimits(os.Getenv("INTEGRATION_CONCURRENCY"),
+			outbound.SaturationMode(envString("INTEGRATION_SATURATION_MODE", string(outbound.SaturationQueue)))),
+	}
+}
+
+// loadFoundationPolicy reads FOUNDATION_RATE and the per-category overrides
+// FOUNDATION_RATE_TOURS, FOUNDATION_RATE_RENTALS and FOUNDATION_RATE_CONSULTING,
+// all given as percentages such as "15" or "15.5%", and the minimum
+// contribution FOUNDATION_MINIMUM_CENTS capped at FOUNDATION_MINIMUM_MAX_SHARE.
+// A rate that does not parse is an error rather than the default, so a
+// typo cannot quietly change the Foundation's share.
+func loadFoundationPolicy() (FoundationPolicy, error) {
+	p := FoundationPolicy{
+		CategoryRates: make(map[string]apitypes.Percent),
+		MinimumCents:  envInt64("FOUNDATION_MINIMUM_CENTS", 0),
+	}
+	var err error
+	if p.DefaultRate, err = envPercent("FOUNDATION_RATE", 15*apitypes.OnePercent); err != nil {
+		return FoundationPolicy{}, err
+	}
+	if p.MinimumMaxShare, err = envPercent("FOUNDATION_MINIMUM_MAX_SHARE", 50*apitypes.OnePercent); err != nil {
+		return FoundationPolicy{}, err
+	}
+	for _, c := range []string{CategoryTours, CategoryRentals, CategoryConsulting} {
+		key := "FOUNDATION_RATE_" + strings.ToUpper(c)
+		if os.Getenv(key) == "" {
+			continue
+		}
+		if p.CategoryRates[c], err = envPercent(key, p.DefaultRate); err != nil {
+			return FoundationPolicy{}, err
+		}
+	}
+	return p, nil
+}
+
+// lightningFallbackRail reads LIGHTNING_FALLBACK_RAIL, the card rail by
+// default; "none" offers no fallback.
+func lightningFallbackRail() string {
+	rail := strings.ToLower(envString("LIGHTNING_FALLBACK_RAIL", string(RailCard)))
+	if rail == "none" {
+		return ""
+	}
+	return rail
+}
+
+// validate reports configuration that would make the service misbehave.
+func (c config) validate() error {
+	if err := outbound.ValidateConcurrencyLimits(c.IntegrationLimits); err != nil {
+		return err
+	}
+	if err := c.Rails.validate(); err != nil {
+		return err
+	}
+	if err := c.Referrals.validate(); err != nil {
+		return err
+	}
+	if err := c.Bundles.validate(); err != nil {
+		return err
+	}
+	if err := c.OnchainConfirmations.validate(); err != nil {
+		return err
+	}
+	if c.StripeAuthorizationTTL <= 0 || c.StripeAuthorizationTTL > stripeAuthorizationLimit {
+		return fmt.Errorf("STRIPE_AUTHORIZATION_TTL must be positive and at most %s, got %s", stripeAuthorizationLimit, c.StripeAuthorizationTTL)
+	}
+	if c.GrantClaimTTL <= 0 {
+		return fmt.Errorf("GRANT_CLAIM_TTL must be positive")
+	}
+	if rail := Rail(c.LightningFallbackRail); rail != "" && (btcRails[rail] || !slices.Contains(allRails, rail)) {
+		return fmt.Errorf("LIGHTNING_FALLBACK_RAIL %q must be a fiat rail or none", rail)
+	}
+	if c.LNDGRPCHost != "" && c.LNDMacaroonPath == "" {
+		return fmt.Errorf("LND_MACAROON_PATH is required with LND_GRPC_HOST")
+	}
+	if c.LightningMaxInvoiceSats < 0 {
+		return fmt.Errorf("LIGHTNING_MAX_INVOICE_SATS must not be negative")
+	}
+	if err := c.validateTenants(); err != nil {
+		return err
+	}
+	return c.Foundation.validate()
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envList reads a comma-separated list, dropping blank entries. fallback is
+// used when key is unset.
+func envList(key, fallback string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		v = fallback
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envPercent reads a percentage such as "15" or "15.5%". fallback is used
+// when key is unset.
+func envPercent(key string, fallback apitypes.Percent) (apitypes.Percent, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	p, err := apitypes.ParsePercent(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q: %w", key, v, err)
+	}
+	return p, nil
+}
+
+func envInt64(key string, fallback int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil {
+		return v
+	}
+	return fallback
+}
+
+// envRegions reads a comma-separated list of country codes into a set.
+func envRegions(key string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// configHandler returns the configuration the service is running with, so
+// ops can confirm what it actually loaded. Fields tagged secret:"true" are
+// redacted: only whether they are set is visible.
+func (s *server) configHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, dumpConfig(reflect.ValueOf(s.cfg)))
+}
+
+// dumpConfig renders a configuration value for display: struct fields
+// become snake_case keys, durations and other Stringers their text, and
+// secret fields are replaced by redacted when set.
+func dumpConfig(v reflect.Value) interface{} {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return v.Interface().(time.Duration).String()
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if f.Tag.Get("secret") == "true" {
+				out[snakeCase(f.Name)] = redactSecret(v.Field(i))
+				continue
+			}
+			out[snakeCase(f.Name)] = dumpConfig(v.Field(i))
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			out[fmt.Sprint(k)] = dumpConfig(v.MapIndex(k))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = dumpConfig(v.Index(i))
+		}
+		return out
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return dumpConfig(v.Elem())
+	}
+	return v.Interface()
+}
+
+// redactSecret shows whether a secret is set without its value. Lists of
+// secrets keep their length, so a rotation in progress is visible.
+func redactSecret(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Slice {
+		out := make([]string, v.Len())
+		for i := range out {
+			out[i] = redacted
+		}
+		return out
+	}
+	if v.IsZero() {
+		return ""
+	}
+	return redacted
+}
+
+// initialisms are split out of runs of capitals, so "StripeAPIURL" reads
+// as stripe, api, url.
+var initialisms = []string{"API", "HTTP", "ID", "LND", "URL"}
+
+// snakeCase turns a Go field name such as "StripeAPIURL" into
+// "stripe_api_url".
+func snakeCase(name string) string {
+	var words []string
+	for len(name) > 0 {
+		n := wordLen(name)
+		words = append(words, strings.ToLower(name[:n]))
+		name = name[n:]
+	}
+	return strings.Join(words, "_")
+}
+
+// wordLen is the length of the word name starts with: a known initialism,
+// a capitalised word, or a run of capitals up to the next word.
+func wordLen(name string) int {
+	for _, in := range initialisms {
+		if rest, ok := strings.CutPrefix(name, in); ok && (rest == "" || unicode.IsUpper(rune(rest[0]))) {
+			return len(in)
+		}
+	}
+	n := 1
+	if unicode.IsUpper(rune(name[0])) && len(name) > 1 && unicode.IsUpper(rune(name[1])) {
+		for n < len(name) && unicode.IsUpper(rune(name[n])) && !(n+1 < len(name) && unicode.IsLower(rune(name[n+1]))) {
+			n++
+		}
+		return n
+	}
+	for n < len(name) && !unicode.IsUpper(rune(name[n])) {
+		n++
+	}
+	return n
+}
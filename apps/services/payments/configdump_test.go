@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// setSecrets fills every field tagged secret:"true" with a recognisable
+// value and returns the values used.
+func setSecrets(t *testing.T, cfg *config) []string {
+	t.Helper()
+	var values []string
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Tag.Get("secret") != "true" {
+			continue
+		}
+		value := "sentinel-" + f.Name
+		switch f.Type.Kind() {
+		case reflect.String:
+			v.Field(i).SetString(value)
+		case reflect.Slice:
+			v.Field(i).Set(reflect.ValueOf([]string{value + "-old", value + "-new"}))
+			values = append(values, value+"-old", value+"-new")
+			continue
+		default:
+			t.Fatalf("secret field %s has unsupported type %s", f.Name, f.Type)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestConfigDumpRedactsSecrets(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Port = "8001"
+	s.cfg.HTTPTimeouts = httpkit.ServerTimeouts{ReadHeader: 10 * time.Second}
+	secrets := setSecrets(t, &s.cfg)
+	if len(secrets) == 0 {
+		t.Fatal("no config field is tagged secret")
+	}
+	s.cfg.AdminAPIKey = testAdminKey
+	secrets = append(secrets, testAdminKey)
+
+	var dump map[string]interface{}
+	rec := doJSON(t, s.routes(), http.MethodGet, "/config", nil, &dump)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	raw := rec.Body.String()
+	for _, secret := range secrets {
+		if strings.Contains(raw, secret) {
+			t.Errorf("dump contains secret %q", secret)
+		}
+	}
+
+	if dump["port"] != "8001" || dump["admin_api_key"] != redacted {
+		t.Fatalf("port %v admin_api_key %v", dump["port"], dump["admin_api_key"])
+	}
+	if got := dump["http_timeouts"].(map[string]interface{})["read_header"]; got != "10s" {
+		t.Fatalf("read_header timeout = %v, want 10s", got)
+	}
+	if got := dump["foundation"].(map[string]interface{})["default_rate"]; got != (15 * apitypes.OnePercent).String() {
+		t.Fatalf("foundation default rate = %v", got)
+	}
+	if got := dump["stripe_webhook_secrets"].([]interface{}); len(got) != 2 || got[0] != redacted {
+		t.Fatalf("webhook secrets = %v, want two redacted entries", got)
+	}
+}
+
+func TestConfigCredentialsAreTaggedSecret(t *testing.T) {
+	credential := regexp.MustCompile(`Secret|Key$|Macaroon|Token|Password`)
+	typ := reflect.TypeOf(config{})
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if credential.MatchString(f.Name) && f.Tag.Get("secret") != "true" {
+			t.Errorf("config.%s looks like a credential but is not tagged secret:\"true\"", f.Name)
+		}
+	}
+}
+
+func TestConfigDumpRequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", rec.Code)
+	}
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body["error"] != "unauthorized" {
+		t.Fatalf("body = %v", body)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"Port":                 "port",
+		"StripeAPIURL":         "stripe_api_url",
+		"HTTPTimeouts":         "http_timeouts",
+		"StripeWebhookSecrets": "stripe_webhook_secrets",
+		"MaxInFlight":          "max_in_flight",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// BTCRate is a bitcoin price snapshotted by a settled Lightning payment:
+// AmountSats bought AmountCents of USD when the invoice was issued.
+type BTCRate struct {
+	SatsPerUSD  int64             `json:"sats_per_usd"`
+	AmountSats  int64             `json:"amount_sats"`
+	AmountCents int64             `json:"amount_cents"`
+	PaymentRef  string            `json:"payment_ref"`
+	SettledAt   apitypes.JSONTime `json:"settled_at"`
+}
+
+// Sats converts cents at the rate, rounding half away from zero.
+func (r BTCRate) Sats(cents int64) int64 {
+	n := cents * r.AmountSats
+	if n < 0 {
+		return -((-n + r.AmountCents/2) / r.AmountCents)
+	}
+	return (n + r.AmountCents/2) / r.AmountCents
+}
+
+// ClosingRate returns the rate snapshotted by the last Lightning invoice
+// settled before end, or false when none has been.
+func (l *lightningInvoices) ClosingRate(end time.Time) (BTCRate, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var last *LightningInvoice
+	for _, inv := range l.byHash {
+		if !inv.Settled || !inv.SettledAt.Before(end) || inv.AmountCents <= 0 {
+			continue
+		}
+		if last == nil || inv.SettledAt.After(last.SettledAt.Time) {
+			last = inv
+		}
+	}
+	if last == nil {
+		return BTCRate{}, false
+	}
+	return BTCRate{
+		SatsPerUSD:  last.AmountSats * 100 / last.AmountCents,
+		AmountSats:  last.AmountSats,
+		AmountCents: last.AmountCents,
+		PaymentRef:  last.RHash,
+		SettledAt:   last.SettledAt,
+	}, true
+}
+
+// DailySummary is a day's USD revenue, and its value in sats at the day's
+// closing rate when one was recorded. Foundation includes any corrections
+// made to the day's allocations since. Net is what the platform keeps after
+// the Foundation's share and partner commission.
+type DailySummary struct {
+	Date            string       `json:"date"`
+	PaymentCount    int          `json:"payment_count"`
+	GrossCents      int64        `json:"gross_cents"`
+	FoundationCents int64        `json:"foundation_cents"`
+	CommissionCents int64        `json:"commission_cents"`
+	NetCents        int64        `json:"net_cents"`
+	ClosingRate     *BTCRate     `json:"closing_rate"`
+	Sats            *DailyInSats `json:"sats"`
+}
+
+// DailyInSats is a DailySummary's totals converted at its closing rate.
+type DailyInSats struct {
+	Gross      int64 `json:"gross_sats"`
+	Foundation int64 `json:"foundation_sats"`
+	Commission int64 `json:"commission_sats"`
+	Net        int64 `json:"net_sats"`
+}
+
+// DailySummary totals the USD payments made on the day starting at day.
+// The closing rate is the one snapshotted by the day's last settled
+// Lightning payment; a day without one falls back to the latest earlier
+// snapshot, and is reported without sats if there is none at all.
+func (s *server) DailySummary(day time.Time) DailySummary {
+	end := day.AddDate(0, 0, 1)
+	sum := DailySummary{Date: day.Format(time.DateOnly)}
+	for _, p := range s.ledger.PaymentsBetween(day, end) {
+		if p.Currency != "USD" {
+			continue
+		}
+		sum.PaymentCount++
+		sum.GrossCents += p.GrossCents
+		sum.FoundationCents += s.ledger.FoundationTotal(p.Ref)
+		sum.CommissionCents += s.ledger.CommissionTotal(p.Ref)
+	}
+	sum.NetCents = sum.GrossCents - sum.FoundationCents - sum.CommissionCents
+	if rate, ok := s.invoices.ClosingRate(end); ok {
+		sum.ClosingRate = &rate
+		sum.Sats = &DailyInSats{
+			Gross:      rate.Sats(sum.GrossCents),
+			Foundation: rate.Sats(sum.FoundationCents),
+			Commission: rate.Sats(sum.CommissionCents),
+		}
+		sum.Sats.Net = sum.Sats.Gross - sum.Sats.Foundation - sum.Sats.Commission
+	}
+	return sum
+}
+
+// dailySummaryHandler reports a day's revenue in USD and sats for
+// transparency reports. Query: ?date=YYYY-MM-DD.
+func (s *server) dailySummaryHandler(w http.ResponseWriter, r *http.Request) {
+	day, err := time.Parse(time.DateOnly, r.URL.Query().Get("date"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_date", "date must be formatted YYYY-MM-DD")
+		return
+	}
+	respondJSON(w, http.StatusOK, s.DailySummary(day))
+}
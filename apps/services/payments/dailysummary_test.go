@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// settleInvoice seeds a settled Lightning invoice snapshotting satsPerCent.
+func settleInvoice(s *server, rHash string, cents, satsPerCent int64, at time.Time) {
+	s.invoices.Add(LightningInvoice{
+		RHash: rHash, BookingID: "bk-" + rHash, AmountCents: cents, AmountSats: cents * satsPerCent,
+		Settled: true, SettledAt: apitypes.JSONTime{Time: at},
+	})
+}
+
+func TestDailySummaryInUSDAndSats(t *testing.T) {
+	s := newTestServer(t)
+	day := time.Date(2026, 4, 10, 0, 0, 0, 0, time.UTC)
+
+	seedPayment(s, "pay_card", CategoryTours, 10000, 1500, day.Add(10*time.Hour))
+	seedPayment(s, "ln_close", CategoryTours, 1000, 150, day.Add(18*time.Hour))
+	// Not on the day.
+	seedPayment(s, "pay_next", CategoryTours, 5000, 750, day.AddDate(0, 0, 1))
+
+	// The day's last settled invoice sets the closing rate; earlier and
+	// later snapshots do not.
+	settleInvoice(s, "ln_morning", 2000, 20, day.Add(9*time.Hour))
+	settleInvoice(s, "ln_close", 1000, 15, day.Add(18*time.Hour))
+	settleInvoice(s, "ln_next", 1000, 30, day.AddDate(0, 0, 1).Add(time.Hour))
+
+	var sum DailySummary
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/daily-summary?date=2026-04-10", nil, &sum)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if sum.PaymentCount != 2 || sum.GrossCents != 11000 || sum.FoundationCents != 1650 || sum.NetCents != 9350 {
+		t.Fatalf("USD totals = %+v, want 2 payments, 11000 gross, 1650 foundation, 9350 net", sum)
+	}
+	if sum.ClosingRate == nil || sum.ClosingRate.PaymentRef != "ln_close" || sum.ClosingRate.SatsPerUSD != 1500 {
+		t.Fatalf("closing rate = %+v, want 1500 sats/USD from ln_close", sum.ClosingRate)
+	}
+	if want := (DailyInSats{Gross: 165000, Foundation: 24750, Net: 140250}); sum.Sats == nil || *sum.Sats != want {
+		t.Fatalf("sats = %+v, want %+v", sum.Sats, want)
+	}
+}
+
+func TestDailySummaryRateFallsBackToEarlierSnapshot(t *testing.T) {
+	s := newTestServer(t)
+	day := time.Date(2026, 4, 10, 0, 0, 0, 0, time.UTC)
+	seedPayment(s, "pay_card", CategoryTours, 10000, 1500, day.Add(10*time.Hour))
+
+	var sum DailySummary
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/daily-summary?date=2026-04-10", nil, &sum)
+	if sum.ClosingRate != nil || sum.Sats != nil || sum.GrossCents != 10000 {
+		t.Fatalf("summary = %+v, want USD only without any recorded rate", sum)
+	}
+
+	settleInvoice(s, "ln_earlier", 1000, 12, day.AddDate(0, 0, -3))
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/daily-summary?date=2026-04-10", nil, &sum)
+	if sum.ClosingRate == nil || sum.ClosingRate.PaymentRef != "ln_earlier" || sum.Sats.Gross != 120000 {
+		t.Fatalf("summary = %+v, want sats at the earlier snapshot", sum)
+	}
+
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/daily-summary?date=april", nil, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad date: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// Dispute outcomes as reported to bookings.
+const (
+	DisputeOpen = "open"
+	DisputeWon  = "won"
+	DisputeLost = "lost"
+)
+
+// Dispute is our record of a Stripe chargeback against a payment.
+// WithdrawnCents and FoundationReversedCents are what opening it took out
+// of the ledger, and what winning it puts back. BookingUpdated is false
+// until bookings has accepted the latest status, so a redelivered event
+// retries it.
+type Dispute struct {
+	ID                      string            `json:"dispute_id"`
+	PaymentRef              string            `json:"payment_ref"`
+	Tenant                  string            `json:"tenant,omitempty"`
+	BookingID               string            `json:"booking_id"`
+	AmountCents             int64             `json:"amount_cents"`
+	Currency                string            `json:"currency"`
+	Reason                  string            `json:"reason,omitempty"`
+	Status                  string            `json:"status"`
+	WithdrawnCents          int64             `json:"withdrawn_cents"`
+	FoundationReversedCents int64             `json:"foundation_reversed_cents"`
+	BookingUpdated          bool              `json:"booking_updated"`
+	OpenedAt                apitypes.JSONTime `json:"opened_at"`
+	ClosedAt                apitypes.JSONTime `json:"closed_at"`
+}
+
+// disputes holds chargebacks by Stripe dispute id. mu also serialises
+// handling so a redelivered event never books a dispute twice.
+type disputes struct {
+	mu   sync.Mutex
+	byID map[string]*Dispute
+}
+
+func newDisputes() *disputes {
+	return &disputes{byID: make(map[string]*Dispute)}
+}
+
+// List returns every dispute, newest first.
+func (d *disputes) List() []Dispute {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Dispute, 0, len(d.byID))
+	for _, dp := range d.byID {
+		out = append(out, *dp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].OpenedAt.After(out[j].OpenedAt.Time) })
+	return out
+}
+
+// disputeOutcome maps a closed Stripe dispute's status to its outcome. An
+// inquiry closed without a chargeback counts as won.
+func disputeOutcome(stripeStatus string) string {
+	switch stripeStatus {
+	case "won", "warning_closed":
+		return DisputeWon
+	case "lost":
+		return DisputeLost
+	}
+	return DisputeOpen
+}
+
+// HandleDispute applies a charge.dispute.created or charge.dispute.closed
+// event. Opening a dispute withdraws the disputed amount in the ledger and
+// claws back the Foundation's share of it; winning one reinstates both.
+// Either way bookings is told, and staff alerted. A closed event for a
+// dispute never seen open is first opened, so a lost dispute is still
+// reversed.
+func (s *server) HandleDispute(ctx context.Context, eventType string, o stripeEventObject) (Dispute, error) {
+	s.disputes.mu.Lock()
+	defer s.disputes.mu.Unlock()
+
+	d, known := s.disputes.byID[o.ID]
+	if !known {
+		ref := o.PaymentIntent
+		if ref == "" {
+			ref = o.Charge
+		}
+		p, err := s.ledger.Payment(ref)
+		if err != nil {
+			return Dispute{}, fmt.Errorf("dispute %s on %s: %w", o.ID, ref, err)
+		}
+		d = &Dispute{
+			ID:          o.ID,
+			PaymentRef:  p.Ref,
+			Tenant:      p.Tenant,
+			BookingID:   p.BookingID,
+			AmountCents: o.Amount,
+			Currency:    strings.ToUpper(o.Currency),
+			Reason:      o.Reason,
+			Status:      DisputeOpen,
+			OpenedAt:    apitypes.JSONTime{Time: s.now()},
+		}
+		d.WithdrawnCents, d.FoundationReversedCents, err = s.ledger.RecordDispute(p.Ref, o.Amount, "dispute "+o.ID+": "+o.Reason, s.now())
+		if err != nil {
+			return Dispute{}, err
+		}
+		s.disputes.byID[o.ID] = d
+		log.Printf("ALERT: dispute %s opened on booking %s: %d %s (%s); Foundation share of %d cents reversed",
+			d.ID, d.BookingID, d.AmountCents, d.Currency, d.Reason, d.FoundationReversedCents)
+	}
+
+	if eventType == "charge.dispute.closed" && d.Status == DisputeOpen {
+		outcome := disputeOutcome(o.Status)
+		if outcome == DisputeOpen {
+			return *d, fmt.Errorf("dispute %s closed with unexpected status %q", d.ID, o.Status)
+		}
+		if outcome == DisputeWon {
+			if err := s.ledger.ReinstateDispute(d.PaymentRef, d.WithdrawnCents, d.FoundationReversedCents, "dispute "+d.ID+" won", s.now()); err != nil {
+				return *d, err
+			}
+		}
+		d.Status, d.ClosedAt, d.BookingUpdated = outcome, apitypes.JSONTime{Time: s.now()}, false
+		log.Printf("ALERT: dispute %s on booking %s %s", d.ID, d.BookingID, outcome)
+	}
+
+	if !d.BookingUpdated {
+		_, err := s.bookings.RecordDispute(s.withTenant(ctx, d.Tenant), d.BookingID, DisputeNotice{
+			DisputeID:   d.ID,
+			PaymentRef:  d.PaymentRef,
+			AmountCents: d.AmountCents,
+			Currency:    d.Currency,
+			Reason:      d.Reason,
+			Status:      d.Status,
+		})
+		var berr *BookingsError
+		if errors.As(err, &berr) && berr.Status == http.StatusConflict {
+			// The booking cannot take the dispute, e.g. it was already
+			// cancelled; staff settle it by hand.
+			log.Printf("ALERT: dispute %s: booking %s did not accept status %s: %v", d.ID, d.BookingID, d.Status, err)
+			err = nil
+		}
+		if err != nil {
+			return *d, err
+		}
+		d.BookingUpdated = true
+	}
+	return *d, nil
+}
+
+func (s *server) listDisputesHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"disputes": s.disputes.List()})
+}
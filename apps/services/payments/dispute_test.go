@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func disputeEvent(eventType, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   "evt_dispute_" + status,
+		"type": eventType,
+		"data": map[string]interface{}{
+			"object": map[string]interface{}{
+				"id":             "dp_1",
+				"charge":         "ch_1",
+				"payment_intent": "pi_test_1",
+				"amount":         20000,
+				"currency":       "usd",
+				"reason":         "fraudulent",
+				"status":         status,
+			},
+		},
+	}
+}
+
+// paidByCard records the card payment checkoutCompleted settles.
+func paidByCard(t *testing.T, s *server) {
+	t.Helper()
+	if rec := postStripeEvent(t, s, checkoutCompleted("bk-1"), testWebhookSecret, nil); rec.Code != http.StatusOK {
+		t.Fatalf("checkout event: status %d: %s", rec.Code, rec.Body)
+	}
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 3000 {
+		t.Fatalf("foundation held = %d, want 3000", held)
+	}
+}
+
+func TestDisputeReversesFoundationAndMarksBookingDisputed(t *testing.T) {
+	s := newTestServer(t)
+	paidByCard(t, s)
+
+	var resp map[string]string
+	rec := postStripeEvent(t, s, disputeEvent("charge.dispute.created", "needs_response"), testWebhookSecret, &resp)
+	if rec.Code != http.StatusOK || resp["dispute_status"] != DisputeOpen {
+		t.Fatalf("status %d resp %v", rec.Code, resp)
+	}
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 0 {
+		t.Fatalf("foundation held after dispute = %d, want 0", held)
+	}
+	notices := s.bookings.(*fakeBookings).disputes["bk-1"]
+	if len(notices) != 1 || notices[0].Status != DisputeOpen || notices[0].DisputeID != "dp_1" {
+		t.Fatalf("dispute notices = %+v, want one open", notices)
+	}
+
+	// A redelivered event books nothing more.
+	postStripeEvent(t, s, disputeEvent("charge.dispute.created", "needs_response"), testWebhookSecret, nil)
+	if n := len(s.ledger.Entries(func(e LedgerEntry) bool { return e.Kind == EntryDispute })); n != 1 {
+		t.Fatalf("dispute entries = %d, want 1", n)
+	}
+	if n := len(s.bookings.(*fakeBookings).disputes["bk-1"]); n != 1 {
+		t.Fatalf("bookings told %d times, want once", n)
+	}
+}
+
+func TestWonDisputeRestoresFoundation(t *testing.T) {
+	s := newTestServer(t)
+	paidByCard(t, s)
+	postStripeEvent(t, s, disputeEvent("charge.dispute.created", "needs_response"), testWebhookSecret, nil)
+
+	var resp map[string]string
+	postStripeEvent(t, s, disputeEvent("charge.dispute.closed", "won"), testWebhookSecret, &resp)
+	if resp["dispute_status"] != DisputeWon {
+		t.Fatalf("resp %v, want won", resp)
+	}
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 3000 {
+		t.Fatalf("foundation held after won dispute = %d, want 3000", held)
+	}
+	notices := s.bookings.(*fakeBookings).disputes["bk-1"]
+	if last := notices[len(notices)-1]; last.Status != DisputeWon {
+		t.Fatalf("last dispute notice = %+v, want won", last)
+	}
+}
+
+func TestLostDisputeStaysReversed(t *testing.T) {
+	s := newTestServer(t)
+	paidByCard(t, s)
+
+	// The closed event arrives without the created one.
+	postStripeEvent(t, s, disputeEvent("charge.dispute.closed", "lost"), testWebhookSecret, nil)
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 0 {
+		t.Fatalf("foundation held after lost dispute = %d, want 0", held)
+	}
+	if got := s.disputes.List(); len(got) != 1 || got[0].Status != DisputeLost {
+		t.Fatalf("disputes = %+v, want one lost", got)
+	}
+}
+
+func TestDisputeRetriedWhenBookingsDown(t *testing.T) {
+	s := newTestServer(t)
+	paidByCard(t, s)
+	fake := s.bookings.(*fakeBookings)
+	fake.err = &BookingsError{Status: http.StatusServiceUnavailable}
+	if rec := postStripeEvent(t, s, disputeEvent("charge.dispute.created", "needs_response"), testWebhookSecret, nil); rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502 so Stripe redelivers", rec.Code)
+	}
+
+	fake.err = nil
+	postStripeEvent(t, s, disputeEvent("charge.dispute.created", "needs_response"), testWebhookSecret, nil)
+	if n := len(fake.disputes["bk-1"]); n != 1 {
+		t.Fatalf("bookings told %d times, want once", n)
+	}
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 0 {
+		t.Fatalf("foundation held = %d, want 0 (reversed once)", held)
+	}
+}
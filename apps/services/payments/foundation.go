@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// Booking categories used to pick a Foundation rate.
+const (
+	CategoryTours      = "tours"
+	CategoryRentals    = "rentals"
+	CategoryConsulting = "consulting"
+)
+
+// FoundationPolicy is the share of gross revenue allocated to the Foundation,
+// optionally varying by booking category.
+type FoundationPolicy struct {
+	DefaultRate   apitypes.Percent
+	CategoryRates map[string]apitypes.Percent
+
+	// MinimumCents is the least any payment contributes when its rate
+	// yields less. The minimum never takes more than MinimumMaxShare of the
+	// payment's gross, so a tiny payment is not mostly given away. Zero
+	// disables it.
+	MinimumCents    int64
+	MinimumMaxShare apitypes.Percent
+}
+
+// Rate returns the allocation rate for a category.
+func (p FoundationPolicy) Rate(category string) apitypes.Percent {
+	if r, ok := p.CategoryRates[category]; ok {
+		return r
+	}
+	return p.DefaultRate
+}
+
+// Allocate splits gross into the Foundation share and the platform's net,
+// rounding the share half to even to the nearest cent.
+func (p FoundationPolicy) Allocate(grossCents int64, category string) (foundationCents, netCents int64) {
+	foundationCents, _ = p.Share(grossCents, category)
+	return foundationCents, grossCents - foundationCents
+}
+
+// CalculateFoundationShare splits gross at rate, a fraction such as 0.15,
+// into the Foundation's share and the platform's net. The rate is taken to
+// the nearest basis point and the share rounded half to even, and the two
+// always add up to gross.
+func CalculateFoundationShare(grossCents int64, rate float64) (foundationCents, netCents int64) {
+	foundationCents = apitypes.Percent(math.Round(rate * float64(apitypes.HundredPercent))).Of(grossCents)
+	return foundationCents, grossCents - foundationCents
+}
+
+// Share is the Foundation's cut of gross: the category's rate of it, or the
+// minimum contribution when that is more. minimum reports which applied.
+func (p FoundationPolicy) Share(grossCents int64, category string) (cents int64, minimum bool) {
+	if grossCents <= 0 {
+		return 0, false
+	}
+	cents = p.Rate(category).Of(grossCents)
+	if floor := min(p.MinimumCents, p.MinimumMaxShare.Of(grossCents)); floor > cents {
+		return floor, true
+	}
+	return cents, false
+}
+
+// commitPayment records a completed payment with the Foundation share the
+// current policy allocates to it, noting on the entry when the minimum
+// contribution set it. A referred payment also credits the partner's
+// commission. Committing a payment again does nothing.
+func (s *server) commitPayment(p Payment) []LedgerEntry {
+	policy := s.cfg.foundationPolicy(s.tenantByID(p.Tenant))
+	foundation, minimum := policy.Share(p.GrossCents, p.Category)
+	var memo string
+	if minimum {
+		memo = fmt.Sprintf("minimum contribution: %s of %d is below the %d floor", policy.Rate(p.Category), p.GrossCents, foundation)
+	}
+	entries := s.ledger.RecordPayment(p, foundation, memo)
+	if entries == nil {
+		return nil
+	}
+	if commission, ok := s.referralCommission(p, foundation); ok {
+		entries = append(entries, s.ledger.Append(commission)...)
+	}
+	return entries
+}
+
+// The Foundation's charter bounds its share of revenue.
+const (
+	minFoundationRate = 10 * apitypes.OnePercent
+	maxFoundationRate = 20 * apitypes.OnePercent
+)
+
+func (p FoundationPolicy) validate() error {
+	rates := map[string]apitypes.Percent{"default": p.DefaultRate}
+	for c, r := range p.CategoryRates {
+		rates[c] = r
+	}
+	for c, r := range rates {
+		if r < minFoundationRate || r > maxFoundationRate {
+			return fmt.Errorf("foundation rate for %s is %s, must be between %s and %s", c, r, minFoundationRate, maxFoundationRate)
+		}
+	}
+	if p.MinimumCents < 0 {
+		return fmt.Errorf("FOUNDATION_MINIMUM_CENTS must not be negative, got %d", p.MinimumCents)
+	}
+	if p.MinimumCents > 0 && (p.MinimumMaxShare <= 0 || p.MinimumMaxShare > apitypes.HundredPercent) {
+		return fmt.Errorf("FOUNDATION_MINIMUM_MAX_SHARE must be above 0%% and at most 100%%, got %s", p.MinimumMaxShare)
+	}
+	return nil
+}
+
+// allocationCorrection is one payment whose recorded Foundation share
+// differed from what the current policy produces.
+type allocationCorrection struct {
+	PaymentRef    string `json:"payment_ref"`
+	Category      string `json:"category"`
+	GrossCents    int64  `json:"gross_cents"`
+	RecordedCents int64  `json:"recorded_cents"`
+	ExpectedCents int64  `json:"expected_cents"`
+	DeltaCents    int64  `json:"delta_cents"`
+}
+
+// RecomputeAllocations brings every payment in [from, to) in line with the
+// policy by appending adjustment entries. Original entries are never
+// modified, and a second run over the same range records nothing new.
+func (s *server) RecomputeAllocations(from, to time.Time) []allocationCorrection {
+	// Serialise runs so two concurrent recomputations cannot both book the
+	// same correction.
+	s.recomputeMu.Lock()
+	defer s.recomputeMu.Unlock()
+
+	corrections := []allocationCorrection{}
+	for _, p := range s.ledger.PaymentsBetween(from, to) {
+		expected, _ := s.cfg.foundationPolicy(s.tenantByID(p.Tenant)).Allocate(p.GrossCents, p.Category)
+		recorded := s.ledger.FoundationTotal(p.Ref)
+		delta := expected - recorded
+		if delta == 0 {
+			continue
+		}
+		s.ledger.Append(LedgerEntry{
+			PaymentRef:  p.Ref,
+			BookingID:   p.BookingID,
+			Category:    p.Category,
+			Kind:        EntryFoundationAdjustment,
+			AmountCents: delta,
+			Currency:    p.Currency,
+			Memo:        fmt.Sprintf("recompute: recorded %d, expected %d", recorded, expected),
+			CreatedAt:   apitypes.JSONTime{Time: s.now()},
+		})
+		corrections = append(corrections, allocationCorrection{
+			PaymentRef:    p.Ref,
+			Category:      p.Category,
+			GrossCents:    p.GrossCents,
+			RecordedCents: recorded,
+			ExpectedCents: expected,
+			DeltaCents:    delta,
+		})
+	}
+	return corrections
+}
+
+// foundationEstimate is the allocation a prospective booking would generate.
+type foundationEstimate struct {
+	Category        string           `json:"type"`
+	GrossCents      int64            `json:"gross_cents"`
+	Rate            apitypes.Percent `json:"rate"`
+	FoundationCents int64            `json:"foundation_cents"`
+	NetCents        int64            `json:"net_cents"`
+	Currency        string           `json:"currency"`
+	// MinimumApplied is set when the minimum contribution, not the rate,
+	// gave the Foundation's share.
+	MinimumApplied bool `json:"minimum_applied,omitempty"`
+}
+
+// estimateFoundationHandler shows guests how much of a booking of the given
+// amount and type would go to the Foundation. It uses the same allocation
+// as committed payments, so the estimate is what gets recorded.
+func (s *server) estimateFoundationHandler(w http.ResponseWriter, r *http.Request) {
+	amount, err := parseAmountCents(r.URL.Query().Get("amount"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_amount", err.Error())
+		return
+	}
+	category := r.URL.Query().Get("type")
+	if !validCategory(category) {
+		respondError(w, http.StatusBadRequest, "invalid_type", "type must be one of tours, rentals or consulting")
+		return
+	}
+	tenant := s.tenant(r.Context())
+	respondJSON(w, http.StatusOK, s.estimateFoundation(tenant, amount, category, tenant.Currency))
+}
+
+// estimateFoundation is the allocation tenant's policy makes of a payment.
+func (s *server) estimateFoundation(tenant Tenant, grossCents int64, category, currency string) foundationEstimate {
+	policy := s.cfg.foundationPolicy(tenant)
+	foundation, minimum := policy.Share(grossCents, category)
+	return foundationEstimate{
+		Category:        category,
+		GrossCents:      grossCents,
+		Rate:            policy.Rate(category),
+		FoundationCents: foundation,
+		NetCents:        grossCents - foundation,
+		Currency:        currency,
+		MinimumApplied:  minimum,
+	}
+}
+
+// parseDateRange reads ?from=YYYY-MM-DD&to=YYYY-MM-DD as the half-open UTC
+// interval [from, to+1 day), so both dates are inclusive.
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	return parseDates(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+}
+
+// parseDates reads an inclusive YYYY-MM-DD range as parseDateRange does.
+func parseDates(fromDate, toDate string) (time.Time, time.Time, error) {
+	from, err := time.Parse(time.DateOnly, fromDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be formatted YYYY-MM-DD")
+	}
+	to, err := time.Parse(time.DateOnly, toDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must be formatted YYYY-MM-DD")
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must not be before from")
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+func (s *server) recomputeFoundationHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_range", err.Error())
+		return
+	}
+	corrections := s.RecomputeAllocations(from, to)
+	var net int64
+	for _, c := range corrections {
+		net += c.DeltaCents
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from":            from.Format(time.DateOnly),
+		"to":              to.AddDate(0, 0, -1).Format(time.DateOnly),
+		"corrections":     corrections,
+		"corrected_count": len(corrections),
+		"net_delta_cents": net,
+	})
+}
+
+// FoundationSimulation compares, for one currency, the Foundation's actual
+// allocation over a period with what a proposed rate would have given.
+type FoundationSimulation struct {
+	Currency       string `json:"currency"`
+	PaymentCount   int    `json:"payment_count"`
+	GrossCents     int64  `json:"gross_cents"`
+	ActualCents    int64  `json:"actual_cents"`
+	SimulatedCents int64  `json:"simulated_cents"`
+	DeltaCents     int64  `json:"delta_cents"`
+}
+
+// SimulateFoundationRate applies rate to the gross of every payment in
+// [from, to), rounding each and keeping the minimum contribution as
+// Allocate does, and sets it beside the allocation actually recorded,
+// corrections included. Nothing is written.
+func (s *server) SimulateFoundationRate(rate apitypes.Percent, from, to time.Time) []FoundationSimulation {
+	totals := make(map[string]*FoundationSimulation)
+	proposed := FoundationPolicy{DefaultRate: rate, MinimumCents: s.cfg.Foundation.MinimumCents, MinimumMaxShare: s.cfg.Foundation.MinimumMaxShare}
+	for _, p := range s.ledger.PaymentsBetween(from, to) {
+		t, ok := totals[p.Currency]
+		if !ok {
+			t = &FoundationSimulation{Currency: p.Currency}
+			totals[p.Currency] = t
+		}
+		simulated, _ := proposed.Allocate(p.GrossCents, p.Category)
+		t.PaymentCount++
+		t.GrossCents += p.GrossCents
+		t.ActualCents += s.ledger.FoundationTotal(p.Ref)
+		t.SimulatedCents += simulated
+	}
+	out := make([]FoundationSimulation, 0, len(totals))
+	for _, t := range totals {
+		t.DeltaCents = t.SimulatedCents - t.ActualCents
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Currency < out[j].Currency })
+	return out
+}
+
+// simulateFoundationHandler answers "what if the Foundation's share had
+// been rate?" for a past period. Body: {"rate": "17.5%", "from":
+// "2026-01-01", "to": "2026-03-31"}. The rate must be within the charter's
+// bounds.
+func (s *server) simulateFoundationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rate apitypes.Percent `json:"rate"`
+		From string           `json:"from"`
+		To   string           `json:"to"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.Rate < minFoundationRate || req.Rate > maxFoundationRate {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", fmt.Sprintf("rate must be between %s and %s", minFoundationRate, maxFoundationRate))
+		return
+	}
+	from, to, err := parseDates(req.From, req.To)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_range", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rate":   req.Rate,
+		"from":   from.Format(time.DateOnly),
+		"to":     to.AddDate(0, 0, -1).Format(time.DateOnly),
+		"totals": s.SimulateFoundationRate(req.Rate, from, to),
+	})
+}
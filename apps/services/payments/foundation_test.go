@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func seedPayment(s *server, ref, category string, gross, recordedFoundation int64, paidAt time.Time) {
+	s.ledger.RecordPayment(Payment{
+		Ref: ref, BookingID: "bk-" + ref, Category: category, GrossCents: gross, Currency: "USD", Rail: "card", PaidAt: apitypes.JSONTime{Time: paidAt},
+	}, recordedFoundation, "")
+}
+
+func TestRecomputeFoundationRecordsCorrectionsOnce(t *testing.T) {
+	s := newTestServer(t)
+	h := s.routes()
+	day := time.Date(2026, 4, 10, 15, 0, 0, 0, time.UTC)
+
+	// A misconfiguration booked 10% instead of 15% for two payments.
+	seedPayment(s, "pay_a", CategoryTours, 10000, 1000, day)
+	seedPayment(s, "pay_b", CategoryRentals, 25000, 2500, day.Add(time.Hour))
+	seedPayment(s, "pay_c", CategoryTours, 8000, 1200, day.Add(2*time.Hour))
+	// Outside the window; must not be touched.
+	seedPayment(s, "pay_d", CategoryTours, 10000, 1000, day.AddDate(0, 1, 0))
+
+	var report struct {
+		Corrections   []allocationCorrection `json:"corrections"`
+		NetDeltaCents int64                  `json:"net_delta_cents"`
+	}
+	rec := doJSON(t, h, http.MethodPost, "/api/payments/foundation/recompute?from=2026-04-01&to=2026-04-30", nil, &report)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(report.Corrections) != 2 || report.NetDeltaCents != 500+1250 {
+		t.Fatalf("report = %+v, want corrections for pay_a and pay_b totalling 1750", report)
+	}
+
+	rec = doJSON(t, h, http.MethodPost, "/api/payments/foundation/recompute?from=2026-04-01&to=2026-04-30", nil, &report)
+	if rec.Code != http.StatusOK || len(report.Corrections) != 0 {
+		t.Fatalf("second run corrections = %+v, want none", report.Corrections)
+	}
+
+	want := map[string]int64{"pay_a": 1500, "pay_b": 3750, "pay_c": 1200, "pay_d": 1000}
+	for ref, cents := range want {
+		if got := s.ledger.FoundationTotal(ref); got != cents {
+			t.Errorf("%s foundation total = %d, want %d", ref, got, cents)
+		}
+	}
+
+	// The original entries are untouched; corrections are separate entries.
+	adjustments := s.ledger.Entries(func(e LedgerEntry) bool { return e.Kind == EntryFoundationAdjustment })
+	if len(adjustments) != 2 {
+		t.Fatalf("adjustment entries = %d, want 2", len(adjustments))
+	}
+	originals := s.ledger.Entries(func(e LedgerEntry) bool { return e.Kind == EntryFoundation && e.PaymentRef == "pay_a" })
+	if len(originals) != 1 || originals[0].AmountCents != 1000 {
+		t.Fatalf("original pay_a entry = %+v, want untouched 1000", originals)
+	}
+}
+
+func TestRecomputeFoundationRequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/payments/foundation/recompute?from=2026-04-01&to=2026-04-30", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", rec.Code)
+	}
+}
+
+func TestFoundationPolicyAllocate(t *testing.T) {
+	p := FoundationPolicy{DefaultRate: 15 * apitypes.OnePercent, CategoryRates: map[string]apitypes.Percent{CategoryConsulting: 20 * apitypes.OnePercent}}
+	if f, n := p.Allocate(10001, CategoryTours); f != 1500 || n != 8501 {
+		t.Errorf("tours 10001 = %d/%d, want 1500/8501", f, n)
+	}
+	if f, n := p.Allocate(20000, CategoryConsulting); f != 4000 || n != 16000 {
+		t.Errorf("consulting 20000 = %d/%d, want 4000/16000", f, n)
+	}
+	if err := (FoundationPolicy{DefaultRate: 25 * apitypes.OnePercent}).validate(); err == nil {
+		t.Error("a 25% rate should fail validation")
+	}
+}
+
+func TestFoundationAllocationAtCharterBounds(t *testing.T) {
+	cases := []struct {
+		name           string
+		rate           apitypes.Percent
+		gross          int64
+		minimumCents   int64
+		wantFoundation int64
+	}{
+		{"10% floor", 10 * apitypes.OnePercent, 20000, 0, 2000},
+		{"20% ceiling", 20 * apitypes.OnePercent, 20000, 0, 4000},
+		{"10% rounds half to even", 10 * apitypes.OnePercent, 1005, 0, 100},
+		{"20% rounds down", 20 * apitypes.OnePercent, 1002, 0, 200},
+		{"zero amount", 20 * apitypes.OnePercent, 0, 0, 0},
+		{"zero amount ignores the minimum", 10 * apitypes.OnePercent, 0, 500, 0},
+		{"minimum never passes gross", 10 * apitypes.OnePercent, 3, 500, 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := FoundationPolicy{DefaultRate: c.rate, MinimumCents: c.minimumCents, MinimumMaxShare: apitypes.HundredPercent}
+			if err := p.validate(); err != nil {
+				t.Fatal(err)
+			}
+			f, n := p.Allocate(c.gross, CategoryTours)
+			if f != c.wantFoundation || n != c.gross-c.wantFoundation || f > c.gross {
+				t.Fatalf("Allocate(%d) = %d/%d, want %d/%d", c.gross, f, n, c.wantFoundation, c.gross-c.wantFoundation)
+			}
+		})
+	}
+}
+
+func TestCalculateFoundationShare(t *testing.T) {
+	cases := []struct {
+		gross          int64
+		rate           float64
+		wantFoundation int64
+	}{
+		{20000, 0.10, 2000},
+		{20000, 0.20, 4000},
+		{1005, 0.10, 100}, // 100.5 rounds to the even cent
+		{1015, 0.10, 102}, // 101.5 too
+		{333, 0.15, 50},   // 49.95
+		{1, 0.20, 0},
+		{0, 0.15, 0},
+	}
+	for _, c := range cases {
+		f, n := CalculateFoundationShare(c.gross, c.rate)
+		if f != c.wantFoundation || f+n != c.gross {
+			t.Errorf("CalculateFoundationShare(%d, %v) = %d/%d, want %d/%d", c.gross, c.rate, f, n, c.wantFoundation, c.gross-c.wantFoundation)
+		}
+	}
+}
+
+func TestFoundationEstimateMatchesCommittedAllocation(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Foundation.CategoryRates[CategoryConsulting] = 20 * apitypes.OnePercent
+	s.cfg.Foundation.CategoryRates[CategoryRentals] = 125 * apitypes.OnePercent / 10
+	h := s.routes()
+
+	tests := []struct {
+		amount   string
+		cents    int64
+		category string
+	}{
+		{"100", 10000, CategoryTours},
+		{"100.01", 10001, CategoryTours},
+		{"0.07", 7, CategoryRentals},
+		{"249.99", 24999, CategoryRentals},
+		{"1250.5", 125050, CategoryConsulting},
+	}
+	for i, tt := range tests {
+		var got foundationEstimate
+		rec := doJSON(t, h, http.MethodGet, "/api/payments/foundation/estimate?amount="+tt.amount+"&type="+tt.category, nil, &got)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status %d: %s", tt.amount, tt.category, rec.Code, rec.Body)
+		}
+
+		ref := fmt.Sprintf("pay_%d", i)
+		s.commitPayment(Payment{Ref: ref, Category: tt.category, GrossCents: tt.cents, Currency: "USD", PaidAt: apitypes.JSONTime{Time: s.now()}})
+		committed := s.ledger.FoundationTotal(ref)
+		if got.GrossCents != tt.cents || got.FoundationCents != committed || got.NetCents != tt.cents-committed {
+			t.Errorf("%s %s: estimate %+v, committed %d", tt.amount, tt.category, got, committed)
+		}
+	}
+}
+
+func TestFoundationEstimateRejectsBadInput(t *testing.T) {
+	s := newTestServer(t)
+	for _, q := range []string{"amount=100", "amount=100&type=lodging", "amount=-5&type=tours", "type=tours"} {
+		rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/foundation/estimate?"+q, nil, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+}
+
+func TestStripeWebhookCommitsFoundationAllocation(t *testing.T) {
+	s := newTestServer(t)
+	event := checkoutCompleted("bk-1")
+	event["data"].(map[string]interface{})["object"].(map[string]interface{})["metadata"] = map[string]string{"booking_id": "bk-1", "category": CategoryTours}
+	if rec := postStripeEvent(t, s, event, testWebhookSecret, nil); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	p, err := s.ledger.Payment("pi_test_1")
+	if err != nil || p.Category != CategoryTours || p.GrossCents != 20000 {
+		t.Fatalf("payment = %+v, %v", p, err)
+	}
+	if got := s.ledger.FoundationTotal("pi_test_1"); got != 3000 {
+		t.Fatalf("foundation total = %d, want 3000", got)
+	}
+}
+
+func TestSimulateFoundationRateSumsHistoricalPayments(t *testing.T) {
+	s := newTestServer(t)
+	h := s.routes()
+	day := time.Date(2026, 4, 10, 15, 0, 0, 0, time.UTC)
+	seedPayment(s, "pay_a", CategoryTours, 10000, 1500, day)
+	seedPayment(s, "pay_b", CategoryRentals, 25000, 3750, day.Add(time.Hour))
+	seedPayment(s, "pay_c", CategoryTours, 333, 50, day.Add(2*time.Hour))
+	// A later correction counts towards the actual allocation.
+	s.ledger.Append(LedgerEntry{PaymentRef: "pay_a", Category: CategoryTours, Kind: EntryFoundationAdjustment, AmountCents: 100, Currency: "USD", CreatedAt: apitypes.JSONTime{Time: day}})
+	// Outside the window.
+	seedPayment(s, "pay_d", CategoryTours, 10000, 1500, day.AddDate(0, 1, 0))
+
+	var resp struct {
+		Rate   apitypes.Percent       `json:"rate"`
+		Totals []FoundationSimulation `json:"totals"`
+	}
+	rec := doJSON(t, h, http.MethodPost, "/api/payments/foundation/simulate", map[string]string{"rate": "17.5%", "from": "2026-04-01", "to": "2026-04-30"}, &resp)
+	if rec.Code != http.StatusOK || len(resp.Totals) != 1 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	// 17.5% of 10000, 25000 and 333 is 1750 + 4375 + 58.275 → 58.
+	want := FoundationSimulation{Currency: "USD", PaymentCount: 3, GrossCents: 35333, ActualCents: 5400, SimulatedCents: 6183, DeltaCents: 783}
+	if resp.Totals[0] != want || resp.Rate != 1750 {
+		t.Fatalf("simulation = %+v at %s, want %+v", resp.Totals[0], resp.Rate, want)
+	}
+	// Nothing was recorded.
+	if got := s.ledger.FoundationTotal("pay_a"); got != 1600 {
+		t.Fatalf("pay_a allocation = %d after simulating, want 1600", got)
+	}
+}
+
+func TestSimulateFoundationRateValidation(t *testing.T) {
+	s := newTestServer(t)
+	h := s.routes()
+	for _, rate := range []string{"9.99%", "25", "-15"} {
+		rec := doJSON(t, h, http.MethodPost, "/api/payments/foundation/simulate", map[string]string{"rate": rate, "from": "2026-04-01", "to": "2026-04-30"}, nil)
+		if rec.Code != http.StatusUnprocessableEntity && rec.Code != http.StatusBadRequest {
+			t.Errorf("rate %s: status %d, want rejection", rate, rec.Code)
+		}
+	}
+	if rec := doJSON(t, h, http.MethodPost, "/api/payments/foundation/simulate", map[string]string{"rate": "20", "from": "2026-04-30", "to": "2026-04-01"}, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("reversed range: status %d, want 400", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/foundation/simulate", nil)
+	anon := httptest.NewRecorder()
+	h.ServeHTTP(anon, req)
+	if anon.Code != http.StatusUnauthorized {
+		t.Errorf("without admin key: status %d, want 401", anon.Code)
+	}
+}
+
+func TestFoundationMinimumContribution(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Foundation.MinimumCents = 500
+	s.cfg.Foundation.MinimumMaxShare = 50 * apitypes.OnePercent
+
+	// 15% of $20 is $3, so the $5 minimum applies; 15% of $1,000 is well
+	// above it; on $6 the minimum is capped at half the gross.
+	cases := []struct {
+		ref        string
+		gross      int64
+		foundation int64
+		minimum    bool
+	}{
+		{"pay_small", 2000, 500, true},
+		{"pay_large", 100000, 15000, false},
+		{"pay_tiny", 600, 300, true},
+	}
+	for _, c := range cases {
+		s.commitPayment(Payment{Ref: c.ref, BookingID: "bk-" + c.ref, Category: CategoryTours, GrossCents: c.gross, Currency: "USD", Rail: string(RailCard)})
+		entries := s.ledger.Entries(func(e LedgerEntry) bool { return e.PaymentRef == c.ref && e.Kind == EntryFoundation })
+		if len(entries) != 1 || entries[0].AmountCents != c.foundation || (entries[0].Memo != "") != c.minimum {
+			t.Errorf("%s: foundation entries %+v, want %d (minimum %v)", c.ref, entries, c.foundation, c.minimum)
+		}
+	}
+
+	var est foundationEstimate
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/foundation/estimate?amount=20.00&type=tours", nil, &est)
+	if est.FoundationCents != 500 || est.NetCents != 1500 || !est.MinimumApplied {
+		t.Fatalf("estimate = %+v, want the minimum", est)
+	}
+	if err := (FoundationPolicy{DefaultRate: 15 * apitypes.OnePercent, MinimumCents: 500}).validate(); err == nil {
+		t.Error("a minimum without a max share should fail validation")
+	}
+}
+
+func TestFoundationPolicyRejectsMalformedRates(t *testing.T) {
+	t.Setenv("FOUNDATION_RATE", "12.5%")
+	t.Setenv("FOUNDATION_RATE_TOURS", "20")
+	p, err := loadFoundationPolicy()
+	if err != nil || p.DefaultRate != 1250 || p.Rate(CategoryTours) != 20*apitypes.OnePercent || p.MinimumMaxShare != 50*apitypes.OnePercent {
+		t.Fatalf("policy = %+v, %v", p, err)
+	}
+
+	// A typo must stop the service rather than fall back to the default
+	// split.
+	for key, typo := range map[string]string{
+		"FOUNDATION_RATE":              "15 %",
+		"FOUNDATION_RATE_RENTALS":      "1O",
+		"FOUNDATION_MINIMUM_MAX_SHARE": "half",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, typo)
+			if _, err := loadFoundationPolicy(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Fatalf("%s=%q: err %v, want an error naming the variable", key, typo, err)
+			}
+		})
+	}
+}
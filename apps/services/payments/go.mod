@@ -5,4 +5,31 @@ go 1.22
 require (
 	github.com/go-chi/chi/v5 v5.2.0
 	github.com/go-chi/cors v1.2.1
+	golang.org/x/sync v0.7.0 // indirect
 )
+
+require (
+	github.com/prometheus/client_model v0.6.1 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_golang v1.20.5
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/pupuseria/gateway-es/packages/gokit v0.0.0
+	google.golang.org/grpc v1.64.1
+)
+
+replace github.com/pupuseria/gateway-es/packages/gokit => ../../../packages/gokit
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrGrantNotFound                 = errors.New("grant not found")
+	ErrGrantKeyReused                = errors.New("idempotency key was already used for a different grant")
+	ErrInsufficientFoundationBalance = errors.New("the Foundation's balance does not cover this grant")
+)
+
+// How a grant reaches its recipient: pushed to their Lightning Address, or
+// pulled by their wallet from an LNURL-withdraw link we issue them.
+const (
+	GrantMethodLightningAddress = "lightning_address"
+	GrantMethodLNURLWithdraw    = "lnurl_withdraw"
+)
+
+// Grant states. A grant's amount is debited from the Foundation when it is
+// created and credited back if it fails or its link expires unclaimed.
+const (
+	GrantAwaitingClaim = "awaiting_claim"
+	GrantPaid          = "paid"
+	GrantFailed        = "failed"
+	GrantExpired       = "expired"
+)
+
+// GrantRequest is a grant an admin asks to disburse.
+type GrantRequest struct {
+	Recipient        string `json:"recipient"`
+	Method           string `json:"method"`
+	LightningAddress string `json:"lightning_address,omitempty"`
+	AmountCents      int64  `json:"amount_cents"`
+	Memo             string `json:"memo,omitempty"`
+}
+
+// Grant is a Foundation grant disbursed over Lightning. LNURL is the
+// LNURL-withdraw a grant sent that way is claimed with, valid until
+// ExpiresAt.
+type Grant struct {
+	ID               string            `json:"grant_id"`
+	IdempotencyKey   string            `json:"idempotency_key"`
+	Recipient        string            `json:"recipient"`
+	Method           string            `json:"method"`
+	LightningAddress string            `json:"lightning_address,omitempty"`
+	AmountCents      int64             `json:"amount_cents"`
+	AmountSats       int64             `json:"amount_sats"`
+	Memo             string            `json:"memo,omitempty"`
+	Status           string            `json:"status"`
+	LNURL            string            `json:"lnurl,omitempty"`
+	PaymentHash      string            `json:"payment_hash,omitempty"`
+	Error            string            `json:"error,omitempty"`
+	CreatedAt        apitypes.JSONTime `json:"created_at"`
+	ExpiresAt        apitypes.JSONTime `json:"expires_at"`
+	PaidAt           apitypes.JSONTime `json:"paid_at"`
+
+	// k1 is the secret in the LNURL-withdraw link.
+	k1 string
+}
+
+func (g *Grant) request() GrantRequest {
+	return GrantRequest{Recipient: g.Recipient, Method: g.Method, LightningAddress: g.LightningAddress, AmountCents: g.AmountCents, Memo: g.Memo}
+}
+
+// grants holds disbursed grants by id, idempotency key and LNURL-withdraw
+// secret. mu also serialises disbursements and claims, so two grants
+// never spend the same balance and a link is never paid twice.
+type grants struct {
+	mu    sync.Mutex
+	byID  map[string]*Grant
+	byKey map[string]*Grant
+	byK1  map[string]*Grant
+}
+
+func newGrants() *grants {
+	return &grants{byID: make(map[string]*Grant), byKey: make(map[string]*Grant), byK1: make(map[string]*Grant)}
+}
+
+// List returns every grant, newest first.
+func (g *grants) List() []Grant {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]Grant, 0, len(g.byID))
+	for _, gr := range g.byID {
+		out = append(out, *gr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt.Time) })
+	return out
+}
+
+// foundationBalance is what the Foundation can still grant: its balance in
+// the ledger less what has been paid out to its own accounts.
+func (s *server) foundationBalance() int64 {
+	return s.ledger.FoundationBalance() - s.payouts.SentCents()
+}
+
+// bookGrant moves cents between the Foundation and a grant in the ledger:
+// negative to disburse, positive to return.
+func (s *server) bookGrant(g *Grant, cents int64, memo string) {
+	s.ledger.Append(LedgerEntry{
+		PaymentRef:  g.ID,
+		Kind:        EntryGrant,
+		AmountCents: cents,
+		Currency:    "USD",
+		Memo:        memo,
+		CreatedAt:   apitypes.JSONTime{Time: s.now()},
+	})
+}
+
+// expireGrantsLocked returns the amounts of LNURL-withdraw grants nobody
+// claimed in time. Callers must hold s.grants.mu.
+func (s *server) expireGrantsLocked() {
+	now := s.now()
+	for _, g := range s.grants.byID {
+		if g.Status == GrantAwaitingClaim && !now.Before(g.ExpiresAt.Time) {
+			g.Status = GrantExpired
+			s.bookGrant(g, g.AmountCents, "grant "+g.ID+" expired unclaimed")
+			log.Printf("grant %s to %s expired unclaimed; %d cents returned to the Foundation", g.ID, g.Recipient, g.AmountCents)
+		}
+	}
+}
+
+// DisburseGrant pays req out of the Foundation's balance under an
+// idempotency key. Repeating a key returns the grant it made, and retries
+// it if its payment failed; reusing one for a different grant is refused.
+// A Lightning Address grant is paid at once. An LNURL-withdraw grant is
+// reserved and paid when the recipient's wallet claims it.
+func (s *server) DisburseGrant(ctx context.Context, key string, req GrantRequest) (Grant, error) {
+	s.grants.mu.Lock()
+	defer s.grants.mu.Unlock()
+	s.expireGrantsLocked()
+
+	g, known := s.grants.byKey[key]
+	if known {
+		if g.request() != req {
+			return *g, ErrGrantKeyReused
+		}
+		if g.Status != GrantFailed {
+			return *g, nil
+		}
+	} else {
+		g = &Grant{
+			ID:               newID(),
+			IdempotencyKey:   key,
+			Recipient:        req.Recipient,
+			Method:           req.Method,
+			LightningAddress: req.LightningAddress,
+			AmountCents:      req.AmountCents,
+			Memo:             req.Memo,
+			CreatedAt:        apitypes.JSONTime{Time: s.now()},
+		}
+	}
+	if s.foundationBalance() < req.AmountCents {
+		return *g, ErrInsufficientFoundationBalance
+	}
+	sats, err := s.satsAtCurrentRate(ctx, req.AmountCents)
+	if err != nil {
+		return *g, err
+	}
+	g.AmountSats, g.Error = sats, ""
+	s.bookGrant(g, -g.AmountCents, fmt.Sprintf("grant to %s: %s", g.Recipient, g.Memo))
+	s.grants.byID[g.ID], s.grants.byKey[key] = g, g
+
+	if g.Method == GrantMethodLNURLWithdraw {
+		var secret [32]byte
+		if _, err := rand.Read(secret[:]); err != nil {
+			panic(err)
+		}
+		g.k1 = hex.EncodeToString(secret[:])
+		g.LNURL = encodeLNURL(strings.TrimSuffix(s.cfg.PublicURL, "/") + "/api/payments/lnurlw/" + g.k1)
+		g.Status, g.ExpiresAt = GrantAwaitingClaim, apitypes.JSONTime{Time: s.now().Add(s.cfg.GrantClaimTTL)}
+		s.grants.byK1[g.k1] = g
+		return *g, nil
+	}
+
+	pr, err := s.lnurl.Resolve(ctx, g.LightningAddress, g.AmountSats)
+	if err == nil {
+		g.PaymentHash, err = s.lnd.PayInvoice(ctx, pr)
+		s.lndHealth.observe(err, s.now())
+	}
+	if err != nil {
+		g.Status, g.Error = GrantFailed, err.Error()
+		s.bookGrant(g, g.AmountCents, "grant "+g.ID+" failed")
+		log.Printf("ALERT: grant %s of %d cents to %s failed: %v", g.ID, g.AmountCents, g.LightningAddress, err)
+		return *g, nil
+	}
+	g.Status, g.PaidAt = GrantPaid, apitypes.JSONTime{Time: s.now()}
+	log.Printf("grant %s of %d cents (%d sats) paid to %s", g.ID, g.AmountCents, g.AmountSats, g.LightningAddress)
+	return *g, nil
+}
+
+// claimableGrantLocked finds the unclaimed grant behind an LNURL-withdraw
+// secret. Callers must hold s.grants.mu.
+func (s *server) claimableGrantLocked(k1 string) (*Grant, error) {
+	s.expireGrantsLocked()
+	g, ok := s.grants.byK1[k1]
+	if !ok {
+		return nil, ErrGrantNotFound
+	}
+	if g.Status != GrantAwaitingClaim {
+		return nil, fmt.Errorf("grant is %s", g.Status)
+	}
+	return g, nil
+}
+
+// ClaimGrant pays an LNURL-withdraw grant to the invoice its recipient's
+// wallet sent, which must be for exactly the grant's amount. A failed
+// payment leaves the grant claimable so the wallet can try again.
+func (s *server) ClaimGrant(ctx context.Context, k1, paymentRequest string) (Grant, error) {
+	s.grants.mu.Lock()
+	defer s.grants.mu.Unlock()
+	g, err := s.claimableGrantLocked(k1)
+	if err != nil {
+		return Grant{}, err
+	}
+	decoded, err := s.lnd.DecodePayReq(ctx, paymentRequest)
+	if err != nil {
+		return *g, fmt.Errorf("invalid invoice: %w", err)
+	}
+	if decoded.AmountSats != g.AmountSats {
+		return *g, fmt.Errorf("invoice is for %d sats, the grant is %d sats", decoded.AmountSats, g.AmountSats)
+	}
+	hash, err := s.lnd.PayInvoice(ctx, paymentRequest)
+	s.lndHealth.observe(err, s.now())
+	if err != nil {
+		g.Error = err.Error()
+		log.Printf("grant %s claim failed: %v", g.ID, err)
+		return *g, fmt.Errorf("payment failed: %w", err)
+	}
+	g.Status, g.PaymentHash, g.PaidAt, g.Error = GrantPaid, hash, apitypes.JSONTime{Time: s.now()}, ""
+	log.Printf("grant %s of %d cents (%d sats) claimed by %s", g.ID, g.AmountCents, g.AmountSats, g.Recipient)
+	return *g, nil
+}
+
+// disburseGrantHandler pays a Foundation grant. Admins must send an
+// Idempotency-Key so a retried request cannot pay twice. Body:
+// {"recipient", "method": "lightning_address" or "lnurl_withdraw",
+// "lightning_address", "amount_cents", "memo"}.
+func (s *server) disburseGrantHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		respondError(w, http.StatusBadRequest, "missing_idempotency_key", "Idempotency-Key header is required")
+		return
+	}
+	var req GrantRequest
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	req.Recipient = strings.TrimSpace(req.Recipient)
+	if req.Recipient == "" || req.AmountCents <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_grant", "recipient and a positive amount_cents are required")
+		return
+	}
+	switch req.Method {
+	case GrantMethodLightningAddress:
+		addr, err := normalizeLightningAddress(req.LightningAddress)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_lightning_address", err.Error())
+			return
+		}
+		req.LightningAddress = addr
+	case GrantMethodLNURLWithdraw:
+		if req.LightningAddress != "" {
+			respondError(w, http.StatusBadRequest, "invalid_grant", "lightning_address is only used with method lightning_address")
+			return
+		}
+	default:
+		respondError(w, http.StatusBadRequest, "invalid_grant", "method must be lightning_address or lnurl_withdraw")
+		return
+	}
+	if s.lnd == nil {
+		respondError(w, http.StatusServiceUnavailable, "lightning_unavailable", "no Lightning node is configured")
+		return
+	}
+
+	g, err := s.DisburseGrant(r.Context(), key, req)
+	switch {
+	case errors.Is(err, ErrGrantKeyReused):
+		respondError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", err.Error())
+	case errors.Is(err, ErrInsufficientFoundationBalance):
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":         "insufficient_foundation_balance",
+			"message":       err.Error(),
+			"balance_cents": s.foundationBalance(),
+		})
+	case err != nil:
+		log.Printf("grant to %s: %v", req.Recipient, err)
+		respondError(w, http.StatusServiceUnavailable, "grant_unpriced", "could not price the grant in sats")
+	case g.Status == GrantFailed:
+		respondJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error":   "grant_payment_failed",
+			"message": g.Error,
+			"grant":   g,
+		})
+	default:
+		respondJSON(w, http.StatusOK, g)
+	}
+}
+
+func (s *server) listGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	s.grants.mu.Lock()
+	s.expireGrantsLocked()
+	s.grants.mu.Unlock()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"balance_cents": s.foundationBalance(),
+		"grants":        s.grants.List(),
+	})
+}
+
+// respondLNURLError answers a wallet in the LNURL error format, which
+// wallets expect with a 200.
+func respondLNURLError(w http.ResponseWriter, reason string) {
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ERROR", "reason": reason})
+}
+
+// lnurlWithdrawHandler answers a wallet scanning a grant's LNURL-withdraw
+// with the withdraw request it can claim (LUD-03). Amounts are in
+// millisatoshis.
+func (s *server) lnurlWithdrawHandler(w http.ResponseWriter, r *http.Request) {
+	k1 := chi.URLParam(r, "k1")
+	s.grants.mu.Lock()
+	g, err := s.claimableGrantLocked(k1)
+	var grant Grant
+	if err == nil {
+		grant = *g
+	}
+	s.grants.mu.Unlock()
+	if err != nil {
+		respondLNURLError(w, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tag":                "withdrawRequest",
+		"callback":           strings.TrimSuffix(s.cfg.PublicURL, "/") + "/api/payments/lnurlw/" + k1 + "/callback",
+		"k1":                 k1,
+		"defaultDescription": "Foundation grant to " + grant.Recipient,
+		"minWithdrawable":    grant.AmountSats * 1000,
+		"maxWithdrawable":    grant.AmountSats * 1000,
+	})
+}
+
+// lnurlWithdrawCallbackHandler pays a claimed grant to the invoice the
+// wallet sends. Query: ?k1=&pr=.
+func (s *server) lnurlWithdrawCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	k1 := chi.URLParam(r, "k1")
+	if r.URL.Query().Get("k1") != k1 {
+		respondLNURLError(w, "k1 does not match")
+		return
+	}
+	if s.lnd == nil {
+		respondLNURLError(w, "Lightning is unavailable")
+		return
+	}
+	if _, err := s.ClaimGrant(r.Context(), k1, r.URL.Query().Get("pr")); err != nil {
+		respondLNURLError(w, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// newGrantTestServer holds a Foundation balance of 3000 cents, the 15%
+// share of one 20000 cent payment, and prices BTC at $65,000.
+func newGrantTestServer(t *testing.T) (*server, *fakeLND) {
+	t.Helper()
+	s, lnd := newLightningTestServer(t)
+	s.lnurl = testResolver()
+	s.rates = &fakeRates{reading: BTCRateReading{BtcUSD: 65000, FetchedAt: apitypes.JSONTime{Time: s.now()}}}
+	s.cfg.PublicURL = "https://pay.example.com"
+	s.cfg.GrantClaimTTL = 24 * time.Hour
+	s.commitPayment(Payment{Ref: "pi_1", BookingID: "bk-1", Category: CategoryTours, GrossCents: 20000, Currency: "USD", Rail: string(RailCard)})
+	return s, lnd
+}
+
+func postGrant(t *testing.T, s *server, key string, req GrantRequest, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/payments/foundation/grants", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminKey)
+	r.Header.Set("Idempotency-Key", key)
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, r)
+	if out != nil {
+		json.Unmarshal(rec.Body.Bytes(), out)
+	}
+	return rec
+}
+
+type grantsResponse struct {
+	BalanceCents int64   `json:"balance_cents"`
+	Grants       []Grant `json:"grants"`
+}
+
+func listGrants(t *testing.T, s *server) grantsResponse {
+	t.Helper()
+	var got grantsResponse
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/foundation/grants", nil, &got); rec.Code != http.StatusOK {
+		t.Fatalf("list grants: status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func TestGrantPaidToLightningAddress(t *testing.T) {
+	s, lnd := newGrantTestServer(t)
+	wallet := newFakeWallet(t)
+	req := GrantRequest{Recipient: "Escuela Suchitoto", Method: GrantMethodLightningAddress, LightningAddress: wallet.address(), AmountCents: 2000, Memo: "school supplies"}
+
+	var g Grant
+	if rec := postGrant(t, s, "grant-1", req, &g); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if g.Status != GrantPaid || g.AmountSats != 30769 || g.PaymentHash == "" || len(lnd.paid) != 1 {
+		t.Fatalf("grant = %+v after payments %v, want 30769 sats paid", g, lnd.paid)
+	}
+	if len(wallet.amounts) != 1 || wallet.amounts[0] != "30769000" {
+		t.Fatalf("wallet invoiced %v, want 30769000 msats", wallet.amounts)
+	}
+	if got := listGrants(t, s); got.BalanceCents != 1000 || len(got.Grants) != 1 {
+		t.Fatalf("after grant: %+v, want 1000 cents left", got)
+	}
+	debits := s.ledger.Entries(func(e LedgerEntry) bool { return e.Kind == EntryGrant })
+	if len(debits) != 1 || debits[0].AmountCents != -2000 || debits[0].PaymentRef != g.ID {
+		t.Fatalf("grant entries = %+v", debits)
+	}
+
+	// A retry with the same key returns the grant without paying again.
+	var again Grant
+	if rec := postGrant(t, s, "grant-1", req, &again); rec.Code != http.StatusOK || again.ID != g.ID || len(lnd.paid) != 1 {
+		t.Fatalf("retry: status %d, grant %+v, %d payments", rec.Code, again, len(lnd.paid))
+	}
+	req.AmountCents = 500
+	if rec := postGrant(t, s, "grant-1", req, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key: status %d, want 422", rec.Code)
+	}
+}
+
+func TestGrantOverFoundationBalanceIsRefused(t *testing.T) {
+	s, lnd := newGrantTestServer(t)
+	wallet := newFakeWallet(t)
+
+	var resp struct {
+		Error        string `json:"error"`
+		BalanceCents int64  `json:"balance_cents"`
+	}
+	rec := postGrant(t, s, "grant-big", GrantRequest{Recipient: "Escuela Suchitoto", Method: GrantMethodLightningAddress, LightningAddress: wallet.address(), AmountCents: 5000}, &resp)
+	if rec.Code != http.StatusUnprocessableEntity || resp.Error != "insufficient_foundation_balance" || resp.BalanceCents != 3000 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(lnd.paid) != 0 || len(wallet.amounts) != 0 {
+		t.Fatalf("paid %v, want nothing", lnd.paid)
+	}
+	if got := listGrants(t, s); got.BalanceCents != 3000 || len(got.Grants) != 0 {
+		t.Fatalf("after refusal: %+v, want the balance untouched", got)
+	}
+}
+
+func TestLNURLWithdrawGrantIsClaimedOnce(t *testing.T) {
+	s, lnd := newGrantTestServer(t)
+	h := s.routes()
+
+	var g Grant
+	if rec := postGrant(t, s, "grant-w", GrantRequest{Recipient: "Cooperativa", Method: GrantMethodLNURLWithdraw, AmountCents: 2000}, &g); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if g.Status != GrantAwaitingClaim || len(g.LNURL) < 10 || g.LNURL[:6] != "LNURL1" {
+		t.Fatalf("grant = %+v, want an LNURL awaiting its claim", g)
+	}
+	if got := listGrants(t, s); got.BalanceCents != 1000 {
+		t.Fatalf("balance %d, want the grant reserved", got.BalanceCents)
+	}
+	k1 := s.grants.byID[g.ID].k1
+
+	var params struct {
+		Tag             string `json:"tag"`
+		Callback        string `json:"callback"`
+		K1              string `json:"k1"`
+		MaxWithdrawable int64  `json:"maxWithdrawable"`
+	}
+	doJSON(t, h, http.MethodGet, "/api/payments/lnurlw/"+k1, nil, &params)
+	if params.Tag != "withdrawRequest" || params.K1 != k1 || params.MaxWithdrawable != 30769000 ||
+		params.Callback != "https://pay.example.com/api/payments/lnurlw/"+k1+"/callback" {
+		t.Fatalf("withdraw request = %+v", params)
+	}
+
+	var status struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	callback := "/api/payments/lnurlw/" + k1 + "/callback?k1=" + k1 + "&pr="
+	if doJSON(t, h, http.MethodGet, callback+"lnbc99999", nil, &status); status.Status != "ERROR" || len(lnd.paid) != 0 {
+		t.Fatalf("wrong amount: %+v, paid %v", status, lnd.paid)
+	}
+	if doJSON(t, h, http.MethodGet, callback+"lnbc30769", nil, &status); status.Status != "OK" || len(lnd.paid) != 1 {
+		t.Fatalf("claim: %+v, paid %v", status, lnd.paid)
+	}
+	status.Status = ""
+	if doJSON(t, h, http.MethodGet, callback+"lnbc30769", nil, &status); status.Status != "ERROR" || len(lnd.paid) != 1 {
+		t.Fatalf("second claim: %+v, paid %v", status, lnd.paid)
+	}
+	if got := listGrants(t, s); got.Grants[0].Status != GrantPaid || got.BalanceCents != 1000 {
+		t.Fatalf("after claim: %+v", got)
+	}
+}
+
+func TestUnclaimedGrantExpiresAndReturnsItsAmount(t *testing.T) {
+	s, _ := newGrantTestServer(t)
+	if rec := postGrant(t, s, "grant-w", GrantRequest{Recipient: "Cooperativa", Method: GrantMethodLNURLWithdraw, AmountCents: 2000}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	later := s.now().Add(25 * time.Hour)
+	s.now = func() time.Time { return later }
+	if got := listGrants(t, s); got.Grants[0].Status != GrantExpired || got.BalanceCents != 3000 {
+		t.Fatalf("after expiry: %+v, want expired and the balance restored", got)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// impactMaxAge is how long clients and CDNs may cache an impact summary.
+const impactMaxAge = "public, max-age=300"
+
+// ImpactTotal is the Foundation's funding in one currency. It carries only
+// aggregates, so it is safe to publish.
+type ImpactTotal struct {
+	Currency       string `json:"currency"`
+	AllocatedCents int64  `json:"allocated_cents"`
+	ReversedCents  int64  `json:"reversed_cents"`
+	NetCents       int64  `json:"net_cents"`
+	// ByCategory is the net amount per product category, when requested.
+	ByCategory map[string]int64 `json:"by_category,omitempty"`
+}
+
+// ImpactSummary totals Foundation funding recorded in [from, to): every
+// allocation and correction, less what was clawed back for refunds.
+func (l *Ledger) ImpactSummary(from, to time.Time, byCategory bool) []ImpactTotal {
+	totals := make(map[string]*ImpactTotal)
+	for _, e := range l.Entries(func(e LedgerEntry) bool {
+		return e.Kind.isFoundation() && !e.CreatedAt.Before(from) && e.CreatedAt.Before(to)
+	}) {
+		t, ok := totals[e.Currency]
+		if !ok {
+			t = &ImpactTotal{Currency: e.Currency}
+			if byCategory {
+				t.ByCategory = make(map[string]int64)
+			}
+			totals[e.Currency] = t
+		}
+		if e.Kind == EntryFoundationReversal {
+			t.ReversedCents -= e.AmountCents
+		} else {
+			t.AllocatedCents += e.AmountCents
+		}
+		t.NetCents += e.AmountCents
+		if byCategory {
+			t.ByCategory[e.Category] += e.AmountCents
+		}
+	}
+
+	out := make([]ImpactTotal, 0, len(totals))
+	for _, t := range totals {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Currency < out[j].Currency })
+	return out
+}
+
+// isFoundation reports whether an entry moves money to or from the
+// Foundation.
+func (k EntryKind) isFoundation() bool {
+	return k == EntryFoundation || k == EntryFoundationAdjustment || k == EntryFoundationReversal
+}
+
+// impactHandler publishes the Foundation's funding over a date range. The
+// response is cacheable and answers If-None-Match with 304.
+func (s *server) impactHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_range", err.Error())
+		return
+	}
+	byCategory := r.URL.Query().Get("breakdown") == "category"
+
+	body, err := json.Marshal(map[string]interface{}{
+		"from":   from.Format(time.DateOnly),
+		"to":     to.AddDate(0, 0, -1).Format(time.DateOnly),
+		"totals": s.ledger.ImpactSummary(from, to, byCategory),
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Cache-Control", impactMaxAge)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
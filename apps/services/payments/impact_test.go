@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+type impactResponse struct {
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+	Totals []ImpactTotal `json:"totals"`
+}
+
+// seedImpactLedger records April payments, a correction and a partial
+// refund, plus a payment in May that falls outside the window.
+func seedImpactLedger(t *testing.T, s *server) time.Time {
+	t.Helper()
+	day := time.Date(2026, 4, 10, 15, 0, 0, 0, time.UTC)
+	seedPayment(s, "pay_a", CategoryTours, 10000, 1500, day)
+	seedPayment(s, "pay_b", CategoryRentals, 20000, 3000, day.Add(time.Hour))
+	seedPayment(s, "pay_c", CategoryTours, 10000, 1500, day.AddDate(0, 1, 0))
+	s.ledger.Append(LedgerEntry{PaymentRef: "pay_b", Category: CategoryRentals, Kind: EntryFoundationAdjustment, AmountCents: 100, Currency: "USD", CreatedAt: apitypes.JSONTime{Time: day.Add(2 * time.Hour)}})
+	if _, err := s.ledger.RecordRefund("pay_a", 5000, "guest cancelled", day.AddDate(0, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	return day
+}
+
+func getImpact(t *testing.T, s *server, query string) impactResponse {
+	t.Helper()
+	var got impactResponse
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/impact?"+query, nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func TestImpactMatchesFoundationEntriesNetOfReversals(t *testing.T) {
+	s := newTestServer(t)
+	seedImpactLedger(t, s)
+	from := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	var want, reversed int64
+	for _, e := range s.ledger.Entries(func(e LedgerEntry) bool {
+		return !e.CreatedAt.Before(from) && e.CreatedAt.Before(to)
+	}) {
+		switch e.Kind {
+		case EntryFoundation, EntryFoundationAdjustment:
+			want += e.AmountCents
+		case EntryFoundationReversal:
+			want += e.AmountCents
+			reversed -= e.AmountCents
+		}
+	}
+	if reversed != 750 {
+		t.Fatalf("reversed = %d, want half of pay_a's 1500", reversed)
+	}
+
+	got := getImpact(t, s, "from=2026-04-01&to=2026-04-30")
+	if len(got.Totals) != 1 {
+		t.Fatalf("totals = %+v, want one currency", got.Totals)
+	}
+	total := got.Totals[0]
+	if total.NetCents != want || total.NetCents != 1500+3000+100-750 {
+		t.Fatalf("net = %d, want %d", total.NetCents, want)
+	}
+	if total.AllocatedCents != 4600 || total.ReversedCents != reversed {
+		t.Fatalf("total = %+v", total)
+	}
+	if total.ByCategory != nil {
+		t.Fatalf("by_category = %v, want none unless requested", total.ByCategory)
+	}
+}
+
+func TestImpactByCategory(t *testing.T) {
+	s := newTestServer(t)
+	seedImpactLedger(t, s)
+
+	got := getImpact(t, s, "from=2026-04-01&to=2026-04-30&breakdown=category")
+	cats := got.Totals[0].ByCategory
+	if cats[CategoryTours] != 750 || cats[CategoryRentals] != 3100 {
+		t.Fatalf("by_category = %v", cats)
+	}
+}
+
+func TestImpactExcludesReversalsOutsideWindow(t *testing.T) {
+	s := newTestServer(t)
+	day := seedImpactLedger(t, s)
+	// Refunding pay_b in May leaves April's figure untouched.
+	if _, err := s.ledger.RecordRefund("pay_b", 20000, "", day.AddDate(0, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := getImpact(t, s, "from=2026-04-01&to=2026-04-30"); got.Totals[0].NetCents != 3850 {
+		t.Fatalf("april net = %d, want 3850", got.Totals[0].NetCents)
+	}
+	if got := getImpact(t, s, "from=2026-05-01&to=2026-05-31"); got.Totals[0].NetCents != 1500-3100 {
+		t.Fatalf("may net = %d, want %d", got.Totals[0].NetCents, 1500-3100)
+	}
+}
+
+func TestImpactIsCacheable(t *testing.T) {
+	s := newTestServer(t)
+	seedImpactLedger(t, s)
+	h := s.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/payments/impact?from=2026-04-01&to=2026-04-30", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Cache-Control") != impactMaxAge {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("revalidation: status %d, body %q", rec.Code, rec.Body)
+	}
+}
+
+func TestImpactRejectsBadRange(t *testing.T) {
+	s := newTestServer(t)
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/impact?from=2026-04-30&to=2026-04-01", nil, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestRecordRefundRejectsMoreThanRefundable(t *testing.T) {
+	s := newTestServer(t)
+	seedImpactLedger(t, s)
+
+	if _, err := s.ledger.RecordRefund("pay_a", 5001, "", time.Now()); err != ErrRefundExceeds {
+		t.Fatalf("err = %v, want ErrRefundExceeds", err)
+	}
+	if _, err := s.ledger.RecordRefund("pay_x", 100, "", time.Now()); err != ErrPaymentNotFound {
+		t.Fatalf("err = %v, want ErrPaymentNotFound", err)
+	}
+	// Refunding the rest of pay_a reverses the rest of its allocation.
+	if _, err := s.ledger.RecordRefund("pay_a", 5000, "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	held := s.ledger.Entries(func(e LedgerEntry) bool { return e.PaymentRef == "pay_a" && e.Kind.isFoundation() })
+	var sum int64
+	for _, e := range held {
+		sum += e.AmountCents
+	}
+	if sum != 0 {
+		t.Fatalf("foundation still holds %d cents of a fully refunded payment", sum)
+	}
+}
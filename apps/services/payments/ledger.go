@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	ErrRefundExceeds   = errors.New("refund exceeds the amount still refundable")
+)
+
+// EntryKind classifies a ledger entry.
+type EntryKind string
+
+const (
+	// EntryGross is money received from a guest.
+	EntryGross EntryKind = "gross"
+	// EntryFoundation is the Foundation's share of a payment.
+	EntryFoundation EntryKind = "foundation"
+	// EntryFoundationAdjustment corrects a previously recorded Foundation
+	// share without rewriting history.
+	EntryFoundationAdjustment EntryKind = "foundation_adjustment"
+	// EntryRefund is money returned to a guest, recorded as a negative
+	// amount.
+	EntryRefund EntryKind = "refund"
+	// EntryFoundationReversal claws back the Foundation's share of a
+	// refunded or disputed amount, recorded as a negative amount. A won
+	// dispute reinstates its share with a positive reversal.
+	EntryFoundationReversal EntryKind = "foundation_reversal"
+	// EntryDispute is money withdrawn from us by a chargeback, recorded as
+	// a negative amount and reinstated with a positive one if the dispute
+	// is won.
+	EntryDispute EntryKind = "dispute"
+	// EntryGrant is Foundation money disbursed as a grant, recorded as a
+	// negative amount under the grant's id and returned with a positive
+	// one if the grant is never paid.
+	EntryGrant EntryKind = "grant"
+	// EntryPartnerCommission is what the partner who referred a payment
+	// earns from it, taken from the platform's net.
+	EntryPartnerCommission EntryKind = "partner_commission"
+)
+
+// LedgerEntry is an immutable accounting record. Amounts are signed cents.
+type LedgerEntry struct {
+	ID          string            `json:"id"`
+	PaymentRef  string            `json:"payment_ref"`
+	BookingID   string            `json:"booking_id,omitempty"`
+	Category    string            `json:"category"`
+	Kind        EntryKind         `json:"kind"`
+	Partner     string            `json:"partner,omitempty"`
+	AmountCents int64             `json:"amount_cents"`
+	Currency    string            `json:"currency"`
+	Memo        string            `json:"memo,omitempty"`
+	CreatedAt   apitypes.JSONTime `json:"created_at"`
+}
+
+// Payment is a completed guest payment to one tenant.
+type Payment struct {
+	Ref        string            `json:"payment_ref"`
+	Tenant     string            `json:"tenant,omitempty"`
+	BookingID  string            `json:"booking_id"`
+	Category   string            `json:"category"`
+	GrossCents int64             `json:"gross_cents"`
+	Currency   string            `json:"currency"`
+	Rail       string            `json:"rail"`
+	PaidAt     apitypes.JSONTime `json:"paid_at"`
+	// ReferralCode is the partner code the guest booked with, if any.
+	ReferralCode string `json:"referral_code,omitempty"`
+}
+
+// Ledger is the append-only record of payments and their allocations.
+type Ledger struct {
+	mu       sync.RWMutex
+	entries  []LedgerEntry
+	payments map[string]Payment
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{payments: make(map[string]Payment)}
+}
+
+// RecordPayment stores a completed payment together with its gross and
+// Foundation entries, memo explaining the Foundation entry when set. A
+// payment already recorded is left as it is and nil returned, so providers
+// redelivering a payment cannot book it twice.
+func (l *Ledger) RecordPayment(p Payment, foundationCents int64, memo string) []LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.payments[p.Ref]; ok {
+		return nil
+	}
+	l.payments[p.Ref] = p
+	return l.appendLocked(
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryGross, AmountCents: p.GrossCents, Currency: p.Currency, CreatedAt: p.PaidAt},
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryFoundation, AmountCents: foundationCents, Currency: p.Currency, Memo: memo, CreatedAt: p.PaidAt},
+	)
+}
+
+// Append adds entries to the ledger, assigning ids.
+func (l *Ledger) Append(entries ...LedgerEntry) []LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.appendLocked(entries...)
+}
+
+func (l *Ledger) appendLocked(entries ...LedgerEntry) []LedgerEntry {
+	for i := range entries {
+		entries[i].ID = newID()
+		l.entries = append(l.entries, entries[i])
+	}
+	return entries
+}
+
+// Payment returns the payment with the given reference.
+func (l *Ledger) Payment(ref string) (Payment, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	p, ok := l.payments[ref]
+	if !ok {
+		return Payment{}, ErrPaymentNotFound
+	}
+	return p, nil
+}
+
+// PaymentsBetween returns payments made in [from, to), oldest first.
+func (l *Ledger) PaymentsBetween(from, to time.Time) []Payment {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []Payment
+	for _, p := range l.payments {
+		if !p.PaidAt.Before(from) && p.PaidAt.Before(to) {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PaidAt.Before(out[j].PaidAt.Time) })
+	return out
+}
+
+// Entries returns the entries for which keep returns true, in insertion order.
+func (l *Ledger) Entries(keep func(LedgerEntry) bool) []LedgerEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []LedgerEntry
+	for _, e := range l.entries {
+		if keep == nil || keep(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// FoundationTotal is the Foundation allocation for a payment, including
+// every correction made since. Reversals for refunds are not counted: they
+// follow the allocation rather than change it.
+func (l *Ledger) FoundationTotal(paymentRef string) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sumLocked(paymentRef, EntryFoundation, EntryFoundationAdjustment)
+}
+
+// CommissionTotal is the partner commission recorded for a payment.
+func (l *Ledger) CommissionTotal(paymentRef string) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sumLocked(paymentRef, EntryPartnerCommission)
+}
+
+// Refundable is what can still be refunded of a payment: its gross less
+// earlier refunds and disputed amounts.
+func (l *Ledger) Refundable(paymentRef string) (int64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	p, ok := l.payments[paymentRef]
+	if !ok {
+		return 0, ErrPaymentNotFound
+	}
+	return p.GrossCents + l.sumLocked(paymentRef, EntryRefund, EntryDispute), nil
+}
+
+// FoundationHeld is what the Foundation is still owed from a payment: its
+// allocation net of the reversals for any refunds.
+func (l *Ledger) FoundationHeld(paymentRef string) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sumLocked(paymentRef, EntryFoundation, EntryFoundationAdjustment, EntryFoundationReversal)
+}
+
+// FoundationBalance is everything allocated to the Foundation, net of
+// reversals and of the grants disbursed from it.
+func (l *Ledger) FoundationBalance() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var total int64
+	for _, e := range l.entries {
+		switch e.Kind {
+		case EntryFoundation, EntryFoundationAdjustment, EntryFoundationReversal, EntryGrant:
+			total += e.AmountCents
+		}
+	}
+	return total
+}
+
+// sumLocked totals a payment's entries of the given kinds. Callers must
+// hold l.mu.
+func (l *Ledger) sumLocked(paymentRef string, kinds ...EntryKind) int64 {
+	var total int64
+	for _, e := range l.entries {
+		if e.PaymentRef != paymentRef {
+			continue
+		}
+		for _, k := range kinds {
+			if e.Kind == k {
+				total += e.AmountCents
+			}
+		}
+	}
+	return total
+}
+
+// RecordRefund books a refund against a payment and claws back the same
+// share of the Foundation's net allocation, so a fully refunded payment
+// leaves the Foundation with nothing.
+func (l *Ledger) RecordRefund(paymentRef string, amountCents int64, memo string, at time.Time) ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.payments[paymentRef]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	refundable := p.GrossCents + l.sumLocked(paymentRef, EntryRefund, EntryDispute)
+	if amountCents <= 0 || amountCents > refundable {
+		return nil, ErrRefundExceeds
+	}
+	held := l.sumLocked(paymentRef, EntryFoundation, EntryFoundationAdjustment, EntryFoundationReversal)
+	reversal := divRound(held*amountCents, refundable)
+	return l.appendLocked(
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryRefund, AmountCents: -amountCents, Currency: p.Currency, Memo: memo, CreatedAt: apitypes.JSONTime{Time: at}},
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryFoundationReversal, AmountCents: -reversal, Currency: p.Currency, Memo: memo, CreatedAt: apitypes.JSONTime{Time: at}},
+	), nil
+}
+
+// RecordDispute withdraws a disputed amount from a payment and claws back
+// the same share of the Foundation's net allocation, as a refund would. The
+// amount is capped at what has not already been refunded or disputed. It
+// returns the amount withdrawn and the Foundation cents clawed back, which
+// ReinstateDispute restores should the dispute be won.
+func (l *Ledger) RecordDispute(paymentRef string, amountCents int64, memo string, at time.Time) (withdrawn, reversed int64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.payments[paymentRef]
+	if !ok {
+		return 0, 0, ErrPaymentNotFound
+	}
+	open := p.GrossCents + l.sumLocked(paymentRef, EntryRefund, EntryDispute)
+	withdrawn = min(amountCents, open)
+	if withdrawn <= 0 {
+		return 0, 0, nil
+	}
+	held := l.sumLocked(paymentRef, EntryFoundation, EntryFoundationAdjustment, EntryFoundationReversal)
+	reversed = divRound(held*withdrawn, open)
+	l.appendLocked(
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryDispute, AmountCents: -withdrawn, Currency: p.Currency, Memo: memo, CreatedAt: apitypes.JSONTime{Time: at}},
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryFoundationReversal, AmountCents: -reversed, Currency: p.Currency, Memo: memo, CreatedAt: apitypes.JSONTime{Time: at}},
+	)
+	return withdrawn, reversed, nil
+}
+
+// ReinstateDispute returns the amounts a won dispute withdrew to a payment
+// and to the Foundation.
+func (l *Ledger) ReinstateDispute(paymentRef string, withdrawn, reversed int64, memo string, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.payments[paymentRef]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	l.appendLocked(
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryDispute, AmountCents: withdrawn, Currency: p.Currency, Memo: memo, CreatedAt: apitypes.JSONTime{Time: at}},
+		LedgerEntry{PaymentRef: p.Ref, BookingID: p.BookingID, Category: p.Category, Kind: EntryFoundationReversal, AmountCents: reversed, Currency: p.Currency, Memo: memo, CreatedAt: apitypes.JSONTime{Time: at}},
+	)
+	return nil
+}
+
+// divRound divides a by b (b > 0), rounding half away from zero.
+func divRound(a, b int64) int64 {
+	if a < 0 {
+		return -divRound(-a, b)
+	}
+	return (a + b/2) / b
+}
+
+// newID returns a random RFC 4122 version 4 UUID.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// lightningInvoiceExpiry is how long a Lightning invoice can be paid.
+const lightningInvoiceExpiry = time.Hour
+
+// lndMaxMemoBytes is the longest description LND puts in an invoice.
+const lndMaxMemoBytes = 639
+
+var ErrInvoiceNotFound = errors.New("lightning invoice not found")
+
+// LightningInvoice is our record of an invoice issued for a booking.
+type LightningInvoice struct {
+	RHash          string            `json:"r_hash"`
+	Tenant         string            `json:"tenant,omitempty"`
+	PaymentRequest string            `json:"payment_request"`
+	Memo           string            `json:"memo,omitempty"`
+	BookingID      string            `json:"booking_id"`
+	Category       string            `json:"category,omitempty"`
+	AmountSats     int64             `json:"amount_sats"`
+	AmountCents    int64             `json:"amount_cents"`
+	Settled        bool              `json:"settled"`
+	CreatedAt      apitypes.JSONTime `json:"created_at"`
+	ExpiresAt      apitypes.JSONTime `json:"expires_at"`
+	SettledAt      apitypes.JSONTime `json:"settled_at"`
+}
+
+// lightningInvoices holds issued invoices by payment hash.
+type lightningInvoices struct {
+	mu     sync.Mutex
+	byHash map[string]*LightningInvoice
+}
+
+func newLightningInvoices() *lightningInvoices {
+	return &lightningInvoices{byHash: make(map[string]*LightningInvoice)}
+}
+
+func (l *lightningInvoices) Add(inv LightningInvoice) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.byHash[inv.RHash] = &inv
+}
+
+func (l *lightningInvoices) Get(rHash string) (LightningInvoice, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	inv, ok := l.byHash[rHash]
+	if !ok {
+		return LightningInvoice{}, ErrInvoiceNotFound
+	}
+	return *inv, nil
+}
+
+// MarkSettled records an invoice as paid at at.
+func (l *lightningInvoices) MarkSettled(rHash string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if inv, ok := l.byHash[rHash]; ok {
+		inv.Settled, inv.SettledAt = true, apitypes.JSONTime{Time: at}
+	}
+}
+
+// SettledBetween lists invoices we recorded as settled in [from, to).
+func (l *lightningInvoices) SettledBetween(from, to time.Time) []LightningInvoice {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []LightningInvoice
+	for _, inv := range l.byHash {
+		if inv.Settled && !inv.SettledAt.Before(from) && inv.SettledAt.Before(to) {
+			out = append(out, *inv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SettledAt.Before(out[j].SettledAt.Time) })
+	return out
+}
+
+// settleLightningInvoice commits a paid invoice to the ledger and hands it
+// to bookings, which refunds it from the ledger if the booking lost its
+// seats. It returns the booking's resulting status.
+func (s *server) settleLightningInvoice(ctx context.Context, inv LightningInvoice, settledAt time.Time) (string, error) {
+	s.commitPayment(Payment{
+		Ref:        inv.RHash,
+		Tenant:     inv.Tenant,
+		BookingID:  inv.BookingID,
+		Category:   inv.Category,
+		GrossCents: inv.AmountCents,
+		Currency:   "USD",
+		Rail:       string(RailLightning),
+		PaidAt:     apitypes.JSONTime{Time: settledAt},
+	})
+	status, err := s.bookings.RecordPayment(s.withTenant(ctx, inv.Tenant), inv.BookingID, PaymentNotice{
+		PaymentRef:  inv.RHash,
+		AmountCents: inv.AmountCents,
+		Currency:    "USD",
+	})
+	if err != nil {
+		return "", err
+	}
+	s.invoices.MarkSettled(inv.RHash, settledAt)
+	return status, nil
+}
+
+// Kinds of disagreement between LND and our records.
+const (
+	// DiscrepancyUnknownInvoice is settled in LND but was never issued by us.
+	DiscrepancyUnknownInvoice = "settled_in_lnd_unknown_here"
+	// DiscrepancyUnsettledHere is settled in LND but still open here, so
+	// its booking is still waiting for payment.
+	DiscrepancyUnsettledHere = "settled_in_lnd_pending_here"
+	// DiscrepancyNotSettledInLND is settled here but not in LND.
+	DiscrepancyNotSettledInLND = "settled_here_not_in_lnd"
+	// DiscrepancyUnderpaid was settled in LND for less than invoiced.
+	DiscrepancyUnderpaid = "underpaid"
+)
+
+// lightningDiscrepancy is one invoice on which LND and we disagree. Action
+// reports what auto-confirmation did about it.
+type lightningDiscrepancy struct {
+	RHash       string `json:"r_hash"`
+	Kind        string `json:"kind"`
+	BookingID   string `json:"booking_id,omitempty"`
+	AmountSats  int64  `json:"amount_sats"`
+	PaidSats    int64  `json:"paid_sats,omitempty"`
+	Action      string `json:"action,omitempty"`
+	ActionError string `json:"action_error,omitempty"`
+}
+
+// lightningReconciliation compares LND's settled invoices in a window with
+// ours.
+type lightningReconciliation struct {
+	LNDSettled    int                    `json:"lnd_settled"`
+	Matched       int                    `json:"matched"`
+	Confirmed     int                    `json:"confirmed"`
+	Discrepancies []lightningDiscrepancy `json:"discrepancies"`
+}
+
+// ReconcileLightning matches invoices settled in LND in [from, to) to our
+// records by payment hash. With autoConfirm, invoices LND settled but we
+// still hold open are settled here and their bookings confirmed.
+func (s *server) ReconcileLightning(ctx context.Context, from, to time.Time, autoConfirm bool) (lightningReconciliation, error) {
+	settled, err := s.lnd.SettledInvoices(ctx, from, to)
+	if err != nil {
+		return lightningReconciliation{}, err
+	}
+	rep := lightningReconciliation{LNDSettled: len(settled), Discrepancies: []lightningDiscrepancy{}}
+	inLND := make(map[string]bool, len(settled))
+	for _, lnd := range settled {
+		inLND[lnd.RHash] = true
+		ours, err := s.invoices.Get(lnd.RHash)
+		if err != nil {
+			rep.Discrepancies = append(rep.Discrepancies, lightningDiscrepancy{
+				RHash: lnd.RHash, Kind: DiscrepancyUnknownInvoice, AmountSats: lnd.ValueSats, PaidSats: lnd.AmtPaidSats,
+			})
+			continue
+		}
+		d := lightningDiscrepancy{RHash: lnd.RHash, BookingID: ours.BookingID, AmountSats: ours.AmountSats, PaidSats: lnd.AmtPaidSats}
+		switch {
+		case lnd.AmtPaidSats < ours.AmountSats:
+			// Never confirm a booking on a short payment.
+			d.Kind = DiscrepancyUnderpaid
+		case !ours.Settled:
+			d.Kind = DiscrepancyUnsettledHere
+			if autoConfirm {
+				if _, err := s.settleLightningInvoice(ctx, ours, lnd.SettledAt); err != nil {
+					d.Action, d.ActionError = "confirm_failed", err.Error()
+				} else {
+					d.Action = "confirmed"
+					rep.Confirmed++
+				}
+			}
+		default:
+			rep.Matched++
+			continue
+		}
+		rep.Discrepancies = append(rep.Discrepancies, d)
+	}
+	for _, ours := range s.invoices.SettledBetween(from, to) {
+		if !inLND[ours.RHash] {
+			rep.Discrepancies = append(rep.Discrepancies, lightningDiscrepancy{
+				RHash: ours.RHash, Kind: DiscrepancyNotSettledInLND, BookingID: ours.BookingID, AmountSats: ours.AmountSats,
+			})
+		}
+	}
+	return rep, nil
+}
+
+func (s *server) reconcileLightningHandler(w http.ResponseWriter, r *http.Request) {
+	if s.lnd == nil {
+		respondError(w, http.StatusServiceUnavailable, "lightning_unavailable", "no Lightning node is configured")
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_range", err.Error())
+		return
+	}
+	autoConfirm := r.URL.Query().Get("auto_confirm") == "true"
+	rep, err := s.ReconcileLightning(r.Context(), from, to, autoConfirm)
+	s.lndHealth.observe(err, s.now())
+	if err != nil {
+		log.Printf("lightning reconciliation: %v", err)
+		respondError(w, http.StatusBadGateway, "lnd_unavailable", "could not list invoices from LND")
+		return
+	}
+	for _, d := range rep.Discrepancies {
+		log.Printf("ALERT: lightning invoice %s: %s (booking %q, action %q)", d.RHash, d.Kind, d.BookingID, d.Action)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from":           from.Format(time.DateOnly),
+		"to":             to.AddDate(0, 0, -1).Format(time.DateOnly),
+		"auto_confirm":   autoConfirm,
+		"reconciliation": rep,
+	})
+}
+
+// createLightningInvoiceHandler issues an LND invoice for a booking. The
+// caller supplies the sats amount from a pricing quote along with the USD
+// amount it was converted from. When the node cannot issue one, the 503
+// names the rail to fall back to.
+func (s *server) createLightningInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	if s.lnd == nil {
+		s.respondLightningUnavailable(w, "no Lightning node is configured")
+		return
+	}
+	var req struct {
+		BookingID   string `json:"booking_id"`
+		Category    string `json:"category"`
+		AmountSats  int64  `json:"amount_sats"`
+		AmountCents int64  `json:"amount_cents"`
+		Memo        string `json:"memo"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.BookingID == "" || req.AmountSats <= 0 || req.AmountCents <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_invoice", "booking_id and positive amount_sats and amount_cents are required")
+		return
+	}
+	if limit := s.cfg.LightningMaxInvoiceSats; limit > 0 && req.AmountSats > limit {
+		respondError(w, http.StatusBadRequest, "invalid_invoice", fmt.Sprintf("amount_sats must be at most %d", limit))
+		return
+	}
+	if len(req.Memo) > lndMaxMemoBytes {
+		respondError(w, http.StatusBadRequest, "invalid_invoice", fmt.Sprintf("memo must be at most %d bytes", lndMaxMemoBytes))
+		return
+	}
+	if req.Memo == "" {
+		req.Memo = "Gateway El Salvador booking " + req.BookingID
+	}
+	// The sats amount was priced at the current rate; refuse it rather
+	// than charge a wrong amount if that rate is old.
+	if stale, why := s.btcRateStale(r.Context()); stale {
+		respondError(w, http.StatusServiceUnavailable, RailReasonRateStale, why)
+		return
+	}
+	ctx, capture := withExchangeCapture(r.Context())
+	lnd, err := s.lnd.AddInvoice(ctx, req.AmountSats, req.Memo, lightningInvoiceExpiry)
+	s.lndHealth.observe(err, s.now())
+	if err != nil {
+		log.Printf("lightning invoice for booking %s failed: %v", req.BookingID, err)
+		s.respondLightningUnavailable(w, "could not create Lightning invoice")
+		return
+	}
+	inv := LightningInvoice{
+		RHash:          lnd.RHash,
+		Tenant:         s.tenant(r.Context()).ID,
+		PaymentRequest: lnd.PaymentRequest,
+		Memo:           req.Memo,
+		BookingID:      req.BookingID,
+		Category:       req.Category,
+		AmountSats:     req.AmountSats,
+		AmountCents:    req.AmountCents,
+		CreatedAt:      apitypes.JSONTime{Time: s.now()},
+		ExpiresAt:      apitypes.JSONTime{Time: s.now().Add(lightningInvoiceExpiry)},
+	}
+	s.invoices.Add(inv)
+	s.payloads.Add(inv.RHash, capture.list()...)
+	respondJSON(w, http.StatusCreated, inv)
+}
+
+// checkLightningPaymentHandler reports whether an invoice, named by its
+// payment hash in hex, has been paid, asking the node rather than waiting
+// for reconciliation so a polling frontend learns the moment it lands.
+func (s *server) checkLightningPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.invoices.Get(chi.URLParam(r, "invoiceId"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "invoice_not_found", err.Error())
+		return
+	}
+	if s.lnd == nil {
+		s.respondLightningUnavailable(w, "no Lightning node is configured")
+		return
+	}
+	lnd, err := s.lnd.LookupInvoice(r.Context(), inv.RHash)
+	if errors.Is(err, ErrLNDInvoiceNotFound) {
+		s.lndHealth.observe(nil, s.now())
+		log.Printf("ALERT: lightning invoice %s for booking %s is unknown to LND", inv.RHash, inv.BookingID)
+		respondError(w, http.StatusNotFound, "invoice_not_found", err.Error())
+		return
+	}
+	s.lndHealth.observe(err, s.now())
+	if err != nil {
+		log.Printf("looking up lightning invoice %s: %v", inv.RHash, err)
+		s.respondLightningUnavailable(w, "could not look up Lightning invoice")
+		return
+	}
+	if lnd.ExpiresAt.IsZero() {
+		lnd.ExpiresAt = inv.ExpiresAt.Time
+	}
+	status := lightningPaymentStatus{LightningInvoice: inv, Status: lightningStatus(lnd, s.now())}
+	if lnd.Settled {
+		status.AmtPaidSats = lnd.AmtPaidSats
+		status.SettleDate = &apitypes.JSONTime{Time: lnd.SettledAt}
+	}
+	respondJSON(w, http.StatusOK, status)
+}
+
+// Where a Lightning invoice stands in LND, as reported to a polling guest.
+const (
+	LightningPending = "pending"
+	LightningSettled = "settled"
+	LightningExpired = "expired"
+)
+
+// lightningPaymentStatus is our record of an invoice with LND's view of
+// it. Status and the settlement fields come from the node, so they show a
+// payment as soon as it lands; Settled only turns true once the payment is
+// recorded here and its booking confirmed.
+type lightningPaymentStatus struct {
+	LightningInvoice
+	Status      string             `json:"status"`
+	AmtPaidSats int64              `json:"amt_paid_sats,omitempty"`
+	SettleDate  *apitypes.JSONTime `json:"settle_date,omitempty"`
+}
+
+// lightningStatus is inv's state at now. LND cancels unpaid invoices once
+// they expire, but may not have got to it yet.
+func lightningStatus(inv LNDInvoice, now time.Time) string {
+	switch {
+	case inv.Settled:
+		return LightningSettled
+	case inv.State == "CANCELED", !inv.ExpiresAt.IsZero() && !now.Before(inv.ExpiresAt):
+		return LightningExpired
+	default:
+		return LightningPending
+	}
+}
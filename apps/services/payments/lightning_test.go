@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeLND is a Lightning node whose ledger the test writes directly.
+type fakeLND struct {
+	invoices []LNDInvoice
+	err      error
+	// paid and sent are the payment requests paid and on-chain sends made.
+	paid []string
+	sent []string
+	// addresses counts on-chain addresses handed out; txs are the wallet's
+	// on-chain transactions.
+	addresses int
+	txs       []LNDTransaction
+}
+
+func (f *fakeLND) NewAddress(context.Context) (string, error) {
+	f.addresses++
+	return fmt.Sprintf("bc1qtest%d", f.addresses), f.err
+}
+
+func (f *fakeLND) OnchainTransactions(context.Context) ([]LNDTransaction, error) {
+	return f.txs, f.err
+}
+
+func (f *fakeLND) PayInvoice(_ context.Context, paymentRequest string) (string, error) {
+	f.paid = append(f.paid, paymentRequest)
+	return hex.EncodeToString([]byte(paymentRequest)), f.err
+}
+
+// DecodePayReq reads the "lnbc<sats>" payment requests the fake issues.
+func (f *fakeLND) DecodePayReq(_ context.Context, paymentRequest string) (LNDPayReq, error) {
+	sats, err := strconv.ParseInt(strings.TrimPrefix(paymentRequest, "lnbc"), 10, 64)
+	if err != nil {
+		return LNDPayReq{}, fmt.Errorf("not a payment request: %q", paymentRequest)
+	}
+	return LNDPayReq{PaymentHash: hex.EncodeToString([]byte(paymentRequest)), AmountSats: sats}, f.err
+}
+
+func (f *fakeLND) SendCoins(_ context.Context, addr string, amountSats int64) (string, error) {
+	f.sent = append(f.sent, fmt.Sprintf("%s:%d", addr, amountSats))
+	return "tx-" + addr, f.err
+}
+
+func (f *fakeLND) AddInvoice(_ context.Context, valueSats int64, memo string, _ time.Duration) (LNDInvoice, error) {
+	inv := LNDInvoice{
+		RHash:          hex.EncodeToString([]byte{byte(len(f.invoices) + 1)}),
+		PaymentRequest: "lnbc" + strconv.FormatInt(valueSats, 10),
+		Memo:           memo,
+		ValueSats:      valueSats,
+	}
+	f.invoices = append(f.invoices, inv)
+	return inv, f.err
+}
+
+func (f *fakeLND) SettledInvoices(_ context.Context, from, to time.Time) ([]LNDInvoice, error) {
+	var out []LNDInvoice
+	for _, inv := range f.invoices {
+		if inv.Settled && !inv.SettledAt.Before(from) && inv.SettledAt.Before(to) {
+			out = append(out, inv)
+		}
+	}
+	return out, f.err
+}
+
+func (f *fakeLND) LookupInvoice(_ context.Context, rHash string) (LNDInvoice, error) {
+	if f.err != nil {
+		return LNDInvoice{}, f.err
+	}
+	for _, inv := range f.invoices {
+		if inv.RHash == rHash {
+			return inv, nil
+		}
+	}
+	return LNDInvoice{}, ErrLNDInvoiceNotFound
+}
+
+func (f *fakeLND) settle(rHash string, paidSats int64, at time.Time) {
+	for i := range f.invoices {
+		if f.invoices[i].RHash == rHash {
+			f.invoices[i].Settled, f.invoices[i].AmtPaidSats, f.invoices[i].SettledAt = true, paidSats, at
+			return
+		}
+	}
+	f.invoices = append(f.invoices, LNDInvoice{RHash: rHash, ValueSats: paidSats, AmtPaidSats: paidSats, Settled: true, SettledAt: at})
+}
+
+func newLightningTestServer(t *testing.T) (*server, *fakeLND) {
+	t.Helper()
+	s := newTestServer(t)
+	lnd := &fakeLND{}
+	s.lnd = lnd
+	return s, lnd
+}
+
+func createInvoice(t *testing.T, s *server, bookingID string, sats, cents int64) LightningInvoice {
+	t.Helper()
+	var inv LightningInvoice
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/invoice", map[string]interface{}{
+		"booking_id": bookingID, "category": CategoryTours, "amount_sats": sats, "amount_cents": cents,
+	}, &inv)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create invoice: status %d: %s", rec.Code, rec.Body)
+	}
+	return inv
+}
+
+func TestCreateLightningInvoice(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.cfg.LightningMaxInvoiceSats = 5_000_000
+	var inv LightningInvoice
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/invoice", map[string]interface{}{
+		"booking_id": "bk_1", "amount_sats": 5_000_000, "amount_cents": 300000, "memo": "Volcano hike, 2 guests",
+	}, &inv)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if inv.PaymentRequest != "lnbc5000000" || inv.RHash == "" || inv.Memo != "Volcano hike, 2 guests" || lnd.invoices[0].Memo != inv.Memo {
+		t.Fatalf("invoice %+v", inv)
+	}
+	if !inv.ExpiresAt.Equal(inv.CreatedAt.Add(lightningInvoiceExpiry)) {
+		t.Fatalf("expires at %s, want an hour after %s", inv.ExpiresAt, inv.CreatedAt)
+	}
+
+	for name, body := range map[string]map[string]interface{}{
+		"over the cap":  {"booking_id": "bk_2", "amount_sats": 5_000_001, "amount_cents": 300001},
+		"zero amount":   {"booking_id": "bk_2", "amount_sats": 0, "amount_cents": 100},
+		"memo too long": {"booking_id": "bk_2", "amount_sats": 1000, "amount_cents": 100, "memo": strings.Repeat("x", lndMaxMemoBytes+1)},
+	} {
+		var resp map[string]string
+		if rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/invoice", body, &resp); rec.Code != http.StatusBadRequest || resp["error"] != "invalid_invoice" {
+			t.Errorf("%s: status %d %v, want 400 invalid_invoice", name, rec.Code, resp)
+		}
+	}
+	if len(lnd.invoices) != 1 {
+		t.Fatalf("%d invoices asked of the node, want 1", len(lnd.invoices))
+	}
+}
+
+type reconcileResponse struct {
+	AutoConfirm    bool                    `json:"auto_confirm"`
+	Reconciliation lightningReconciliation `json:"reconciliation"`
+}
+
+func reconcile(t *testing.T, s *server, query string) reconcileResponse {
+	t.Helper()
+	var got reconcileResponse
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/reconcile?"+query, nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reconcile: status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func byKind(ds []lightningDiscrepancy) map[string]lightningDiscrepancy {
+	out := make(map[string]lightningDiscrepancy, len(ds))
+	for _, d := range ds {
+		out[d.Kind] = d
+	}
+	return out
+}
+
+func checkInvoice(t *testing.T, s *server, rHash string) (lightningPaymentStatus, *httptest.ResponseRecorder) {
+	t.Helper()
+	var status lightningPaymentStatus
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/payments/lightning/invoice/"+rHash, nil))
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body, err)
+		}
+	}
+	return status, rec
+}
+
+func TestCheckLightningPaymentAsksNode(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	paid := createInvoice(t, s, "bk_paid", 20000, 1200)
+	cancelled := createInvoice(t, s, "bk_cancelled", 20000, 1200)
+	lapsed := createInvoice(t, s, "bk_lapsed", 20000, 1200)
+	lnd.invoices[1].State = "CANCELED"
+	lnd.invoices[2].ExpiresAt = s.now().Add(-time.Minute)
+
+	if got, rec := checkInvoice(t, s, paid.RHash); rec.Code != http.StatusOK || got.Status != LightningPending || got.AmtPaidSats != 0 || got.SettleDate != nil {
+		t.Fatalf("before payment: status %d %+v, want pending", rec.Code, got)
+	}
+	settledAt := time.Date(2026, 5, 1, 11, 58, 30, 0, time.UTC)
+	lnd.settle(paid.RHash, 20000, settledAt)
+	got, rec := checkInvoice(t, s, paid.RHash)
+	if rec.Code != http.StatusOK || got.Status != LightningSettled || got.AmtPaidSats != 20000 || got.BookingID != "bk_paid" {
+		t.Fatalf("after payment: status %d %+v, want settled for 20000", rec.Code, got)
+	}
+	var raw map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &raw)
+	if raw["settle_date"] != "2026-05-01T11:58:30Z" {
+		t.Fatalf("settle_date = %v, want RFC 3339", raw["settle_date"])
+	}
+
+	for _, inv := range []LightningInvoice{cancelled, lapsed} {
+		if got, rec := checkInvoice(t, s, inv.RHash); rec.Code != http.StatusOK || got.Status != LightningExpired {
+			t.Errorf("%s: status %d %+v, want expired", inv.BookingID, rec.Code, got)
+		}
+	}
+	// Past our own record's expiry with nothing from the node.
+	s.now = func() time.Time { return paid.ExpiresAt.Add(time.Second) }
+	lnd.invoices[1].State = ""
+	if got, _ := checkInvoice(t, s, cancelled.RHash); got.Status != LightningExpired {
+		t.Errorf("past expiry: %+v, want expired", got)
+	}
+
+	if _, rec := checkInvoice(t, s, "abcdef"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown invoice: status %d, want 404", rec.Code)
+	}
+	lnd.invoices = lnd.invoices[1:]
+	if _, rec := checkInvoice(t, s, paid.RHash); rec.Code != http.StatusNotFound {
+		t.Errorf("invoice LND has lost: status %d, want 404", rec.Code)
+	}
+	lnd.err = errors.New("connection refused")
+	if _, rec := checkInvoice(t, s, cancelled.RHash); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("node down: status %d, want 503", rec.Code)
+	}
+}
+
+// seedLightningLedger leaves LND and our records disagreeing in every way:
+// one invoice matches, one LND settled that we never issued, one LND settled
+// that we still hold open, and one we marked settled that LND never did.
+func seedLightningLedger(t *testing.T, s *server, lnd *fakeLND) (matched, pending, missing LightningInvoice) {
+	t.Helper()
+	at := time.Date(2026, 4, 20, 9, 0, 0, 0, time.UTC)
+	matched = createInvoice(t, s, "bk_matched", 20000, 1200)
+	pending = createInvoice(t, s, "bk_pending", 30000, 1800)
+	missing = createInvoice(t, s, "bk_missing", 10000, 600)
+
+	lnd.settle(matched.RHash, 20000, at)
+	s.invoices.MarkSettled(matched.RHash, at)
+	lnd.settle(pending.RHash, 30000, at.Add(time.Hour))
+	lnd.settle("ff00", 5000, at.Add(2*time.Hour))
+	s.invoices.MarkSettled(missing.RHash, at.Add(3*time.Hour))
+	return matched, pending, missing
+}
+
+func TestReconcileLightningReportsDiscrepancies(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	_, pending, missing := seedLightningLedger(t, s, lnd)
+
+	got := reconcile(t, s, "from=2026-04-01&to=2026-04-30").Reconciliation
+	if got.LNDSettled != 3 || got.Matched != 1 || got.Confirmed != 0 || len(got.Discrepancies) != 3 {
+		t.Fatalf("reconciliation = %+v", got)
+	}
+	kinds := byKind(got.Discrepancies)
+	if d := kinds[DiscrepancyUnknownInvoice]; d.RHash != "ff00" || d.PaidSats != 5000 {
+		t.Fatalf("unknown invoice = %+v", d)
+	}
+	if d := kinds[DiscrepancyUnsettledHere]; d.RHash != pending.RHash || d.BookingID != "bk_pending" || d.Action != "" {
+		t.Fatalf("pending invoice = %+v", d)
+	}
+	if d := kinds[DiscrepancyNotSettledInLND]; d.RHash != missing.RHash || d.BookingID != "bk_missing" {
+		t.Fatalf("missing invoice = %+v", d)
+	}
+	// Without auto_confirm nothing changes.
+	if inv, _ := s.invoices.Get(pending.RHash); inv.Settled {
+		t.Fatal("pending invoice settled without auto_confirm")
+	}
+	if _, err := s.ledger.Payment(pending.RHash); !errors.Is(err, ErrPaymentNotFound) {
+		t.Fatalf("ledger payment err = %v, want none recorded", err)
+	}
+}
+
+func TestReconcileLightningAutoConfirmsPendingBookings(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	_, pending, _ := seedLightningLedger(t, s, lnd)
+
+	got := reconcile(t, s, "from=2026-04-01&to=2026-04-30&auto_confirm=true").Reconciliation
+	if got.Confirmed != 1 {
+		t.Fatalf("confirmed = %d, want 1", got.Confirmed)
+	}
+	if d := byKind(got.Discrepancies)[DiscrepancyUnsettledHere]; d.Action != "confirmed" {
+		t.Fatalf("pending invoice = %+v", d)
+	}
+	notice := s.bookings.(*fakeBookings).payments["bk_pending"]
+	if notice.PaymentRef != pending.RHash || notice.AmountCents != 1800 {
+		t.Fatalf("booking notice = %+v", notice)
+	}
+	p, err := s.ledger.Payment(pending.RHash)
+	if err != nil || p.Rail != string(RailLightning) || p.GrossCents != 1800 {
+		t.Fatalf("ledger payment = %+v, %v", p, err)
+	}
+	// The unknown invoice is only reported: there is no booking to confirm.
+	if _, ok := s.bookings.(*fakeBookings).payments[""]; ok {
+		t.Fatal("confirmed a booking for an unknown invoice")
+	}
+
+	// A second run finds the pending invoice matched.
+	again := reconcile(t, s, "from=2026-04-01&to=2026-04-30&auto_confirm=true").Reconciliation
+	if again.Matched != 2 || again.Confirmed != 0 || len(again.Discrepancies) != 2 {
+		t.Fatalf("second run = %+v", again)
+	}
+}
+
+func TestReconcileLightningNeverConfirmsUnderpayment(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	inv := createInvoice(t, s, "bk_short", 30000, 1800)
+	lnd.settle(inv.RHash, 29000, time.Date(2026, 4, 20, 9, 0, 0, 0, time.UTC))
+
+	got := reconcile(t, s, "from=2026-04-01&to=2026-04-30&auto_confirm=true").Reconciliation
+	if d := byKind(got.Discrepancies)[DiscrepancyUnderpaid]; d.RHash != inv.RHash || d.PaidSats != 29000 || d.Action != "" {
+		t.Fatalf("discrepancies = %+v", got.Discrepancies)
+	}
+	if len(s.bookings.(*fakeBookings).payments) != 0 {
+		t.Fatal("underpaid booking was confirmed")
+	}
+}
+
+func TestReconcileLightningReportsFailedConfirmation(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.bookings = &fakeBookings{err: errors.New("bookings down")}
+	inv := createInvoice(t, s, "bk_pending", 30000, 1800)
+	lnd.settle(inv.RHash, 30000, time.Date(2026, 4, 20, 9, 0, 0, 0, time.UTC))
+
+	got := reconcile(t, s, "from=2026-04-01&to=2026-04-30&auto_confirm=true").Reconciliation
+	d := byKind(got.Discrepancies)[DiscrepancyUnsettledHere]
+	if d.Action != "confirm_failed" || d.ActionError == "" {
+		t.Fatalf("discrepancy = %+v", d)
+	}
+	if stored, _ := s.invoices.Get(inv.RHash); stored.Settled {
+		t.Fatal("invoice marked settled although the booking was not confirmed")
+	}
+}
+
+func TestReconcileLightningRequiresNodeAndAdmin(t *testing.T) {
+	s := newTestServer(t)
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/reconcile?from=2026-04-01&to=2026-04-30", nil, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without node: status %d, want 503", rec.Code)
+	}
+
+	s, _ = newLightningTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/lightning/reconcile?from=2026-04-01&to=2026-04-30", nil)
+	rec = httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without credentials: status %d, want 401", rec.Code)
+	}
+}
+
+func TestLNDClientPagesSettledInvoices(t *testing.T) {
+	from := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	var pages int
+	c := startFakeLND(t, func(call lndCall) (interface{}, error) {
+		var req lnrpcListInvoiceRequest
+		if err := call.Recv(&req); err != nil {
+			return nil, err
+		}
+		if call.Method != "ListInvoices" || req.NumMaxInvoices != lndInvoicePage {
+			return nil, status.Errorf(codes.InvalidArgument, "%s %+v", call.Method, req)
+		}
+		pages++
+		var page lnrpcListInvoiceResponse
+		for i := int(req.IndexOffset); i < int(req.IndexOffset)+lndInvoicePage && i < lndInvoicePage+3; i++ {
+			settle := from.Add(time.Duration(i) * time.Minute)
+			var state int32 = 1 // SETTLED
+			if i%2 == 1 {
+				state = 0 // OPEN
+			}
+			if i == lndInvoicePage+2 {
+				settle = to // outside the window
+			}
+			page.Invoices = append(page.Invoices, lnrpcInvoice{
+				RHash: []byte{byte(i >> 8), byte(i)}, Value: 1000, AmtPaidSat: 1000, State: state, SettleDate: settle.Unix(),
+			})
+		}
+		page.LastIndexOffset = req.IndexOffset + uint64(len(page.Invoices))
+		return &page, nil
+	})
+
+	got, err := c.SettledInvoices(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 {
+		t.Fatalf("fetched %d pages, want 2", pages)
+	}
+	// Even indexes settle, and 502 settles after the window.
+	if len(got) != lndInvoicePage/2+1 {
+		t.Fatalf("got %d settled invoices, want %d", len(got), lndInvoicePage/2+1)
+	}
+	if got[0].RHash != "0000" || got[1].RHash != "0002" || got[0].AmtPaidSats != 1000 {
+		t.Fatalf("first invoices = %+v", got[:2])
+	}
+}
+
+func TestLNDClientLooksUpInvoice(t *testing.T) {
+	created := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := startFakeLND(t, func(call lndCall) (interface{}, error) {
+		var req lnrpcPaymentHash
+		if err := call.Recv(&req); err != nil {
+			return nil, err
+		}
+		switch hex.EncodeToString(req.RHash) {
+		case "0a0b":
+			return &lnrpcInvoice{
+				RHash: req.RHash, Value: 1000, AmtPaidSat: 1000, State: 1,
+				CreationDate: created.Unix(), SettleDate: created.Add(time.Minute).Unix(), Expiry: 3600,
+			}, nil
+		case "0c0d":
+			return nil, status.Error(codes.NotFound, "there are no existing invoices")
+		default:
+			// Older LND reports an unknown hash as an unknown error.
+			return nil, status.Error(codes.Unknown, "unable to locate invoice")
+		}
+	})
+
+	inv, err := c.LookupInvoice(context.Background(), "0a0b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.RHash != "0a0b" || !inv.Settled || inv.State != "SETTLED" || inv.AmtPaidSats != 1000 ||
+		!inv.SettledAt.Equal(created.Add(time.Minute)) || !inv.ExpiresAt.Equal(created.Add(time.Hour)) {
+		t.Fatalf("invoice = %+v", inv)
+	}
+	for _, hash := range []string{"0c0d", "0e0f"} {
+		if _, err := c.LookupInvoice(context.Background(), hash); !errors.Is(err, ErrLNDInvoiceNotFound) {
+			t.Errorf("%s: err = %v, want ErrLNDInvoiceNotFound", hash, err)
+		}
+	}
+}
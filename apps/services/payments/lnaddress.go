@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+)
+
+var (
+	ErrInvalidLightningAddress = errors.New("lightning address must look like name@domain")
+	ErrNoLightningAddress      = errors.New("guest has no saved lightning address")
+)
+
+// lightningAddressPattern is a Lightning Address (LUD-16): a lowercase
+// username and a domain, optionally with a port.
+var lightningAddressPattern = regexp.MustCompile(`^([a-z0-9\-_.+]+)@([a-z0-9\-.]+\.[a-z]{2,}|[a-z0-9\-.]+:\d+)$`)
+
+// SavedLightningAddress is where a guest wants Lightning refunds sent.
+type SavedLightningAddress struct {
+	GuestEmail       string            `json:"guest_email"`
+	LightningAddress string            `json:"lightning_address"`
+	SavedAt          apitypes.JSONTime `json:"saved_at"`
+}
+
+// refundAddresses holds guests' saved Lightning Addresses by lowercased
+// email.
+type refundAddresses struct {
+	mu      sync.Mutex
+	byGuest map[string]SavedLightningAddress
+}
+
+func newRefundAddresses() *refundAddresses {
+	return &refundAddresses{byGuest: make(map[string]SavedLightningAddress)}
+}
+
+func (a *refundAddresses) Put(saved SavedLightningAddress) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.byGuest[strings.ToLower(saved.GuestEmail)] = saved
+}
+
+func (a *refundAddresses) Get(guestEmail string) (SavedLightningAddress, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	saved, ok := a.byGuest[strings.ToLower(guestEmail)]
+	if !ok {
+		return SavedLightningAddress{}, ErrNoLightningAddress
+	}
+	return saved, nil
+}
+
+func (a *refundAddresses) Delete(guestEmail string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := strings.ToLower(guestEmail)
+	if _, ok := a.byGuest[key]; !ok {
+		return ErrNoLightningAddress
+	}
+	delete(a.byGuest, key)
+	return nil
+}
+
+// normalizeLightningAddress lowercases and checks a Lightning Address.
+func normalizeLightningAddress(addr string) (string, error) {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	if !lightningAddressPattern.MatchString(addr) {
+		return "", ErrInvalidLightningAddress
+	}
+	return addr, nil
+}
+
+// lnurlResolver turns a Lightning Address into a payable invoice through
+// the LNURL-pay flow (LUD-06 and LUD-16).
+type lnurlResolver struct {
+	client *outbound.Client
+	// scheme is https in production; tests serve plain http.
+	scheme string
+}
+
+func newLNURLResolver() *lnurlResolver {
+	return &lnurlResolver{client: outbound.NewClient("lnurl", 10*time.Second), scheme: "https"}
+}
+
+// lnurlPayParams is the wallet's answer to the well-known lookup. Amounts are
+// in millisatoshis.
+type lnurlPayParams struct {
+	Tag         string `json:"tag"`
+	Callback    string `json:"callback"`
+	MinSendable int64  `json:"minSendable"`
+	MaxSendable int64  `json:"maxSendable"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+}
+
+// Resolve asks the wallet behind addr for an invoice of amountSats and
+// returns its payment request.
+func (l *lnurlResolver) Resolve(ctx context.Context, addr string, amountSats int64) (string, error) {
+	addr, err := normalizeLightningAddress(addr)
+	if err != nil {
+		return "", err
+	}
+	user, domain, _ := strings.Cut(addr, "@")
+	var params lnurlPayParams
+	if err := l.get(ctx, l.scheme+"://"+domain+"/.well-known/lnurlp/"+url.PathEscape(user), &params); err != nil {
+		return "", err
+	}
+	if params.Status == "ERROR" {
+		return "", fmt.Errorf("lnurl %s: %s", addr, params.Reason)
+	}
+	if params.Tag != "payRequest" || params.Callback == "" {
+		return "", fmt.Errorf("lnurl %s: not a pay request", addr)
+	}
+	msats := amountSats * 1000
+	if msats < params.MinSendable || (params.MaxSendable > 0 && msats > params.MaxSendable) {
+		return "", fmt.Errorf("lnurl %s: accepts %d to %d msats, not %d", addr, params.MinSendable, params.MaxSendable, msats)
+	}
+
+	callback, err := url.Parse(params.Callback)
+	if err != nil {
+		return "", fmt.Errorf("lnurl %s: callback: %w", addr, err)
+	}
+	q := callback.Query()
+	q.Set("amount", strconv.FormatInt(msats, 10))
+	callback.RawQuery = q.Encode()
+	var invoice struct {
+		PR     string `json:"pr"`
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := l.get(ctx, callback.String(), &invoice); err != nil {
+		return "", err
+	}
+	if invoice.Status == "ERROR" || invoice.PR == "" {
+		return "", fmt.Errorf("lnurl %s: no invoice: %s", addr, invoice.Reason)
+	}
+	return invoice.PR, nil
+}
+
+func (l *lnurlResolver) get(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lnurl %s: unexpected status %d", req.URL.Host, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("lnurl %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+// bech32Charset is the bech32 alphabet (BIP 173).
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// encodeLNURL bech32-encodes u as an LNURL (LUD-01), upper-cased so it
+// packs densely into a QR code. LNURLs exceed BIP 173's 90 character limit,
+// which wallets ignore for them.
+func encodeLNURL(u string) string {
+	// Regroup the URL's bytes into 5-bit words.
+	var data []byte
+	acc, bits := uint32(0), uint(0)
+	for _, b := range []byte(u) {
+		acc = (acc<<8 | uint32(b)) & 0xfff
+		for bits += 8; bits >= 5; {
+			bits -= 5
+			data = append(data, byte(acc>>bits)&31)
+		}
+	}
+	if bits > 0 {
+		data = append(data, byte(acc<<(5-bits))&31)
+	}
+
+	const hrp = "lnurl"
+	var values []byte
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	values = append(append(values, data...), 0, 0, 0, 0, 0, 0)
+	checksum := bech32Polymod(values) ^ 1
+
+	var b strings.Builder
+	b.WriteString(hrp + "1")
+	for _, d := range data {
+		b.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[(checksum>>uint(5*(5-i)))&31])
+	}
+	return strings.ToUpper(b.String())
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// putLightningAddressHandler saves where a guest's Lightning refunds go.
+// Body: {"lightning_address": "name@wallet.example"}.
+func (s *server) putLightningAddressHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		LightningAddress string `json:"lightning_address"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	addr, err := normalizeLightningAddress(req.LightningAddress)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_lightning_address", err.Error())
+		return
+	}
+	saved := SavedLightningAddress{GuestEmail: chi.URLParam(r, "guestEmail"), LightningAddress: addr, SavedAt: apitypes.JSONTime{Time: s.now()}}
+	s.refundAddresses.Put(saved)
+	respondJSON(w, http.StatusOK, saved)
+}
+
+func (s *server) getLightningAddressHandler(w http.ResponseWriter, r *http.Request) {
+	saved, err := s.refundAddresses.Get(chi.URLParam(r, "guestEmail"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "lightning_address_not_found", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, saved)
+}
+
+func (s *server) deleteLightningAddressHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.refundAddresses.Delete(chi.URLParam(r, "guestEmail")); err != nil {
+		respondError(w, http.StatusNotFound, "lightning_address_not_found", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
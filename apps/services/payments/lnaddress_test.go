@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeWallet serves the LNURL-pay flow for alice, recording the amounts it
+// was asked to invoice.
+type fakeWallet struct {
+	srv     *httptest.Server
+	amounts []string
+}
+
+func newFakeWallet(t *testing.T) *fakeWallet {
+	t.Helper()
+	w := &fakeWallet{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/lnurlp/alice", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(lnurlPayParams{
+			Tag:         "payRequest",
+			Callback:    w.srv.URL + "/lnurlp/alice/callback",
+			MinSendable: 1000,
+			MaxSendable: 100_000_000,
+		})
+	})
+	mux.HandleFunc("/lnurlp/alice/callback", func(rw http.ResponseWriter, r *http.Request) {
+		w.amounts = append(w.amounts, r.URL.Query().Get("amount"))
+		json.NewEncoder(rw).Encode(map[string]interface{}{"pr": "lnbc-refund-" + r.URL.Query().Get("amount"), "routes": []string{}})
+	})
+	w.srv = httptest.NewServer(mux)
+	t.Cleanup(w.srv.Close)
+	return w
+}
+
+// address is alice's Lightning Address at the fake wallet.
+func (w *fakeWallet) address() string {
+	return "alice@" + strings.TrimPrefix(w.srv.URL, "http://")
+}
+
+func testResolver() *lnurlResolver {
+	l := newLNURLResolver()
+	l.scheme = "http"
+	return l
+}
+
+func TestResolveLightningAddress(t *testing.T) {
+	wallet := newFakeWallet(t)
+	pr, err := testResolver().Resolve(context.Background(), wallet.address(), 2500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr != "lnbc-refund-2500000" || len(wallet.amounts) != 1 {
+		t.Fatalf("invoice %q after amounts %v, want one for 2500000 msats", pr, wallet.amounts)
+	}
+
+	if _, err := testResolver().Resolve(context.Background(), "bob@"+strings.TrimPrefix(wallet.srv.URL, "http://"), 2500); err == nil {
+		t.Fatal("resolved an address the wallet does not know")
+	}
+	if _, err := testResolver().Resolve(context.Background(), "not-an-address", 2500); err != ErrInvalidLightningAddress {
+		t.Fatalf("err = %v, want ErrInvalidLightningAddress", err)
+	}
+}
+
+// paidByLightning books inv as settled.
+func paidByLightning(s *server, inv LightningInvoice) {
+	s.commitPayment(Payment{Ref: inv.RHash, BookingID: inv.BookingID, Category: CategoryTours, GrossCents: inv.AmountCents, Currency: "USD", Rail: string(RailLightning)})
+}
+
+func TestRefundPaysSavedLightningAddress(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.lnurl = testResolver()
+	wallet := newFakeWallet(t)
+	inv := createInvoice(t, s, "bk-ln", 100000, 5000)
+	paidByLightning(s, inv)
+
+	rec := doJSON(t, s.routes(), http.MethodPut, "/api/payments/guests/ana@example.com/lightning-address", map[string]string{"lightning_address": wallet.address()}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save: status %d: %s", rec.Code, rec.Body)
+	}
+	var saved SavedLightningAddress
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/guests/ANA@example.com/lightning-address", nil, &saved)
+	if saved.LightningAddress != wallet.address() {
+		t.Fatalf("saved = %+v", saved)
+	}
+
+	// Half the payment back, at the rate it was paid at.
+	var resp map[string]interface{}
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]string{
+		"payment_ref": inv.RHash, "amount": "25.00", "guest_email": "ana@example.com",
+	}, &resp)
+	if rec.Code != http.StatusOK || resp["amount_sats"] != float64(50000) || resp["rail"] != "lightning" || resp["lightning_address"] != nil {
+		t.Fatalf("status %d resp %v", rec.Code, resp)
+	}
+	if len(lnd.paid) != 1 || lnd.paid[0] != "lnbc-refund-50000000" {
+		t.Fatalf("paid %v, want the wallet's refund invoice", lnd.paid)
+	}
+	if left, _ := s.ledger.Refundable(inv.RHash); left != 2500 {
+		t.Fatalf("refundable = %d, want 2500", left)
+	}
+}
+
+func TestRefundWithUnreachableLightningAddressFails(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.lnurl = testResolver()
+	s.lnurl.client.MaxRetries = 0
+	wallet := newFakeWallet(t)
+	addr := wallet.address()
+	wallet.srv.Close()
+	inv := createInvoice(t, s, "bk-ln", 100000, 5000)
+	paidByLightning(s, inv)
+	doJSON(t, s.routes(), http.MethodPut, "/api/payments/guests/ana@example.com/lightning-address", map[string]string{"lightning_address": addr}, nil)
+
+	var resp map[string]interface{}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]string{
+		"payment_ref": inv.RHash, "amount": "50.00", "guest_email": "ana@example.com",
+	}, &resp)
+	if rec.Code != http.StatusBadGateway || resp["error"] != "refund_failed" {
+		t.Fatalf("status %d resp %v, want 502 refund_failed", rec.Code, resp)
+	}
+	if left, _ := s.ledger.Refundable(inv.RHash); len(lnd.paid) != 0 || left != 5000 {
+		t.Fatalf("paid %v refundable %d, want nothing sent or booked", lnd.paid, left)
+	}
+
+	// Without a saved address there is nowhere to send it.
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]string{
+		"payment_ref": inv.RHash, "amount": "50.00", "guest_email": "bea@example.com",
+	}, &resp)
+	if rec.Code != http.StatusConflict || resp["error"] != "refund_destination_required" {
+		t.Fatalf("no saved address: status %d resp %v, want 409", rec.Code, resp)
+	}
+}
+
+func TestLightningAddressValidationAndAdmin(t *testing.T) {
+	s := newTestServer(t)
+	rec := doJSON(t, s.routes(), http.MethodPut, "/api/payments/guests/ana@example.com/lightning-address", map[string]string{"lightning_address": "lnbc1invoice"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid address: status %d, want 400", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/payments/guests/ana@example.com/lightning-address", nil)
+	anon := httptest.NewRecorder()
+	s.routes().ServeHTTP(anon, req)
+	if anon.Code != http.StatusUnauthorized {
+		t.Fatalf("without admin key: status %d, want 401", anon.Code)
+	}
+}
+
+func TestEncodeLNURL(t *testing.T) {
+	// The example from LUD-01.
+	got := encodeLNURL("https://service.com/api?q=3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df")
+	want := "LNURL1DP68GURN8GHJ7UM9WFMXJCM99E3K7MF0V9CXJ0M385EKVCENXC6R2C35XVUKXEFCV5MKVV34X5EKZD3EV56NYD3HXQURZEPEXEJXXEPNXSCRVWFNV9NXZCN9XQ6XYEFHVGCXXCMYXYMNSERXFQ5FNS"
+	if got != want {
+		t.Fatalf("encodeLNURL = %s, want %s", got, want)
+	}
+}
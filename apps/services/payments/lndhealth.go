@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// RailReasonNodeUnavailable withholds the bitcoin rails while the Lightning
+// node is not answering.
+const RailReasonNodeUnavailable = "node_unavailable"
+
+// lndHealth remembers whether the Lightning node answered the last call made
+// to it. Calls are still attempted while it is down, so the first one that
+// succeeds marks it available again.
+type lndHealth struct {
+	mu      sync.Mutex
+	down    bool
+	since   time.Time
+	lastErr string
+}
+
+// observe records the outcome of a call to the node made at now.
+func (h *lndHealth) observe(err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if down := err != nil; down != h.down {
+		h.down, h.since = down, now
+	}
+	h.lastErr = ""
+	if err != nil {
+		h.lastErr = err.Error()
+	}
+}
+
+// Down reports whether the node failed its last call, since when and why.
+func (h *lndHealth) Down() (bool, time.Time, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.down, h.since, h.lastErr
+}
+
+// respondLightningUnavailable answers a Lightning request the node cannot
+// serve with a 503 that tells the frontend which rail, if any, to offer the
+// guest instead.
+func (s *server) respondLightningUnavailable(w http.ResponseWriter, message string) {
+	body := map[string]interface{}{
+		"error":              "lightning_unavailable",
+		"message":            message,
+		"fallback_available": s.cfg.LightningFallbackRail != "",
+	}
+	if s.cfg.LightningFallbackRail != "" {
+		body["fallback_rail"] = s.cfg.LightningFallbackRail
+	}
+	w.Header().Set("Retry-After", "30")
+	respondJSON(w, http.StatusServiceUnavailable, body)
+}
+
+// withholdRailsWhileNodeDown marks the bitcoin rails unavailable while the
+// Lightning node is down, leaving fiat rails as they were.
+func (s *server) withholdRailsWhileNodeDown(rails []RailAvailability) {
+	if down, _, _ := s.lndHealth.Down(); !down {
+		return
+	}
+	for i, a := range rails {
+		if btcRails[a.Rail] && a.Enabled {
+			rails[i] = RailAvailability{Rail: a.Rail, Reason: RailReasonNodeUnavailable, Message: "the Lightning node is not responding"}
+		}
+	}
+}
+
+// readyHandler reports whether the service and its optional dependencies
+// can take payments. The service stays up without Lightning, since card
+// payments still work, so a down node makes it "degraded" rather than
+// unready.
+func (s *server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	lightning := map[string]interface{}{"status": "ok"}
+	status := "ready"
+	if s.lnd == nil {
+		lightning["status"] = "not_configured"
+	} else if down, since, why := s.lndHealth.Down(); down {
+		status = "degraded"
+		lightning = map[string]interface{}{"status": "unavailable", "since": apitypes.JSONTime{Time: since}, "error": why}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  status,
+		"service": "payments",
+		"checks":  map[string]interface{}{"lightning": lightning},
+	})
+}
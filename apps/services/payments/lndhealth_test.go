@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+type readiness struct {
+	Status string `json:"status"`
+	Checks struct {
+		Lightning struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		} `json:"lightning"`
+	} `json:"checks"`
+}
+
+func ready(t *testing.T, s *server) readiness {
+	t.Helper()
+	var got readiness
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/ready", nil, &got); rec.Code != http.StatusOK {
+		t.Fatalf("ready: status %d: %s", rec.Code, rec.Body)
+	}
+	return got
+}
+
+func TestUnreachableLNDOffersFallback(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.cfg.LightningFallbackRail = string(RailCard)
+	if got := ready(t, s); got.Status != "ready" || got.Checks.Lightning.Status != "ok" {
+		t.Fatalf("readiness before outage = %+v", got)
+	}
+
+	lnd.err = errors.New("dial tcp 10.0.0.5:8080: connect: connection refused")
+	var body map[string]interface{}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/invoice", map[string]interface{}{
+		"booking_id": "bk-1", "amount_sats": 20000, "amount_cents": 1500,
+	}, &body)
+	if rec.Code != http.StatusServiceUnavailable || body["error"] != "lightning_unavailable" {
+		t.Fatalf("status %d: %v, want 503 lightning_unavailable", rec.Code, body)
+	}
+	if body["fallback_available"] != true || body["fallback_rail"] != "card" {
+		t.Fatalf("fallback = %v %v, want true card", body["fallback_available"], body["fallback_rail"])
+	}
+
+	got := ready(t, s)
+	if got.Status != "degraded" || got.Checks.Lightning.Status != "unavailable" || got.Checks.Lightning.Error == "" {
+		t.Fatalf("readiness during outage = %+v, want degraded with lightning unavailable", got)
+	}
+
+	// The node comes back: the next invoice succeeds and readiness recovers.
+	lnd.err = nil
+	createInvoice(t, s, "bk-1", 20000, 1500)
+	if got := ready(t, s); got.Status != "ready" {
+		t.Fatalf("readiness after recovery = %+v", got)
+	}
+}
+
+func TestRailsWithheldWhileLNDDown(t *testing.T) {
+	s := newRailsTestServer(t)
+	lnd := &fakeLND{}
+	s.lnd = lnd
+	lnd.err = errors.New("connection refused")
+	doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/invoice", map[string]interface{}{
+		"booking_id": "bk-1", "amount_sats": 20000, "amount_cents": 10000,
+	}, nil)
+
+	var got railsResponse
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?region=SV&amount=100.00", nil, &got)
+	if ln := got.rail(t, RailLightning); ln.Enabled || ln.Reason != RailReasonNodeUnavailable {
+		t.Fatalf("lightning = %+v, want node_unavailable", ln)
+	}
+	if card := got.rail(t, RailCard); !card.Enabled {
+		t.Fatalf("card = %+v, want enabled", card)
+	}
+}
+
+func TestNoFallbackRailConfigured(t *testing.T) {
+	s := newTestServer(t)
+	var body map[string]interface{}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/lightning/invoice", map[string]interface{}{
+		"booking_id": "bk-1", "amount_sats": 20000, "amount_cents": 1500,
+	}, &body)
+	if rec.Code != http.StatusServiceUnavailable || body["fallback_available"] != false {
+		t.Fatalf("status %d: %v, want 503 without fallback", rec.Code, body)
+	}
+	if _, ok := body["fallback_rail"]; ok {
+		t.Fatalf("fallback_rail = %v, want none", body["fallback_rail"])
+	}
+}
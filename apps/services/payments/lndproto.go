@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The lnrpc messages the payments service exchanges with LND, declared with
+// only the fields it reads or sets. Each field's protobuf tag carries its
+// field number in lnd's lightning.proto, and its JSON tag the name LND's
+// own JSON uses, so captured exchanges read like the node's.
+
+type lnrpcInvoice struct {
+	Memo           string `protobuf:"1" json:"memo,omitempty"`
+	RHash          []byte `protobuf:"4" json:"r_hash,omitempty"`
+	Value          int64  `protobuf:"5" json:"value,omitempty"`
+	CreationDate   int64  `protobuf:"7" json:"creation_date,omitempty"`
+	SettleDate     int64  `protobuf:"8" json:"settle_date,omitempty"`
+	PaymentRequest string `protobuf:"9" json:"payment_request,omitempty"`
+	Expiry         int64  `protobuf:"11" json:"expiry,omitempty"`
+	AmtPaidSat     int64  `protobuf:"19" json:"amt_paid_sat,omitempty"`
+	State          int32  `protobuf:"21" json:"state,omitempty"`
+}
+
+// lnrpcInvoiceStates names lnrpc.Invoice.InvoiceState values.
+var lnrpcInvoiceStates = map[int32]string{0: "OPEN", 1: "SETTLED", 2: "CANCELED", 3: "ACCEPTED"}
+
+type lnrpcAddInvoiceResponse struct {
+	RHash          []byte `protobuf:"1" json:"r_hash,omitempty"`
+	PaymentRequest string `protobuf:"2" json:"payment_request,omitempty"`
+	AddIndex       uint64 `protobuf:"16" json:"add_index,omitempty"`
+	PaymentAddr    []byte `protobuf:"17" json:"payment_addr,omitempty"`
+}
+
+type lnrpcListInvoiceRequest struct {
+	IndexOffset       uint64 `protobuf:"4" json:"index_offset,omitempty"`
+	NumMaxInvoices    uint64 `protobuf:"5" json:"num_max_invoices,omitempty"`
+	CreationDateStart uint64 `protobuf:"7" json:"creation_date_start,omitempty"`
+	CreationDateEnd   uint64 `protobuf:"8" json:"creation_date_end,omitempty"`
+}
+
+type lnrpcListInvoiceResponse struct {
+	Invoices        []lnrpcInvoice `protobuf:"1" json:"invoices,omitempty"`
+	LastIndexOffset uint64         `protobuf:"2" json:"last_index_offset,omitempty"`
+}
+
+type lnrpcPaymentHash struct {
+	RHash []byte `protobuf:"2" json:"r_hash,omitempty"`
+}
+
+type lnrpcSendRequest struct {
+	PaymentRequest string `protobuf:"6" json:"payment_request,omitempty"`
+}
+
+type lnrpcSendResponse struct {
+	PaymentError    string `protobuf:"1" json:"payment_error,omitempty"`
+	PaymentPreimage []byte `protobuf:"2" json:"payment_preimage,omitempty"`
+	PaymentHash     []byte `protobuf:"4" json:"payment_hash,omitempty"`
+}
+
+type lnrpcSendCoinsRequest struct {
+	Addr   string `protobuf:"1" json:"addr,omitempty"`
+	Amount int64  `protobuf:"2" json:"amount,omitempty"`
+}
+
+type lnrpcSendCoinsResponse struct {
+	Txid string `protobuf:"1" json:"txid,omitempty"`
+}
+
+// lnrpcNewAddressRequest asks for the default address type, a native
+// segwit (p2wkh) address.
+type lnrpcNewAddressRequest struct{}
+
+type lnrpcNewAddressResponse struct {
+	Address string `protobuf:"1" json:"address,omitempty"`
+}
+
+type lnrpcGetTransactionsRequest struct{}
+
+type lnrpcTransactionDetails struct {
+	Transactions []lnrpcTransaction `protobuf:"1" json:"transactions,omitempty"`
+}
+
+type lnrpcTransaction struct {
+	TxHash           string              `protobuf:"1" json:"tx_hash,omitempty"`
+	NumConfirmations int32               `protobuf:"3" json:"num_confirmations,omitempty"`
+	OutputDetails    []lnrpcOutputDetail `protobuf:"11" json:"output_details,omitempty"`
+}
+
+type lnrpcOutputDetail struct {
+	Address      string `protobuf:"2" json:"address,omitempty"`
+	Amount       int64  `protobuf:"5" json:"amount,omitempty"`
+	IsOurAddress bool   `protobuf:"6" json:"is_our_address,omitempty"`
+}
+
+type lnrpcPayReqString struct {
+	PayReq string `protobuf:"1" json:"pay_req,omitempty"`
+}
+
+type lnrpcPayReq struct {
+	PaymentHash string `protobuf:"2" json:"payment_hash,omitempty"`
+	NumSatoshis int64  `protobuf:"3" json:"num_satoshis,omitempty"`
+}
+
+// lndCodec encodes the lnrpc structs above in the protobuf wire format, so
+// the service speaks LND's gRPC API without generated code. It handles the
+// field kinds they use: strings, bytes, integers, bools and repeated
+// messages.
+type lndCodec struct{}
+
+func (lndCodec) Name() string { return "proto" }
+
+func (lndCodec) Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("lnd codec: cannot marshal %T", v)
+	}
+	return appendMessage(nil, rv.Elem())
+}
+
+func (lndCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("lnd codec: cannot unmarshal into %T", v)
+	}
+	return consumeMessage(data, rv.Elem())
+}
+
+// fieldNumber reads a struct field's protobuf tag.
+func fieldNumber(f reflect.StructField) (protowire.Number, bool) {
+	n, err := strconv.Atoi(f.Tag.Get("protobuf"))
+	return protowire.Number(n), err == nil
+}
+
+// appendMessage appends v's non-zero fields, as proto3 does.
+func appendMessage(b []byte, v reflect.Value) ([]byte, error) {
+	for i := 0; i < v.NumField(); i++ {
+		num, ok := fieldNumber(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			if f.Len() > 0 {
+				b = protowire.AppendTag(b, num, protowire.BytesType)
+				b = protowire.AppendString(b, f.String())
+			}
+		case reflect.Bool:
+			if f.Bool() {
+				b = protowire.AppendTag(b, num, protowire.VarintType)
+				b = protowire.AppendVarint(b, 1)
+			}
+		case reflect.Int32, reflect.Int64:
+			// Negative int32s are sign-extended to ten bytes, like int64s.
+			if f.Int() != 0 {
+				b = protowire.AppendTag(b, num, protowire.VarintType)
+				b = protowire.AppendVarint(b, uint64(f.Int()))
+			}
+		case reflect.Uint32, reflect.Uint64:
+			if f.Uint() != 0 {
+				b = protowire.AppendTag(b, num, protowire.VarintType)
+				b = protowire.AppendVarint(b, f.Uint())
+			}
+		case reflect.Slice:
+			if f.Type().Elem().Kind() == reflect.Uint8 {
+				if f.Len() > 0 {
+					b = protowire.AppendTag(b, num, protowire.BytesType)
+					b = protowire.AppendBytes(b, f.Bytes())
+				}
+				continue
+			}
+			for j := 0; j < f.Len(); j++ {
+				msg, err := appendMessage(nil, f.Index(j))
+				if err != nil {
+					return nil, err
+				}
+				b = protowire.AppendTag(b, num, protowire.BytesType)
+				b = protowire.AppendBytes(b, msg)
+			}
+		default:
+			return nil, fmt.Errorf("lnd codec: unsupported field %s", v.Type().Field(i).Name)
+		}
+	}
+	return b, nil
+}
+
+// consumeMessage decodes b into v. Fields v does not declare are skipped,
+// so newer LND versions can add to their messages.
+func consumeMessage(b []byte, v reflect.Value) error {
+	fields := make(map[protowire.Number]reflect.Value)
+	for i := 0; i < v.NumField(); i++ {
+		if num, ok := fieldNumber(v.Type().Field(i)); ok {
+			fields[num] = v.Field(i)
+		}
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		f, known := fields[num]
+		switch {
+		case known && typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch f.Kind() {
+			case reflect.Bool:
+				f.SetBool(x != 0)
+			case reflect.Int32, reflect.Int64:
+				f.SetInt(int64(x))
+			case reflect.Uint32, reflect.Uint64:
+				f.SetUint(x)
+			default:
+				return fmt.Errorf("lnd codec: field %d is not a varint", num)
+			}
+		case known && typ == protowire.BytesType:
+			x, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch {
+			case f.Kind() == reflect.String:
+				f.SetString(string(x))
+			case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+				f.SetBytes(append([]byte(nil), x...))
+			case f.Kind() == reflect.Slice:
+				elem := reflect.New(f.Type().Elem()).Elem()
+				if err := consumeMessage(x, elem); err != nil {
+					return err
+				}
+				f.Set(reflect.Append(f, elem))
+			default:
+				return fmt.Errorf("lnd codec: field %d is not length-delimited", num)
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
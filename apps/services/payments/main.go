@@ -10,49 +10,185 @@ High-concurrency payment processing microservice handling:
 package main
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
 )
 
+// server wires configuration and dependencies into the HTTP handlers.
+type server struct {
+	cfg       config
+	stripe    *stripeClient
+	bookings  BookingsClient
+	rates     RateClient
+	ledger    *Ledger
+	checkouts *checkoutStore
+	velocity  *velocityTracker
+	invoices  *lightningInvoices
+	onchain   *onchainPayments
+	transfers *bankTransfers
+	payouts   *foundationPayouts
+	disputes  *disputes
+	grants    *grants
+	// refundAddresses are guests' saved Lightning Addresses, resolved by
+	// lnurl into refund invoices.
+	refundAddresses *refundAddresses
+	lnurl           *lnurlResolver
+	// authorizations are manual-capture card payments awaiting capture.
+	authorizations *authorizations
+	// lnd is nil when no Lightning node is configured. lndHealth tracks
+	// whether it is answering.
+	lnd       LightningNode
+	lndHealth *lndHealth
+	// payloads keeps the redacted exchanges with Stripe and LND for
+	// support to debug payments with.
+	payloads *providerPayloads
+	shed     *httpkit.LoadShedder
+	now      func() time.Time
+
+	recomputeMu sync.Mutex
+	// refundMu serializes refunds so two requests for one payment cannot
+	// both pass the refundable check before either is booked.
+	refundMu sync.Mutex
+}
+
+func newServer(cfg config) *server {
+	if cfg.Tenants.Len() == 0 {
+		cfg.Tenants = tenantkit.New(tenantkit.DefaultID, builtinTenant)
+	}
+	s := &server{
+		cfg:       cfg,
+		stripe:    newStripeClient(cfg.StripeSecretKey, cfg.StripeAPIURL),
+		bookings:  newHTTPBookingsClient(cfg.BookingsServiceURL, cfg.BookingsServiceKey),
+		rates:     newHTTPRateClient(cfg.PricingServiceURL),
+		ledger:    NewLedger(),
+		checkouts: newCheckoutStore(),
+		velocity:  newVelocityTracker(),
+		invoices:  newLightningInvoices(),
+		onchain:   newOnchainPayments(),
+		transfers: newBankTransfers(),
+		payouts:   newFoundationPayouts(),
+		disputes:  newDisputes(),
+		grants:    newGrants(),
+		payloads:  newProviderPayloads(),
+		shed:      httpkit.NewLoadShedder(cfg.LoadShedding),
+		now:       time.Now,
+
+		lndHealth:       &lndHealth{},
+		refundAddresses: newRefundAddresses(),
+		lnurl:           newLNURLResolver(),
+		authorizations:  newAuthorizations(),
+	}
+	return s
+}
+
 func main() {
-	port := os.Getenv("PAYMENTS_SERVICE_PORT")
-	if port == "" {
-		port = "8001"
+	cfg := loadConfig()
+	tenants, err := loadTenants(cfg.TenantsFile, cfg.DefaultTenant)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.Tenants = tenants
+	if cfg.Foundation, err = loadFoundationPolicy(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
 	}
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	outbound.SetIntegrationLimits(cfg.IntegrationLimits)
+	s := newServer(cfg)
+	if cfg.LNDGRPCHost != "" {
+		lnd, err := newLNDClient(cfg.LNDGRPCHost, cfg.LNDTLSCertPath, cfg.LNDMacaroonPath)
+		if err != nil {
+			log.Fatalf("invalid configuration: %v", err)
+		}
+		s.lnd = lnd
+	}
+
+	log.Printf("🇸🇻 Payments service starting on port %s", cfg.Port)
+	if err := httpkit.Run(s.routes(), cfg.Port, cfg.HTTPTimeouts); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Payments service stopped")
+}
 
+func (s *server) routes() chi.Router {
 	r := chi.NewRouter()
 
 	// Middleware
+	r.Use(httpkit.RequestID(s.cfg.RequestIDHeader))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.RequestID)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:8000"},
+		AllowOriginFunc:  s.cfg.Tenants.AllowOrigin,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", tenantkit.Header},
 		AllowCredentials: true,
 	}))
+	if s.shed != nil {
+		r.Use(s.shed.Middleware)
+	}
+	httpkit.UseJSONErrors(r)
 
 	// Routes
 	r.Get("/health", healthHandler)
+	r.Get("/ready", s.readyHandler)
+	r.Handle("/metrics", promhttp.Handler())
+	r.With(s.requireAdmin).Get("/config", s.configHandler)
+	// Stripe names no tenant, so its webhook is verified before, and
+	// outside, tenant resolution; the event's metadata carries the tenant.
+	r.Post("/api/payments/webhook/stripe", s.stripeWebhookHandler)
 	r.Route("/api/payments", func(r chi.Router) {
-		r.Post("/checkout", createCheckoutHandler)
-		r.Post("/webhook/stripe", stripeWebhookHandler)
-		r.Post("/lightning/invoice", createLightningInvoiceHandler)
-		r.Get("/lightning/invoice/{invoiceId}", checkLightningPaymentHandler)
+		r.Use(s.cfg.Tenants.Middleware)
+		r.With(s.requireAdmin).Post("/checkout", s.createCheckoutHandler)
+		r.Get("/rails", s.getRailsHandler)
+		r.Get("/impact", s.impactHandler)
+		r.Get("/foundation/estimate", s.estimateFoundationHandler)
+		r.Get("/referrals/{code}", s.getReferralHandler)
+		r.Post("/orders/quote", s.quoteOrderHandler)
+		r.With(s.requireAdmin).Post("/refunds", s.createRefundHandler)
+		r.Post("/lightning/invoice", s.createLightningInvoiceHandler)
+		r.Get("/lightning/invoice/{invoiceId}", s.checkLightningPaymentHandler)
+		r.Post("/onchain/address", s.createOnchainPaymentHandler)
+		r.Get("/onchain/address/{address}", s.getOnchainPaymentHandler)
+		r.Post("/bank-transfer", s.createBankTransferHandler)
+		r.Get("/lnurlw/{k1}", s.lnurlWithdrawHandler)
+		r.Get("/lnurlw/{k1}/callback", s.lnurlWithdrawCallbackHandler)
+
+		// Admin operations
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireAdmin)
+			r.Post("/foundation/recompute", s.recomputeFoundationHandler)
+			r.Post("/foundation/simulate", s.simulateFoundationHandler)
+			r.Post("/foundation/payouts", s.payFoundationHandler)
+			r.Get("/foundation/payouts", s.listFoundationPayoutsHandler)
+			r.Post("/foundation/grants", s.disburseGrantHandler)
+			r.Get("/foundation/grants", s.listGrantsHandler)
+			r.Get("/disputes", s.listDisputesHandler)
+			r.Get("/daily-summary", s.dailySummaryHandler)
+			r.Get("/partners/{partnerId}/earnings", s.partnerEarningsHandler)
+			r.Post("/lightning/reconcile", s.reconcileLightningHandler)
+			r.Post("/onchain/check", s.checkOnchainPaymentsHandler)
+			r.Post("/bank-transfer/confirm", s.confirmBankTransfersHandler)
+			r.Put("/guests/{guestEmail}/lightning-address", s.putLightningAddressHandler)
+			r.Get("/guests/{guestEmail}/lightning-address", s.getLightningAddressHandler)
+			r.Delete("/guests/{guestEmail}/lightning-address", s.deleteLightningAddressHandler)
+			r.Get("/{paymentRef}/provider-payload", s.providerPayloadHandler)
+			r.Post("/{paymentRef}/capture", s.captureHandler)
+			r.Post("/{paymentRef}/void", s.voidHandler)
+		})
 	})
 
-	log.Printf("🇸🇻 Payments service starting on port %s", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), r); err != nil {
-		log.Fatal(err)
-	}
+	return r
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -62,42 +198,11 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func createCheckoutHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Create Stripe checkout session
-	// TODO: Calculate Foundation allocation
-	respondJSON(w, http.StatusOK, map[string]string{
-		"status": "checkout_created",
-	})
-}
-
-func stripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Verify Stripe webhook signature
-	// TODO: Process payment confirmation
-	// TODO: Allocate Foundation percentage
-	// TODO: Record impact transaction
-	respondJSON(w, http.StatusOK, map[string]string{
-		"status": "webhook_received",
-	})
-}
-
-func createLightningInvoiceHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Create Lightning Network invoice via LND
-	respondJSON(w, http.StatusOK, map[string]string{
-		"status": "lightning_invoice_created",
-	})
-}
-
-func checkLightningPaymentHandler(w http.ResponseWriter, r *http.Request) {
-	invoiceID := chi.URLParam(r, "invoiceId")
-	// TODO: Check Lightning payment status
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"invoice_id": invoiceID,
-		"status":     "pending",
-	})
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	httpkit.RespondJSON(w, status, data)
 }
 
-func respondJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+// respondError writes the standard error envelope.
+func respondError(w http.ResponseWriter, status int, code, message string) {
+	httpkit.RespondError(w, status, code, message)
 }
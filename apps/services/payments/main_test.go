@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+const (
+	testAdminKey      = "test-admin-key"
+	testWebhookSecret = "whsec_test"
+)
+
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	s := newServer(config{
+		AdminAPIKey:          testAdminKey,
+		StripeWebhookSecrets: []string{testWebhookSecret},
+		Foundation:           FoundationPolicy{DefaultRate: 15 * apitypes.OnePercent, CategoryRates: map[string]apitypes.Percent{}},
+	})
+	s.bookings = &fakeBookings{status: "confirmed"}
+	s.now = func() time.Time { return time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return s
+}
+
+// doJSON sends body (marshalled as JSON unless nil) with admin credentials
+// and decodes the response into out when out is non-nil.
+func doJSON(t *testing.T, h http.Handler, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+// fakeBookings records payments handed to the bookings service and answers
+// with a fixed status or error.
+type fakeBookings struct {
+	status string
+	err    error
+	// onPayment, when set, runs before RecordPayment answers, as the
+	// bookings service's own follow-up calls do.
+	onPayment func(bookingID string, n PaymentNotice)
+	payments  map[string]PaymentNotice
+	disputes  map[string][]DisputeNotice
+	failures  map[string][]PaymentFailureNotice
+}
+
+func (f *fakeBookings) RecordPayment(_ context.Context, bookingID string, n PaymentNotice) (string, error) {
+	if f.payments == nil {
+		f.payments = make(map[string]PaymentNotice)
+	}
+	f.payments[bookingID] = n
+	if f.onPayment != nil {
+		f.onPayment(bookingID, n)
+	}
+	return f.status, f.err
+}
+
+func (f *fakeBookings) RecordDispute(_ context.Context, bookingID string, n DisputeNotice) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if f.disputes == nil {
+		f.disputes = make(map[string][]DisputeNotice)
+	}
+	f.disputes[bookingID] = append(f.disputes[bookingID], n)
+	if n.Status == DisputeOpen {
+		return "disputed", nil
+	}
+	return f.status, nil
+}
+
+func (f *fakeBookings) RecordPaymentFailure(_ context.Context, bookingID string, n PaymentFailureNotice) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if f.failures == nil {
+		f.failures = make(map[string][]PaymentFailureNotice)
+	}
+	f.failures[bookingID] = append(f.failures[bookingID], n)
+	return "payment_failed", nil
+}
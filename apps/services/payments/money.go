@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidMoney = errors.New("invalid amount")
+
+// Money is an amount in the minor unit of its currency, e.g. cents for USD
+// or yen for JPY.
+type Money struct {
+	MinorUnits int64  `json:"amount_cents"`
+	Currency   string `json:"currency"`
+}
+
+// currencyDecimals lists currencies whose minor unit is not a hundredth.
+// Every other currency has two decimal places.
+var currencyDecimals = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"CLP": 0,
+	"PYG": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"JOD": 3,
+	"TND": 3,
+}
+
+// currencyPlaces returns how many decimal places currency allows.
+func currencyPlaces(currency string) int {
+	if places, ok := currencyDecimals[strings.ToUpper(currency)]; ok {
+		return places
+	}
+	return 2
+}
+
+// maxMoneyDigits bounds the whole part so the minor units fit an int64.
+const maxMoneyDigits = 13
+
+// ParseMoney reads a decimal amount such as "100", "100.5" or "100.50" in
+// currency. It is strict: the amount must be plain digits with an optional
+// point and at most the currency's decimal places, so negative amounts,
+// signs, exponents and excess precision are rejected rather than rounded.
+// The value is parsed as a decimal, never through a float.
+func ParseMoney(s, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	places := currencyPlaces(currency)
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-") {
+		return Money{}, fmt.Errorf("%w: amount must not be negative", ErrInvalidMoney)
+	}
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" || len(whole) > maxMoneyDigits || !allDigits(whole) || (hasPoint && (frac == "" || !allDigits(frac))) {
+		return Money{}, fmt.Errorf("%w: %q is not a decimal amount such as 100 or 100.00", ErrInvalidMoney, s)
+	}
+	if len(frac) > places {
+		return Money{}, fmt.Errorf("%w: %s allows at most %d decimal places", ErrInvalidMoney, currency, places)
+	}
+	units, _ := strconv.ParseInt(whole+frac+strings.Repeat("0", places-len(frac)), 10, 64)
+	return Money{MinorUnits: units, Currency: currency}, nil
+}
+
+func allDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
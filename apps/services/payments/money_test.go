@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseMoneyAcceptsDecimals(t *testing.T) {
+	for _, tc := range []struct {
+		in, currency string
+		units        int64
+	}{
+		{"100", "USD", 10000},
+		{"100.0", "USD", 10000},
+		{"100.00", "usd", 10000},
+		{"0.5", "USD", 50},
+		{"19.99", "EUR", 1999},
+		{"5000", "JPY", 5000},
+		{"1.234", "KWD", 1234},
+	} {
+		m, err := ParseMoney(tc.in, tc.currency)
+		if err != nil {
+			t.Fatalf("ParseMoney(%q, %s): %v", tc.in, tc.currency, err)
+		}
+		if m.MinorUnits != tc.units {
+			t.Errorf("ParseMoney(%q, %s) = %d, want %d", tc.in, tc.currency, m.MinorUnits, tc.units)
+		}
+	}
+}
+
+func TestParseMoneyRejectsOverPreciseAndMalformed(t *testing.T) {
+	for _, tc := range []struct{ in, currency string }{
+		{"100.001", "USD"},
+		{"100.5", "JPY"},
+		{"1e2", "USD"},
+		{"1.5E1", "USD"},
+		{"+100", "USD"},
+		{"100.", "USD"},
+		{".50", "USD"},
+		{"", "USD"},
+		{"1,000.00", "USD"},
+		{"99999999999999", "USD"},
+	} {
+		if m, err := ParseMoney(tc.in, tc.currency); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("ParseMoney(%q, %s) = %+v, %v; want ErrInvalidMoney", tc.in, tc.currency, m, err)
+		}
+	}
+}
+
+func TestParseMoneyRejectsNegative(t *testing.T) {
+	if m, err := ParseMoney("-25.00", "USD"); !errors.Is(err, ErrInvalidMoney) {
+		t.Fatalf("ParseMoney(-25.00) = %+v, %v; want ErrInvalidMoney", m, err)
+	}
+}
+
+func TestCheckoutAcceptsDecimalAmount(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	h := s.routes()
+
+	decimal := testCheckout
+	decimal.AmountCents, decimal.Amount = 0, "90.00"
+	if rec := postCheckout(t, h, "k1", decimal); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	// The same amount in cents is the same checkout.
+	if rec := postCheckout(t, h, "k1", testCheckout); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("cents replay: status %d: %s", rec.Code, rec.Body)
+	}
+	if stripe.created != 1 {
+		t.Fatalf("created = %d, want 1", stripe.created)
+	}
+
+	decimal.Amount = "90.001"
+	if rec := postCheckout(t, h, "k2", decimal); rec.Code != http.StatusBadRequest {
+		t.Fatalf("over-precise amount: status %d, want 400", rec.Code)
+	}
+}
+
+func TestRefundRejectsNegativeAmount(t *testing.T) {
+	s, _ := newCheckoutTestServer(t, 0)
+	paidByCard(t, s)
+	var resp map[string]interface{}
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]string{"payment_ref": "pi_test_1", "amount": "-5.00"}, &resp)
+	if rec.Code != http.StatusBadRequest || resp["error"] != "invalid_amount" {
+		t.Fatalf("status %d resp %v, want 400 invalid_amount", rec.Code, resp)
+	}
+	rec = doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]string{"payment_ref": "pi_test_1", "amount": "12.5"}, &resp)
+	if rec.Code != http.StatusOK || resp["amount_cents"] != float64(1250) {
+		t.Fatalf("status %d resp %v, want 200 for 1250 cents", rec.Code, resp)
+	}
+}
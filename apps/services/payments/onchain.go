@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var ErrOnchainPaymentNotFound = errors.New("on-chain payment not found")
+
+// States of an on-chain payment. A payment is confirming once its address
+// has received the full amount, and paid once that has the confirmations
+// its size requires.
+const (
+	OnchainAwaitingPayment = "awaiting_payment"
+	OnchainConfirming      = "confirming"
+	OnchainPaid            = "paid"
+)
+
+// ConfirmationTier requires Confirmations blocks for on-chain payments of at
+// least MinCents.
+type ConfirmationTier struct {
+	MinCents      int64
+	Confirmations int
+}
+
+// ConfirmationPolicy scales the confirmations an on-chain payment needs
+// with its size, so a large payment is harder to reverse. Tiers are sorted
+// by MinCents.
+type ConfirmationPolicy []ConfirmationTier
+
+// Required is the number of confirmations a payment of amountCents needs:
+// that of the largest tier it reaches, and at least one.
+func (p ConfirmationPolicy) Required(amountCents int64) int {
+	required := 1
+	for _, t := range p {
+		if amountCents >= t.MinCents {
+			required = t.Confirmations
+		}
+	}
+	return required
+}
+
+// loadConfirmationPolicy reads ONCHAIN_CONFIRMATION_TIERS, a list of
+// min_cents:confirmations tiers such as "0:1,50000:3,500000:6".
+func loadConfirmationPolicy() ConfirmationPolicy {
+	const fallback = "0:1,50000:3,500000:6"
+	p, err := parseConfirmationPolicy(envString("ONCHAIN_CONFIRMATION_TIERS", fallback))
+	if err != nil {
+		p, _ = parseConfirmationPolicy(fallback)
+	}
+	return p
+}
+
+func parseConfirmationPolicy(s string) (ConfirmationPolicy, error) {
+	var p ConfirmationPolicy
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		lower, confs, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("confirmation tier %q: want min_cents:confirmations", entry)
+		}
+		minCents, err := strconv.ParseInt(strings.TrimSpace(lower), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("confirmation tier %q: min_cents: %w", entry, err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(confs))
+		if err != nil {
+			return nil, fmt.Errorf("confirmation tier %q: confirmations: %w", entry, err)
+		}
+		p = append(p, ConfirmationTier{MinCents: minCents, Confirmations: n})
+	}
+	sort.Slice(p, func(i, j int) bool { return p[i].MinCents < p[j].MinCents })
+	return p, nil
+}
+
+// validate refuses tiers that would let a larger payment settle on fewer
+// confirmations than a smaller one.
+func (p ConfirmationPolicy) validate() error {
+	for i, t := range p {
+		if t.MinCents < 0 || t.Confirmations < 1 {
+			return fmt.Errorf("confirmation tier %d:%d: min_cents must not be negative and confirmations must be at least 1", t.MinCents, t.Confirmations)
+		}
+		if i > 0 && t.Confirmations < p[i-1].Confirmations {
+			return fmt.Errorf("confirmation tier %d:%d: requires fewer confirmations than smaller payments", t.MinCents, t.Confirmations)
+		}
+	}
+	return nil
+}
+
+// OnchainPayment is our record of an address issued for a booking to be
+// paid to on-chain. ReceivedSats and Confirmations are as last seen by
+// the node; a payment spread over several transactions is as confirmed as
+// the least confirmed of them.
+type OnchainPayment struct {
+	Address               string            `json:"address"`
+	Tenant                string            `json:"tenant,omitempty"`
+	BookingID             string            `json:"booking_id"`
+	Category              string            `json:"category,omitempty"`
+	AmountSats            int64             `json:"amount_sats"`
+	AmountCents           int64             `json:"amount_cents"`
+	RequiredConfirmations int               `json:"required_confirmations"`
+	Status                string            `json:"status"`
+	ReceivedSats          int64             `json:"received_sats"`
+	Confirmations         int               `json:"confirmations"`
+	TxIDs                 []string          `json:"txids,omitempty"`
+	CreatedAt             apitypes.JSONTime `json:"created_at"`
+	PaidAt                apitypes.JSONTime `json:"paid_at"`
+}
+
+// onchainPayments holds issued on-chain payments by address.
+type onchainPayments struct {
+	mu        sync.Mutex
+	byAddress map[string]*OnchainPayment
+}
+
+func newOnchainPayments() *onchainPayments {
+	return &onchainPayments{byAddress: make(map[string]*OnchainPayment)}
+}
+
+func (o *onchainPayments) Add(p OnchainPayment) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.byAddress[p.Address] = &p
+}
+
+func (o *onchainPayments) Get(address string) (OnchainPayment, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, ok := o.byAddress[address]
+	if !ok {
+		return OnchainPayment{}, ErrOnchainPaymentNotFound
+	}
+	return *p, nil
+}
+
+// Unpaid lists payments not yet paid, oldest first.
+func (o *onchainPayments) Unpaid() []OnchainPayment {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []OnchainPayment
+	for _, p := range o.byAddress {
+		if p.Status != OnchainPaid {
+			out = append(out, *p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt.Time) })
+	return out
+}
+
+// Update replaces the record of p.Address with p.
+func (o *onchainPayments) Update(p OnchainPayment) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.byAddress[p.Address]; ok {
+		o.byAddress[p.Address] = &p
+	}
+}
+
+// onchainCheck reports what one pass over the node's transactions found.
+type onchainCheck struct {
+	Checked   int              `json:"checked"`
+	Confirmed int              `json:"confirmed"`
+	Payments  []OnchainPayment `json:"payments"`
+	Failures  []string         `json:"failures,omitempty"`
+}
+
+// CheckOnchainPayments updates each unpaid payment from the node's wallet
+// transactions and settles those that have received their full amount with
+// the confirmations their size requires. A payment bookings could not be
+// told about is left confirming and retried on the next check.
+func (s *server) CheckOnchainPayments(ctx context.Context) (onchainCheck, error) {
+	txs, err := s.lnd.OnchainTransactions(ctx)
+	if err != nil {
+		return onchainCheck{}, err
+	}
+	rep := onchainCheck{Payments: []OnchainPayment{}}
+	for _, p := range s.onchain.Unpaid() {
+		rep.Checked++
+		p.ReceivedSats, p.Confirmations, p.TxIDs = 0, 0, nil
+		for _, tx := range txs {
+			sats, ok := tx.Outputs[p.Address]
+			if !ok {
+				continue
+			}
+			if len(p.TxIDs) == 0 || tx.Confirmations < p.Confirmations {
+				p.Confirmations = tx.Confirmations
+			}
+			p.ReceivedSats += sats
+			p.TxIDs = append(p.TxIDs, tx.TxHash)
+		}
+		p.Status = OnchainAwaitingPayment
+		if p.ReceivedSats >= p.AmountSats {
+			p.Status = OnchainConfirming
+		}
+		if p.Status == OnchainConfirming && p.Confirmations >= p.RequiredConfirmations {
+			if _, err := s.settleOnchainPayment(ctx, p); err != nil {
+				log.Printf("on-chain payment %s for booking %s: recording payment failed: %v", p.Address, p.BookingID, err)
+				rep.Failures = append(rep.Failures, p.Address)
+			} else {
+				p.Status, p.PaidAt = OnchainPaid, apitypes.JSONTime{Time: s.now()}
+				rep.Confirmed++
+			}
+		}
+		s.onchain.Update(p)
+		rep.Payments = append(rep.Payments, p)
+	}
+	return rep, nil
+}
+
+// settleOnchainPayment commits a confirmed payment to the ledger under its
+// address and hands it to bookings.
+func (s *server) settleOnchainPayment(ctx context.Context, p OnchainPayment) (string, error) {
+	s.commitPayment(Payment{
+		Ref:        p.Address,
+		Tenant:     p.Tenant,
+		BookingID:  p.BookingID,
+		Category:   p.Category,
+		GrossCents: p.AmountCents,
+		Currency:   "USD",
+		Rail:       string(RailOnchain),
+		PaidAt:     apitypes.JSONTime{Time: s.now()},
+	})
+	return s.bookings.RecordPayment(s.withTenant(ctx, p.Tenant), p.BookingID, PaymentNotice{
+		PaymentRef:  p.Address,
+		AmountCents: p.AmountCents,
+		Currency:    "USD",
+	})
+}
+
+// createOnchainPaymentHandler issues a fresh address for a booking to be
+// paid to on-chain. As with Lightning, the caller supplies the sats amount
+// from a pricing quote and the USD amount it was converted from; the USD
+// amount decides how many confirmations the payment needs.
+func (s *server) createOnchainPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	if s.lnd == nil {
+		s.respondLightningUnavailable(w, "no Lightning node is configured")
+		return
+	}
+	var req struct {
+		BookingID   string `json:"booking_id"`
+		Category    string `json:"category"`
+		AmountSats  int64  `json:"amount_sats"`
+		AmountCents int64  `json:"amount_cents"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.BookingID == "" || req.AmountSats <= 0 || req.AmountCents <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_payment", "booking_id and positive amount_sats and amount_cents are required")
+		return
+	}
+	if stale, why := s.btcRateStale(r.Context()); stale {
+		respondError(w, http.StatusServiceUnavailable, RailReasonRateStale, why)
+		return
+	}
+	ctx, capture := withExchangeCapture(r.Context())
+	addr, err := s.lnd.NewAddress(ctx)
+	s.lndHealth.observe(err, s.now())
+	if err != nil {
+		log.Printf("on-chain address for booking %s failed: %v", req.BookingID, err)
+		s.respondLightningUnavailable(w, "could not create on-chain address")
+		return
+	}
+	p := OnchainPayment{
+		Address:               addr,
+		Tenant:                s.tenant(r.Context()).ID,
+		BookingID:             req.BookingID,
+		Category:              req.Category,
+		AmountSats:            req.AmountSats,
+		AmountCents:           req.AmountCents,
+		RequiredConfirmations: s.cfg.OnchainConfirmations.Required(req.AmountCents),
+		Status:                OnchainAwaitingPayment,
+		CreatedAt:             apitypes.JSONTime{Time: s.now()},
+	}
+	s.onchain.Add(p)
+	s.payloads.Add(p.Address, capture.list()...)
+	respondJSON(w, http.StatusCreated, p)
+}
+
+func (s *server) getOnchainPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := s.onchain.Get(chi.URLParam(r, "address"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, "payment_not_found", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+// checkOnchainPaymentsHandler runs one confirmation check. It is meant to
+// be called on a schedule, every block or so.
+func (s *server) checkOnchainPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.lnd == nil {
+		respondError(w, http.StatusServiceUnavailable, "lightning_unavailable", "no Lightning node is configured")
+		return
+	}
+	rep, err := s.CheckOnchainPayments(r.Context())
+	s.lndHealth.observe(err, s.now())
+	if err != nil {
+		log.Printf("on-chain confirmation check: %v", err)
+		respondError(w, http.StatusBadGateway, "lnd_unavailable", "could not list transactions from LND")
+		return
+	}
+	respondJSON(w, http.StatusOK, rep)
+}
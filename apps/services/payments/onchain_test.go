@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func createOnchainPayment(t *testing.T, s *server, bookingID string, sats, cents int64) OnchainPayment {
+	t.Helper()
+	var p OnchainPayment
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/onchain/address", map[string]interface{}{
+		"booking_id": bookingID, "category": CategoryRentals, "amount_sats": sats, "amount_cents": cents,
+	}, &p)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create on-chain payment: status %d: %s", rec.Code, rec.Body)
+	}
+	return p
+}
+
+func checkOnchain(t *testing.T, s *server) onchainCheck {
+	t.Helper()
+	var rep onchainCheck
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/onchain/check", nil, &rep)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("check: status %d: %s", rec.Code, rec.Body)
+	}
+	return rep
+}
+
+func onchainStatus(t *testing.T, s *server, address string) OnchainPayment {
+	t.Helper()
+	var p OnchainPayment
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/onchain/address/"+address, nil, &p); rec.Code != http.StatusOK {
+		t.Fatalf("get on-chain payment: status %d: %s", rec.Code, rec.Body)
+	}
+	return p
+}
+
+func TestOnchainConfirmationsScaleWithAmount(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.cfg.OnchainConfirmations, _ = parseConfirmationPolicy("0:1,50000:3,500000:6")
+
+	small := createOnchainPayment(t, s, "bk-small", 100_000, 10_000)
+	large := createOnchainPayment(t, s, "bk-large", 1_000_000, 100_000)
+	if small.RequiredConfirmations != 1 || large.RequiredConfirmations != 3 {
+		t.Fatalf("required confirmations = %d and %d, want 1 and 3", small.RequiredConfirmations, large.RequiredConfirmations)
+	}
+
+	lnd.txs = []LNDTransaction{
+		{TxHash: "tx-small", Confirmations: 1, Outputs: map[string]int64{small.Address: 100_000}},
+		{TxHash: "tx-large", Confirmations: 1, Outputs: map[string]int64{large.Address: 1_000_000}},
+	}
+	if rep := checkOnchain(t, s); rep.Confirmed != 1 {
+		t.Fatalf("confirmed after 1 block = %d, want 1", rep.Confirmed)
+	}
+	if got := onchainStatus(t, s, small.Address); got.Status != OnchainPaid {
+		t.Fatalf("small payment = %s, want paid at 1 confirmation", got.Status)
+	}
+	if _, err := s.ledger.Payment(small.Address); err != nil {
+		t.Fatalf("small payment not in ledger: %v", err)
+	}
+
+	lnd.txs[1].Confirmations = 2
+	checkOnchain(t, s)
+	got := onchainStatus(t, s, large.Address)
+	if got.Status != OnchainConfirming || got.Confirmations != 2 {
+		t.Fatalf("large payment = %s at %d confirmations, want confirming at 2", got.Status, got.Confirmations)
+	}
+	if _, err := s.ledger.Payment(large.Address); err == nil {
+		t.Fatal("large payment committed before reaching 3 confirmations")
+	}
+	if _, ok := s.bookings.(*fakeBookings).payments["bk-large"]; ok {
+		t.Fatal("bookings told large payment was made before reaching 3 confirmations")
+	}
+
+	lnd.txs[1].Confirmations = 3
+	checkOnchain(t, s)
+	if got := onchainStatus(t, s, large.Address); got.Status != OnchainPaid {
+		t.Fatalf("large payment = %s, want paid at 3 confirmations", got.Status)
+	}
+	pay, err := s.ledger.Payment(large.Address)
+	if err != nil || pay.Rail != string(RailOnchain) || pay.GrossCents != 100_000 {
+		t.Fatalf("large payment in ledger = %+v, %v", pay, err)
+	}
+}
+
+func TestOnchainUnderpaymentStaysAwaiting(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.cfg.OnchainConfirmations, _ = parseConfirmationPolicy("0:1")
+
+	p := createOnchainPayment(t, s, "bk-1", 100_000, 10_000)
+	lnd.txs = []LNDTransaction{{TxHash: "tx-1", Confirmations: 6, Outputs: map[string]int64{p.Address: 60_000}}}
+	checkOnchain(t, s)
+	if got := onchainStatus(t, s, p.Address); got.Status != OnchainAwaitingPayment || got.ReceivedSats != 60_000 {
+		t.Fatalf("underpaid payment = %s with %d sats received, want awaiting_payment with 60000", got.Status, got.ReceivedSats)
+	}
+
+	// The rest arrives in a second transaction; the payment is only as
+	// confirmed as that one.
+	lnd.txs = append(lnd.txs, LNDTransaction{TxHash: "tx-2", Confirmations: 0, Outputs: map[string]int64{p.Address: 40_000}})
+	checkOnchain(t, s)
+	if got := onchainStatus(t, s, p.Address); got.Status != OnchainConfirming || got.Confirmations != 0 {
+		t.Fatalf("topped-up payment = %s at %d confirmations, want confirming at 0", got.Status, got.Confirmations)
+	}
+}
+
+func TestConfirmationPolicyValidate(t *testing.T) {
+	p, err := parseConfirmationPolicy("50000:1,0:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.validate(); err == nil {
+		t.Fatal("validate accepted tiers requiring fewer confirmations for larger payments")
+	}
+	if _, err := parseConfirmationPolicy("0-1"); err == nil {
+		t.Fatal("parse accepted a tier without a colon")
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+var ErrNoPayoutAccount = errors.New("no Foundation payout account is configured for these proceeds")
+
+// Origins of Foundation proceeds. Fiat and BTC proceeds are paid out to
+// separate accounts so their impact is accounted for separately.
+const (
+	OriginFiat = "fiat"
+	OriginBTC  = "btc"
+)
+
+// paymentOrigin is whether a payment made on rail brought in fiat or BTC.
+func paymentOrigin(rail string) string {
+	if btcRails[Rail(rail)] {
+		return OriginBTC
+	}
+	return OriginFiat
+}
+
+// Rails Foundation payouts are sent over.
+const (
+	PayoutRailStripe    = "stripe"
+	PayoutRailLightning = "lightning"
+	PayoutRailOnchain   = "onchain"
+)
+
+// Payout states.
+const (
+	PayoutSent   = "sent"
+	PayoutFailed = "failed"
+)
+
+// FoundationPayoutAccounts are where the Foundation's share is paid out:
+// fiat proceeds to its Stripe connected account, BTC proceeds to its
+// Lightning Address or, when it has none, its on-chain address.
+type FoundationPayoutAccounts struct {
+	StripeAccount    string
+	LightningAddress string
+	OnchainAddress   string
+}
+
+// Route picks the rail and destination for proceeds of the given origin.
+func (a FoundationPayoutAccounts) Route(origin string) (rail, destination string, err error) {
+	switch {
+	case origin == OriginFiat && a.StripeAccount != "":
+		return PayoutRailStripe, a.StripeAccount, nil
+	case origin == OriginBTC && a.LightningAddress != "":
+		return PayoutRailLightning, a.LightningAddress, nil
+	case origin == OriginBTC && a.OnchainAddress != "":
+		return PayoutRailOnchain, a.OnchainAddress, nil
+	}
+	return "", "", ErrNoPayoutAccount
+}
+
+// FoundationPayout is one transfer of the Foundation's share of a set of
+// payments. Rail records how it was sent and ProviderRef the Stripe
+// transfer id, Lightning payment hash or on-chain txid. AmountSats is set
+// for BTC payouts.
+type FoundationPayout struct {
+	ID          string            `json:"id"`
+	Origin      string            `json:"origin"`
+	Rail        string            `json:"rail,omitempty"`
+	Destination string            `json:"destination,omitempty"`
+	AmountCents int64             `json:"amount_cents"`
+	Currency    string            `json:"currency"`
+	AmountSats  int64             `json:"amount_sats,omitempty"`
+	PaymentRefs []string          `json:"payment_refs"`
+	Status      string            `json:"status"`
+	ProviderRef string            `json:"provider_ref,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   apitypes.JSONTime `json:"created_at"`
+}
+
+// foundationPayouts records payouts and which payments they settled.
+type foundationPayouts struct {
+	mu      sync.Mutex
+	payouts []FoundationPayout
+	paid    map[string]string // payment ref -> payout id
+	// runMu serialises payout runs so a payment is never paid out twice.
+	runMu sync.Mutex
+}
+
+func newFoundationPayouts() *foundationPayouts {
+	return &foundationPayouts{paid: make(map[string]string)}
+}
+
+// Record stores a payout, marking its payments paid when it was sent.
+func (f *foundationPayouts) Record(p FoundationPayout) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.payouts = append(f.payouts, p)
+	if p.Status == PayoutSent {
+		for _, ref := range p.PaymentRefs {
+			f.paid[ref] = p.ID
+		}
+	}
+}
+
+func (f *foundationPayouts) Paid(paymentRef string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.paid[paymentRef]
+	return ok
+}
+
+// SentCents totals the payouts sent to the Foundation's own accounts.
+func (f *foundationPayouts) SentCents() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var total int64
+	for _, p := range f.payouts {
+		if p.Status == PayoutSent {
+			total += p.AmountCents
+		}
+	}
+	return total
+}
+
+// List returns every payout, oldest first.
+func (f *foundationPayouts) List() []FoundationPayout {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FoundationPayout{}, f.payouts...)
+}
+
+// PayFoundation pays out what the Foundation is owed from the payments made
+// in [from, to) that no earlier run has paid out. Payments are grouped by
+// origin and currency, and each group is sent to the account configured
+// for its origin. A group that cannot be sent is recorded as failed and
+// picked up again by the next run.
+func (s *server) PayFoundation(ctx context.Context, from, to time.Time) []FoundationPayout {
+	s.payouts.runMu.Lock()
+	defer s.payouts.runMu.Unlock()
+
+	type group struct{ origin, currency string }
+	groups := make(map[group][]Payment)
+	var order []group
+	for _, p := range s.ledger.PaymentsBetween(from, to) {
+		if s.payouts.Paid(p.Ref) || s.ledger.FoundationHeld(p.Ref) <= 0 {
+			continue
+		}
+		g := group{paymentOrigin(p.Rail), p.Currency}
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], p)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].origin != order[j].origin {
+			return order[i].origin < order[j].origin
+		}
+		return order[i].currency < order[j].currency
+	})
+
+	payouts := []FoundationPayout{}
+	for _, g := range order {
+		p := FoundationPayout{
+			ID:        newID(),
+			Origin:    g.origin,
+			Currency:  g.currency,
+			CreatedAt: apitypes.JSONTime{Time: s.now()},
+		}
+		for _, pay := range groups[g] {
+			p.PaymentRefs = append(p.PaymentRefs, pay.Ref)
+			p.AmountCents += s.ledger.FoundationHeld(pay.Ref)
+		}
+		if err := s.sendPayout(ctx, &p, groups[g]); err != nil {
+			p.Status, p.Error = PayoutFailed, err.Error()
+		} else {
+			p.Status = PayoutSent
+		}
+		s.payouts.Record(p)
+		payouts = append(payouts, p)
+	}
+	return payouts
+}
+
+// sendPayout routes p to the Foundation's account for its origin and sends
+// it, filling in the rail, destination and provider reference.
+func (s *server) sendPayout(ctx context.Context, p *FoundationPayout, payments []Payment) error {
+	rail, dest, err := s.cfg.FoundationPayouts.Route(p.Origin)
+	if err != nil {
+		return err
+	}
+	p.Rail, p.Destination = rail, dest
+	if rail == PayoutRailStripe {
+		return s.sendStripePayout(ctx, p)
+	}
+
+	if s.lnd == nil {
+		return errors.New("no Lightning node is configured")
+	}
+	for _, pay := range payments {
+		sats, err := s.foundationSats(ctx, pay)
+		if err != nil {
+			return err
+		}
+		p.AmountSats += sats
+	}
+	if rail == PayoutRailOnchain {
+		p.ProviderRef, err = s.lnd.SendCoins(ctx, dest, p.AmountSats)
+		return err
+	}
+	pr, err := s.lnurl.Resolve(ctx, dest, p.AmountSats)
+	if err != nil {
+		return err
+	}
+	p.ProviderRef, err = s.lnd.PayInvoice(ctx, pr)
+	return err
+}
+
+// sendStripePayout transfers p to the Foundation's Stripe connected
+// account. The payout id is the idempotency key, so a retried request
+// cannot transfer twice.
+func (s *server) sendStripePayout(ctx context.Context, p *FoundationPayout) error {
+	form := url.Values{
+		"amount":                {strconv.FormatInt(p.AmountCents, 10)},
+		"currency":              {strings.ToLower(p.Currency)},
+		"destination":           {p.Destination},
+		"description":           {fmt.Sprintf("Foundation share of %d payments", len(p.PaymentRefs))},
+		"metadata[payout_id]":   {p.ID},
+		"metadata[payout_kind]": {"foundation"},
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := s.stripe.post(ctx, "/v1/transfers", form, "foundation-payout-"+p.ID, &out); err != nil {
+		return err
+	}
+	p.ProviderRef = out.ID
+	return nil
+}
+
+// foundationSats is the Foundation's share of a BTC payment in sats. A
+// Lightning payment converts at the rate its invoice was issued at, so the
+// Foundation receives its share of the sats actually paid; other payments
+// convert at the current rate.
+func (s *server) foundationSats(ctx context.Context, p Payment) (int64, error) {
+	cents := s.ledger.FoundationHeld(p.Ref)
+	if inv, err := s.invoices.Get(p.Ref); err == nil && inv.AmountCents > 0 {
+		return BTCRate{AmountSats: inv.AmountSats, AmountCents: inv.AmountCents}.Sats(cents), nil
+	}
+	return s.satsAtCurrentRate(ctx, cents)
+}
+
+// satsAtCurrentRate converts USD cents to sats at the current BTC rate.
+func (s *server) satsAtCurrentRate(ctx context.Context, cents int64) (int64, error) {
+	rate, err := s.rates.BTCRate(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("pricing BTC payout: %w", err)
+	}
+	if rate.BtcUSD <= 0 {
+		return 0, errors.New("pricing BTC payout: no BTC rate")
+	}
+	return int64(math.Round(float64(cents) * 1e6 / rate.BtcUSD)), nil
+}
+
+// payFoundationHandler pays out the Foundation's share of a period's
+// payments. Query: ?from=YYYY-MM-DD&to=YYYY-MM-DD.
+func (s *server) payFoundationHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_range", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from":    from.Format(time.DateOnly),
+		"to":      to.AddDate(0, 0, -1).Format(time.DateOnly),
+		"payouts": s.PayFoundation(r.Context(), from, to),
+	})
+}
+
+func (s *server) listFoundationPayoutsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"payouts": s.payouts.List()})
+}
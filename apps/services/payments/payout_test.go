@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// fakeStripeTransfers records the transfers created through it.
+type fakeStripeTransfers struct {
+	mu        sync.Mutex
+	transfers []url.Values
+}
+
+func (f *fakeStripeTransfers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	f.transfers = append(f.transfers, r.PostForm)
+	w.Write([]byte(`{"id":"tr_1"}`))
+}
+
+// newPayoutTestServer has Foundation accounts for both origins, a Stripe
+// API recording transfers and a Lightning node recording payments.
+func newPayoutTestServer(t *testing.T) (*server, *fakeStripeTransfers, *fakeLND, *fakeWallet) {
+	t.Helper()
+	s, lnd := newLightningTestServer(t)
+	stripe := &fakeStripeTransfers{}
+	api := httptest.NewServer(stripe)
+	t.Cleanup(api.Close)
+	s.stripe = newStripeClient("sk_test", api.URL)
+	s.lnurl = testResolver()
+	wallet := newFakeWallet(t)
+	s.cfg.FoundationPayouts = FoundationPayoutAccounts{StripeAccount: "acct_foundation", LightningAddress: wallet.address()}
+	return s, stripe, lnd, wallet
+}
+
+type payoutResponse struct {
+	Payouts []FoundationPayout `json:"payouts"`
+}
+
+func TestFiatFoundationShareIsPaidOutThroughStripe(t *testing.T) {
+	s, stripe, lnd, _ := newPayoutTestServer(t)
+	day := time.Date(2026, 4, 10, 15, 0, 0, 0, time.UTC)
+	seedPayment(s, "pay_a", CategoryTours, 10000, 1500, day)
+	seedPayment(s, "pay_b", CategoryTours, 20000, 3000, day.Add(time.Hour))
+
+	var got payoutResponse
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/foundation/payouts?from=2026-04-10&to=2026-04-10", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("payout: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(got.Payouts) != 1 {
+		t.Fatalf("payouts = %+v, want one", got.Payouts)
+	}
+	p := got.Payouts[0]
+	if p.Origin != OriginFiat || p.Rail != PayoutRailStripe || p.Destination != "acct_foundation" ||
+		p.AmountCents != 4500 || p.Status != PayoutSent || p.ProviderRef != "tr_1" || len(p.PaymentRefs) != 2 {
+		t.Fatalf("payout = %+v, want 4500 sent to acct_foundation via stripe", p)
+	}
+	if len(stripe.transfers) != 1 || stripe.transfers[0].Get("destination") != "acct_foundation" || stripe.transfers[0].Get("amount") != "4500" {
+		t.Fatalf("stripe transfers = %v", stripe.transfers)
+	}
+	if len(lnd.paid) != 0 || len(lnd.sent) != 0 {
+		t.Fatalf("lightning used for fiat proceeds: paid %v sent %v", lnd.paid, lnd.sent)
+	}
+
+	// A second run finds nothing left to pay.
+	doJSON(t, s.routes(), http.MethodPost, "/api/payments/foundation/payouts?from=2026-04-10&to=2026-04-10", nil, &got)
+	if len(got.Payouts) != 0 || len(stripe.transfers) != 1 {
+		t.Fatalf("second run paid %+v", got.Payouts)
+	}
+}
+
+func TestBTCFoundationShareIsPaidOutOverLightning(t *testing.T) {
+	s, stripe, lnd, wallet := newPayoutTestServer(t)
+	settledAt := time.Date(2026, 4, 10, 15, 0, 0, 0, time.UTC)
+	s.invoices.Add(LightningInvoice{RHash: "ab01", BookingID: "bk-ln", AmountSats: 100000, AmountCents: 5000})
+	s.commitPayment(Payment{Ref: "ab01", BookingID: "bk-ln", GrossCents: 5000, Currency: "USD", Rail: string(RailLightning), PaidAt: apitypes.JSONTime{Time: settledAt}})
+
+	var got payoutResponse
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/foundation/payouts?from=2026-04-10&to=2026-04-10", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("payout: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(got.Payouts) != 1 {
+		t.Fatalf("payouts = %+v, want one", got.Payouts)
+	}
+	// 15% of 5000 cents is 750, or 15000 sats at the invoice's rate.
+	p := got.Payouts[0]
+	if p.Origin != OriginBTC || p.Rail != PayoutRailLightning || p.Destination != wallet.address() ||
+		p.AmountCents != 750 || p.AmountSats != 15000 || p.Status != PayoutSent {
+		t.Fatalf("payout = %+v, want 15000 sats sent over lightning", p)
+	}
+	if len(wallet.amounts) != 1 || wallet.amounts[0] != "15000000" || len(lnd.paid) != 1 || lnd.paid[0] != "lnbc-refund-15000000" {
+		t.Fatalf("wallet amounts %v, lnd paid %v", wallet.amounts, lnd.paid)
+	}
+	if len(stripe.transfers) != 0 {
+		t.Fatalf("stripe used for BTC proceeds: %v", stripe.transfers)
+	}
+
+	var listed payoutResponse
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/foundation/payouts", nil, &listed)
+	if len(listed.Payouts) != 1 || listed.Payouts[0].Rail != PayoutRailLightning {
+		t.Fatalf("listed = %+v", listed.Payouts)
+	}
+}
+
+func TestFoundationPayoutWithoutAccountFails(t *testing.T) {
+	s, _, _, _ := newPayoutTestServer(t)
+	s.cfg.FoundationPayouts.StripeAccount = ""
+	seedPayment(s, "pay_a", CategoryTours, 10000, 1500, time.Date(2026, 4, 10, 15, 0, 0, 0, time.UTC))
+
+	var got payoutResponse
+	doJSON(t, s.routes(), http.MethodPost, "/api/payments/foundation/payouts?from=2026-04-10&to=2026-04-10", nil, &got)
+	if len(got.Payouts) != 1 || got.Payouts[0].Status != PayoutFailed || got.Payouts[0].Error != ErrNoPayoutAccount.Error() {
+		t.Fatalf("payouts = %+v, want one failed for want of an account", got.Payouts)
+	}
+	// The failed payout is retried once an account is configured.
+	s.cfg.FoundationPayouts.StripeAccount = "acct_foundation"
+	doJSON(t, s.routes(), http.MethodPost, "/api/payments/foundation/payouts?from=2026-04-10&to=2026-04-10", nil, &got)
+	if len(got.Payouts) != 1 || got.Payouts[0].Status != PayoutSent {
+		t.Fatalf("retry = %+v, want sent", got.Payouts)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// redacted replaces every secret in a stored provider payload.
+const redacted = "[REDACTED]"
+
+// maxPayloadBytes bounds each stored request or response body.
+const maxPayloadBytes = 64 << 10
+
+// secretHeaders are request headers that carry credentials.
+var secretHeaders = map[string]bool{
+	"Authorization":    true,
+	"Stripe-Signature": true,
+}
+
+// secretFields are body fields whose values are credentials or would let
+// someone take a payment over.
+var secretFields = map[string]bool{
+	"client_secret": true,
+	"secret":        true,
+	"secret_key":    true,
+	"api_key":       true,
+	"password":      true,
+	"macaroon":      true,
+	"r_preimage":    true,
+	"preimage":      true,
+	"payment_addr":  true,
+}
+
+// ProviderExchange is one request we sent to Stripe or LND, or one webhook
+// they sent us, with its response, as support sees it: every secret is
+// redacted before it is stored.
+type ProviderExchange struct {
+	Provider       string            `json:"provider"`
+	Direction      string            `json:"direction"`
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	RequestHeaders map[string]string `json:"request_headers,omitempty"`
+	RequestBody    string            `json:"request_body,omitempty"`
+	Status         int               `json:"status,omitempty"`
+	ResponseBody   string            `json:"response_body,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	At             apitypes.JSONTime `json:"at"`
+}
+
+// Directions of a provider exchange.
+const (
+	DirectionOutbound = "outbound"
+	DirectionInbound  = "inbound"
+)
+
+// newProviderExchange builds a redacted record of req and its response.
+func newProviderExchange(provider, direction string, req *http.Request, reqBody []byte, status int, respBody []byte, err error) ProviderExchange {
+	x := ProviderExchange{
+		Provider:       provider,
+		Direction:      direction,
+		Method:         req.Method,
+		Path:           req.URL.Path,
+		RequestHeaders: make(map[string]string),
+		RequestBody:    redactBody(reqBody),
+		Status:         status,
+		ResponseBody:   redactBody(respBody),
+		At:             apitypes.JSONTime{Time: time.Now()},
+	}
+	if q := req.URL.Query(); len(q) > 0 {
+		x.Path += "?" + redactForm(q).Encode()
+	}
+	for name := range req.Header {
+		v := req.Header.Get(name)
+		if secretHeaders[http.CanonicalHeaderKey(name)] {
+			v = redacted
+		}
+		x.RequestHeaders[http.CanonicalHeaderKey(name)] = v
+	}
+	if err != nil {
+		x.Error = err.Error()
+	}
+	return x
+}
+
+// newGRPCExchange records a gRPC call to a provider, its messages captured
+// as JSON and redacted like HTTP bodies. The macaroon travels as call
+// metadata and is not recorded.
+func newGRPCExchange(provider, method string, req, resp interface{}, err error) ProviderExchange {
+	x := ProviderExchange{
+		Provider:  provider,
+		Direction: DirectionOutbound,
+		Method:    http.MethodPost,
+		Path:      method,
+		At:        apitypes.JSONTime{Time: time.Now()},
+	}
+	if b, merr := json.Marshal(req); merr == nil {
+		x.RequestBody = redactBody(b)
+	}
+	if err != nil {
+		x.Error = err.Error()
+		return x
+	}
+	if b, merr := json.Marshal(resp); merr == nil {
+		x.ResponseBody = redactBody(b)
+	}
+	return x
+}
+
+// isSecretField reports whether a JSON key or form key names a secret. Form
+// keys such as "metadata[client_secret]" are judged by their last part.
+func isSecretField(key string) bool {
+	key = strings.ToLower(key)
+	if i := strings.LastIndex(key, "["); i >= 0 {
+		key = strings.TrimSuffix(key[i+1:], "]")
+	}
+	return secretFields[key]
+}
+
+// redactBody redacts a JSON or form-encoded body, truncating it to
+// maxPayloadBytes. Bodies in neither format are kept as they are.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		out, _ := json.Marshal(redactJSON(v))
+		return truncatePayload(string(out))
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil && strings.Contains(string(body), "=") {
+		return truncatePayload(redactForm(form).Encode())
+	}
+	return truncatePayload(string(body))
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if isSecretField(k) {
+				t[k] = redacted
+			} else {
+				t[k] = redactJSON(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = redactJSON(child)
+		}
+	}
+	return v
+}
+
+func redactForm(form url.Values) url.Values {
+	for k := range form {
+		if isSecretField(k) {
+			form[k] = []string{redacted}
+		}
+	}
+	return form
+}
+
+func truncatePayload(s string) string {
+	if len(s) > maxPayloadBytes {
+		return s[:maxPayloadBytes] + "…(truncated)"
+	}
+	return s
+}
+
+// exchangeCapture collects the exchanges made while handling one payment,
+// so they can be stored under its reference once it is known.
+type exchangeCapture struct {
+	mu        sync.Mutex
+	exchanges []ProviderExchange
+}
+
+type exchangeCaptureKey struct{}
+
+// withExchangeCapture returns a context whose provider calls are captured.
+func withExchangeCapture(ctx context.Context) (context.Context, *exchangeCapture) {
+	c := &exchangeCapture{}
+	return context.WithValue(ctx, exchangeCaptureKey{}, c), c
+}
+
+// captureExchange records x on ctx's capture, if it has one.
+func captureExchange(ctx context.Context, x ProviderExchange) {
+	if c, ok := ctx.Value(exchangeCaptureKey{}).(*exchangeCapture); ok {
+		c.mu.Lock()
+		c.exchanges = append(c.exchanges, x)
+		c.mu.Unlock()
+	}
+}
+
+func (c *exchangeCapture) list() []ProviderExchange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ProviderExchange(nil), c.exchanges...)
+}
+
+// providerPayloads keeps every exchange by payment reference: a Checkout
+// Session id or PaymentIntent for Stripe, a payment hash for Lightning.
+type providerPayloads struct {
+	mu    sync.Mutex
+	byRef map[string][]ProviderExchange
+	// aliases maps a Checkout Session id to the PaymentIntent it produced.
+	aliases map[string]string
+}
+
+func newProviderPayloads() *providerPayloads {
+	return &providerPayloads{
+		byRef:   make(map[string][]ProviderExchange),
+		aliases: make(map[string]string),
+	}
+}
+
+func (p *providerPayloads) resolveLocked(ref string) string {
+	if to, ok := p.aliases[ref]; ok {
+		return to
+	}
+	return ref
+}
+
+// Add appends exchanges to ref's history.
+func (p *providerPayloads) Add(ref string, exchanges ...ProviderExchange) {
+	if ref == "" || len(exchanges) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ref = p.resolveLocked(ref)
+	p.byRef[ref] = append(p.byRef[ref], exchanges...)
+}
+
+// Link moves from's history to the front of to's and makes from an alias
+// of to, e.g. when a Checkout Session completes with a PaymentIntent.
+// Linking the same pair again is a no-op, so redelivered webhooks are safe.
+func (p *providerPayloads) Link(from, to string) {
+	if from == "" || to == "" || from == to {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.aliases[from]; ok {
+		return
+	}
+	if history, ok := p.byRef[from]; ok {
+		p.byRef[to] = append(history, p.byRef[to]...)
+		delete(p.byRef, from)
+	}
+	p.aliases[from] = to
+}
+
+// Get returns ref's exchanges in the order they happened.
+func (p *providerPayloads) Get(ref string) []ProviderExchange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ProviderExchange(nil), p.byRef[p.resolveLocked(ref)]...)
+}
+
+// providerPayloadHandler returns what was exchanged with Stripe or LND for
+// a payment, secrets redacted.
+func (s *server) providerPayloadHandler(w http.ResponseWriter, r *http.Request) {
+	ref := chi.URLParam(r, "paymentRef")
+	exchanges := s.payloads.Get(ref)
+	if len(exchanges) == 0 {
+		respondError(w, http.StatusNotFound, "payload_not_found", "no provider exchanges are stored for that payment")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"payment_ref": ref,
+		"exchanges":   exchanges,
+	})
+}
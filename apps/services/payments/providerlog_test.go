@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type providerPayloadResponse struct {
+	PaymentRef string             `json:"payment_ref"`
+	Exchanges  []ProviderExchange `json:"exchanges"`
+}
+
+func getProviderPayload(t *testing.T, s *server, ref string) (providerPayloadResponse, *httptest.ResponseRecorder) {
+	t.Helper()
+	var resp providerPayloadResponse
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/"+ref+"/provider-payload", nil, &resp)
+	return resp, rec
+}
+
+func TestStripePayloadIsStoredRedacted(t *testing.T) {
+	s, _ := newCheckoutTestServer(t, 0)
+	if rec := postCheckout(t, s.routes(), "key-1", testCheckout); rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	event := checkoutCompleted("bk-1")
+	event["data"].(map[string]interface{})["object"].(map[string]interface{})["id"] = "cs_1"
+	postStripeEvent(t, s, event, testWebhookSecret, nil)
+	// Stripe redelivers; the history must not double.
+	postStripeEvent(t, s, event, testWebhookSecret, nil)
+
+	resp, rec := getProviderPayload(t, s, "pi_test_1")
+	if rec.Code != http.StatusOK || len(resp.Exchanges) != 3 {
+		t.Fatalf("status %d exchanges %+v, want the session and two deliveries", rec.Code, resp.Exchanges)
+	}
+	if raw := rec.Body.String(); strings.Contains(raw, "sk_test") || strings.Contains(raw, testWebhookSecret) || strings.Contains(raw, "v1=") {
+		t.Fatalf("secrets leaked: %s", raw)
+	}
+
+	created := resp.Exchanges[0]
+	if created.Direction != DirectionOutbound || created.Path != "/v1/checkout/sessions" || created.Status != http.StatusOK {
+		t.Fatalf("session exchange = %+v", created)
+	}
+	if created.RequestHeaders["Authorization"] != redacted || created.RequestHeaders["Idempotency-Key"] == "" {
+		t.Fatalf("request headers = %v", created.RequestHeaders)
+	}
+	if !strings.Contains(created.RequestBody, "metadata%5Bbooking_id%5D=bk-1") {
+		t.Fatalf("request body = %q", created.RequestBody)
+	}
+	var session map[string]string
+	if err := json.Unmarshal([]byte(created.ResponseBody), &session); err != nil || session["id"] != "cs_1" {
+		t.Fatalf("response body %q does not round-trip: %v", created.ResponseBody, err)
+	}
+
+	received := resp.Exchanges[1]
+	if received.Direction != DirectionInbound || received.RequestHeaders["Stripe-Signature"] != redacted || !strings.Contains(received.RequestBody, `"pi_test_1"`) {
+		t.Fatalf("webhook exchange = %+v", received)
+	}
+
+	// The session id still finds the same history.
+	if bySession, _ := getProviderPayload(t, s, "cs_1"); len(bySession.Exchanges) != 3 {
+		t.Fatalf("by session: %d exchanges, want 3", len(bySession.Exchanges))
+	}
+	if _, rec := getProviderPayload(t, s, "pi_unknown"); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown ref: status %d, want 404", rec.Code)
+	}
+
+	anon := httptest.NewRecorder()
+	s.routes().ServeHTTP(anon, httptest.NewRequest(http.MethodGet, "/api/payments/pi_test_1/provider-payload", nil))
+	if anon.Code != http.StatusUnauthorized {
+		t.Fatalf("without admin key: status %d, want 401", anon.Code)
+	}
+}
+
+func TestLNDPayloadIsStoredRedacted(t *testing.T) {
+	hash := []byte("0123456789abcdef0123456789abcdef")
+	s := newTestServer(t)
+	s.lnd = startFakeLND(t, func(call lndCall) (interface{}, error) {
+		if err := call.Recv(&lnrpcInvoice{}); err != nil {
+			return nil, err
+		}
+		return &lnrpcAddInvoiceResponse{RHash: hash, PaymentRequest: "lnbc50u1test", PaymentAddr: []byte("payment-secret")}, nil
+	})
+	inv := createInvoice(t, s, "bk-ln", 5000, 300)
+	if inv.RHash != hex.EncodeToString(hash) {
+		t.Fatalf("r_hash = %q", inv.RHash)
+	}
+
+	resp, rec := getProviderPayload(t, s, inv.RHash)
+	if rec.Code != http.StatusOK || len(resp.Exchanges) != 1 {
+		t.Fatalf("status %d exchanges %+v", rec.Code, resp.Exchanges)
+	}
+	if raw := rec.Body.String(); strings.Contains(raw, testMacaroon) || strings.Contains(raw, base64.StdEncoding.EncodeToString([]byte("payment-secret"))) {
+		t.Fatalf("secrets leaked: %s", raw)
+	}
+	x := resp.Exchanges[0]
+	if x.Provider != "lnd" || x.Path != "/lnrpc.Lightning/AddInvoice" {
+		t.Fatalf("exchange = %+v", x)
+	}
+	var req, out map[string]interface{}
+	if err := json.Unmarshal([]byte(x.RequestBody), &req); err != nil || req["value"] != float64(5000) {
+		t.Fatalf("request body %q: %v", x.RequestBody, err)
+	}
+	if err := json.Unmarshal([]byte(x.ResponseBody), &out); err != nil || out["payment_request"] != "lnbc50u1test" || out["payment_addr"] != redacted {
+		t.Fatalf("response body %q: %v", x.ResponseBody, err)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{`{"id":"pi_1","client_secret":"pi_1_secret_x","charges":[{"r_preimage":"abc"}]}`, `{"charges":[{"r_preimage":"[REDACTED]"}],"client_secret":"[REDACTED]","id":"pi_1"}`},
+		{"amount=100&metadata[api_key]=k", "amount=100&metadata%5Bapi_key%5D=%5BREDACTED%5D"},
+		{"not a form", "not a form"},
+	}
+	for _, tt := range tests {
+		if got := redactBody([]byte(tt.body)); got != tt.want {
+			t.Errorf("redactBody(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rail is a way a guest can pay.
+type Rail string
+
+const (
+	RailCard      Rail = "card"
+	RailLightning Rail = "lightning"
+	RailOnchain   Rail = "onchain"
+	RailCredit    Rail = "credit"
+	// RailBankTransfer is paid by bank transfer and confirmed by hand once
+	// finance sees it on the statement.
+	RailBankTransfer Rail = "bank_transfer"
+)
+
+// allRails lists every rail in the order they are offered to guests.
+var allRails = []Rail{RailCard, RailLightning, RailOnchain, RailCredit, RailBankTransfer}
+
+// Reasons a rail is withheld.
+const (
+	RailReasonDisabled     = "disabled"
+	RailReasonRegion       = "region_unavailable"
+	RailReasonBelowMinimum = "below_minimum"
+	RailReasonAboveMaximum = "above_maximum"
+)
+
+// RailRule is when a rail may be offered. Amounts are USD cents; a zero
+// MaxCents means no upper bound.
+type RailRule struct {
+	Enabled         bool
+	MinCents        int64
+	MaxCents        int64
+	DisabledRegions map[string]bool
+}
+
+// RailPolicy holds the rule for every rail.
+type RailPolicy map[Rail]RailRule
+
+// railDefaults are the rules used when nothing is configured: card has
+// Stripe's minimum charge, Lightning tops out where routing large payments
+// gets unreliable, on-chain starts where network fees stop dominating, and
+// bank transfers are kept for bookings worth reconciling by hand.
+var railDefaults = RailPolicy{
+	RailCard:      {Enabled: true, MinCents: 50},
+	RailLightning: {Enabled: true, MinCents: 1, MaxCents: 100000},
+	RailOnchain:   {Enabled: true, MinCents: 5000},
+	RailCredit:    {Enabled: true, MinCents: 1},
+	// Bank transfers are reconciled by hand, so only large bookings may
+	// wait on one.
+	RailBankTransfer: {Enabled: true, MinCents: 100000},
+}
+
+// loadRailPolicy reads PAYMENT_RAILS_ENABLED and, per rail,
+// RAIL_<NAME>_MIN_CENTS, RAIL_<NAME>_MAX_CENTS and
+// RAIL_<NAME>_DISABLED_REGIONS (comma-separated ISO country codes).
+func loadRailPolicy() RailPolicy {
+	enabled := make(map[Rail]bool)
+	for _, name := range strings.Split(envString("PAYMENT_RAILS_ENABLED", "card,lightning,onchain,credit,bank_transfer"), ",") {
+		enabled[Rail(strings.ToLower(strings.TrimSpace(name)))] = true
+	}
+	p := make(RailPolicy, len(allRails))
+	for _, rail := range allRails {
+		def := railDefaults[rail]
+		prefix := "RAIL_" + strings.ToUpper(string(rail))
+		p[rail] = RailRule{
+			Enabled:         enabled[rail],
+			MinCents:        envInt64(prefix+"_MIN_CENTS", def.MinCents),
+			MaxCents:        envInt64(prefix+"_MAX_CENTS", def.MaxCents),
+			DisabledRegions: envRegions(prefix + "_DISABLED_REGIONS"),
+		}
+	}
+	return p
+}
+
+func (p RailPolicy) validate() error {
+	for _, rail := range allRails {
+		rule := p[rail]
+		if rule.MinCents < 0 || (rule.MaxCents != 0 && rule.MaxCents < rule.MinCents) {
+			return fmt.Errorf("rail %s: min %d and max %d cents do not form a range", rail, rule.MinCents, rule.MaxCents)
+		}
+	}
+	return nil
+}
+
+// RailAvailability is whether one rail can be used, and why not if it
+// cannot.
+type RailAvailability struct {
+	Rail    Rail   `json:"rail"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Availability evaluates every rail for a payment of amountCents from region.
+func (p RailPolicy) Availability(region string, amountCents int64) []RailAvailability {
+	out := make([]RailAvailability, 0, len(allRails))
+	for _, rail := range allRails {
+		rule := p[rail]
+		a := RailAvailability{Rail: rail}
+		switch {
+		case !rule.Enabled:
+			a.Reason, a.Message = RailReasonDisabled, "not offered"
+		case rule.DisabledRegions[region]:
+			a.Reason, a.Message = RailReasonRegion, "not available in "+region
+		case amountCents < rule.MinCents:
+			a.Reason, a.Message = RailReasonBelowMinimum, "minimum is "+formatUSD(rule.MinCents)
+		case rule.MaxCents != 0 && amountCents > rule.MaxCents:
+			a.Reason, a.Message = RailReasonAboveMaximum, "maximum is "+formatUSD(rule.MaxCents)
+		default:
+			a.Enabled = true
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+var regionPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+var (
+	amountPattern    = regexp.MustCompile(`^(\d{1,12})(?:\.(\d{1,2}))?$`)
+	errInvalidAmount = errors.New("amount must be a positive USD amount with at most 2 decimals")
+)
+
+// parseAmountCents reads a USD amount such as "25", "25.5" or "25.50".
+func parseAmountCents(s string) (int64, error) {
+	m := amountPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errInvalidAmount
+	}
+	dollars, _ := strconv.ParseInt(m[1], 10, 64)
+	cents, _ := strconv.ParseInt((m[2] + "00")[:2], 10, 64)
+	if total := dollars*100 + cents; total > 0 {
+		return total, nil
+	}
+	return 0, errInvalidAmount
+}
+
+func formatUSD(cents int64) string {
+	return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+}
+
+// getRailsHandler lists the payment rails available for a region and
+// amount, with the reason for each one withheld. The bitcoin rails are
+// withheld while the BTC rate is stale.
+func (s *server) getRailsHandler(w http.ResponseWriter, r *http.Request) {
+	region := strings.ToUpper(r.URL.Query().Get("region"))
+	if !regionPattern.MatchString(region) {
+		respondError(w, http.StatusBadRequest, "invalid_region", "region must be a two-letter ISO country code")
+		return
+	}
+	amount, err := parseAmountCents(r.URL.Query().Get("amount"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_amount", err.Error())
+		return
+	}
+	rails := s.cfg.Rails.Availability(region, amount)
+	if stale, why := s.btcRateStale(r.Context()); stale {
+		withholdBTCRails(rails, why)
+	}
+	s.withholdRailsWhileNodeDown(rails)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"region":       region,
+		"amount_cents": amount,
+		"currency":     "USD",
+		"rails":        rails,
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type railsResponse struct {
+	Region      string             `json:"region"`
+	AmountCents int64              `json:"amount_cents"`
+	Rails       []RailAvailability `json:"rails"`
+}
+
+func (r railsResponse) rail(t *testing.T, name Rail) RailAvailability {
+	t.Helper()
+	for _, a := range r.Rails {
+		if a.Rail == name {
+			return a
+		}
+	}
+	t.Fatalf("rail %s missing from %+v", name, r.Rails)
+	return RailAvailability{}
+}
+
+func newRailsTestServer(t *testing.T) *server {
+	t.Helper()
+	s := newTestServer(t)
+	s.cfg.Rails = RailPolicy{
+		RailCard:      {Enabled: true, MinCents: 50},
+		RailLightning: {Enabled: true, MinCents: 1, MaxCents: 100000},
+		RailOnchain:   {Enabled: true, MinCents: 5000, DisabledRegions: map[string]bool{"US": true}},
+		RailCredit:    {Enabled: false},
+	}
+	return s
+}
+
+func TestRailsOnchainDisabledByRegion(t *testing.T) {
+	s := newRailsTestServer(t)
+
+	var got railsResponse
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?region=us&amount=250.00", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got.Region != "US" || got.AmountCents != 25000 {
+		t.Fatalf("context = %s %d", got.Region, got.AmountCents)
+	}
+	if onchain := got.rail(t, RailOnchain); onchain.Enabled || onchain.Reason != RailReasonRegion {
+		t.Fatalf("onchain = %+v, want region_unavailable", onchain)
+	}
+	if card := got.rail(t, RailCard); !card.Enabled {
+		t.Fatalf("card = %+v, want enabled", card)
+	}
+	if credit := got.rail(t, RailCredit); credit.Enabled || credit.Reason != RailReasonDisabled {
+		t.Fatalf("credit = %+v, want disabled", credit)
+	}
+
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?region=SV&amount=250", nil, &got)
+	if onchain := got.rail(t, RailOnchain); !onchain.Enabled {
+		t.Fatalf("onchain in SV = %+v, want enabled", onchain)
+	}
+}
+
+func TestRailsLightningPracticalLimit(t *testing.T) {
+	s := newRailsTestServer(t)
+
+	var small railsResponse
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?region=SV&amount=12.5", nil, &small)
+	if ln := small.rail(t, RailLightning); !ln.Enabled {
+		t.Fatalf("lightning below its limit = %+v, want enabled", ln)
+	}
+	// Too small for an on-chain transaction to be worth its fee.
+	if onchain := small.rail(t, RailOnchain); onchain.Enabled || onchain.Reason != RailReasonBelowMinimum {
+		t.Fatalf("onchain = %+v, want below_minimum", onchain)
+	}
+
+	var large railsResponse
+	doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?region=SV&amount=1000.01", nil, &large)
+	if ln := large.rail(t, RailLightning); ln.Enabled || ln.Reason != RailReasonAboveMaximum || ln.Message != "maximum is $1000.00" {
+		t.Fatalf("lightning above its limit = %+v, want above_maximum", ln)
+	}
+}
+
+func TestRailsRejectsBadQuery(t *testing.T) {
+	s := newRailsTestServer(t)
+	for _, q := range []string{"region=SV", "region=SV&amount=0", "region=SV&amount=1.234", "region=SV&amount=-5", "region=ESV&amount=5", "amount=5"} {
+		if rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/rails?"+q, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+}
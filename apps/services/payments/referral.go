@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// Partner is a business that sends us guests under a referral code and
+// earns CommissionRate of the gross of every payment they bring.
+type Partner struct {
+	ID             string           `json:"partner_id"`
+	Code           string           `json:"code"`
+	CommissionRate apitypes.Percent `json:"commission_rate"`
+}
+
+// Referrals are the partners' referral codes, keyed by normalized code.
+type Referrals map[string]Partner
+
+// loadReferrals reads PARTNER_REFERRALS, a comma-separated list of
+// CODE=partner:rate entries such as "SURFCLUB=surf-club:8%". Malformed
+// entries are kept without a partner id so validate reports them.
+func loadReferrals() Referrals {
+	r := make(Referrals)
+	for _, entry := range strings.Split(os.Getenv("PARTNER_REFERRALS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		code, spec, _ := strings.Cut(entry, "=")
+		id, rate, _ := strings.Cut(spec, ":")
+		p := Partner{ID: strings.TrimSpace(id), Code: normalizeReferralCode(code)}
+		if pct, err := apitypes.ParsePercent(rate); err == nil {
+			p.CommissionRate = pct
+		} else {
+			p.ID = ""
+		}
+		if p.Code == "" {
+			p.Code = entry
+		}
+		r[p.Code] = p
+	}
+	return r
+}
+
+func (r Referrals) validate() error {
+	for _, p := range r {
+		if p.ID == "" {
+			return fmt.Errorf("referral %q: want CODE=partner:rate", p.Code)
+		}
+		if p.CommissionRate <= 0 || p.CommissionRate >= apitypes.HundredPercent {
+			return fmt.Errorf("referral %s: commission rate %s must be above 0%% and below 100%%", p.Code, p.CommissionRate)
+		}
+	}
+	return nil
+}
+
+// normalizeReferralCode makes codes case-insensitive.
+func normalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// lookup returns the partner a code belongs to.
+func (r Referrals) lookup(code string) (Partner, bool) {
+	p, ok := r[normalizeReferralCode(code)]
+	return p, ok
+}
+
+// commission is what p earns from a payment: its rate of gross, taken from
+// the platform's net so the Foundation's share is untouched. It never
+// exceeds that net.
+func (p Partner) commission(grossCents, foundationCents int64) int64 {
+	return max(0, min(p.CommissionRate.Of(grossCents), grossCents-foundationCents))
+}
+
+// referralCommission is the ledger entry crediting the partner behind a
+// payment's referral code, or false if it has none. A code that is no
+// longer configured earns nothing.
+func (s *server) referralCommission(p Payment, foundationCents int64) (LedgerEntry, bool) {
+	if p.ReferralCode == "" {
+		return LedgerEntry{}, false
+	}
+	partner, ok := s.cfg.Referrals.lookup(p.ReferralCode)
+	if !ok {
+		log.Printf("payment %s: referral code %s is no longer configured; no commission recorded", p.Ref, p.ReferralCode)
+		return LedgerEntry{}, false
+	}
+	cents := partner.commission(p.GrossCents, foundationCents)
+	if cents == 0 {
+		return LedgerEntry{}, false
+	}
+	return LedgerEntry{
+		PaymentRef:  p.Ref,
+		BookingID:   p.BookingID,
+		Category:    p.Category,
+		Kind:        EntryPartnerCommission,
+		Partner:     partner.ID,
+		AmountCents: cents,
+		Currency:    p.Currency,
+		Memo:        fmt.Sprintf("%s of %d for referral code %s", partner.CommissionRate, p.GrossCents, partner.Code),
+		CreatedAt:   p.PaidAt,
+	}, true
+}
+
+// PartnerEarnings is a partner's commission in one currency.
+type PartnerEarnings struct {
+	Currency        string `json:"currency"`
+	PaymentCount    int    `json:"payment_count"`
+	CommissionCents int64  `json:"commission_cents"`
+}
+
+// PartnerEarnings totals the commission recorded for partnerID, per
+// currency, with the entries behind it.
+func (l *Ledger) PartnerEarnings(partnerID string) ([]PartnerEarnings, []LedgerEntry) {
+	entries := l.Entries(func(e LedgerEntry) bool {
+		return e.Kind == EntryPartnerCommission && e.Partner == partnerID
+	})
+	totals := make(map[string]*PartnerEarnings)
+	for _, e := range entries {
+		t, ok := totals[e.Currency]
+		if !ok {
+			t = &PartnerEarnings{Currency: e.Currency}
+			totals[e.Currency] = t
+		}
+		t.PaymentCount++
+		t.CommissionCents += e.AmountCents
+	}
+	out := make([]PartnerEarnings, 0, len(totals))
+	for _, t := range totals {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Currency < out[j].Currency })
+	return out, entries
+}
+
+// getReferralHandler tells a guest whether a referral code is valid before
+// they book with it.
+func (s *server) getReferralHandler(w http.ResponseWriter, r *http.Request) {
+	partner, ok := s.cfg.Referrals.lookup(chi.URLParam(r, "code"))
+	if !ok {
+		respondError(w, http.StatusNotFound, "invalid_referral_code", "referral code not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"code":       partner.Code,
+		"partner_id": partner.ID,
+	})
+}
+
+// partnerEarningsHandler reports the commission a partner has earned.
+func (s *server) partnerEarningsHandler(w http.ResponseWriter, r *http.Request) {
+	partnerID := chi.URLParam(r, "partnerId")
+	totals, entries := s.ledger.PartnerEarnings(partnerID)
+	if entries == nil {
+		entries = []LedgerEntry{}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"partner_id": partnerID,
+		"totals":     totals,
+		"entries":    entries,
+	})
+}
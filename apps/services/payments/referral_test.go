@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func referredCheckoutCompleted(bookingID, code string) map[string]interface{} {
+	event := checkoutCompleted(bookingID)
+	object := event["data"].(map[string]interface{})["object"].(map[string]interface{})
+	object["metadata"] = map[string]string{"booking_id": bookingID, "category": CategoryTours, "referral_code": code}
+	return event
+}
+
+func TestReferralRecordsCommission(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	s.cfg.Referrals = Referrals{"SURFCLUB": {ID: "surf-club", Code: "SURFCLUB", CommissionRate: 8 * apitypes.OnePercent}}
+
+	var valid map[string]string
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/referrals/surfclub", nil, &valid); rec.Code != http.StatusOK || valid["partner_id"] != "surf-club" {
+		t.Fatalf("validate: status %d %v", rec.Code, valid)
+	}
+
+	req := testCheckout
+	req.ReferralCode = " surfclub "
+	if rec := postCheckout(t, s.routes(), "key-1", req); rec.Code != http.StatusOK {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	if form := stripe.forms[0]; form.Get("metadata[referral_code]") != "SURFCLUB" || form.Get("payment_intent_data[metadata][referral_code]") != "SURFCLUB" {
+		t.Fatalf("stripe metadata = %v, want referral_code SURFCLUB", form)
+	}
+
+	if rec := postStripeEvent(t, s, referredCheckoutCompleted("bk-1", "SURFCLUB"), testWebhookSecret, nil); rec.Code != http.StatusOK {
+		t.Fatalf("webhook: status %d: %s", rec.Code, rec.Body)
+	}
+	// 8% of 20000 comes out of the platform's net; the Foundation keeps 15%.
+	if got := s.ledger.FoundationTotal("pi_test_1"); got != 3000 {
+		t.Fatalf("foundation = %d, want 3000", got)
+	}
+	sum := s.DailySummary(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	if sum.FoundationCents != 3000 || sum.CommissionCents != 1600 || sum.NetCents != 15400 {
+		t.Fatalf("daily summary = %+v, want 3000 foundation, 1600 commission, 15400 net", sum)
+	}
+
+	var earnings struct {
+		PartnerID string            `json:"partner_id"`
+		Totals    []PartnerEarnings `json:"totals"`
+		Entries   []LedgerEntry     `json:"entries"`
+	}
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/partners/surf-club/earnings", nil, &earnings); rec.Code != http.StatusOK {
+		t.Fatalf("earnings: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(earnings.Totals) != 1 || earnings.Totals[0] != (PartnerEarnings{Currency: "USD", PaymentCount: 1, CommissionCents: 1600}) {
+		t.Fatalf("earnings totals = %+v", earnings.Totals)
+	}
+	if len(earnings.Entries) != 1 || earnings.Entries[0].PaymentRef != "pi_test_1" || earnings.Entries[0].Kind != EntryPartnerCommission {
+		t.Fatalf("earnings entries = %+v", earnings.Entries)
+	}
+}
+
+func TestUnknownReferralCodeIsIgnored(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	s.cfg.Referrals = Referrals{"SURFCLUB": {ID: "surf-club", Code: "SURFCLUB", CommissionRate: 8 * apitypes.OnePercent}}
+
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/payments/referrals/NOPE", nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("validate: status %d, want 404", rec.Code)
+	}
+	req := testCheckout
+	req.ReferralCode = "NOPE"
+	if rec := postCheckout(t, s.routes(), "key-1", req); rec.Code != http.StatusOK {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := stripe.forms[0]["metadata[referral_code]"]; ok {
+		t.Fatalf("unknown code reached stripe: %v", stripe.forms[0])
+	}
+
+	// A code dropped from configuration after checkout earns nothing either.
+	if rec := postStripeEvent(t, s, referredCheckoutCompleted("bk-1", "OLDCODE"), testWebhookSecret, nil); rec.Code != http.StatusOK {
+		t.Fatalf("webhook: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := s.ledger.CommissionTotal("pi_test_1"); got != 0 {
+		t.Fatalf("commission = %d, want none", got)
+	}
+	if sum := s.DailySummary(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)); sum.NetCents != 17000 {
+		t.Fatalf("net = %d, want 17000", sum.NetCents)
+	}
+}
+
+func TestReferralValidation(t *testing.T) {
+	t.Setenv("PARTNER_REFERRALS", "surfclub=surf-club:8%, BADENTRY")
+	if err := loadReferrals().validate(); err == nil {
+		t.Fatal("malformed entry accepted")
+	}
+	t.Setenv("PARTNER_REFERRALS", "surfclub=surf-club:8%, hostel=casa-verde:2.5%")
+	r := loadReferrals()
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := r.lookup("Hostel"); !ok || p.ID != "casa-verde" || p.CommissionRate != 250 {
+		t.Fatalf("lookup = %+v, %v", p, ok)
+	}
+	if err := (Referrals{"FREE": {ID: "x", Code: "FREE", CommissionRate: apitypes.HundredPercent}}).validate(); err == nil {
+		t.Fatal("100% commission accepted")
+	}
+}
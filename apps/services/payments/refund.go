@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrRefundNotSupported     = errors.New("payments on this rail cannot be refunded automatically")
+	ErrRefundCurrency         = errors.New("refund currency does not match the payment")
+	ErrRefundProviderRejected = errors.New("refund was not sent")
+)
+
+// Refund is a refund sent back over a payment's original rail.
+type Refund struct {
+	PaymentRef  string `json:"payment_ref"`
+	Rail        string `json:"rail"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	// AmountSats is what a Lightning refund paid, at the rate of the
+	// original invoice.
+	AmountSats  int64         `json:"amount_sats,omitempty"`
+	ProviderRef string        `json:"provider_ref"`
+	Entries     []LedgerEntry `json:"entries"`
+}
+
+// RefundPayment sends amountCents of a payment back the way it came and
+// books it in the ledger, which reverses the matching share of the
+// Foundation's allocation. Card payments are refunded through Stripe.
+// Lightning payments are paid to the guest's saved Lightning Address at
+// the rate the invoice was issued at. Nothing is recorded unless the
+// provider accepted the refund.
+func (s *server) RefundPayment(ctx context.Context, ref string, amount Money, guestEmail, reason string) (Refund, error) {
+	s.refundMu.Lock()
+	defer s.refundMu.Unlock()
+	p, err := s.ledger.Payment(ref)
+	if err != nil {
+		return Refund{}, err
+	}
+	if !strings.EqualFold(p.Currency, amount.Currency) {
+		return Refund{}, ErrRefundCurrency
+	}
+	refundable, err := s.ledger.Refundable(ref)
+	if err != nil {
+		return Refund{}, err
+	}
+	if amount.MinorUnits > refundable {
+		return Refund{}, ErrRefundExceeds
+	}
+
+	refund := Refund{PaymentRef: ref, Rail: p.Rail, AmountCents: amount.MinorUnits, Currency: p.Currency}
+	switch Rail(p.Rail) {
+	case RailCard:
+		refund.ProviderRef, err = s.sendStripeRefund(ctx, p, amount.MinorUnits, refundable, reason)
+	case RailLightning:
+		refund.AmountSats, refund.ProviderRef, err = s.sendLightningRefund(ctx, p, amount.MinorUnits, guestEmail)
+	default:
+		return Refund{}, ErrRefundNotSupported
+	}
+	if err != nil {
+		return Refund{}, err
+	}
+	if refund.Entries, err = s.ledger.RecordRefund(ref, amount.MinorUnits, reason, s.now()); err != nil {
+		log.Printf("ALERT: refund %s of %d cents on %s was sent but not booked: %v", refund.ProviderRef, amount.MinorUnits, ref, err)
+		return Refund{}, err
+	}
+	log.Printf("refunded %d cents of %s over %s (%s)", amount.MinorUnits, ref, p.Rail, refund.ProviderRef)
+	return refund, nil
+}
+
+// sendStripeRefund refunds part of a card payment's PaymentIntent. The
+// idempotency key is the payment and the amount still refundable before
+// this refund, so a retried request cannot refund twice while a second,
+// later refund gets a key of its own.
+func (s *server) sendStripeRefund(ctx context.Context, p Payment, cents, refundable int64, reason string) (string, error) {
+	if !s.stripe.configured() {
+		return "", fmt.Errorf("%w: Stripe is not configured", ErrRefundProviderRejected)
+	}
+	form := url.Values{
+		"payment_intent":        {p.Ref},
+		"amount":                {strconv.FormatInt(cents, 10)},
+		"metadata[booking_id]":  {p.BookingID},
+		"metadata[refund_note]": {reason},
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	key := fmt.Sprintf("refund-%s-%d-%d", p.Ref, refundable, cents)
+	if err := s.stripe.post(ctx, "/v1/refunds", form, key, &out); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRefundProviderRejected, err)
+	}
+	return out.ID, nil
+}
+
+// sendLightningRefund pays a Lightning refund to the guest's saved
+// Lightning Address, converting at the original invoice's rate so the
+// guest gets back the sats they paid for the refunded share.
+func (s *server) sendLightningRefund(ctx context.Context, p Payment, cents int64, guestEmail string) (sats int64, hash string, err error) {
+	if s.lnd == nil {
+		return 0, "", fmt.Errorf("%w: no Lightning node is configured", ErrRefundProviderRejected)
+	}
+	saved, err := s.refundAddresses.Get(guestEmail)
+	if err != nil {
+		return 0, "", err
+	}
+	inv, err := s.invoices.Get(p.Ref)
+	if err != nil || inv.AmountCents == 0 {
+		return 0, "", fmt.Errorf("%w: the original invoice is unknown", ErrRefundProviderRejected)
+	}
+	sats = BTCRate{AmountSats: inv.AmountSats, AmountCents: inv.AmountCents}.Sats(cents)
+	pr, err := s.lnurl.Resolve(ctx, saved.LightningAddress, sats)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: could not get an invoice from the guest's wallet: %v", ErrRefundProviderRejected, err)
+	}
+	hash, err = s.lnd.PayInvoice(ctx, pr)
+	s.lndHealth.observe(err, s.now())
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrRefundProviderRejected, err)
+	}
+	return sats, hash, nil
+}
+
+// createRefundHandler refunds a payment over its original rail. Body:
+// {"payment_ref": "...", "amount": "25.00" or "amount_cents": 2500,
+// "currency": "USD", "booking_id": "...", "reason": "...", "guest_email":
+// "..."}. The guest's email is needed to refund a Lightning payment, to
+// their saved Lightning Address.
+func (s *server) createRefundHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PaymentRef  string `json:"payment_ref"`
+		BookingID   string `json:"booking_id"`
+		Amount      string `json:"amount"`
+		AmountCents int64  `json:"amount_cents"`
+		Currency    string `json:"currency"`
+		Reason      string `json:"reason"`
+		GuestEmail  string `json:"guest_email"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.PaymentRef == "" {
+		respondError(w, http.StatusBadRequest, "invalid_refund", "payment_ref is required")
+		return
+	}
+	if req.Currency == "" {
+		req.Currency = "USD"
+	}
+	amount := Money{MinorUnits: req.AmountCents, Currency: strings.ToUpper(req.Currency)}
+	var err error
+	if req.Amount != "" {
+		amount, err = ParseMoney(req.Amount, req.Currency)
+	}
+	if err == nil && amount.MinorUnits <= 0 {
+		err = fmt.Errorf("%w: amount must be positive", ErrInvalidMoney)
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_amount", err.Error())
+		return
+	}
+
+	refund, err := s.RefundPayment(r.Context(), req.PaymentRef, amount, req.GuestEmail, req.Reason)
+	switch {
+	case errors.Is(err, ErrPaymentNotFound):
+		respondError(w, http.StatusNotFound, "payment_not_found", err.Error())
+	case errors.Is(err, ErrRefundExceeds), errors.Is(err, ErrRefundCurrency), errors.Is(err, ErrRefundNotSupported):
+		respondError(w, http.StatusUnprocessableEntity, "refund_rejected", err.Error())
+	case errors.Is(err, ErrNoLightningAddress):
+		respondError(w, http.StatusConflict, "refund_destination_required", "the guest has no saved Lightning Address to refund to")
+	case err != nil:
+		log.Printf("ALERT: refund of %d cents on %s failed: %v", amount.MinorUnits, req.PaymentRef, err)
+		respondError(w, http.StatusBadGateway, "refund_failed", err.Error())
+	default:
+		respondJSON(w, http.StatusOK, refund)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRefundCardPaymentThroughStripe(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	paidByCard(t, s)
+
+	var got Refund
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]interface{}{
+		"payment_ref": "pi_test_1", "booking_id": "bk-1", "amount_cents": 5000, "currency": "USD", "reason": "cancelled 10 days out",
+	}, &got)
+	if rec.Code != http.StatusOK || got.ProviderRef != "cs_1" || got.AmountCents != 5000 {
+		t.Fatalf("status %d refund %+v: %s", rec.Code, got, rec.Body)
+	}
+	form := stripe.forms[0]
+	if form.Get("payment_intent") != "pi_test_1" || form.Get("amount") != "5000" || stripe.keys[0] == "" {
+		t.Fatalf("stripe refund form %v key %q", form, stripe.keys[0])
+	}
+	if left, _ := s.ledger.Refundable("pi_test_1"); left != 15000 {
+		t.Fatalf("refundable = %d, want 15000", left)
+	}
+	// A quarter of the payment refunded takes back a quarter of the share.
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 2250 {
+		t.Fatalf("foundation held = %d, want 2250", held)
+	}
+}
+
+func TestRefundNotSentBooksNothing(t *testing.T) {
+	s, _ := newCheckoutTestServer(t, 1)
+	paidByCard(t, s)
+
+	var resp map[string]string
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]interface{}{"payment_ref": "pi_test_1", "amount_cents": 5000}, &resp)
+	if rec.Code != http.StatusBadGateway || resp["error"] != "refund_failed" {
+		t.Fatalf("status %d resp %v, want 502 refund_failed", rec.Code, resp)
+	}
+	if left, _ := s.ledger.Refundable("pi_test_1"); left != 20000 {
+		t.Fatalf("refundable = %d, want the whole payment", left)
+	}
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 3000 {
+		t.Fatalf("foundation held = %d, want 3000", held)
+	}
+}
+
+func TestRefundRejectsUnknownOrMismatchedPayment(t *testing.T) {
+	s, _ := newCheckoutTestServer(t, 0)
+	paidByCard(t, s)
+	s.commitPayment(Payment{Ref: "xfer_1", Category: CategoryTours, GrossCents: 20000, Currency: "USD", Rail: string(RailBankTransfer)})
+
+	cases := []struct {
+		body map[string]interface{}
+		want int
+	}{
+		{map[string]interface{}{"payment_ref": "pi_missing", "amount_cents": 100}, http.StatusNotFound},
+		{map[string]interface{}{"payment_ref": "pi_test_1", "amount_cents": 100, "currency": "EUR"}, http.StatusUnprocessableEntity},
+		{map[string]interface{}{"payment_ref": "xfer_1", "amount_cents": 100}, http.StatusUnprocessableEntity},
+	}
+	for _, c := range cases {
+		if rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", c.body, nil); rec.Code != c.want {
+			t.Errorf("%v: status %d, want %d", c.body, rec.Code, c.want)
+		}
+	}
+}
+
+func TestRefundNeedsAdminAndStopsAtAmountPaid(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	paidByCard(t, s)
+
+	body, _ := json.Marshal(map[string]interface{}{"payment_ref": "pi_test_1", "amount_cents": 5000})
+	anon := httptest.NewRecorder()
+	s.routes().ServeHTTP(anon, httptest.NewRequest(http.MethodPost, "/api/payments/refunds", bytes.NewReader(body)))
+	if anon.Code != http.StatusUnauthorized || len(stripe.forms) != 0 {
+		t.Fatalf("without admin key: status %d, %d refunds sent", anon.Code, len(stripe.forms))
+	}
+
+	if rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]interface{}{"payment_ref": "pi_test_1", "amount_cents": 15000}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("first refund: status %d: %s", rec.Code, rec.Body)
+	}
+	// $50 is left of the $200 paid.
+	var resp map[string]string
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]interface{}{"payment_ref": "pi_test_1", "amount_cents": 5001}, &resp)
+	if rec.Code != http.StatusUnprocessableEntity || resp["error"] != "refund_rejected" || len(stripe.forms) != 1 {
+		t.Fatalf("over-refund: status %d resp %v, %d refunds sent", rec.Code, resp, len(stripe.forms))
+	}
+}
+
+// refundLostCapacity answers payments for bookings that lost their seats as
+// the bookings service does: before answering, it asks for the payment back
+// with the guest's email. The status of each refund request is recorded.
+func refundLostCapacity(t *testing.T, s *server, guestEmail string) *[]int {
+	t.Helper()
+	var statuses []int
+	f := s.bookings.(*fakeBookings)
+	f.status = "failed_no_capacity"
+	f.onPayment = func(bookingID string, n PaymentNotice) {
+		rec := doJSON(t, s.routes(), http.MethodPost, "/api/payments/refunds", map[string]interface{}{
+			"payment_ref": n.PaymentRef, "booking_id": bookingID, "amount_cents": n.AmountCents,
+			"currency": n.Currency, "reason": "no_capacity", "guest_email": guestEmail,
+		}, nil)
+		statuses = append(statuses, rec.Code)
+	}
+	return &statuses
+}
+
+func TestLostCapacityCardPaymentIsRefunded(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	refunds := refundLostCapacity(t, s, "ana@example.com")
+
+	var resp map[string]string
+	rec := postStripeEvent(t, s, checkoutCompleted("bk-1"), testWebhookSecret, &resp)
+	if rec.Code != http.StatusOK || resp["booking_status"] != "failed_no_capacity" {
+		t.Fatalf("status %d resp %v", rec.Code, resp)
+	}
+	if len(*refunds) != 1 || (*refunds)[0] != http.StatusOK {
+		t.Fatalf("refund statuses %v, want one 200", *refunds)
+	}
+	if len(stripe.forms) != 1 || stripe.forms[0].Get("payment_intent") != "pi_test_1" || stripe.forms[0].Get("amount") != "20000" {
+		t.Fatalf("stripe refunds %v, want all of pi_test_1", stripe.forms)
+	}
+	if left, _ := s.ledger.Refundable("pi_test_1"); left != 0 {
+		t.Fatalf("refundable = %d, want 0", left)
+	}
+	if held := s.ledger.FoundationHeld("pi_test_1"); held != 0 {
+		t.Fatalf("foundation held = %d, want the share reversed", held)
+	}
+
+	// Stripe redelivers the event; bookings answers 409 and nothing is
+	// booked twice.
+	s.bookings.(*fakeBookings).onPayment = nil
+	s.bookings.(*fakeBookings).err = &BookingsError{Status: http.StatusConflict, Code: "invalid_state"}
+	postStripeEvent(t, s, checkoutCompleted("bk-1"), testWebhookSecret, nil)
+	if p, _ := s.ledger.Payment("pi_test_1"); p.GrossCents != 20000 {
+		t.Fatalf("payment = %+v", p)
+	}
+	if left, _ := s.ledger.Refundable("pi_test_1"); left != 0 {
+		t.Fatalf("refundable after redelivery = %d, want 0", left)
+	}
+}
+
+func TestLostCapacityLightningPaymentIsRefunded(t *testing.T) {
+	s, lnd := newLightningTestServer(t)
+	s.lnurl = testResolver()
+	wallet := newFakeWallet(t)
+	s.refundAddresses.Put(SavedLightningAddress{GuestEmail: "ana@example.com", LightningAddress: wallet.address()})
+	refunds := refundLostCapacity(t, s, "ana@example.com")
+
+	inv := createInvoice(t, s, "bk-ln", 100000, 5000)
+	lnd.settle(inv.RHash, 100000, time.Date(2026, 4, 20, 9, 0, 0, 0, time.UTC))
+	if got := reconcile(t, s, "from=2026-04-01&to=2026-04-30&auto_confirm=true").Reconciliation; got.Confirmed != 1 {
+		t.Fatalf("confirmed = %d, want 1", got.Confirmed)
+	}
+	if len(*refunds) != 1 || (*refunds)[0] != http.StatusOK {
+		t.Fatalf("refund statuses %v, want one 200", *refunds)
+	}
+	if len(lnd.paid) != 1 || lnd.paid[0] != "lnbc-refund-100000000" {
+		t.Fatalf("paid %v, want the whole payment back to the guest's wallet", lnd.paid)
+	}
+	if left, _ := s.ledger.Refundable(inv.RHash); left != 0 {
+		t.Fatalf("refundable = %d, want 0", left)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+)
+
+// stripeClient is a thin client for Stripe's form-encoded REST API.
+type stripeClient struct {
+	secretKey string
+	baseURL   string
+	client    *outbound.Client
+}
+
+func newStripeClient(secretKey, baseURL string) *stripeClient {
+	return &stripeClient{
+		secretKey: secretKey,
+		baseURL:   baseURL,
+		client:    outbound.NewClient("stripe", 20*time.Second),
+	}
+}
+
+// configured reports whether the client has a secret key to call Stripe
+// with.
+func (c *stripeClient) configured() bool {
+	return c.secretKey != ""
+}
+
+// stripeError is the error object Stripe returns for non-2xx responses.
+type stripeError struct {
+	Status  int    `json:"-"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *stripeError) Error() string {
+	return fmt.Sprintf("stripe: %d %s: %s", e.Status, e.Type, e.Message)
+}
+
+// post sends form to the given API path and decodes the response into out.
+// Stripe deduplicates requests that share an idempotency key, which makes the
+// call safe to retry.
+func (c *stripeClient) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	body := form.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		captureExchange(ctx, newProviderExchange("stripe", DirectionOutbound, req, []byte(body), 0, nil, err))
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	captureExchange(ctx, newProviderExchange("stripe", DirectionOutbound, req, []byte(body), resp.StatusCode, respBody, err))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var envelope struct {
+			Error stripeError `json:"error"`
+		}
+		json.Unmarshal(respBody, &envelope)
+		envelope.Error.Status = resp.StatusCode
+		return &envelope.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
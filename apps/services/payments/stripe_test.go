@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+)
+
+func TestStripeClientRecordsDuration(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); user != "sk_test_123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":"re_1"}`))
+	}))
+	defer api.Close()
+
+	reg := prometheus.NewRegistry()
+	c := newStripeClient("sk_test_123", api.URL)
+	c.client.Metrics = outbound.NewMetrics(reg)
+
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := c.post(context.Background(), "/v1/refunds", url.Values{"payment_intent": {"pi_1"}}, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != "re_1" {
+		t.Fatalf("id = %q", out.ID)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "external_request_duration_seconds" {
+			continue
+		}
+		m := f.GetMetric()[0]
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "integration" && l.GetValue() != "stripe" {
+				t.Fatalf("integration label = %q, want stripe", l.GetValue())
+			}
+		}
+		if m.GetHistogram().GetSampleCount() != 1 {
+			t.Fatalf("sample count = %d, want 1", m.GetHistogram().GetSampleCount())
+		}
+		return
+	}
+	t.Fatal("duration histogram not recorded")
+}
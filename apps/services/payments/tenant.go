@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// Tenant is one brand the platform serves: a regional marketplace with its
+// own currency, web origins and branding. FoundationRate, when set,
+// replaces the Foundation policy's rates for the tenant's payments.
+type Tenant struct {
+	ID             string           `json:"id"`
+	Name           string           `json:"name"`
+	Currency       string           `json:"currency"`
+	FoundationRate apitypes.Percent `json:"foundation_rate,omitempty"`
+	CORSOrigins    []string         `json:"cors_origins"`
+	Branding       Branding         `json:"branding"`
+}
+
+func (t Tenant) TenantID() string         { return t.ID }
+func (t Tenant) AllowedOrigins() []string { return t.CORSOrigins }
+
+// Branding is how a tenant's storefront and messages present it.
+type Branding struct {
+	LogoURL      string `json:"logo_url,omitempty"`
+	PrimaryColor string `json:"primary_color,omitempty"`
+	SupportEmail string `json:"support_email,omitempty"`
+}
+
+// Tenants are the brands served, by id.
+type Tenants = tenantkit.Tenants[Tenant]
+
+// builtinTenant is the single tenant served without a tenants file.
+var builtinTenant = Tenant{
+	ID:          tenantkit.DefaultID,
+	Name:        "PupuserIA",
+	Currency:    "USD",
+	CORSOrigins: tenantkit.LocalOrigins,
+}
+
+// loadTenants reads the tenants from the JSON file at path, which maps
+// tenant ids to their settings: {"pupuseria": {"name": "PupuserIA",
+// "currency": "USD", "foundation_rate": "15%"}}. Without a file the
+// built-in PupuserIA tenant is served. defaultID, when set, must name one
+// of the tenants.
+func loadTenants(path, defaultID string) (Tenants, error) {
+	return tenantkit.Load(path, defaultID, builtinTenant, func(id string, t Tenant) (Tenant, error) {
+		t.ID = id
+		t.Currency = strings.ToUpper(t.Currency)
+		if len(t.Currency) != 3 {
+			return t, errors.New("needs a three-letter currency")
+		}
+		return t, nil
+	})
+}
+
+// foundationPolicy is the Foundation policy for tenant's payments: the
+// configured one, at the tenant's own rate for every category when it
+// sets one.
+func (c config) foundationPolicy(tenant Tenant) FoundationPolicy {
+	p := c.Foundation
+	if tenant.FoundationRate != 0 {
+		p.DefaultRate, p.CategoryRates = tenant.FoundationRate, nil
+	}
+	return p
+}
+
+// validateTenants checks each tenant's Foundation rate keeps to the
+// charter.
+func (c config) validateTenants() error {
+	for _, t := range c.Tenants.All() {
+		if err := c.foundationPolicy(t).validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// tenant returns the tenant ctx's request is for, or the default tenant
+// outside a request.
+func (s *server) tenant(ctx context.Context) Tenant {
+	if tenant, ok := tenantkit.FromContext[Tenant](ctx); ok {
+		return tenant
+	}
+	return s.cfg.Tenants.Default()
+}
+
+// tenantByID returns the tenant a payment was recorded for. Payments from
+// before tenants were recorded, or for a tenant no longer served, belong
+// to the default tenant.
+func (s *server) tenantByID(id string) Tenant {
+	if tenant, ok := s.cfg.Tenants.Lookup(id); ok {
+		return tenant
+	}
+	return s.cfg.Tenants.Default()
+}
+
+// withTenant acts for the tenant with the given id in ctx, as when settling
+// a payment outside the request that started it.
+func (s *server) withTenant(ctx context.Context, id string) context.Context {
+	return tenantkit.WithTenant(ctx, s.tenantByID(id))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+const testTenants = `{
+	"pupuseria": {"name": "PupuserIA", "currency": "USD"},
+	"volcanica": {"name": "Volcánica", "currency": "eur", "foundation_rate": "12%"}
+}`
+
+// withTestTenants serves PupuserIA, the default, and Volcánica, which
+// gives the Foundation 12%.
+func withTestTenants(t *testing.T, s *server) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(testTenants), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := loadTenants(path, "pupuseria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.Tenants = tenants
+	if err := s.cfg.validateTenants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tenantGet(t *testing.T, s *server, tenant, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(tenantkit.Header, tenant)
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTenantFoundationRateAppliesToItsPayments(t *testing.T) {
+	s := newTestServer(t)
+	withTestTenants(t, s)
+
+	for tenant, want := range map[string]int64{"volcanica": 2400, "pupuseria": 3000} {
+		event := checkoutCompleted("bk-" + tenant)
+		object := event["data"].(map[string]interface{})["object"].(map[string]interface{})
+		object["payment_intent"] = "pi_" + tenant
+		object["metadata"] = map[string]string{"booking_id": "bk-" + tenant, "category": CategoryTours, "tenant": tenant}
+		if rec := postStripeEvent(t, s, event, testWebhookSecret, nil); rec.Code != http.StatusOK {
+			t.Fatalf("%s webhook: status %d: %s", tenant, rec.Code, rec.Body)
+		}
+		p, err := s.ledger.Payment("pi_" + tenant)
+		if err != nil || p.Tenant != tenant || s.ledger.FoundationTotal(p.Ref) != want {
+			t.Errorf("%s payment %+v (%v), Foundation %d; want %d", tenant, p, err, s.ledger.FoundationTotal(p.Ref), want)
+		}
+	}
+
+	var estimate foundationEstimate
+	rec := tenantGet(t, s, "volcanica", "/api/payments/foundation/estimate?amount=100.00&type=tours")
+	if err := json.Unmarshal(rec.Body.Bytes(), &estimate); err != nil {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if estimate.Rate != 12*apitypes.OnePercent || estimate.FoundationCents != 1200 || estimate.Currency != "EUR" {
+		t.Fatalf("estimate = %+v, want 12%% in EUR", estimate)
+	}
+}
+
+func TestCheckoutRecordsTenantForTheWebhook(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	withTestTenants(t, s)
+	req := testCheckout
+	req.Currency = ""
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/payments/checkout", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminKey)
+	r.Header.Set("Idempotency-Key", "booking-bk-1-checkout")
+	r.Header.Set(tenantkit.Header, "volcanica")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	form := stripe.forms[0]
+	if form.Get("metadata[tenant]") != "volcanica" || form.Get("payment_intent_data[metadata][tenant]") != "volcanica" ||
+		form.Get("line_items[0][price_data][currency]") != "eur" {
+		t.Fatalf("session form %v, want volcanica's tenant and currency", form)
+	}
+}
+
+func TestUnknownTenantIsRejected(t *testing.T) {
+	s := newTestServer(t)
+	withTestTenants(t, s)
+	if rec := tenantGet(t, s, "acme", "/api/payments/rails"); rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", rec.Code)
+	}
+}
+
+func TestTenantFoundationRateMustKeepToCharter(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Tenants = tenantkit.New("acme", Tenant{ID: "acme", Currency: "USD", FoundationRate: 25 * apitypes.OnePercent})
+	if err := s.cfg.validateTenants(); err == nil {
+		t.Fatal("25% tenant Foundation rate accepted")
+	}
+}
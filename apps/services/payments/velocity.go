@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// Checkout attempts are counted per guest, client IP and card.
+const (
+	VelocityGuest = "guest"
+	VelocityIP    = "ip"
+	VelocityCard  = "card"
+)
+
+// VelocityPolicy limits how many checkouts one guest, IP address or card
+// may start within Window. A zero limit leaves that dimension unchecked.
+// With FlagOnly, checkouts over a limit are logged rather than refused.
+type VelocityPolicy struct {
+	Window      time.Duration
+	MaxPerGuest int
+	MaxPerIP    int
+	MaxPerCard  int
+	FlagOnly    bool
+}
+
+// loadVelocityPolicy reads CHECKOUT_VELOCITY_WINDOW, the per-dimension
+// CHECKOUT_VELOCITY_MAX_PER_{GUEST,IP,CARD} and CHECKOUT_VELOCITY_MODE
+// ("block" or "flag").
+func loadVelocityPolicy() VelocityPolicy {
+	return VelocityPolicy{
+		Window:      httpkit.TimeoutFromEnv("CHECKOUT_VELOCITY_WINDOW", 10*time.Minute),
+		MaxPerGuest: int(envInt64("CHECKOUT_VELOCITY_MAX_PER_GUEST", 5)),
+		MaxPerIP:    int(envInt64("CHECKOUT_VELOCITY_MAX_PER_IP", 20)),
+		MaxPerCard:  int(envInt64("CHECKOUT_VELOCITY_MAX_PER_CARD", 3)),
+		FlagOnly:    strings.EqualFold(envString("CHECKOUT_VELOCITY_MODE", "block"), "flag"),
+	}
+}
+
+func (p VelocityPolicy) limit(dimension string) int {
+	switch dimension {
+	case VelocityGuest:
+		return p.MaxPerGuest
+	case VelocityIP:
+		return p.MaxPerIP
+	case VelocityCard:
+		return p.MaxPerCard
+	}
+	return 0
+}
+
+// velocityAttempt is one checkout counted against a guest, IP or card.
+type velocityAttempt struct {
+	key string
+	at  time.Time
+}
+
+// velocityTracker counts recent checkout attempts by dimension and value,
+// e.g. "guest:ana@example.com".
+type velocityTracker struct {
+	mu       sync.Mutex
+	attempts map[string][]velocityAttempt
+}
+
+func newVelocityTracker() *velocityTracker {
+	return &velocityTracker{attempts: make(map[string][]velocityAttempt)}
+}
+
+// velocityExceeded describes the limit a checkout went over.
+type velocityExceeded struct {
+	Dimension  string
+	Limit      int
+	RetryAfter time.Duration
+}
+
+// Check counts a checkout made with idempotencyKey against each of its
+// identities (dimension to value), unless one is already at its limit. A
+// retry of a key already counted passes and is not counted again, so
+// legitimate retries are never penalised.
+func (t *velocityTracker) Check(p VelocityPolicy, identities map[string]string, idempotencyKey string, now time.Time) (velocityExceeded, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since := now.Add(-p.Window)
+	var ids []string
+	for _, dim := range []string{VelocityGuest, VelocityIP, VelocityCard} {
+		v := identities[dim]
+		if v == "" || p.limit(dim) <= 0 {
+			continue
+		}
+		id := dim + ":" + v
+		kept := t.attempts[id][:0]
+		for _, a := range t.attempts[id] {
+			if a.at.After(since) {
+				kept = append(kept, a)
+			}
+		}
+		t.attempts[id] = kept
+		if len(kept) == 0 {
+			delete(t.attempts, id)
+		}
+		for _, a := range kept {
+			if a.key == idempotencyKey {
+				return velocityExceeded{}, false
+			}
+		}
+		ids = append(ids, id)
+	}
+
+	for _, id := range ids {
+		dim, _, _ := strings.Cut(id, ":")
+		if recent := t.attempts[id]; len(recent) >= p.limit(dim) {
+			return velocityExceeded{
+				Dimension:  dim,
+				Limit:      p.limit(dim),
+				RetryAfter: recent[len(recent)-p.limit(dim)].at.Add(p.Window).Sub(now),
+			}, true
+		}
+	}
+	for _, id := range ids {
+		t.attempts[id] = append(t.attempts[id], velocityAttempt{key: idempotencyKey, at: now})
+	}
+	return velocityExceeded{}, false
+}
+
+// checkoutIdentities are the guest, IP and card a checkout request is
+// counted against. The guest falls back to the booking when no email is
+// given.
+func checkoutIdentities(r *http.Request, req CheckoutRequest) map[string]string {
+	guest := strings.ToLower(strings.TrimSpace(req.GuestEmail))
+	if guest == "" {
+		guest = "booking/" + req.BookingID
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return map[string]string{
+		VelocityGuest: guest,
+		VelocityIP:    ip,
+		VelocityCard:  req.CardFingerprint,
+	}
+}
+
+// checkVelocity applies the checkout velocity policy to req, writing a 429
+// and returning false when it is refused.
+func (s *server) checkVelocity(w http.ResponseWriter, r *http.Request, req CheckoutRequest, idempotencyKey string) bool {
+	ids := checkoutIdentities(r, req)
+	exceeded, over := s.velocity.Check(s.cfg.CheckoutVelocity, ids, idempotencyKey, s.now())
+	if !over {
+		return true
+	}
+	log.Printf("checkout velocity: %s %s over %d checkouts in %s (booking %s)",
+		exceeded.Dimension, ids[exceeded.Dimension], exceeded.Limit, s.cfg.CheckoutVelocity.Window, req.BookingID)
+	if s.cfg.CheckoutVelocity.FlagOnly {
+		return true
+	}
+	retry := int(exceeded.RetryAfter.Round(time.Second) / time.Second)
+	w.Header().Set("Retry-After", fmt.Sprint(max(retry, 1)))
+	respondError(w, http.StatusTooManyRequests, "velocity_exceeded",
+		fmt.Sprintf("too many checkout attempts for this %s; try again later", exceeded.Dimension))
+	return false
+}
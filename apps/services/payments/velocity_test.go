@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckoutVelocityRefusesRapidAttempts(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 0)
+	s.cfg.CheckoutVelocity = VelocityPolicy{Window: 10 * time.Minute, MaxPerGuest: 2, MaxPerIP: 10}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	h := s.routes()
+
+	req := testCheckout
+	req.GuestEmail = "ana@example.com"
+	for i := 1; i <= 2; i++ {
+		req.BookingID = fmt.Sprintf("bk-%d", i)
+		if rec := postCheckout(t, h, req.BookingID, req); rec.Code != http.StatusOK {
+			t.Fatalf("checkout %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+	}
+	req.BookingID = "bk-3"
+	rec := postCheckout(t, h, "bk-3", req)
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), `"velocity_exceeded"`) {
+		t.Fatalf("third checkout: status %d: %s, want 429 velocity_exceeded", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") != "600" || stripe.created != 2 {
+		t.Fatalf("Retry-After %q after %d sessions", rec.Header().Get("Retry-After"), stripe.created)
+	}
+
+	// The same guest by another spelling is still the same guest.
+	req.GuestEmail = "ANA@example.com"
+	if rec := postCheckout(t, h, "bk-3b", req); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("re-cased email: status %d, want 429", rec.Code)
+	}
+
+	// Once the window has passed, the guest may check out again.
+	now = now.Add(10*time.Minute + time.Second)
+	if rec := postCheckout(t, h, "bk-3", req); rec.Code != http.StatusOK {
+		t.Fatalf("after window: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCheckoutVelocityIgnoresIdempotentRetries(t *testing.T) {
+	s, stripe := newCheckoutTestServer(t, 1)
+	s.cfg.CheckoutVelocity = VelocityPolicy{Window: 10 * time.Minute, MaxPerGuest: 1}
+	h := s.routes()
+
+	// The first try fails at Stripe; the guest retries with the same key.
+	req := testCheckout
+	req.GuestEmail = "ana@example.com"
+	if rec := postCheckout(t, h, "booking-bk-1-checkout", req); rec.Code != http.StatusBadGateway {
+		t.Fatalf("first try: status %d, want 502", rec.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if rec := postCheckout(t, h, "booking-bk-1-checkout", req); rec.Code != http.StatusOK {
+			t.Fatalf("retry %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+	}
+	if stripe.created != 1 {
+		t.Fatalf("sessions created = %d, want 1", stripe.created)
+	}
+
+	// A new key is a new attempt and over the limit.
+	req.BookingID = "bk-2"
+	if rec := postCheckout(t, h, "booking-bk-2-checkout", req); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("new key: status %d, want 429", rec.Code)
+	}
+}
+
+func TestCheckoutVelocityFlagOnly(t *testing.T) {
+	s, _ := newCheckoutTestServer(t, 0)
+	s.cfg.CheckoutVelocity = VelocityPolicy{Window: 10 * time.Minute, MaxPerCard: 1, FlagOnly: true}
+	h := s.routes()
+
+	req := testCheckout
+	req.CardFingerprint = "fp_123"
+	for i := 1; i <= 3; i++ {
+		req.BookingID = fmt.Sprintf("bk-%d", i)
+		if rec := postCheckout(t, h, req.BookingID, req); rec.Code != http.StatusOK {
+			t.Fatalf("checkout %d: status %d, want flagged but allowed", i, rec.Code)
+		}
+	}
+}
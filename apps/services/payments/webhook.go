@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+var ErrBadSignature = errors.New("stripe signature does not match any webhook secret")
+
+const (
+	// stripeSignatureTolerance is how old a signed timestamp may be, which
+	// bounds replays of a captured event.
+	stripeSignatureTolerance = 5 * time.Minute
+	// maxWebhookBytes bounds a webhook body read before it is verified.
+	maxWebhookBytes = 1 << 20
+)
+
+// verifyStripeSignature checks a Stripe-Signature header ("t=...,v1=...")
+// against payload. The signature is valid when any v1 entry matches any of
+// secrets, so events signed with either secret verify while one is being
+// rotated out.
+func verifyStripeSignature(payload []byte, header string, secrets []string, now time.Time) error {
+	var (
+		timestamp  string
+		signatures [][]byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return ErrBadSignature
+	}
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(payload)
+		expected := mac.Sum(nil)
+		for _, sig := range signatures {
+			if hmac.Equal(sig, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrBadSignature
+}
+
+// stripeEvent is the subset of a Stripe webhook event the service reads.
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object stripeEventObject `json:"object"`
+	} `json:"data"`
+}
+
+// stripeEventObject covers Checkout Sessions, PaymentIntents and Disputes.
+type stripeEventObject struct {
+	ID             string            `json:"id"`
+	PaymentIntent  string            `json:"payment_intent"`
+	AmountTotal    int64             `json:"amount_total"`
+	AmountReceived int64             `json:"amount_received"`
+	Currency       string            `json:"currency"`
+	Metadata       map[string]string `json:"metadata"`
+	// Dispute fields: the disputed charge and amount, the guest's stated
+	// reason and the dispute's status.
+	Charge string `json:"charge"`
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+	Status string `json:"status"`
+}
+
+// paymentNotice extracts the booking and charge from a successful payment
+// event.
+func (o stripeEventObject) paymentNotice() (string, PaymentNotice) {
+	n := PaymentNotice{
+		PaymentRef:  o.ID,
+		AmountCents: o.AmountTotal,
+		Currency:    strings.ToUpper(o.Currency),
+	}
+	// Refunds are issued against the PaymentIntent, so prefer it as the ref.
+	if o.PaymentIntent != "" {
+		n.PaymentRef = o.PaymentIntent
+	}
+	if n.AmountCents == 0 {
+		n.AmountCents = o.AmountReceived
+	}
+	return o.Metadata["booking_id"], n
+}
+
+// stripeWebhookHandler hands successful payments to the bookings service,
+// which re-checks that the booking still has its seats before confirming and
+// refunds it if not. Manual-capture payments are only recorded as
+// authorizations until captured. Dispute events are handled by
+// HandleDispute, and Checkout Sessions that expire or whose payment fails
+// by paymentFailureWebhook.
+func (s *server) stripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if len(s.cfg.StripeWebhookSecrets) == 0 {
+		respondError(w, http.StatusServiceUnavailable, "webhook_not_configured", "no Stripe webhook secret is configured")
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		respondError(w, http.StatusRequestEntityTooLarge, "body_too_large", "webhook body is too large")
+		return
+	}
+	if err := verifyStripeSignature(payload, r.Header.Get("Stripe-Signature"), s.cfg.StripeWebhookSecrets, s.now()); err != nil {
+		log.Printf("stripe webhook from %s rejected: %v", r.RemoteAddr, err)
+		respondError(w, http.StatusBadRequest, "invalid_signature", err.Error())
+		return
+	}
+	// Stripe events carry far more than stripeEvent models, so unknown
+	// fields are tolerated here rather than decoded with DecodeJSON.
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_json", "request body must be valid JSON")
+		return
+	}
+	switch event.Type {
+	case "checkout.session.completed", "payment_intent.succeeded":
+	case "charge.dispute.created", "charge.dispute.closed":
+		s.disputeWebhook(w, r, event, payload)
+		return
+	case "checkout.session.expired", "checkout.session.async_payment_failed":
+		s.paymentFailureWebhook(w, r, event, payload)
+		return
+	default:
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	bookingID, notice := event.Data.Object.paymentNotice()
+	// File the event, and the Checkout Session it completes, under the
+	// payment it settles.
+	s.payloads.Link(event.Data.Object.ID, notice.PaymentRef)
+	s.payloads.Add(notice.PaymentRef, newProviderExchange("stripe", DirectionInbound, r, payload, 0, nil, nil))
+	if bookingID == "" {
+		log.Printf("stripe event %s (%s) has no booking_id metadata", event.ID, event.Type)
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	// Stripe does not say which tenant the payment is for; the checkout
+	// recorded it in the metadata.
+	tenant := event.Data.Object.Metadata["tenant"]
+	payment := Payment{
+		Ref:        notice.PaymentRef,
+		Tenant:     s.tenantByID(tenant).ID,
+		BookingID:  bookingID,
+		Category:   event.Data.Object.Metadata["category"],
+		GrossCents: notice.AmountCents,
+		Currency:   notice.Currency,
+		Rail:       string(RailCard),
+		PaidAt:     apitypes.JSONTime{Time: s.now()},
+
+		ReferralCode: event.Data.Object.Metadata["referral_code"],
+	}
+	manual := event.Data.Object.Metadata["capture"] == captureManual
+	if !manual {
+		// The money is ours whatever bookings makes of it, and a booking
+		// that lost its seats asks for this payment back before answering.
+		s.commitPayment(payment)
+	}
+	status, err := s.bookings.RecordPayment(s.withTenant(r.Context(), tenant), bookingID, notice)
+	var berr *BookingsError
+	switch {
+	case errors.As(err, &berr) && berr.Status == http.StatusConflict:
+		// Stripe redelivers events; the booking already left pending.
+		respondJSON(w, http.StatusOK, map[string]string{"status": "duplicate", "booking_id": bookingID})
+		return
+	case err != nil:
+		// A non-2xx answer makes Stripe retry the event later.
+		log.Printf("stripe event %s: recording payment for booking %s failed: %v", event.ID, bookingID, err)
+		respondError(w, http.StatusBadGateway, "bookings_unavailable", "could not record payment with bookings service")
+		return
+	}
+	if manual {
+		// Only authorized: the ledger waits for the capture, and a
+		// booking that lost its seats is released rather than refunded.
+		s.authorize(payment)
+		if status == "failed_no_capacity" {
+			if _, err := s.Void(r.Context(), payment.Ref); err != nil {
+				log.Printf("ALERT: booking %s lost its seats but authorization %s could not be voided: %v", bookingID, payment.Ref, err)
+			}
+		}
+	}
+	respondJSON(w, http.StatusOK, map[string]string{
+		"status":         "processed",
+		"booking_id":     bookingID,
+		"booking_status": status,
+	})
+}
+
+// disputeWebhook applies a dispute event. Disputes on payments we have no
+// record of are acknowledged so Stripe stops sending them, and raised with
+// staff.
+func (s *server) disputeWebhook(w http.ResponseWriter, r *http.Request, event stripeEvent, payload []byte) {
+	d, err := s.HandleDispute(r.Context(), event.Type, event.Data.Object)
+	if errors.Is(err, ErrPaymentNotFound) {
+		log.Printf("ALERT: stripe event %s: %v", event.ID, err)
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+	if d.PaymentRef != "" {
+		s.payloads.Add(d.PaymentRef, newProviderExchange("stripe", DirectionInbound, r, payload, 0, nil, nil))
+	}
+	if err != nil {
+		// A non-2xx answer makes Stripe retry the event later.
+		log.Printf("stripe event %s: %v", event.ID, err)
+		respondError(w, http.StatusBadGateway, "dispute_not_recorded", "could not record dispute")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{
+		"status":         "processed",
+		"booking_id":     d.BookingID,
+		"dispute_status": d.Status,
+	})
+}
+
+// paymentFailureWebhook tells bookings a Checkout Session will never be
+// paid, so the booking's seats go back on sale. Only these terminal events
+// count: a declined card within a session can still be retried by the
+// guest. Bookings frees the seats once, so a redelivered event is
+// harmless; a booking that was paid some other way answers 409 and the
+// event is acknowledged.
+func (s *server) paymentFailureWebhook(w http.ResponseWriter, r *http.Request, event stripeEvent, payload []byte) {
+	o := event.Data.Object
+	s.payloads.Add(o.ID, newProviderExchange("stripe", DirectionInbound, r, payload, 0, nil, nil))
+	bookingID := o.Metadata["booking_id"]
+	if bookingID == "" {
+		log.Printf("stripe event %s (%s) has no booking_id metadata", event.ID, event.Type)
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	status, err := s.bookings.RecordPaymentFailure(s.withTenant(r.Context(), o.Metadata["tenant"]), bookingID, PaymentFailureNotice{
+		PaymentRef: o.ID,
+		Source:     string(RailCard),
+		Reason:     event.Type,
+	})
+	var berr *BookingsError
+	switch {
+	case errors.As(err, &berr) && berr.Status == http.StatusConflict:
+		log.Printf("stripe event %s: booking %s is no longer awaiting payment; seats kept", event.ID, bookingID)
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ignored", "booking_id": bookingID})
+		return
+	case err != nil:
+		// A non-2xx answer makes Stripe retry the event later.
+		log.Printf("stripe event %s: recording payment failure for booking %s failed: %v", event.ID, bookingID, err)
+		respondError(w, http.StatusBadGateway, "bookings_unavailable", "could not record payment failure with bookings service")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{
+		"status":         "processed",
+		"booking_id":     bookingID,
+		"booking_status": status,
+	})
+}
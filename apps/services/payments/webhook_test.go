@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// signStripe builds a Stripe-Signature header for payload signed with secret
+// at time at.
+func signStripe(payload []byte, secret string, at time.Time) string {
+	ts := fmt.Sprint(at.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postStripeEvent delivers event to the webhook signed with secret, as
+// Stripe would, and decodes the response into out when out is non-nil.
+func postStripeEvent(t *testing.T, s *server, event interface{}, secret string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook/stripe", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", signStripe(payload, secret, s.now()))
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func checkoutCompleted(bookingID string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   "evt_1",
+		"type": "checkout.session.completed",
+		"data": map[string]interface{}{
+			"object": map[string]interface{}{
+				"id":             "cs_test_1",
+				"payment_intent": "pi_test_1",
+				"amount_total":   20000,
+				"currency":       "usd",
+				"metadata":       map[string]string{"booking_id": bookingID},
+			},
+		},
+	}
+}
+
+func TestStripeWebhookConfirmsBooking(t *testing.T) {
+	s := newTestServer(t)
+	var resp map[string]string
+	rec := postStripeEvent(t, s, checkoutCompleted("bk-1"), testWebhookSecret, &resp)
+	if rec.Code != http.StatusOK || resp["booking_status"] != "confirmed" {
+		t.Fatalf("status %d resp %v", rec.Code, resp)
+	}
+	got := s.bookings.(*fakeBookings).payments["bk-1"]
+	if got != (PaymentNotice{PaymentRef: "pi_test_1", AmountCents: 20000, Currency: "USD"}) {
+		t.Fatalf("payment notice = %+v", got)
+	}
+}
+
+func TestStripeWebhookReportsLostCapacity(t *testing.T) {
+	s := newTestServer(t)
+	s.bookings.(*fakeBookings).status = "failed_no_capacity"
+	var resp map[string]string
+	rec := postStripeEvent(t, s, checkoutCompleted("bk-2"), testWebhookSecret, &resp)
+	if rec.Code != http.StatusOK || resp["booking_status"] != "failed_no_capacity" {
+		t.Fatalf("status %d resp %v", rec.Code, resp)
+	}
+}
+
+func TestStripeWebhookRetriesWhenBookingsDown(t *testing.T) {
+	s := newTestServer(t)
+	s.bookings.(*fakeBookings).err = &BookingsError{Status: http.StatusServiceUnavailable}
+	rec := postStripeEvent(t, s, checkoutCompleted("bk-3"), testWebhookSecret, nil)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502 so Stripe redelivers", rec.Code)
+	}
+
+	s.bookings.(*fakeBookings).err = &BookingsError{Status: http.StatusConflict, Code: "invalid_state"}
+	var resp map[string]string
+	postStripeEvent(t, s, checkoutCompleted("bk-3"), testWebhookSecret, &resp)
+	if resp["status"] != "duplicate" {
+		t.Fatalf("redelivered event resp %v, want duplicate", resp)
+	}
+}
+
+func TestStripeWebhookReleasesExpiredCheckout(t *testing.T) {
+	s := newTestServer(t)
+	event := checkoutCompleted("bk-1")
+	event["type"] = "checkout.session.expired"
+	// Stripe redelivers events; each is forwarded and bookings frees the
+	// seats only once.
+	for i := 0; i < 2; i++ {
+		var resp map[string]string
+		rec := postStripeEvent(t, s, event, testWebhookSecret, &resp)
+		if rec.Code != http.StatusOK || resp["booking_status"] != "payment_failed" {
+			t.Fatalf("delivery %d: status %d resp %v", i+1, rec.Code, resp)
+		}
+	}
+	fake := s.bookings.(*fakeBookings)
+	want := PaymentFailureNotice{PaymentRef: "cs_test_1", Source: "card", Reason: "checkout.session.expired"}
+	if got := fake.failures["bk-1"]; len(got) != 2 || got[0] != want {
+		t.Fatalf("failure notices = %+v", got)
+	}
+	if _, ok := fake.payments["bk-1"]; ok {
+		t.Fatal("expired checkout was recorded as a payment")
+	}
+
+	// A booking that was paid by then keeps its seats.
+	fake.err = &BookingsError{Status: http.StatusConflict, Code: "invalid_state"}
+	var resp map[string]string
+	if rec := postStripeEvent(t, s, event, testWebhookSecret, &resp); rec.Code != http.StatusOK || resp["status"] != "ignored" {
+		t.Fatalf("paid booking: status %d resp %v", rec.Code, resp)
+	}
+}
+
+func TestStripeWebhookAcceptsEitherSecretDuringRotation(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.StripeWebhookSecrets = []string{"whsec_old", "whsec_new"}
+	for i, secret := range []string{"whsec_old", "whsec_new"} {
+		var resp map[string]string
+		rec := postStripeEvent(t, s, checkoutCompleted(fmt.Sprintf("bk-rot-%d", i)), secret, &resp)
+		if rec.Code != http.StatusOK || resp["status"] != "processed" {
+			t.Fatalf("signed with %s: status %d resp %v", secret, rec.Code, resp)
+		}
+	}
+
+	// Once rotation finishes, events signed with the old secret fail.
+	s.cfg.StripeWebhookSecrets = []string{"whsec_new"}
+	var resp map[string]string
+	rec := postStripeEvent(t, s, checkoutCompleted("bk-rot-2"), "whsec_old", &resp)
+	if rec.Code != http.StatusBadRequest || resp["error"] != "invalid_signature" {
+		t.Fatalf("removed secret: status %d resp %v, want 400 invalid_signature", rec.Code, resp)
+	}
+	if _, ok := s.bookings.(*fakeBookings).payments["bk-rot-2"]; ok {
+		t.Fatal("payment recorded for an event with a bad signature")
+	}
+}
+
+func TestStripeWebhookNeedsNoTenant(t *testing.T) {
+	s := newTestServer(t)
+	// Without a default tenant, requests must name theirs; Stripe cannot.
+	s.cfg.Tenants = tenantkit.New("", Tenant{ID: "volcanica", Currency: "EUR"})
+	event := checkoutCompleted("bk-1")
+	object := event["data"].(map[string]interface{})["object"].(map[string]interface{})
+	object["metadata"] = map[string]string{"booking_id": "bk-1", "tenant": "volcanica"}
+
+	if rec := postStripeEvent(t, s, event, "whsec_forged", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("forged event: status %d, want 400", rec.Code)
+	}
+	var resp map[string]string
+	if rec := postStripeEvent(t, s, event, testWebhookSecret, &resp); rec.Code != http.StatusOK || resp["status"] != "processed" {
+		t.Fatalf("status %d resp %v, want processed", rec.Code, resp)
+	}
+	if p, err := s.ledger.Payment("pi_test_1"); err != nil || p.Tenant != "volcanica" {
+		t.Fatalf("payment %+v (%v), want volcanica's", p, err)
+	}
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	payload := []byte(`{"id":"evt_1"}`)
+	secrets := []string{testWebhookSecret}
+	cases := []struct {
+		name   string
+		header string
+		ok     bool
+	}{
+		{"valid", signStripe(payload, testWebhookSecret, now), true},
+		{"one of several v1", signStripe(payload, "whsec_other", now) + ",v1=" + strings.Split(signStripe(payload, testWebhookSecret, now), "v1=")[1], true},
+		{"wrong secret", signStripe(payload, "whsec_other", now), false},
+		{"stale", signStripe(payload, testWebhookSecret, now.Add(-6*time.Minute)), false},
+		{"missing", "", false},
+		{"no timestamp", "v1=" + strings.Split(signStripe(payload, testWebhookSecret, now), "v1=")[1], false},
+	}
+	for _, c := range cases {
+		err := verifyStripeSignature(payload, c.header, secrets, now)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: err = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+	if err := verifyStripeSignature([]byte(`{"id":"evt_2"}`), signStripe(payload, testWebhookSecret, now), secrets, now); err == nil {
+		t.Error("tampered payload verified")
+	}
+}
+
+func TestStripeWebhookRefusedWithoutSecrets(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.StripeWebhookSecrets = nil
+	rec := postStripeEvent(t, s, checkoutCompleted("bk-4"), testWebhookSecret, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+}
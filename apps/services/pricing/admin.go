@@ -0,0 +1,20 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin rejects requests that do not carry the configured admin API
+// key as a bearer token. With no key configured every admin route is closed.
+func (s *server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.cfg.AdminAPIKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminAPIKey)) != 1 {
+			respondError(w, http.StatusUnauthorized, "unauthorized", "admin credentials required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
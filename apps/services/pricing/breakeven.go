@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+// BreakEven is the occupancy and average daily rate (ADR) a property needs
+// over a month to cover its fixed costs at current pricing. Revenue is the
+// nightly rates only: cleaning fees cover cleaning and taxes go to the
+// state. When even a fully booked month falls short, Feasible is false,
+// ShortfallCents is by how much and no occupancy is given; the ADR needed
+// is always given, at TargetOccupancy.
+type BreakEven struct {
+	PropertyID       string `json:"property_id"`
+	Month            string `json:"month"`
+	Currency         string `json:"currency"`
+	MonthlyCostCents int64  `json:"monthly_cost_cents"`
+	Nights           int    `json:"nights"`
+	// ADRCents is the average nightly rate across the month and
+	// MaxRevenueCents what the month earns fully booked.
+	ADRCents        int64 `json:"adr_cents"`
+	MaxRevenueCents int64 `json:"max_revenue_cents"`
+
+	Feasible           bool             `json:"feasible"`
+	BreakEvenOccupancy apitypes.Percent `json:"breakeven_occupancy,omitempty"`
+	BreakEvenNights    int              `json:"breakeven_nights,omitempty"`
+	ShortfallCents     int64            `json:"shortfall_cents,omitempty"`
+
+	TargetOccupancy   apitypes.Percent `json:"target_occupancy"`
+	BreakEvenADRCents int64            `json:"breakeven_adr_cents"`
+	Message           string           `json:"message"`
+}
+
+// ceilDiv divides a by b (both positive), rounding up.
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// BreakEven works out what the property must sell in the month starting at
+// month to earn costCents, and the ADR it needs at target occupancy.
+// Occupancy and ADR are rounded up, so meeting them covers the cost.
+func (e *Engine) BreakEven(propertyID string, month time.Time, costCents int64, target apitypes.Percent) (BreakEven, error) {
+	q, err := e.QuoteStay(propertyID, month, month.AddDate(0, 1, 0), Party{})
+	if err != nil {
+		return BreakEven{}, err
+	}
+	b := BreakEven{
+		PropertyID:       propertyID,
+		Month:            month.Format("2006-01"),
+		Currency:         q.Currency,
+		MonthlyCostCents: costCents,
+		Nights:           len(q.Nights),
+		TargetOccupancy:  target,
+	}
+	for _, n := range q.Nights {
+		b.MaxRevenueCents += n.RateCents
+	}
+	b.ADRCents = b.MaxRevenueCents / int64(b.Nights)
+
+	// Nights sold at the target occupancy, at least one.
+	targetNights := max(ceilDiv(int64(b.Nights)*int64(target), int64(apitypes.HundredPercent)), 1)
+	b.BreakEvenADRCents = ceilDiv(costCents, targetNights)
+
+	if b.MaxRevenueCents < costCents {
+		b.ShortfallCents = costCents - b.MaxRevenueCents
+		b.Message = fmt.Sprintf("costs exceed the %d cents a fully booked month earns at current rates; rates must average %d cents a night at %s occupancy to break even",
+			b.MaxRevenueCents, b.BreakEvenADRCents, target)
+		return b, nil
+	}
+	b.Feasible = true
+	b.BreakEvenOccupancy = apitypes.Percent(ceilDiv(costCents*int64(apitypes.HundredPercent), b.MaxRevenueCents))
+	b.BreakEvenNights = int(ceilDiv(costCents*int64(b.Nights), b.MaxRevenueCents))
+	b.Message = fmt.Sprintf("%d of %d nights (%s occupancy) at current rates cover the cost", b.BreakEvenNights, b.Nights, b.BreakEvenOccupancy)
+	return b, nil
+}
+
+// getBreakEvenHandler reports the occupancy and ADR a property needs to
+// cover ?monthly_cost_cents= in ?month=YYYY-MM, the current month when
+// omitted. ?target_occupancy= (default 100%) is the occupancy the needed
+// ADR is given for.
+func (s *server) getBreakEvenHandler(w http.ResponseWriter, r *http.Request) {
+	cost, err := strconv.ParseInt(r.URL.Query().Get("monthly_cost_cents"), 10, 64)
+	if err != nil || cost <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_cost", "monthly_cost_cents must be a positive integer")
+		return
+	}
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if v := r.URL.Query().Get("month"); v != "" {
+		if month, err = time.Parse("2006-01", v); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_month", "month must be formatted YYYY-MM")
+			return
+		}
+	}
+	target := apitypes.HundredPercent
+	if v := r.URL.Query().Get("target_occupancy"); v != "" {
+		if target, err = apitypes.ParsePercent(v); err != nil || target <= 0 || target > apitypes.HundredPercent {
+			respondError(w, http.StatusBadRequest, "invalid_target_occupancy", "target_occupancy must be a percentage above 0 and at most 100")
+			return
+		}
+	}
+	b, err := s.engine.BreakEven(chi.URLParam(r, "propertyId"), month, cost, target)
+	if errors.Is(err, ErrPropertyNotFound) {
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+		return
+	}
+	respondJSON(w, http.StatusOK, b)
+}
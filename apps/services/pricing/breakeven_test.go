@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func TestBreakEvenFeasibleCost(t *testing.T) {
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 10000, CleaningFeeCents: 5000, TaxRate: 13 * apitypes.OnePercent})
+
+	// June has 30 nights at $100: $3,000 fully booked, before fees and tax.
+	var got BreakEven
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/tunco-villa/breakeven?monthly_cost_cents=150000&month=2026-06&target_occupancy=75", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if !got.Feasible || got.Nights != 30 || got.ADRCents != 10000 || got.MaxRevenueCents != 300000 {
+		t.Fatalf("break-even = %+v", got)
+	}
+	if got.BreakEvenOccupancy != 50*apitypes.OnePercent || got.BreakEvenNights != 15 || got.ShortfallCents != 0 {
+		t.Fatalf("break-even occupancy %s over %d nights, want 50%% over 15", got.BreakEvenOccupancy, got.BreakEvenNights)
+	}
+	// 75% of 30 nights rounds up to 23, each needing $65.22.
+	if got.TargetOccupancy != 75*apitypes.OnePercent || got.BreakEvenADRCents != 6522 {
+		t.Fatalf("ADR at %s = %d, want 6522", got.TargetOccupancy, got.BreakEvenADRCents)
+	}
+}
+
+func TestBreakEvenCostAboveMaxRevenue(t *testing.T) {
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 10000})
+
+	var got BreakEven
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/tunco-villa/breakeven?monthly_cost_cents=400000&month=2026-06", nil, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got.Feasible || got.BreakEvenOccupancy != 0 || got.BreakEvenNights != 0 || got.ShortfallCents != 100000 {
+		t.Fatalf("break-even = %+v, want infeasible $1,000 short", got)
+	}
+	// Fully booked, rates must average $133.34 a night.
+	if got.TargetOccupancy != apitypes.HundredPercent || got.BreakEvenADRCents != 13334 || got.Message == "" {
+		t.Fatalf("ADR needed = %d at %s (%q), want 13334 at 100%%", got.BreakEvenADRCents, got.TargetOccupancy, got.Message)
+	}
+
+	for _, q := range []string{"monthly_cost_cents=0", "monthly_cost_cents=100&month=June", "monthly_cost_cents=100&target_occupancy=120"} {
+		if rec := doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/tunco-villa/breakeven?"+q, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, rec.Code)
+		}
+	}
+	if rec := doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/nowhere/breakeven?monthly_cost_cents=100", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown property: status %d, want 404", rec.Code)
+	}
+}
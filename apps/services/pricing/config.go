@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// defaultLowPriorityRoutes are the preview and estimate routes shed under
+// overload unless LOAD_SHED_LOW_PRIORITY_ROUTES names others.
+const defaultLowPriorityRoutes = "GET /api/pricing/rental/{propertyId}," +
+	"GET /api/pricing/rental/{propertyId}/nightly," +
+	"GET /api/pricing/rental/{propertyId}/gaps"
+
+// config holds the runtime settings for the pricing service, loaded from the
+// environment with development-friendly defaults.
+type config struct {
+	Port string
+
+	// HTTPTimeouts bound each stage of an incoming connection.
+	HTTPTimeouts httpkit.ServerTimeouts
+	// LoadShedding turns away low-priority routes under overload.
+	LoadShedding httpkit.LoadShedding
+
+	// RequestIDHeader is the header used to accept, echo and forward the
+	// request correlation id.
+	RequestIDHeader string
+
+	// Tenants are the brands served, loaded at startup from TenantsFile.
+	// Browsers may call the API only from their tenant's CORS origins.
+	Tenants       Tenants
+	TenantsFile   string
+	DefaultTenant string
+
+	// AdminAPIKey guards the routes that change prices. They are closed
+	// when it is empty.
+	AdminAPIKey string
+
+	// CoinGeckoURL is the base URL of the CoinGecko API.
+	CoinGeckoURL string
+
+	// RateFallback decides how sats quotes behave when every BTC rate
+	// source is down and nothing is cached.
+	RateFallback RateFallback
+
+	// BTC/USD readings younger than RateCacheTTL are served without asking
+	// the sources. With RedisURL set they are shared through Redis so every
+	// replica reuses one reading; otherwise each replica caches its own.
+	RateCacheTTL time.Duration
+	RedisURL     string
+
+	// SurgeCap bounds the combined effect of seasonal and event multipliers.
+	SurgeCap float64
+
+	// Gaps of at most GapMaxNights unbooked nights between two bookings are
+	// offered at GapDiscount off as last-minute deals.
+	GapMaxNights int
+	GapDiscount  apitypes.Percent
+
+	// SatsRounding keeps the prices of offerings denominated in sats to
+	// round numbers and above a minimum.
+	SatsRounding SatsRounding
+
+	// Revenue guarantee monitoring: hosts are alerted when more than
+	// FloorAlertNights of the next FloorAlertHorizon nights sit at their
+	// floor. Checks run every FloorAlertInterval.
+	FloorAlertNights   int
+	FloorAlertHorizon  int
+	FloorAlertInterval time.Duration
+
+	// pricing.changed webhooks: when a change moves any of a property's
+	// next PriceChangeHorizon nights by at least PriceChangeThreshold, an
+	// event is POSTed to PriceChangeWebhookURL (or logged when unset) once
+	// the property has been quiet for PriceChangeDebounce.
+	PriceChangeWebhookURL string
+	PriceChangeThreshold  apitypes.Percent
+	PriceChangeHorizon    int
+	PriceChangeDebounce   time.Duration
+
+	// IntegrationLimits caps concurrent calls per external integration,
+	// keyed by integration name. Unlisted integrations are unlimited.
+	IntegrationLimits map[string]outbound.ConcurrencyLimit
+}
+
+func loadConfig() config {
+	return config{
+		Port:            envString("PRICING_SERVICE_PORT", "8003"),
+		RequestIDHeader: envString("REQUEST_ID_HEADER", httpkit.RequestIDHeader),
+		HTTPTimeouts:    httpkit.ServerTimeoutsFromEnv(),
+		LoadShedding:    httpkit.LoadSheddingFromEnv(defaultLowPriorityRoutes),
+		TenantsFile:     os.Getenv("TENANTS_FILE"),
+		DefaultTenant:   envString("DEFAULT_TENANT", tenantkit.DefaultID),
+		AdminAPIKey:     os.Getenv("ADMIN_API_KEY"),
+		CoinGeckoURL:    envString("COINGECKO_API_URL", "https://api.coingecko.com"),
+		RateFallback: RateFallback{
+			Mode:       FallbackMode(envString("BTC_RATE_FALLBACK_MODE", string(FallbackRefuse))),
+			ManualRate: envFloat("BTC_MANUAL_FALLBACK_RATE", 0),
+		},
+		SurgeCap: envFloat("PRICING_SURGE_CAP", 2.5),
+
+		RateCacheTTL: envDuration("BTC_RATE_CACHE_TTL", time.Minute),
+		RedisURL:     os.Getenv("REDIS_URL"),
+
+		GapMaxNights: envInt("GAP_MAX_NIGHTS", 2),
+		GapDiscount:  envPercent("GAP_DISCOUNT", 20*apitypes.OnePercent),
+
+		SatsRounding: SatsRounding{
+			Increment:   int64(envInt("SATS_ROUNDING_INCREMENT", 1000)),
+			Mode:        SatsRoundingMode(envString("SATS_ROUNDING_MODE", string(SatsRoundNearest))),
+			MinimumSats: int64(envInt("SATS_MINIMUM", 0)),
+		},
+
+		FloorAlertNights:   envInt("FLOOR_ALERT_NIGHTS", 7),
+		FloorAlertHorizon:  envInt("FLOOR_ALERT_HORIZON_NIGHTS", 30),
+		FloorAlertInterval: envDuration("FLOOR_ALERT_INTERVAL", time.Hour),
+
+		PriceChangeWebhookURL: os.Getenv("PRICE_CHANGE_WEBHOOK_URL"),
+		PriceChangeThreshold:  envPercent("PRICE_CHANGE_THRESHOLD", 5*apitypes.OnePercent),
+		PriceChangeHorizon:    envInt("PRICE_CHANGE_HORIZON_NIGHTS", 90),
+		PriceChangeDebounce:   envDuration("PRICE_CHANGE_DEBOUNCE", 30*time.Second),
+
+		IntegrationLimits: outbound.ParseConcurrencyLimits(os.Getenv("INTEGRATION_CONCURRENCY"),
+			outbound.SaturationMode(envString("INTEGRATION_SATURATION_MODE", string(outbound.SaturationQueue)))),
+	}
+}
+
+// validate reports configuration that would make the service misbehave.
+func (c config) validate() error {
+	if c.SurgeCap != 0 && c.SurgeCap < 1 {
+		return fmt.Errorf("PRICING_SURGE_CAP must be at least 1 (or 0 to disable), got %g", c.SurgeCap)
+	}
+	if c.GapMaxNights < 1 {
+		return fmt.Errorf("GAP_MAX_NIGHTS must be at least 1, got %d", c.GapMaxNights)
+	}
+	if c.GapDiscount < 0 || c.GapDiscount > apitypes.HundredPercent {
+		return fmt.Errorf("GAP_DISCOUNT must be between 0%% and 100%%, got %s", c.GapDiscount)
+	}
+	if c.PriceChangeThreshold <= 0 || c.PriceChangeThreshold > apitypes.HundredPercent {
+		return fmt.Errorf("PRICE_CHANGE_THRESHOLD must be above 0%% and at most 100%%, got %s", c.PriceChangeThreshold)
+	}
+	if c.PriceChangeHorizon < 1 || c.PriceChangeHorizon > 366 {
+		return fmt.Errorf("PRICE_CHANGE_HORIZON_NIGHTS must be between 1 and 366, got %d", c.PriceChangeHorizon)
+	}
+	if c.PriceChangeDebounce < 0 {
+		return fmt.Errorf("PRICE_CHANGE_DEBOUNCE must not be negative, got %s", c.PriceChangeDebounce)
+	}
+	if c.RateCacheTTL < 0 {
+		return fmt.Errorf("BTC_RATE_CACHE_TTL must not be negative, got %s", c.RateCacheTTL)
+	}
+	if c.RedisURL != "" {
+		if _, err := parseRedisURL(c.RedisURL); err != nil {
+			return err
+		}
+	}
+	if err := c.SatsRounding.validate(); err != nil {
+		return err
+	}
+	if err := outbound.ValidateConcurrencyLimits(c.IntegrationLimits); err != nil {
+		return err
+	}
+	return c.RateFallback.validate()
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envPercent(key string, fallback apitypes.Percent) apitypes.Percent {
+	if v, err := apitypes.ParsePercent(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Denominations a quote can be expressed in.
+const (
+	DenomUSD  = "usd"
+	DenomBTC  = "btc"
+	DenomSats = "sats"
+)
+
+// DenomAmount is a price in one denomination. MinorUnits is exact (cents
+// or sats) and Amount is the same value in major units.
+type DenomAmount struct {
+	Amount     string `json:"amount"`
+	MinorUnits int64  `json:"minor_units"`
+}
+
+// Denominated is a total converted to every requested denomination using a
+// single rate. BTC and sats always agree exactly: the BTC amount is the sats
+// amount divided by 10^8.
+type Denominated struct {
+	Amounts map[string]DenomAmount `json:"amounts,omitempty"`
+	Rate    *BtcRate               `json:"rate,omitempty"`
+	Warning string                 `json:"warning,omitempty"`
+}
+
+// parseDenoms reads a list such as "usd,btc,sats", keeping known
+// denominations in order without repeats and returning the unknown ones.
+func parseDenoms(spec string) (known, unknown []string) {
+	seen := make(map[string]bool)
+	for _, d := range strings.Split(spec, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		switch d {
+		case DenomUSD, DenomBTC, DenomSats:
+			known = append(known, d)
+		default:
+			unknown = append(unknown, d)
+		}
+	}
+	return known, unknown
+}
+
+// usdCentsToSats converts at rate, rounding to the nearest sat.
+func usdCentsToSats(cents int64, rate BtcRate) int64 {
+	// One cent is SatsPerDollar/100 sats.
+	sats := float64(cents) * rate.SatsPerDollar / 100
+	if sats < 0 {
+		return -int64(-sats + 0.5)
+	}
+	return int64(sats + 0.5)
+}
+
+func formatSatsAsBTC(sats int64) string {
+	sign := ""
+	if sats < 0 {
+		sign, sats = "-", -sats
+	}
+	return fmt.Sprintf("%s%d.%08d", sign, sats/1e8, sats%1e8)
+}
+
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// denominate converts a USD total into the denominations named by the
+// request's denoms parameter, fetching the BTC rate at most once. It returns
+// nil when no denominations were asked for, and writes an error response
+// and reports false when the conversion cannot be made.
+func (s *server) denominate(w http.ResponseWriter, r *http.Request, totalCents int64, currency string) (*Denominated, bool) {
+	spec := r.URL.Query().Get("denoms")
+	if spec == "" {
+		return nil, true
+	}
+	denoms, unknown := parseDenoms(spec)
+	d := &Denominated{Amounts: make(map[string]DenomAmount, len(denoms))}
+	if len(unknown) > 0 {
+		d.Warning = "ignored unknown denominations: " + strings.Join(unknown, ", ")
+	}
+	if len(denoms) > 0 && !strings.EqualFold(currency, "USD") {
+		respondError(w, http.StatusUnprocessableEntity, "unsupported_currency", "denominations are only available for USD quotes")
+		return nil, false
+	}
+
+	for _, denom := range denoms {
+		if denom == DenomUSD {
+			d.Amounts[DenomUSD] = DenomAmount{Amount: formatCents(totalCents), MinorUnits: totalCents}
+			continue
+		}
+		if d.Rate == nil {
+			rate, err := s.rates.Rate(r.Context())
+			if err != nil {
+				respondError(w, http.StatusServiceUnavailable, "rate_unavailable", "no BTC/USD rate source is reachable")
+				return nil, false
+			}
+			d.Rate = &rate
+		}
+		sats := usdCentsToSats(totalCents, *d.Rate)
+		if denom == DenomBTC {
+			d.Amounts[DenomBTC] = DenomAmount{Amount: formatSatsAsBTC(sats), MinorUnits: sats}
+		} else {
+			d.Amounts[DenomSats] = DenomAmount{Amount: fmt.Sprint(sats), MinorUnits: sats}
+		}
+	}
+	return d, true
+}
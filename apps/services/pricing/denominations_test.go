@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// countingSource is a RateSource that counts its fetches.
+type countingSource struct {
+	rate    float64
+	fetches int
+}
+
+func (c *countingSource) Name() string { return "stub" }
+
+func (c *countingSource) FetchBTCUSD(context.Context) (float64, error) {
+	c.fetches++
+	return c.rate, nil
+}
+
+func newDenomTestServer(rate float64) (*server, *countingSource) {
+	s := newTestServer()
+	src := &countingSource{rate: rate}
+	s.rates = NewBtcRateProvider(RateFallback{Mode: FallbackRefuse}, src)
+	s.engine.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 12500})
+	return s, src
+}
+
+func TestQuoteInAllDenominationsFromOneRate(t *testing.T) {
+	s, src := newDenomTestServer(68000)
+
+	var resp struct {
+		TotalCents    int64       `json:"total_cents"`
+		Denominations Denominated `json:"denominations"`
+	}
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/tunco-villa?check_in=2026-08-03&check_out=2026-08-05&denoms=usd,btc,sats", nil, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if src.fetches != 1 {
+		t.Fatalf("rate fetched %d times, want once", src.fetches)
+	}
+	d := resp.Denominations
+	if d.Rate == nil || d.Rate.BtcUSD != 68000 || d.Warning != "" {
+		t.Fatalf("denominations = %+v", d)
+	}
+
+	usd, btc, sats := d.Amounts[DenomUSD], d.Amounts[DenomBTC], d.Amounts[DenomSats]
+	if usd.MinorUnits != resp.TotalCents || usd.Amount != "250.00" {
+		t.Errorf("usd = %+v, want the 25000-cent total", usd)
+	}
+	// $250 at $68,000/BTC is 367,647.06 sats.
+	if sats.MinorUnits != 367647 || sats.Amount != "367647" {
+		t.Errorf("sats = %+v, want 367647", sats)
+	}
+	if btc.MinorUnits != sats.MinorUnits || btc.Amount != "0.00367647" {
+		t.Errorf("btc = %+v, want exactly the sats amount", btc)
+	}
+	exact := float64(usd.MinorUnits) / 100 * d.Rate.SatsPerDollar
+	if math.Abs(float64(sats.MinorUnits)-exact) > 0.5 {
+		t.Errorf("sats %d is not %f rounded", sats.MinorUnits, exact)
+	}
+	if v, _ := strconv.ParseFloat(btc.Amount, 64); math.Abs(v*1e8-float64(sats.MinorUnits)) > 1e-6 {
+		t.Errorf("btc %s does not reconcile with %d sats", btc.Amount, sats.MinorUnits)
+	}
+}
+
+func TestNightlyBreakdownDenominationsIgnoreUnknown(t *testing.T) {
+	s, src := newDenomTestServer(50000)
+
+	var q struct {
+		TotalCents    int64         `json:"total_cents"`
+		Nights        []NightlyRate `json:"nights"`
+		Denominations Denominated   `json:"denominations"`
+	}
+	rec := doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/tunco-villa/nightly?check_in=2026-08-03&check_out=2026-08-04&denoms=sats,eur,USD,doge", nil, &q)
+	if rec.Code != http.StatusOK || len(q.Nights) != 1 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	d := q.Denominations
+	if len(d.Amounts) != 2 || d.Amounts[DenomSats].MinorUnits != 250000 || d.Amounts[DenomUSD].MinorUnits != 12500 {
+		t.Fatalf("amounts = %+v", d.Amounts)
+	}
+	if d.Warning != "ignored unknown denominations: eur, doge" {
+		t.Fatalf("warning = %q", d.Warning)
+	}
+	if src.fetches != 1 {
+		t.Fatalf("rate fetched %d times, want once", src.fetches)
+	}
+}
+
+func TestQuoteWithoutDenomsSkipsRate(t *testing.T) {
+	s, src := newDenomTestServer(50000)
+
+	var resp map[string]interface{}
+	doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/tunco-villa?check_in=2026-08-03&check_out=2026-08-04&denoms=usd", nil, &resp)
+	if src.fetches != 0 {
+		t.Fatalf("rate fetched %d times for a USD-only quote", src.fetches)
+	}
+	var plain map[string]interface{}
+	doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/tunco-villa?check_in=2026-08-03&check_out=2026-08-04", nil, &plain)
+	if _, ok := plain["denominations"]; ok {
+		t.Fatalf("response = %v, want no denominations unless asked", plain)
+	}
+}
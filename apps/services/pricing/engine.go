@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+var (
+	ErrPropertyNotFound = errors.New("property not found")
+	ErrRuleOverlap      = errors.New("seasonal rule overlaps an existing rule")
+	ErrRuleNotFound     = errors.New("seasonal rule not found")
+	ErrEventNotFound    = errors.New("event not found")
+)
+
+// Property is a rental's rate card as configured by the host or revenue
+// manager.
+type Property struct {
+	ID            string         `json:"property_id"`
+	Department    string         `json:"department,omitempty"`
+	Currency      string         `json:"currency"`
+	BaseRateCents int64          `json:"base_rate_cents"`
+	FloorCents    int64          `json:"floor_cents,omitempty"`
+	CeilingCents  int64          `json:"ceiling_cents,omitempty"`
+	SeasonalRules []SeasonalRule `json:"seasonal_rules"`
+	// ScheduledRates are future base rate changes, sorted by effective
+	// date. They are managed through PutScheduledRate.
+	ScheduledRates []ScheduledRate `json:"scheduled_rates,omitempty"`
+
+	// WeekendMultiplier scales Friday and Saturday nights; zero means no
+	// weekend premium.
+	WeekendMultiplier float64 `json:"weekend_multiplier,omitempty"`
+	// WeeklyDiscount comes off the nightly subtotal of stays of seven
+	// nights or more.
+	WeeklyDiscount   apitypes.Percent `json:"weekly_discount,omitempty"`
+	CleaningFeeCents int64            `json:"cleaning_fee_cents,omitempty"`
+	// FeeSchedule, when set, replaces CleaningFeeCents with cleaning,
+	// extra-guest and pet fees, each taxed or not on its own.
+	FeeSchedule *FeeSchedule `json:"fee_schedule,omitempty"`
+	// TaxRate is charged on the discounted nights plus fees.
+	TaxRate apitypes.Percent `json:"tax_rate,omitempty"`
+	// Taxes are further named taxes charged on the same amount, such as
+	// a tourism levy alongside IVA. Each is rounded on its own.
+	Taxes []Tax `json:"taxes,omitempty"`
+
+	// RevenueGuarantee enrols the host in floor alerts: they are told when
+	// too many upcoming nights are priced at FloorCents.
+	RevenueGuarantee bool `json:"revenue_guarantee,omitempty"`
+
+	// Freeze, when set, pins nightly rates for a date range. It is managed
+	// through FreezeRates and ResumeRates.
+	Freeze *PriceFreeze `json:"freeze,omitempty"`
+
+	// BookedStays are the property's reservations, sorted by check-in. They
+	// are managed through SetBookedStays.
+	BookedStays []BookedStay `json:"booked_stays,omitempty"`
+}
+
+// SeasonalRule scales the base rate for every night in [Start, End].
+type SeasonalRule struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// validate checks the rule is well formed on its own.
+func (r SeasonalRule) validate() error {
+	if r.ID == "" || r.Name == "" {
+		return errors.New("id and name are required")
+	}
+	start, err := time.Parse(time.DateOnly, r.Start)
+	if err != nil {
+		return errors.New("start must be formatted YYYY-MM-DD")
+	}
+	end, err := time.Parse(time.DateOnly, r.End)
+	if err != nil {
+		return errors.New("end must be formatted YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return errors.New("end must not be before start")
+	}
+	if r.Multiplier <= 0 || r.Multiplier > 5 {
+		return errors.New("multiplier must be greater than 0 and at most 5")
+	}
+	return nil
+}
+
+// overlaps reports whether two rules share at least one night. Dates are
+// ISO formatted so they compare lexically.
+func (r SeasonalRule) overlaps(o SeasonalRule) bool {
+	return r.Start <= o.End && o.Start <= r.End
+}
+
+// EventRule scales rates for a special event such as a festival or surf
+// contest. Unlike seasonal rules, events may overlap each other and stack on
+// top of seasons. A department limits the event to properties there.
+type EventRule struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Department string  `json:"department,omitempty"`
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+func (ev EventRule) validate() error {
+	return SeasonalRule{ID: ev.ID, Name: ev.Name, Start: ev.Start, End: ev.End, Multiplier: ev.Multiplier}.validate()
+}
+
+// appliesTo reports whether the event covers date for a property.
+func (ev EventRule) appliesTo(p *Property, date string) bool {
+	if ev.Department != "" && ev.Department != p.Department {
+		return false
+	}
+	return ev.Start <= date && date <= ev.End
+}
+
+// EngineOptions are the platform-wide pricing policies.
+type EngineOptions struct {
+	// SurgeCap bounds the combined multiplier of every seasonal and event
+	// rule on a night, e.g. 2.5 means never more than 2.5x base. Zero
+	// disables the cap.
+	SurgeCap float64
+
+	// GapMaxNights is the longest run of unbooked nights between two
+	// bookings that counts as a gap worth discounting.
+	GapMaxNights int
+	// GapDiscount is the last-minute discount suggested for gap nights.
+	GapDiscount apitypes.Percent
+
+	// SatsRounding rounds the nightly rates of properties and the
+	// per-person prices of tours priced in sats, and holds them to a
+	// minimum.
+	SatsRounding SatsRounding
+}
+
+// Engine holds the rate cards of every priced property and tour.
+type Engine struct {
+	opts EngineOptions
+
+	mu         sync.RWMutex
+	properties map[string]*Property
+	tours      map[string]Tour
+	events     map[string]EventRule
+	// onChange, when set, is told which properties' rates may have moved
+	// after each change. It runs with e.mu held so it must not call back
+	// into the engine.
+	onChange func(propertyID string)
+}
+
+func NewEngine(opts EngineOptions) *Engine {
+	return &Engine{
+		opts:       opts,
+		properties: make(map[string]*Property),
+		tours:      make(map[string]Tour),
+		events:     make(map[string]EventRule),
+	}
+}
+
+// SetProperty creates or replaces a property's rate card, keeping any
+// seasonal rules, scheduled rates, freeze and booked stays already attached
+// to it.
+func (e *Engine) SetProperty(p Property) Property {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if existing, ok := e.properties[p.ID]; ok {
+		p.SeasonalRules = existing.SeasonalRules
+		p.ScheduledRates = existing.ScheduledRates
+		p.Freeze = existing.Freeze
+		p.BookedStays = existing.BookedStays
+	} else {
+		p.ScheduledRates = nil
+		p.Freeze = nil
+		p.BookedStays = nil
+	}
+	if p.SeasonalRules == nil {
+		p.SeasonalRules = []SeasonalRule{}
+	}
+	e.properties[p.ID] = &p
+	e.changedLocked(p.ID)
+	return p.clone()
+}
+
+// Property returns a copy of a property's rate card.
+func (e *Engine) Property(id string) (Property, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	p, ok := e.properties[id]
+	if !ok {
+		return Property{}, ErrPropertyNotFound
+	}
+	return p.clone(), nil
+}
+
+// PropertyIDs lists properties, optionally restricted to one department.
+func (e *Engine) PropertyIDs(department string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var ids []string
+	for id, p := range e.properties {
+		if department == "" || p.Department == department {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PutSeasonalRule attaches rule to a property, replacing a rule with the same
+// id. It reports whether an existing rule was replaced.
+func (e *Engine) PutSeasonalRule(propertyID string, rule SeasonalRule) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return false, ErrPropertyNotFound
+	}
+	replaced := -1
+	for i, existing := range p.SeasonalRules {
+		if existing.ID == rule.ID {
+			replaced = i
+			continue
+		}
+		if existing.overlaps(rule) {
+			return false, ErrRuleOverlap
+		}
+	}
+	defer e.changedLocked(propertyID)
+	if replaced >= 0 {
+		p.SeasonalRules[replaced] = rule
+		return true, nil
+	}
+	p.SeasonalRules = append(p.SeasonalRules, rule)
+	sort.Slice(p.SeasonalRules, func(i, j int) bool { return p.SeasonalRules[i].Start < p.SeasonalRules[j].Start })
+	return false, nil
+}
+
+// DeleteSeasonalRule removes the rule with ruleID from a property.
+func (e *Engine) DeleteSeasonalRule(propertyID, ruleID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return ErrPropertyNotFound
+	}
+	for i, existing := range p.SeasonalRules {
+		if existing.ID == ruleID {
+			p.SeasonalRules = append(p.SeasonalRules[:i], p.SeasonalRules[i+1:]...)
+			e.changedLocked(propertyID)
+			return nil
+		}
+	}
+	return ErrRuleNotFound
+}
+
+// PutEvent creates or replaces an event rule.
+func (e *Engine) PutEvent(ev EventRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if old, ok := e.events[ev.ID]; ok {
+		e.eventChangedLocked(old)
+	}
+	e.events[ev.ID] = ev
+	e.eventChangedLocked(ev)
+}
+
+// DeleteEvent removes an event rule.
+func (e *Engine) DeleteEvent(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ev, ok := e.events[id]
+	if !ok {
+		return ErrEventNotFound
+	}
+	delete(e.events, id)
+	e.eventChangedLocked(ev)
+	return nil
+}
+
+// OnChange registers fn to hear of every property whose rates a rule or
+// rate card change may have moved. fn must not call back into the engine.
+func (e *Engine) OnChange(fn func(propertyID string)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = fn
+}
+
+// changedLocked reports ids to the change hook. Callers must hold e.mu.
+func (e *Engine) changedLocked(ids ...string) {
+	if e.onChange == nil {
+		return
+	}
+	for _, id := range ids {
+		e.onChange(id)
+	}
+}
+
+// eventChangedLocked reports every property ev applies to. Callers must hold
+// e.mu.
+func (e *Engine) eventChangedLocked(ev EventRule) {
+	for id, p := range e.properties {
+		if ev.Department == "" || ev.Department == p.Department {
+			e.changedLocked(id)
+		}
+	}
+}
+
+func (p *Property) clone() Property {
+	c := *p
+	c.SeasonalRules = append([]SeasonalRule{}, p.SeasonalRules...)
+	c.ScheduledRates = append([]ScheduledRate(nil), p.ScheduledRates...)
+	c.Taxes = append([]Tax(nil), p.Taxes...)
+	c.BookedStays = append([]BookedStay(nil), p.BookedStays...)
+	if p.FeeSchedule != nil {
+		fs := *p.FeeSchedule
+		c.FeeSchedule = &fs
+	}
+	if p.Freeze != nil {
+		f := p.Freeze.clone()
+		c.Freeze = &f
+	}
+	return c
+}
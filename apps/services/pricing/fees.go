@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+var ErrInvalidParty = errors.New("guests must be a positive whole number and pets true or false")
+
+// Fee codes itemised on a stay quote.
+const (
+	FeeCleaning   = "cleaning"
+	FeeExtraGuest = "extra_guest"
+	FeePet        = "pet"
+)
+
+// Fee is one charge in a property's fee schedule. Fees are taxed like the
+// nights unless TaxExempt is set.
+type Fee struct {
+	AmountCents int64 `json:"amount_cents"`
+	TaxExempt   bool  `json:"tax_exempt,omitempty"`
+}
+
+// FeeSchedule is what a property charges on top of its nights: a flat
+// cleaning fee per stay, a nightly fee for each guest beyond IncludedGuests,
+// and a flat fee when guests bring pets. A zero amount charges nothing.
+type FeeSchedule struct {
+	Cleaning       Fee `json:"cleaning"`
+	IncludedGuests int `json:"included_guests,omitempty"`
+	ExtraGuest     Fee `json:"extra_guest"`
+	Pet            Fee `json:"pet"`
+}
+
+func (fs FeeSchedule) validate() error {
+	if fs.Cleaning.AmountCents < 0 || fs.ExtraGuest.AmountCents < 0 || fs.Pet.AmountCents < 0 {
+		return errors.New("fee amounts must not be negative")
+	}
+	if fs.IncludedGuests < 0 {
+		return errors.New("included_guests must not be negative")
+	}
+	if fs.ExtraGuest.AmountCents > 0 && fs.IncludedGuests == 0 {
+		return errors.New("included_guests is required with an extra_guest fee")
+	}
+	return nil
+}
+
+// Party is who a stay is for. Zero Guests means the count was not given, so
+// no extra-guest fee applies.
+type Party struct {
+	Guests int
+	Pets   bool
+}
+
+// stayFees itemises the fees a party owes for a stay of nights, and how much
+// of them is taxable. A property without a fee schedule charges only its
+// CleaningFeeCents, taxed.
+func (p *Property) stayFees(nights int, party Party) (fees []LineItem, taxable int64) {
+	add := func(code, name string, fee Fee) {
+		if fee.AmountCents <= 0 {
+			return
+		}
+		fees = append(fees, LineItem{Code: code, Name: name, AmountCents: fee.AmountCents, TaxExempt: fee.TaxExempt})
+		if !fee.TaxExempt {
+			taxable += fee.AmountCents
+		}
+	}
+	fs := p.FeeSchedule
+	if fs == nil {
+		add(FeeCleaning, "Cleaning fee", Fee{AmountCents: p.CleaningFeeCents})
+		return fees, taxable
+	}
+	add(FeeCleaning, "Cleaning fee", fs.Cleaning)
+	if extra := party.Guests - fs.IncludedGuests; extra > 0 {
+		name := fmt.Sprintf("Extra guest fee (%d × %d nights)", extra, nights)
+		add(FeeExtraGuest, name, Fee{AmountCents: fs.ExtraGuest.AmountCents * int64(extra) * int64(nights), TaxExempt: fs.ExtraGuest.TaxExempt})
+	}
+	if party.Pets {
+		add(FeePet, "Pet fee", fs.Pet)
+	}
+	return fees, taxable
+}
+
+// parseParty reads the optional guests and pets query parameters.
+func parseParty(r *http.Request) (Party, error) {
+	var party Party
+	if v := r.URL.Query().Get("guests"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Party{}, ErrInvalidParty
+		}
+		party.Guests = n
+	}
+	if v := r.URL.Query().Get("pets"); v != "" {
+		pets, err := strconv.ParseBool(v)
+		if err != nil {
+			return Party{}, ErrInvalidParty
+		}
+		party.Pets = pets
+	}
+	return party, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// feeProperty charges taxable cleaning and extra-guest fees and a tax-exempt
+// pet fee, under 13% IVA and a 5% tourism levy.
+func feeProperty(t *testing.T, h http.Handler) {
+	t.Helper()
+	rec := doJSON(t, h, http.MethodPut, "/api/pricing/rental/tunco-villa/config", map[string]interface{}{
+		"base_rate_cents": 10000, "tax_rate": "13%",
+		"taxes": []map[string]string{{"code": "tourism", "name": "Tourism levy", "rate": "5%"}},
+		"fee_schedule": map[string]interface{}{
+			"cleaning":        map[string]interface{}{"amount_cents": 5000},
+			"included_guests": 4,
+			"extra_guest":     map[string]interface{}{"amount_cents": 1500},
+			"pet":             map[string]interface{}{"amount_cents": 3000, "tax_exempt": true},
+		},
+	}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("config: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStayQuoteItemisesExtraGuestAndPetFees(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	feeProperty(t, h)
+
+	// Three weeknights for six guests and a dog.
+	var q StayQuote
+	rec := doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/nightly?check_in=2026-06-01&check_out=2026-06-04&guests=6&pets=true", nil, &q)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := []LineItem{
+		{Code: FeeCleaning, AmountCents: 5000},
+		{Code: FeeExtraGuest, AmountCents: 2 * 3 * 1500},
+		{Code: FeePet, AmountCents: 3000, TaxExempt: true},
+	}
+	if len(q.Fees) != len(want) {
+		t.Fatalf("fees = %+v", q.Fees)
+	}
+	var fees int64
+	for i, w := range want {
+		if f := q.Fees[i]; f.Code != w.Code || f.AmountCents != w.AmountCents || f.TaxExempt != w.TaxExempt {
+			t.Errorf("fee %d = %+v, want %+v", i, f, w)
+		}
+		fees += q.Fees[i].AmountCents
+	}
+
+	// Nights, cleaning and extra guests are taxed; the pet fee is not.
+	taxable := q.SubtotalCents + 5000 + 9000
+	if q.SubtotalCents != 30000 || len(q.Taxes) != 2 || q.Taxes[0].AmountCents != 13*taxable/100 || q.Taxes[1].AmountCents != 5*taxable/100 {
+		t.Fatalf("subtotal %d taxes %+v on %d taxable", q.SubtotalCents, q.Taxes, taxable)
+	}
+	var taxes int64
+	for _, tax := range q.Taxes {
+		taxes += tax.AmountCents
+	}
+	if q.TaxCents != taxes || q.TotalCents != q.SubtotalCents+fees+taxes || q.TotalCents != 54920 {
+		t.Fatalf("tax %d total %d does not reconcile with %d + %d + %d", q.TaxCents, q.TotalCents, q.SubtotalCents, fees, taxes)
+	}
+}
+
+func TestStayQuoteWithinIncludedGuestsChargesCleaningOnly(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	feeProperty(t, h)
+
+	var q StayQuote
+	doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/nightly?check_in=2026-06-01&check_out=2026-06-04&guests=4", nil, &q)
+	if len(q.Fees) != 1 || q.Fees[0].Code != FeeCleaning || q.TotalCents != 35000+35000*18/100 {
+		t.Fatalf("fees %+v total %d, want cleaning only", q.Fees, q.TotalCents)
+	}
+
+	if rec := doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/nightly?check_in=2026-06-01&check_out=2026-06-04&guests=many", nil, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad guests: status %d, want 400", rec.Code)
+	}
+}
+
+func TestFeeScheduleRequiresIncludedGuestsForExtraGuestFee(t *testing.T) {
+	s := newTestServer()
+	rec := doJSON(t, s.routes(), http.MethodPut, "/api/pricing/rental/tunco-villa/config", map[string]interface{}{
+		"base_rate_cents": 10000,
+		"fee_schedule":    map[string]interface{}{"extra_guest": map[string]interface{}{"amount_cents": 1500}},
+	}, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
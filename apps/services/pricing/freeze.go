@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// maxFreezeNights bounds how far ahead a host can pin rates.
+const maxFreezeNights = 366
+
+var (
+	ErrInvalidFreeze = errors.New("end must not be before start and the range must be at most 366 nights")
+	ErrNotFrozen     = errors.New("pricing is not frozen")
+)
+
+// AdjustFrozen marks a night priced from a freeze instead of the rules.
+const AdjustFrozen = "frozen"
+
+// PriceFreeze pins a property's nightly rates in [Start, End] at what they
+// were when it was taken. While it holds, weekend, seasonal and event
+// multipliers, the surge cap, floor and ceiling are all bypassed for those
+// nights.
+type PriceFreeze struct {
+	Start    string            `json:"start"`
+	End      string            `json:"end"`
+	Rates    map[string]int64  `json:"rates"`
+	FrozenAt apitypes.JSONTime `json:"frozen_at"`
+}
+
+// FreezeRates captures the current rate of every night from start to end,
+// inclusive, as fixed overrides, replacing any earlier freeze.
+func (e *Engine) FreezeRates(propertyID string, start, end, now time.Time) (PriceFreeze, error) {
+	nights := int(end.Sub(start).Hours()/24) + 1
+	if nights < 1 || nights > maxFreezeNights {
+		return PriceFreeze{}, ErrInvalidFreeze
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return PriceFreeze{}, ErrPropertyNotFound
+	}
+	// Price against the rules alone, not a freeze being replaced.
+	p.Freeze = nil
+	f := &PriceFreeze{
+		Start:    start.Format(time.DateOnly),
+		End:      end.Format(time.DateOnly),
+		Rates:    make(map[string]int64, nights),
+		FrozenAt: apitypes.JSONTime{Time: now},
+	}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		n := e.priceNightLocked(p, d)
+		f.Rates[n.Date] = n.RateCents
+	}
+	p.Freeze = f
+	e.changedLocked(propertyID)
+	return f.clone(), nil
+}
+
+// ResumeRates lifts a property's freeze so its nights are priced by the
+// rules again.
+func (e *Engine) ResumeRates(propertyID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return ErrPropertyNotFound
+	}
+	if p.Freeze == nil {
+		return ErrNotFrozen
+	}
+	p.Freeze = nil
+	e.changedLocked(propertyID)
+	return nil
+}
+
+// frozenRate returns the pinned rate for date, if the property has one.
+func (p *Property) frozenRate(date string) (int64, bool) {
+	if p.Freeze == nil {
+		return 0, false
+	}
+	rate, ok := p.Freeze.Rates[date]
+	return rate, ok
+}
+
+func (f *PriceFreeze) clone() PriceFreeze {
+	c := *f
+	c.Rates = make(map[string]int64, len(f.Rates))
+	for d, r := range f.Rates {
+		c.Rates[d] = r
+	}
+	return c
+}
+
+func (s *server) freezePricingHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	start, err1 := time.Parse(time.DateOnly, req.Start)
+	end, err2 := time.Parse(time.DateOnly, req.End)
+	if err1 != nil || err2 != nil {
+		respondError(w, http.StatusBadRequest, "invalid_dates", "start and end must be formatted YYYY-MM-DD")
+		return
+	}
+	f, err := s.engine.FreezeRates(chi.URLParam(r, "propertyId"), start, end, time.Now().UTC())
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+	case errors.Is(err, ErrInvalidFreeze):
+		respondError(w, http.StatusUnprocessableEntity, "invalid_freeze", err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	default:
+		respondJSON(w, http.StatusOK, f)
+	}
+}
+
+func (s *server) resumePricingHandler(w http.ResponseWriter, r *http.Request) {
+	err := s.engine.ResumeRates(chi.URLParam(r, "propertyId"))
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+	case errors.Is(err, ErrNotFrozen):
+		respondError(w, http.StatusConflict, "not_frozen", err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func nightlyQuote(t *testing.T, h http.Handler, query string) StayQuote {
+	t.Helper()
+	var q StayQuote
+	rec := doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/nightly?"+query, nil, &q)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	return q
+}
+
+func TestFrozenNightsIgnoreSurgeUntilResumed(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Department: "La Libertad", Currency: "USD", BaseRateCents: 10000})
+
+	var f PriceFreeze
+	rec := doJSON(t, h, http.MethodPost, "/api/pricing/rental/tunco-villa/freeze", map[string]string{"start": "2026-08-05", "end": "2026-08-06"}, &f)
+	if rec.Code != http.StatusOK || len(f.Rates) != 2 || f.Rates["2026-08-05"] != 10000 {
+		t.Fatalf("status %d freeze %+v", rec.Code, f)
+	}
+
+	// A festival announced after the freeze would double the rate.
+	doJSON(t, h, http.MethodPut, "/api/pricing/events/fiestas", EventRule{
+		Name: "Fiestas", Department: "La Libertad", Start: "2026-08-01", End: "2026-08-31", Multiplier: 2,
+	}, nil)
+
+	q := nightlyQuote(t, h, "check_in=2026-08-05&check_out=2026-08-08")
+	for i, want := range []int64{10000, 10000, 20000} {
+		if q.Nights[i].RateCents != want {
+			t.Errorf("%s rate = %d, want %d", q.Nights[i].Date, q.Nights[i].RateCents, want)
+		}
+	}
+	if kinds := adjustmentKinds(q.Nights[0]); len(kinds) != 1 || kinds[0] != AdjustFrozen {
+		t.Errorf("frozen night adjustments = %v, want only frozen", kinds)
+	}
+
+	if rec := doJSON(t, h, http.MethodPost, "/api/pricing/rental/tunco-villa/resume", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("resume: status %d", rec.Code)
+	}
+	q = nightlyQuote(t, h, "check_in=2026-08-05&check_out=2026-08-07")
+	if q.Nights[0].RateCents != 20000 || q.Nights[1].RateCents != 20000 {
+		t.Fatalf("after resume rates = %d, %d, want surge back at 20000", q.Nights[0].RateCents, q.Nights[1].RateCents)
+	}
+}
+
+func TestFreezeSurvivesConfigUpdate(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 10000})
+	doJSON(t, h, http.MethodPost, "/api/pricing/rental/tunco-villa/freeze", map[string]string{"start": "2026-08-05", "end": "2026-08-05"}, nil)
+
+	doJSON(t, h, http.MethodPut, "/api/pricing/rental/tunco-villa/config", Property{Currency: "USD", BaseRateCents: 15000}, nil)
+
+	q := nightlyQuote(t, h, "check_in=2026-08-05&check_out=2026-08-07")
+	if q.Nights[0].RateCents != 10000 || q.Nights[1].RateCents != 15000 {
+		t.Fatalf("rates = %d, %d, want frozen 10000 then new base 15000", q.Nights[0].RateCents, q.Nights[1].RateCents)
+	}
+}
+
+func TestFreezeErrors(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 10000})
+
+	tests := []struct {
+		path string
+		body interface{}
+		want int
+	}{
+		{"/api/pricing/rental/nowhere/freeze", map[string]string{"start": "2026-08-05", "end": "2026-08-06"}, http.StatusNotFound},
+		{"/api/pricing/rental/tunco-villa/freeze", map[string]string{"start": "2026-08-06", "end": "2026-08-05"}, http.StatusUnprocessableEntity},
+		{"/api/pricing/rental/tunco-villa/freeze", map[string]string{"start": "August", "end": "2026-08-05"}, http.StatusBadRequest},
+		{"/api/pricing/rental/tunco-villa/resume", nil, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rec := doJSON(t, h, http.MethodPost, tt.path, tt.body, nil); rec.Code != tt.want {
+			t.Errorf("%s %v: status %d, want %d", tt.path, tt.body, rec.Code, tt.want)
+		}
+	}
+}
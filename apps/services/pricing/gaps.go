@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// maxGapRangeNights bounds how far a gap search can look.
+const maxGapRangeNights = 366
+
+var (
+	ErrInvalidStays = errors.New("each stay needs check_in before check_out, formatted YYYY-MM-DD, and stays must not overlap")
+	ErrInvalidRange = errors.New("to must not be before from and the range must be at most 366 nights")
+)
+
+// BookedStay is a reservation occupying the nights from CheckIn up to but
+// excluding CheckOut. Dates are ISO formatted so they compare lexically.
+type BookedStay struct {
+	CheckIn  string `json:"check_in"`
+	CheckOut string `json:"check_out"`
+}
+
+// validateStays checks each stay is well formed and sorts them by check-in,
+// rejecting any two that share a night.
+func validateStays(stays []BookedStay) error {
+	for _, st := range stays {
+		in, err1 := time.Parse(time.DateOnly, st.CheckIn)
+		out, err2 := time.Parse(time.DateOnly, st.CheckOut)
+		if err1 != nil || err2 != nil || !out.After(in) {
+			return ErrInvalidStays
+		}
+	}
+	sort.Slice(stays, func(i, j int) bool { return stays[i].CheckIn < stays[j].CheckIn })
+	for i := 1; i < len(stays); i++ {
+		if stays[i].CheckIn < stays[i-1].CheckOut {
+			return ErrInvalidStays
+		}
+	}
+	return nil
+}
+
+// SetBookedStays replaces a property's known reservations, as synced from
+// the bookings service or a channel manager.
+func (e *Engine) SetBookedStays(propertyID string, stays []BookedStay) error {
+	stays = append([]BookedStay{}, stays...)
+	if err := validateStays(stays); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return ErrPropertyNotFound
+	}
+	p.BookedStays = stays
+	return nil
+}
+
+// GapNight is one orphaned night with its current and suggested rate.
+type GapNight struct {
+	Date           string `json:"date"`
+	RateCents      int64  `json:"rate_cents"`
+	SuggestedCents int64  `json:"suggested_cents"`
+}
+
+// BookingGap is a run of unbooked nights, too short for most guests, with a
+// booking checking out the morning it starts and another checking in the day
+// after it ends.
+type BookingGap struct {
+	Start          string           `json:"start"`
+	End            string           `json:"end"`
+	Nights         int              `json:"nights"`
+	Discount       apitypes.Percent `json:"discount"`
+	RateCents      int64            `json:"rate_cents"`
+	SuggestedCents int64            `json:"suggested_cents"`
+	NightlyRates   []GapNight       `json:"nightly_rates"`
+}
+
+// BookingGaps finds gaps of at most maxNights between consecutive stays
+// that touch [from, to]. Each night's suggestion takes the engine's gap
+// discount off the current rate, but never below the property's floor.
+func (e *Engine) BookingGaps(propertyID string, from, to time.Time, maxNights int) ([]BookingGap, error) {
+	nights := int(to.Sub(from).Hours()/24) + 1
+	if nights < 1 || nights > maxGapRangeNights {
+		return nil, ErrInvalidRange
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return nil, ErrPropertyNotFound
+	}
+	first, last := from.Format(time.DateOnly), to.Format(time.DateOnly)
+	gaps := []BookingGap{}
+	for i := 1; i < len(p.BookedStays); i++ {
+		start, _ := time.Parse(time.DateOnly, p.BookedStays[i-1].CheckOut)
+		next, _ := time.Parse(time.DateOnly, p.BookedStays[i].CheckIn)
+		n := int(next.Sub(start).Hours() / 24)
+		end := next.AddDate(0, 0, -1)
+		if n < 1 || n > maxNights || end.Format(time.DateOnly) < first || start.Format(time.DateOnly) > last {
+			continue
+		}
+		g := BookingGap{
+			Start:        start.Format(time.DateOnly),
+			End:          end.Format(time.DateOnly),
+			Nights:       n,
+			Discount:     e.opts.GapDiscount,
+			NightlyRates: make([]GapNight, 0, n),
+		}
+		for d := start; d.Before(next); d = d.AddDate(0, 0, 1) {
+			night := e.priceNightLocked(p, d)
+			suggested := night.RateCents - e.opts.GapDiscount.Of(night.RateCents)
+			if suggested < p.FloorCents {
+				// A frozen rate may already sit below the floor.
+				suggested = min(p.FloorCents, night.RateCents)
+			}
+			g.NightlyRates = append(g.NightlyRates, GapNight{Date: night.Date, RateCents: night.RateCents, SuggestedCents: suggested})
+			g.RateCents += night.RateCents
+			g.SuggestedCents += suggested
+		}
+		gaps = append(gaps, g)
+	}
+	return gaps, nil
+}
+
+func (s *server) putBookedStaysHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Stays []BookedStay `json:"stays"`
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	err := s.engine.SetBookedStays(chi.URLParam(r, "propertyId"), req.Stays)
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+	case errors.Is(err, ErrInvalidStays):
+		respondError(w, http.StatusUnprocessableEntity, "invalid_stays", err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// getBookingGapsHandler lists orphaned nights between bookings in
+// ?from=&to= with a suggested last-minute rate. ?max_nights= overrides the
+// configured gap length.
+func (s *server) getBookingGapsHandler(w http.ResponseWriter, r *http.Request) {
+	from, err1 := time.Parse(time.DateOnly, r.URL.Query().Get("from"))
+	to, err2 := time.Parse(time.DateOnly, r.URL.Query().Get("to"))
+	if err1 != nil || err2 != nil {
+		respondError(w, http.StatusBadRequest, "invalid_dates", "from and to must be formatted YYYY-MM-DD")
+		return
+	}
+	maxNights := s.engine.opts.GapMaxNights
+	if v := r.URL.Query().Get("max_nights"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			respondError(w, http.StatusBadRequest, "invalid_max_nights", "max_nights must be a positive integer")
+			return
+		}
+		maxNights = n
+	}
+	gaps, err := s.engine.BookingGaps(chi.URLParam(r, "propertyId"), from, to, maxNights)
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+	case errors.Is(err, ErrInvalidRange):
+		respondError(w, http.StatusUnprocessableEntity, "invalid_range", err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	default:
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"property_id": chi.URLParam(r, "propertyId"),
+			"from":        from.Format(time.DateOnly),
+			"to":          to.Format(time.DateOnly),
+			"max_nights":  maxNights,
+			"gaps":        gaps,
+		})
+	}
+}
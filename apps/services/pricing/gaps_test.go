@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+type gapsResponse struct {
+	MaxNights int          `json:"max_nights"`
+	Gaps      []BookingGap `json:"gaps"`
+}
+
+func TestOrphanedNightBetweenBookingsIsFlagged(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 10000, FloorCents: 7000})
+	rec := doJSON(t, h, http.MethodPut, "/api/pricing/rental/tunco-villa/bookings", map[string]interface{}{
+		"stays": []BookedStay{
+			{CheckIn: "2026-06-10", CheckOut: "2026-06-13"},
+			// Out of order on purpose; stays are sorted on the way in.
+			{CheckIn: "2026-06-20", CheckOut: "2026-06-22"},
+			{CheckIn: "2026-06-14", CheckOut: "2026-06-17"},
+		},
+	}, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("put bookings: status %d body %s", rec.Code, rec.Body)
+	}
+
+	var resp gapsResponse
+	rec = doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/gaps?from=2026-06-01&to=2026-06-30", nil, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d body %s", rec.Code, rec.Body)
+	}
+	// The night of the 13th sits alone between two stays; the three nights
+	// from the 17th are longer than the two-night threshold.
+	if len(resp.Gaps) != 1 {
+		t.Fatalf("gaps = %+v, want only the orphaned night", resp.Gaps)
+	}
+	g := resp.Gaps[0]
+	if g.Start != "2026-06-13" || g.End != "2026-06-13" || g.Nights != 1 {
+		t.Errorf("gap = %+v, want the single night of 2026-06-13", g)
+	}
+	if g.Discount != 20*apitypes.OnePercent || g.RateCents != 10000 || g.SuggestedCents != 8000 {
+		t.Errorf("gap pricing = %s off %d -> %d, want 20%% off 10000 -> 8000", g.Discount, g.RateCents, g.SuggestedCents)
+	}
+
+	// Widening the threshold picks up the three-night gap too.
+	doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/gaps?from=2026-06-01&to=2026-06-30&max_nights=3", nil, &resp)
+	if len(resp.Gaps) != 2 || resp.Gaps[1].Start != "2026-06-17" || resp.Gaps[1].Nights != 3 {
+		t.Errorf("gaps with max_nights=3 = %+v", resp.Gaps)
+	}
+}
+
+func TestGapSuggestionRespectsFloor(t *testing.T) {
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "zonte-cabin", Currency: "USD", BaseRateCents: 9000, FloorCents: 8000})
+	if err := s.engine.SetBookedStays("zonte-cabin", []BookedStay{
+		{CheckIn: "2026-06-01", CheckOut: "2026-06-05"},
+		{CheckIn: "2026-06-06", CheckOut: "2026-06-08"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp gapsResponse
+	doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/zonte-cabin/gaps?from=2026-06-05&to=2026-06-05", nil, &resp)
+	if len(resp.Gaps) != 1 || resp.Gaps[0].SuggestedCents != 8000 {
+		t.Fatalf("gaps = %+v, want one gap suggested at the 8000 floor", resp.Gaps)
+	}
+}
+
+func TestOverlappingBookedStaysRejected(t *testing.T) {
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 10000})
+	rec := doJSON(t, s.routes(), http.MethodPut, "/api/pricing/rental/tunco-villa/bookings", map[string]interface{}{
+		"stays": []BookedStay{
+			{CheckIn: "2026-06-10", CheckOut: "2026-06-13"},
+			{CheckIn: "2026-06-12", CheckOut: "2026-06-14"},
+		},
+	}, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
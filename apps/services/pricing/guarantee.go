@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// FloorAlert tells a host on a revenue guarantee plan that dynamic pricing
+// is pinned at their floor for too many upcoming nights.
+type FloorAlert struct {
+	PropertyID    string   `json:"property_id"`
+	FloorCents    int64    `json:"floor_cents"`
+	FloorNights   int      `json:"floor_nights"`
+	Threshold     int      `json:"threshold"`
+	HorizonNights int      `json:"horizon_nights"`
+	Dates         []string `json:"dates"`
+}
+
+// HostAlerter delivers floor alerts to hosts.
+type HostAlerter interface {
+	AlertHost(ctx context.Context, a FloorAlert) error
+}
+
+// logHostAlerter writes alerts to the service log.
+type logHostAlerter struct{}
+
+func (logHostAlerter) AlertHost(_ context.Context, a FloorAlert) error {
+	log.Printf("ALERT: property %s priced at floor %d for %d of the next %d nights (threshold %d)",
+		a.PropertyID, a.FloorCents, a.FloorNights, a.HorizonNights, a.Threshold)
+	return nil
+}
+
+// FloorNights lists the dates among the nights starting at from whose
+// computed rate sits at the property's floor.
+func (e *Engine) FloorNights(propertyID string, from time.Time, nights int) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return nil, ErrPropertyNotFound
+	}
+	var dates []string
+	if p.FloorCents <= 0 {
+		return dates, nil
+	}
+	for i := 0; i < nights; i++ {
+		n := e.priceNightLocked(p, from.AddDate(0, 0, i))
+		if n.RateCents <= p.FloorCents {
+			dates = append(dates, n.Date)
+		}
+	}
+	return dates, nil
+}
+
+// guaranteeMonitor watches properties on a revenue guarantee plan and alerts
+// their hosts when more than threshold of the next horizon nights are priced
+// at the floor. Each property is alerted once until it recovers.
+type guaranteeMonitor struct {
+	engine    *Engine
+	alerter   HostAlerter
+	threshold int
+	horizon   int
+	now       func() time.Time
+
+	mu      sync.Mutex
+	alerted map[string]bool
+}
+
+func newGuaranteeMonitor(engine *Engine, alerter HostAlerter, threshold, horizon int) *guaranteeMonitor {
+	return &guaranteeMonitor{
+		engine:    engine,
+		alerter:   alerter,
+		threshold: threshold,
+		horizon:   horizon,
+		now:       time.Now,
+		alerted:   make(map[string]bool),
+	}
+}
+
+// Check evaluates every guaranteed property once and returns the alerts it
+// raised.
+func (m *guaranteeMonitor) Check(ctx context.Context) []FloorAlert {
+	now := m.now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var raised []FloorAlert
+	for _, id := range m.engine.PropertyIDs("") {
+		p, err := m.engine.Property(id)
+		if err != nil || !p.RevenueGuarantee {
+			continue
+		}
+		dates, err := m.engine.FloorNights(id, from, m.horizon)
+		if err != nil {
+			continue
+		}
+		if len(dates) <= m.threshold {
+			delete(m.alerted, id)
+			continue
+		}
+		if m.alerted[id] {
+			continue
+		}
+		a := FloorAlert{
+			PropertyID:    id,
+			FloorCents:    p.FloorCents,
+			FloorNights:   len(dates),
+			Threshold:     m.threshold,
+			HorizonNights: m.horizon,
+			Dates:         dates,
+		}
+		if err := m.alerter.AlertHost(ctx, a); err != nil {
+			log.Printf("floor alert for property %s failed: %v", id, err)
+			continue
+		}
+		m.alerted[id] = true
+		raised = append(raised, a)
+	}
+	return raised
+}
+
+// Run checks on every tick until ctx is done.
+func (m *guaranteeMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordingAlerter struct{ alerts []FloorAlert }
+
+func (r *recordingAlerter) AlertHost(_ context.Context, a FloorAlert) error {
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+// seedFloorProperty prices 2026-06-01..04 at the floor and the rest of June
+// above it.
+func seedFloorProperty(e *Engine) {
+	e.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 8000, FloorCents: 9000, RevenueGuarantee: true})
+	e.PutSeasonalRule("tunco-villa", SeasonalRule{ID: "surf", Name: "Surf season", Start: "2026-06-05", End: "2026-06-30", Multiplier: 1.5})
+	// Not on the plan, so never alerted even though it is always at floor.
+	e.SetProperty(Property{ID: "zonte-cabin", Currency: "USD", BaseRateCents: 5000, FloorCents: 6000})
+}
+
+func newTestMonitor(threshold int) (*guaranteeMonitor, *recordingAlerter) {
+	e := NewEngine(EngineOptions{})
+	seedFloorProperty(e)
+	alerter := &recordingAlerter{}
+	m := newGuaranteeMonitor(e, alerter, threshold, 30)
+	m.now = func() time.Time { return time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC) }
+	return m, alerter
+}
+
+func TestFloorAlertAboveThreshold(t *testing.T) {
+	m, alerter := newTestMonitor(3)
+
+	m.Check(context.Background())
+	if len(alerter.alerts) != 1 {
+		t.Fatalf("alerts = %+v, want one", alerter.alerts)
+	}
+	a := alerter.alerts[0]
+	if a.PropertyID != "tunco-villa" || a.FloorNights != 4 || a.Dates[0] != "2026-06-01" || a.Dates[3] != "2026-06-04" {
+		t.Fatalf("alert = %+v", a)
+	}
+
+	// The host is not alerted again while the condition persists.
+	m.Check(context.Background())
+	if len(alerter.alerts) != 1 {
+		t.Fatalf("repeat check raised %d alerts, want 1", len(alerter.alerts))
+	}
+}
+
+func TestFloorAlertAtThresholdIsQuiet(t *testing.T) {
+	m, alerter := newTestMonitor(4)
+	m.Check(context.Background())
+	if len(alerter.alerts) != 0 {
+		t.Fatalf("alerts = %+v, want none at exactly the threshold", alerter.alerts)
+	}
+}
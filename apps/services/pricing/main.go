@@ -10,32 +10,98 @@ Dynamic pricing engine for:
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"log"
 	"net/http"
-	"os"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
 )
 
+// server wires configuration and dependencies into the HTTP handlers.
+type server struct {
+	cfg    config
+	engine *Engine
+	rates  *BtcRateProvider
+	// shed is nil when the router runs without load shedding.
+	shed *httpkit.LoadShedder
+}
+
+func newServer(cfg config) *server {
+	rates := NewBtcRateProvider(cfg.RateFallback, newCoinGeckoSource(cfg.CoinGeckoURL))
+	var cache RateCache
+	if cfg.RedisURL != "" {
+		// validate has already rejected a malformed URL.
+		if c, err := newRedisCache(cfg.RedisURL); err == nil {
+			cache = c
+		}
+	}
+	rates.UseCache(cache, cfg.RateCacheTTL)
+	if cfg.Tenants.Len() == 0 {
+		cfg.Tenants = tenantkit.New(tenantkit.DefaultID, builtinTenant)
+	}
+	return &server{
+		cfg: cfg,
+		engine: NewEngine(EngineOptions{
+			SurgeCap:     cfg.SurgeCap,
+			GapMaxNights: cfg.GapMaxNights,
+			GapDiscount:  cfg.GapDiscount,
+			SatsRounding: cfg.SatsRounding,
+		}),
+		rates: rates,
+		shed:  httpkit.NewLoadShedder(cfg.LoadShedding),
+	}
+}
+
 func main() {
-	port := os.Getenv("PRICING_SERVICE_PORT")
-	if port == "" {
-		port = "8003"
+	cfg := loadConfig()
+	tenants, err := loadTenants(cfg.TenantsFile, cfg.DefaultTenant)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
 	}
+	cfg.Tenants = tenants
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	outbound.SetIntegrationLimits(cfg.IntegrationLimits)
+	s := newServer(cfg)
+
+	monitor := newGuaranteeMonitor(s.engine, logHostAlerter{}, cfg.FloorAlertNights, cfg.FloorAlertHorizon)
+	go monitor.Run(context.Background(), cfg.FloorAlertInterval)
 
+	var sender PriceChangeSender = logPriceChangeSender{}
+	if cfg.PriceChangeWebhookURL != "" {
+		sender = newWebhookPriceChangeSender(cfg.PriceChangeWebhookURL)
+	}
+	newPriceChangeWatcher(s.engine, sender, cfg.PriceChangeThreshold, cfg.PriceChangeHorizon, cfg.PriceChangeDebounce).Watch(context.Background())
+
+	log.Printf("🇸🇻 Pricing service starting on port %s", cfg.Port)
+	if err := httpkit.Run(s.routes(), cfg.Port, cfg.HTTPTimeouts); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Pricing service stopped")
+}
+
+func (s *server) routes() chi.Router {
 	r := chi.NewRouter()
 
+	r.Use(httpkit.RequestID(s.cfg.RequestIDHeader))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{"http://localhost:3000", "http://localhost:8000"},
-		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type"},
+		AllowOriginFunc: s.cfg.Tenants.AllowOrigin,
+		AllowedMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:  []string{"Accept", "Authorization", "Content-Type", tenantkit.Header},
 	}))
+	if s.shed != nil {
+		r.Use(s.shed.Middleware)
+	}
+	httpkit.UseJSONErrors(r)
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		respondJSON(w, http.StatusOK, map[string]string{
@@ -43,51 +109,84 @@ func main() {
 			"service": "pricing",
 		})
 	})
+	r.Get("/ready", func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, map[string]string{
+			"status":  "ready",
+			"service": "pricing",
+		})
+	})
+	r.Handle("/metrics", promhttp.Handler())
 
 	r.Route("/api/pricing", func(r chi.Router) {
-		r.Get("/rental/{propertyId}", getRentalPricingHandler)
-		r.Get("/tour/{tourId}", getTourPricingHandler)
-		r.Get("/btc/rate", getBtcRateHandler)
-	})
+		r.Use(s.cfg.Tenants.Middleware)
+		r.Get("/rental/{propertyId}", s.getRentalPricingHandler)
+		r.Get("/rental/{propertyId}/nightly", s.getNightlyBreakdownHandler)
+		r.Put("/rental/{propertyId}/bookings", s.putBookedStaysHandler)
+		r.Get("/rental/{propertyId}/gaps", s.getBookingGapsHandler)
+		r.Get("/rental/{propertyId}/breakeven", s.getBreakEvenHandler)
+		r.Get("/tour/{tourId}", s.getTourPricingHandler)
+		r.Get("/btc/rate", s.getBtcRateHandler)
+		r.Get("/btc/sources", s.getBtcSourcesHandler)
 
-	log.Printf("🇸🇻 Pricing service starting on port %s", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), r); err != nil {
-		log.Fatal(err)
-	}
-}
+		// Admin operations that change prices
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireAdmin)
+			r.Put("/rental/{propertyId}/config", s.putPropertyHandler)
+			r.Put("/tour/{tourId}/config", s.putTourHandler)
+			r.Put("/rental/{propertyId}/scheduled-rates/{rateId}", s.putScheduledRateHandler)
+			r.Delete("/rental/{propertyId}/scheduled-rates/{rateId}", s.deleteScheduledRateHandler)
+			r.Post("/rental/{propertyId}/freeze", s.freezePricingHandler)
+			r.Post("/rental/{propertyId}/resume", s.resumePricingHandler)
 
-func getRentalPricingHandler(w http.ResponseWriter, r *http.Request) {
-	propertyID := chi.URLParam(r, "propertyId")
-	// TODO: Dynamic pricing based on demand, season, events
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"property_id":    propertyID,
-		"nightly_rate":   0,
-		"currency":       "USD",
-		"pricing_model":  "base",
+			// Seasonal rules across many properties
+			r.Post("/seasonal/bulk", s.bulkApplySeasonalHandler)
+			r.Delete("/seasonal/bulk", s.bulkDeleteSeasonalHandler)
+
+			// Special events
+			r.Put("/events/{eventId}", s.putEventHandler)
+			r.Delete("/events/{eventId}", s.deleteEventHandler)
+		})
 	})
+
+	return r
 }
 
-func getTourPricingHandler(w http.ResponseWriter, r *http.Request) {
-	tourID := chi.URLParam(r, "tourId")
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"tour_id":  tourID,
-		"price":    0,
-		"currency": "USD",
-	})
+func (s *server) getBtcRateHandler(w http.ResponseWriter, r *http.Request) {
+	rate, err := s.rates.Rate(r.Context())
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, "rate_unavailable", "no BTC/USD rate source is reachable")
+		return
+	}
+	resp := map[string]interface{}{
+		"btc_usd":         rate.BtcUSD,
+		"sats_per_dollar": rate.SatsPerDollar,
+		"source":          rate.Source,
+		"fetched_at":      rate.FetchedAt,
+		"cached":          rate.Cached,
+		"stale":           rate.Stale,
+		"manual_fallback": rate.ManualFallback,
+	}
+	switch {
+	case rate.ManualFallback:
+		resp["warning"] = "all BTC rate sources are down; this is a manually configured fallback rate"
+	case rate.Stale:
+		resp["warning"] = "all BTC rate sources are down; this is the last rate fetched"
+	}
+	respondJSON(w, http.StatusOK, resp)
 }
 
-func getBtcRateHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Fetch real-time BTC/USD rate, cache in Redis
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"btc_usd":    0,
-		"sats_per_dollar": 0,
-		"source":     "coingecko",
-		"cached":     false,
-	})
+// getBtcSourcesHandler reports each BTC rate source's health for
+// monitoring. It shows what the last rate lookups found and does not poll
+// the sources itself.
+func (s *server) getBtcSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{"sources": s.rates.Sources()})
 }
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+	httpkit.RespondJSON(w, status, data)
+}
+
+// respondError writes the standard error envelope.
+func respondError(w http.ResponseWriter, status int, code, message string) {
+	httpkit.RespondError(w, status, code, message)
 }
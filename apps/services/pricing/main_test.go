@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// testAdminKey is the admin API key test servers accept.
+const testAdminKey = "test-admin-key"
+
+// testTenants serves the built-in tenant alone.
+var testTenants = tenantkit.New(tenantkit.DefaultID, builtinTenant)
+
+func newTestServer() *server {
+	return &server{
+		cfg:    config{AdminAPIKey: testAdminKey, Tenants: testTenants},
+		engine: NewEngine(EngineOptions{SurgeCap: 2.5, GapMaxNights: 2, GapDiscount: 20 * apitypes.OnePercent}),
+		rates:  NewBtcRateProvider(RateFallback{Mode: FallbackRefuse}),
+	}
+}
+
+// doJSON sends body (marshalled as JSON unless nil) with admin credentials
+// and decodes the response into out when out is non-nil.
+func doJSON(t *testing.T, h http.Handler, method, path string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func TestMalformedBodyIsA400WithCode(t *testing.T) {
+	h := newTestServer().routes()
+	tests := map[string]string{
+		`{"base_rate_cents": 100`:                    httpkit.DecodeInvalidJSON,
+		`{"base_rate_cents": 100, "surprise": true}`: httpkit.DecodeUnknownField,
+		`{"base_rate_cents": "one hundred dollars"}`: httpkit.DecodeInvalidType,
+	}
+	for body, code := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/api/pricing/rental/casa-1/config", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testAdminKey)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var resp map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusBadRequest || resp["error"] != code || resp["message"] == "" {
+			t.Errorf("%s: status %d, body %v; want 400 %s", body, rec.Code, resp, code)
+		}
+	}
+}
+
+func TestPriceChangingRoutesRequireAdmin(t *testing.T) {
+	h := newTestServer().routes()
+	routes := []struct{ method, path string }{
+		{http.MethodPut, "/api/pricing/rental/casa-1/config"},
+		{http.MethodPut, "/api/pricing/tour/volcano-hike/config"},
+		{http.MethodPut, "/api/pricing/rental/casa-1/scheduled-rates/r1"},
+		{http.MethodDelete, "/api/pricing/rental/casa-1/scheduled-rates/r1"},
+		{http.MethodPost, "/api/pricing/rental/casa-1/freeze"},
+		{http.MethodPost, "/api/pricing/rental/casa-1/resume"},
+		{http.MethodPost, "/api/pricing/seasonal/bulk"},
+		{http.MethodDelete, "/api/pricing/seasonal/bulk"},
+		{http.MethodPut, "/api/pricing/events/fiestas"},
+		{http.MethodDelete, "/api/pricing/events/fiestas"},
+	}
+	for _, rt := range routes {
+		// No key, the wrong key, and the key without the Bearer scheme.
+		for _, auth := range []string{"", "Bearer wrong-key", testAdminKey} {
+			req := httptest.NewRequest(rt.method, rt.path, strings.NewReader("{}"))
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with %q: status %d, want 401", rt.method, rt.path, auth, rec.Code)
+			}
+		}
+	}
+
+	// Quotes stay open to everyone.
+	doJSON(t, h, http.MethodPut, "/api/pricing/tour/volcano-hike/config", Tour{PriceCents: 3500}, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pricing/tour/volcano-hike", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("tour quote: status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+)
+
+// RateChange is one night whose rate moved by at least the threshold.
+type RateChange struct {
+	Date          string `json:"date"`
+	PreviousCents int64  `json:"previous_cents"`
+	RateCents     int64  `json:"rate_cents"`
+}
+
+// PriceChangeEvent is the body of a pricing.changed webhook.
+type PriceChangeEvent struct {
+	Type       string            `json:"type"`
+	PropertyID string            `json:"property_id"`
+	Currency   string            `json:"currency"`
+	Changes    []RateChange      `json:"changes"`
+	DetectedAt apitypes.JSONTime `json:"detected_at"`
+}
+
+// PriceChangeSender delivers pricing.changed events downstream.
+type PriceChangeSender interface {
+	SendPriceChange(ctx context.Context, ev PriceChangeEvent) error
+}
+
+// logPriceChangeSender writes events to the service log, for when no webhook
+// is configured.
+type logPriceChangeSender struct{}
+
+func (logPriceChangeSender) SendPriceChange(_ context.Context, ev PriceChangeEvent) error {
+	log.Printf("pricing.changed: property %s moved on %d nights", ev.PropertyID, len(ev.Changes))
+	return nil
+}
+
+// webhookPriceChangeSender POSTs events as JSON to a subscriber URL.
+type webhookPriceChangeSender struct {
+	url    string
+	client *outbound.Client
+}
+
+func newWebhookPriceChangeSender(url string) *webhookPriceChangeSender {
+	return &webhookPriceChangeSender{url: url, client: outbound.NewClient("pricing-webhook", 10*time.Second)}
+}
+
+func (s *webhookPriceChangeSender) SendPriceChange(ctx context.Context, ev PriceChangeEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NightRates returns the computed rate of each of the nights starting at
+// from, keyed by date, along with the property's currency.
+func (e *Engine) NightRates(propertyID string, from time.Time, nights int) (map[string]int64, string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return nil, "", ErrPropertyNotFound
+	}
+	rates := make(map[string]int64, nights)
+	for i := 0; i < nights; i++ {
+		n := e.priceNightLocked(p, from.AddDate(0, 0, i))
+		rates[n.Date] = n.RateCents
+	}
+	return rates, p.Currency, nil
+}
+
+// priceChangeWatcher turns engine changes into pricing.changed events. A
+// property's changes are debounced so a burst of edits sends one event, and
+// only nights that moved by at least threshold since they were last
+// announced are reported; smaller moves accumulate until they cross it. A
+// property's first rates are its baseline and are never announced.
+type priceChangeWatcher struct {
+	engine    *Engine
+	sender    PriceChangeSender
+	threshold apitypes.Percent
+	horizon   int
+	debounce  time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+
+	// checkMu serializes checks. It is separate from mu so a slow webhook
+	// never holds up Touch, and with it the engine.
+	checkMu sync.Mutex
+	// baseline holds the last announced rate of each night, by property.
+	baseline map[string]map[string]int64
+}
+
+func newPriceChangeWatcher(engine *Engine, sender PriceChangeSender, threshold apitypes.Percent, horizon int, debounce time.Duration) *priceChangeWatcher {
+	return &priceChangeWatcher{
+		engine:    engine,
+		sender:    sender,
+		threshold: threshold,
+		horizon:   horizon,
+		debounce:  debounce,
+		now:       time.Now,
+		baseline:  make(map[string]map[string]int64),
+		pending:   make(map[string]*time.Timer),
+	}
+}
+
+// Watch records the engine's current rates as the baseline and subscribes
+// to its changes.
+func (w *priceChangeWatcher) Watch(ctx context.Context) {
+	for _, id := range w.engine.PropertyIDs("") {
+		w.Check(ctx, id)
+	}
+	w.engine.OnChange(w.Touch)
+}
+
+// Touch schedules a check of a property once it has been quiet for the
+// debounce period, restarting the wait if one is already scheduled. It
+// never calls into the engine, so the engine may call it under its lock.
+func (w *priceChangeWatcher) Touch(propertyID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t, ok := w.pending[propertyID]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		if w.pending[propertyID] == t {
+			delete(w.pending, propertyID)
+		}
+		w.mu.Unlock()
+		w.Check(context.Background(), propertyID)
+	})
+	w.pending[propertyID] = t
+}
+
+// Flush checks every property with a change still waiting out its debounce
+// period, without waiting.
+func (w *priceChangeWatcher) Flush(ctx context.Context) {
+	w.mu.Lock()
+	var ids []string
+	for id, t := range w.pending {
+		if t.Stop() {
+			ids = append(ids, id)
+		}
+		delete(w.pending, id)
+	}
+	w.mu.Unlock()
+	sort.Strings(ids)
+	for _, id := range ids {
+		w.Check(ctx, id)
+	}
+}
+
+// Check compares a property's upcoming rates with its baseline and sends an
+// event for the nights that moved by at least the threshold. The baseline
+// moves only for nights that were announced, or seen for the first time.
+// When the send fails the baseline is kept so the next check reports the
+// change again.
+func (w *priceChangeWatcher) Check(ctx context.Context, propertyID string) *PriceChangeEvent {
+	now := w.now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	w.checkMu.Lock()
+	defer w.checkMu.Unlock()
+	rates, currency, err := w.engine.NightRates(propertyID, from, w.horizon)
+	if err != nil {
+		// The property is gone; forget it.
+		delete(w.baseline, propertyID)
+		return nil
+	}
+	base, known := w.baseline[propertyID]
+	if !known {
+		w.baseline[propertyID] = rates
+		return nil
+	}
+	// Forget nights that have passed.
+	for date := range base {
+		if _, ok := rates[date]; !ok {
+			delete(base, date)
+		}
+	}
+
+	var changes []RateChange
+	for date, rate := range rates {
+		previous, ok := base[date]
+		if !ok {
+			base[date] = rate
+			continue
+		}
+		delta := rate - previous
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta > 0 && delta >= w.threshold.Of(previous) {
+			changes = append(changes, RateChange{Date: date, PreviousCents: previous, RateCents: rate})
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Date < changes[j].Date })
+	ev := PriceChangeEvent{
+		Type:       "pricing.changed",
+		PropertyID: propertyID,
+		Currency:   currency,
+		Changes:    changes,
+		DetectedAt: apitypes.JSONTime{Time: now},
+	}
+	if err := w.sender.SendPriceChange(ctx, ev); err != nil {
+		log.Printf("ALERT: pricing.changed for property %s not delivered: %v", propertyID, err)
+		return nil
+	}
+	for _, c := range changes {
+		base[c.Date] = c.RateCents
+	}
+	return &ev
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+type recordingPriceChanges struct {
+	mu     sync.Mutex
+	events []PriceChangeEvent
+}
+
+func (r *recordingPriceChanges) SendPriceChange(_ context.Context, ev PriceChangeEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *recordingPriceChanges) sent() []PriceChangeEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]PriceChangeEvent(nil), r.events...)
+}
+
+// newTestWatcher watches a server's engine with a 5% threshold over 30
+// nights from 2026-06-01.
+func newTestWatcher(t *testing.T, debounce time.Duration) (*server, *priceChangeWatcher, *recordingPriceChanges) {
+	t.Helper()
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Department: "La Libertad", Currency: "USD", BaseRateCents: 10000})
+	sender := &recordingPriceChanges{}
+	w := newPriceChangeWatcher(s.engine, sender, 5*apitypes.OnePercent, 30, debounce)
+	w.now = func() time.Time { return time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC) }
+	w.Watch(context.Background())
+	return s, w, sender
+}
+
+func TestMaterialRateChangeSendsOneEvent(t *testing.T) {
+	s, w, sender := newTestWatcher(t, time.Hour)
+	h := s.routes()
+
+	// Two edits in a burst: a season and then a bigger one replacing it.
+	for _, multiplier := range []float64{1.2, 1.5} {
+		rec := doJSON(t, h, http.MethodPost, "/api/pricing/seasonal/bulk", map[string]interface{}{
+			"property_ids": []string{"tunco-villa"},
+			"rule":         SeasonalRule{ID: "fiestas", Name: "Fiestas", Start: "2026-06-10", End: "2026-06-11", Multiplier: multiplier},
+		}, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("seasonal: status %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if got := sender.sent(); len(got) != 0 {
+		t.Fatalf("sent %+v before the debounce period ended", got)
+	}
+
+	w.Flush(context.Background())
+	got := sender.sent()
+	if len(got) != 1 {
+		t.Fatalf("sent %d events, want 1", len(got))
+	}
+	ev := got[0]
+	if ev.Type != "pricing.changed" || ev.PropertyID != "tunco-villa" || ev.Currency != "USD" || len(ev.Changes) != 2 {
+		t.Fatalf("event = %+v", ev)
+	}
+	if c := ev.Changes[0]; c.Date != "2026-06-10" || c.PreviousCents != 10000 || c.RateCents != 15000 {
+		t.Fatalf("change = %+v, want 2026-06-10 from 10000 to 15000", c)
+	}
+
+	// Nothing further moved, so a later flush is quiet.
+	w.Touch("tunco-villa")
+	w.Flush(context.Background())
+	if got := sender.sent(); len(got) != 1 {
+		t.Fatalf("sent %d events after an idle flush, want 1", len(got))
+	}
+}
+
+func TestTinyRateChangeSendsNothing(t *testing.T) {
+	s, w, sender := newTestWatcher(t, time.Hour)
+
+	if _, err := s.engine.PutSeasonalRule("tunco-villa", SeasonalRule{ID: "drizzle", Name: "Drizzle", Start: "2026-06-10", End: "2026-06-12", Multiplier: 1.02}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush(context.Background())
+	if got := sender.sent(); len(got) != 0 {
+		t.Fatalf("sent %+v for a 2%% change, want nothing", got)
+	}
+
+	// Small moves accumulate against the last announced rate: another 4%
+	// on top crosses the threshold.
+	if _, err := s.engine.PutSeasonalRule("tunco-villa", SeasonalRule{ID: "drizzle", Name: "Drizzle", Start: "2026-06-10", End: "2026-06-12", Multiplier: 1.06}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush(context.Background())
+	if got := sender.sent(); len(got) != 1 || len(got[0].Changes) != 3 || got[0].Changes[0].PreviousCents != 10000 {
+		t.Fatalf("sent %+v, want one event from the original rate", got)
+	}
+}
+
+func TestPriceChangeDebounceFiresOnItsOwn(t *testing.T) {
+	s, _, sender := newTestWatcher(t, 20*time.Millisecond)
+	s.engine.PutEvent(EventRule{ID: "surf-open", Name: "Surf Open", Department: "La Libertad", Start: "2026-06-20", End: "2026-06-21", Multiplier: 2})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sender.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := sender.sent(); len(got) != 1 || got[0].PropertyID != "tunco-villa" {
+		t.Fatalf("sent %+v, want one event for tunco-villa", got)
+	}
+}
+
+func TestWebhookPriceChangeSenderPostsEvent(t *testing.T) {
+	var got PriceChangeEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	ev := PriceChangeEvent{Type: "pricing.changed", PropertyID: "tunco-villa", Changes: []RateChange{{Date: "2026-06-10", PreviousCents: 10000, RateCents: 15000}}}
+	if err := newWebhookPriceChangeSender(srv.URL).SendPriceChange(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if got.PropertyID != "tunco-villa" || len(got.Changes) != 1 || got.Changes[0].RateCents != 15000 {
+		t.Fatalf("webhook received %+v", got)
+	}
+}
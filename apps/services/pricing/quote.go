@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// maxStayNights bounds a single quote so a typo cannot price a year.
+const maxStayNights = 90
+
+var ErrInvalidStay = errors.New("check_out must be after check_in and within 90 nights")
+
+// Adjustment kinds recorded in a night's breakdown.
+const (
+	AdjustWeekend  = "weekend"
+	AdjustSeasonal = "seasonal"
+	AdjustEvent    = "event"
+	AdjustSurgeCap = "surge_cap"
+	AdjustFloor    = "floor"
+	AdjustCeiling  = "ceiling"
+
+	AdjustSatsRounding = "sats_rounding"
+	AdjustSatsMinimum  = "sats_minimum"
+)
+
+// Adjustment is one rule that changed a night's rate.
+type Adjustment struct {
+	Kind       string  `json:"kind"`
+	Name       string  `json:"name,omitempty"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+}
+
+// NightlyRate is the price of one night and how it was reached.
+type NightlyRate struct {
+	Date        string       `json:"date"`
+	BaseCents   int64        `json:"base_cents"`
+	RateCents   int64        `json:"rate_cents"`
+	Adjustments []Adjustment `json:"adjustments"`
+}
+
+// Tax is a named percentage charged on a stay.
+type Tax struct {
+	Code string           `json:"code"`
+	Name string           `json:"name"`
+	Rate apitypes.Percent `json:"rate"`
+}
+
+// taxes lists every tax the property charges: TaxRate as "tax", then its
+// named Taxes.
+func (p *Property) taxes() []Tax {
+	var out []Tax
+	if p.TaxRate > 0 {
+		out = append(out, Tax{Code: "tax", Name: "Tax", Rate: p.TaxRate})
+	}
+	return append(out, p.Taxes...)
+}
+
+// LineItem is a named amount added to or taken off a stay. TaxExempt marks
+// a fee left out of the taxed amount.
+type LineItem struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	AmountCents int64  `json:"amount_cents"`
+	TaxExempt   bool   `json:"tax_exempt,omitempty"`
+}
+
+// StayQuote prices every night of a stay and the charges on top of them.
+// TotalCents always equals SubtotalCents minus discounts plus fees plus tax,
+// and TaxCents the sum of Taxes. TaxRate is the combined rate.
+type StayQuote struct {
+	PropertyID    string            `json:"property_id"`
+	Currency      string            `json:"currency"`
+	CheckIn       apitypes.JSONDate `json:"check_in"`
+	CheckOut      apitypes.JSONDate `json:"check_out"`
+	Nights        []NightlyRate     `json:"nights"`
+	SubtotalCents int64             `json:"subtotal_cents"`
+	Discounts     []LineItem        `json:"discounts"`
+	Fees          []LineItem        `json:"fees"`
+	TaxRate       apitypes.Percent  `json:"tax_rate"`
+	Taxes         []LineItem        `json:"taxes"`
+	TaxCents      int64             `json:"tax_cents"`
+	TotalCents    int64             `json:"total_cents"`
+}
+
+// QuoteStay prices the nights from checkIn up to but excluding checkOut, with
+// the fees party owes under the property's fee schedule.
+func (e *Engine) QuoteStay(propertyID string, checkIn, checkOut time.Time, party Party) (StayQuote, error) {
+	nights := int(checkOut.Sub(checkIn).Hours() / 24)
+	if nights < 1 || nights > maxStayNights {
+		return StayQuote{}, ErrInvalidStay
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return StayQuote{}, ErrPropertyNotFound
+	}
+
+	q := StayQuote{
+		PropertyID: p.ID,
+		Currency:   p.Currency,
+		CheckIn:    apitypes.JSONDate{Time: checkIn},
+		CheckOut:   apitypes.JSONDate{Time: checkOut},
+		Nights:     make([]NightlyRate, 0, nights),
+		Discounts:  []LineItem{},
+		Fees:       []LineItem{},
+		Taxes:      []LineItem{},
+	}
+	for d := checkIn; d.Before(checkOut); d = d.AddDate(0, 0, 1) {
+		n := e.priceNightLocked(p, d)
+		q.Nights = append(q.Nights, n)
+		q.SubtotalCents += n.RateCents
+	}
+
+	taxable := q.SubtotalCents
+	if nights >= 7 && p.WeeklyDiscount > 0 {
+		off := p.WeeklyDiscount.Of(q.SubtotalCents)
+		q.Discounts = append(q.Discounts, LineItem{Code: "weekly", Name: "Weekly stay " + p.WeeklyDiscount.String() + " off", AmountCents: off})
+		taxable -= off
+	}
+	fees, taxableFees := p.stayFees(nights, party)
+	q.Fees = append(q.Fees, fees...)
+	taxable += taxableFees
+	for _, tax := range p.taxes() {
+		amount := tax.Rate.Of(taxable)
+		q.Taxes = append(q.Taxes, LineItem{Code: tax.Code, Name: tax.Name + " " + tax.Rate.String(), AmountCents: amount})
+		q.TaxRate += tax.Rate
+		q.TaxCents += amount
+	}
+	q.TotalCents = taxable + q.TaxCents
+	for _, fee := range q.Fees {
+		if fee.TaxExempt {
+			q.TotalCents += fee.AmountCents
+		}
+	}
+	return q, nil
+}
+
+// priceNightLocked applies weekend, seasonal and event multipliers to the
+// base rate in force that night, bounds their combined effect by the surge
+// cap, then bounds the result with bound. A frozen night skips all of that
+// and keeps its pinned rate. Callers must hold e.mu.
+func (e *Engine) priceNightLocked(p *Property, night time.Time) NightlyRate {
+	date := night.Format(time.DateOnly)
+	n := NightlyRate{Date: date, BaseCents: p.baseRateOn(date), Adjustments: []Adjustment{}}
+	if rate, ok := p.frozenRate(date); ok {
+		n.RateCents = rate
+		n.Adjustments = append(n.Adjustments, Adjustment{Kind: AdjustFrozen, Name: "frozen"})
+		return n
+	}
+
+	multiplier := 1.0
+	if wd := night.Weekday(); p.WeekendMultiplier > 0 && (wd == time.Friday || wd == time.Saturday) {
+		multiplier *= p.WeekendMultiplier
+		n.Adjustments = append(n.Adjustments, Adjustment{Kind: AdjustWeekend, Name: "weekend", Multiplier: p.WeekendMultiplier})
+	}
+	for _, rule := range p.SeasonalRules {
+		if rule.Start <= date && date <= rule.End {
+			multiplier *= rule.Multiplier
+			n.Adjustments = append(n.Adjustments, Adjustment{Kind: AdjustSeasonal, Name: rule.Name, Multiplier: rule.Multiplier})
+		}
+	}
+	for _, ev := range e.eventsLocked() {
+		if ev.appliesTo(p, date) {
+			multiplier *= ev.Multiplier
+			n.Adjustments = append(n.Adjustments, Adjustment{Kind: AdjustEvent, Name: ev.Name, Multiplier: ev.Multiplier})
+		}
+	}
+	if limit := e.opts.SurgeCap; limit > 0 && multiplier > limit {
+		multiplier = limit
+		n.Adjustments = append(n.Adjustments, Adjustment{Kind: AdjustSurgeCap, Name: "surge cap", Multiplier: limit})
+	}
+
+	n.RateCents = int64(math.Round(float64(n.BaseCents) * multiplier))
+	n.RateCents, n.Adjustments = e.bound(n.RateCents, p.FloorCents, p.CeilingCents, p.satsDenominated(), n.Adjustments)
+	return n
+}
+
+// eventsLocked returns the event rules in a stable order. Callers must hold
+// e.mu.
+func (e *Engine) eventsLocked() []EventRule {
+	events := make([]EventRule, 0, len(e.events))
+	for _, ev := range e.events {
+		events = append(events, ev)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events
+}
+
+// parseStay reads the check_in and check_out query parameters.
+func parseStay(r *http.Request) (time.Time, time.Time, bool) {
+	checkIn, err := time.Parse(time.DateOnly, r.URL.Query().Get("check_in"))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	checkOut, err := time.Parse(time.DateOnly, r.URL.Query().Get("check_out"))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return checkIn, checkOut, true
+}
+
+// getRentalPricingHandler summarises a stay's price with its nights, fees and
+// taxes itemised, and the total converted into each denomination listed in
+// ?denoms= when given.
+func (s *server) getRentalPricingHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.quoteStay(w, r)
+	if !ok {
+		return
+	}
+	denominated, ok := s.denominate(w, r, q.TotalCents, q.Currency)
+	if !ok {
+		return
+	}
+	resp := map[string]interface{}{
+		"property_id":           q.PropertyID,
+		"check_in":              q.CheckIn,
+		"check_out":             q.CheckOut,
+		"nights":                len(q.Nights),
+		"average_nightly_cents": q.SubtotalCents / int64(len(q.Nights)),
+		"nightly_rates":         q.Nights,
+		"subtotal_cents":        q.SubtotalCents,
+		"discounts":             q.Discounts,
+		"fees":                  q.Fees,
+		"taxes":                 q.Taxes,
+		"tax_cents":             q.TaxCents,
+		"total_cents":           q.TotalCents,
+		"currency":              q.Currency,
+	}
+	if denominated != nil {
+		resp["denominations"] = denominated
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// getNightlyBreakdownHandler returns every night's rate and the adjustments
+// behind it, with discounts, fees and tax, and the total in each
+// denomination listed in ?denoms= when given.
+func (s *server) getNightlyBreakdownHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.quoteStay(w, r)
+	if !ok {
+		return
+	}
+	denominated, ok := s.denominate(w, r, q.TotalCents, q.Currency)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, struct {
+		StayQuote
+		Denominations *Denominated `json:"denominations,omitempty"`
+	}{q, denominated})
+}
+
+// quoteStay prices the stay named by the request, for the guests and pets it
+// gives, writing an error response when it cannot.
+func (s *server) quoteStay(w http.ResponseWriter, r *http.Request) (StayQuote, bool) {
+	checkIn, checkOut, ok := parseStay(r)
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid_dates", "check_in and check_out must be formatted YYYY-MM-DD")
+		return StayQuote{}, false
+	}
+	party, err := parseParty(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_party", err.Error())
+		return StayQuote{}, false
+	}
+	q, err := s.engine.QuoteStay(chi.URLParam(r, "propertyId"), checkIn, checkOut, party)
+	if err != nil {
+		respondQuoteError(w, err)
+		return StayQuote{}, false
+	}
+	return q, true
+}
+
+func respondQuoteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+	case errors.Is(err, ErrInvalidStay):
+		respondError(w, http.StatusUnprocessableEntity, "invalid_stay", err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	}
+}
+
+func (s *server) putEventHandler(w http.ResponseWriter, r *http.Request) {
+	var ev EventRule
+	if err := httpkit.DecodeJSON(r, &ev); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	ev.ID = chi.URLParam(r, "eventId")
+	if err := ev.validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_event", err.Error())
+		return
+	}
+	s.engine.PutEvent(ev)
+	respondJSON(w, http.StatusOK, ev)
+}
+
+func (s *server) deleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.engine.DeleteEvent(chi.URLParam(r, "eventId")); err != nil {
+		respondError(w, http.StatusNotFound, "event_not_found", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+)
+
+func adjustmentKinds(n NightlyRate) []string {
+	var kinds []string
+	for _, a := range n.Adjustments {
+		kinds = append(kinds, a.Kind)
+	}
+	return kinds
+}
+
+func TestSurgeCapClipsStackedMultipliers(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	s.engine.SetProperty(Property{ID: "tunco-villa", Department: "La Libertad", Currency: "USD", BaseRateCents: 10000})
+	s.engine.PutSeasonalRule("tunco-villa", SeasonalRule{ID: "peak", Name: "Peak", Start: "2026-08-01", End: "2026-08-31", Multiplier: 1.8})
+	doJSON(t, h, http.MethodPut, "/api/pricing/events/surf-open", EventRule{
+		Name: "Surf City Open", Department: "La Libertad", Start: "2026-08-06", End: "2026-08-07", Multiplier: 1.7,
+	}, nil)
+
+	var q StayQuote
+	rec := doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/nightly?check_in=2026-08-05&check_out=2026-08-07", nil, &q)
+	if rec.Code != http.StatusOK || len(q.Nights) != 2 {
+		t.Fatalf("status %d quote %+v", rec.Code, q)
+	}
+
+	// 1.8 × 1.7 = 3.06x is clipped to the 2.5x cap.
+	capped := q.Nights[1]
+	if capped.RateCents != 25000 {
+		t.Errorf("event night rate = %d, want 25000", capped.RateCents)
+	}
+	kinds := adjustmentKinds(capped)
+	if len(kinds) != 3 || kinds[2] != AdjustSurgeCap {
+		t.Errorf("event night adjustments = %v, want seasonal, event, surge_cap", kinds)
+	}
+	if q.TotalCents != 18000+25000 {
+		t.Errorf("total = %d, want 43000", q.TotalCents)
+	}
+}
+
+func TestSurgeCapLeavesNormalPricingUntouched(t *testing.T) {
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "zonte-cabin", Currency: "USD", BaseRateCents: 9000})
+	s.engine.PutSeasonalRule("zonte-cabin", SeasonalRule{ID: "peak", Name: "Peak", Start: "2026-08-01", End: "2026-08-31", Multiplier: 1.5})
+
+	var q StayQuote
+	doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/zonte-cabin/nightly?check_in=2026-07-31&check_out=2026-08-02", nil, &q)
+	if len(q.Nights) != 2 {
+		t.Fatalf("quote %+v", q)
+	}
+	if q.Nights[0].RateCents != 9000 || len(q.Nights[0].Adjustments) != 0 {
+		t.Errorf("off-season night = %+v, want base rate", q.Nights[0])
+	}
+	if q.Nights[1].RateCents != 13500 {
+		t.Errorf("peak night = %d, want 13500", q.Nights[1].RateCents)
+	}
+	for _, k := range adjustmentKinds(q.Nights[1]) {
+		if k == AdjustSurgeCap {
+			t.Errorf("1.5x night should not be capped")
+		}
+	}
+}
+
+func TestSurgeCapIndependentOfCeiling(t *testing.T) {
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "suchitoto-loft", Currency: "USD", BaseRateCents: 10000, CeilingCents: 20000})
+	s.engine.PutSeasonalRule("suchitoto-loft", SeasonalRule{ID: "fiestas", Name: "Fiestas", Start: "2026-08-01", End: "2026-08-06", Multiplier: 3})
+
+	var q StayQuote
+	doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/suchitoto-loft/nightly?check_in=2026-08-01&check_out=2026-08-02", nil, &q)
+	n := q.Nights[0]
+	kinds := adjustmentKinds(n)
+	if n.RateCents != 20000 || len(kinds) != 3 || kinds[1] != AdjustSurgeCap || kinds[2] != AdjustCeiling {
+		t.Fatalf("night = %+v, want cap then ceiling applied", n)
+	}
+}
+
+func TestNightlyBreakdownAcrossWeekendAndSeason(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	doJSON(t, h, http.MethodPut, "/api/pricing/rental/tunco-villa/config", map[string]interface{}{
+		"base_rate_cents": 10000, "weekend_multiplier": 1.2, "cleaning_fee_cents": 5000, "tax_rate": "13%",
+	}, nil)
+	s.engine.PutSeasonalRule("tunco-villa", semanaSanta)
+
+	// Thursday to Tuesday: a weekday, Friday and Saturday, then two nights
+	// of Semana Santa.
+	var q StayQuote
+	rec := doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa/nightly?check_in=2026-03-26&check_out=2026-03-31", nil, &q)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	want := []struct {
+		date  string
+		rate  int64
+		kinds int
+	}{
+		{"2026-03-26", 10000, 0},
+		{"2026-03-27", 12000, 1},
+		{"2026-03-28", 12000, 1},
+		{"2026-03-29", 14000, 1},
+		{"2026-03-30", 14000, 1},
+	}
+	if len(q.Nights) != len(want) {
+		t.Fatalf("nights = %+v", q.Nights)
+	}
+	var sum int64
+	for i, w := range want {
+		n := q.Nights[i]
+		if n.Date != w.date || n.RateCents != w.rate || len(n.Adjustments) != w.kinds {
+			t.Errorf("night %d = %+v, want %s at %d with %d adjustments", i, n, w.date, w.rate, w.kinds)
+		}
+		sum += n.RateCents
+	}
+	if q.SubtotalCents != sum || sum != 62000 {
+		t.Errorf("subtotal = %d, sum of nights = %d, want 62000", q.SubtotalCents, sum)
+	}
+	if len(q.Fees) != 1 || q.Fees[0].AmountCents != 5000 || len(q.Discounts) != 0 {
+		t.Errorf("fees %+v discounts %+v", q.Fees, q.Discounts)
+	}
+	// 13% of (62000 + 5000).
+	if q.TaxCents != 8710 || q.TotalCents != 62000+5000+8710 {
+		t.Errorf("tax %d total %d, want 8710 and 75710", q.TaxCents, q.TotalCents)
+	}
+}
+
+func TestNightlyBreakdownWeeklyDiscount(t *testing.T) {
+	s := newTestServer()
+	s.engine.SetProperty(Property{ID: "zonte-cabin", Currency: "USD", BaseRateCents: 10000, WeeklyDiscount: 10 * apitypes.OnePercent})
+
+	var q StayQuote
+	doJSON(t, s.routes(), http.MethodGet, "/api/pricing/rental/zonte-cabin/nightly?check_in=2026-06-01&check_out=2026-06-08", nil, &q)
+	if len(q.Discounts) != 1 || q.Discounts[0].AmountCents != 7000 || q.TotalCents != 63000 {
+		t.Fatalf("discounts %+v total %d, want 7000 off a 70000 week", q.Discounts, q.TotalCents)
+	}
+}
+
+func TestStayQuoteItemisesTaxesAndReconciles(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	rec := doJSON(t, h, http.MethodPut, "/api/pricing/rental/tunco-villa/config", map[string]interface{}{
+		"base_rate_cents": 10000, "weekend_multiplier": 1.2, "cleaning_fee_cents": 5000, "tax_rate": "13%",
+		"taxes": []map[string]string{{"code": "tourism", "name": "Tourism levy", "rate": "5%"}},
+	}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("config: status %d: %s", rec.Code, rec.Body)
+	}
+	s.engine.PutSeasonalRule("tunco-villa", semanaSanta)
+
+	// Friday to Tuesday: two weekend nights, then two of Semana Santa.
+	var resp struct {
+		Nights        int           `json:"nights"`
+		NightlyRates  []NightlyRate `json:"nightly_rates"`
+		SubtotalCents int64         `json:"subtotal_cents"`
+		Fees          []LineItem    `json:"fees"`
+		Taxes         []LineItem    `json:"taxes"`
+		TaxCents      int64         `json:"tax_cents"`
+		TotalCents    int64         `json:"total_cents"`
+	}
+	rec = doJSON(t, h, http.MethodGet, "/api/pricing/rental/tunco-villa?check_in=2026-03-27&check_out=2026-03-31", nil, &resp)
+	if rec.Code != http.StatusOK || resp.Nights != 4 || len(resp.NightlyRates) != 4 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if resp.NightlyRates[1].RateCents == resp.NightlyRates[2].RateCents || resp.NightlyRates[2].Adjustments[0].Kind != AdjustSeasonal {
+		t.Fatalf("weekend and seasonal nights priced alike: %+v", resp.NightlyRates)
+	}
+
+	var nights, fees, taxes int64
+	for _, n := range resp.NightlyRates {
+		nights += n.RateCents
+	}
+	for _, f := range resp.Fees {
+		fees += f.AmountCents
+	}
+	for _, tax := range resp.Taxes {
+		taxes += tax.AmountCents
+	}
+	// 12000 + 12000 + 14000 + 14000, plus cleaning, taxed at 13% and 5%.
+	if nights != 52000 || resp.SubtotalCents != nights || fees != 5000 {
+		t.Fatalf("nights %d subtotal %d fees %d", nights, resp.SubtotalCents, fees)
+	}
+	if len(resp.Taxes) != 2 || resp.Taxes[0].AmountCents != 7410 || resp.Taxes[1].AmountCents != 2850 || resp.TaxCents != taxes {
+		t.Fatalf("taxes %+v tax_cents %d", resp.Taxes, resp.TaxCents)
+	}
+	if resp.TotalCents != nights+fees+taxes {
+		t.Fatalf("total %d does not reconcile with %d + %d + %d", resp.TotalCents, nights, fees, taxes)
+	}
+}
+
+func TestStayQuoteSerializesDatesAsDateOnly(t *testing.T) {
+	q := StayQuote{
+		CheckIn:  apitypes.JSONDate{Time: time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)},
+		CheckOut: apitypes.JSONDate{Time: time.Date(2026, 3, 17, 0, 0, 0, 0, time.UTC)},
+	}
+	b, err := json.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["check_in"] != "2026-03-14" || raw["check_out"] != "2026-03-17" {
+		t.Fatalf("check_in %v check_out %v, want date-only strings", raw["check_in"], raw["check_out"])
+	}
+}
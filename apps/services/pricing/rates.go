@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/outbound"
+)
+
+// RateSource is an upstream provider of the BTC/USD spot price.
+type RateSource interface {
+	Name() string
+	FetchBTCUSD(ctx context.Context) (float64, error)
+}
+
+// coinGeckoSource reads the BTC/USD spot price from CoinGecko's simple price API.
+type coinGeckoSource struct {
+	baseURL string
+	client  *outbound.Client
+}
+
+func newCoinGeckoSource(baseURL string) *coinGeckoSource {
+	return &coinGeckoSource{baseURL: baseURL, client: outbound.NewClient("coingecko", 5*time.Second)}
+}
+
+func (c *coinGeckoSource) Name() string { return "coingecko" }
+
+func (c *coinGeckoSource) FetchBTCUSD(ctx context.Context) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v3/simple/price?ids=bitcoin&vs_currencies=usd", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("coingecko: unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Bitcoin struct {
+			USD float64 `json:"usd"`
+		} `json:"bitcoin"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("coingecko: %w", err)
+	}
+	if body.Bitcoin.USD <= 0 {
+		return 0, errors.New("coingecko: missing bitcoin price")
+	}
+	return body.Bitcoin.USD, nil
+}
+
+// BtcRate is a BTC/USD reading and the source that produced it.
+type BtcRate struct {
+	BtcUSD        float64           `json:"btc_usd"`
+	SatsPerDollar float64           `json:"sats_per_dollar"`
+	Source        string            `json:"source"`
+	FetchedAt     apitypes.JSONTime `json:"fetched_at"`
+	Cached        bool              `json:"cached"`
+	// Stale marks a cached rate older than the ttl, served because every
+	// source was down.
+	Stale bool `json:"stale"`
+	// ManualFallback marks a rate that came from configuration rather than
+	// the market because every source was down.
+	ManualFallback bool `json:"manual_fallback"`
+}
+
+func newBtcRate(btcUSD float64, source string, at time.Time) BtcRate {
+	return BtcRate{
+		BtcUSD:        btcUSD,
+		SatsPerDollar: 1e8 / btcUSD,
+		Source:        source,
+		FetchedAt:     apitypes.JSONTime{Time: at},
+	}
+}
+
+// FallbackMode decides what happens when no source and no cached value can
+// produce a BTC/USD rate.
+type FallbackMode string
+
+const (
+	// FallbackRefuse refuses sats quotes outright.
+	FallbackRefuse FallbackMode = "refuse"
+	// FallbackManual quotes at an operator-configured rate, flagged as such.
+	FallbackManual FallbackMode = "manual"
+)
+
+// RateFallback is the per-deployment policy for a total rate outage.
+type RateFallback struct {
+	Mode       FallbackMode
+	ManualRate float64
+}
+
+func (f RateFallback) validate() error {
+	switch f.Mode {
+	case FallbackRefuse:
+		return nil
+	case FallbackManual:
+		if f.ManualRate <= 0 {
+			return errors.New("manual BTC rate fallback requires a positive BTC_MANUAL_FALLBACK_RATE")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown BTC rate fallback mode %q", f.Mode)
+	}
+}
+
+// RateCache shares BTC/USD readings between pricing replicas. Values
+// expire after the ttl they were set with.
+type RateCache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+const (
+	// rateCacheKey is where the latest reading is shared.
+	rateCacheKey = "btc_usd_rate"
+	// rateCacheRetention is how long a shared reading is kept. It outlives
+	// the freshness ttl so a replica that restarts during an outage can
+	// still serve the last good rate.
+	rateCacheRetention = 24 * time.Hour
+)
+
+// BtcRateProvider resolves the current BTC/USD rate from its sources in
+// priority order, remembering the last good reading for outages. With a
+// ttl, a reading younger than it is served without asking the sources.
+type BtcRateProvider struct {
+	sources  []RateSource
+	fallback RateFallback
+	now      func() time.Time
+
+	// cache, when set, shares readings with other replicas; lastGood still
+	// serves while it is unreachable.
+	cache RateCache
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	lastGood *BtcRate
+	// health is each source's track record, in the order of sources.
+	health []SourceHealth
+}
+
+func NewBtcRateProvider(fallback RateFallback, sources ...RateSource) *BtcRateProvider {
+	p := &BtcRateProvider{sources: sources, fallback: fallback, now: time.Now}
+	for i, src := range sources {
+		p.health = append(p.health, SourceHealth{Name: src.Name(), Priority: i + 1})
+	}
+	return p
+}
+
+// UseCache serves readings younger than ttl from memory and, when cache is
+// not nil, from cache. A zero ttl asks the sources every time.
+func (p *BtcRateProvider) UseCache(cache RateCache, ttl time.Duration) {
+	p.cache, p.ttl = cache, ttl
+}
+
+// SourceHealth is what a rate source has done lately. A source contributes
+// while the rate being served is its latest reading; sources behind it in
+// priority are only asked when it fails, so their readings can be old.
+type SourceHealth struct {
+	Name                string            `json:"name"`
+	Priority            int               `json:"priority"`
+	LastSuccessAt       apitypes.JSONTime `json:"last_success_at"`
+	LastValue           float64           `json:"last_value,omitempty"`
+	LastFailureAt       apitypes.JSONTime `json:"last_failure_at"`
+	LastError           string            `json:"last_error,omitempty"`
+	ConsecutiveFailures int               `json:"consecutive_failures"`
+	Contributing        bool              `json:"contributing"`
+}
+
+// record notes the outcome of asking source i for a rate.
+func (p *BtcRateProvider) record(i int, v float64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := &p.health[i]
+	if err != nil {
+		h.LastFailureAt, h.LastError = apitypes.JSONTime{Time: p.now()}, err.Error()
+		h.ConsecutiveFailures++
+		h.Contributing = false
+		return
+	}
+	h.LastSuccessAt, h.LastValue = apitypes.JSONTime{Time: p.now()}, v
+	h.ConsecutiveFailures = 0
+	for j := range p.health {
+		p.health[j].Contributing = j == i
+	}
+}
+
+// Sources reports the health of every configured source in priority
+// order.
+func (p *BtcRateProvider) Sources() []SourceHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]SourceHealth{}, p.health...)
+}
+
+// ErrRateUnavailable is returned when no source can produce a rate.
+var ErrRateUnavailable = errors.New("btc rate unavailable")
+
+// Rate returns a cached reading younger than the ttl, else asks the
+// sources in order. When they all fail the newest cached reading is
+// served however old, then the manual fallback if configured.
+func (p *BtcRateProvider) Rate(ctx context.Context) (BtcRate, error) {
+	cached := p.cached(ctx)
+	if cached != nil && p.ttl > 0 && p.now().Sub(cached.FetchedAt.Time) < p.ttl {
+		return *cached, nil
+	}
+
+	for i, src := range p.sources {
+		v, err := src.FetchBTCUSD(ctx)
+		p.record(i, v, err)
+		if err != nil {
+			continue
+		}
+		rate := newBtcRate(v, src.Name(), p.now())
+		p.remember(ctx, rate)
+		return rate, nil
+	}
+
+	if cached != nil {
+		cached.Stale = p.now().Sub(cached.FetchedAt.Time) >= p.ttl
+		return *cached, nil
+	}
+
+	if p.fallback.Mode == FallbackManual {
+		rate := newBtcRate(p.fallback.ManualRate, "manual_fallback", p.now())
+		rate.ManualFallback = true
+		return rate, nil
+	}
+	return BtcRate{}, ErrRateUnavailable
+}
+
+// cached returns the newest reading in the shared cache or memory, marked
+// as cached, or nil if there is none. An unreachable cache is logged and
+// memory used alone.
+func (p *BtcRateProvider) cached(ctx context.Context) *BtcRate {
+	p.mu.Lock()
+	var newest *BtcRate
+	if p.lastGood != nil {
+		rate := *p.lastGood
+		newest = &rate
+	}
+	p.mu.Unlock()
+
+	if p.cache != nil {
+		var shared BtcRate
+		raw, ok, err := p.cache.Get(ctx, rateCacheKey)
+		if err == nil && ok {
+			err = json.Unmarshal(raw, &shared)
+		}
+		switch {
+		case err != nil:
+			log.Printf("reading cached BTC rate: %v", err)
+		case ok && (newest == nil || shared.FetchedAt.After(newest.FetchedAt.Time)):
+			// Another replica's reading is kept in case the cache goes down.
+			p.mu.Lock()
+			p.lastGood = &shared
+			p.mu.Unlock()
+			rate := shared
+			newest = &rate
+		}
+	}
+	if newest != nil {
+		newest.Cached = true
+	}
+	return newest
+}
+
+// remember keeps a fresh reading in memory and shares it.
+func (p *BtcRateProvider) remember(ctx context.Context, rate BtcRate) {
+	p.mu.Lock()
+	p.lastGood = &rate
+	p.mu.Unlock()
+	if p.cache == nil {
+		return
+	}
+	raw, err := json.Marshal(rate)
+	if err == nil {
+		err = p.cache.Set(ctx, rateCacheKey, raw, rateCacheRetention)
+	}
+	if err != nil {
+		log.Printf("caching BTC rate: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubSource is a RateSource returning a fixed value or error.
+type stubSource struct {
+	name string
+	rate float64
+	err  error
+}
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) FetchBTCUSD(context.Context) (float64, error) {
+	return s.rate, s.err
+}
+
+func getBtcRate(t *testing.T, s *server) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pricing/btc/rate", nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return rec, body
+}
+
+func TestRateFallbackRefuse(t *testing.T) {
+	down := &stubSource{name: "coingecko", err: errors.New("connection refused")}
+	s := &server{cfg: config{Tenants: testTenants}, rates: NewBtcRateProvider(RateFallback{Mode: FallbackRefuse}, down)}
+
+	rec, body := getBtcRate(t, s)
+	if rec.Code != http.StatusServiceUnavailable || body["error"] != "rate_unavailable" {
+		t.Fatalf("got %d %v, want 503 rate_unavailable", rec.Code, body)
+	}
+}
+
+func TestRateFallbackManual(t *testing.T) {
+	down := &stubSource{name: "coingecko", err: errors.New("connection refused")}
+	s := &server{cfg: config{Tenants: testTenants}, rates: NewBtcRateProvider(RateFallback{Mode: FallbackManual, ManualRate: 50000}, down)}
+
+	rec, body := getBtcRate(t, s)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if body["manual_fallback"] != true || body["btc_usd"] != 50000.0 || body["sats_per_dollar"] != 2000.0 {
+		t.Fatalf("body = %v, want flagged manual rate of 50000", body)
+	}
+}
+
+func TestRateServesLastGoodBeforeFallback(t *testing.T) {
+	src := &stubSource{name: "coingecko", rate: 64000}
+	p := NewBtcRateProvider(RateFallback{Mode: FallbackManual, ManualRate: 50000}, src)
+	if _, err := p.Rate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	src.err = errors.New("timeout")
+	rate, err := p.Rate(context.Background())
+	if err != nil || rate.BtcUSD != 64000 || !rate.Cached || rate.ManualFallback {
+		t.Fatalf("Rate() = %+v, %v; want cached 64000", rate, err)
+	}
+}
+
+func TestRateFallbackValidation(t *testing.T) {
+	if err := (RateFallback{Mode: FallbackManual}).validate(); err == nil {
+		t.Error("manual mode without a rate should be rejected")
+	}
+	if err := (RateFallback{Mode: "guess"}).validate(); err == nil {
+		t.Error("unknown mode should be rejected")
+	}
+}
+
+func TestBtcSourcesReportHealth(t *testing.T) {
+	down := &stubSource{name: "coingecko", err: errors.New("connection refused")}
+	up := &stubSource{name: "kraken", rate: 64000}
+	s := &server{cfg: config{Tenants: testTenants}, rates: NewBtcRateProvider(RateFallback{Mode: FallbackRefuse}, down, up)}
+	for i := 0; i < 3; i++ {
+		if _, err := s.rates.Rate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pricing/btc/sources", nil))
+	var body struct {
+		Sources []SourceHealth `json:"sources"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(body.Sources) != 2 {
+		t.Fatalf("sources = %+v, want 2", body.Sources)
+	}
+	failing, healthy := body.Sources[0], body.Sources[1]
+	if failing.Name != "coingecko" || failing.ConsecutiveFailures != 3 || failing.Contributing || failing.LastError == "" || !failing.LastSuccessAt.IsZero() {
+		t.Errorf("failing source = %+v, want 3 failures and not contributing", failing)
+	}
+	if healthy.Name != "kraken" || healthy.LastValue != 64000 || !healthy.Contributing || healthy.ConsecutiveFailures != 0 || healthy.LastSuccessAt.IsZero() {
+		t.Errorf("healthy source = %+v, want contributing at 64000", healthy)
+	}
+
+	// Once the primary recovers it takes over and its failures reset.
+	down.err, down.rate = nil, 65000
+	s.rates.Rate(context.Background())
+	got := s.rates.Sources()
+	if !got[0].Contributing || got[0].ConsecutiveFailures != 0 || got[1].Contributing {
+		t.Errorf("after recovery = %+v", got)
+	}
+}
+
+// fakeRateCache is an in-memory RateCache that can be taken down.
+type fakeRateCache struct {
+	values map[string][]byte
+	down   bool
+}
+
+func (c *fakeRateCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	if c.down {
+		return nil, false, errors.New("connection refused")
+	}
+	v, ok := c.values[key]
+	return v, ok, nil
+}
+
+func (c *fakeRateCache) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	if c.down {
+		return errors.New("connection refused")
+	}
+	c.values[key] = value
+	return nil
+}
+
+// fakeCoinGecko serves CoinGecko's simple price API at price, counting
+// requests, or fails while price is zero.
+type fakeCoinGecko struct {
+	price float64
+	calls int
+}
+
+func (f *fakeCoinGecko) source(t *testing.T) *coinGeckoSource {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.calls++
+		if f.price == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"bitcoin":{"usd":%g}}`, f.price)
+	}))
+	t.Cleanup(srv.Close)
+	src := newCoinGeckoSource(srv.URL)
+	src.client.MaxRetries = 0
+	return src
+}
+
+func newCachedProvider(t *testing.T, upstream *fakeCoinGecko, cache RateCache, now *time.Time) *BtcRateProvider {
+	t.Helper()
+	p := NewBtcRateProvider(RateFallback{Mode: FallbackRefuse}, upstream.source(t))
+	p.now = func() time.Time { return *now }
+	p.UseCache(cache, time.Minute)
+	return p
+}
+
+func TestRateIsCachedForTTL(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	upstream := &fakeCoinGecko{price: 64000}
+	s := &server{cfg: config{Tenants: testTenants}, rates: newCachedProvider(t, upstream, &fakeRateCache{values: map[string][]byte{}}, &now)}
+
+	if _, body := getBtcRate(t, s); body["cached"] != false || body["btc_usd"] != 64000.0 {
+		t.Fatalf("first read = %v, want fresh 64000", body)
+	}
+	upstream.price = 65000
+	now = now.Add(59 * time.Second)
+	if _, body := getBtcRate(t, s); body["cached"] != true || body["stale"] != false || body["btc_usd"] != 64000.0 || upstream.calls != 1 {
+		t.Fatalf("read within ttl = %v after %d upstream calls, want cached 64000 after 1", body, upstream.calls)
+	}
+	now = now.Add(time.Second)
+	if _, body := getBtcRate(t, s); body["cached"] != false || body["btc_usd"] != 65000.0 || upstream.calls != 2 {
+		t.Fatalf("read after ttl = %v after %d upstream calls, want fresh 65000 after 2", body, upstream.calls)
+	}
+	upstream.price = 0
+	now = now.Add(time.Hour)
+	if _, body := getBtcRate(t, s); body["stale"] != true || body["btc_usd"] != 65000.0 || body["warning"] == nil {
+		t.Fatalf("read during outage = %v, want stale 65000 with a warning", body)
+	}
+}
+
+func TestRateSharedBetweenReplicas(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := &fakeRateCache{values: map[string][]byte{}}
+	first, second := &fakeCoinGecko{price: 64000}, &fakeCoinGecko{price: 65000}
+	if _, err := newCachedProvider(t, first, cache, &now).Rate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rate, err := newCachedProvider(t, second, cache, &now).Rate(context.Background())
+	if err != nil || rate.BtcUSD != 64000 || !rate.Cached || second.calls != 0 {
+		t.Fatalf("second replica got %+v, %v after %d upstream calls; want the first's cached reading", rate, err, second.calls)
+	}
+}
+
+func TestRateServesCacheWhenUpstreamFails(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := &fakeRateCache{values: map[string][]byte{}}
+	if _, err := newCachedProvider(t, &fakeCoinGecko{price: 64000}, cache, &now).Rate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A replica starting during the outage has only the shared reading.
+	now = now.Add(time.Hour)
+	down := &fakeCoinGecko{}
+	rate, err := newCachedProvider(t, down, cache, &now).Rate(context.Background())
+	if err != nil || rate.BtcUSD != 64000 || !rate.Cached || !rate.Stale || down.calls != 1 {
+		t.Fatalf("Rate() = %+v, %v after %d upstream calls; want stale cached 64000 after trying upstream", rate, err, down.calls)
+	}
+}
+
+func TestRateServesMemoryWhenCacheDown(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cache := &fakeRateCache{values: map[string][]byte{}}
+	upstream := &fakeCoinGecko{price: 64000}
+	p := newCachedProvider(t, upstream, cache, &now)
+	if _, err := p.Rate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.down = true
+	rate, err := p.Rate(context.Background())
+	if err != nil || rate.BtcUSD != 64000 || !rate.Cached || rate.Stale || upstream.calls != 1 {
+		t.Fatalf("within ttl: Rate() = %+v, %v after %d upstream calls; want cached 64000 from memory", rate, err, upstream.calls)
+	}
+	now = now.Add(time.Hour)
+	upstream.price = 0
+	rate, err = p.Rate(context.Background())
+	if err != nil || rate.BtcUSD != 64000 || !rate.Cached || !rate.Stale {
+		t.Fatalf("upstream and cache down: Rate() = %+v, %v; want stale 64000 from memory", rate, err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds connecting to Redis and each command, so a slow
+// cache never holds up a quote for long.
+const redisTimeout = 2 * time.Second
+
+// redisCache shares values between replicas through Redis. The go-redis
+// client pools its connections, redials dropped ones, and authenticates
+// and selects the database on each.
+type redisCache struct {
+	client *redis.Client
+}
+
+// parseRedisURL reads a redis://[user:password@]host:port[/db] URL, or
+// rediss:// for TLS.
+func parseRedisURL(rawURL string) (*redis.Options, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL must look like redis://[user:password@]host:port[/db]: %w", err)
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+	return opts, nil
+}
+
+// newRedisCache parses rawURL with parseRedisURL. It does not connect; the
+// first command does.
+func newRedisCache(rawURL string) (*redisCache, error) {
+	opts, err := parseRedisURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisCache{client: redis.NewClient(opts)}, nil
+}
+
+// Get returns key's value, or false when it is not set.
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("redis GET: %w", err)
+	}
+	return v, true, nil
+}
+
+// Set stores value under key for ttl.
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := c.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("redis SET: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(h http.Handler, method, path string) (*httptest.ResponseRecorder, map[string]string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec, body
+}
+
+func TestUnknownPathsGetJSONNotFound(t *testing.T) {
+	h := newTestServer().routes()
+	for _, path := range []string{"/nope", "/api/pricing/nope", "/api/pricing/rental/casa-1/nope"} {
+		rec, body := serve(h, http.MethodGet, path)
+		if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("%s: status %d, content type %q", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if body["error"] != "not_found" || body["message"] == "" {
+			t.Fatalf("%s: body = %v", path, body)
+		}
+	}
+}
+
+func TestDisallowedMethodGetsJSON405WithAllow(t *testing.T) {
+	h := newTestServer().routes()
+
+	rec, body := serve(h, http.MethodPost, "/api/pricing/events/fiestas")
+	if rec.Code != http.StatusMethodNotAllowed || body["error"] != "method_not_allowed" {
+		t.Fatalf("status %d, body %v", rec.Code, body)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "PUT, DELETE" {
+		t.Fatalf("Allow = %q, want PUT, DELETE", allow)
+	}
+
+	rec, _ = serve(h, http.MethodDelete, "/health")
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Fatalf("/health: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SatsRoundingMode decides which way a sats price moves to reach its
+// increment.
+type SatsRoundingMode string
+
+const (
+	SatsRoundNearest SatsRoundingMode = "nearest"
+	SatsRoundUp      SatsRoundingMode = "up"
+	SatsRoundDown    SatsRoundingMode = "down"
+)
+
+// SatsRounding keeps prices of offerings denominated in sats to clean round
+// numbers: a multiple of Increment, and never below MinimumSats. An
+// Increment of 0 or 1 leaves prices unrounded; a MinimumSats of 0 sets no
+// minimum.
+type SatsRounding struct {
+	Increment   int64
+	Mode        SatsRoundingMode
+	MinimumSats int64
+}
+
+func (r SatsRounding) validate() error {
+	switch r.Mode {
+	case SatsRoundNearest, SatsRoundUp, SatsRoundDown:
+	default:
+		return fmt.Errorf("unknown sats rounding mode %q", r.Mode)
+	}
+	if r.Increment < 0 || r.MinimumSats < 0 {
+		return errors.New("SATS_ROUNDING_INCREMENT and SATS_MINIMUM must not be negative")
+	}
+	if r.Increment > 1 && r.MinimumSats%r.Increment != 0 {
+		return fmt.Errorf("SATS_MINIMUM %d must be a multiple of SATS_ROUNDING_INCREMENT %d", r.MinimumSats, r.Increment)
+	}
+	return nil
+}
+
+// Round moves sats to a multiple of the increment in the configured
+// direction. Halfway prices round up.
+func (r SatsRounding) Round(sats int64) int64 {
+	if r.Increment <= 1 {
+		return sats
+	}
+	down := sats - sats%r.Increment
+	if down == sats {
+		return sats
+	}
+	switch r.Mode {
+	case SatsRoundUp:
+		return down + r.Increment
+	case SatsRoundDown:
+		return down
+	default:
+		if sats-down >= r.Increment-(sats-down) {
+			return down + r.Increment
+		}
+		return down
+	}
+}
+
+// satsDenominated reports whether the property's rates are set in sats
+// rather than fiat.
+func (p *Property) satsDenominated() bool {
+	return strings.EqualFold(p.Currency, DenomSats)
+}
+
+// bound clamps cents to floor and ceiling, where zero means no bound. A price
+// in sats is then rounded to the sats increment and raised to the sats
+// minimum, so even a clamped price lands on a round number; a floor or
+// ceiling off the increment may be crossed by less than one increment. Each
+// change is appended to adj.
+func (e *Engine) bound(cents, floor, ceiling int64, sats bool, adj []Adjustment) (int64, []Adjustment) {
+	if floor > 0 && cents < floor {
+		cents = floor
+		adj = append(adj, Adjustment{Kind: AdjustFloor})
+	}
+	if ceiling > 0 && cents > ceiling {
+		cents = ceiling
+		adj = append(adj, Adjustment{Kind: AdjustCeiling})
+	}
+	if !sats {
+		return cents, adj
+	}
+	if rounded := e.opts.SatsRounding.Round(cents); rounded != cents {
+		cents = rounded
+		adj = append(adj, Adjustment{Kind: AdjustSatsRounding})
+	}
+	if minimum := e.opts.SatsRounding.MinimumSats; cents < minimum {
+		cents = minimum
+		adj = append(adj, Adjustment{Kind: AdjustSatsMinimum})
+	}
+	return cents, adj
+}
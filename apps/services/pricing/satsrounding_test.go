@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSatsRoundingToIncrement(t *testing.T) {
+	cases := []struct {
+		mode SatsRoundingMode
+		in   int64
+		want int64
+	}{
+		{SatsRoundNearest, 21337, 21000},
+		{SatsRoundNearest, 21500, 22000},
+		{SatsRoundNearest, 21000, 21000},
+		{SatsRoundUp, 21001, 22000},
+		{SatsRoundDown, 21999, 21000},
+	}
+	for _, c := range cases {
+		if got := (SatsRounding{Increment: 1000, Mode: c.mode}).Round(c.in); got != c.want {
+			t.Errorf("%s rounding of %d = %d, want %d", c.mode, c.in, got, c.want)
+		}
+	}
+	if got := (SatsRounding{Mode: SatsRoundNearest}).Round(21337); got != 21337 {
+		t.Errorf("no increment rounded 21337 to %d", got)
+	}
+	if err := (SatsRounding{Increment: 1000, Mode: SatsRoundNearest, MinimumSats: 1500}).validate(); err == nil {
+		t.Error("minimum off the increment accepted")
+	}
+}
+
+func TestSatsPricedNightsAreRoundedAndHeldToMinimum(t *testing.T) {
+	e := NewEngine(EngineOptions{SatsRounding: SatsRounding{Increment: 1000, Mode: SatsRoundNearest, MinimumSats: 10000}})
+	e.SetProperty(Property{ID: "zonte-cabin", Currency: "sats", BaseRateCents: 21337})
+	e.SetProperty(Property{ID: "suchitoto-loft", Currency: "sats", BaseRateCents: 4200})
+	e.SetProperty(Property{ID: "tunco-villa", Currency: "USD", BaseRateCents: 4200})
+	checkIn := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	night := func(id string) NightlyRate {
+		t.Helper()
+		q, err := e.QuoteStay(id, checkIn, checkIn.AddDate(0, 0, 1), Party{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q.Nights[0]
+	}
+	if n := night("zonte-cabin"); n.RateCents != 21000 || len(n.Adjustments) != 1 || n.Adjustments[0].Kind != AdjustSatsRounding {
+		t.Errorf("rounded night = %+v, want 21000 sats", n)
+	}
+	if n := night("suchitoto-loft"); n.RateCents != 10000 || len(n.Adjustments) != 2 || n.Adjustments[1].Kind != AdjustSatsMinimum {
+		t.Errorf("cheap night = %+v, want the 10000 sats minimum", n)
+	}
+	if n := night("tunco-villa"); n.RateCents != 4200 || len(n.Adjustments) != 0 {
+		t.Errorf("USD night = %+v, want it untouched", n)
+	}
+}
+
+func TestSatsPricedNightsAreRoundedAfterClamping(t *testing.T) {
+	e := NewEngine(EngineOptions{SatsRounding: SatsRounding{Increment: 1000, Mode: SatsRoundNearest}})
+	e.SetProperty(Property{ID: "zonte-cabin", Currency: "sats", BaseRateCents: 5000, FloorCents: 21600})
+	checkIn := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	q, err := e.QuoteStay("zonte-cabin", checkIn, checkIn.AddDate(0, 0, 1), Party{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := q.Nights[0]
+	if n.RateCents != 22000 || len(n.Adjustments) != 2 || n.Adjustments[0].Kind != AdjustFloor || n.Adjustments[1].Kind != AdjustSatsRounding {
+		t.Errorf("floored night = %+v, want the 21600 floor rounded to 22000", n)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrScheduledRateNotFound = errors.New("scheduled rate not found")
+	ErrScheduledRateConflict = errors.New("another scheduled rate takes effect on that date")
+)
+
+// ScheduledRate replaces a property's base rate from EffectiveFrom onwards,
+// until a later scheduled rate takes over. Seasonal, weekend and event
+// multipliers still apply on top of it.
+type ScheduledRate struct {
+	ID            string `json:"id"`
+	EffectiveFrom string `json:"effective_from"`
+	BaseRateCents int64  `json:"base_rate_cents"`
+}
+
+func (sr ScheduledRate) validate() error {
+	if _, err := time.Parse(time.DateOnly, sr.EffectiveFrom); err != nil {
+		return fmt.Errorf("effective_from must be formatted YYYY-MM-DD")
+	}
+	if sr.BaseRateCents <= 0 {
+		return fmt.Errorf("base_rate_cents must be positive")
+	}
+	return nil
+}
+
+// baseRateOn returns the base rate in force on date: the latest scheduled
+// rate effective by then, or BaseRateCents before the first one.
+func (p *Property) baseRateOn(date string) int64 {
+	rate := p.BaseRateCents
+	for _, sr := range p.ScheduledRates {
+		if sr.EffectiveFrom > date {
+			break
+		}
+		rate = sr.BaseRateCents
+	}
+	return rate
+}
+
+// PutScheduledRate schedules a base rate change for a property, replacing a
+// scheduled rate with the same id. It reports whether one was replaced.
+func (e *Engine) PutScheduledRate(propertyID string, sr ScheduledRate) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return false, ErrPropertyNotFound
+	}
+	replaced := -1
+	for i, existing := range p.ScheduledRates {
+		if existing.ID == sr.ID {
+			replaced = i
+			continue
+		}
+		if existing.EffectiveFrom == sr.EffectiveFrom {
+			return false, ErrScheduledRateConflict
+		}
+	}
+	defer e.changedLocked(propertyID)
+	if replaced >= 0 {
+		p.ScheduledRates[replaced] = sr
+	} else {
+		p.ScheduledRates = append(p.ScheduledRates, sr)
+	}
+	sort.Slice(p.ScheduledRates, func(i, j int) bool { return p.ScheduledRates[i].EffectiveFrom < p.ScheduledRates[j].EffectiveFrom })
+	return replaced >= 0, nil
+}
+
+// DeleteScheduledRate cancels a scheduled base rate change.
+func (e *Engine) DeleteScheduledRate(propertyID, id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.properties[propertyID]
+	if !ok {
+		return ErrPropertyNotFound
+	}
+	for i, existing := range p.ScheduledRates {
+		if existing.ID == id {
+			p.ScheduledRates = append(p.ScheduledRates[:i], p.ScheduledRates[i+1:]...)
+			e.changedLocked(propertyID)
+			return nil
+		}
+	}
+	return ErrScheduledRateNotFound
+}
+
+// putScheduledRateHandler schedules a base rate change. Body:
+// {"effective_from": "2026-07-01", "base_rate_cents": 14000}.
+func (s *server) putScheduledRateHandler(w http.ResponseWriter, r *http.Request) {
+	var sr ScheduledRate
+	if err := httpkit.DecodeJSON(r, &sr); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	sr.ID = chi.URLParam(r, "rateId")
+	if err := sr.validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", err.Error())
+		return
+	}
+	replaced, err := s.engine.PutScheduledRate(chi.URLParam(r, "propertyId"), sr)
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+	case errors.Is(err, ErrScheduledRateConflict):
+		respondError(w, http.StatusConflict, "scheduled_rate_conflict", err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	case replaced:
+		respondJSON(w, http.StatusOK, sr)
+	default:
+		respondJSON(w, http.StatusCreated, sr)
+	}
+}
+
+func (s *server) deleteScheduledRateHandler(w http.ResponseWriter, r *http.Request) {
+	err := s.engine.DeleteScheduledRate(chi.URLParam(r, "propertyId"), chi.URLParam(r, "rateId"))
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		respondError(w, http.StatusNotFound, "property_not_found", err.Error())
+	case errors.Is(err, ErrScheduledRateNotFound):
+		respondError(w, http.StatusNotFound, "scheduled_rate_not_found", err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
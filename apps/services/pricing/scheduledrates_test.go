@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestScheduledRateAppliesFromEffectiveDate(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	s.engine.SetProperty(Property{ID: "zonte-cabin", Currency: "USD", BaseRateCents: 9000})
+	s.engine.PutSeasonalRule("zonte-cabin", SeasonalRule{ID: "peak", Name: "Peak", Start: "2026-07-02", End: "2026-07-31", Multiplier: 1.5})
+
+	rec := doJSON(t, h, http.MethodPut, "/api/pricing/rental/zonte-cabin/scheduled-rates/summer-2026", ScheduledRate{EffectiveFrom: "2026-07-01", BaseRateCents: 12000}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("schedule: status %d: %s", rec.Code, rec.Body)
+	}
+	doJSON(t, h, http.MethodPut, "/api/pricing/rental/zonte-cabin/scheduled-rates/autumn-2026", ScheduledRate{EffectiveFrom: "2026-09-01", BaseRateCents: 10000}, nil)
+
+	var q StayQuote
+	doJSON(t, h, http.MethodGet, "/api/pricing/rental/zonte-cabin/nightly?check_in=2026-06-30&check_out=2026-07-03", nil, &q)
+	if len(q.Nights) != 3 {
+		t.Fatalf("quote %+v", q)
+	}
+	if n := q.Nights[0]; n.BaseCents != 9000 || n.RateCents != 9000 {
+		t.Errorf("night before the change = %+v, want the original 9000", n)
+	}
+	if n := q.Nights[1]; n.BaseCents != 12000 || n.RateCents != 12000 {
+		t.Errorf("effective night = %+v, want 12000", n)
+	}
+	// Seasonal multipliers scale the scheduled rate.
+	if n := q.Nights[2]; n.BaseCents != 12000 || n.RateCents != 18000 {
+		t.Errorf("peak night = %+v, want 12000 × 1.5", n)
+	}
+
+	doJSON(t, h, http.MethodGet, "/api/pricing/rental/zonte-cabin/nightly?check_in=2026-08-31&check_out=2026-09-02", nil, &q)
+	if q.Nights[0].BaseCents != 12000 || q.Nights[1].BaseCents != 10000 {
+		t.Errorf("nights around the second change = %+v", q.Nights)
+	}
+
+	// Cancelling the summer change leaves the original rate in force.
+	if rec := doJSON(t, h, http.MethodDelete, "/api/pricing/rental/zonte-cabin/scheduled-rates/summer-2026", nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+	doJSON(t, h, http.MethodGet, "/api/pricing/rental/zonte-cabin/nightly?check_in=2026-07-01&check_out=2026-07-02", nil, &q)
+	if q.Nights[0].BaseCents != 9000 {
+		t.Errorf("after cancelling, base = %d, want 9000", q.Nights[0].BaseCents)
+	}
+}
+
+func TestScheduledRateValidation(t *testing.T) {
+	s := newTestServer()
+	h := s.routes()
+	s.engine.SetProperty(Property{ID: "zonte-cabin", Currency: "USD", BaseRateCents: 9000})
+
+	if rec := doJSON(t, h, http.MethodPut, "/api/pricing/rental/zonte-cabin/scheduled-rates/bad", ScheduledRate{EffectiveFrom: "July", BaseRateCents: 12000}, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("bad date: status %d, want 422", rec.Code)
+	}
+	if rec := doJSON(t, h, http.MethodPut, "/api/pricing/rental/missing/scheduled-rates/a", ScheduledRate{EffectiveFrom: "2026-07-01", BaseRateCents: 12000}, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown property: status %d, want 404", rec.Code)
+	}
+	doJSON(t, h, http.MethodPut, "/api/pricing/rental/zonte-cabin/scheduled-rates/a", ScheduledRate{EffectiveFrom: "2026-07-01", BaseRateCents: 12000}, nil)
+	if rec := doJSON(t, h, http.MethodPut, "/api/pricing/rental/zonte-cabin/scheduled-rates/b", ScheduledRate{EffectiveFrom: "2026-07-01", BaseRateCents: 13000}, nil); rec.Code != http.StatusConflict {
+		t.Errorf("same effective date: status %d, want 409", rec.Code)
+	}
+
+	// Replacing the rate card keeps the schedule.
+	s.engine.SetProperty(Property{ID: "zonte-cabin", Currency: "USD", BaseRateCents: 9500})
+	if p, _ := s.engine.Property("zonte-cabin"); len(p.ScheduledRates) != 1 {
+		t.Errorf("scheduled rates after SetProperty = %+v", p.ScheduledRates)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/apitypes"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+func (s *server) putPropertyHandler(w http.ResponseWriter, r *http.Request) {
+	var p Property
+	if err := httpkit.DecodeJSON(r, &p); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	p.ID = chi.URLParam(r, "propertyId")
+	if p.Currency == "" {
+		p.Currency = "USD"
+	}
+	if p.BaseRateCents <= 0 {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "base_rate_cents must be positive")
+		return
+	}
+	if p.CeilingCents > 0 && p.CeilingCents < p.FloorCents {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "ceiling_cents must not be below floor_cents")
+		return
+	}
+	if p.WeekendMultiplier < 0 || p.WeekendMultiplier > 5 {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "weekend_multiplier must be between 0 and 5")
+		return
+	}
+	if p.WeeklyDiscount < 0 || p.WeeklyDiscount > apitypes.HundredPercent || p.TaxRate < 0 || p.TaxRate > apitypes.HundredPercent {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "weekly_discount and tax_rate must be between 0% and 100%")
+		return
+	}
+	for _, tax := range p.Taxes {
+		if tax.Code == "" || tax.Rate <= 0 || tax.Rate > apitypes.HundredPercent {
+			respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "each tax needs a code and a rate between 0% and 100%")
+			return
+		}
+	}
+	if p.CleaningFeeCents < 0 {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "cleaning_fee_cents must not be negative")
+		return
+	}
+	if p.FeeSchedule != nil {
+		if err := p.FeeSchedule.validate(); err != nil {
+			respondError(w, http.StatusUnprocessableEntity, "invalid_fee_schedule", err.Error())
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, s.engine.SetProperty(p))
+}
+
+// propertySelector picks the properties a bulk operation targets: an explicit
+// list, a filter, or both combined.
+type propertySelector struct {
+	PropertyIDs []string `json:"property_ids"`
+	Filter      struct {
+		Department string `json:"department"`
+	} `json:"filter"`
+}
+
+func (sel propertySelector) empty() bool {
+	return len(sel.PropertyIDs) == 0 && sel.Filter.Department == ""
+}
+
+func (sel propertySelector) resolve(e *Engine) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range sel.PropertyIDs {
+		add(id)
+	}
+	if sel.Filter.Department != "" {
+		for _, id := range e.PropertyIDs(sel.Filter.Department) {
+			add(id)
+		}
+	}
+	return ids
+}
+
+// bulkResult is the outcome of a bulk operation for one property.
+type bulkResult struct {
+	PropertyID string `json:"property_id"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+func respondBulk(w http.ResponseWriter, results []bulkResult) {
+	failed := 0
+	for _, res := range results {
+		if res.Status == "error" {
+			failed++
+		}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
+
+func bulkError(id string, err error) bulkResult {
+	code := "internal_error"
+	switch {
+	case errors.Is(err, ErrPropertyNotFound):
+		code = "property_not_found"
+	case errors.Is(err, ErrRuleOverlap):
+		code = "overlapping_rule"
+	case errors.Is(err, ErrRuleNotFound):
+		code = "rule_not_found"
+	}
+	return bulkResult{PropertyID: id, Status: "error", Error: code}
+}
+
+// bulkApplySeasonalHandler applies one seasonal rule to many properties.
+// Each property succeeds or fails independently.
+func (s *server) bulkApplySeasonalHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rule SeasonalRule `json:"rule"`
+		propertySelector
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if err := req.Rule.validate(); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rule", err.Error())
+		return
+	}
+	if req.empty() {
+		respondError(w, http.StatusUnprocessableEntity, "no_properties", "property_ids or filter is required")
+		return
+	}
+
+	var results []bulkResult
+	for _, id := range req.resolve(s.engine) {
+		replaced, err := s.engine.PutSeasonalRule(id, req.Rule)
+		switch {
+		case err != nil:
+			results = append(results, bulkError(id, err))
+		case replaced:
+			results = append(results, bulkResult{PropertyID: id, Status: "replaced"})
+		default:
+			results = append(results, bulkResult{PropertyID: id, Status: "applied"})
+		}
+	}
+	respondBulk(w, results)
+}
+
+// bulkDeleteSeasonalHandler removes a seasonal rule from many properties.
+func (s *server) bulkDeleteSeasonalHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RuleID string `json:"rule_id"`
+		propertySelector
+	}
+	if err := httpkit.DecodeJSON(r, &req); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	if req.RuleID == "" {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rule", "rule_id is required")
+		return
+	}
+	if req.empty() {
+		respondError(w, http.StatusUnprocessableEntity, "no_properties", "property_ids or filter is required")
+		return
+	}
+
+	var results []bulkResult
+	for _, id := range req.resolve(s.engine) {
+		if err := s.engine.DeleteSeasonalRule(id, req.RuleID); err != nil {
+			results = append(results, bulkError(id, err))
+			continue
+		}
+		results = append(results, bulkResult{PropertyID: id, Status: "deleted"})
+	}
+	respondBulk(w, results)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type bulkResponse struct {
+	Results   []bulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+func seedProperties(s *server) {
+	s.engine.SetProperty(Property{ID: "tunco-villa", Department: "La Libertad", BaseRateCents: 18000})
+	s.engine.SetProperty(Property{ID: "zonte-cabin", Department: "La Libertad", BaseRateCents: 9000})
+	s.engine.SetProperty(Property{ID: "suchitoto-loft", Department: "Cuscatlán", BaseRateCents: 7500})
+}
+
+var semanaSanta = SeasonalRule{ID: "semana-santa-2026", Name: "Semana Santa", Start: "2026-03-29", End: "2026-04-05", Multiplier: 1.4}
+
+func TestBulkApplySeasonalRule(t *testing.T) {
+	s := newTestServer()
+	seedProperties(s)
+	h := s.routes()
+
+	var resp bulkResponse
+	rec := doJSON(t, h, http.MethodPost, "/api/pricing/seasonal/bulk", map[string]interface{}{
+		"rule":         semanaSanta,
+		"property_ids": []string{"suchitoto-loft"},
+		"filter":       map[string]string{"department": "La Libertad"},
+	}, &resp)
+	if rec.Code != http.StatusOK || resp.Succeeded != 3 || resp.Failed != 0 {
+		t.Fatalf("status %d resp %+v, want 3 applied", rec.Code, resp)
+	}
+	for _, id := range []string{"tunco-villa", "zonte-cabin", "suchitoto-loft"} {
+		p, _ := s.engine.Property(id)
+		if len(p.SeasonalRules) != 1 || p.SeasonalRules[0].ID != semanaSanta.ID {
+			t.Errorf("%s rules = %+v", id, p.SeasonalRules)
+		}
+	}
+
+	// Re-applying the same rule id replaces rather than duplicates.
+	doJSON(t, h, http.MethodPost, "/api/pricing/seasonal/bulk", map[string]interface{}{
+		"rule": semanaSanta, "property_ids": []string{"tunco-villa"},
+	}, &resp)
+	if resp.Results[0].Status != "replaced" {
+		t.Fatalf("re-apply status %q, want replaced", resp.Results[0].Status)
+	}
+}
+
+func TestBulkApplyReportsPartialFailure(t *testing.T) {
+	s := newTestServer()
+	seedProperties(s)
+	h := s.routes()
+	s.engine.PutSeasonalRule("zonte-cabin", SeasonalRule{ID: "surf-open", Name: "Surf Open", Start: "2026-04-01", End: "2026-04-10", Multiplier: 1.2})
+
+	var resp bulkResponse
+	doJSON(t, h, http.MethodPost, "/api/pricing/seasonal/bulk", map[string]interface{}{
+		"rule":         semanaSanta,
+		"property_ids": []string{"tunco-villa", "zonte-cabin", "ghost-property"},
+	}, &resp)
+
+	want := map[string]string{"tunco-villa": "", "zonte-cabin": "overlapping_rule", "ghost-property": "property_not_found"}
+	if resp.Succeeded != 1 || resp.Failed != 2 {
+		t.Fatalf("resp %+v, want 1 succeeded 2 failed", resp)
+	}
+	for _, res := range resp.Results {
+		if res.Error != want[res.PropertyID] {
+			t.Errorf("%s error %q, want %q", res.PropertyID, res.Error, want[res.PropertyID])
+		}
+	}
+}
+
+func TestBulkApplyRejectsInvalidRule(t *testing.T) {
+	s := newTestServer()
+	seedProperties(s)
+	bad := semanaSanta
+	bad.End = "2026-03-01"
+	rec := doJSON(t, s.routes(), http.MethodPost, "/api/pricing/seasonal/bulk", map[string]interface{}{
+		"rule": bad, "property_ids": []string{"tunco-villa"},
+	}, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422", rec.Code)
+	}
+}
+
+func TestBulkDeleteSeasonalRule(t *testing.T) {
+	s := newTestServer()
+	seedProperties(s)
+	s.engine.PutSeasonalRule("tunco-villa", semanaSanta)
+
+	var resp bulkResponse
+	doJSON(t, s.routes(), http.MethodDelete, "/api/pricing/seasonal/bulk", map[string]interface{}{
+		"rule_id": semanaSanta.ID, "property_ids": []string{"tunco-villa", "zonte-cabin"},
+	}, &resp)
+	if resp.Succeeded != 1 || resp.Failed != 1 || resp.Results[1].Error != "rule_not_found" {
+		t.Fatalf("resp %+v", resp)
+	}
+	if p, _ := s.engine.Property("tunco-villa"); len(p.SeasonalRules) != 0 {
+		t.Fatalf("rule not deleted: %+v", p.SeasonalRules)
+	}
+}
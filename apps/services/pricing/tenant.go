@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+// Tenant is one brand the platform serves. Pricing reads only the web
+// origins its storefronts call the API from; the rest of the tenants file
+// is for the bookings and payments services.
+type Tenant struct {
+	ID          string   `json:"id"`
+	CORSOrigins []string `json:"cors_origins"`
+}
+
+func (t Tenant) TenantID() string         { return t.ID }
+func (t Tenant) AllowedOrigins() []string { return t.CORSOrigins }
+
+// Tenants are the brands served, by id.
+type Tenants = tenantkit.Tenants[Tenant]
+
+// builtinTenant is the single tenant served without a tenants file.
+var builtinTenant = Tenant{ID: tenantkit.DefaultID, CORSOrigins: tenantkit.LocalOrigins}
+
+// loadTenants reads the tenants from the JSON file at path, the same file
+// the bookings and payments services read. Without a file the built-in
+// PupuserIA tenant is served.
+func loadTenants(path, defaultID string) (Tenants, error) {
+	return tenantkit.Load(path, defaultID, builtinTenant, func(id string, t Tenant) (Tenant, error) {
+		t.ID = id
+		return t, nil
+	})
+}
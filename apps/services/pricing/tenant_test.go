@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/tenantkit"
+)
+
+func TestCORSAllowsOnlyTheTenantsOrigins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(`{
+		"pupuseria": {"name": "PupuserIA", "currency": "USD", "cors_origins": ["https://pupuseria.sv"]},
+		"volcanica": {"name": "Volcánica", "currency": "EUR", "cors_origins": ["https://volcanica.example"]}
+	}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := loadTenants(path, "pupuseria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer()
+	s.cfg.Tenants = tenants
+	h := s.routes()
+
+	for _, tc := range []struct{ tenant, origin, want string }{
+		{"volcanica", "https://volcanica.example", "https://volcanica.example"},
+		{"volcanica", "https://pupuseria.sv", ""},
+		{"", "https://pupuseria.sv", "https://pupuseria.sv"},
+		{"", "http://localhost:3000", ""},
+	} {
+		req := httptest.NewRequest(http.MethodOptions, "/api/pricing/rental/casa-1/config", nil)
+		if tc.tenant != "" {
+			req.Header.Set(tenantkit.Header, tc.tenant)
+		}
+		req.Header.Set("Origin", tc.origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tc.want {
+			t.Errorf("tenant %q preflight from %s allowed %q, want %q", tc.tenant, tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestLoadTenantsNeedsKnownDefault(t *testing.T) {
+	if _, err := loadTenants("", "volcanica"); err == nil {
+		t.Fatal("accepted a default tenant the built-in set lacks")
+	}
+	tenants, err := loadTenants("", tenantkit.DefaultID)
+	if err != nil || !tenants.AllowOrigin(httptest.NewRequest(http.MethodGet, "/", nil), "http://localhost:3000") {
+		t.Fatalf("built-in tenants = %+v, %v; want localhost allowed", tenants, err)
+	}
+}
+
+func TestUnknownTenantIsRefused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(`{"pupuseria": {}, "volcanica": {}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := loadTenants(path, "pupuseria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer()
+	s.cfg.Tenants = tenants
+	h := s.routes()
+
+	for tenant, want := range map[string]int{"": http.StatusOK, "volcanica": http.StatusOK, "acme": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/api/pricing/btc/sources", nil)
+		if tenant != "" {
+			req.Header.Set(tenantkit.Header, tenant)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("tenant %q: status %d, want %d: %s", tenant, rec.Code, want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var (
+	ErrTourNotFound     = errors.New("tour not found")
+	ErrInvalidPartySize = errors.New("party_size must be a positive whole number")
+)
+
+// maxTourPartySize bounds a single tour quote.
+const maxTourPartySize = 100
+
+// Tour is a tour's rate card: a price per person, optionally held between a
+// floor and a ceiling.
+type Tour struct {
+	ID           string `json:"tour_id"`
+	Currency     string `json:"currency"`
+	PriceCents   int64  `json:"price_cents"`
+	FloorCents   int64  `json:"floor_cents,omitempty"`
+	CeilingCents int64  `json:"ceiling_cents,omitempty"`
+}
+
+// TourQuote is the price of a party on a tour and how the per-person price
+// was reached.
+type TourQuote struct {
+	TourID         string       `json:"tour_id"`
+	Currency       string       `json:"currency"`
+	PartySize      int          `json:"party_size"`
+	PerPersonCents int64        `json:"per_person_cents"`
+	PriceCents     int64        `json:"price_cents"`
+	Adjustments    []Adjustment `json:"adjustments"`
+}
+
+// SetTour creates or replaces a tour's rate card.
+func (e *Engine) SetTour(t Tour) Tour {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tours[t.ID] = t
+	return t
+}
+
+// QuoteTour prices partySize people on a tour. The per-person price is
+// bounded with bound, so a tour priced in sats is rounded after its floor
+// and ceiling, then multiplied by the party size.
+func (e *Engine) QuoteTour(id string, partySize int) (TourQuote, error) {
+	if partySize < 1 || partySize > maxTourPartySize {
+		return TourQuote{}, ErrInvalidPartySize
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	t, ok := e.tours[id]
+	if !ok {
+		return TourQuote{}, ErrTourNotFound
+	}
+	q := TourQuote{TourID: t.ID, Currency: t.Currency, PartySize: partySize}
+	q.PerPersonCents, q.Adjustments = e.bound(t.PriceCents, t.FloorCents, t.CeilingCents, strings.EqualFold(t.Currency, DenomSats), []Adjustment{})
+	q.PriceCents = q.PerPersonCents * int64(partySize)
+	return q, nil
+}
+
+func (s *server) putTourHandler(w http.ResponseWriter, r *http.Request) {
+	var t Tour
+	if err := httpkit.DecodeJSON(r, &t); err != nil {
+		httpkit.RespondDecodeError(w, err)
+		return
+	}
+	t.ID = chi.URLParam(r, "tourId")
+	if t.Currency == "" {
+		t.Currency = "USD"
+	}
+	if t.PriceCents <= 0 {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "price_cents must be positive")
+		return
+	}
+	if t.FloorCents < 0 || t.CeilingCents < 0 || (t.CeilingCents > 0 && t.CeilingCents < t.FloorCents) {
+		respondError(w, http.StatusUnprocessableEntity, "invalid_rate", "floor_cents and ceiling_cents must not be negative, and ceiling_cents not below floor_cents")
+		return
+	}
+	respondJSON(w, http.StatusOK, s.engine.SetTour(t))
+}
+
+// getTourPricingHandler prices the ?party_size= people (one when not given)
+// on a tour.
+func (s *server) getTourPricingHandler(w http.ResponseWriter, r *http.Request) {
+	partySize := 1
+	if v := r.URL.Query().Get("party_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_party_size", ErrInvalidPartySize.Error())
+			return
+		}
+		partySize = n
+	}
+	q, err := s.engine.QuoteTour(chi.URLParam(r, "tourId"), partySize)
+	switch {
+	case errors.Is(err, ErrTourNotFound):
+		respondError(w, http.StatusNotFound, "tour_not_found", err.Error())
+	case errors.Is(err, ErrInvalidPartySize):
+		respondError(w, http.StatusBadRequest, "invalid_party_size", err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "internal_error", "internal error")
+	default:
+		respondJSON(w, http.StatusOK, q)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestTourQuoteIsPerPerson(t *testing.T) {
+	h := newTestServer().routes()
+	if rec := doJSON(t, h, http.MethodGet, "/api/pricing/tour/volcano-hike?party_size=2", nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unconfigured tour: status %d, want 404", rec.Code)
+	}
+	if rec := doJSON(t, h, http.MethodPut, "/api/pricing/tour/volcano-hike/config", Tour{PriceCents: 3500, FloorCents: 4000, CeilingCents: 3000}, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("ceiling below floor: status %d, want 422", rec.Code)
+	}
+	doJSON(t, h, http.MethodPut, "/api/pricing/tour/volcano-hike/config", Tour{PriceCents: 3500, FloorCents: 4000}, nil)
+
+	var q TourQuote
+	rec := doJSON(t, h, http.MethodGet, "/api/pricing/tour/volcano-hike?date=2026-06-01&party_size=3", nil, &q)
+	if rec.Code != http.StatusOK || q.Currency != "USD" || q.PerPersonCents != 4000 || q.PriceCents != 12000 {
+		t.Fatalf("status %d, quote %+v; want 3 people at the 4000 floor", rec.Code, q)
+	}
+	if rec := doJSON(t, h, http.MethodGet, "/api/pricing/tour/volcano-hike?party_size=0", nil, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("party of zero: status %d, want 400", rec.Code)
+	}
+}
+
+func TestSatsPricedToursAreRoundedAfterClamping(t *testing.T) {
+	e := NewEngine(EngineOptions{SatsRounding: SatsRounding{Increment: 1000, Mode: SatsRoundNearest, MinimumSats: 10000}})
+	e.SetTour(Tour{ID: "coffee-farm", Currency: "sats", PriceCents: 21337})
+	e.SetTour(Tour{ID: "surf-lesson", Currency: "sats", PriceCents: 50000, CeilingCents: 30600})
+	e.SetTour(Tour{ID: "night-walk", Currency: "sats", PriceCents: 4200})
+	e.SetTour(Tour{ID: "city-tour", Currency: "USD", PriceCents: 4250, CeilingCents: 4200})
+
+	kinds := func(q TourQuote) []string {
+		var out []string
+		for _, a := range q.Adjustments {
+			out = append(out, a.Kind)
+		}
+		return out
+	}
+	tests := []struct {
+		id        string
+		perPerson int64
+		kinds     []string
+	}{
+		{"coffee-farm", 21000, []string{AdjustSatsRounding}},
+		{"surf-lesson", 31000, []string{AdjustCeiling, AdjustSatsRounding}},
+		{"night-walk", 10000, []string{AdjustSatsRounding, AdjustSatsMinimum}},
+		{"city-tour", 4200, []string{AdjustCeiling}},
+	}
+	for _, tt := range tests {
+		q, err := e.QuoteTour(tt.id, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.PerPersonCents != tt.perPerson || q.PriceCents != 2*tt.perPerson || !slices.Equal(kinds(q), tt.kinds) {
+			t.Errorf("%s = %+v, want %d per person after %v", tt.id, q, tt.perPerson, tt.kinds)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 # ── Go Microservice (Multi-stage Build) ──
+# Built from the repository root so the shared packages/gokit module is in
+# the context: docker build -f infra/docker/Dockerfile.go --build-arg SERVICE=payments .
 FROM golang:1.22-alpine AS builder
+ARG SERVICE
 
-WORKDIR /app
-COPY go.mod go.sum* ./
+WORKDIR /src
+COPY packages/gokit ./packages/gokit
+COPY apps/services/${SERVICE}/go.mod apps/services/${SERVICE}/go.sum* ./apps/services/${SERVICE}/
+WORKDIR /src/apps/services/${SERVICE}
 RUN go mod download
-COPY . .
+COPY apps/services/${SERVICE} ./
 RUN CGO_ENABLED=0 GOOS=linux go build -o /service .
 
 FROM alpine:3.20
@@ -0,0 +1,74 @@
+// Package apitypes holds the value types the services share on the wire:
+// timestamps, dates and percentages.
+package apitypes
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// JSONTime is a timestamp in the API's wire format: RFC 3339 in UTC with a
+// trailing Z, to the second. A zero JSONTime is null.
+type JSONTime struct {
+	time.Time
+}
+
+func (t JSONTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.UTC().Format(time.RFC3339))
+}
+
+func (t *JSONTime) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*t = JSONTime{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	*t = JSONTime{parsed.UTC()}
+	return nil
+}
+
+// JSONDate is a calendar date in the API's wire format, YYYY-MM-DD. A zero
+// JSONDate is null.
+type JSONDate struct {
+	time.Time
+}
+
+func (d JSONDate) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.Format(time.DateOnly))
+}
+
+func (d *JSONDate) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*d = JSONDate{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return err
+	}
+	*d = JSONDate{parsed}
+	return nil
+}
+
+// String formats the date as YYYY-MM-DD.
+func (d JSONDate) String() string {
+	return d.Format(time.DateOnly)
+}
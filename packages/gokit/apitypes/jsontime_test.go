@@ -0,0 +1,61 @@
+package apitypes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONTimeMarshalsRFC3339UTC(t *testing.T) {
+	cst := time.FixedZone("CST", -6*60*60)
+	at := JSONTime{time.Date(2026, 3, 14, 9, 4, 5, 987654321, cst)}
+	got, err := json.Marshal(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `"2026-03-14T15:04:05Z"` {
+		t.Fatalf("got %s, want \"2026-03-14T15:04:05Z\"", got)
+	}
+}
+
+func TestJSONDateMarshalsDateOnly(t *testing.T) {
+	got, err := json.Marshal(JSONDate{time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `"2026-03-14"` {
+		t.Fatalf("got %s, want \"2026-03-14\"", got)
+	}
+}
+
+func TestJSONTimeZeroIsNull(t *testing.T) {
+	got, err := json.Marshal(struct {
+		At   JSONTime `json:"at"`
+		Date JSONDate `json:"date"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"at":null,"date":null}` {
+		t.Fatalf("got %s, want nulls", got)
+	}
+}
+
+func TestJSONTimeRoundTrip(t *testing.T) {
+	var v struct {
+		At   JSONTime `json:"at"`
+		Date JSONDate `json:"date"`
+	}
+	if err := json.Unmarshal([]byte(`{"at":"2026-03-14T09:04:05-06:00","date":"2026-03-14"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.At.Location() != time.UTC || !v.At.Equal(time.Date(2026, 3, 14, 15, 4, 5, 0, time.UTC)) {
+		t.Fatalf("at = %v, want 2026-03-14 15:04:05 UTC", v.At.Time)
+	}
+	if v.Date.String() != "2026-03-14" {
+		t.Fatalf("date = %s", v.Date)
+	}
+	if err := json.Unmarshal([]byte(`{"at":"2026-03-14 09:04"}`), &v); err == nil {
+		t.Fatal("expected an error for a non-RFC 3339 timestamp")
+	}
+}
@@ -0,0 +1,97 @@
+package apitypes
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Percent is a percentage stored as integer basis points (1500 = 15.00%), so
+// rates compare exactly and apply to money without floating-point drift.
+type Percent int64
+
+const (
+	BasisPoint     Percent = 1
+	OnePercent     Percent = 100
+	HundredPercent Percent = 10000
+)
+
+var errInvalidPercent = errors.New("percent must be a number with at most two decimals, e.g. 15 or 15.25%")
+
+// ParsePercent reads a percentage such as "15", "15.5" or "15.25%". At most
+// two decimal places are accepted; the value is parsed as a decimal, never
+// through a float.
+func ParsePercent(s string) (Percent, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "%")
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, frac, dot := strings.Cut(s, ".")
+	if !isDigits(whole) || dot && !isDigits(frac) || len(frac) > 2 {
+		return 0, errInvalidPercent
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, errInvalidPercent
+	}
+	f, _ := strconv.ParseInt(frac, 10, 64)
+	p := Percent(w*100 + f)
+	if neg {
+		p = -p
+	}
+	return p, nil
+}
+
+// isDigits reports whether s is one or more ASCII digits, with no sign.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// BasisPoints returns the percentage in hundredths of a percent.
+func (p Percent) BasisPoints() int64 { return int64(p) }
+
+// Of returns p of an amount in cents, rounded to the nearest cent with
+// halves going to the even cent (banker's rounding), so rounding does not
+// drift one way over many amounts.
+func (p Percent) Of(cents int64) int64 {
+	v := cents * int64(p)
+	q, r := v/10000, v%10000 // r carries v's sign
+	switch {
+	case r > 5000 || r == 5000 && q%2 != 0:
+		q++
+	case r < -5000 || r == -5000 && q%2 != 0:
+		q--
+	}
+	return q
+}
+
+// String formats p with two decimals, e.g. "15.00%".
+func (p Percent) String() string {
+	sign := ""
+	if p < 0 {
+		sign, p = "-", -p
+	}
+	return fmt.Sprintf("%s%d.%02d%%", sign, p/100, p%100)
+}
+
+func (p Percent) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Percent) UnmarshalText(b []byte) error {
+	v, err := ParsePercent(string(b))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
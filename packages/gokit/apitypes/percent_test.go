@@ -0,0 +1,57 @@
+package apitypes
+
+import "testing"
+
+func TestPercentOfMoneyIsExact(t *testing.T) {
+	fifteen, err := ParsePercent("15%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fifteen.Of(10000); got != 1500 {
+		t.Fatalf("15%% of $100.00 = %d cents, want 1500", got)
+	}
+	// Half a cent rounds to the even cent.
+	for _, tc := range []struct{ cents, want int64 }{{1, 0}, {3, 2}, {5, 2}, {-1, 0}, {-3, -2}} {
+		if got := (50 * OnePercent).Of(tc.cents); got != tc.want {
+			t.Errorf("50%% of %d cents = %d, want %d", tc.cents, got, tc.want)
+		}
+	}
+	if got := Percent(1250).Of(10); got != 1 {
+		t.Errorf("12.50%% of 10 cents = %d, want 1", got)
+	}
+	if got := fifteen.Of(-10000); got != -1500 {
+		t.Errorf("15%% of -$100.00 = %d, want -1500", got)
+	}
+}
+
+func TestPercentParseFormatRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		bp   int64
+		text string
+	}{
+		{"15", 1500, "15.00%"},
+		{"15%", 1500, "15.00%"},
+		{"15.5", 1550, "15.50%"},
+		{"0.01%", 1, "0.01%"},
+		{"100", 10000, "100.00%"},
+		{"-2.25", -225, "-2.25%"},
+	} {
+		p, err := ParsePercent(tc.in)
+		if err != nil {
+			t.Fatalf("ParsePercent(%q): %v", tc.in, err)
+		}
+		if p.BasisPoints() != tc.bp || p.String() != tc.text {
+			t.Errorf("ParsePercent(%q) = %d bp %q, want %d bp %q", tc.in, p.BasisPoints(), p, tc.bp, tc.text)
+		}
+		back, err := ParsePercent(p.String())
+		if err != nil || back != p {
+			t.Errorf("round trip of %q = %v, %v", p, back, err)
+		}
+	}
+	for _, bad := range []string{"", "abc", "15.123", "1e2", "15.+5", "15.-5", "15.", "--5", "+15", "15. 5"} {
+		if _, err := ParsePercent(bad); err == nil {
+			t.Errorf("ParsePercent(%q) accepted", bad)
+		}
+	}
+}
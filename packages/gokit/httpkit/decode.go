@@ -0,0 +1,106 @@
+package httpkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Codes reported for request bodies that cannot be decoded.
+const (
+	DecodeInvalidJSON  = "invalid_json"
+	DecodeEmptyBody    = "empty_body"
+	DecodeUnknownField = "unknown_field"
+	DecodeInvalidType  = "invalid_type"
+	DecodeInvalidValue = "invalid_value"
+)
+
+// DecodeError explains why a request body was rejected. Code is one of the
+// Decode* constants and Message is safe to show to the client.
+type DecodeError struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *DecodeError) Error() string { return e.Message }
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// DecodeJSON decodes a request body holding exactly one JSON value into v,
+// rejecting fields v does not declare. Failures are returned as a
+// *DecodeError; an empty body unwraps to io.EOF so callers that accept one
+// can check for it.
+func DecodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if dec.More() {
+		return &DecodeError{Code: DecodeInvalidJSON, Message: "request body must contain a single JSON value"}
+	}
+	return nil
+}
+
+func decodeError(err error) *DecodeError {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Code: DecodeEmptyBody, Message: "request body must not be empty", Err: err}
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Code: DecodeInvalidJSON, Message: fmt.Sprintf("request body is not valid JSON (at byte %d)", syntaxErr.Offset), Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Code: DecodeInvalidJSON, Message: "request body is truncated JSON", Err: err}
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "request body"
+		}
+		return &DecodeError{Code: DecodeInvalidType, Message: fmt.Sprintf("%s must be %s, not %s", field, jsonTypeName(typeErr.Type), typeErr.Value), Err: err}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return &DecodeError{Code: DecodeUnknownField, Message: "unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field "), Err: err}
+	default:
+		// Values rejected by a field's own UnmarshalJSON or UnmarshalText,
+		// such as malformed timestamps.
+		return &DecodeError{Code: DecodeInvalidValue, Message: err.Error(), Err: err}
+	}
+}
+
+// jsonTypeName describes a Go type the way a JSON client would.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// RespondDecodeError writes a 400 for an error returned by DecodeJSON.
+func RespondDecodeError(w http.ResponseWriter, err error) {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		RespondError(w, http.StatusBadRequest, de.Code, de.Message)
+		return
+	}
+	RespondError(w, http.StatusBadRequest, DecodeInvalidJSON, "request body must be valid JSON")
+}
@@ -0,0 +1,70 @@
+package httpkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeJSONClassifiesMalformedBodies(t *testing.T) {
+	type payload struct {
+		Name  string    `json:"name"`
+		Count int       `json:"count"`
+		Tags  []string  `json:"tags"`
+		At    time.Time `json:"at"`
+	}
+	tests := []struct {
+		name    string
+		body    string
+		code    string
+		message string
+	}{
+		{"syntax error", `{"name": "a",}`, DecodeInvalidJSON, "at byte"},
+		{"truncated", `{"name": "a"`, DecodeInvalidJSON, "truncated"},
+		{"trailing value", `{"name": "a"} {"name": "b"}`, DecodeInvalidJSON, "single JSON value"},
+		{"empty", ``, DecodeEmptyBody, "must not be empty"},
+		{"unknown field", `{"name": "a", "colour": "red"}`, DecodeUnknownField, `unknown field "colour"`},
+		{"number as string", `{"count": "three"}`, DecodeInvalidType, "count must be a number, not string"},
+		{"object as array", `{"tags": {"a": 1}}`, DecodeInvalidType, "tags must be an array, not object"},
+		{"bad timestamp", `{"at": "yesterday"}`, DecodeInvalidValue, "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p payload
+			err := DecodeJSON(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)), &p)
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("err = %v, want a *DecodeError", err)
+			}
+			if de.Code != tt.code || !strings.Contains(de.Message, tt.message) {
+				t.Fatalf("error = %s %q, want %s mentioning %q", de.Code, de.Message, tt.code, tt.message)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONEmptyBodyIsEOF(t *testing.T) {
+	var v struct{}
+	err := DecodeJSON(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("")), &v)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("err = %v, want io.EOF for callers that accept an empty body", err)
+	}
+}
+
+func TestRespondDecodeErrorWritesEnvelope(t *testing.T) {
+	var v struct {
+		Name string `json:"name"`
+	}
+	rec := httptest.NewRecorder()
+	RespondDecodeError(rec, DecodeJSON(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"colour": "red"}`)), &v))
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusBadRequest || resp["error"] != DecodeUnknownField || resp["message"] == "" {
+		t.Fatalf("status %d, body %v; want 400 %s", rec.Code, resp, DecodeUnknownField)
+	}
+}
@@ -0,0 +1,167 @@
+package httpkit
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadShedding decides when low-priority routes are turned away so that
+// the routes that matter keep working under overload. The service is
+// overloaded while MaxInFlight or more requests are running, or while
+// recent requests average slower than MaxLatency. Zero disables a signal.
+type LoadShedding struct {
+	MaxInFlight int
+	MaxLatency  time.Duration
+	// LowPriority lists the routes shed under overload, as "METHOD
+	// /pattern" or "/pattern" for every method. Patterns are chi-style:
+	// "{id}" matches one segment and a trailing "*" the rest of the path.
+	// Every other route is served whatever the load.
+	LowPriority []string
+}
+
+// LoadSheddingFromEnv reads LOAD_SHED_MAX_IN_FLIGHT, LOAD_SHED_MAX_LATENCY
+// and LOAD_SHED_LOW_PRIORITY_ROUTES, falling back to lowPriority for the
+// service's own preview routes.
+func LoadSheddingFromEnv(lowPriority string) LoadShedding {
+	l := LoadShedding{MaxLatency: TimeoutFromEnv("LOAD_SHED_MAX_LATENCY", 0)}
+	if n, err := strconv.Atoi(os.Getenv("LOAD_SHED_MAX_IN_FLIGHT")); err == nil && n >= 0 {
+		l.MaxInFlight = n
+	}
+	routes := lowPriority
+	if v, ok := os.LookupEnv("LOAD_SHED_LOW_PRIORITY_ROUTES"); ok {
+		routes = v
+	}
+	for _, route := range strings.Split(routes, ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			l.LowPriority = append(l.LowPriority, route)
+		}
+	}
+	return l
+}
+
+// latencyWeight is how much each finished request moves the latency
+// average.
+const latencyWeight = 0.2
+
+// latencyStaleAfter is how long the latency average is trusted without a
+// new request; after it the service is assumed to have recovered, since
+// shed requests never refresh the average.
+const latencyStaleAfter = 10 * time.Second
+
+// LoadShedder tracks the service's load and sheds low-priority requests
+// while it is overloaded. Health checks are neither shed nor counted, so
+// probes keep passing and do not mask the real load.
+type LoadShedder struct {
+	cfg      LoadShedding
+	routes   []routePattern
+	inFlight atomic.Int64
+	now      func() time.Time
+
+	mu         sync.Mutex
+	avgLatency time.Duration
+	lastSample time.Time
+}
+
+// NewLoadShedder returns a LoadShedder for cfg.
+func NewLoadShedder(cfg LoadShedding) *LoadShedder {
+	l := &LoadShedder{cfg: cfg, now: time.Now}
+	for _, route := range cfg.LowPriority {
+		l.routes = append(l.routes, parseRoutePattern(route))
+	}
+	return l
+}
+
+// overloaded reports whether either load signal is over its threshold.
+func (l *LoadShedder) overloaded() bool {
+	if l.cfg.MaxInFlight > 0 && l.inFlight.Load() >= int64(l.cfg.MaxInFlight) {
+		return true
+	}
+	if l.cfg.MaxLatency <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.avgLatency > l.cfg.MaxLatency && l.now().Sub(l.lastSample) < latencyStaleAfter
+}
+
+func (l *LoadShedder) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lastSample.IsZero() {
+		l.avgLatency = d
+	} else {
+		l.avgLatency += time.Duration(latencyWeight * float64(d-l.avgLatency))
+	}
+	l.lastSample = l.now()
+}
+
+func (l *LoadShedder) lowPriority(r *http.Request) bool {
+	for _, p := range l.routes {
+		if p.matches(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware sheds low-priority requests with a 503 and Retry-After while
+// the service is overloaded.
+func (l *LoadShedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if l.lowPriority(r) && l.overloaded() {
+			w.Header().Set("Retry-After", "5")
+			RespondError(w, http.StatusServiceUnavailable, "overloaded", "the service is shedding low-priority requests; retry shortly")
+			return
+		}
+		l.inFlight.Add(1)
+		start := l.now()
+		defer func() {
+			l.inFlight.Add(-1)
+			l.observe(l.now().Sub(start))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routePattern is a parsed LoadShedding.LowPriority entry.
+type routePattern struct {
+	method   string
+	segments []string
+}
+
+func parseRoutePattern(route string) routePattern {
+	var p routePattern
+	if method, path, ok := strings.Cut(route, " "); ok {
+		p.method, route = strings.ToUpper(method), strings.TrimSpace(path)
+	}
+	p.segments = strings.Split(strings.Trim(route, "/"), "/")
+	return p
+}
+
+func (p routePattern) matches(r *http.Request) bool {
+	if p.method != "" && p.method != r.Method {
+		return false
+	}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for i, seg := range p.segments {
+		if seg == "*" {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		if !(strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")) && seg != path[i] {
+			return false
+		}
+	}
+	return len(path) == len(p.segments)
+}
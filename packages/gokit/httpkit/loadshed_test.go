@@ -0,0 +1,82 @@
+package httpkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newShedTestHandler sheds GET /preview/{id} and serves every path with 200.
+func newShedTestHandler(cfg LoadShedding) (*LoadShedder, http.Handler) {
+	cfg.LowPriority = []string{"GET /preview/{id}"}
+	l := NewLoadShedder(cfg)
+	return l, l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+func serveGet(h http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestOverloadShedsOnlyLowPriorityRoutes(t *testing.T) {
+	l, h := newShedTestHandler(LoadShedding{MaxInFlight: 4})
+	if rec := serveGet(h, "/preview/casa-1"); rec.Code == http.StatusServiceUnavailable {
+		t.Fatalf("shed before any load: %s", rec.Body)
+	}
+
+	// Simulate four requests already running.
+	l.inFlight.Add(4)
+	rec := serveGet(h, "/preview/casa-1?checkin=2026-03-01&checkout=2026-03-03")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("low priority under overload: status %d, want 503 with Retry-After", rec.Code)
+	}
+	if rec := serveGet(h, "/book/casa-1"); rec.Code == http.StatusServiceUnavailable {
+		t.Fatalf("high priority route was shed: %s", rec.Body)
+	}
+	if rec := serveGet(h, "/health"); rec.Code != http.StatusOK {
+		t.Fatalf("health check under overload: status %d", rec.Code)
+	}
+
+	l.inFlight.Add(-4)
+	if rec := serveGet(h, "/preview/casa-1"); rec.Code == http.StatusServiceUnavailable {
+		t.Fatal("still shedding after the load dropped")
+	}
+}
+
+func TestSlowResponsesShedUntilTheyGoStale(t *testing.T) {
+	l, h := newShedTestHandler(LoadShedding{MaxLatency: 500 * time.Millisecond})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	l.observe(2 * time.Second)
+	if rec := serveGet(h, "/preview/casa-1"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("low priority while slow: status %d, want 503", rec.Code)
+	}
+	// Nothing but shed requests arrive, so the average goes stale and
+	// previews are let through again.
+	now = now.Add(latencyStaleAfter)
+	if rec := serveGet(h, "/preview/casa-1"); rec.Code == http.StatusServiceUnavailable {
+		t.Fatal("still shedding on a stale latency average")
+	}
+}
+
+func TestRoutePatternMatching(t *testing.T) {
+	tests := []struct {
+		pattern, method, path string
+		want                  bool
+	}{
+		{"GET /api/pricing/rental/{propertyId}", "GET", "/api/pricing/rental/casa-1", true},
+		{"GET /api/pricing/rental/{propertyId}", "PUT", "/api/pricing/rental/casa-1", false},
+		{"GET /api/pricing/rental/{propertyId}", "GET", "/api/pricing/rental/casa-1/nightly", false},
+		{"/api/pricing/rental/*", "PUT", "/api/pricing/rental/casa-1/config", true},
+		{"/api/pricing/rental/*", "GET", "/api/pricing/tour/volcano-hike", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := parseRoutePattern(tt.pattern).matches(r); got != tt.want {
+			t.Errorf("%q matches %s %s = %v, want %v", tt.pattern, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
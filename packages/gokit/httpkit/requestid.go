@@ -0,0 +1,54 @@
+package httpkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader carries the correlation id between services.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID bounds incoming ids to a safe alphabet and length so
+// upstream values cannot inject into logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID reuses a well-formed incoming request id from header (X-Request-ID
+// when empty) or generates a new one, echoes it on the response and stores it
+// in the request context where middleware.Logger and outbound clients pick it
+// up.
+func RequestID(header string) func(http.Handler) http.Handler {
+	if header == "" {
+		header = RequestIDHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(header, id)
+			ctx := context.WithValue(r.Context(), middleware.RequestIDKey, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// PropagateRequestID copies the request id in ctx onto an outbound request.
+func PropagateRequestID(ctx context.Context, req *http.Request) {
+	if id := middleware.GetReqID(ctx); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
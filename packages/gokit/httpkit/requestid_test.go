@@ -0,0 +1,63 @@
+package httpkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// serveWithID runs a request through the middleware and returns the id the
+// handler saw and the id echoed on the response.
+func serveWithID(t *testing.T, incoming string) (seen, echoed string) {
+	t.Helper()
+	h := RequestID("X-Request-ID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.GetReqID(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	if incoming != "" {
+		req.Header.Set("X-Request-ID", incoming)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return seen, rec.Header().Get("X-Request-ID")
+}
+
+func TestRequestIDPreservesValidIncoming(t *testing.T) {
+	seen, echoed := serveWithID(t, "web-7f3a9c:42")
+	if seen != "web-7f3a9c:42" || echoed != seen {
+		t.Fatalf("seen %q echoed %q, want the incoming id", seen, echoed)
+	}
+}
+
+func TestRequestIDGeneratedWhenAbsent(t *testing.T) {
+	seen, echoed := serveWithID(t, "")
+	if len(seen) != 32 || echoed != seen {
+		t.Fatalf("seen %q echoed %q, want a generated 32-char id", seen, echoed)
+	}
+}
+
+func TestRequestIDReplacesMalformed(t *testing.T) {
+	for _, bad := range []string{"abc\nFAKE LOG LINE", "id with spaces", strings.Repeat("a", 129)} {
+		seen, echoed := serveWithID(t, bad)
+		if seen == bad || len(seen) != 32 || echoed != seen {
+			t.Errorf("incoming %q: seen %q echoed %q, want a fresh id", bad, seen, echoed)
+		}
+	}
+}
+
+func TestPropagateRequestIDCopiesContextID(t *testing.T) {
+	var forwarded *http.Request
+	h := RequestID("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = http.NewRequestWithContext(r.Context(), http.MethodGet, "http://upstream.test/", nil)
+		PropagateRequestID(r.Context(), forwarded)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "trace-123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got := forwarded.Header.Get(RequestIDHeader); got != "trace-123" {
+		t.Fatalf("outbound request id = %q, want trace-123", got)
+	}
+}
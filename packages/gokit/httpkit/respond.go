@@ -0,0 +1,24 @@
+// Package httpkit is the HTTP plumbing the services share: the JSON error
+// envelope, request decoding, request ids, load shedding and a server that
+// drains on shutdown.
+package httpkit
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RespondJSON writes data as a JSON response with the given status.
+func RespondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// RespondError writes the standard error envelope.
+func RespondError(w http.ResponseWriter, status int, code, message string) {
+	RespondJSON(w, status, map[string]string{
+		"error":   code,
+		"message": message,
+	})
+}
@@ -0,0 +1,35 @@
+package httpkit
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// routeMethods are the methods checked when listing what a path allows.
+var routeMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// UseJSONErrors makes r, and every router mounted on it, answer unmatched
+// paths and methods with the standard error envelope instead of chi's
+// plain-text defaults. A 405 lists the methods the path does allow.
+func UseJSONErrors(r chi.Router) {
+	r.NotFound(func(w http.ResponseWriter, req *http.Request) {
+		RespondError(w, http.StatusNotFound, "not_found", "no route matches "+req.URL.Path)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, req *http.Request) {
+		var allowed []string
+		for _, m := range routeMethods {
+			if r.Match(chi.NewRouteContext(), m, req.URL.Path) {
+				allowed = append(allowed, m)
+			}
+		}
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+		}
+		RespondError(w, http.StatusMethodNotAllowed, "method_not_allowed", req.Method+" is not allowed on "+req.URL.Path)
+	})
+}
@@ -0,0 +1,34 @@
+package httpkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestUnmatchedRoutesGetJSONErrors(t *testing.T) {
+	r := chi.NewRouter()
+	UseJSONErrors(r)
+	r.Put("/events/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Delete("/events/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		method, path, code, allow string
+		status                    int
+	}{
+		{http.MethodGet, "/nope", "not_found", "", http.StatusNotFound},
+		{http.MethodPost, "/events/fiestas", "method_not_allowed", "PUT, DELETE", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		var body map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != tt.status || body["error"] != tt.code || body["message"] == "" || rec.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s: status %d, body %v, Allow %q", tt.method, tt.path, rec.Code, body, rec.Header().Get("Allow"))
+		}
+	}
+}
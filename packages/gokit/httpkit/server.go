@@ -0,0 +1,124 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServerTimeouts bound how long a connection may spend at each stage, so a
+// slow or stalled client cannot hold it open. Zero disables a timeout.
+type ServerTimeouts struct {
+	// ReadHeader limits how long a client may take to send request
+	// headers; it is what cuts off slowloris clients.
+	ReadHeader time.Duration
+	// Read limits reading the whole request, body included.
+	Read time.Duration
+	// Write limits writing the response. Streaming routes lift it with
+	// Streaming.
+	Write time.Duration
+	// Idle limits how long a keep-alive connection waits for its next
+	// request.
+	Idle time.Duration
+	// Shutdown limits how long in-flight requests may take to finish once
+	// the service is asked to stop. Zero waits for them however long.
+	Shutdown time.Duration
+}
+
+// ServerTimeoutsFromEnv reads HTTP_READ_HEADER_TIMEOUT, HTTP_READ_TIMEOUT,
+// HTTP_WRITE_TIMEOUT, HTTP_IDLE_TIMEOUT and HTTP_SHUTDOWN_TIMEOUT.
+func ServerTimeoutsFromEnv() ServerTimeouts {
+	return ServerTimeouts{
+		ReadHeader: TimeoutFromEnv("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		Read:       TimeoutFromEnv("HTTP_READ_TIMEOUT", 30*time.Second),
+		Write:      TimeoutFromEnv("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		Idle:       TimeoutFromEnv("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		Shutdown:   TimeoutFromEnv("HTTP_SHUTDOWN_TIMEOUT", 15*time.Second),
+	}
+}
+
+// TimeoutFromEnv reads a duration such as "30s" from key, falling back when
+// it is unset, malformed or negative.
+func TimeoutFromEnv(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v >= 0 {
+		return v
+	}
+	return fallback
+}
+
+// NewServer returns a server for h on addr with timeouts applied.
+func NewServer(addr string, h http.Handler, t ServerTimeouts) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: t.ReadHeader,
+		ReadTimeout:       t.Read,
+		WriteTimeout:      t.Write,
+		IdleTimeout:       t.Idle,
+	}
+}
+
+// Streaming lifts the read and write deadlines for a long-lived response,
+// such as a server-sent event stream or a WebSocket upgrade, which would
+// otherwise be cut off by the server's timeouts. The headers were already
+// read in full before the handler runs, so slow clients stay bounded.
+func Streaming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		// Errors mean the writer cannot hold deadlines, e.g. in tests, and
+		// there is nothing to lift.
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run serves h on port until the process receives SIGINT or SIGTERM,
+// then drains in-flight requests before returning, so a deploy does not cut
+// a webhook or booking off halfway.
+func Run(h http.Handler, port string, t ServerTimeouts) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	addr := fmt.Sprintf(":%s", port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return serveUntil(ctx, NewServer(addr, h, t), ln, t.Shutdown)
+}
+
+// serveUntil serves on ln until ctx is done, then stops accepting
+// connections and waits up to drain for open requests to complete. Those
+// still running after it are cut off.
+func serveUntil(ctx context.Context, srv *http.Server, ln net.Listener, drain time.Duration) error {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down: draining in-flight requests")
+	shutdownCtx := context.Background()
+	if drain > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, drain)
+		defer cancel()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("requests still running after %s were cut off: %w", drain, err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package httpkit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTest runs h behind NewServer on a loopback port and returns its
+// address.
+func serveTest(t *testing.T, h http.Handler, timeouts ServerTimeouts) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(ln.Addr().String(), h, timeouts)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestSlowHeadersCutOffAtReadHeaderTimeout(t *testing.T) {
+	addr := serveTest(t, http.NotFoundHandler(), ServerTimeouts{ReadHeader: 100 * time.Millisecond})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Start a request and never finish its headers.
+	fmt.Fprint(conn, "GET /health HTTP/1.1\r\nHost: example\r\n")
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.ReadAll(conn)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		t.Fatal("connection still open after 2s, want it closed at the read-header timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("closed after %s, want about 100ms", elapsed)
+	}
+}
+
+func TestStreamingOutlivesWriteTimeout(t *testing.T) {
+	const events = 5
+	sse := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < events; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(60 * time.Millisecond)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/stream", Streaming(sse))
+	mux.Handle("/plain", sse)
+	addr := serveTest(t, mux, ServerTimeouts{ReadHeader: time.Second, Read: 100 * time.Millisecond, Write: 100 * time.Millisecond})
+
+	read := func(path string) int {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		n := 0
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if strings.HasPrefix(sc.Text(), "data: ") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// The stream runs three times longer than the timeouts and still
+	// delivers every event.
+	if got := read("/stream"); got != events {
+		t.Fatalf("stream delivered %d events, want %d", got, events)
+	}
+	// Without streaming the write timeout ends the same response early.
+	if got := read("/plain"); got >= events {
+		t.Fatalf("plain response delivered %d events, want it cut off", got)
+	}
+}
+
+// startServing runs h behind serveUntil on a loopback port until the
+// returned cancel is called, and reports serveUntil's result on done.
+func startServing(t *testing.T, h http.Handler, drain time.Duration) (addr string, cancel context.CancelFunc, done <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() { errc <- serveUntil(ctx, NewServer(ln.Addr().String(), h, ServerTimeouts{}), ln, drain) }()
+	return ln.Addr().String(), cancel, errc
+}
+
+func TestShutdownDrainsInFlightRequest(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "processed")
+	})
+	addr, shutdown, done := startServing(t, h, 5*time.Second)
+
+	type result struct {
+		body string
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/webhook")
+		if err != nil {
+			resc <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resc <- result{string(body), err}
+	}()
+	<-started
+	shutdown()
+
+	select {
+	case err := <-done:
+		t.Fatalf("server stopped with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Fatal("server still accepting connections while draining")
+	}
+
+	close(release)
+	if res := <-resc; res.err != nil || res.body != "processed" {
+		t.Fatalf("in-flight request: body %q err %v, want it to complete", res.body, res.err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestShutdownCutsOffRequestsAfterDrainTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	addr, shutdown, done := startServing(t, h, 50*time.Millisecond)
+	go http.Get("http://" + addr + "/stuck")
+	<-started
+	shutdown()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("shutdown reported success with a request cut off")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown did not give up after the drain timeout")
+	}
+}
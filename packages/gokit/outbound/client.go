@@ -0,0 +1,277 @@
+// Package outbound is the client side of calls to external integrations:
+// retries, per-integration concurrency limits and latency metrics.
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// Metrics records the latency and retry behaviour of calls to
+// external integrations so SLO alerts can be set per dependency.
+type Metrics struct {
+	duration *prometheus.HistogramVec
+	retries  *prometheus.CounterVec
+}
+
+// NewMetrics registers the outbound metrics with reg.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "external_request_duration_seconds",
+			Help:    "Duration of outbound requests to external integrations.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"integration", "status"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "external_request_retries_total",
+			Help: "Retries issued for outbound requests to external integrations.",
+		}, []string{"integration"}),
+	}
+	reg.MustRegister(m.duration, m.retries)
+	return m
+}
+
+var defaultMetrics = NewMetrics(prometheus.DefaultRegisterer)
+
+// ErrIntegrationBusy is returned instead of queueing when an integration in
+// fail-fast mode already has its maximum number of calls in flight.
+var ErrIntegrationBusy = errors.New("integration busy")
+
+// SaturationMode decides what a call does when its integration is at its
+// concurrency limit.
+type SaturationMode string
+
+const (
+	// SaturationQueue waits for a slot, or until the request is cancelled.
+	SaturationQueue SaturationMode = "queue"
+	// SaturationFail returns ErrIntegrationBusy immediately.
+	SaturationFail SaturationMode = "fail"
+)
+
+// ConcurrencyLimit caps the calls in flight to one integration.
+type ConcurrencyLimit struct {
+	Max  int64          `json:"max"`
+	Mode SaturationMode `json:"mode"`
+}
+
+func (l ConcurrencyLimit) validate() error {
+	if l.Max < 1 {
+		return fmt.Errorf("must allow at least 1 concurrent call, got %d", l.Max)
+	}
+	if l.Mode != SaturationQueue && l.Mode != SaturationFail {
+		return fmt.Errorf("unknown saturation mode %q (want queue or fail)", l.Mode)
+	}
+	return nil
+}
+
+// ParseConcurrencyLimits reads a list such as "stripe=8,coingecko=2:fail".
+// Entries without a mode use defaultMode. Malformed entries are kept with a
+// zero Max so validation reports them rather than silently lifting a limit.
+func ParseConcurrencyLimits(spec string, defaultMode SaturationMode) map[string]ConcurrencyLimit {
+	limits := make(map[string]ConcurrencyLimit)
+	for _, entry := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			continue
+		}
+		limit := ConcurrencyLimit{Mode: defaultMode}
+		if max, mode, ok := strings.Cut(value, ":"); ok {
+			value, limit.Mode = max, SaturationMode(mode)
+		}
+		limit.Max, _ = strconv.ParseInt(value, 10, 64)
+		limits[strings.ToLower(name)] = limit
+	}
+	return limits
+}
+
+// ValidateConcurrencyLimits reports the first invalid limit, naming its
+// integration.
+func ValidateConcurrencyLimits(limits map[string]ConcurrencyLimit) error {
+	for name, l := range limits {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("INTEGRATION_CONCURRENCY %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// concurrencyLimiter is a weighted semaphore guarding one integration.
+type concurrencyLimiter struct {
+	sem  *semaphore.Weighted
+	mode SaturationMode
+}
+
+func newConcurrencyLimiter(l ConcurrencyLimit) *concurrencyLimiter {
+	return &concurrencyLimiter{sem: semaphore.NewWeighted(l.Max), mode: l.Mode}
+}
+
+func (l *concurrencyLimiter) acquire(ctx context.Context, weight int64) error {
+	if l.mode == SaturationFail {
+		if !l.sem.TryAcquire(weight) {
+			return ErrIntegrationBusy
+		}
+		return nil
+	}
+	return l.sem.Acquire(ctx, weight)
+}
+
+func (l *concurrencyLimiter) release(weight int64) {
+	l.sem.Release(weight)
+}
+
+// integrationLimiters holds one limiter per limited integration, shared by
+// every client of that integration in the process.
+var integrationLimiters struct {
+	mu sync.Mutex
+	m  map[string]*concurrencyLimiter
+}
+
+// SetIntegrationLimits installs the configured limits. Clients pick up their
+// integration's limiter when they are constructed, so it must run first.
+func SetIntegrationLimits(limits map[string]ConcurrencyLimit) {
+	m := make(map[string]*concurrencyLimiter, len(limits))
+	for name, l := range limits {
+		m[name] = newConcurrencyLimiter(l)
+	}
+	integrationLimiters.mu.Lock()
+	integrationLimiters.m = m
+	integrationLimiters.mu.Unlock()
+}
+
+func limiterFor(integration string) *concurrencyLimiter {
+	integrationLimiters.mu.Lock()
+	defer integrationLimiters.mu.Unlock()
+	return integrationLimiters.m[integration]
+}
+
+// Client wraps http.Client for calls to a single named integration,
+// retrying transient failures and recording every attempt's outcome.
+type Client struct {
+	// MaxRetries is how many times a transient failure is retried.
+	MaxRetries int
+	// Backoff is the wait before the first retry, growing linearly.
+	Backoff time.Duration
+	// Metrics receives every call's outcome.
+	Metrics *Metrics
+
+	integration string
+	client      *http.Client
+	// limiter, when set, bounds this integration's calls in flight.
+	limiter *concurrencyLimiter
+}
+
+// NewClient returns a Client for integration whose attempts each time out
+// after timeout.
+func NewClient(integration string, timeout time.Duration) *Client {
+	return &Client{
+		MaxRetries:  2,
+		Backoff:     200 * time.Millisecond,
+		Metrics:     defaultMetrics,
+		integration: integration,
+		client:      &http.Client{Timeout: timeout},
+		limiter:     limiterFor(integration),
+	}
+}
+
+// Do sends req, retrying network errors and 5xx/429 responses when the body
+// can be replayed, and forwards the caller's request id. The final response
+// (or error) is returned to the caller. When the integration is at its
+// concurrency limit, Do waits for a slot or fails with ErrIntegrationBusy,
+// as configured; the slot is held across retries.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	httpkit.PropagateRequestID(req.Context(), req)
+	start := time.Now()
+	if c.limiter != nil {
+		if err := c.limiter.acquire(req.Context(), 1); err != nil {
+			c.observe(req, start, 0, 0, err)
+			return nil, err
+		}
+		defer c.limiter.release(1)
+	}
+	var (
+		resp    *http.Response
+		err     error
+		retries int
+	)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if req.Body != nil {
+				body, gerr := req.GetBody()
+				if gerr != nil {
+					resp, err = nil, gerr
+					break
+				}
+				req.Body = body
+			}
+			retries++
+			c.Metrics.retries.WithLabelValues(c.integration).Inc()
+			select {
+			case <-req.Context().Done():
+				err = req.Context().Err()
+				c.observe(req, start, 0, retries, err)
+				return nil, err
+			case <-time.After(c.Backoff * time.Duration(attempt)):
+			}
+		}
+
+		resp, err = c.client.Do(req)
+		if !c.retryable(req, resp, err) || attempt == c.MaxRetries {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.observe(req, start, status, retries, err)
+	return resp, err
+}
+
+func (c *Client) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+func (c *Client) observe(req *http.Request, start time.Time, status, retries int, err error) {
+	elapsed := time.Since(start)
+	label := "error"
+	if err == nil {
+		label = strconv.Itoa(status)
+	}
+	c.Metrics.duration.WithLabelValues(c.integration, label).Observe(elapsed.Seconds())
+
+	attrs := []any{
+		"integration", c.integration,
+		"method", req.Method,
+		"host", req.URL.Host,
+		"status", label,
+		"duration_ms", elapsed.Milliseconds(),
+		"retries", retries,
+	}
+	if err != nil {
+		slog.Warn("external call failed", append(attrs, "error", err)...)
+		return
+	}
+	slog.Info("external call", attrs...)
+}
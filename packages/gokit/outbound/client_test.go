@@ -0,0 +1,241 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// histogramCount returns the number of observations recorded for the given
+// integration label in the registry's duration histogram.
+func histogramCount(t *testing.T, reg *prometheus.Registry, integration string) uint64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total uint64
+	for _, f := range families {
+		if f.GetName() != "external_request_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if labelValue(m, "integration") == integration {
+				total += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return total
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// newTestClient returns a Client for integration that records into reg and
+// retries without waiting.
+func newTestClient(integration string, reg *prometheus.Registry) *Client {
+	c := NewClient(integration, time.Second)
+	c.Metrics = NewMetrics(reg)
+	c.Backoff = 0
+	return c
+}
+
+func get(t *testing.T, c *Client, url string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestClientRecordsDurationPerIntegration(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"bitcoin":{"usd":65000}}`))
+	}))
+	defer upstream.Close()
+
+	reg := prometheus.NewRegistry()
+	get(t, newTestClient("coingecko", reg), upstream.URL)
+	if got := histogramCount(t, reg, "coingecko"); got != 1 {
+		t.Fatalf("coingecko observations = %d, want 1", got)
+	}
+	if got := histogramCount(t, reg, "stripe"); got != 0 {
+		t.Fatalf("stripe observations = %d, want 0", got)
+	}
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"bitcoin":{"usd":65000}}`))
+	}))
+	defer upstream.Close()
+
+	reg := prometheus.NewRegistry()
+	get(t, newTestClient("coingecko", reg), upstream.URL)
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("upstream calls = %d, want 2", calls)
+	}
+	families, _ := reg.Gather()
+	for _, f := range families {
+		if f.GetName() == "external_request_retries_total" {
+			if got := f.GetMetric()[0].GetCounter().GetValue(); got != 1 {
+				t.Fatalf("retries = %v, want 1", got)
+			}
+			return
+		}
+	}
+	t.Fatal("retry counter not registered")
+}
+
+func TestClientForwardsRequestID(t *testing.T) {
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Request-ID")
+	}))
+	defer upstream.Close()
+
+	h := httpkit.RequestID("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL, nil)
+		resp, err := newTestClient("test", prometheus.NewRegistry()).Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "trace-123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if forwarded != "trace-123" {
+		t.Fatalf("upstream saw request id %q, want trace-123", forwarded)
+	}
+}
+
+// blockingUpstream holds every request open until release is closed and
+// reports each arrival on arrived.
+func blockingUpstream(t *testing.T) (url string, arrived chan struct{}, release chan struct{}) {
+	t.Helper()
+	arrived, release = make(chan struct{}, 10), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, arrived, release
+}
+
+func limitedClient(limit ConcurrencyLimit) *Client {
+	c := NewClient("limited", time.Second)
+	c.Metrics = NewMetrics(prometheus.NewRegistry())
+	c.limiter = newConcurrencyLimiter(limit)
+	return c
+}
+
+func TestClientFailsFastWhenSaturated(t *testing.T) {
+	url, arrived, release := blockingUpstream(t)
+	c := limitedClient(ConcurrencyLimit{Max: 1, Mode: SaturationFail})
+
+	first := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		first <- err
+	}()
+	<-arrived
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if _, err := c.Do(req); !errors.Is(err, ErrIntegrationBusy) {
+		t.Fatalf("second call: err = %v, want ErrIntegrationBusy", err)
+	}
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+}
+
+func TestClientQueuesWhenSaturated(t *testing.T) {
+	url, arrived, release := blockingUpstream(t)
+	c := limitedClient(ConcurrencyLimit{Max: 1, Mode: SaturationQueue})
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			resp, err := c.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			done <- err
+		}()
+	}
+	<-arrived
+	select {
+	case <-arrived:
+		t.Fatal("second call reached the upstream while the first held the only slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("queued call: %v", err)
+		}
+	}
+}
+
+func TestClientQueueHonoursCancellation(t *testing.T) {
+	url, arrived, release := blockingUpstream(t)
+	defer close(release)
+	c := limitedClient(ConcurrencyLimit{Max: 1, Mode: SaturationQueue})
+
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if resp, err := c.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-arrived
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if _, err := c.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestParseConcurrencyLimits(t *testing.T) {
+	got := ParseConcurrencyLimits("stripe=8, CoinGecko=2:fail,lnd=x", SaturationQueue)
+	if got["stripe"] != (ConcurrencyLimit{Max: 8, Mode: SaturationQueue}) {
+		t.Fatalf("stripe = %+v", got["stripe"])
+	}
+	if got["coingecko"] != (ConcurrencyLimit{Max: 2, Mode: SaturationFail}) {
+		t.Fatalf("coingecko = %+v", got["coingecko"])
+	}
+	if err := ValidateConcurrencyLimits(got); err == nil {
+		t.Fatal("malformed lnd limit passed validation")
+	}
+}
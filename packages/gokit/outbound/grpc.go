@@ -0,0 +1,58 @@
+package outbound
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+// UnaryInterceptor gives gRPC calls to integration what Client gives HTTP
+// ones: the integration's concurrency limit, the caller's request id and a
+// duration recorded in m, or the default metrics when m is nil. Calls are
+// not retried; a gRPC call that failed may still have taken effect.
+func UnaryInterceptor(integration string, m *Metrics) grpc.UnaryClientInterceptor {
+	if m == nil {
+		m = defaultMetrics
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		if l := limiterFor(integration); l != nil {
+			if err := l.acquire(ctx, 1); err != nil {
+				observeGRPC(m, integration, method, start, err)
+				return err
+			}
+			defer l.release(1)
+		}
+		if id := middleware.GetReqID(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, httpkit.RequestIDHeader, id)
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		observeGRPC(m, integration, method, start, err)
+		return err
+	}
+}
+
+func observeGRPC(m *Metrics, integration, method string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	label := status.Code(err).String()
+	m.duration.WithLabelValues(integration, label).Observe(elapsed.Seconds())
+
+	attrs := []any{
+		"integration", integration,
+		"method", method,
+		"status", label,
+		"duration_ms", elapsed.Milliseconds(),
+	}
+	if err != nil {
+		slog.Warn("external call failed", append(attrs, "error", err)...)
+		return
+	}
+	slog.Info("external call", attrs...)
+}
@@ -0,0 +1,59 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryInterceptorForwardsRequestIDAndRecords(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	intercept := UnaryInterceptor("lnd", NewMetrics(reg))
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "trace-123")
+
+	var forwarded []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		forwarded = md.Get("x-request-id")
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+	err := intercept(ctx, "/lnrpc.Lightning/GetInfo", nil, nil, nil, invoker)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("err = %v, want the invoker's", err)
+	}
+	if len(forwarded) != 1 || forwarded[0] != "trace-123" {
+		t.Fatalf("forwarded request id %v, want trace-123", forwarded)
+	}
+	if got := histogramCount(t, reg, "lnd"); got != 1 {
+		t.Fatalf("lnd observations = %d, want 1", got)
+	}
+}
+
+func TestUnaryInterceptorFailsFastWhenSaturated(t *testing.T) {
+	SetIntegrationLimits(map[string]ConcurrencyLimit{"lnd": {Max: 1, Mode: SaturationFail}})
+	t.Cleanup(func() { SetIntegrationLimits(nil) })
+	intercept := UnaryInterceptor("lnd", NewMetrics(prometheus.NewRegistry()))
+
+	// The first call holds the only slot while the second is attempted.
+	var second error
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		second = intercept(ctx, method, nil, nil, nil, func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			t.Fatal("second call reached the node")
+			return nil
+		})
+		return nil
+	}
+	if err := intercept(context.Background(), "/lnrpc.Lightning/GetInfo", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(second, ErrIntegrationBusy) {
+		t.Fatalf("second call: err = %v, want ErrIntegrationBusy", second)
+	}
+}
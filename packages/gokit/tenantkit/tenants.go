@@ -0,0 +1,194 @@
+// Package tenantkit works out which tenant, one of the brands the platform
+// serves, a request is for. Each service keeps its own tenant type with
+// the settings it needs; tenantkit holds them by id, resolves requests to
+// them and carries the result through the request's context.
+package tenantkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pupuseria/gateway-es/packages/gokit/httpkit"
+)
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// Header names the tenant a request is for. Services forward it on the
+// calls they make to each other so every one acts for the same tenant.
+const Header = "X-Tenant-ID"
+
+// DefaultID is the built-in tenant served when no tenants file is
+// configured.
+const DefaultID = "pupuseria"
+
+// LocalOrigins are where the built-in tenant's storefronts run in
+// development.
+var LocalOrigins = []string{"http://localhost:3000", "http://localhost:8000"}
+
+// Tenant is what tenantkit needs of a service's tenant type.
+type Tenant interface {
+	TenantID() string
+	// AllowedOrigins are the web origins browsers may call the API from
+	// for the tenant.
+	AllowedOrigins() []string
+}
+
+// Tenants are the brands served, by id. Requests that name no tenant are
+// served as the default one.
+type Tenants[T Tenant] struct {
+	byID      map[string]T
+	defaultID string
+}
+
+// New serves tenants, with the one whose id is defaultID as the default.
+// With no defaultID every request must name its tenant.
+func New[T Tenant](defaultID string, tenants ...T) Tenants[T] {
+	t := Tenants[T]{byID: make(map[string]T, len(tenants)), defaultID: strings.ToLower(defaultID)}
+	for _, tenant := range tenants {
+		t.byID[strings.ToLower(tenant.TenantID())] = tenant
+	}
+	return t
+}
+
+// Load reads the tenants from the JSON file at path, which maps tenant ids
+// to their settings: {"pupuseria": {"cors_origins":
+// ["https://pupuseria.sv"], ...}}. Every service reads the same file and
+// takes the settings its tenant type has. prepare is given each tenant
+// with its lowercased id, to set the id and check the service's own
+// settings. Without a file only builtin is served, as the default.
+// defaultID, when set, must name one of the tenants.
+func Load[T Tenant](path, defaultID string, builtin T, prepare func(id string, tenant T) (T, error)) (Tenants[T], error) {
+	if path == "" {
+		if defaultID != "" && !strings.EqualFold(defaultID, builtin.TenantID()) {
+			return Tenants[T]{}, fmt.Errorf("DEFAULT_TENANT %q: %w", defaultID, ErrUnknownTenant)
+		}
+		return New(builtin.TenantID(), builtin), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Tenants[T]{}, fmt.Errorf("tenants: %w", err)
+	}
+	var file map[string]T
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Tenants[T]{}, fmt.Errorf("tenants %s: %w", path, err)
+	}
+	t := Tenants[T]{byID: make(map[string]T, len(file)), defaultID: strings.ToLower(defaultID)}
+	for id, tenant := range file {
+		id = strings.ToLower(id)
+		if tenant, err = prepare(id, tenant); err != nil {
+			return Tenants[T]{}, fmt.Errorf("tenants %s: tenant %s %w", path, id, err)
+		}
+		t.byID[id] = tenant
+	}
+	if _, ok := t.byID[t.defaultID]; t.defaultID != "" && !ok {
+		return Tenants[T]{}, fmt.Errorf("DEFAULT_TENANT %q: %w", defaultID, ErrUnknownTenant)
+	}
+	return t, nil
+}
+
+// Len is how many tenants are served.
+func (t Tenants[T]) Len() int {
+	return len(t.byID)
+}
+
+// All returns every tenant served, ordered by id.
+func (t Tenants[T]) All() []T {
+	ids := make([]string, 0, len(t.byID))
+	for id := range t.byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	all := make([]T, len(ids))
+	for i, id := range ids {
+		all[i] = t.byID[id]
+	}
+	return all
+}
+
+// Lookup returns the tenant with the given id.
+func (t Tenants[T]) Lookup(id string) (T, bool) {
+	tenant, ok := t.byID[strings.ToLower(id)]
+	return tenant, ok
+}
+
+// Default returns the default tenant, or the zero T when there is none.
+func (t Tenants[T]) Default() T {
+	return t.byID[t.defaultID]
+}
+
+// Resolve finds the tenant r is for: the one named by Header, else the one
+// whose id is the first label of a subdomain host such as
+// acme.marketplace.example, else the default. A tenant named in the header
+// must exist.
+func (t Tenants[T]) Resolve(r *http.Request) (T, error) {
+	var none T
+	if id := strings.TrimSpace(r.Header.Get(Header)); id != "" {
+		if tenant, ok := t.Lookup(id); ok {
+			return tenant, nil
+		}
+		return none, fmt.Errorf("%w %q", ErrUnknownTenant, id)
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if labels := strings.Split(host, "."); len(labels) >= 3 {
+		if tenant, ok := t.Lookup(labels[0]); ok {
+			return tenant, nil
+		}
+	}
+	if tenant, ok := t.byID[t.defaultID]; ok {
+		return tenant, nil
+	}
+	return none, fmt.Errorf("%w: name one in the %s header", ErrUnknownTenant, Header)
+}
+
+// AllowOrigin lets browsers on r's tenant's own origins call the API. It
+// suits cors.Options.AllowOriginFunc.
+func (t Tenants[T]) AllowOrigin(r *http.Request, origin string) bool {
+	tenant, err := t.Resolve(r)
+	return err == nil && slices.Contains(tenant.AllowedOrigins(), origin)
+}
+
+type contextKey struct{}
+
+// Middleware attaches the request's tenant to its context, answering 404
+// unknown_tenant for tenants not served.
+func (t Tenants[T]) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := t.Resolve(r)
+		if err != nil {
+			httpkit.RespondError(w, http.StatusNotFound, "unknown_tenant", err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
+
+// WithTenant acts for tenant in ctx, as when work for a tenant happens
+// outside the request that started it.
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant ctx acts for.
+func FromContext[T Tenant](ctx context.Context) (T, bool) {
+	tenant, ok := ctx.Value(contextKey{}).(T)
+	return tenant, ok
+}
+
+// Propagate names ctx's tenant on an outbound request to a sibling
+// service.
+func Propagate(ctx context.Context, req *http.Request) {
+	if tenant, ok := ctx.Value(contextKey{}).(Tenant); ok {
+		req.Header.Set(Header, tenant.TenantID())
+	}
+}
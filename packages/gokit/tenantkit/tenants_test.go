@@ -0,0 +1,166 @@
+package tenantkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testTenant struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	CORSOrigins []string `json:"cors_origins"`
+}
+
+func (t testTenant) TenantID() string         { return t.ID }
+func (t testTenant) AllowedOrigins() []string { return t.CORSOrigins }
+
+var builtin = testTenant{ID: DefaultID, CORSOrigins: LocalOrigins}
+
+func setID(id string, t testTenant) (testTenant, error) {
+	if t.Name == "" {
+		return t, errors.New("needs a name")
+	}
+	t.ID = id
+	return t, nil
+}
+
+func loadTestTenants(t *testing.T, file, defaultID string) (Tenants[testTenant], error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path, defaultID, builtin, setID)
+}
+
+const testFile = `{
+	"Pupuseria": {"name": "PupuserIA", "cors_origins": ["https://pupuseria.sv"]},
+	"volcanica": {"name": "Volcánica", "cors_origins": ["https://volcanica.example"]}
+}`
+
+func TestResolve(t *testing.T) {
+	tenants, err := loadTestTenants(t, testFile, "pupuseria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header, host, want string
+		unknown            bool
+	}{
+		{"volcanica", "api.example", "volcanica", false},
+		{" VOLCANICA ", "pupuseria.marketplace.example", "volcanica", false},
+		{"", "volcanica.marketplace.example:443", "volcanica", false},
+		{"", "nobody.marketplace.example", "pupuseria", false},
+		{"", "localhost:8002", "pupuseria", false},
+		{"acme", "volcanica.marketplace.example", "", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tt.host
+		if tt.header != "" {
+			r.Header.Set(Header, tt.header)
+		}
+		got, err := tenants.Resolve(r)
+		if tt.unknown {
+			if !errors.Is(err, ErrUnknownTenant) {
+				t.Errorf("header %q host %q: err %v, want ErrUnknownTenant", tt.header, tt.host, err)
+			}
+			continue
+		}
+		if err != nil || got.ID != tt.want {
+			t.Errorf("header %q host %q: %q, %v; want %q", tt.header, tt.host, got.ID, err, tt.want)
+		}
+	}
+
+	// Without a default a request must name its tenant.
+	noDefault := New("", testTenant{ID: "volcanica"})
+	if _, err := noDefault.Resolve(httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("no default: err %v, want ErrUnknownTenant", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := loadTestTenants(t, testFile, "acme"); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("unknown default: err %v", err)
+	}
+	if _, err := loadTestTenants(t, `{"acme": {}}`, ""); err == nil {
+		t.Fatal("accepted a tenant prepare refused")
+	}
+	if _, err := loadTestTenants(t, `{"acme": [`, ""); err == nil {
+		t.Fatal("accepted malformed JSON")
+	}
+	tenants, err := loadTestTenants(t, testFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := tenants.All()
+	if tenants.Len() != 2 || len(all) != 2 || all[0].ID != "pupuseria" || all[1].ID != "volcanica" {
+		t.Fatalf("tenants = %+v, want pupuseria and volcanica by lowercased id", all)
+	}
+
+	// Without a file only the built-in tenant is served.
+	if _, err := Load("", "volcanica", builtin, setID); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("built-in with unknown default: err %v", err)
+	}
+	tenants, err = Load("", "", builtin, setID)
+	if err != nil || tenants.Len() != 1 || tenants.Default().ID != DefaultID {
+		t.Fatalf("built-in = %+v, %v", tenants.All(), err)
+	}
+}
+
+func TestAllowOrigin(t *testing.T) {
+	tenants, err := loadTestTenants(t, testFile, "pupuseria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		tenant, origin string
+		want           bool
+	}{
+		{"volcanica", "https://volcanica.example", true},
+		{"volcanica", "https://pupuseria.sv", false},
+		{"", "https://pupuseria.sv", true},
+		{"", "http://localhost:3000", false},
+		{"acme", "https://pupuseria.sv", false},
+	} {
+		r := httptest.NewRequest(http.MethodOptions, "/", nil)
+		if tt.tenant != "" {
+			r.Header.Set(Header, tt.tenant)
+		}
+		if got := tenants.AllowOrigin(r, tt.origin); got != tt.want {
+			t.Errorf("tenant %q origin %s: %v, want %v", tt.tenant, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareCarriesTheTenant(t *testing.T) {
+	tenants := New(DefaultID, builtin, testTenant{ID: "volcanica"})
+	var seen string
+	h := tenants.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ := FromContext[testTenant](r.Context())
+		seen = tenant.ID
+		out := httptest.NewRequest(http.MethodGet, "/", nil)
+		Propagate(r.Context(), out)
+		w.Header().Set("Forwarded-Tenant", out.Header.Get(Header))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(Header, "volcanica")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || seen != "volcanica" || rec.Header().Get("Forwarded-Tenant") != "volcanica" {
+		t.Fatalf("status %d, tenant %q, forwarded %q", rec.Code, seen, rec.Header().Get("Forwarded-Tenant"))
+	}
+
+	r.Header.Set(Header, "acme")
+	rec = httptest.NewRecorder()
+	seen = ""
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound || seen != "" {
+		t.Fatalf("unknown tenant: status %d, handler saw %q", rec.Code, seen)
+	}
+}